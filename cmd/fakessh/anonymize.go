@@ -0,0 +1,113 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/privacy"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	anonymizeConfigFile       string
+	anonymizeOut              string
+	anonymizeFormat           string
+	anonymizeColumns          []string
+	anonymizeIPMode           string
+	anonymizeIPKey            string
+	anonymizeIPKeyFile        string
+	anonymizePasswordMode     string
+	anonymizePasswordKey      string
+	anonymizePasswordKeyFile  string
+	anonymizePasswordTruncate int
+	anonymizeDrop             []string
+)
+
+// anonymizeCmd rewrites logs for publication
+var anonymizeCmd = &cobra.Command{
+	Use:   "anonymize [flags] [FILE...]",
+	Short: "Anonymize credential logs for sharing",
+	Long: `Rewrite credential logs so they can be published: source addresses are
+anonymized and passwords hashed or redacted wherever they appear, including
+the sources of spray events and IP indicators, and fields locating the
+source more precisely, like its reverse DNS name, are dropped.
+
+The keyed modes, cryptopan for addresses and hmac for passwords, map a value
+to the same result in every event, so attempts of one source or with one
+password can still be linked. Keep the keys secret and reuse them to
+anonymize later logs consistently; use different keys for addresses and
+passwords. Passwords already masked by the sensor are kept, unless redacted.
+
+Without files, the log of the configuration is read; "-" reads standard
+input.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths, times, err := logPaths(anonymizeConfigFile, args)
+		if err != nil {
+			return err
+		}
+
+		ipKey, err := config.ReadSecret(anonymizeIPKey, anonymizeIPKeyFile)
+		if err != nil {
+			return err
+		}
+		ip, err := privacy.NewIPAnonymizer(anonymizeIPMode, ipKey)
+		if err != nil {
+			return err
+		}
+		passwordKey, err := config.ReadSecret(anonymizePasswordKey, anonymizePasswordKeyFile)
+		if err != nil {
+			return err
+		}
+		password, err := privacy.NewPasswordMasker(anonymizePasswordMode, passwordKey, anonymizePasswordTruncate)
+		if err != nil {
+			return err
+		}
+		dataset := privacy.NewDataset(privacy.DatasetConfig{
+			IP:       ip,
+			Password: password,
+			Drop:     anonymizeDrop,
+		})
+
+		return exportEvents(cmd, exportOutput{
+			format:  anonymizeFormat,
+			path:    anonymizeOut,
+			columns: anonymizeColumns,
+			process: dataset.Process,
+		}, paths, times, func(*logger.Event) bool { return true })
+	},
+}
+
+func init() {
+	anonymizeCmd.Flags().StringVar(&anonymizeConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	anonymizeCmd.Flags().StringVar(&anonymizeOut, "out", "", "output file (default standard output)")
+	anonymizeCmd.Flags().StringVar(&anonymizeFormat, "format", report.ExportJSON, "output format: json, csv or sql")
+	anonymizeCmd.Flags().StringSliceVar(&anonymizeColumns, "columns", report.DefaultColumns, "columns of the csv and sql formats")
+	anonymizeCmd.Flags().StringVar(&anonymizeIPMode, "ip-mode", privacy.IPCryptoPAn, "IP anonymization mode: cryptopan, truncate or none")
+	anonymizeCmd.Flags().StringVar(&anonymizeIPKey, "ip-key", "", "key for cryptopan IP anonymization")
+	anonymizeCmd.Flags().StringVar(&anonymizeIPKeyFile, "ip-key-file", "", "file containing the key for IP anonymization")
+	anonymizeCmd.Flags().StringVar(&anonymizePasswordMode, "password-mode", privacy.PasswordHMAC, "password mode: hmac, sha256, truncate, redact or plain")
+	anonymizeCmd.Flags().StringVar(&anonymizePasswordKey, "password-key", "", "key for hmac or salt for sha256 password hashing")
+	anonymizeCmd.Flags().StringVar(&anonymizePasswordKeyFile, "password-key-file", "", "file containing the password key")
+	anonymizeCmd.Flags().IntVar(&anonymizePasswordTruncate, "password-truncate", 3, "characters kept in truncate password mode")
+	anonymizeCmd.Flags().StringSliceVar(&anonymizeDrop, "drop", privacy.DefaultDroppedFields, "fields removed from every event")
+
+	rootCmd.AddCommand(anonymizeCmd)
+}
@@ -0,0 +1,250 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	banlistConfigFile   string
+	banlistFormat       string
+	banlistOut          string
+	banlistSet          string
+	banlistTable        string
+	banlistWindow       time.Duration
+	banlistMinAttempts  int
+	banlistMinUsernames int
+	banlistExclude      []string
+	banlistFollow       bool
+	banlistInterval     time.Duration
+)
+
+// banlistCmd lists the sources to block in a firewall
+var banlistCmd = &cobra.Command{
+	Use:   "banlist [flags] [FILE...]",
+	Short: "List the sources exceeding attempt thresholds for firewalls",
+	Long: `Read credential logs in JSON format and list the source addresses with at
+least --min-attempts attempts, and --min-usernames distinct usernames if
+set, within the --window before now:
+
+  plain    one address per line
+  ipset    commands for ipset restore, replacing the sets NAME_v4 and
+           NAME_v6 atomically
+  nftables a script for nft -f, declaring the sets NAME_v4 and NAME_v6 in
+           --table and replacing their elements atomically
+
+Networks given with --exclude are never listed. Attempts with anonymized
+addresses (privacy.ip_mode) are ignored.
+
+With --follow, the log is followed and the list is written to --out every
+--interval while it changes, replacing the file at once, so that the
+firewall can load it at any time. Without files, the log of the
+configuration is read; "-" reads standard input.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output := report.BanOutput{Format: banlistFormat, Set: banlistSet, Table: banlistTable}
+		if err := output.Validate(); err != nil {
+			return err
+		}
+		if banlistWindow <= 0 || banlistMinAttempts < 1 || banlistMinUsernames < 0 {
+			return fmt.Errorf("invalid thresholds: window and attempts must be positive")
+		}
+		exclude, err := parsePrefixes(banlistExclude)
+		if err != nil {
+			return err
+		}
+		paths, times, err := logPaths(banlistConfigFile, args)
+		if err != nil {
+			return err
+		}
+		if banlistFollow {
+			if banlistOut == "" || banlistOut == "-" {
+				return fmt.Errorf("--follow requires an output file (--out)")
+			}
+			if len(paths) != 1 || paths[0] == "-" {
+				return fmt.Errorf("--follow requires a single log file")
+			}
+			if banlistInterval <= 0 {
+				return fmt.Errorf("invalid interval: must be positive")
+			}
+		}
+
+		cmd.SilenceUsage = true
+
+		banlist := report.NewBanlist(report.BanConfig{
+			Window:       banlistWindow,
+			MinAttempts:  banlistMinAttempts,
+			MinUsernames: banlistMinUsernames,
+			Exclude:      exclude,
+		})
+		if !banlistFollow {
+			err := logger.ReadLogs(paths, times, func(event *logger.Event) error {
+				banlist.Add(event)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			var buf bytes.Buffer
+			if err := output.Write(&buf, banlist.Banned(time.Now())); err != nil {
+				return err
+			}
+			if banlistOut == "" || banlistOut == "-" {
+				_, err := os.Stdout.Write(buf.Bytes())
+				return err
+			}
+			return replaceFile(banlistOut, buf.Bytes())
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// The list is written once the existing log is read, then every interval
+		var mu sync.Mutex
+		var written []byte
+		update := func() error {
+			mu.Lock()
+			banned := banlist.Banned(time.Now())
+			mu.Unlock()
+			var buf bytes.Buffer
+			if err := output.Write(&buf, banned); err != nil {
+				return err
+			}
+			if written != nil && bytes.Equal(buf.Bytes(), written) {
+				return nil
+			}
+			if err := replaceFile(banlistOut, buf.Bytes()); err != nil {
+				return err
+			}
+			written = buf.Bytes()
+			fmt.Fprintf(os.Stderr, "%s: wrote %d addresses to %s\n", time.Now().Format(time.DateTime), len(banned), banlistOut)
+			return nil
+		}
+		caughtUp := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			done <- logger.Follow(ctx, logger.FollowConfig{
+				Path:      paths[0],
+				Times:     times,
+				FromStart: true,
+				CaughtUp:  func() { close(caughtUp) },
+			}, func(event *logger.Event) error {
+				mu.Lock()
+				banlist.Add(event)
+				mu.Unlock()
+				return nil
+			})
+		}()
+
+		select {
+		case <-caughtUp:
+		case err := <-done:
+			return err
+		}
+		ticker := time.NewTicker(banlistInterval)
+		defer ticker.Stop()
+		for {
+			if err := update(); err != nil {
+				return err
+			}
+			select {
+			case <-ticker.C:
+			case err := <-done:
+				if err == context.Canceled {
+					return nil
+				}
+				return err
+			}
+		}
+	},
+}
+
+// parsePrefixes parses networks in CIDR notation or single addresses
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		if addr, err := netip.ParseAddr(v); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network '%s'", v)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// replaceFile replaces the contents of a file at once, so that readers see
+// either the old or the new contents
+func replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func init() {
+	banlistCmd.Flags().StringVar(&banlistConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	banlistCmd.Flags().StringVar(&banlistFormat, "format", report.BanPlain, "output format: plain, ipset or nftables")
+	banlistCmd.Flags().StringVar(&banlistOut, "out", "", "output file (default standard output)")
+	banlistCmd.Flags().StringVar(&banlistSet, "set", "fakessh", "name of the ipset and nftables sets, suffixed with _v4 and _v6")
+	banlistCmd.Flags().StringVar(&banlistTable, "table", "inet filter", "family and name of the nftables table holding the sets")
+	banlistCmd.Flags().DurationVar(&banlistWindow, "window", time.Hour, "window before now in which attempts are counted")
+	banlistCmd.Flags().IntVar(&banlistMinAttempts, "min-attempts", 10, "attempts of a source before it is listed")
+	banlistCmd.Flags().IntVar(&banlistMinUsernames, "min-usernames", 0, "distinct usernames of a source before it is listed, ignored if 0")
+	banlistCmd.Flags().StringSliceVar(&banlistExclude, "exclude", nil, "networks never listed, in CIDR notation")
+	banlistCmd.Flags().BoolVarP(&banlistFollow, "follow", "f", false, "follow the log and keep --out up to date")
+	banlistCmd.Flags().DurationVar(&banlistInterval, "interval", time.Minute, "how often the list is written with --follow")
+
+	rootCmd.AddCommand(banlistCmd)
+}
@@ -0,0 +1,371 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/alert"
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/enrich"
+	"github.com/abehterev/fakessh/internal/forward"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	checkConfigFile    string
+	checkTimeout       time.Duration
+	checkOffline       bool
+	checkCollectorMode bool
+)
+
+// checkCmd validates a configuration before it is deployed
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Validate the configuration without starting the server",
+	Long: `Check a configuration as the server would load it, without starting it
+or logging events: unknown keys, validation, the host key, the log sinks and
+their secrets, the GeoIP and ASN databases, the alert notifiers, and the
+connections to the collector and the exporters. The result of each check is
+printed, and the exit status is non-zero if any failed.
+
+Log files are opened for appending, or their directory is checked if they do
+not exist yet. With --offline, no connection is attempted. With --collector,
+the settings of the collector mode are checked as well.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		// Only warnings are shown next to the results
+		opsCloser, err := logger.SetupOperational(logger.OperationalConfig{
+			File:   "stderr",
+			Level:  "warn",
+			Format: "pretty",
+		})
+		if err != nil {
+			return fmt.Errorf("operational logger setup error: %w", err)
+		}
+		defer opsCloser.Close()
+
+		if !runCheck(checkConfigFile, checkTimeout, checkOffline, checkCollectorMode) {
+			return errors.New("configuration check failed")
+		}
+		return nil
+	},
+}
+
+// runCheck checks the configuration and reports whether all checks passed
+func runCheck(path string, timeout time.Duration, offline, collector bool) bool {
+	report := &checkReport{}
+	cfg, err := config.LoadConfig(path)
+	if !report.check("config file", err) {
+		return false
+	}
+	report.check("validation", cfg.Validate())
+	if cfg.StateDir != "" {
+		report.check("state directory", checkWritableDir(cfg.StateDir))
+	}
+
+	checkHostKey(report, cfg)
+	checkLogFiles(report, cfg)
+	report.check("privacy", addPrivacyProcessors(&logger.Pipeline{}, cfg))
+	checkEnrichment(report, cfg)
+	if cfg.Alerts.Enabled() {
+		threshold := alert.NewThresholdTrigger(cfg.Alerts.AttemptsThreshold, cfg.Alerts.ThresholdWindow)
+		alerts, err := newAlertManager(cfg, threshold)
+		if report.check("alerts", err) {
+			alerts.Close()
+		}
+	}
+	if api := cfg.API; api.Listen != "" {
+		report.check("admin API", checkAPI(api))
+	}
+	if collector {
+		report.check("collector", checkCollector(cfg.Collector))
+	}
+
+	// Connections are attempted last, as they take the longest
+	connect := func(component, address string) {
+		if offline {
+			report.pass(component, "skipped")
+			return
+		}
+		report.check(component, dial(address, timeout))
+	}
+	if f := cfg.Forward; f.URL != "" {
+		if f.ProfileKeyFile != "" {
+			data, err := os.ReadFile(f.ProfileKeyFile)
+			if err == nil {
+				_, err = forward.ParseProfileKey(data)
+			}
+			report.check("profile key", err)
+		}
+		if offline {
+			report.pass("forward", "skipped")
+		} else {
+			report.check("forward", forward.Check(forward.Config{
+				URL:      f.URL,
+				CertFile: f.CertFile,
+				KeyFile:  f.KeyFile,
+				CAFile:   f.CAFile,
+				Timeout:  timeout,
+			}))
+		}
+	}
+	if address := cfg.Metrics.StatsD.Address; address != "" {
+		if offline {
+			report.pass("StatsD", "skipped")
+		} else {
+			_, err := net.ResolveUDPAddr("udp", address)
+			report.check("StatsD", err)
+		}
+	}
+	if endpoint := cfg.Metrics.OTLP.Endpoint; endpoint != "" {
+		connect("OTLP metrics", endpointAddress(endpoint))
+	}
+	if endpoint := cfg.Tracing.Endpoint; endpoint != "" {
+		connect("OTLP tracing", endpointAddress(endpoint))
+	}
+	if email := cfg.Alerts.Email; email.Enabled() {
+		connect("SMTP server", net.JoinHostPort(email.Host, strconv.Itoa(email.Port)))
+	}
+
+	return !report.failed
+}
+
+// checkHostKey checks that the host key can be loaded
+func checkHostKey(report *checkReport, cfg *config.Config) {
+	switch {
+	case cfg.GenerateKey:
+		report.pass("host key", "generated at startup")
+	case cfg.PrivateKeyPath == "":
+		report.pass("host key", "built-in, shared by every installation")
+	default:
+		data, err := os.ReadFile(cfg.PrivateKeyPath)
+		if err != nil {
+			report.check("host key", err)
+			return
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			report.check("host key", fmt.Errorf("%s: %w", cfg.PrivateKeyPath, err))
+			return
+		}
+		report.pass("host key", ssh.FingerprintSHA256(signer.PublicKey()))
+	}
+}
+
+// checkLogFiles checks the settings and files of the log sinks
+func checkLogFiles(report *checkReport, cfg *config.Config) {
+	if _, err := loadLoggerConfig(cfg); !report.check("log settings", err) {
+		return
+	}
+	files := []string{cfg.Log.File}
+	for _, sink := range cfg.Log.Sinks {
+		if sink.Type != "stdout" && sink.Path != "" {
+			files = append(files, sink.Path)
+		}
+	}
+	for _, file := range files {
+		if file == "stdout" {
+			continue
+		}
+		if err := checkWritable(file); err != nil {
+			report.check("log file", err)
+		} else {
+			report.pass("log file", file)
+		}
+	}
+	if cfg.Log.EmergencyFile != "" {
+		report.check("emergency file", checkWritable(cfg.Log.EmergencyFile))
+	}
+}
+
+// checkEnrichment checks the databases, secrets and state files of the
+// enrichers without starting them, so that a running sensor is not
+// disturbed
+func checkEnrichment(report *checkReport, cfg *config.Config) {
+	e := cfg.Enrichment
+	download := e.MaxMind.Enabled()
+	if path := e.GeoIP.Database; path != "" {
+		report.check("GeoIP database", checkDatabase(path, download, func() (io.Closer, error) {
+			return enrich.NewGeoIP(path, 0)
+		}))
+	}
+	if path := e.ASN.Database; path != "" {
+		report.check("ASN database", checkDatabase(path, download, func() (io.Closer, error) {
+			return enrich.NewASN(path, 0)
+		}))
+	}
+
+	var errs []error
+	if download {
+		if _, err := config.ReadSecret(e.MaxMind.LicenseKey, e.MaxMind.LicenseKeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("MaxMind license key: %w", err))
+		}
+	}
+	if r := e.Reputation.AbuseIPDB; r.Enabled {
+		if _, err := config.ReadSecret(r.APIKey, r.APIKeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("AbuseIPDB key: %w", err))
+		}
+	}
+	if r := e.Reputation.GreyNoise; r.Enabled {
+		if _, err := config.ReadSecret(r.APIKey, r.APIKeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("GreyNoise key: %w", err))
+		}
+	}
+	if e.Usernames.Enabled {
+		var rules []enrich.UsernameRule
+		for _, rule := range e.Usernames.Rules {
+			rules = append(rules, enrich.UsernameRule{Category: rule.Category, Usernames: rule.Usernames, Pattern: rule.Pattern})
+		}
+		if _, err := enrich.NewUsernameClassifier(rules); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if e.UsesCache() && e.Cache.File != "" {
+		if err := checkWritable(e.Cache.File); err != nil {
+			errs = append(errs, fmt.Errorf("enrichment cache: %w", err))
+		}
+	}
+	if e.Attackers.Enabled && e.Attackers.File != "" {
+		if err := checkWritable(e.Attackers.File); err != nil {
+			errs = append(errs, fmt.Errorf("attacker tracker: %w", err))
+		}
+	}
+	report.check("enrichment", errors.Join(errs...))
+}
+
+// checkDatabase opens and closes a GeoIP or ASN database. A missing
+// database passes if it is downloaded at startup.
+func checkDatabase(path string, download bool, open func() (io.Closer, error)) error {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) && download {
+		return checkWritable(path)
+	}
+	db, err := open()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// checkAPI checks the token and certificates of the admin API
+func checkAPI(api config.APIConfig) error {
+	var errs []error
+	if api.Token != "" || api.TokenFile != "" {
+		if _, err := config.ReadSecret(api.Token, api.TokenFile); err != nil {
+			errs = append(errs, fmt.Errorf("token: %w", err))
+		}
+	}
+	if api.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(api.CertFile, api.KeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("certificate: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkCollector checks the settings, certificate and profiles of the
+// collector mode
+func checkCollector(col config.CollectorConfig) error {
+	cfg := &config.Config{Collector: col}
+	if err := cfg.ValidateCollector(); err != nil {
+		return err
+	}
+	if _, err := tls.LoadX509KeyPair(col.CertFile, col.KeyFile); err != nil {
+		return fmt.Errorf("certificate: %w", err)
+	}
+	_, _, err := collectorProfiles(col)
+	return err
+}
+
+// checkWritable checks that a file can be appended to without creating it:
+// an existing file is opened for writing, otherwise its directory is
+// checked with a temporary file
+func checkWritable(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err == nil {
+		return f.Close()
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := checkWritableDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("%s cannot be created: %w", path, err)
+	}
+	return nil
+}
+
+// checkWritableDir checks that files can be created in a directory with a
+// temporary file
+func checkWritableDir(dir string) error {
+	tmp, err := os.CreateTemp(dir, ".fakessh-check-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// endpointAddress returns the host and port of an endpoint URL, with the
+// default port of its scheme
+func endpointAddress(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return endpoint
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "443"
+	if u.Scheme == "http" {
+		port = "80"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// dial checks that a TCP connection can be opened
+func dial(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func init() {
+	checkCmd.Flags().StringVar(&checkConfigFile, "config", "", "path to configuration file")
+	checkCmd.Flags().DurationVar(&checkTimeout, "timeout", 5*time.Second, "timeout of each connection")
+	checkCmd.Flags().BoolVar(&checkOffline, "offline", false, "skip the connection checks")
+	checkCmd.Flags().BoolVar(&checkCollectorMode, "collector", false, "check the settings of the collector mode")
+
+	rootCmd.AddCommand(checkCmd)
+}
@@ -0,0 +1,298 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/admin"
+	"github.com/abehterev/fakessh/internal/collector"
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/dashboard"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/stream"
+	"github.com/abehterev/fakessh/internal/systemd"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	collectorConfigFile string
+	collectorListen     string
+)
+
+// collectorCmd receives the events of remote sensors
+var collectorCmd = &cobra.Command{
+	Use:   "collector [flags]",
+	Short: "Receive and store the events of remote sensors",
+	Long: `Run as a collector: accept batches of events from fakessh sensors over
+HTTPS with mutual TLS and write them to the log and sinks of the
+configuration, tagged with the sensor they came from.
+
+Sensors authenticate with client certificates issued by collector.client_ca_file
+and name their ID in the Fakessh-Sensor-Id header; an ID is bound to the
+first certificate claiming it, and the common name of the certificate is the
+ID of sensors naming none. The ID replaces the sensor_id field of their
+events, whatever value they contain. Events are written as
+received, keeping their time and ID: enrichment, privacy processing,
+aggregation and alerts are left to the sensors.
+
+Batches are POSTed to /v1/events as JSON lines, optionally gzip-compressed.
+A batch with an invalid record is rejected as a whole. Sensors register
+their name, location and version with POST /v1/sensors, and GET /v1/sensors
+lists them.
+
+With collector.tenants, several customers share the collector: the sensors
+whose certificate names match the patterns of a tenant belong to it, their
+events are written to the log_file of the tenant only, and sensor IDs are
+bound within the tenant. The api_token of a tenant queries its own events
+and sensors, while collector.api_token queries the events of the sensors
+belonging to no tenant and lists all sensors.
+
+With collector.api_token, clients presenting it as a bearer token query the
+stored events without a certificate: GET /v1/events lists them,
+GET /v1/top/{column} and GET /v1/summary aggregate them, and GET /v1/stream
+streams new events as Server-Sent Events or over WebSocket. With
+collector.dashboard, /dashboard/ serves a web dashboard of the events
+received since the start, asking for the token. The admin server, if
+configured, serves the health checks.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(collectorConfigFile)
+		if err != nil {
+			return fmt.Errorf("configuration loading error: %w", err)
+		}
+		if cmd.Flags().Changed("listen") {
+			cfg.Collector.Listen = collectorListen
+		}
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		if err := cfg.ValidateCollector(); err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		opsCloser, err := logger.SetupOperational(logger.OperationalConfig{
+			File:   cfg.OpsLog.File,
+			Level:  cfg.OpsLog.Level,
+			Format: cfg.OpsLog.Format,
+		})
+		if err != nil {
+			return fmt.Errorf("operational logger setup error: %w", err)
+		}
+		defer opsCloser.Close()
+
+		loggerConfig, err := loadLoggerConfig(cfg)
+		if err != nil {
+			return err
+		}
+		loggerConfig.AggregateWindow = 0
+		credLogger, err := logger.NewCredentialsLogger(loggerConfig)
+		if err != nil {
+			return fmt.Errorf("logger creation error: %w", err)
+		}
+		defer credLogger.Close()
+
+		// The events of each tenant go to a log of its own, without the sinks
+		// of the operator
+		var tenants []collector.Tenant
+		var streams []*stream.Hub
+		checkSinks := []func() error{credLogger.CheckSinks}
+		queried := false
+		for _, t := range cfg.Collector.Tenants {
+			tenantConfig := loggerConfig
+			tenantConfig.LogFile = t.LogFile
+			tenantConfig.Sinks = nil
+			tenantConfig.EmergencyFile = ""
+			tenantLogger, err := logger.NewCredentialsLogger(tenantConfig)
+			if err != nil {
+				return fmt.Errorf("logger creation error of tenant %s: %w", t.Name, err)
+			}
+			defer tenantLogger.Close()
+			checkSinks = append(checkSinks, tenantLogger.CheckSinks)
+
+			tenant := collector.Tenant{Name: t.Name, Sensors: t.Sensors, Log: tenantLogger.LogEvent}
+			if t.HasAPIToken() {
+				token, err := config.ReadSecret(t.APIToken, t.APITokenFile)
+				if err != nil {
+					return fmt.Errorf("API token loading error of tenant %s: %w", t.Name, err)
+				}
+				events := stream.New(stream.Config{MaxClients: maxStreamClients})
+				defer tenantLogger.Consume(0, events).Close()
+				streams = append(streams, events)
+				tenant.Query = collector.QueryConfig{
+					Tokens: []string{string(token)},
+					Logs:   collectedLogs(t.LogFile),
+					Times:  loggerConfig.TimeFormat,
+					Stream: events,
+				}
+				queried = true
+			}
+			tenants = append(tenants, tenant)
+		}
+
+		profiles, profileKey, err := collectorProfiles(cfg.Collector)
+		if err != nil {
+			return err
+		}
+
+		server, err := collector.New(collector.Config{
+			Listen:        cfg.Collector.Listen,
+			CertFile:      cfg.Collector.CertFile,
+			KeyFile:       cfg.Collector.KeyFile,
+			ClientCAFile:  cfg.Collector.ClientCAFile,
+			MaxBatchBytes: int64(cfg.Collector.MaxBatchBytes),
+			RecentIDs:     cfg.Collector.RecentIDs,
+			Tenants:       tenants,
+
+			CorrelationWindow:    cfg.Collector.CorrelationWindow,
+			MaxCorrelatedSources: cfg.Collector.MaxCorrelatedSources,
+			FleetSensors:         cfg.Collector.FleetDenylist.MinSensors,
+			FleetAttempts:        cfg.Collector.FleetDenylist.MinAttempts,
+			FleetAction:          cfg.Collector.FleetDenylist.Action,
+			Profiles:             profiles,
+			ProfileKey:           profileKey,
+		}, credLogger.LogEvent)
+		if err != nil {
+			return err
+		}
+		query := collector.QueryConfig{Logs: collectedLogs(cfg.Log.File), Times: loggerConfig.TimeFormat}
+		if col := cfg.Collector; col.APIToken != "" || col.APITokenFile != "" {
+			token, err := config.ReadSecret(col.APIToken, col.APITokenFile)
+			if err != nil {
+				return fmt.Errorf("collector API token loading error: %w", err)
+			}
+			events := stream.New(stream.Config{MaxClients: maxStreamClients})
+			defer credLogger.Consume(0, events).Close()
+			streams = append(streams, events)
+			query.Tokens = []string{string(token)}
+			query.Stream = events
+			queried = true
+			if col.Dashboard {
+				dash := dashboard.New(dashboard.Config{})
+				defer credLogger.Consume(0, dash).Close()
+				server.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", dash.Page()))
+				server.Handle("GET /dashboard/data.json", admin.RequireToken([]string{string(token)}, dash))
+			}
+		}
+		if queried {
+			server.EnableQuery(query)
+		}
+		if err := server.Start(); err != nil {
+			return err
+		}
+		defer server.Close()
+		// Streams end before the server waits for its requests
+		for _, events := range streams {
+			defer events.Close()
+		}
+
+		if cfg.Admin.Listen != "" {
+			adminServer := admin.New(cfg.Admin.Listen)
+			adminServer.AddReadinessCheck("sinks", func() error {
+				var errs []error
+				for _, check := range checkSinks {
+					errs = append(errs, check())
+				}
+				return errors.Join(errs...)
+			})
+			if err := adminServer.Start(); err != nil {
+				return err
+			}
+			defer adminServer.Close()
+		}
+
+		if _, err := systemd.Notify(systemd.Ready); err != nil {
+			log.Warn().Err(err).Msg("systemd readiness notification failed")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+		log.Info().Msg("collector stopping")
+		return nil
+	},
+}
+
+func init() {
+	collectorCmd.Flags().StringVar(&collectorConfigFile, "config", "", "path to configuration file")
+	collectorCmd.Flags().StringVar(&collectorListen, "listen", "", "address of the HTTPS listener (default collector.listen, :8443)")
+
+	rootCmd.AddCommand(collectorCmd)
+}
+
+// collectedLogs returns the function listing the rotated files of a log
+// written at or after a time, and the log itself once it exists
+func collectedLogs(file string) func(since time.Time) ([]string, error) {
+	return func(since time.Time) ([]string, error) {
+		paths, err := rotatedLogs(file, since)
+		if err != nil {
+			return nil, err
+		}
+		// The log file is created by the first event
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			paths = paths[:len(paths)-1]
+		}
+		return paths, nil
+	}
+}
+
+// collectorProfiles returns the configuration profiles served to the sensors
+// and the key signing them. The profile files are read again on every
+// request, so that they can be changed without a restart, and once here to
+// fail on invalid ones.
+func collectorProfiles(col config.CollectorConfig) ([]collector.Profile, ed25519.PrivateKey, error) {
+	if len(col.Profiles) == 0 {
+		return nil, nil, nil
+	}
+	pem, err := config.ReadSecret(col.ProfileKey, col.ProfileKeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("profile key loading error: %w", err)
+	}
+	key, err := collector.ParseSigningKey(pem)
+	if err != nil {
+		return nil, nil, fmt.Errorf("profile key loading error: %w", err)
+	}
+	var profiles []collector.Profile
+	for _, p := range col.Profiles {
+		load := func() ([]byte, error) {
+			profile, err := config.LoadProfile(p.File)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(profile)
+		}
+		if _, err := load(); err != nil {
+			return nil, nil, err
+		}
+		profiles = append(profiles, collector.Profile{Sensors: p.Sensors, Load: load})
+	}
+	return profiles, key, nil
+}
@@ -0,0 +1,114 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var configInitForce bool
+
+// configCmd groups the subcommands working on configuration files
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Work with configuration files",
+}
+
+// configInitCmd writes an example configuration
+var configInitCmd = &cobra.Command{
+	Use:   "init [FILE]",
+	Short: "Write a commented configuration with the default settings",
+	Long: `Write a YAML configuration with every setting at its default value and
+the description of each, generated from the settings the server supports.
+Lists such as log sinks and alert rules are empty, with the settings of an
+entry commented out.
+
+Without a file, the configuration is written to standard output. An existing
+file is only replaced with --force.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		data, err := config.Example()
+		if err != nil {
+			return fmt.Errorf("failed to generate configuration: %w", err)
+		}
+		if len(args) == 0 || args[0] == "-" {
+			_, err := os.Stdout.Write(data)
+			return err
+		}
+
+		flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		if configInitForce {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+		// The configuration will hold secrets once filled in
+		f, err := os.OpenFile(args[0], flags, 0600)
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%s already exists, use --force to replace it", args[0])
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	},
+}
+
+// configOptionsCmd lists the flag and environment variable of every setting
+var configOptionsCmd = &cobra.Command{
+	Use:   "options",
+	Short: "List the flag and environment variable of every setting",
+	Long: `List every setting with the command-line flag and the environment variable
+setting it, and its default value. Flags take precedence over environment
+variables, which take precedence over the configuration file.
+
+Lists of values are comma-separated or given by repeating the flag, and maps
+such as tags are KEY=VALUE pairs.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tFLAG\tENVIRONMENT\tDEFAULT")
+		for _, opt := range config.Options() {
+			fmt.Fprintf(tw, "%s\t--%s\t%s\t%s\n", opt.Key, opt.Flag, opt.Env, opt.Default)
+		}
+		return tw.Flush()
+	},
+}
+
+func init() {
+	configInitCmd.Flags().BoolVar(&configInitForce, "force", false, "replace an existing file")
+
+	configCmd.AddCommand(configInitCmd)
+	configCmd.AddCommand(configOptionsCmd)
+	rootCmd.AddCommand(configCmd)
+}
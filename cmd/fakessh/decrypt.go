@@ -0,0 +1,73 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"filippo.io/age"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+var decryptIdentityFile string
+
+// decryptCmd decrypts credential logs encrypted at rest
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt --identity FILE LOG",
+	Short: "Decrypt an encrypted credentials log to stdout",
+	Long: `Decrypt every complete segment of a credentials log encrypted with age.
+Records of an incomplete trailing segment (e.g. after a crash) are lost.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if decryptIdentityFile == "" {
+			return fmt.Errorf("identity file is required (--identity)")
+		}
+
+		idFile, err := os.Open(decryptIdentityFile)
+		if err != nil {
+			return err
+		}
+		identities, err := age.ParseIdentities(idFile)
+		idFile.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse identities: %w", err)
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		segments, err := logger.Decrypt(f, os.Stdout, identities...)
+		if err != nil {
+			return fmt.Errorf("decryption stopped after %d segments: %w", segments, err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	decryptCmd.Flags().StringVar(&decryptIdentityFile, "identity", "", "file with age identities (age-keygen output)")
+
+	rootCmd.AddCommand(decryptCmd)
+}
@@ -0,0 +1,110 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffConfigFile string
+	diffA          string
+	diffB          string
+	diffTop        int
+	diffFormat     string
+)
+
+// diffCmd compares the attempts of two periods
+var diffCmd = &cobra.Command{
+	Use:   "diff --a RANGE --b RANGE [flags] [FILE...]",
+	Short: "Compare the attempts of two periods",
+	Long: `Read credential logs in JSON format and compare the attempts of two
+periods, e.g. before and after moving a sensor or changing its banner:
+
+  - attempts, attempts per day, unique addresses, usernames, passwords
+    and countries, with their relative change
+  - addresses seen only in period B (new) and only in period A
+    (disappeared), with their attempts
+  - usernames, passwords and countries whose share of the attempts
+    changed most, in percentage points
+
+Periods are given as START..END with RFC3339 times, dates (2006-01-02,
+UTC) or durations before now; either end can be left out, e.g.
+--a 14d..7d --b 7d.. compares last week with the week before. Without
+files, the log of the configuration is read; "-" reads standard input.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if diffFormat != "table" && diffFormat != "json" {
+			return fmt.Errorf("invalid format '%s': must be table or json", diffFormat)
+		}
+		if diffTop < 1 {
+			return fmt.Errorf("invalid top list size: must be positive")
+		}
+		now := time.Now()
+		a, err := report.ParseRange(diffA, now)
+		if err != nil {
+			return fmt.Errorf("--a: %w", err)
+		}
+		b, err := report.ParseRange(diffB, now)
+		if err != nil {
+			return fmt.Errorf("--b: %w", err)
+		}
+		paths, times, err := logPaths(diffConfigFile, args)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		comparer := report.NewComparer(a, b, diffTop)
+		err = logger.ReadLogs(paths, times, func(event *logger.Event) error {
+			comparer.Add(event)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		comparison := comparer.Comparison()
+		if diffFormat == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(comparison)
+		}
+		return comparison.WriteTable(os.Stdout)
+	},
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	diffCmd.Flags().StringVar(&diffA, "a", "", "first period, START..END")
+	diffCmd.Flags().StringVar(&diffB, "b", "", "second period, START..END")
+	diffCmd.Flags().IntVar(&diffTop, "top", 10, "entries of each list")
+	diffCmd.Flags().StringVar(&diffFormat, "format", "table", "output format: table or json")
+	diffCmd.MarkFlagRequired("a")
+	diffCmd.MarkFlagRequired("b")
+
+	rootCmd.AddCommand(diffCmd)
+}
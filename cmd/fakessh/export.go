@@ -0,0 +1,166 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportConfigFile string
+	exportFormat     string
+	exportOut        string
+	exportColumns    []string
+	exportTypes      []string
+	exportSince      string
+	exportUntil      string
+)
+
+// exportCmd converts credential logs into tables
+var exportCmd = &cobra.Command{
+	Use:   "export [flags] [FILE...]",
+	Short: "Convert credential logs to CSV, Parquet, SQLite databases, SQL or JSON lines",
+	Long: `Read credential logs in JSON format and write their events as rows of a
+table with the selected columns, for loading into spreadsheets, data frames
+or databases:
+
+  csv     a header and one record per event
+  parquet a Parquet file with a string column per selected column,
+          holding the values as in the csv format
+  sqlite  an SQLite database file with an "events" table, written to --out
+  sql     statements creating and filling an "events" table, e.g.
+          fakessh export --format sql | sqlite3 events.db
+  json    whole events, one object per line, ignoring --columns
+
+Columns are event fields, or time (RFC3339 in UTC), event, event_id,
+message, source_ip and source_port. Lists and objects are written as JSON.
+Without files, the log of the configuration is read; "-" reads standard
+input.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := parseFilter(exportSince, exportUntil)
+		if err != nil {
+			return err
+		}
+		filter.Types = exportTypes
+		paths, times, err := logPaths(exportConfigFile, args)
+		if err != nil {
+			return err
+		}
+		return exportEvents(cmd, exportOutput{
+			format:  exportFormat,
+			path:    exportOut,
+			columns: exportColumns,
+		}, paths, times, filter.Match)
+	},
+}
+
+// exportOutput describes where and how events are written
+type exportOutput struct {
+	format  string
+	path    string
+	columns []string
+	// Maximum number of events, unlimited if 0
+	limit int
+	// Transformation of the selected events before writing, if set
+	process func(*logger.Event)
+}
+
+// exportEvents writes the events of the logs selected by match
+func exportEvents(cmd *cobra.Command, output exportOutput, paths []string, times logger.TimeFormat, match func(*logger.Event) bool) error {
+	toFile := output.path != "" && output.path != "-"
+	if output.format == report.ExportSQLite && !toFile {
+		return fmt.Errorf("the sqlite format requires --out")
+	}
+	out := os.Stdout
+	if toFile {
+		var err error
+		if out, err = os.Create(output.path); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	// Databases are written to the file directly, as pages are written
+	// out of order
+	var w io.Writer = out
+	var buffered *bufio.Writer
+	if output.format != report.ExportSQLite {
+		buffered = bufio.NewWriter(out)
+		w = buffered
+	}
+	exporter, err := report.NewExporter(output.format, w, output.columns)
+	if err != nil {
+		return err
+	}
+
+	cmd.SilenceUsage = true
+
+	written := 0
+	err = logger.ReadLogs(paths, times, func(event *logger.Event) error {
+		if !match(event) {
+			return nil
+		}
+		if output.limit > 0 && written == output.limit {
+			return errLimit
+		}
+		written++
+		if output.process != nil {
+			output.process(event)
+		}
+		return exporter.Write(event)
+	})
+	if err != nil && err != errLimit {
+		return err
+	}
+	if err := exporter.Close(); err != nil {
+		return err
+	}
+	if buffered != nil {
+		if err := buffered.Flush(); err != nil {
+			return fmt.Errorf("failed to write events: %w", err)
+		}
+	}
+	if out != os.Stdout {
+		return out.Close()
+	}
+	return nil
+}
+
+// errLimit stops reading logs once enough events were written
+var errLimit = errors.New("limit reached")
+
+func init() {
+	exportCmd.Flags().StringVar(&exportConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	exportCmd.Flags().StringVar(&exportFormat, "format", report.ExportCSV, "output format: csv, parquet, sqlite, sql or json")
+	exportCmd.Flags().StringVar(&exportOut, "out", "", "output file (default standard output)")
+	exportCmd.Flags().StringSliceVar(&exportColumns, "columns", report.DefaultColumns, "exported columns")
+	exportCmd.Flags().StringSliceVar(&exportTypes, "type", []string{"auth_attempt"}, "exported event types, all if empty")
+	exportCmd.Flags().StringVar(&exportSince, "since", "", "only export events at or after this time")
+	exportCmd.Flags().StringVar(&exportUntil, "until", "", "only export events before this time")
+
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,123 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	geomapConfigFile string
+	geomapOut        string
+	geomapFormat     string
+	geomapPrecision  int
+	geomapSince      string
+	geomapUntil      string
+)
+
+// geomapCmd writes the origins of attempts as map data
+var geomapCmd = &cobra.Command{
+	Use:   "geomap [flags] [FILE...]",
+	Short: "Write the origins of attempts as GeoJSON or heat map CSV",
+	Long: `Read credential logs in JSON format and count the attempts by the
+coordinates of their source, as added by the GeoIP city database, for
+plotting attack origins in mapping tools:
+
+  geojson a FeatureCollection of points with the number of attempts and
+          sources, the country and the city as properties
+  csv     latitude, longitude and weight (attempts) of heat map points,
+          followed by sources, country and city
+
+Coordinates are rounded to --precision decimals, so that nearby locations
+are counted together. Attempts without coordinates are skipped. Without
+files, the log of the configuration is read; "-" reads standard input.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if geomapFormat != "geojson" && geomapFormat != "csv" {
+			return fmt.Errorf("invalid format '%s': must be geojson or csv", geomapFormat)
+		}
+		if geomapPrecision < 0 || geomapPrecision > 6 {
+			return fmt.Errorf("invalid precision: must be between 0 and 6")
+		}
+		filter, err := parseFilter(geomapSince, geomapUntil)
+		if err != nil {
+			return err
+		}
+		paths, times, err := logPaths(geomapConfigFile, args)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		m := report.NewGeoMap(geomapPrecision)
+		err = logger.ReadLogs(paths, times, func(event *logger.Event) error {
+			if filter.Match(event) {
+				m.Add(event)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if skipped := m.Skipped(); skipped > 0 {
+			fmt.Fprintf(os.Stderr, "Skipped %d attempts without coordinates\n", skipped)
+		}
+
+		out := os.Stdout
+		if geomapOut != "" && geomapOut != "-" {
+			if out, err = os.Create(geomapOut); err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		w := bufio.NewWriter(out)
+		if geomapFormat == "csv" {
+			err = m.WriteCSV(w)
+		} else {
+			err = m.WriteGeoJSON(w)
+		}
+		if err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to write map data: %w", err)
+		}
+		if out != os.Stdout {
+			return out.Close()
+		}
+		return nil
+	},
+}
+
+func init() {
+	geomapCmd.Flags().StringVar(&geomapConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	geomapCmd.Flags().StringVar(&geomapOut, "out", "", "output file (default standard output)")
+	geomapCmd.Flags().StringVar(&geomapFormat, "format", "geojson", "output format: geojson or csv")
+	geomapCmd.Flags().IntVar(&geomapPrecision, "precision", 2, "decimals of the rounded coordinates")
+	geomapCmd.Flags().StringVar(&geomapSince, "since", "", "only count attempts at or after this time")
+	geomapCmd.Flags().StringVar(&geomapUntil, "until", "", "only count attempts before this time")
+
+	rootCmd.AddCommand(geomapCmd)
+}
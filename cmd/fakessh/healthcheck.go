@@ -0,0 +1,130 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	healthcheckConfigFile string
+	healthcheckAdmin      string
+	healthcheckPort       int
+	healthcheckTimeout    time.Duration
+)
+
+// healthcheckCmd checks a running server, for container HEALTHCHECK directives
+var healthcheckCmd = &cobra.Command{
+	Use:   "healthcheck",
+	Short: "Check that the local server is healthy",
+	Long: `Check the local server and exit with a non-zero status on failure.
+With an admin listener configured, its /readyz endpoint is queried.
+Otherwise the SSH port is checked for the server's version banner.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(healthcheckConfigFile)
+		if err != nil {
+			return fmt.Errorf("configuration loading error: %w", err)
+		}
+		if cmd.Flags().Changed("admin") {
+			cfg.Admin.Listen = healthcheckAdmin
+		}
+		if cmd.Flags().Changed("port") {
+			cfg.Port = healthcheckPort
+		}
+
+		// Usage is printed for invalid arguments only
+		cmd.SilenceUsage = true
+
+		if cfg.Admin.Listen != "" {
+			return checkReadiness(localAddress(cfg.Admin.Listen), healthcheckTimeout)
+		}
+		return checkBanner(net.JoinHostPort("127.0.0.1", strconv.Itoa(cfg.Port)), healthcheckTimeout)
+	},
+}
+
+// localAddress replaces an unspecified listen host with the loopback address
+func localAddress(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return listen
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// checkReadiness queries the readiness endpoint of the admin server
+func checkReadiness(addr string, timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get("http://" + addr + "/readyz")
+	if err != nil {
+		return fmt.Errorf("admin server is not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server is not ready: %s", strings.TrimSpace(string(body)))
+	}
+	fmt.Println("OK")
+	return nil
+}
+
+// checkBanner connects to the SSH port and reads the version banner
+func checkBanner(addr string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return fmt.Errorf("SSH port is not reachable: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no SSH banner received: %w", err)
+	}
+	banner = strings.TrimSpace(banner)
+	if !strings.HasPrefix(banner, "SSH-") {
+		return fmt.Errorf("unexpected SSH banner: %q", banner)
+	}
+	fmt.Printf("OK, %s\n", banner)
+	return nil
+}
+
+func init() {
+	healthcheckCmd.Flags().StringVar(&healthcheckConfigFile, "config", "", "path to configuration file")
+	healthcheckCmd.Flags().StringVar(&healthcheckAdmin, "admin", "", "address of the admin server, overrides the configuration")
+	healthcheckCmd.Flags().IntVar(&healthcheckPort, "port", 2222, "SSH port checked without an admin server")
+	healthcheckCmd.Flags().DurationVar(&healthcheckTimeout, "timeout", 5*time.Second, "timeout of the check")
+
+	rootCmd.AddCommand(healthcheckCmd)
+}
@@ -0,0 +1,134 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/importer"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFormat   string
+	importOut      string
+	importYear     int
+	importTimezone string
+	importIOC      bool
+)
+
+// importCmd converts the logs of other honeypots and of sshd
+var importCmd = &cobra.Command{
+	Use:   "import --format cowrie|authlog [flags] FILE...",
+	Short: "Convert Cowrie or OpenSSH logs into credential logs",
+	Long: `Convert the logs of other honeypots and of sshd into events of credential
+logs in JSON format, so that the other subcommands can analyze them:
+
+  cowrie  JSON log of the Cowrie honeypot (cowrie.json): login attempts
+          become auth_attempt events with the client version of their
+          session, command input becomes command events
+  authlog syslog output of OpenSSH (/var/log/auth.log, /var/log/secure):
+          failed and accepted authentications become auth_attempt events
+          without a password, with the method in auth_method
+
+Events keep the session of their source in session_id and its host or
+sensor name in sensor_id. Traditional syslog timestamps have neither year
+nor timezone: they are read in --timezone, in the latest year that does not
+put them in the future unless --year is given. Compressed files are read
+transparently, "-" reads standard input.
+
+With --ioc, every command event is followed by an ioc event for each URL,
+address, domain and hash found in it, for the misp and stix subcommands.
+
+The events are written as JSON lines; pipe them into fakessh replay to
+store them in the log and sinks of a configuration.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		location, err := time.LoadLocation(importTimezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+		converter, err := importer.NewConverter(importFormat, importer.Config{
+			Location: location,
+			Year:     importYear,
+			IOC:      importIOC,
+		})
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		out := os.Stdout
+		if importOut != "" && importOut != "-" {
+			if out, err = os.Create(importOut); err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		w := bufio.NewWriter(out)
+		exporter, err := report.NewExporter(report.ExportJSON, w, nil)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range args {
+			in := os.Stdin
+			if path != "-" {
+				if in, err = os.Open(path); err != nil {
+					return err
+				}
+			}
+			result, err := importer.Import(in, converter, exporter.Write)
+			if in != os.Stdin {
+				in.Close()
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			fmt.Fprintf(os.Stderr, "%s: %d events from %d lines, %d invalid lines skipped\n", path, result.Events, result.Lines, result.Invalid)
+		}
+
+		if err := exporter.Close(); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to write events: %w", err)
+		}
+		if out != os.Stdout {
+			return out.Close()
+		}
+		return nil
+	},
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importFormat, "format", "", "input format: cowrie or authlog")
+	importCmd.Flags().StringVar(&importOut, "out", "", "output file (default standard output)")
+	importCmd.Flags().IntVar(&importYear, "year", 0, "year of syslog timestamps (default the latest year not in the future)")
+	importCmd.Flags().StringVar(&importTimezone, "timezone", "Local", "timezone of syslog timestamps: Local, UTC or an IANA name")
+	importCmd.Flags().BoolVar(&importIOC, "ioc", false, "emit ioc events for the indicators of compromise found in commands")
+	importCmd.MarkFlagRequired("format")
+
+	rootCmd.AddCommand(importCmd)
+}
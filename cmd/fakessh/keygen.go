@@ -0,0 +1,198 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/sshserver"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	keygenType    string
+	keygenBits    int
+	keygenOut     string
+	keygenComment string
+	keygenForce   bool
+
+	fingerprintConfigFile string
+)
+
+// keygenCmd generates host keys for sensors
+var keygenCmd = &cobra.Command{
+	Use:   "keygen --out FILE [flags]",
+	Short: "Generate an SSH host key",
+	Long: `Generate an SSH host key in the OpenSSH format, to give sensors a stable
+key with private_key_path instead of a key generated on each start or the
+built-in key. The private key is written with mode 0600 and the public key
+next to it with a .pub suffix, and the fingerprint is printed.
+
+Without --bits, RSA keys have 3072 bits and ECDSA keys 256.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if keygenOut == "" {
+			return fmt.Errorf("output file is required (--out)")
+		}
+		bits := keygenBits
+		if bits == 0 {
+			bits = sshserver.DefaultKeyBits(keygenType)
+		}
+		data, err := sshserver.GenerateHostKey(keygenType, bits, keygenComment)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return err
+		}
+		public := ssh.MarshalAuthorizedKey(signer.PublicKey())
+		if keygenComment != "" {
+			public = append(public[:len(public)-1], " "+keygenComment+"\n"...)
+		}
+		if err := writeKeyFile(keygenOut, data, 0600); err != nil {
+			return err
+		}
+		if err := writeKeyFile(keygenOut+".pub", public, 0644); err != nil {
+			return err
+		}
+		fmt.Println(fingerprintLine(signer.PublicKey(), ssh.FingerprintSHA256(signer.PublicKey()), keygenComment))
+		return nil
+	},
+}
+
+// fingerprintCmd prints the fingerprints of host keys
+var fingerprintCmd = &cobra.Command{
+	Use:   "fingerprint [FILE]",
+	Short: "Print the fingerprints of an SSH host key",
+	Long: `Print the SHA256 and MD5 fingerprints of a host key, as clients show them
+on first connection. The file can hold a private key or a public key in the
+authorized_keys format, such as a .pub file.
+
+Without a file, the key of the configuration given with --config is used, or
+the built-in key if it has none. Keys generated on each start have no stable
+fingerprint.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := ""
+		if len(args) > 0 {
+			path = args[0]
+		} else if fingerprintConfigFile != "" {
+			cfg, err := config.LoadConfig(fingerprintConfigFile)
+			if err != nil {
+				return fmt.Errorf("configuration loading error: %w", err)
+			}
+			if cfg.GenerateKey {
+				return fmt.Errorf("the configuration generates a new key on each start")
+			}
+			path = cfg.PrivateKeyPath
+		}
+
+		cmd.SilenceUsage = true
+
+		key, comment, err := readPublicKey(path)
+		if err != nil {
+			return err
+		}
+		fmt.Println(fingerprintLine(key, ssh.FingerprintSHA256(key), comment))
+		fmt.Println(fingerprintLine(key, "MD5:"+ssh.FingerprintLegacyMD5(key), comment))
+		return nil
+	},
+}
+
+// readPublicKey returns the public key of a private or public key file, or
+// of the built-in key if path is empty, with its comment
+func readPublicKey(path string) (ssh.PublicKey, string, error) {
+	if path == "" {
+		signer, err := sshserver.BuiltinHostKey()
+		if err != nil {
+			return nil, "", err
+		}
+		return signer.PublicKey(), "built-in key", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if key, comment, _, _, err := ssh.ParseAuthorizedKey(data); err == nil {
+		return key, comment, nil
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	return signer.PublicKey(), "", nil
+}
+
+// fingerprintLine formats a fingerprint like ssh-keygen -l:
+// "256 SHA256:... comment (ED25519)"
+func fingerprintLine(key ssh.PublicKey, fingerprint, comment string) string {
+	name := strings.ToUpper(strings.TrimPrefix(key.Type(), "ssh-"))
+	if strings.HasPrefix(name, "ECDSA") {
+		name = "ECDSA"
+	}
+	if comment == "" {
+		comment = "no comment"
+	}
+	return fmt.Sprintf("%d %s %s (%s)", sshserver.KeyBits(key), fingerprint, comment, name)
+}
+
+// writeKeyFile writes a key file with a mode, unless it exists and --force
+// was not given
+func writeKeyFile(path string, data []byte, mode os.FileMode) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if keygenForce {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, mode)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists, use --force to replace it", path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func init() {
+	keygenCmd.Flags().StringVar(&keygenType, "type", sshserver.KeyTypeEd25519, "key type (rsa, ecdsa or ed25519)")
+	keygenCmd.Flags().IntVar(&keygenBits, "bits", 0, "key size in bits (RSA 2048-16384, ECDSA 256, 384 or 521)")
+	keygenCmd.Flags().StringVar(&keygenOut, "out", "", "path of the private key, the public key gets a .pub suffix")
+	keygenCmd.Flags().StringVar(&keygenComment, "comment", "", "comment of the key")
+	keygenCmd.Flags().BoolVar(&keygenForce, "force", false, "replace existing key files")
+
+	fingerprintCmd.Flags().StringVar(&fingerprintConfigFile, "config", "", "path to configuration file with the key")
+
+	rootCmd.AddCommand(keygenCmd)
+	rootCmd.AddCommand(fingerprintCmd)
+}
@@ -0,0 +1,101 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/loadtest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	loadtestTarget      string
+	loadtestRate        float64
+	loadtestConcurrency int
+	loadtestAttempts    int
+	loadtestDuration    time.Duration
+	loadtestTimeout     time.Duration
+)
+
+// loadtestCmd simulates SSH clients guessing credentials
+var loadtestCmd = &cobra.Command{
+	Use:   "loadtest",
+	Short: "Simulate concurrent SSH clients attempting credentials",
+	Long: `Open SSH connections to a server at a fixed rate, each trying random
+passwords, and report how many were rejected as expected and how long they
+took. Used for capacity planning and for testing a sensor under load.
+Only run it against servers you operate.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		fmt.Printf("Connecting to %s at %.1f connections/s for %s (Ctrl-C to stop)\n", loadtestTarget, loadtestRate, loadtestDuration)
+		result, err := loadtest.Run(ctx, loadtest.Config{
+			Target:          loadtestTarget,
+			Rate:            loadtestRate,
+			Concurrency:     loadtestConcurrency,
+			AttemptsPerConn: loadtestAttempts,
+			Duration:        loadtestDuration,
+			Timeout:         loadtestTimeout,
+		})
+		if err != nil {
+			return err
+		}
+
+		elapsed := result.Elapsed.Seconds()
+		fmt.Printf("Connections: %d in %s (%.1f/s)\n", result.Connections, result.Elapsed.Round(time.Millisecond), float64(result.Connections)/elapsed)
+		fmt.Printf("Attempts:    %d rejected (%.1f/s)\n", result.Rejected*loadtestAttempts, float64(result.Rejected*loadtestAttempts)/elapsed)
+		fmt.Printf("Errors:      %d\n", result.Errors)
+		if result.LastError != "" {
+			fmt.Printf("Last error:  %s\n", result.LastError)
+		}
+		if result.Skipped > 0 {
+			fmt.Printf("Skipped:     %d, all %d connections were open\n", result.Skipped, loadtestConcurrency)
+		}
+		l := result.Latency
+		fmt.Printf("Latency:     min %s, mean %s, p50 %s, p95 %s, max %s\n",
+			l.Min.Round(time.Millisecond), l.Mean.Round(time.Millisecond), l.P50.Round(time.Millisecond),
+			l.P95.Round(time.Millisecond), l.Max.Round(time.Millisecond))
+
+		if result.Errors > 0 {
+			return fmt.Errorf("%d of %d connections failed", result.Errors, result.Connections)
+		}
+		return nil
+	},
+}
+
+func init() {
+	loadtestCmd.Flags().StringVar(&loadtestTarget, "target", "127.0.0.1:2222", "address of the server, host:port")
+	loadtestCmd.Flags().Float64Var(&loadtestRate, "rate", 10, "connections started per second")
+	loadtestCmd.Flags().IntVar(&loadtestConcurrency, "concurrency", 100, "maximum number of open connections")
+	loadtestCmd.Flags().IntVar(&loadtestAttempts, "attempts", 3, "password attempts per connection")
+	loadtestCmd.Flags().DurationVar(&loadtestDuration, "duration", 30*time.Second, "how long connections are started")
+	loadtestCmd.Flags().DurationVar(&loadtestTimeout, "timeout", 30*time.Second, "timeout of a single connection")
+
+	rootCmd.AddCommand(loadtestCmd)
+}
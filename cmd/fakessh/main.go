@@ -20,96 +20,500 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"syscall"
+	"text/template"
 	"time"
 
+	"github.com/abehterev/fakessh/internal/admin"
+	"github.com/abehterev/fakessh/internal/alert"
+	"github.com/abehterev/fakessh/internal/collector"
 	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/control"
+	"github.com/abehterev/fakessh/internal/dashboard"
+	"github.com/abehterev/fakessh/internal/enrich"
+	"github.com/abehterev/fakessh/internal/forward"
 	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/metrics"
+	"github.com/abehterev/fakessh/internal/pidfile"
+	"github.com/abehterev/fakessh/internal/privacy"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/abehterev/fakessh/internal/sandbox"
+	"github.com/abehterev/fakessh/internal/schedule"
 	"github.com/abehterev/fakessh/internal/sshserver"
-	"github.com/rs/zerolog"
+	"github.com/abehterev/fakessh/internal/stats"
+	"github.com/abehterev/fakessh/internal/stream"
+	"github.com/abehterev/fakessh/internal/systemd"
+	"github.com/abehterev/fakessh/internal/tracing"
+	"github.com/abehterev/fakessh/internal/winsvc"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
-var (
-	cfgFile        string
-	port           int
-	logFile        string
-	logFormat      string
-	banner         string
-	serverVersion  string
-	privateKeyPath string
-	generateKey    bool
-)
+// maxStreamClients limits the clients of the live event stream
+const maxStreamClients = 100
+
+var cfgFile string
+
+// sensorFlags are the documented flags of settings, some under shorter names
+// than the flags of every setting that config.AddFlags adds
+var sensorFlags = []struct {
+	name, key, usage string
+}{
+	{"port", "port", "SSH server port"},
+	{"log", "log.file", "path to credentials log file (stdout for console output)"},
+	{"log-format", "log.format", "log format (json, pretty or text)"},
+	{"log-time-format", "log.time_format", "event timestamp format (rfc3339, rfc3339nano, unix, unixms or a Go time layout)"},
+	{"log-timezone", "log.timezone", "timezone of event timestamps (UTC, Local or IANA name)"},
+	{"log-emergency-file", "log.emergency_file", "file used for credentials when all log sinks are failing (empty to disable)"},
+	{"ops-log", "ops_log.file", "destination of operational messages (stderr, stdout or file path)"},
+	{"ops-log-level", "ops_log.level", "operational log level (debug, info, warn or error)"},
+	{"ops-log-format", "ops_log.format", "operational log format (json or pretty)"},
+	{"banner", "banner", "SSH banner (version part)"},
+	{"server-version", "server_version", "SSH server version"},
+	{"key", "private_key_path", "path to SSH private key (if not specified, built-in or newly generated will be used)"},
+	{"generate-key", "generate_key", "generate a new SSH key on each start"},
+	{"state-dir", "state_dir", "directory of the host key, sensor ID, logs, caches and spool given as relative paths"},
+	{"pidfile", "pidfile", "file the process ID is written to while the server runs"},
+	{"password-mode", "privacy.password_mode", "how passwords are logged (plain, sha256, hmac, truncate or redact)"},
+	{"ip-mode", "privacy.ip_mode", "how source IPs are anonymized (none, truncate or cryptopan)"},
+	{"asn-db", "enrichment.asn.database", "path to a MaxMind GeoLite2/GeoIP2 ASN database for network owner enrichment"},
+	{"geoip-db", "enrichment.geoip.database", "path to a MaxMind GeoLite2/GeoIP2 City or Country database for location enrichment"},
+	{"rdns", "enrichment.rdns.enabled", "resolve the hostnames of source addresses"},
+	{"cloud-ranges", "enrichment.cloud.enabled", "tag events from published cloud provider ranges"},
+	{"dictionaries", "enrichment.dictionaries.enabled", "tag attempts using well-known botnet and vendor default credentials"},
+	{"password-analysis", "enrichment.password_analysis", "add password length, entropy, character classes and patterns to attempts"},
+	{"username-classes", "enrichment.usernames.enabled", "attach the category of the username to attempts"},
+	{"hibp", "enrichment.hibp.enabled", "check attempted passwords against Have I Been Pwned (k-anonymity)"},
+	{"campaigns", "enrichment.campaigns.enabled", "group sources into campaigns by shared wordlists, timing and client versions"},
+	{"statsd", "metrics.statsd.address", "UDP address of a StatsD/DogStatsD server receiving metrics"},
+	{"admin-listen", "admin.listen", "address of the admin HTTP server with health checks, e.g. 127.0.0.1:9090"},
+	{"pprof", "admin.pprof", "serve runtime profiles under /debug/pprof/ on the admin server"},
+	{"heartbeat-interval", "heartbeat.interval", "interval of heartbeat events with uptime and counters (0 to disable)"},
+	{"metrics-endpoint", "metrics.otlp.endpoint", "OTLP/HTTP collector URL receiving pushed metrics"},
+	{"tracing-endpoint", "tracing.endpoint", "OTLP/HTTP collector URL receiving traces of connection handling"},
+	{"track-attackers", "enrichment.attackers.enabled", "attach new_attacker and attempt_number from per-IP first-seen tracking to attempts"},
+	{"tag", "tags", "static key=value pair attached to every event (can be repeated)"},
+}
 
 // rootCmd represents the base command when the application is called
 var rootCmd = &cobra.Command{
 	Use:   "fakessh",
 	Short: "Fake SSH server for credential harvesting",
 	Long: `Fake SSH server that emulates OpenSSH server behavior,
-but always rejects authentication attempts and logs credentials.`,
+but always rejects authentication attempts and logs credentials.
+
+Every setting of the configuration file can also be given as a flag named
+after its key, such as --enrichment-rdns-timeout for enrichment.rdns.timeout,
+or as an environment variable such as FAKESSH_ENRICHMENT_RDNS_TIMEOUT. Run
+'fakessh config options' to list them.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Configure global zerolog logger
-		zerolog.TimeFieldFormat = time.RFC3339
-		if logFormat == "pretty" {
-			log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
-		} else {
-			// Configure JSON output
-			log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+		// The Windows service manager starts the server with --service
+		if serviceName != "" && !serviceRunning {
+			return runService(cmd, args)
 		}
 
-		// Load configuration
-		cfg, err := config.LoadConfig(cfgFile)
+		cfg, err := loadSensorConfig(cmd)
 		if err != nil {
-			return fmt.Errorf("configuration loading error: %w", err)
+			return err
 		}
 
-		// Command line flags take precedence
-		if cmd.Flags().Changed("port") {
-			cfg.Port = port
+		// Configure operational logging, separate from credential events.
+		// A service has no console, its messages go to the event log.
+		opsConfig := logger.OperationalConfig{
+			File:   cfg.OpsLog.File,
+			Level:  cfg.OpsLog.Level,
+			Format: cfg.OpsLog.Format,
 		}
-		if cmd.Flags().Changed("log") {
-			cfg.Log.File = logFile
+		if serviceRunning && (cfg.OpsLog.File == "" || cfg.OpsLog.File == "stderr" || cfg.OpsLog.File == "stdout") {
+			if opsConfig.Output, err = winsvc.OpenEventLog(serviceName); err != nil {
+				return err
+			}
 		}
-		if cmd.Flags().Changed("log-format") {
-			cfg.Log.Format = logFormat
+		opsCloser, err := logger.SetupOperational(opsConfig)
+		if err != nil {
+			return fmt.Errorf("operational logger setup error: %w", err)
 		}
-		if cmd.Flags().Changed("banner") {
-			cfg.Banner = banner
+		defer opsCloser.Close()
+
+		// The PID file is removed on exit, after everything else is stopped
+		if cfg.PIDFile != "" {
+			pid, err := pidfile.Write(cfg.PIDFile)
+			if err != nil {
+				return fmt.Errorf("PID file error: %w", err)
+			}
+			defer func() {
+				if err := pid.Remove(); err != nil {
+					log.Warn().Err(err).Msg("failed to remove PID file")
+				}
+			}()
 		}
-		if cmd.Flags().Changed("server-version") {
-			cfg.ServerVersion = serverVersion
+
+		// The sensor identity is stamped onto every event
+		sensorID, err := cfg.LoadSensorID()
+		if err != nil {
+			return fmt.Errorf("sensor identity error: %w", err)
 		}
-		if cmd.Flags().Changed("key") {
-			cfg.PrivateKeyPath = privateKeyPath
+		cfg.Tags = sensorTags(cfg, sensorID)
+
+		// Metrics are collected even without exporters
+		registry := metrics.NewRegistry()
+		if statsd := cfg.Metrics.StatsD; statsd.Address != "" {
+			exporter, err := metrics.NewStatsD(metrics.StatsDConfig{
+				Address:       statsd.Address,
+				Prefix:        statsd.Prefix,
+				Tags:          statsd.Tags,
+				DogStatsD:     statsd.DogStatsD,
+				FlushInterval: statsd.FlushInterval,
+			})
+			if err != nil {
+				return err
+			}
+			defer exporter.Close()
+			registry.AddObserver(exporter)
 		}
-		if cmd.Flags().Changed("generate-key") {
-			cfg.GenerateKey = generateKey
+		if otlp := cfg.Metrics.OTLP; otlp.Endpoint != "" {
+			exporter := metrics.NewOTLPExporter(registry, metrics.OTLPConfig{
+				Endpoint: otlp.Endpoint,
+				Headers:  otlp.Headers,
+				Resource: cfg.Tags,
+				Interval: otlp.Interval,
+				Timeout:  otlp.Timeout,
+			})
+			defer exporter.Close()
 		}
 
-		// Validate configuration
-		if err := cfg.Validate(); err != nil {
-			return fmt.Errorf("invalid configuration: %w", err)
+		// Spans are exported on exit, after the server and the logger are done
+		var tracer *tracing.Tracer
+		if cfg.Tracing.Endpoint != "" {
+			tracer = tracing.New(tracing.Config{
+				Endpoint:      cfg.Tracing.Endpoint,
+				Headers:       cfg.Tracing.Headers,
+				Resource:      cfg.Tags,
+				SampleRatio:   cfg.Tracing.SampleRatio,
+				BatchSize:     cfg.Tracing.BatchSize,
+				QueueSize:     cfg.Tracing.QueueSize,
+				FlushInterval: cfg.Tracing.FlushInterval,
+				Timeout:       cfg.Tracing.Timeout,
+			})
+			defer tracer.Close()
 		}
 
 		// Create credentials logger
-		loggerConfig := logger.Config{
-			LogFile:   cfg.Log.File,
-			LogFormat: cfg.Log.Format,
+		credLogger, err := newCredentialsLogger(cfg, registry, tracer)
+		if err != nil {
+			return err
+		}
+		defer credLogger.Close()
+
+		// Events are spooled and sent to the collector as they are written
+		var forwardSink *forward.Sink
+		if f := cfg.Forward; f.URL != "" {
+			var profileKey ed25519.PublicKey
+			if f.ProfileKeyFile != "" {
+				data, err := os.ReadFile(f.ProfileKeyFile)
+				if err != nil {
+					return fmt.Errorf("profile key loading error: %w", err)
+				}
+				if profileKey, err = forward.ParseProfileKey(data); err != nil {
+					return fmt.Errorf("profile key loading error: %w", err)
+				}
+			}
+			forwardSink, err = forward.New(forward.Config{
+				URL:           f.URL,
+				CertFile:      f.CertFile,
+				KeyFile:       f.KeyFile,
+				CAFile:        f.CAFile,
+				SpoolDir:      f.SpoolDir,
+				MaxSpoolBytes: int64(f.MaxSpoolBytes),
+				BatchSize:     f.BatchSize,
+				FlushInterval: f.FlushInterval,
+				Timeout:       f.Timeout,
+				FleetInterval: f.FleetInterval,
+
+				ProfileKey:      profileKey,
+				ProfileInterval: f.ProfileInterval,
+				Sensor: collector.Registration{
+					ID:       sensorID,
+					Name:     cfg.Sensor.Name,
+					Location: cfg.Sensor.Location,
+					Version:  buildVersion(),
+				},
+			})
+			if err != nil {
+				return err
+			}
+			credLogger.AddSink(forwardSink)
+		}
+
+		// The profile of the collector overrides the local settings, which
+		// are kept to be restored if it is removed
+		local := cfg
+		var profile []byte
+		if forwardSink != nil && cfg.Forward.ProfileKeyFile != "" {
+			cfg, profile = profiledConfig(local, forwardSink)
 		}
 
-		credLogger, err := logger.NewCredentialsLogger(loggerConfig)
+		// Enrichment and privacy processing are replaced as a whole when
+		// the configuration is reloaded
+		processing, enrichers, err := newProcessing(cfg, credLogger)
 		if err != nil {
-			return fmt.Errorf("logger creation error: %w", err)
+			return err
+		}
+		credLogger.AddProcessor(processing)
+		sensor := &liveSensor{
+			credLogger: credLogger,
+			processing: processing,
+			enrichers:  enrichers,
+			local:      local,
+			profile:    profile,
+			current:    cfg,
+		}
+		defer sensor.close()
+
+		// Runtime statistics count attempts as they are logged, consuming the
+		// processed events in goroutines of their own
+		var collector *stats.Collector
+		var sessions *report.Sessions
+		var events *stream.Hub
+		var dash *dashboard.Dashboard
+		if cfg.Admin.Listen != "" || cfg.API.Listen != "" {
+			collector = stats.NewCollector(registry, credLogger.Health)
+			defer credLogger.Consume(0, collector).Close()
+		}
+		if cfg.Admin.Listen != "" {
+			if cfg.Admin.SessionsEnabled() {
+				sessions = report.NewSessions(report.SessionConfig{Gap: 10 * time.Minute, Max: cfg.Admin.Sessions})
+				defer credLogger.Consume(0, sessions).Close()
+			}
+			if cfg.Admin.StreamEnabled() {
+				events = stream.New(stream.Config{MaxClients: maxStreamClients})
+				defer credLogger.Consume(0, events).Close()
+			}
+			if cfg.Admin.Dashboard {
+				dash = dashboard.New(dashboard.Config{})
+				defer credLogger.Consume(0, dash).Close()
+			}
+		}
+
+		// Alerts show events as they are logged, after the privacy processors
+		var threshold *alert.ThresholdTrigger
+		var alerts *alert.Manager
+		if cfg.Alerts.Enabled() {
+			threshold = alert.NewThresholdTrigger(cfg.Alerts.AttemptsThreshold, cfg.Alerts.ThresholdWindow)
+			if alerts, err = newAlertManager(cfg, threshold); err != nil {
+				return err
+			}
+			defer alerts.Close()
+			defer credLogger.Consume(0, alerts).Close()
+		}
+		if email := cfg.Alerts.Email; email.SendsDigest() {
+			notifier, err := newEmail(email)
+			if err != nil {
+				return err
+			}
+			digest := alert.NewDigest(alert.DigestConfig{
+				Interval: email.DigestInterval,
+				Top:      email.DigestTop,
+				Timeout:  cfg.Alerts.Timeout,
+			}, notifier)
+			defer digest.Close()
+			defer credLogger.Consume(0, digest).Close()
+		}
+		if cfg.Reports.Enabled() {
+			reports, err := startReports(cfg)
+			if err != nil {
+				return err
+			}
+			defer reports.Close()
 		}
-		defer credLogger.Close()
 
 		// Create SSH server
 		server, err := sshserver.NewServer(cfg, credLogger)
 		if err != nil {
 			return fmt.Errorf("SSH server creation error: %w", err)
 		}
+		server.SetMetrics(registry)
+		server.SetTracer(tracer)
+
+		// Sources listed by the collector are denied or held in the tarpit,
+		// and its profile changes are applied to the running server
+		sensor.server = server
+		sensor.threshold = threshold
+		sensor.alerts = alerts
+		if forwardSink != nil {
+			forwardSink.OnFleet(applyFleet(server.Governor()))
+			if cfg.Forward.ProfileKeyFile != "" {
+				forwardSink.OnProfile(sensor.setProfile)
+			}
+		}
+
+		// SIGHUP reloads the configuration without closing the listener
+		sensor.load = func() (*config.Config, error) {
+			cfg, err := loadSensorConfig(cmd)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Tags = sensorTags(cfg, sensorID)
+			return cfg, nil
+		}
+		hangups := make(chan os.Signal, 1)
+		signal.Notify(hangups, syscall.SIGHUP)
+		defer signal.Stop(hangups)
+		go func() {
+			for range hangups {
+				sensor.reload()
+			}
+		}()
+
+		// SIGUSR1 reopens the log files after logrotate renamed them
+		if len(reopenSignals) > 0 {
+			reopens := make(chan os.Signal, 1)
+			signal.Notify(reopens, reopenSignals...)
+			defer signal.Stop(reopens)
+			go func() {
+				for range reopens {
+					reopenLogs(credLogger)
+				}
+			}()
+		}
+
+		// SIGTERM, interrupts and stopping the Windows service stop
+		// accepting connections and give the open ones shutdown_timeout to
+		// end; a second signal exits at once. The server also stops when
+		// the process can not be confined.
+		stops := make(chan os.Signal, 1)
+		signal.Notify(stops, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(stops)
+		stopped := make(chan error, 1)
+		var confineErr error
+		confineFailed := make(chan struct{})
+		go func() {
+			reason := "service stopped"
+			select {
+			case sig := <-stops:
+				reason = sig.String()
+			case <-cmd.Context().Done():
+			case <-confineFailed:
+				reason = "confinement failed"
+			}
+			signal.Stop(stops)
+			log.Info().Str("reason", reason).Dur("timeout", cfg.ShutdownTimeout).Msg("shutting down")
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			defer cancel()
+			stopped <- server.Shutdown(ctx)
+		}()
+
+		// The admin server runs next to the SSH server
+		if cfg.Admin.Listen != "" {
+			adminServer := admin.New(cfg.Admin.Listen)
+			adminServer.AddReadinessCheck("listener", server.CheckListener)
+			adminServer.AddReadinessCheck("host_key", server.CheckHostKey)
+			adminServer.AddReadinessCheck("sinks", credLogger.CheckSinks)
+			adminServer.Handle("GET /stats", collector)
+			var tokens []string
+			if cfg.Admin.HasToken() {
+				token, err := config.ReadSecret(cfg.Admin.Token, cfg.Admin.TokenFile)
+				if err != nil {
+					return fmt.Errorf("admin token loading error: %w", err)
+				}
+				tokens = []string{string(token)}
+			}
+			if sessions != nil {
+				adminServer.Handle("GET /sessions", admin.RequireToken(tokens, sessions))
+				adminServer.Handle("GET /sessions/{id}", admin.RequireToken(tokens, sessions))
+			} else if cfg.Admin.Sessions > 0 {
+				log.Info().Msg("sessions API disabled, it requires admin.token")
+			}
+			if events != nil {
+				token, err := config.ReadSecret(cfg.Admin.StreamToken, cfg.Admin.StreamTokenFile)
+				if err != nil {
+					return fmt.Errorf("stream token loading error: %w", err)
+				}
+				adminServer.Handle("GET /stream", admin.RequireToken([]string{string(token)}, events))
+			}
+			if dash != nil {
+				adminServer.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", dash.Page()))
+				adminServer.Handle("GET /dashboard/data.json", admin.RequireToken(tokens, dash))
+			}
+			adminServer.EnableExpvar("fakessh", func() interface{} { return collector.Snapshot() })
+			if cfg.Admin.Pprof {
+				adminServer.EnablePprof()
+			}
+			if err := adminServer.Start(); err != nil {
+				return err
+			}
+			defer adminServer.Close()
+			// Streams end before the server waits for its requests
+			if events != nil {
+				defer events.Close()
+			}
+		}
+
+		// The admin API changes the sensor at runtime
+		if cfg.API.Listen != "" {
+			api, err := newControlServer(cfg, sensorID, sensor, collector)
+			if err != nil {
+				return err
+			}
+			if err := api.Start(); err != nil {
+				return err
+			}
+			defer api.Close()
+		}
+
+		// Heartbeats tell downstream systems that the sensor is alive
+		if cfg.Heartbeat.Interval > 0 {
+			info := buildInfo()
+			heartbeat := stats.StartHeartbeat(stats.HeartbeatConfig{
+				Interval:  cfg.Heartbeat.Interval,
+				SensorID:  sensorID,
+				Version:   info.Version,
+				Commit:    info.Commit,
+				BuildDate: info.Date,
+				GoVersion: info.GoVersion,
+			}, registry, credLogger)
+			defer heartbeat.Close()
+		}
+
+		// Once the listener is bound the process is confined, then
+		// Type=notify units are told it is ready, and the watchdog is fed
+		// while the listener stays bound
+		server.SetListeningHook(func() {
+			if box := sandboxConfig(cfg); box.Enabled() {
+				if err := sandbox.Apply(box); err != nil {
+					confineErr = fmt.Errorf("sandbox error: %w", err)
+					close(confineFailed)
+					return
+				}
+				log.Info().
+					Str("chroot", box.Chroot).
+					Str("user", box.User).
+					Bool("landlock", box.Landlock).
+					Bool("seccomp", box.Seccomp).
+					Msg("process confined")
+			}
+			if sent, err := systemd.Notify(systemd.Ready); err != nil {
+				log.Warn().Err(err).Msg("systemd readiness notification failed")
+			} else if sent {
+				log.Debug().Msg("readiness notified to systemd")
+			}
+		})
+		if timeout, ok := systemd.WatchdogInterval(); ok {
+			watchdog := systemd.StartWatchdog(timeout, server.CheckListener)
+			defer watchdog.Close()
+		}
 
 		// Launch server
 		log.Info().
@@ -123,20 +527,952 @@ but always rejects authentication attempts and logs credentials.`,
 			return fmt.Errorf("server runtime error: %w", err)
 		}
 
+		// Start returns once the listener is closed by a signal
+		if err := <-stopped; err != nil {
+			log.Warn().Err(err).Msg("connections still open were closed")
+		}
+		if confineErr != nil {
+			return confineErr
+		}
+		log.Info().Msg("fake SSH server stopped")
 		return nil
 	},
 }
 
+// reopenLogs opens the credential and operational log files again at their
+// paths
+func reopenLogs(credLogger *logger.CredentialsLogger) {
+	if err := logger.ReopenOperational(); err != nil {
+		log.Error().Err(err).Msg("failed to reopen operational log")
+	}
+	if err := credLogger.Reopen(); err != nil {
+		log.Error().Err(err).Msg("failed to reopen log files")
+		return
+	}
+	log.Info().Msg("log files reopened")
+}
+
+// sandboxPaths are the system files read by the server: name resolution,
+// certificate roots and time zones
+var sandboxPaths = []string{
+	"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf", "/etc/localtime",
+	"/etc/ssl", "/etc/pki", "/usr/share/zoneinfo",
+}
+
+// sandboxConfig returns the confinement of the sensor, whose Landlock rules
+// allow the files of the configuration and the system files it reads
+func sandboxConfig(cfg *config.Config) sandbox.Config {
+	read, write := cfg.SandboxPaths()
+	read = append(read, sandboxPaths...)
+	if cfgFile != "" {
+		if path, err := filepath.Abs(cfgFile); err == nil {
+			read = append(read, filepath.Dir(path))
+		}
+	}
+	return sandbox.Config{
+		Chroot:        cfg.Sandbox.Chroot,
+		User:          cfg.Sandbox.User,
+		Landlock:      cfg.Sandbox.Landlock,
+		ReadPaths:     read,
+		WritePaths:    write,
+		Seccomp:       cfg.Sandbox.Seccomp,
+		SeccompAction: cfg.Sandbox.SeccompAction,
+	}
+}
+
+// loadSensorConfig reads and validates the configuration of the sensor,
+// with the command line flags taking precedence
+func loadSensorConfig(cmd *cobra.Command) (*config.Config, error) {
+	// Command line flags take precedence
+	cfg, err := config.LoadConfigFlags(cfgFile, cmd.Flags())
+	if err != nil {
+		return nil, fmt.Errorf("configuration loading error: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyFleet returns the function passing the fleet lists of the collector
+// to the governor
+func applyFleet(governor *sshserver.Governor) func(collector.Fleet) {
+	return func(fleet collector.Fleet) {
+		deny, tarpit := governor.Fleet()
+		if err := governor.SetFleet(fleet.Denylist, fleet.Tarpit); err != nil {
+			log.Warn().Err(err).Msg("invalid fleet lists from the collector ignored")
+			return
+		}
+		if newDeny, newTarpit := governor.Fleet(); !slices.Equal(deny, newDeny) || !slices.Equal(tarpit, newTarpit) {
+			log.Info().Int("denylist", len(newDeny)).Int("tarpit", len(newTarpit)).Msg("fleet lists updated")
+		}
+	}
+}
+
+// profiledConfig returns the configuration with the profile of the collector
+// applied and the profile, or the local configuration if the collector has
+// no profile or it is invalid
+func profiledConfig(local *config.Config, sink *forward.Sink) (*config.Config, []byte) {
+	data, err := sink.FetchProfile()
+	if err != nil {
+		log.Warn().Err(err).Msg("configuration profile unavailable, using the local settings")
+		return local, nil
+	}
+	if data == nil {
+		return local, nil
+	}
+	cfg, profile, err := withProfile(local, data)
+	if err != nil {
+		log.Warn().Err(err).Msg("invalid configuration profile ignored")
+		return local, nil
+	}
+	log.Info().Str("profile", profile).Msg("configuration profile applied")
+	return cfg, data
+}
+
+// withProfile applies the profile data received from the collector to the
+// local configuration, returning the result and the name of the profile
+func withProfile(local *config.Config, data []byte) (*config.Config, string, error) {
+	profile, err := config.ParseProfile(data)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := local.WithProfile(profile)
+	if err != nil {
+		return nil, "", err
+	}
+	return cfg, profile.Name, nil
+}
+
+// newControlServer creates the admin API server of the sensor
+func newControlServer(cfg *config.Config, sensorID string, sensor *liveSensor, collector *stats.Collector) (*control.Server, error) {
+	var tokens []string
+	if cfg.API.Token != "" || cfg.API.TokenFile != "" {
+		token, err := config.ReadSecret(cfg.API.Token, cfg.API.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("admin API token loading error: %w", err)
+		}
+		tokens = append(tokens, string(token))
+	}
+
+	controlled := control.Sensor{
+		Version:     buildVersion(),
+		ID:          sensorID,
+		Listening:   sensor.server.CheckListener,
+		Stats:       collector.Snapshot,
+		Settings:    sensor.settings,
+		Governor:    sensor.server.Governor(),
+		RotateLogs:  sensor.credLogger.Rotate,
+		Banner:      sensor.server.Banner,
+		SetBanner:   sensor.server.SetBanner,
+		Threshold:   sensor.threshold,
+		LogLevel:    logger.OperationalLevel,
+		SetLogLevel: logger.SetOperationalLevel,
+		Audit:       sensor.credLogger.LogEvent,
+	}
+	if len(sensor.databases()) > 0 {
+		controlled.ReloadGeoIP = sensor.reloadDatabases
+	}
+
+	return control.New(control.Config{
+		Listen:       cfg.API.Listen,
+		Tokens:       tokens,
+		CertFile:     cfg.API.CertFile,
+		KeyFile:      cfg.API.KeyFile,
+		ClientCAFile: cfg.API.ClientCAFile,
+	}, controlled)
+}
+
+// sensorTags returns the configured tags with the sensor ID, name and
+// location added
+func sensorTags(cfg *config.Config, id string) map[string]string {
+	tags := make(map[string]string, len(cfg.Tags)+3)
+	for k, v := range cfg.Tags {
+		tags[k] = v
+	}
+	tags["sensor_id"] = id
+	if cfg.Sensor.Name != "" {
+		tags["sensor_name"] = cfg.Sensor.Name
+	}
+	if cfg.Sensor.Location != "" {
+		tags["sensor_location"] = cfg.Sensor.Location
+	}
+	return tags
+}
+
+// newProcessing creates the processors enriching events and masking their
+// sensitive data, and returns them with the enrichers to close
+func newProcessing(cfg *config.Config, credLogger *logger.CredentialsLogger) (*logger.Pipeline, []io.Closer, error) {
+	pipeline := &logger.Pipeline{}
+
+	// Enrichers add fields before the privacy processors mask the source
+	enrichers, err := addEnrichers(pipeline, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Indicators are extracted before the privacy processors, which mask the
+	// source of the ioc events as they are logged
+	if cfg.Enrichment.IOC.Enabled {
+		pipeline.AddProcessor(enrich.NewIOCExtractor(credLogger.LogEvent))
+	}
+
+	// Privacy processors run last so that they see the final event
+	if err := addPrivacyProcessors(pipeline, cfg); err != nil {
+		closeAll(enrichers)
+		return nil, nil, err
+	}
+
+	// Sprays are detected on the values as logged, so that the reported
+	// password and sources are masked like those of the attempts
+	if s := cfg.Enrichment.Spray; s.Enabled {
+		pipeline.AddProcessor(enrich.NewSprayDetector(enrich.SprayConfig{
+			Window:       s.Window,
+			MinUsernames: s.MinUsernames,
+			MinSources:   s.MinSources,
+			MaxEntries:   s.MaxEntries,
+		}, credLogger.LogEvent))
+	}
+	if s := cfg.Enrichment.Surge; s.Enabled {
+		pipeline.AddProcessor(enrich.NewSurgeDetector(enrich.SurgeConfig{
+			Interval:    s.Interval,
+			Baseline:    s.Baseline,
+			Multiplier:  s.Multiplier,
+			MinAttempts: s.MinAttempts,
+		}, credLogger.LogEvent))
+	}
+
+	return pipeline, enrichers, nil
+}
+
+// closeAll closes the enrichers in their order
+func closeAll(enrichers []io.Closer) {
+	for _, e := range enrichers {
+		e.Close()
+	}
+}
+
+// addEnrichers registers the processors adding data about the source of
+// events and returns them so that they can be closed on exit
+func addEnrichers(pipeline *logger.Pipeline, cfg *config.Config) ([]io.Closer, error) {
+	var enrichers []io.Closer
+	var cache *enrich.Cache
+
+	// Enrichers started before an error are closed, so that a failed
+	// reload leaves no updaters and refresh loops running
+	fail := func(err error) ([]io.Closer, error) {
+		if cache != nil {
+			enrichers = append(enrichers, cache)
+		}
+		closeAll(enrichers)
+		return nil, err
+	}
+
+	// Databases are downloaded before they are opened
+	if maxMind := cfg.Enrichment.MaxMind; maxMind.Enabled() {
+		key, err := config.ReadSecret(maxMind.LicenseKey, maxMind.LicenseKeyFile)
+		if err != nil {
+			return fail(fmt.Errorf("MaxMind license key loading error: %w", err))
+		}
+		var downloads []enrich.MMDBDownload
+		for _, db := range []config.MMDBConfig{cfg.Enrichment.GeoIP, cfg.Enrichment.ASN} {
+			if db.Database != "" {
+				downloads = append(downloads, enrich.MMDBDownload{Edition: db.Edition, Path: db.Database})
+			}
+		}
+		updater := enrich.NewUpdater(enrich.UpdaterConfig{
+			AccountID:  maxMind.AccountID,
+			LicenseKey: string(key),
+			Interval:   maxMind.UpdateInterval,
+			Databases:  downloads,
+		})
+		if err := updater.Update(context.Background()); err != nil {
+			log.Warn().Err(err).Msg("MaxMind database update failed")
+		}
+		updater.Start()
+		enrichers = append(enrichers, updater)
+	}
+
+	if cfg.Enrichment.GeoIP.Database != "" {
+		geoIP, err := enrich.NewGeoIP(cfg.Enrichment.GeoIP.Database, cfg.Enrichment.GeoIP.ReloadInterval)
+		if err != nil {
+			return fail(fmt.Errorf("GeoIP database loading error: %w", err))
+		}
+		log.Info().
+			Str("database", cfg.Enrichment.GeoIP.Database).
+			Str("type", geoIP.Metadata().DatabaseType).
+			Msg("GeoIP enrichment enabled")
+		pipeline.AddProcessor(geoIP)
+		enrichers = append(enrichers, geoIP)
+	}
+
+	if cfg.Enrichment.ASN.Database != "" {
+		asn, err := enrich.NewASN(cfg.Enrichment.ASN.Database, cfg.Enrichment.ASN.ReloadInterval)
+		if err != nil {
+			return fail(fmt.Errorf("ASN database loading error: %w", err))
+		}
+		log.Info().
+			Str("database", cfg.Enrichment.ASN.Database).
+			Str("type", asn.Metadata().DatabaseType).
+			Msg("ASN enrichment enabled")
+		pipeline.AddProcessor(asn)
+		enrichers = append(enrichers, asn)
+	}
+
+	// Results of lookups in other services are shared and outlive the enrichers
+	if cfg.Enrichment.UsesCache() {
+		var err error
+		cache, err = enrich.NewCache(cfg.Enrichment.Cache.Size, cfg.Enrichment.Cache.File, cfg.Enrichment.Cache.SaveInterval)
+		if err != nil {
+			return fail(fmt.Errorf("enrichment cache loading error: %w", err))
+		}
+		log.Info().Int("entries", cache.Len()).Str("file", cfg.Enrichment.Cache.File).Msg("enrichment cache ready")
+	}
+
+	if cfg.Enrichment.RDNS.Enabled {
+		rdns := enrich.NewRDNS(enrich.RDNSConfig{
+			Concurrency: cfg.Enrichment.RDNS.Concurrency,
+			Timeout:     cfg.Enrichment.RDNS.Timeout,
+			Cache:       cache,
+			CacheTTL:    cfg.Enrichment.RDNS.CacheTTL,
+		})
+		pipeline.AddProcessor(rdns)
+		enrichers = append(enrichers, rdns)
+	}
+
+	if cfg.Enrichment.Cloud.Enabled {
+		sources := enrich.DefaultCloudSources
+		if len(cfg.Enrichment.Cloud.Sources) > 0 {
+			sources = nil
+			for _, src := range cfg.Enrichment.Cloud.Sources {
+				sources = append(sources, enrich.CloudSource{
+					Provider: src.Provider,
+					Location: src.URL,
+					Format:   src.Format,
+				})
+			}
+		}
+		cloud, err := enrich.NewCloud(sources, cfg.Enrichment.Cloud.RefreshInterval)
+		if err != nil {
+			return fail(fmt.Errorf("cloud provider ranges loading error: %w", err))
+		}
+		pipeline.AddProcessor(cloud)
+		enrichers = append(enrichers, cloud)
+	}
+
+	reputation := cfg.Enrichment.Reputation
+	reputationConfig := enrich.ReputationConfig{
+		Concurrency: reputation.Concurrency,
+		Timeout:     reputation.Timeout,
+		Cache:       cache,
+		CacheTTL:    reputation.CacheTTL,
+	}
+	if reputation.AbuseIPDB.Enabled {
+		key, err := config.ReadSecret(reputation.AbuseIPDB.APIKey, reputation.AbuseIPDB.APIKeyFile)
+		if err != nil {
+			return fail(fmt.Errorf("AbuseIPDB key loading error: %w", err))
+		}
+		abuseConfig := reputationConfig
+		abuseConfig.APIKey = string(key)
+		abuseIPDB := enrich.NewAbuseIPDB(abuseConfig, reputation.AbuseIPDB.MaxAgeDays)
+		pipeline.AddProcessor(abuseIPDB)
+		enrichers = append(enrichers, abuseIPDB)
+	}
+	if reputation.GreyNoise.Enabled {
+		key, err := config.ReadSecret(reputation.GreyNoise.APIKey, reputation.GreyNoise.APIKeyFile)
+		if err != nil {
+			return fail(fmt.Errorf("GreyNoise key loading error: %w", err))
+		}
+		greyNoiseConfig := reputationConfig
+		greyNoiseConfig.APIKey = string(key)
+		greyNoise := enrich.NewGreyNoise(greyNoiseConfig)
+		pipeline.AddProcessor(greyNoise)
+		enrichers = append(enrichers, greyNoise)
+	}
+
+	if len(cfg.Enrichment.Blocklists.Lists) > 0 {
+		var sources []enrich.BlocklistSource
+		for _, list := range cfg.Enrichment.Blocklists.Lists {
+			sources = append(sources, enrich.BlocklistSource{Name: list.Name, Location: list.URL})
+		}
+		blocklists := enrich.NewBlocklists(sources, cfg.Enrichment.Blocklists.RefreshInterval)
+		pipeline.AddProcessor(blocklists)
+		enrichers = append(enrichers, blocklists)
+	}
+
+	if cfg.Enrichment.Dictionaries.Enabled {
+		var sources []enrich.DictionarySource
+		for _, name := range cfg.Enrichment.Dictionaries.Builtin {
+			sources = append(sources, enrich.DictionarySource{Name: name})
+		}
+		for _, dict := range cfg.Enrichment.Dictionaries.Custom {
+			sources = append(sources, enrich.DictionarySource{Name: dict.Name, Location: dict.URL})
+		}
+		dicts, err := enrich.NewDictionaries(sources)
+		if err != nil {
+			return fail(fmt.Errorf("credential dictionary loading error: %w", err))
+		}
+		log.Info().Int("credentials", dicts.Len()).Msg("credential dictionaries loaded")
+		pipeline.AddProcessor(dicts)
+	}
+
+	if cfg.Enrichment.PasswordAnalysis {
+		pipeline.AddProcessor(enrich.PasswordAnalyzer{})
+	}
+
+	if cfg.Enrichment.Usernames.Enabled {
+		rules := enrich.DefaultUsernameRules
+		if len(cfg.Enrichment.Usernames.Rules) > 0 {
+			rules = nil
+			for _, rule := range cfg.Enrichment.Usernames.Rules {
+				rules = append(rules, enrich.UsernameRule{
+					Category:  rule.Category,
+					Usernames: rule.Usernames,
+					Pattern:   rule.Pattern,
+				})
+			}
+		}
+		classifier, err := enrich.NewUsernameClassifier(rules)
+		if err != nil {
+			return fail(fmt.Errorf("username classifier creation error: %w", err))
+		}
+		pipeline.AddProcessor(classifier)
+	}
+
+	if cfg.Enrichment.HIBP.Enabled {
+		hibp := enrich.NewHIBP(enrich.HIBPConfig{
+			Concurrency: cfg.Enrichment.HIBP.Concurrency,
+			Timeout:     cfg.Enrichment.HIBP.Timeout,
+			CacheSize:   cfg.Enrichment.HIBP.CacheSize,
+			CacheTTL:    cfg.Enrichment.HIBP.CacheTTL,
+		})
+		pipeline.AddProcessor(hibp)
+		enrichers = append(enrichers, hibp)
+	}
+
+	if attackers := cfg.Enrichment.Attackers; attackers.Enabled {
+		tracker, err := enrich.NewAttackerTracker(attackers.MaxEntries, attackers.File, attackers.SaveInterval)
+		if err != nil {
+			return fail(fmt.Errorf("attacker tracker creation error: %w", err))
+		}
+		pipeline.AddProcessor(tracker)
+		enrichers = append(enrichers, tracker)
+	}
+
+	if c := cfg.Enrichment.Campaigns; c.Enabled {
+		pipeline.AddProcessor(enrich.NewCampaigns(enrich.CampaignConfig{
+			MinAttempts: c.MinAttempts,
+			Window:      c.Window,
+			MaxSources:  c.MaxSources,
+		}))
+	}
+
+	// The cache is closed last, after running lookups have stored their results
+	if cache != nil {
+		enrichers = append(enrichers, cache)
+	}
+
+	return enrichers, nil
+}
+
+// newAlertManager creates the alert triggers and notifiers. The threshold
+// trigger is checked even while disabled, so that the admin API can enable it.
+func newAlertManager(cfg *config.Config, threshold *alert.ThresholdTrigger) (*alert.Manager, error) {
+	var triggers []alert.Trigger
+	if cfg.Alerts.NewAttacker {
+		triggers = append(triggers, alert.NewAttackerTrigger{})
+	}
+	if cfg.Alerts.NewCountry {
+		triggers = append(triggers, alert.NewCountryTrigger{})
+	}
+	if cfg.Alerts.NewASN {
+		triggers = append(triggers, alert.NewASNTrigger{})
+	}
+	if cfg.Alerts.PasswordSpray {
+		triggers = append(triggers, alert.SprayTrigger{})
+	}
+	if cfg.Alerts.AttackSurge {
+		triggers = append(triggers, alert.SurgeTrigger{})
+	}
+	if len(cfg.Alerts.InternalNetworks) > 0 {
+		networks, err := alert.ParseNetworks(cfg.Alerts.InternalNetworks)
+		if err != nil {
+			return nil, fmt.Errorf("internal networks: %w", err)
+		}
+		triggers = append(triggers, alert.NewInternalSourceTrigger(networks))
+	}
+	rules, cooldowns, err := newRuleTriggers(cfg.Alerts.Rules)
+	if err != nil {
+		return nil, err
+	}
+	if len(triggers) == 0 && len(rules) == 0 && cfg.Alerts.AttemptsThreshold == 0 {
+		log.Warn().Msg("alert notifiers are configured without triggers")
+	}
+	triggers = append(triggers, threshold)
+
+	var notifiers []alert.Notifier
+	if slack := cfg.Alerts.Slack; slack.Enabled() {
+		url, err := config.ReadSecret(slack.WebhookURL, slack.WebhookURLFile)
+		if err != nil {
+			return nil, fmt.Errorf("Slack webhook URL loading error: %w", err)
+		}
+		tmpl, err := alert.ParseTemplate(slack.Template)
+		if err != nil {
+			return nil, err
+		}
+		notifier, err := alert.NewSlack(alert.SlackConfig{WebhookURL: string(url), Template: tmpl})
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, alert.ForRules(notifier, slack.Rules...))
+	}
+	if telegram := cfg.Alerts.Telegram; telegram.Enabled() {
+		token, err := config.ReadSecret(telegram.BotToken, telegram.BotTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("Telegram bot token loading error: %w", err)
+		}
+		tmpl, err := alert.ParseTemplate(telegram.Template)
+		if err != nil {
+			return nil, err
+		}
+		notifier, err := alert.NewTelegram(alert.TelegramConfig{
+			BotToken: string(token),
+			ChatID:   telegram.ChatID,
+			Template: tmpl,
+		})
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, alert.ForRules(notifier, telegram.Rules...))
+	}
+	if discord := cfg.Alerts.Discord; discord.Enabled() {
+		url, err := config.ReadSecret(discord.WebhookURL, discord.WebhookURLFile)
+		if err != nil {
+			return nil, fmt.Errorf("Discord webhook URL loading error: %w", err)
+		}
+		var tmpl *template.Template
+		if discord.Template != "" {
+			if tmpl, err = alert.ParseTemplate(discord.Template); err != nil {
+				return nil, err
+			}
+		}
+		notifier := alert.NewDiscord(alert.DiscordConfig{WebhookURL: string(url), Template: tmpl})
+		notifiers = append(notifiers, alert.ForRules(notifier, discord.Rules...))
+	}
+	if pagerduty := cfg.Alerts.PagerDuty; pagerduty.Enabled() {
+		key, err := config.ReadSecret(pagerduty.RoutingKey, pagerduty.RoutingKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("PagerDuty routing key loading error: %w", err)
+		}
+		notifier := alert.NewPagerDuty(alert.PagerDutyConfig{RoutingKey: string(key)})
+		notifiers = append(notifiers, alert.ForRules(alert.MinSeverity(notifier, alert.Severity(pagerduty.MinSeverity)), pagerduty.Rules...))
+	}
+	if opsgenie := cfg.Alerts.Opsgenie; opsgenie.Enabled() {
+		key, err := config.ReadSecret(opsgenie.APIKey, opsgenie.APIKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Opsgenie API key loading error: %w", err)
+		}
+		tmpl, err := alert.ParseTemplate(opsgenie.Template)
+		if err != nil {
+			return nil, err
+		}
+		notifier, err := alert.NewOpsgenie(alert.OpsgenieConfig{
+			APIKey:   string(key),
+			APIURL:   opsgenie.APIURL,
+			Template: tmpl,
+		})
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, alert.ForRules(alert.MinSeverity(notifier, alert.Severity(opsgenie.MinSeverity)), opsgenie.Rules...))
+	}
+	if ntfy := cfg.Alerts.Ntfy; ntfy.Enabled() {
+		token, err := config.ReadSecret(ntfy.Token, ntfy.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("ntfy token loading error: %w", err)
+		}
+		tmpl, err := alert.ParseTemplate(ntfy.Template)
+		if err != nil {
+			return nil, err
+		}
+		notifier, err := alert.NewNtfy(alert.NtfyConfig{
+			Server:   ntfy.Server,
+			Topic:    ntfy.Topic,
+			Token:    string(token),
+			Template: tmpl,
+		})
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, alert.ForRules(notifier, ntfy.Rules...))
+	}
+	if pushover := cfg.Alerts.Pushover; pushover.Enabled() {
+		token, err := config.ReadSecret(pushover.AppToken, pushover.AppTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("Pushover app token loading error: %w", err)
+		}
+		tmpl, err := alert.ParseTemplate(pushover.Template)
+		if err != nil {
+			return nil, err
+		}
+		notifier, err := alert.NewPushover(alert.PushoverConfig{
+			AppToken: string(token),
+			UserKey:  pushover.UserKey,
+			Device:   pushover.Device,
+			Template: tmpl,
+		})
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, alert.ForRules(notifier, pushover.Rules...))
+	}
+	if email := cfg.Alerts.Email; email.SendsAlerts() {
+		notifier, err := newEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, alert.ForRules(notifier, email.Rules...))
+	}
+
+	manager := alert.NewManager(alert.Config{
+		QueueSize:   cfg.Alerts.QueueSize,
+		Timeout:     cfg.Alerts.Timeout,
+		Cooldown:    cfg.Alerts.Cooldown,
+		BatchWindow: cfg.Alerts.BatchWindow,
+	}, triggers, notifiers)
+	manager.SetRules(rules, cooldowns)
+	return manager, nil
+}
+
+// newRuleTriggers creates the triggers of the custom alert rules and their
+// cooldowns
+func newRuleTriggers(rules []config.AlertRuleConfig) ([]*alert.RuleTrigger, map[string]time.Duration, error) {
+	var triggers []*alert.RuleTrigger
+	cooldowns := make(map[string]time.Duration)
+	for _, r := range rules {
+		trigger, err := newRuleTrigger(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		triggers = append(triggers, trigger)
+		if r.Cooldown > 0 {
+			cooldowns[r.Name] = r.Cooldown
+		}
+	}
+	return triggers, cooldowns, nil
+}
+
+// newRuleTrigger creates the trigger of a custom alert rule
+func newRuleTrigger(r config.AlertRuleConfig) (*alert.RuleTrigger, error) {
+	rule := alert.Rule{
+		Name:      r.Name,
+		Severity:  alert.Severity(r.Severity),
+		Events:    r.Events,
+		Threshold: r.Threshold,
+		Window:    r.Window,
+		GroupBy:   r.GroupBy,
+		Notifiers: r.Notifiers,
+	}
+	if rule.Severity == "" {
+		rule.Severity = alert.SeverityWarning
+	}
+	if r.Message != "" {
+		tmpl, err := template.New(r.Name).Parse(r.Message)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %s: %w", r.Name, err)
+		}
+		rule.Message = tmpl
+	}
+	for _, c := range r.Conditions {
+		condition := alert.Condition{
+			Field:  c.Field,
+			In:     c.In,
+			Min:    c.Min,
+			Max:    c.Max,
+			Exists: c.Exists,
+			Not:    c.Not,
+		}
+		networks, err := alert.ParseNetworks(c.Networks)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %s: %w", r.Name, err)
+		}
+		condition.Networks = networks
+		if c.Regex != "" {
+			re, err := regexp.Compile(c.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("alert rule %s: %w", r.Name, err)
+			}
+			condition.Regex = re
+		}
+		rule.Conditions = append(rule.Conditions, condition)
+	}
+	return alert.NewRuleTrigger(rule), nil
+}
+
+// newEmail creates the email notifier used for alerts and digests
+func newEmail(email config.EmailConfig) (*alert.Email, error) {
+	password, err := config.ReadSecret(email.Password, email.PasswordFile)
+	if err != nil {
+		return nil, fmt.Errorf("SMTP password loading error: %w", err)
+	}
+	tmpl, err := alert.ParseTemplate(email.Template)
+	if err != nil {
+		return nil, err
+	}
+	return alert.NewEmail(alert.EmailConfig{
+		Host:     email.Host,
+		Port:     email.Port,
+		Security: email.Security,
+		Username: email.Username,
+		Password: string(password),
+		From:     email.From,
+		To:       email.To,
+		Template: tmpl,
+	})
+}
+
+// startReports schedules the reports of the log file and their delivery
+// through the email, Slack and Discord notifiers
+func startReports(cfg *config.Config) (*alert.ScheduledReports, error) {
+	loc, err := time.LoadLocation(cfg.Reports.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	sched, err := schedule.Parse(cfg.Reports.Schedule, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	var senders []alert.ReportSender
+	if email := cfg.Alerts.Email; email.Enabled() && cfg.Reports.Delivers("email") {
+		notifier, err := newEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		senders = append(senders, notifier)
+	}
+	if slack := cfg.Alerts.Slack; slack.Enabled() && cfg.Reports.Delivers("slack") {
+		url, err := config.ReadSecret(slack.WebhookURL, slack.WebhookURLFile)
+		if err != nil {
+			return nil, fmt.Errorf("Slack webhook URL loading error: %w", err)
+		}
+		notifier, err := alert.NewSlack(alert.SlackConfig{WebhookURL: string(url)})
+		if err != nil {
+			return nil, err
+		}
+		senders = append(senders, notifier)
+	}
+	if discord := cfg.Alerts.Discord; discord.Enabled() && cfg.Reports.Delivers("discord") {
+		url, err := config.ReadSecret(discord.WebhookURL, discord.WebhookURLFile)
+		if err != nil {
+			return nil, fmt.Errorf("Discord webhook URL loading error: %w", err)
+		}
+		senders = append(senders, alert.NewDiscord(alert.DiscordConfig{WebhookURL: string(url)}))
+	}
+
+	log.Info().Str("schedule", cfg.Reports.Schedule).Time("next", sched.Next(time.Now())).Msg("reports scheduled")
+	return alert.StartReports(alert.ReportConfig{
+		Schedule: sched,
+		Timeout:  cfg.Alerts.Timeout,
+	}, func(now time.Time) (alert.Report, error) {
+		return generateReport(cfg, now)
+	}, senders), nil
+}
+
+// generateReport summarizes the attempts of the report period ending now,
+// read from the log file and its rotated copies
+func generateReport(cfg *config.Config, now time.Time) (alert.Report, error) {
+	r := cfg.Reports
+	filter := report.Filter{Since: now.Add(-r.Period), Until: now}
+	times, err := logger.NewTimeFormat(cfg.Log.TimeFormat, cfg.Log.Timezone)
+	if err != nil {
+		return alert.Report{}, err
+	}
+	paths, err := rotatedLogs(cfg.Log.File, filter.Since)
+	if err != nil {
+		return alert.Report{}, err
+	}
+
+	summarizer := report.NewSummarizer(r.Top)
+	var html *report.HTMLReport
+	if r.Format == config.ReportHTML {
+		html = report.NewHTMLReport(report.HTMLConfig{Title: r.Title, Top: r.Top, Since: filter.Since, Until: filter.Until})
+	}
+	err = logger.ReadLogs(paths, times, func(event *logger.Event) error {
+		if filter.Match(event) {
+			summarizer.Add(event)
+			if html != nil {
+				html.Add(event)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return alert.Report{}, err
+	}
+
+	summary := summarizer.Summary()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Attempts from %s to %s\n\n", filter.Since.UTC().Format(time.RFC3339), filter.Until.UTC().Format(time.RFC3339))
+	if err := summary.WriteTable(&buf); err != nil {
+		return alert.Report{}, err
+	}
+	result := alert.Report{
+		Subject: fmt.Sprintf("[fakessh] %s: %d attempts from %d sources", r.Title, summary.Attempts, summary.UniqueIPs),
+		Summary: buf.String(),
+	}
+	if html != nil {
+		var page bytes.Buffer
+		if err := html.Write(&page, now); err != nil {
+			return alert.Report{}, err
+		}
+		result.Filename = "fakessh-report-" + now.In(filter.Since.Location()).Format(time.DateOnly) + ".html"
+		result.ContentType = "text/html; charset=utf-8"
+		result.Data = page.Bytes()
+	}
+	return result, nil
+}
+
+// rotatedLogs returns the rotated copies of the log file (FILE.1,
+// FILE.2.gz, FILE-20240101.gz) that were written to at or after since,
+// oldest first, followed by the log file
+func rotatedLogs(path string, since time.Time) ([]string, error) {
+	var paths []string
+	modified := make(map[string]time.Time)
+	for _, pattern := range []string{path + ".*", path + "-*"} {
+		rotated, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range rotated {
+			if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() && !info.ModTime().Before(since) {
+				paths = append(paths, p)
+				modified[p] = info.ModTime()
+			}
+		}
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		return modified[paths[i]].Before(modified[paths[j]])
+	})
+	return append(paths, path), nil
+}
+
+// addPrivacyProcessors registers the processors masking sensitive event data
+func addPrivacyProcessors(pipeline *logger.Pipeline, cfg *config.Config) error {
+	if cfg.Privacy.PasswordMode != "" && cfg.Privacy.PasswordMode != privacy.PasswordPlain {
+		key, err := config.ReadSecret(cfg.Privacy.PasswordKey, cfg.Privacy.PasswordKeyFile)
+		if err != nil {
+			return fmt.Errorf("password key loading error: %w", err)
+		}
+		masker, err := privacy.NewPasswordMasker(cfg.Privacy.PasswordMode, key, cfg.Privacy.PasswordTruncate)
+		if err != nil {
+			return fmt.Errorf("password masker creation error: %w", err)
+		}
+		pipeline.AddProcessor(masker)
+	}
+
+	if cfg.Privacy.IPMode != "" && cfg.Privacy.IPMode != privacy.IPNone {
+		key, err := config.ReadSecret(cfg.Privacy.IPKey, cfg.Privacy.IPKeyFile)
+		if err != nil {
+			return fmt.Errorf("IP anonymization key loading error: %w", err)
+		}
+		anonymizer, err := privacy.NewIPAnonymizer(cfg.Privacy.IPMode, key)
+		if err != nil {
+			return fmt.Errorf("IP anonymizer creation error: %w", err)
+		}
+		pipeline.AddProcessor(anonymizer)
+	}
+
+	return nil
+}
+
+// newCredentialsLogger creates the credentials logger with its secrets loaded
+func newCredentialsLogger(cfg *config.Config, registry *metrics.Registry, tracer *tracing.Tracer) (*logger.CredentialsLogger, error) {
+	loggerConfig, err := loadLoggerConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	loggerConfig.Metrics = registry
+	loggerConfig.Tracer = tracer
+
+	credLogger, err := logger.NewCredentialsLogger(loggerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("logger creation error: %w", err)
+	}
+	return credLogger, nil
+}
+
+// loadLoggerConfig returns the logger settings with the time format and the
+// secrets they refer to loaded
+func loadLoggerConfig(cfg *config.Config) (logger.Config, error) {
+	var err error
+	loggerConfig := newLoggerConfig(cfg)
+	loggerConfig.TimeFormat, err = logger.NewTimeFormat(cfg.Log.TimeFormat, cfg.Log.Timezone)
+	if err != nil {
+		return loggerConfig, fmt.Errorf("timestamp format error: %w", err)
+	}
+	loggerConfig.ChainKey, err = config.ReadSecret(cfg.Log.ChainKey, cfg.Log.ChainKeyFile)
+	if err != nil {
+		return loggerConfig, fmt.Errorf("chain key loading error: %w", err)
+	}
+
+	loggerConfig.Encryption.Recipients, err = cfg.Log.Encryption.LoadRecipients()
+	if err != nil {
+		return loggerConfig, fmt.Errorf("encryption recipients loading error: %w", err)
+	}
+	return loggerConfig, nil
+}
+
+// newLoggerConfig converts the application configuration into logger settings
+func newLoggerConfig(cfg *config.Config) logger.Config {
+	loggerConfig := logger.Config{
+		LogFile:         cfg.Log.File,
+		LogFormat:       cfg.Log.Format,
+		Mapping:         newFieldMapping(cfg.Log.FieldsConfig),
+		EmergencyFile:   cfg.Log.EmergencyFile,
+		Tags:            cfg.Tags,
+		AggregateWindow: cfg.Log.AggregateWindow,
+		Encryption: logger.EncryptionConfig{
+			SegmentRecords:  cfg.Log.Encryption.SegmentRecords,
+			SegmentInterval: cfg.Log.Encryption.SegmentInterval,
+		},
+	}
+
+	for _, sink := range cfg.Log.Sinks {
+		format := sink.Format
+		if format == "" {
+			format = cfg.Log.Format
+		}
+		loggerConfig.Sinks = append(loggerConfig.Sinks, logger.SinkConfig{
+			Type:    sink.Type,
+			Path:    sink.Path,
+			Format:  format,
+			Mapping: newFieldMapping(sink.FieldsConfig),
+		})
+	}
+
+	return loggerConfig
+}
+
+// newFieldMapping converts field settings into a logger field mapping
+func newFieldMapping(fields config.FieldsConfig) logger.FieldMapping {
+	return logger.FieldMapping{
+		Fields:  fields.Fields,
+		Exclude: fields.Exclude,
+		Rename:  fields.Rename,
+	}
+}
+
 func init() {
 	// Command line flags
 	rootCmd.Flags().StringVar(&cfgFile, "config", "", "path to configuration file")
-	rootCmd.Flags().IntVar(&port, "port", 2222, "SSH server port")
-	rootCmd.Flags().StringVar(&logFile, "log", "credentials.log", "path to credentials log file (stdout for console output)")
-	rootCmd.Flags().StringVar(&logFormat, "log-format", "json", "log format (json, pretty or text)")
-	rootCmd.Flags().StringVar(&banner, "banner", "Ubuntu-4ubuntu0.5", "SSH banner (version part)")
-	rootCmd.Flags().StringVar(&serverVersion, "server-version", "OpenSSH_8.2p1", "SSH server version")
-	rootCmd.Flags().StringVar(&privateKeyPath, "key", "", "path to SSH private key (if not specified, built-in or newly generated will be used)")
-	rootCmd.Flags().BoolVar(&generateKey, "generate-key", true, "generate a new SSH key on each start")
+	for _, f := range sensorFlags {
+		if err := config.AddFlag(rootCmd.Flags(), f.name, f.key, f.usage); err != nil {
+			panic(err)
+		}
+	}
+	config.AddFlags(rootCmd.Flags())
 }
 
 func main() {
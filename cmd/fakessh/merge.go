@@ -0,0 +1,133 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mergeConfigFile string
+	mergeOut        string
+	mergeFormat     string
+	mergeColumns    []string
+)
+
+// mergeCmd combines the logs of several sensors
+var mergeCmd = &cobra.Command{
+	Use:   "merge [flags] [SENSOR=]FILE...",
+	Short: "Combine the credential logs of several sensors",
+	Long: `Combine the credential logs of several sensors into one log ordered by
+time. Every event gets a sensor_id field naming its sensor, unless it already
+has one from the sensor_id tag: the SENSOR given before the file, or the
+file name without extensions. Events found more than once, e.g. in
+overlapping copies of a log, are written once; events of older versions
+without an ID are compared by content with the events of other logs.
+
+The merged log is written as JSON lines, or as CSV or SQL like export. All
+events are held in memory for sorting.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, times, err := logPaths(mergeConfigFile, args)
+		if err != nil {
+			return err
+		}
+
+		out := os.Stdout
+		if mergeOut != "" && mergeOut != "-" {
+			if out, err = os.Create(mergeOut); err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		w := bufio.NewWriter(out)
+		exporter, err := report.NewExporter(mergeFormat, w, mergeColumns)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		merger := report.NewMerger()
+		for _, arg := range args {
+			sensor, path := mergeSource(arg)
+			add := merger.Log(sensor)
+			err := logger.ReadLogs([]string{path}, times, func(event *logger.Event) error {
+				add(event)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		events := merger.Events()
+		for _, event := range events {
+			if err := exporter.Write(event); err != nil {
+				return err
+			}
+		}
+		if err := exporter.Close(); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to write merged log: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Merged %d events from %d logs, %d duplicates dropped\n", len(events), len(args), merger.Duplicates())
+		if out != os.Stdout {
+			return out.Close()
+		}
+		return nil
+	},
+}
+
+// mergeSource splits a SENSOR=FILE argument. Without a sensor, it is the
+// file name without extensions, e.g. sensor-01 for sensor-01.log.gz.
+func mergeSource(arg string) (sensor, path string) {
+	if name, file, ok := strings.Cut(arg, "="); ok && name != "" && !strings.ContainsRune(name, filepath.Separator) {
+		if _, err := os.Stat(arg); err != nil {
+			return name, file
+		}
+	}
+	if arg == "-" {
+		return "", arg
+	}
+	sensor = filepath.Base(arg)
+	if i := strings.IndexByte(sensor, '.'); i > 0 {
+		sensor = sensor[:i]
+	}
+	return sensor, arg
+}
+
+func init() {
+	mergeCmd.Flags().StringVar(&mergeConfigFile, "config", "", "path to configuration file with the time format of the logs")
+	mergeCmd.Flags().StringVar(&mergeOut, "out", "", "output file (default standard output)")
+	mergeCmd.Flags().StringVar(&mergeFormat, "format", report.ExportJSON, "output format: json, csv or sql")
+	mergeCmd.Flags().StringSliceVar(&mergeColumns, "columns", append([]string{report.SensorField}, report.DefaultColumns...), "columns of the csv and sql formats")
+
+	rootCmd.AddCommand(mergeCmd)
+}
@@ -0,0 +1,163 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/intel"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mispConfigFile   string
+	mispOut          string
+	mispURL          string
+	mispKey          string
+	mispKeyFile      string
+	mispInfo         string
+	mispTags         []string
+	mispDistribution int
+	mispThreatLevel  int
+	mispMinAttempts  int
+	mispCredentials  int
+	mispSince        string
+	mispUntil        string
+	mispTimeout      time.Duration
+)
+
+// mispCmd packages the indicators of credential logs as a MISP event
+var mispCmd = &cobra.Command{
+	Use:   "misp [flags] [FILE...]",
+	Short: "Export attacker addresses, credentials and IOCs as a MISP event",
+	Long: `Read credential logs in JSON format and package their indicators into an
+unpublished MISP event for threat intelligence sharing:
+
+  - the addresses of sources with at least --min-attempts attempts as
+    ip-src attributes with first and last seen times
+  - indicators of compromise extracted from commands (ioc events) as url,
+    domain, ip-dst, md5, sha1 and sha256 attributes
+  - the --credentials most tried credentials as credential objects
+
+Anonymized, private and local addresses and masked passwords are left out.
+The event is written as MISP JSON, or created on the MISP server given with
+--url using the API key of a user allowed to add events. Without files, the log of the
+configuration is read; "-" reads standard input.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if mispDistribution < 0 || mispDistribution > 3 {
+			return fmt.Errorf("invalid distribution: must be between 0 and 3")
+		}
+		if mispThreatLevel < 1 || mispThreatLevel > 4 {
+			return fmt.Errorf("invalid threat level: must be between 1 and 4")
+		}
+		if mispMinAttempts < 1 || mispCredentials < 0 {
+			return fmt.Errorf("invalid limits: minimum attempts must be positive, credentials not negative")
+		}
+		filter, err := parseFilter(mispSince, mispUntil)
+		if err != nil {
+			return err
+		}
+		key, err := config.ReadSecret(mispKey, mispKeyFile)
+		if err != nil {
+			return err
+		}
+		if mispURL != "" && len(key) == 0 {
+			return fmt.Errorf("an API key is required to push events (--key or --key-file)")
+		}
+		paths, times, err := logPaths(mispConfigFile, args)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		collector := intel.NewCollector()
+		err = logger.ReadLogs(paths, times, func(event *logger.Event) error {
+			if filter.Match(event) {
+				collector.Add(event)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		event := intel.NewMISPEvent(collector, intel.MISPConfig{
+			Info:         mispInfo,
+			Tags:         mispTags,
+			Distribution: mispDistribution,
+			ThreatLevel:  mispThreatLevel,
+			MinAttempts:  mispMinAttempts,
+			Credentials:  mispCredentials,
+		}, time.Now())
+
+		if mispURL != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), mispTimeout)
+			defer cancel()
+			id, err := intel.PushMISP(ctx, &http.Client{}, mispURL, string(key), event)
+			if err != nil {
+				return fmt.Errorf("failed to create MISP event: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Created MISP event %s with %d attributes and %d objects\n", id, len(event.Event.Attribute), len(event.Event.Object))
+			return nil
+		}
+
+		out := os.Stdout
+		if mispOut != "" && mispOut != "-" {
+			if out, err = os.Create(mispOut); err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to write MISP event: %w", err)
+		}
+		if out != os.Stdout {
+			return out.Close()
+		}
+		return nil
+	},
+}
+
+func init() {
+	mispCmd.Flags().StringVar(&mispConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	mispCmd.Flags().StringVar(&mispOut, "out", "", "output file (default standard output)")
+	mispCmd.Flags().StringVar(&mispURL, "url", "", "URL of a MISP server the event is created on instead of written")
+	mispCmd.Flags().StringVar(&mispKey, "key", "", "MISP API key")
+	mispCmd.Flags().StringVar(&mispKeyFile, "key-file", "", "file containing the MISP API key")
+	mispCmd.Flags().StringVar(&mispInfo, "info", "", "event description (default a summary with the period)")
+	mispCmd.Flags().StringSliceVar(&mispTags, "tag", nil, "tags of the event, e.g. tlp:green")
+	mispCmd.Flags().IntVar(&mispDistribution, "distribution", 0, "distribution: 0 organisation, 1 community, 2 connected communities, 3 all")
+	mispCmd.Flags().IntVar(&mispThreatLevel, "threat-level", 3, "threat level: 1 high, 2 medium, 3 low, 4 undefined")
+	mispCmd.Flags().IntVar(&mispMinAttempts, "min-attempts", 1, "attempts of a source before its address is included")
+	mispCmd.Flags().IntVar(&mispCredentials, "credentials", 100, "most tried credentials included, all if 0")
+	mispCmd.Flags().StringVar(&mispSince, "since", "", "only include events at or after this time")
+	mispCmd.Flags().StringVar(&mispUntil, "until", "", "only include events before this time")
+	mispCmd.Flags().DurationVar(&mispTimeout, "timeout", 30*time.Second, "timeout of the request to the MISP server")
+
+	rootCmd.AddCommand(mispCmd)
+}
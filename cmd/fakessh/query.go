@@ -0,0 +1,84 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	queryConfigFile string
+	queryFormat     string
+	queryOut        string
+	queryColumns    []string
+	queryLimit      int
+)
+
+// queryCmd prints the events of credential logs matching an expression
+var queryCmd = &cobra.Command{
+	Use:   "query [flags] EXPR [FILE...]",
+	Short: "Print the events of credential logs matching an expression",
+	Long: `Read credential logs in JSON format and print the events matching a filter
+expression, e.g.
+
+  fakessh query 'username == "root" && country == "CN" && ts > "2024-01-01"'
+
+Operands are event fields, the columns time (or ts), event, event_id,
+message, source_ip and source_port, double-quoted or backquoted strings,
+numbers, true, false and null. Comparisons are ==, !=, <, <=, >, >=, and
+=~ and !~ for regular expressions; they combine with &&, || and ! and group
+with parentheses. A field on its own is true if it is set to anything but
+false, 0 or "". Times compare with RFC3339 times, dates and durations before
+now: ts > "24h" selects the last day.
+
+Events are printed as JSON lines, or as CSV or SQL with the selected
+columns like export. Without files, the log of the configuration is read;
+"-" reads standard input.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		expr, err := report.ParseExpr(args[0], time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid expression: %w", err)
+		}
+		paths, times, err := logPaths(queryConfigFile, args[1:])
+		if err != nil {
+			return err
+		}
+		return exportEvents(cmd, exportOutput{
+			format:  queryFormat,
+			path:    queryOut,
+			columns: queryColumns,
+			limit:   queryLimit,
+		}, paths, times, expr.Match)
+	},
+}
+
+func init() {
+	queryCmd.Flags().StringVar(&queryConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	queryCmd.Flags().StringVar(&queryFormat, "format", report.ExportJSON, "output format: json, csv or sql")
+	queryCmd.Flags().StringVar(&queryOut, "out", "", "output file (default standard output)")
+	queryCmd.Flags().StringSliceVar(&queryColumns, "columns", report.DefaultColumns, "columns of the csv and sql formats")
+	queryCmd.Flags().IntVar(&queryLimit, "limit", 0, "print at most this many events (0 for all)")
+
+	rootCmd.AddCommand(queryCmd)
+}
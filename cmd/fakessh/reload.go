@@ -0,0 +1,256 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/alert"
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/sshserver"
+	"github.com/rs/zerolog/log"
+)
+
+// sinkSettings are the log settings applied by reopening the sinks
+var sinkSettings = []string{
+	"log.file", "log.format", "log.time_format", "log.timezone",
+	"log.chain_key", "log.chain_key_file", "log.encryption",
+	"log.fields", "log.exclude", "log.rename", "log.sinks",
+}
+
+// liveSensor holds the parts of a running sensor that change with a
+// reloaded configuration or a new profile of the collector
+type liveSensor struct {
+	server     *sshserver.Server
+	credLogger *logger.CredentialsLogger
+	processing *logger.Pipeline
+	threshold  *alert.ThresholdTrigger
+	alerts     *alert.Manager
+	// load reads the local configuration again
+	load func() (*config.Config, error)
+
+	mu sync.Mutex
+	// Configuration of the files, environment and flags, the profile of the
+	// collector applied on top of it and the resulting configuration
+	local     *config.Config
+	profile   []byte
+	current   *config.Config
+	enrichers []io.Closer
+}
+
+// reload applies the configuration read again, keeping the profile of the
+// collector on top of it
+func (s *liveSensor) reload() {
+	local, err := s.load()
+	if err != nil {
+		log.Error().Err(err).Msg("configuration reload failed, keeping the current settings")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := local
+	if s.profile != nil {
+		if next, _, err = withProfile(local, s.profile); err != nil {
+			log.Warn().Err(err).Msg("configuration profile does not apply to the reloaded configuration, ignored")
+			next = local
+		}
+	}
+	if err := s.apply(next); err != nil {
+		log.Error().Err(err).Msg("configuration reload failed, keeping the current settings")
+		return
+	}
+	s.local = local
+	log.Info().Msg("configuration reloaded")
+}
+
+// setProfile applies a profile received from the collector, nil restoring
+// the local settings
+func (s *liveSensor) setProfile(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next, profile := s.local, ""
+	if data != nil {
+		var err error
+		if next, profile, err = withProfile(s.local, data); err != nil {
+			log.Warn().Err(err).Msg("invalid configuration profile ignored")
+			return
+		}
+	}
+	if err := s.apply(next); err != nil {
+		log.Warn().Err(err).Msg("configuration profile could not be applied")
+		return
+	}
+	s.profile = data
+	if profile == "" {
+		log.Info().Msg("configuration profile removed, local settings restored")
+		return
+	}
+	log.Info().Str("profile", profile).Msg("configuration profile applied")
+}
+
+// apply changes the running sensor to a configuration, logging every
+// changed setting. Only the changed settings are applied, so that changes
+// made through the admin API to the others are kept. The parts that can
+// fail are prepared first, so that a failure changes nothing.
+func (s *liveSensor) apply(next *config.Config) error {
+	changes := config.Diff(s.current, next)
+	// The settings of included files are compared one by one
+	live := []string{"includes"}
+	applies := func(keys ...string) bool {
+		for _, c := range changes {
+			if matchesSetting(c.Key, keys) {
+				live = append(live, keys...)
+				return true
+			}
+		}
+		return false
+	}
+
+	var rules []*alert.RuleTrigger
+	var cooldowns map[string]time.Duration
+	rulesChanged := s.alerts != nil && applies("alerts.rules")
+	if rulesChanged {
+		var err error
+		if rules, cooldowns, err = newRuleTriggers(next.Alerts.Rules); err != nil {
+			return err
+		}
+	}
+	var processing *logger.Pipeline
+	var enrichers []io.Closer
+	if applies("enrichment", "privacy") {
+		var err error
+		if processing, enrichers, err = newProcessing(next, s.credLogger); err != nil {
+			return err
+		}
+	}
+	// The sinks come last, as they are already replaced if this succeeds
+	if applies(sinkSettings...) {
+		loggerConfig, err := loadLoggerConfig(next)
+		if err == nil {
+			err = s.credLogger.ReloadSinks(loggerConfig)
+		}
+		if err != nil {
+			closeAll(enrichers)
+			return err
+		}
+	}
+
+	if processing != nil {
+		s.processing.Replace(processing)
+		closeAll(s.enrichers)
+		s.enrichers = enrichers
+	}
+	if rulesChanged {
+		s.alerts.SetRules(rules, cooldowns)
+	}
+	if applies("ops_log.level") {
+		if err := logger.SetOperationalLevel(next.OpsLog.Level); err != nil {
+			log.Error().Err(err).Msg("operational log level not changed")
+		}
+	}
+	if applies("server_version", "banner") {
+		s.server.SetServerVersion(next.ServerVersion)
+		s.server.SetBanner(next.Banner)
+	}
+	governor := s.server.Governor()
+	if applies("access.delay_min", "access.delay_max") {
+		if err := governor.SetDelay(next.Access.DelayMin, next.Access.DelayMax); err != nil {
+			log.Error().Err(err).Msg("attempt delay not changed")
+		}
+	}
+	if applies("access.tarpit") {
+		governor.SetTarpit(next.Access.Tarpit)
+	}
+	if applies("access.denylist") {
+		if err := governor.SetDenylist(next.Access.Denylist); err != nil {
+			log.Error().Err(err).Msg("denylist not changed")
+		}
+	}
+	if applies("access.allowlist") {
+		if err := governor.SetAllowlist(next.Access.Allowlist); err != nil {
+			log.Error().Err(err).Msg("allowlist not changed")
+		}
+	}
+	if s.threshold != nil && applies("alerts.attempts_threshold", "alerts.threshold_window") {
+		s.threshold.SetThreshold(next.Alerts.AttemptsThreshold, next.Alerts.ThresholdWindow)
+	}
+
+	for _, c := range changes {
+		if matchesSetting(c.Key, live) {
+			log.Info().Str("setting", c.Key).Interface("previous", c.Previous).Interface("value", c.Value).Msg("setting changed")
+		} else {
+			log.Warn().Str("setting", c.Key).Interface("previous", c.Previous).Interface("value", c.Value).Msg("setting changed, effective after a restart")
+		}
+	}
+	s.current = next
+	return nil
+}
+
+// matchesSetting reports whether a setting is one of the keys or nested in
+// one of them
+func matchesSetting(setting string, keys []string) bool {
+	for _, key := range keys {
+		if setting == key || strings.HasPrefix(setting, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// settings returns the current configuration with the secrets redacted
+func (s *liveSensor) settings() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current.Settings()
+}
+
+// databases returns the current GeoIP and ASN databases
+func (s *liveSensor) databases() []interface{ Reload() error } {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var databases []interface{ Reload() error }
+	for _, e := range s.enrichers {
+		if db, ok := e.(interface{ Reload() error }); ok {
+			databases = append(databases, db)
+		}
+	}
+	return databases
+}
+
+// reloadDatabases reopens the GeoIP and ASN databases together
+func (s *liveSensor) reloadDatabases() error {
+	var errs []error
+	for _, db := range s.databases() {
+		errs = append(errs, db.Reload())
+	}
+	return errors.Join(errs...)
+}
+
+// close closes the current enrichers
+func (s *liveSensor) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	closeAll(s.enrichers)
+}
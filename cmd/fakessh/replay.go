@@ -0,0 +1,177 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	replayConfigFile  string
+	replaySkipMainLog bool
+	replayTiming      bool
+	replaySpeed       float64
+	replayMaxGap      time.Duration
+	replaySince       string
+	replayUntil       string
+	replayFilter      string
+)
+
+// replayCmd writes recorded events to the configured sinks again
+var replayCmd = &cobra.Command{
+	Use:   "replay [flags] FILE...",
+	Short: "Write recorded events to the configured sinks",
+	Long: `Read credential logs in JSON format and write their events to the log and
+sinks of the configuration, with their field mappings and tags, e.g. to
+backfill a new SIEM or to test sink settings with real data. Events are
+written as recorded, keeping their time and ID: enrichment, privacy
+processing, aggregation and alerts are not applied again, and the
+emergency file is not used.
+
+By default events are written as fast as possible; with --timing they keep
+the spacing they were recorded with, scaled by --speed and with gaps
+shortened to --max-gap. --skip-main-log writes to the additional sinks only.
+"-" reads standard input.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if replaySpeed <= 0 {
+			return fmt.Errorf("invalid speed: must be positive")
+		}
+		filter, err := parseFilter(replaySince, replayUntil)
+		if err != nil {
+			return err
+		}
+		match := filter.Match
+		if replayFilter != "" {
+			expr, err := report.ParseExpr(replayFilter, time.Now())
+			if err != nil {
+				return fmt.Errorf("invalid filter expression: %w", err)
+			}
+			match = func(event *logger.Event) bool {
+				return filter.Match(event) && expr.Match(event)
+			}
+		}
+
+		cfg, err := config.LoadConfig(replayConfigFile)
+		if err != nil {
+			return fmt.Errorf("configuration loading error: %w", err)
+		}
+		loggerConfig, err := loadLoggerConfig(cfg)
+		if err != nil {
+			return err
+		}
+		loggerConfig.SkipMainLog = replaySkipMainLog
+		loggerConfig.AggregateWindow = 0
+		loggerConfig.EmergencyFile = ""
+		if err := checkReplayTargets(args, loggerConfig); err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		credLogger, err := logger.NewCredentialsLogger(loggerConfig)
+		if err != nil {
+			return fmt.Errorf("logger creation error: %w", err)
+		}
+		defer credLogger.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		var pacer *logger.Pacer
+		if replayTiming {
+			pacer = logger.NewPacer(replaySpeed, replayMaxGap)
+		}
+		replayed := 0
+		err = logger.ReadLogs(args, loggerConfig.TimeFormat, func(event *logger.Event) error {
+			if !match(event) {
+				return nil
+			}
+			if pacer != nil {
+				if err := pacer.Wait(ctx, event.Time); err != nil {
+					return err
+				}
+			} else if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := credLogger.LogEvent(event); err != nil {
+				return err
+			}
+			replayed++
+			return nil
+		})
+		fmt.Fprintf(os.Stderr, "Replayed %d events\n", replayed)
+		if err == context.Canceled {
+			return nil
+		}
+		return err
+	},
+}
+
+// checkReplayTargets refuses to replay a log into a file it is read from
+func checkReplayTargets(paths []string, loggerConfig logger.Config) error {
+	targets := make(map[string]bool)
+	add := func(sinkType, path string) {
+		if sinkType != "stdout" && path != "stdout" {
+			if abs, err := filepath.Abs(path); err == nil {
+				targets[abs] = true
+			}
+		}
+	}
+	if !loggerConfig.SkipMainLog {
+		add("file", loggerConfig.LogFile)
+	}
+	for _, sink := range loggerConfig.Sinks {
+		add(sink.Type, sink.Path)
+	}
+
+	for _, path := range paths {
+		if path == "-" {
+			continue
+		}
+		if abs, err := filepath.Abs(path); err == nil && targets[abs] {
+			return fmt.Errorf("%s is written by the configuration, refusing to replay it into itself", path)
+		}
+	}
+	return nil
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replayConfigFile, "config", "", "path to configuration file with the log and sinks to write to")
+	replayCmd.Flags().BoolVar(&replaySkipMainLog, "skip-main-log", false, "write to the additional sinks only")
+	replayCmd.Flags().BoolVar(&replayTiming, "timing", false, "keep the original spacing of the events")
+	replayCmd.Flags().Float64Var(&replaySpeed, "speed", 1, "speed factor of --timing, e.g. 10 to replay ten times faster")
+	replayCmd.Flags().DurationVar(&replayMaxGap, "max-gap", 0, "longest pause between events with --timing, unlimited if 0")
+	replayCmd.Flags().StringVar(&replaySince, "since", "", "only replay events at or after this time")
+	replayCmd.Flags().StringVar(&replayUntil, "until", "", "only replay events before this time")
+	replayCmd.Flags().StringVar(&replayFilter, "filter", "", "only replay events matching this expression (see fakessh query --help)")
+
+	rootCmd.AddCommand(replayCmd)
+}
@@ -0,0 +1,107 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportConfigFile string
+	reportOut        string
+	reportTitle      string
+	reportSince      string
+	reportUntil      string
+	reportTop        int
+)
+
+// reportCmd writes an HTML report of credential logs
+var reportCmd = &cobra.Command{
+	Use:   "report --out FILE [flags] [FILE...]",
+	Short: "Write an HTML report of the attempts of credential logs",
+	Long: `Read credential logs in JSON format and write a self-contained HTML report
+for a period: attempts over time, countries and networks, top addresses and
+credentials, and the connections with the most attempts. The report needs no
+external resources, so it can be mailed or archived as is.
+
+Without files, the log of the configuration is read; "-" reads standard
+input. --since and --until take RFC3339 times, dates (2006-01-02, UTC) or
+durations before now such as 24h or 7d.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if reportOut == "" {
+			return fmt.Errorf("output file is required (--out)")
+		}
+		if reportTop < 1 {
+			return fmt.Errorf("invalid top list size: must be positive")
+		}
+		filter, err := parseFilter(reportSince, reportUntil)
+		if err != nil {
+			return err
+		}
+		paths, times, err := logPaths(reportConfigFile, args)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		r := report.NewHTMLReport(report.HTMLConfig{
+			Title: reportTitle,
+			Top:   reportTop,
+			Since: filter.Since,
+			Until: filter.Until,
+		})
+		err = logger.ReadLogs(paths, times, func(event *logger.Event) error {
+			if filter.Match(event) {
+				r.Add(event)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Create(reportOut)
+		if err != nil {
+			return err
+		}
+		if err := r.Write(f, time.Now()); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		return f.Close()
+	},
+}
+
+func init() {
+	reportCmd.Flags().StringVar(&reportConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	reportCmd.Flags().StringVar(&reportOut, "out", "", "path of the HTML report")
+	reportCmd.Flags().StringVar(&reportTitle, "title", "fakessh report", "title of the report")
+	reportCmd.Flags().StringVar(&reportSince, "since", "", "only include attempts at or after this time")
+	reportCmd.Flags().StringVar(&reportUntil, "until", "", "only include attempts before this time")
+	reportCmd.Flags().IntVar(&reportTop, "top", 10, "entries of each top list")
+
+	rootCmd.AddCommand(reportCmd)
+}
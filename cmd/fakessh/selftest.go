@@ -0,0 +1,231 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/metrics"
+	"github.com/abehterev/fakessh/internal/sshserver"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// Username of the test attempt, so that it can be filtered out downstream
+const selftestUsername = "fakessh-selftest"
+
+var (
+	selftestConfigFile string
+	selftestTimeout    time.Duration
+)
+
+// selftestCmd runs the configured pipeline end to end on an ephemeral server
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check the configuration with a real SSH login attempt",
+	Long: `Start an ephemeral server with the given configuration on a random
+local port, log in to it with an SSH client using a test credential and
+check that the attempt reaches every configured sink. The result of each
+component is printed, and the exit status is non-zero if any failed.
+
+The test attempt is written to the configured sinks like any other, with
+the username "` + selftestUsername + `" and a "selftest" field set to true.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(selftestConfigFile)
+		if err != nil {
+			return fmt.Errorf("configuration loading error: %w", err)
+		}
+
+		cmd.SilenceUsage = true
+
+		// Only warnings are shown next to the results
+		opsCloser, err := logger.SetupOperational(logger.OperationalConfig{
+			File:   "stderr",
+			Level:  "warn",
+			Format: "pretty",
+		})
+		if err != nil {
+			return fmt.Errorf("operational logger setup error: %w", err)
+		}
+		defer opsCloser.Close()
+
+		if !runSelftest(cfg, selftestTimeout) {
+			return errors.New("self-test failed")
+		}
+		return nil
+	},
+}
+
+// checkReport prints the result of each checked component
+type checkReport struct {
+	failed bool
+}
+
+// check prints the result of a component and returns whether it passed
+func (r *checkReport) check(component string, err error) bool {
+	if err != nil {
+		r.failed = true
+		fmt.Printf("FAIL  %-24s %v\n", component, err)
+		return false
+	}
+	r.pass(component, "")
+	return true
+}
+
+// pass prints a passed component with details
+func (r *checkReport) pass(component, detail string) {
+	fmt.Println(strings.TrimSpace(fmt.Sprintf("PASS  %-24s %s", component, detail)))
+}
+
+// selftestMarker flags the test attempt and reports that it went through the processors
+type selftestMarker struct {
+	seen chan string
+}
+
+// Process marks the test attempt
+func (m *selftestMarker) Process(event *logger.Event) {
+	if event.Type != "auth_attempt" || event.GetString("username") != selftestUsername {
+		return
+	}
+	event.Set("selftest", true)
+	select {
+	case m.seen <- event.ID:
+	default:
+	}
+}
+
+// runSelftest checks the pipeline of the configuration and reports whether all checks passed
+func runSelftest(cfg *config.Config, timeout time.Duration) bool {
+	report := &checkReport{}
+	if !report.check("config", cfg.Validate()) {
+		return false
+	}
+
+	// Aggregated attempts would only be logged at the end of their window
+	cfg.Log.AggregateWindow = 0
+	cfg.Port = 0
+
+	registry := metrics.NewRegistry()
+	credLogger, err := newCredentialsLogger(cfg, registry, nil)
+	if !report.check("logger", err) {
+		return false
+	}
+	defer credLogger.Close()
+
+	processing := &logger.Pipeline{}
+	enrichers, err := addEnrichers(processing, cfg)
+	if !report.check("enrichment", err) {
+		return false
+	}
+	defer closeAll(enrichers)
+	if !report.check("privacy", addPrivacyProcessors(processing, cfg)) {
+		return false
+	}
+	credLogger.AddProcessor(processing)
+	marker := &selftestMarker{seen: make(chan string, 1)}
+	credLogger.AddProcessor(marker)
+
+	server, err := sshserver.NewServer(cfg, credLogger)
+	if !report.check("host key", err) {
+		return false
+	}
+	server.SetMetrics(registry)
+
+	listening := make(chan struct{})
+	server.SetListeningHook(func() { close(listening) })
+	started := make(chan error, 1)
+	go func() { started <- server.Start() }()
+	select {
+	case <-listening:
+		report.check("listener", nil)
+	case err := <-started:
+		report.check("listener", err)
+		return false
+	case <-time.After(timeout):
+		report.check("listener", errors.New("listener was not bound in time"))
+		return false
+	}
+	defer server.Close()
+
+	start := time.Now()
+	port := server.Addr().(*net.TCPAddr).Port
+	report.check("ssh login", selftestLogin(net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), timeout))
+
+	select {
+	case id := <-marker.seen:
+		report.pass("event", id)
+	case <-time.After(timeout):
+		report.check("event", errors.New("attempt was not logged"))
+		return false
+	}
+
+	for _, h := range credLogger.Health() {
+		var err error
+		switch {
+		case !h.Healthy:
+			err = errors.New(h.LastError)
+		case h.LastSuccess.Before(start):
+			err = errors.New("event was not written")
+		}
+		report.check("sink "+h.Name, err)
+	}
+
+	return !report.failed
+}
+
+// selftestLogin attempts a password login, which the server must reject
+func selftestLogin(addr string, timeout time.Duration) error {
+	password := make([]byte, 8)
+	if _, err := rand.Read(password); err != nil {
+		return err
+	}
+
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            selftestUsername,
+		Auth:            []ssh.AuthMethod{ssh.Password(hex.EncodeToString(password))},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         timeout,
+	})
+	if err == nil {
+		client.Close()
+		return errors.New("authentication was accepted")
+	}
+	if !strings.Contains(err.Error(), "unable to authenticate") {
+		return err
+	}
+	return nil
+}
+
+func init() {
+	selftestCmd.Flags().StringVar(&selftestConfigFile, "config", "", "path to configuration file")
+	selftestCmd.Flags().DurationVar(&selftestTimeout, "timeout", 10*time.Second, "timeout of each step")
+
+	rootCmd.AddCommand(selftestCmd)
+}
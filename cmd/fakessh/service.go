@@ -0,0 +1,181 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/abehterev/fakessh/internal/winsvc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// serviceName is set by the service manager, running the server as
+	// the Windows service of this name
+	serviceName string
+	// serviceRunning is set once the server runs in the service handler
+	serviceRunning bool
+
+	// managedService is the name of the service of the service commands
+	managedService        string
+	serviceInstallDisplay string
+	serviceInstallConfig  string
+	serviceInstallManual  bool
+)
+
+// serviceCmd groups the subcommands managing the Windows service
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Install and control the Windows service",
+	Long: `Install fakessh as a native Windows service, started at boot and restarted
+when it fails, and start, stop or remove it. Operational messages of the
+service go to the Windows event log unless ops_log.file is a file. These
+commands require an elevated prompt.`,
+}
+
+// serviceInstallCmd creates the Windows service
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install [-- FLAGS...]",
+	Short: "Install the Windows service",
+	Long: `Install the Windows service running this executable with the configuration
+file given with --config, made absolute. The service starts in the
+directory of the configuration file, or of the executable without one, so
+that relative paths in the configuration, such as log files, are found
+there. Flags after -- are passed to the server.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		serviceArgs := []string{"--service", managedService}
+		if serviceInstallConfig != "" {
+			path, err := filepath.Abs(serviceInstallConfig)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(path); err != nil {
+				return fmt.Errorf("configuration file error: %w", err)
+			}
+			serviceArgs = append(serviceArgs, "--config", path)
+		}
+		serviceArgs = append(serviceArgs, args...)
+
+		err = winsvc.Install(winsvc.Config{
+			Name:        managedService,
+			DisplayName: serviceInstallDisplay,
+			Description: "Fake SSH server logging the credentials of authentication attempts",
+			Executable:  exe,
+			Args:        serviceArgs,
+			Manual:      serviceInstallManual,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Service %s installed\n", managedService)
+		return nil
+	},
+}
+
+// serviceUninstallCmd removes the Windows service
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the Windows service",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		if err := winsvc.Uninstall(managedService); err != nil {
+			return err
+		}
+		fmt.Printf("Service %s removed\n", managedService)
+		return nil
+	},
+}
+
+// serviceStartCmd starts the Windows service
+var serviceStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the Windows service",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return winsvc.Start(managedService)
+	},
+}
+
+// serviceStopCmd stops the Windows service
+var serviceStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the Windows service and wait until it has stopped",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return winsvc.Stop(managedService)
+	},
+}
+
+// runService runs the server in the handler of the Windows service, which
+// cancels the context of the command when the service is stopped
+func runService(cmd *cobra.Command, args []string) error {
+	// Services start in the system directory
+	var dir string
+	if cfgFile != "" {
+		path, err := filepath.Abs(cfgFile)
+		if err != nil {
+			return err
+		}
+		cfgFile, dir = path, filepath.Dir(path)
+	} else {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Dir(exe)
+	}
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+
+	return winsvc.Run(serviceName, func(ctx context.Context) error {
+		serviceRunning = true
+		cmd.SetContext(ctx)
+		return cmd.RunE(cmd, args)
+	})
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&serviceName, "service", "", "run as the Windows service NAME, set by service install")
+	rootCmd.Flags().MarkHidden("service")
+
+	serviceCmd.PersistentFlags().StringVar(&managedService, "name", winsvc.DefaultName, "name of the service")
+	serviceInstallCmd.Flags().StringVar(&serviceInstallDisplay, "display-name", "Fake SSH server", "name shown in the services console")
+	serviceInstallCmd.Flags().StringVar(&serviceInstallConfig, "config", "", "path to configuration file")
+	serviceInstallCmd.Flags().BoolVar(&serviceInstallManual, "manual", false, "start the service on demand instead of at boot")
+
+	serviceCmd.AddCommand(serviceInstallCmd)
+	serviceCmd.AddCommand(serviceUninstallCmd)
+	serviceCmd.AddCommand(serviceStartCmd)
+	serviceCmd.AddCommand(serviceStopCmd)
+	rootCmd.AddCommand(serviceCmd)
+}
@@ -0,0 +1,191 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	sessionsConfigFile  string
+	sessionsFormat      string
+	sessionsOut         string
+	sessionsID          string
+	sessionsFilter      string
+	sessionsGap         time.Duration
+	sessionsMinAttempts int
+	sessionsLimit       int
+	sessionsSince       string
+	sessionsUntil       string
+	sessionsColor       string
+	sessionsVerbose     bool
+)
+
+// sessionsCmd prints the events of credential logs grouped by connection
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions [flags] [FILE...]",
+	Short: "Print the events of credential logs grouped by session",
+	Long: `Read credential logs in JSON format and group their events into sessions,
+so that the interaction of an attacker reads top to bottom: its
+authentication attempts, commands and other events with the source,
+duration and client version.
+
+Events of imported logs are grouped by their session_id, the others by the
+sensor and the address and port of the connection; a pause of more than
+--gap starts a new session, as source ports are reused. Sessions are
+printed in the order they started, as text with an indented line per event
+or as JSON lines with the events in the format of export.
+
+--filter keeps sessions with at least one event matching an expression
+(see fakessh query --help), --id a single session. Without files, the log
+of the configuration is read; "-" reads standard input.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if sessionsFormat != "text" && sessionsFormat != "json" {
+			return fmt.Errorf("invalid format '%s': must be text or json", sessionsFormat)
+		}
+		if sessionsGap < 0 || sessionsMinAttempts < 0 || sessionsLimit < 0 {
+			return fmt.Errorf("invalid limits: gap, attempts and limit must not be negative")
+		}
+		pretty := report.Pretty{Verbose: sessionsVerbose}
+		switch sessionsColor {
+		case "auto":
+			pretty.Color = sessionsOut == "" && term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("NO_COLOR") == ""
+		case "always":
+			pretty.Color = true
+		case "never":
+		default:
+			return fmt.Errorf("invalid color mode '%s': must be auto, always or never", sessionsColor)
+		}
+		filter, err := parseFilter(sessionsSince, sessionsUntil)
+		if err != nil {
+			return err
+		}
+		var expr *report.Expr
+		if sessionsFilter != "" {
+			if expr, err = report.ParseExpr(sessionsFilter, time.Now()); err != nil {
+				return fmt.Errorf("invalid filter expression: %w", err)
+			}
+		}
+		paths, times, err := logPaths(sessionsConfigFile, args)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		sessions := report.NewSessions(report.SessionConfig{Gap: sessionsGap})
+		err = logger.ReadLogs(paths, times, func(event *logger.Event) error {
+			if filter.Match(event) {
+				sessions.Add(event)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		var selected []*report.Session
+		for _, session := range sessions.List() {
+			if sessionsID != "" && session.ID != sessionsID {
+				continue
+			}
+			if session.Attempts < sessionsMinAttempts {
+				continue
+			}
+			if expr != nil && !anyMatch(expr, session.Events) {
+				continue
+			}
+			selected = append(selected, session)
+		}
+		if sessionsID != "" && len(selected) == 0 {
+			return fmt.Errorf("session %s not found", sessionsID)
+		}
+		if sessionsLimit > 0 && len(selected) > sessionsLimit {
+			selected = selected[len(selected)-sessionsLimit:]
+		}
+
+		f := os.Stdout
+		if sessionsOut != "" && sessionsOut != "-" {
+			if f, err = os.Create(sessionsOut); err != nil {
+				return err
+			}
+			defer f.Close()
+		}
+		out := bufio.NewWriter(f)
+		encoder := json.NewEncoder(out)
+		for i, session := range selected {
+			if sessionsFormat == "json" {
+				if err := encoder.Encode(session); err != nil {
+					return err
+				}
+				continue
+			}
+			if i > 0 {
+				fmt.Fprintln(out)
+			}
+			fmt.Fprintln(out, pretty.FormatSession(session))
+			for _, event := range session.Events {
+				fmt.Fprintln(out, "  "+pretty.Format(event))
+			}
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		if f != os.Stdout {
+			return f.Close()
+		}
+		return nil
+	},
+}
+
+// anyMatch reports whether an expression matches one of the events
+func anyMatch(expr *report.Expr, events []*logger.Event) bool {
+	for _, event := range events {
+		if expr.Match(event) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	sessionsCmd.Flags().StringVar(&sessionsConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	sessionsCmd.Flags().StringVar(&sessionsFormat, "format", "text", "output format: text or json")
+	sessionsCmd.Flags().StringVar(&sessionsOut, "out", "", "output file (default standard output)")
+	sessionsCmd.Flags().StringVar(&sessionsID, "id", "", "print only the session with this ID")
+	sessionsCmd.Flags().StringVar(&sessionsFilter, "filter", "", "only print sessions with an event matching this expression")
+	sessionsCmd.Flags().DurationVar(&sessionsGap, "gap", 10*time.Minute, "pause after which a connection starts a new session (0 for never)")
+	sessionsCmd.Flags().IntVar(&sessionsMinAttempts, "min-attempts", 0, "only print sessions with at least this many attempts")
+	sessionsCmd.Flags().IntVar(&sessionsLimit, "limit", 0, "print only the latest sessions (0 for all)")
+	sessionsCmd.Flags().StringVar(&sessionsSince, "since", "", "only include events at or after this time")
+	sessionsCmd.Flags().StringVar(&sessionsUntil, "until", "", "only include events before this time")
+	sessionsCmd.Flags().StringVar(&sessionsColor, "color", "auto", "colored output: auto, always or never")
+	sessionsCmd.Flags().BoolVarP(&sessionsVerbose, "verbose", "v", false, "print all fields of attempts")
+
+	rootCmd.AddCommand(sessionsCmd)
+}
@@ -0,0 +1,138 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsConfigFile string
+	statsSince      string
+	statsUntil      string
+	statsTop        int
+	statsFormat     string
+)
+
+// statsCmd summarizes credential logs
+var statsCmd = &cobra.Command{
+	Use:   "stats [flags] [FILE...]",
+	Short: "Summarize the attempts of credential logs",
+	Long: `Read credential logs in JSON format and print a summary: total attempts,
+unique source addresses, top addresses, usernames, passwords and countries,
+and attempts per day. Without files, the log of the configuration is read;
+"-" reads standard input. Gzip-compressed logs are read as well, encrypted
+logs have to be decrypted first (fakessh decrypt LOG | fakessh stats -).
+
+--since and --until take RFC3339 times, dates (2006-01-02, UTC) or
+durations before now such as 24h or 7d.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if statsFormat != "table" && statsFormat != "json" {
+			return fmt.Errorf("invalid format '%s': must be table or json", statsFormat)
+		}
+		if statsTop < 1 {
+			return fmt.Errorf("invalid top list size: must be positive")
+		}
+		filter, err := parseFilter(statsSince, statsUntil)
+		if err != nil {
+			return err
+		}
+		paths, times, err := logPaths(statsConfigFile, args)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		summarizer := report.NewSummarizer(statsTop)
+		err = logger.ReadLogs(paths, times, func(event *logger.Event) error {
+			if filter.Match(event) {
+				summarizer.Add(event)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		summary := summarizer.Summary()
+		if statsFormat == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(summary)
+		}
+		return summary.WriteTable(os.Stdout)
+	},
+}
+
+// parseFilter creates the filter of the --since and --until flags
+func parseFilter(since, until string) (report.Filter, error) {
+	var filter report.Filter
+	now := time.Now()
+	var err error
+	if since != "" {
+		if filter.Since, err = report.ParseTime(since, now); err != nil {
+			return filter, fmt.Errorf("--since: %w", err)
+		}
+	}
+	if until != "" {
+		if filter.Until, err = report.ParseTime(until, now); err != nil {
+			return filter, fmt.Errorf("--until: %w", err)
+		}
+	}
+	return filter, nil
+}
+
+// logPaths returns the logs to read and their timestamp format: the given
+// files, or the log file of the configuration if there are none
+func logPaths(configFile string, args []string) ([]string, logger.TimeFormat, error) {
+	cfg, err := config.LoadConfig(configFile)
+	if err != nil {
+		return nil, logger.TimeFormat{}, fmt.Errorf("configuration loading error: %w", err)
+	}
+	times, err := logger.NewTimeFormat(cfg.Log.TimeFormat, cfg.Log.Timezone)
+	if err != nil {
+		return nil, logger.TimeFormat{}, err
+	}
+	if len(args) > 0 {
+		return args, times, nil
+	}
+	if cfg.Log.File == "" || cfg.Log.File == "stdout" {
+		return nil, times, fmt.Errorf("no log file given and none configured")
+	}
+	return []string{cfg.Log.File}, times, nil
+}
+
+func init() {
+	statsCmd.Flags().StringVar(&statsConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	statsCmd.Flags().StringVar(&statsSince, "since", "", "only count attempts at or after this time")
+	statsCmd.Flags().StringVar(&statsUntil, "until", "", "only count attempts before this time")
+	statsCmd.Flags().IntVar(&statsTop, "top", 10, "entries of each top list")
+	statsCmd.Flags().StringVar(&statsFormat, "format", "table", "output format: table or json")
+
+	rootCmd.AddCommand(statsCmd)
+}
@@ -0,0 +1,223 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/intel"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	stixConfigFile        string
+	stixOut               string
+	stixIdentity          string
+	stixMinAttempts       int
+	stixCredentials       int
+	stixSince             string
+	stixUntil             string
+	stixTAXII             string
+	stixTAXIIUser         string
+	stixTAXIIPasswordFile string
+	stixRefresh           time.Duration
+)
+
+// stixCmd packages the indicators of credential logs as a STIX 2.1 bundle
+var stixCmd = &cobra.Command{
+	Use:   "stix [flags] [FILE...]",
+	Short: "Export attacker addresses, credentials and IOCs as a STIX 2.1 bundle",
+	Long: `Read credential logs in JSON format and package their indicators into a
+STIX 2.1 bundle for threat intelligence platforms:
+
+  - ipv4-addr and ipv6-addr observables of sources with at least
+    --min-attempts attempts
+  - user-account observables of the --credentials most tried credentials
+  - url, domain-name, ipv4-addr and file hash observables of indicators of
+    compromise extracted from commands (ioc events)
+
+Every observable comes with an indicator with a STIX pattern matching it,
+observed data and a sighting by the --identity of the honeypot with the
+first and last seen times and the number of attempts. Observables and
+indicators keep their IDs across exports. Anonymized, private and local
+addresses and masked passwords are left out.
+
+With --taxii, the bundle is served as the collection of a read-only TAXII
+2.1 server at this address instead of written (discovery at /taxii2/, API
+root at /api/) and rebuilt from the logs every --refresh. Without files,
+the log of the configuration is read; "-" reads standard input.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if stixMinAttempts < 1 || stixCredentials < 0 {
+			return fmt.Errorf("invalid limits: minimum attempts must be positive, credentials not negative")
+		}
+		filter, err := parseFilter(stixSince, stixUntil)
+		if err != nil {
+			return err
+		}
+		paths, times, err := logPaths(stixConfigFile, args)
+		if err != nil {
+			return err
+		}
+		var taxii intel.TAXIIConfig
+		if stixTAXII != "" {
+			for _, path := range paths {
+				if path == "-" {
+					return fmt.Errorf("--taxii cannot read standard input")
+				}
+			}
+			if stixRefresh <= 0 {
+				return fmt.Errorf("invalid refresh interval: must be positive")
+			}
+			taxii = intel.TAXIIConfig{Title: stixIdentity + " SSH honeypot", Username: stixTAXIIUser}
+			if stixTAXIIUser != "" {
+				password, err := config.ReadSecret("", stixTAXIIPasswordFile)
+				if err != nil {
+					return err
+				}
+				if len(password) == 0 {
+					return fmt.Errorf("a password is required for the TAXII user (--taxii-password-file)")
+				}
+				taxii.Password = string(password)
+			}
+		}
+
+		cmd.SilenceUsage = true
+
+		build := func() (*intel.STIXBundle, error) {
+			return stixBundle(paths, times, filter)
+		}
+		if stixTAXII != "" {
+			return serveTAXII(stixTAXII, taxii, build)
+		}
+
+		bundle, err := build()
+		if err != nil {
+			return err
+		}
+		out := os.Stdout
+		if stixOut != "" && stixOut != "-" {
+			if out, err = os.Create(stixOut); err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(bundle); err != nil {
+			return fmt.Errorf("failed to write STIX bundle: %w", err)
+		}
+		if out != os.Stdout {
+			return out.Close()
+		}
+		return nil
+	},
+}
+
+// stixBundle reads the logs and packages their indicators
+func stixBundle(paths []string, times logger.TimeFormat, filter report.Filter) (*intel.STIXBundle, error) {
+	collector := intel.NewCollector()
+	err := logger.ReadLogs(paths, times, func(event *logger.Event) error {
+		if filter.Match(event) {
+			collector.Add(event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return intel.NewSTIXBundle(collector, intel.STIXConfig{
+		Identity:    stixIdentity,
+		MinAttempts: stixMinAttempts,
+		Credentials: stixCredentials,
+	}, time.Now()), nil
+}
+
+// serveTAXII serves the bundles built every refresh interval until
+// interrupted
+func serveTAXII(addr string, config intel.TAXIIConfig, build func() (*intel.STIXBundle, error)) error {
+	bundle, err := build()
+	if err != nil {
+		return err
+	}
+	taxii := intel.NewTAXII(config)
+	taxii.Update(bundle)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: taxii, ReadHeaderTimeout: 10 * time.Second}
+	fmt.Fprintf(os.Stderr, "Serving %d STIX objects at http://%s/taxii2/\n", len(bundle.Objects), ln.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		ticker := time.NewTicker(stixRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				srv.Shutdown(shutdown)
+				cancel()
+				return
+			case <-ticker.C:
+				bundle, err := build()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to rebuild STIX bundle: %v\n", err)
+					continue
+				}
+				taxii.Update(bundle)
+			}
+		}
+	}()
+
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func init() {
+	stixCmd.Flags().StringVar(&stixConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	stixCmd.Flags().StringVar(&stixOut, "out", "", "output file (default standard output)")
+	stixCmd.Flags().StringVar(&stixIdentity, "identity", "fakessh", "name of the identity sighting the observables")
+	stixCmd.Flags().IntVar(&stixMinAttempts, "min-attempts", 1, "attempts of a source before its address is included")
+	stixCmd.Flags().IntVar(&stixCredentials, "credentials", 100, "most tried credentials included, all if 0")
+	stixCmd.Flags().StringVar(&stixSince, "since", "", "only include events at or after this time")
+	stixCmd.Flags().StringVar(&stixUntil, "until", "", "only include events before this time")
+	stixCmd.Flags().StringVar(&stixTAXII, "taxii", "", "address of a TAXII server serving the bundle instead of writing it, e.g. :9500")
+	stixCmd.Flags().StringVar(&stixTAXIIUser, "taxii-user", "", "username of HTTP basic authentication of the TAXII server")
+	stixCmd.Flags().StringVar(&stixTAXIIPasswordFile, "taxii-password-file", "", "file containing the password of the TAXII user")
+	stixCmd.Flags().DurationVar(&stixRefresh, "refresh", 5*time.Minute, "interval of rebuilding the served bundle")
+
+	rootCmd.AddCommand(stixCmd)
+}
@@ -0,0 +1,146 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	tailConfigFile string
+	tailFollow     bool
+	tailLines      int
+	tailFilter     string
+	tailColor      string
+	tailVerbose    bool
+)
+
+// tailCmd prints the last events of a credentials log as readable lines
+var tailCmd = &cobra.Command{
+	Use:   "tail [flags] [FILE]",
+	Short: "Print the last events of a credentials log as readable lines",
+	Long: `Print the last events of a credentials log in JSON format as readable,
+colored lines, optionally only those matching a filter expression (see
+fakessh query --help). With --follow, events are printed as they are
+appended, across rotation and truncation of the log. Without a file, the
+log of the configuration is read; "-" reads standard input.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if tailLines < 0 {
+			return fmt.Errorf("invalid number of lines: must not be negative")
+		}
+		pretty := report.Pretty{Verbose: tailVerbose}
+		switch tailColor {
+		case "auto":
+			pretty.Color = term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("NO_COLOR") == ""
+		case "always":
+			pretty.Color = true
+		case "never":
+		default:
+			return fmt.Errorf("invalid color mode '%s': must be auto, always or never", tailColor)
+		}
+		match := func(*logger.Event) bool { return true }
+		if tailFilter != "" {
+			expr, err := report.ParseExpr(tailFilter, time.Now())
+			if err != nil {
+				return fmt.Errorf("invalid filter expression: %w", err)
+			}
+			match = expr.Match
+		}
+		paths, times, err := logPaths(tailConfigFile, args)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		out := bufio.NewWriter(os.Stdout)
+		defer out.Flush()
+		printEvent := func(event *logger.Event) {
+			fmt.Fprintln(out, pretty.Format(event))
+		}
+
+		// The last events are kept until the end of the log is reached
+		var last []*logger.Event
+		caughtUp := false
+		collect := func(event *logger.Event) error {
+			if !match(event) {
+				return nil
+			}
+			if caughtUp {
+				printEvent(event)
+				return out.Flush()
+			}
+			last = append(last, event)
+			if len(last) > tailLines {
+				last = last[1:]
+			}
+			return nil
+		}
+		flushLast := func() {
+			for _, event := range last {
+				printEvent(event)
+			}
+			last = nil
+			caughtUp = true
+			out.Flush()
+		}
+
+		if !tailFollow || paths[0] == "-" {
+			// Standard input is followed by reading it to its end
+			caughtUp = tailFollow
+			if err := logger.ReadLogs(paths, times, collect); err != nil {
+				return err
+			}
+			flushLast()
+			return nil
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return logger.Follow(ctx, logger.FollowConfig{
+			Path:      paths[0],
+			Times:     times,
+			FromStart: true,
+			CaughtUp:  flushLast,
+		}, collect)
+	},
+}
+
+func init() {
+	tailCmd.Flags().StringVar(&tailConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	tailCmd.Flags().BoolVarP(&tailFollow, "follow", "f", false, "print events as they are appended")
+	tailCmd.Flags().IntVarP(&tailLines, "lines", "n", 10, "number of last events printed")
+	tailCmd.Flags().StringVar(&tailFilter, "filter", "", "only print events matching this expression")
+	tailCmd.Flags().StringVar(&tailColor, "color", "auto", "colored output: auto, always or never")
+	tailCmd.Flags().BoolVarP(&tailVerbose, "verbose", "v", false, "print all fields of attempts")
+
+	rootCmd.AddCommand(tailCmd)
+}
@@ -0,0 +1,126 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	topConfigFile string
+	topWindow     time.Duration
+	topEntries    int
+	topInterval   time.Duration
+)
+
+// topCmd shows a live view of incoming attempts
+var topCmd = &cobra.Command{
+	Use:   "top [flags] [FILE]",
+	Short: "Show a live view of incoming attempts",
+	Long: `Follow a credentials log in JSON format and show a live view in the
+terminal: attempt rates of the last minute and hour, top sources and
+credentials within --window, and the latest attempts. Without a file, the
+log of the configuration is followed. Press Ctrl-C to quit.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if topEntries < 1 {
+			return fmt.Errorf("invalid top list size: must be positive")
+		}
+		if topWindow < time.Minute || topInterval <= 0 {
+			return fmt.Errorf("invalid window or interval: window must be at least 1m, interval positive")
+		}
+		paths, times, err := logPaths(topConfigFile, args)
+		if err != nil {
+			return err
+		}
+		if paths[0] == "-" {
+			return fmt.Errorf("top follows a log file, not standard input")
+		}
+		if !term.IsTerminal(int(os.Stdout.Fd())) {
+			return fmt.Errorf("top requires a terminal, use stats for summaries")
+		}
+
+		cmd.SilenceUsage = true
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		live := report.NewLive(report.LiveConfig{Window: topWindow, Top: topEntries})
+		followed := make(chan error, 1)
+		go func() {
+			followed <- logger.Follow(ctx, logger.FollowConfig{Path: paths[0], Times: times}, func(event *logger.Event) error {
+				live.Add(event, time.Now())
+				return nil
+			})
+		}()
+
+		// Draw on the alternate screen and restore the terminal on exit
+		fmt.Print("\x1b[?1049h\x1b[?25l")
+		defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+		ticker := time.NewTicker(topInterval)
+		defer ticker.Stop()
+		title := "fakessh top - " + paths[0]
+		for {
+			drawTop(live, title)
+			select {
+			case <-ctx.Done():
+				return <-followed
+			case err := <-followed:
+				return err
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+// drawTop redraws the live view to fit the terminal
+func drawTop(live *report.Live, title string) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+
+	// The last line is left empty, so that the screen does not scroll
+	var frame bytes.Buffer
+	live.Render(&frame, title, time.Now(), width, height-1)
+	out := "\x1b[H" + strings.ReplaceAll(frame.String(), "\n", "\x1b[K\n") + "\x1b[J"
+	os.Stdout.WriteString(out)
+}
+
+func init() {
+	topCmd.Flags().StringVar(&topConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	topCmd.Flags().DurationVar(&topWindow, "window", 5*time.Minute, "period of the top lists")
+	topCmd.Flags().IntVar(&topEntries, "top", 10, "entries of each top list")
+	topCmd.Flags().DurationVar(&topInterval, "interval", time.Second, "refresh interval")
+
+	rootCmd.AddCommand(topCmd)
+}
@@ -0,0 +1,95 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyConfigFile   string
+	verifyChainKey     string
+	verifyChainKeyFile string
+)
+
+// verifyCmd checks the HMAC chain of credential log files
+var verifyCmd = &cobra.Command{
+	Use:   "verify [flags] FILE...",
+	Short: "Verify the tamper-evident HMAC chain of credential logs",
+	Long: `Verify that credential logs written with an HMAC chain key were not
+modified, reordered or truncated in the middle.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := config.ReadSecret(verifyChainKey, verifyChainKeyFile)
+		if err != nil {
+			return err
+		}
+
+		// Fall back to the key from the configuration
+		if len(key) == 0 && verifyConfigFile != "" {
+			cfg, err := config.LoadConfig(verifyConfigFile)
+			if err != nil {
+				return fmt.Errorf("configuration loading error: %w", err)
+			}
+			key, err = config.ReadSecret(cfg.Log.ChainKey, cfg.Log.ChainKeyFile)
+			if err != nil {
+				return err
+			}
+		}
+		if len(key) == 0 {
+			return fmt.Errorf("chain key is required (--chain-key, --chain-key-file or --config)")
+		}
+
+		failed := false
+		for _, path := range args {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			records, err := logger.VerifyChain(f, key)
+			f.Close()
+
+			if err != nil {
+				failed = true
+				fmt.Printf("%s: FAILED after %d records: %v\n", path, records, err)
+				continue
+			}
+			fmt.Printf("%s: OK, %d records\n", path, records)
+		}
+
+		if failed {
+			return fmt.Errorf("chain verification failed")
+		}
+		return nil
+	},
+}
+
+func init() {
+	verifyCmd.Flags().StringVar(&verifyConfigFile, "config", "", "path to configuration file to read the chain key from")
+	verifyCmd.Flags().StringVar(&verifyChainKey, "chain-key", "", "HMAC chain key")
+	verifyCmd.Flags().StringVar(&verifyChainKeyFile, "chain-key-file", "", "file containing the HMAC chain key")
+
+	rootCmd.AddCommand(verifyCmd)
+}
@@ -0,0 +1,127 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+)
+
+// Build metadata, set by release builds with
+// -ldflags "-X main.version=v1.4.0 -X main.commit=... -X main.date=..."
+var (
+	version string
+	commit  string
+	date    string
+)
+
+var versionJSON bool
+
+// buildMetadata describes the build of the binary
+type buildMetadata struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// versionCmd prints the build metadata
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version and build metadata",
+	Long: `Print the version, git commit and build date of the binary, and the Go
+version it was built with, for fleet inventories and bug reports.
+
+Release builds set them with -ldflags; other builds report the module version
+or the commit recorded by the Go toolchain.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := buildInfo()
+		if versionJSON {
+			return json.NewEncoder(os.Stdout).Encode(info)
+		}
+		fmt.Printf("fakessh %s\n", info.Version)
+		if info.Commit != "" {
+			fmt.Printf("commit:     %s\n", info.Commit)
+		}
+		if info.Date != "" {
+			fmt.Printf("built:      %s\n", info.Date)
+		}
+		fmt.Printf("go version: %s\n", info.GoVersion)
+		fmt.Printf("platform:   %s\n", info.Platform)
+		return nil
+	},
+}
+
+// buildInfo returns the build metadata set with -ldflags, completed with
+// the module version and VCS settings recorded by the Go toolchain
+func buildInfo() buildMetadata {
+	info := buildMetadata{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		if info.Version == "" {
+			info.Version = "unknown"
+		}
+		return info
+	}
+	for _, s := range build.Settings {
+		switch {
+		case s.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = s.Value
+		case s.Key == "vcs.time" && info.Date == "":
+			info.Date = s.Value
+		}
+	}
+	if info.Version == "" {
+		switch {
+		case build.Main.Version != "" && build.Main.Version != "(devel)":
+			info.Version = build.Main.Version
+		case len(info.Commit) >= 12:
+			info.Version = "devel-" + info.Commit[:12]
+		default:
+			info.Version = "devel"
+		}
+	}
+	return info
+}
+
+// buildVersion returns the version of the binary, or its VCS revision for
+// development builds
+func buildVersion() string {
+	return buildInfo().Version
+}
+
+func init() {
+	versionCmd.Flags().BoolVar(&versionJSON, "json", false, "print the metadata as JSON")
+
+	rootCmd.AddCommand(versionCmd)
+}
@@ -0,0 +1,143 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	wordlistConfigFile string
+	wordlistUsernames  string
+	wordlistPasswords  string
+	wordlistPairs      string
+	wordlistMinCount   int
+	wordlistCounts     bool
+	wordlistSince      string
+	wordlistUntil      string
+)
+
+// wordlistCmd extracts wordlists from credential logs
+var wordlistCmd = &cobra.Command{
+	Use:   "wordlist [flags] [FILE...]",
+	Short: "Extract username and password wordlists from credential logs",
+	Long: `Read credential logs in JSON format and write the unique usernames,
+passwords and username:password pairs of the attempts into plain wordlist
+files, one value per line and the most frequent first, e.g. for password
+auditing tools. --min-count leaves out values used less often, --counts
+precedes every value with its count and a tab.
+
+Passwords masked by the sensor (privacy.password_mode) are left out, as are
+empty values, values spanning several lines and pairs of usernames
+containing a colon. At least one of
+--usernames, --passwords and --pairs is required; "-" writes to standard
+output. Without files, the log of the configuration is read; "-" reads
+standard input.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if wordlistUsernames == "" && wordlistPasswords == "" && wordlistPairs == "" {
+			return fmt.Errorf("no wordlist selected: use --usernames, --passwords or --pairs")
+		}
+		if wordlistMinCount < 1 {
+			return fmt.Errorf("invalid minimum count: must be positive")
+		}
+		filter, err := parseFilter(wordlistSince, wordlistUntil)
+		if err != nil {
+			return err
+		}
+		paths, times, err := logPaths(wordlistConfigFile, args)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
+
+		lists := report.NewWordlists()
+		err = logger.ReadLogs(paths, times, func(event *logger.Event) error {
+			if filter.Match(event) {
+				lists.Add(event)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if masked := lists.Masked(); masked > 0 {
+			fmt.Fprintf(os.Stderr, "Left out the masked passwords of %d attempts\n", masked)
+		}
+
+		for _, output := range []struct {
+			path   string
+			counts func() []report.Count
+		}{
+			{wordlistUsernames, lists.Usernames},
+			{wordlistPasswords, lists.Passwords},
+			{wordlistPairs, lists.Pairs},
+		} {
+			if output.path == "" {
+				continue
+			}
+			if err := writeWordlist(output.path, output.counts()); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// writeWordlist writes a wordlist to a file or to standard output
+func writeWordlist(path string, counts []report.Count) error {
+	out := os.Stdout
+	if path != "-" {
+		var err error
+		if out, err = os.Create(path); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	if err := report.WriteWordlist(w, counts, wordlistMinCount, wordlistCounts); err != nil {
+		return fmt.Errorf("failed to write wordlist: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write wordlist: %w", err)
+	}
+	if out != os.Stdout {
+		return out.Close()
+	}
+	return nil
+}
+
+func init() {
+	wordlistCmd.Flags().StringVar(&wordlistConfigFile, "config", "", "path to configuration file with the log file and its time format")
+	wordlistCmd.Flags().StringVar(&wordlistUsernames, "usernames", "", "file the usernames are written to")
+	wordlistCmd.Flags().StringVar(&wordlistPasswords, "passwords", "", "file the passwords are written to")
+	wordlistCmd.Flags().StringVar(&wordlistPairs, "pairs", "", "file the username:password pairs are written to")
+	wordlistCmd.Flags().IntVar(&wordlistMinCount, "min-count", 1, "leave out values used fewer times")
+	wordlistCmd.Flags().BoolVar(&wordlistCounts, "counts", false, "precede values with their count and a tab")
+	wordlistCmd.Flags().StringVar(&wordlistSince, "since", "", "only include attempts at or after this time")
+	wordlistCmd.Flags().StringVar(&wordlistUntil, "until", "", "only include attempts before this time")
+
+	rootCmd.AddCommand(wordlistCmd)
+}
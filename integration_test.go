@@ -58,6 +58,8 @@ func TestFakeSSHServerIntegration(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to create server: %v", err)
 	}
+	listening := make(chan struct{})
+	server.SetListeningHook(func() { close(listening) })
 
 	// Start the server in a goroutine
 	go func() {
@@ -67,7 +69,14 @@ func TestFakeSSHServerIntegration(t *testing.T) {
 	}()
 
 	// Wait for the server to start
-	time.Sleep(1 * time.Second)
+	select {
+	case <-listening:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not start listening")
+	}
+	if err := server.CheckListener(); err != nil {
+		t.Fatalf("Server is not ready: %v", err)
+	}
 
 	// Create an SSH client config
 	clientConfig := &ssh.ClientConfig{
@@ -0,0 +1,192 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package admin serves the administrative HTTP endpoints: health checks,
+// runtime statistics and diagnostics
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Check reports an error if a component is not ready
+type Check func() error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Server is the admin HTTP server
+type Server struct {
+	listen string
+	mux    *http.ServeMux
+	srv    *http.Server
+
+	mu     sync.Mutex
+	checks []namedCheck
+}
+
+// New creates an admin server listening on the given address
+func New(listen string) *Server {
+	s := &Server{
+		listen: listen,
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+	s.srv = &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Handle registers an additional endpoint
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// EnablePprof serves the runtime profiles of net/http/pprof under /debug/pprof/
+func (s *Server) EnablePprof() {
+	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// EnableExpvar publishes the value returned by f as the expvar variable name
+// and serves all expvar variables under /debug/vars
+func (s *Server) EnableExpvar(name string, f func() interface{}) {
+	if expvar.Get(name) == nil {
+		expvar.Publish(name, expvar.Func(f))
+	}
+	s.mux.Handle("GET /debug/vars", expvar.Handler())
+}
+
+// AddReadinessCheck registers a check run by /readyz
+func (s *Server) AddReadinessCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, namedCheck{name: name, check: check})
+}
+
+// Start binds the listener and serves requests in the background
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return fmt.Errorf("admin server start error: %w", err)
+	}
+	log.Info().Str("listen", ln.Addr().String()).Msg("admin server started")
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("admin server error")
+		}
+	}()
+	return nil
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
+
+// handleHealthz reports that the process is alive
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readiness is the response of /readyz
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// handleReadyz runs all readiness checks
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	checks := append([]namedCheck(nil), s.checks...)
+	s.mu.Unlock()
+
+	resp := readiness{Status: "ready", Checks: make(map[string]string, len(checks))}
+	status := http.StatusOK
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			resp.Checks[c.name] = err.Error()
+			resp.Status = "not ready"
+			status = http.StatusServiceUnavailable
+		} else {
+			resp.Checks[c.name] = "ok"
+		}
+	}
+	writeJSON(w, status, resp)
+}
+
+// HasToken reports whether a request carries one of the tokens as bearer token
+func HasToken(r *http.Request, tokens []string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireToken passes the requests carrying one of the tokens to h and
+// rejects the others
+func RequireToken(tokens []string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !HasToken(r, tokens) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fakessh"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid API token"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debug().Err(err).Msg("admin response write error")
+	}
+}
@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	s := New("127.0.0.1:0")
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	s := New("127.0.0.1:0")
+	ready := false
+	s.AddReadinessCheck("host_key", func() error { return nil })
+	s.AddReadinessCheck("listener", func() error {
+		if !ready {
+			return errors.New("not listening")
+		}
+		return nil
+	})
+
+	get := func() (int, readiness) {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var resp readiness
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+		return rec.Code, resp
+	}
+
+	code, resp := get()
+	if code != http.StatusServiceUnavailable || resp.Checks["listener"] != "not listening" || resp.Checks["host_key"] != "ok" {
+		t.Errorf("Expected not ready, got %d %+v", code, resp)
+	}
+
+	ready = true
+	if code, resp := get(); code != http.StatusOK || resp.Status != "ready" {
+		t.Errorf("Expected ready, got %d %+v", code, resp)
+	}
+}
+
+func TestStartClose(t *testing.T) {
+	s := New("127.0.0.1:0")
+	if err := s.Start(); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Failed to close: %v", err)
+	}
+
+	if err := New("256.0.0.1:0").Start(); err == nil {
+		t.Errorf("Expected error for invalid address")
+	}
+}
+
+func TestPprof(t *testing.T) {
+	s := New("127.0.0.1:0")
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	if code := get("/debug/pprof/"); code != http.StatusNotFound {
+		t.Errorf("Expected profiles to be disabled by default, got %d", code)
+	}
+	s.EnablePprof()
+	if code := get("/debug/pprof/heap"); code != http.StatusOK {
+		t.Errorf("Expected heap profile, got %d", code)
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	s := New("127.0.0.1:0")
+	s.EnableExpvar("admin_test", func() interface{} { return map[string]int{"attempts": 3} })
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(rec.Body).Decode(&vars); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if string(vars["admin_test"]) != `{"attempts":3}` {
+		t.Errorf("Unexpected variable: %s", vars["admin_test"])
+	}
+	if _, ok := vars["memstats"]; !ok {
+		t.Error("Expected the standard memstats variable")
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	h := RequireToken([]string{"first", "second"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		header string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer ", http.StatusUnauthorized},
+		{"Bearer third", http.StatusUnauthorized},
+		{"Basic second", http.StatusUnauthorized},
+		{"Bearer first", http.StatusNoContent},
+		{"Bearer second", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("Authorization %q: expected %d, got %d", tt.header, tt.status, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package alert notifies operators of notable events: triggers select the
+// events, and notifiers deliver the resulting alerts in the background
+package alert
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Severity of an alert
+type Severity string
+
+// Alert severities
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// severityRank orders the severities
+var severityRank = map[Severity]int{
+	SeverityInfo:     1,
+	SeverityWarning:  2,
+	SeverityCritical: 3,
+}
+
+// AtLeast reports whether the severity is min or higher
+func (s Severity) AtLeast(min Severity) bool {
+	return severityRank[s] >= severityRank[min]
+}
+
+// Alert is a notification about an event
+type Alert struct {
+	// Name of the trigger that raised the alert
+	Rule string
+	// Severity of the alert
+	Severity Severity
+	// Time of the event
+	Time time.Time
+	// One-line summary
+	Message string
+	// Source address of the event, without the port
+	Source string
+	// Fields of the event, as logged
+	Fields map[string]interface{}
+	// Notifiers receiving the alert, all if empty
+	Notifiers []string
+}
+
+// For reports whether a notifier receives the alert
+func (a Alert) For(notifier string) bool {
+	if len(a.Notifiers) == 0 {
+		return true
+	}
+	for _, n := range a.Notifiers {
+		if n == notifier {
+			return true
+		}
+	}
+	return false
+}
+
+// newAlert creates an alert about an event
+func newAlert(rule string, severity Severity, message string, event *logger.Event) Alert {
+	fields := make(map[string]interface{}, len(event.Fields)+1)
+	for _, f := range event.Fields {
+		fields[f.Key] = f.Value
+	}
+	fields["event_id"] = event.ID
+
+	return Alert{
+		Rule:     rule,
+		Severity: severity,
+		Time:     event.Time,
+		Message:  message,
+		Source:   sourceIP(event),
+		Fields:   fields,
+	}
+}
+
+// sourceIP returns the source address of an event without the port
+func sourceIP(event *logger.Event) string {
+	return hostOf(event.GetString("remote_addr"))
+}
+
+// originalSourceIP returns the source address of an event without the port
+// as it was before anonymization, for matching networks
+func originalSourceIP(event *logger.Event) string {
+	if event.OriginalAddr != "" {
+		return hostOf(event.OriginalAddr)
+	}
+	return sourceIP(event)
+}
+
+// hostOf removes the port of an address
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// truncate shortens a string to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
+
+// Notifier delivers alerts to a service
+type Notifier interface {
+	// Name identifies the notifier in logs
+	Name() string
+	// Notify delivers an alert
+	Notify(ctx context.Context, a Alert) error
+}
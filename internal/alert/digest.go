@@ -0,0 +1,218 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package alert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/rs/zerolog/log"
+)
+
+// Distinct values counted per period, further values only count in the totals
+const maxDigestKeys = 100000
+
+// sender delivers a message with a subject
+type sender interface {
+	Send(ctx context.Context, subject, body string) error
+}
+
+// DigestConfig contains settings of periodic digests
+type DigestConfig struct {
+	// Period summarized by each digest
+	Interval time.Duration
+	// Entries of each top list
+	Top int
+	// Timeout of sending a digest
+	Timeout time.Duration
+}
+
+// Digest periodically sends a summary of the attempts of the past period:
+// top sources, usernames, passwords and credential pairs
+type Digest struct {
+	config DigestConfig
+	sender sender
+
+	mu          sync.Mutex
+	start       time.Time
+	attempts    int
+	sources     map[string]int
+	usernames   map[string]int
+	passwords   map[string]int
+	credentials map[string]int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDigest creates a digest sent through an email notifier and starts its period
+func NewDigest(config DigestConfig, email *Email) *Digest {
+	d := newDigest(config, email)
+	d.wg.Add(1)
+	go d.loop()
+	return d
+}
+
+func newDigest(config DigestConfig, s sender) *Digest {
+	d := &Digest{config: config, sender: s, done: make(chan struct{})}
+	d.reset(time.Now())
+	return d
+}
+
+// reset starts a new period
+func (d *Digest) reset(now time.Time) {
+	d.start = now
+	d.attempts = 0
+	d.sources = make(map[string]int)
+	d.usernames = make(map[string]int)
+	d.passwords = make(map[string]int)
+	d.credentials = make(map[string]int)
+}
+
+// Process counts an authentication attempt, as logged
+func (d *Digest) Process(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	attempts := 1
+	if v, ok := event.Get("count"); ok {
+		if n, ok := v.(int); ok && n > 0 {
+			attempts = n
+		}
+	}
+	username := event.GetString("username")
+	password := event.GetString("password")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.attempts += attempts
+	countKey(d.sources, sourceIP(event), attempts)
+	countKey(d.usernames, username, attempts)
+	countKey(d.passwords, password, attempts)
+	countKey(d.credentials, username+" / "+password, attempts)
+}
+
+// countKey adds to the count of a key, if the map is not full
+func countKey(m map[string]int, key string, n int) {
+	if _, ok := m[key]; ok || len(m) < maxDigestKeys {
+		m[key] += n
+	}
+}
+
+func (d *Digest) loop() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.send(time.Now(), true)
+		}
+	}
+}
+
+// send sends the digest of the period ending now and starts the next one.
+// Empty periods are only reported if always is set.
+func (d *Digest) send(now time.Time, always bool) {
+	d.mu.Lock()
+	if d.attempts == 0 && !always {
+		d.mu.Unlock()
+		return
+	}
+	subject := fmt.Sprintf("[fakessh] Digest: %d attempts from %d sources", d.attempts, len(d.sources))
+	body := d.format(now)
+	d.reset(now)
+	d.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.Timeout)
+	defer cancel()
+	if err := d.sender.Send(ctx, subject, body); err != nil {
+		log.Warn().Err(err).Msg("digest delivery failed")
+	}
+}
+
+// format writes the summary of the current period
+func (d *Digest) format(now time.Time) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Attempts from %s to %s\n\n", d.start.UTC().Format(time.RFC3339), now.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&buf, "Attempts: %d\nSources:  %d\n", d.attempts, len(d.sources))
+
+	lists := []struct {
+		title  string
+		counts map[string]int
+	}{
+		{"Top sources", d.sources},
+		{"Top usernames", d.usernames},
+		{"Top passwords", d.passwords},
+		{"Top credentials", d.credentials},
+	}
+	for _, l := range lists {
+		if len(l.counts) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "\n%s:\n", l.title)
+		entries := top(l.counts, d.config.Top)
+		width := len(strconv.Itoa(entries[0].count))
+		for _, e := range entries {
+			fmt.Fprintf(&buf, "  %*d  %s\n", width, e.count, e.key)
+		}
+	}
+	return buf.String()
+}
+
+type keyCount struct {
+	key   string
+	count int
+}
+
+// top returns the n keys with the highest counts, ties in key order
+func top(m map[string]int, n int) []keyCount {
+	entries := make([]keyCount, 0, len(m))
+	for k, c := range m {
+		entries = append(entries, keyCount{k, c})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].key < entries[j].key
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// Close stops the digest and sends the attempts of the unfinished period
+func (d *Digest) Close() error {
+	close(d.done)
+	d.wg.Wait()
+	d.send(time.Now(), false)
+	return nil
+}
@@ -0,0 +1,77 @@
+package alert
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// mailbox is a sender remembering the sent messages
+type mailbox struct {
+	subjects []string
+	bodies   []string
+}
+
+func (m *mailbox) Send(ctx context.Context, subject, body string) error {
+	m.subjects = append(m.subjects, subject)
+	m.bodies = append(m.bodies, body)
+	return nil
+}
+
+func TestDigest(t *testing.T) {
+	m := &mailbox{}
+	d := newDigest(DigestConfig{Interval: time.Hour, Top: 2, Timeout: time.Second}, m)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	d.reset(start)
+
+	now := time.Now()
+	for _, addr := range []string{"192.0.2.1:1", "192.0.2.1:2", "192.0.2.2:1"} {
+		d.Process(attempt(addr, now))
+	}
+	aggregated := attempt("192.0.2.3:1", now)
+	aggregated.Set("username", "admin")
+	aggregated.Set("count", 5)
+	d.Process(aggregated)
+
+	d.send(start.Add(time.Hour), false)
+	if len(m.subjects) != 1 {
+		t.Fatalf("Expected one digest, got %d", len(m.subjects))
+	}
+	if m.subjects[0] != "[fakessh] Digest: 8 attempts from 3 sources" {
+		t.Errorf("Unexpected subject %q", m.subjects[0])
+	}
+
+	want := `Attempts from 2024-01-01T12:00:00Z to 2024-01-01T13:00:00Z
+
+Attempts: 8
+Sources:  3
+
+Top sources:
+  5  192.0.2.3
+  2  192.0.2.1
+
+Top usernames:
+  5  admin
+  3  root
+
+Top passwords:
+  8  123456
+
+Top credentials:
+  5  admin / 123456
+  3  root / 123456
+`
+	if got := m.bodies[0]; got != want {
+		t.Errorf("Body =\n%s\nwant\n%s", got, want)
+	}
+
+	// Empty periods are only sent by the ticker
+	d.send(start.Add(2*time.Hour), false)
+	if len(m.subjects) != 1 {
+		t.Errorf("Expected no digest for an empty period on close, got %d", len(m.subjects))
+	}
+	d.send(start.Add(2*time.Hour), true)
+	if len(m.subjects) != 2 || m.subjects[1] != "[fakessh] Digest: 0 attempts from 0 sources" {
+		t.Errorf("Expected an empty digest, got %v", m.subjects)
+	}
+}
@@ -0,0 +1,197 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Embed colors by severity
+var discordColors = map[Severity]int{
+	SeverityInfo:     0x3498db,
+	SeverityWarning:  0xf39c12,
+	SeverityCritical: 0xe74c3c,
+}
+
+// Maximum length of an embed field value
+const discordFieldLimit = 1024
+
+// Maximum length of message content, leaving room for the subject
+const discordContentLimit = 1800
+
+// DiscordConfig contains settings of the Discord notifier
+type DiscordConfig struct {
+	// Webhook URL
+	WebhookURL string
+	// Template of the embed description, no description if nil
+	Template *template.Template
+}
+
+// Discord posts alerts as embeds to a Discord webhook
+type Discord struct {
+	url      string
+	template *template.Template
+	client   *http.Client
+}
+
+type discordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Footer      *discordFooter `json:"footer,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordFooter struct {
+	Text string `json:"text"`
+}
+
+// NewDiscord creates a Discord notifier
+func NewDiscord(config DiscordConfig) *Discord {
+	return &Discord{url: config.WebhookURL, template: config.Template, client: &http.Client{}}
+}
+
+// Name identifies the notifier
+func (d *Discord) Name() string {
+	return "discord"
+}
+
+// Notify posts the alert as an embed with the source, location and credentials
+func (d *Discord) Notify(ctx context.Context, a Alert) error {
+	embed := discordEmbed{
+		Title:  a.Message,
+		Color:  discordColors[a.Severity],
+		Footer: &discordFooter{Text: fmt.Sprintf("%s · %s", a.Rule, a.Severity)},
+	}
+	if !a.Time.IsZero() {
+		embed.Timestamp = a.Time.UTC().Format(time.RFC3339)
+	}
+	if d.template != nil {
+		description, err := render(d.template, a)
+		if err != nil {
+			return err
+		}
+		embed.Description = description
+	}
+	embed.Fields = discordFields(a)
+
+	body, err := json.Marshal(discordMessage{Username: "fakessh", Embeds: []discordEmbed{embed}})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, d.client, d.url, nil, body)
+}
+
+// SendReport posts the summary of a report with its file attached
+func (d *Discord) SendReport(ctx context.Context, r Report) error {
+	payload, err := json.Marshal(map[string]string{
+		"username": "fakessh",
+		"content":  "**" + truncate(r.Subject, 150) + "**\n```" + truncate(r.Summary, discordContentLimit) + "```",
+	})
+	if err != nil {
+		return err
+	}
+	if r.Data == nil {
+		return postJSON(ctx, d.client, d.url, nil, payload)
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("payload_json", string(payload))
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="files[0]"; filename=%q`, r.Filename)},
+		"Content-Type":        {r.ContentType},
+	})
+	if err != nil {
+		return err
+	}
+	part.Write(r.Data)
+	if err := mw.Close(); err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {mw.FormDataContentType()}}
+	return post(ctx, d.client, d.url, header, buf.Bytes())
+}
+
+// discordFields returns the embed fields of the alert, skipping unknown values
+func discordFields(a Alert) []discordField {
+	str := func(key string) string {
+		if v, ok := a.Fields[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+
+	var location []string
+	for _, key := range []string{"city", "country_name"} {
+		if v := str(key); v != "" {
+			location = append(location, v)
+		}
+	}
+	if len(location) == 0 {
+		if v := str("country"); v != "" {
+			location = append(location, v)
+		}
+	}
+
+	attempts := str("attempt_number")
+	if attempts == "" {
+		attempts = str("count")
+	}
+
+	candidates := []discordField{
+		{Name: "Source", Value: a.Source, Inline: true},
+		{Name: "Location", Value: strings.Join(location, ", "), Inline: true},
+		{Name: "Network", Value: str("as_org"), Inline: true},
+		{Name: "Username", Value: str("username"), Inline: true},
+		{Name: "Password", Value: str("password"), Inline: true},
+		{Name: "Attempts", Value: attempts, Inline: true},
+	}
+	var fields []discordField
+	for _, f := range candidates {
+		if f.Value == "" {
+			continue
+		}
+		f.Value = truncate(f.Value, discordFieldLimit)
+		fields = append(fields, f)
+	}
+	return fields
+}
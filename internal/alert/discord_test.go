@@ -0,0 +1,78 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscordNotify(t *testing.T) {
+	var msg discordMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&msg)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	tmpl, err := ParseTemplate("Client {{.Fields.client_version}}")
+	if err != nil {
+		t.Fatalf("ParseTemplate() error: %v", err)
+	}
+	d := NewDiscord(DiscordConfig{WebhookURL: srv.URL, Template: tmpl})
+	a := Alert{
+		Rule:     "threshold",
+		Severity: SeverityWarning,
+		Time:     time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		Message:  "192.0.2.1 reached 100 attempts within 1h0m0s",
+		Source:   "192.0.2.1",
+		Fields: map[string]interface{}{
+			"username":       "root",
+			"password":       strings.Repeat("x", 2000),
+			"country":        "NL",
+			"country_name":   "Netherlands",
+			"city":           "Amsterdam",
+			"attempt_number": 100,
+			"client_version": "SSH-2.0-Go",
+		},
+	}
+	if err := d.Notify(context.Background(), a); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+
+	if len(msg.Embeds) != 1 {
+		t.Fatalf("Expected one embed, got %+v", msg)
+	}
+	embed := msg.Embeds[0]
+	if embed.Title != a.Message || embed.Color != 0xf39c12 || embed.Timestamp != "2024-01-01T12:00:00Z" {
+		t.Errorf("Unexpected embed: %+v", embed)
+	}
+	if embed.Description != "Client SSH-2.0-Go" || embed.Footer == nil || embed.Footer.Text != "threshold · warning" {
+		t.Errorf("Unexpected description or footer: %+v", embed)
+	}
+
+	fields := make(map[string]string)
+	for _, f := range embed.Fields {
+		fields[f.Name] = f.Value
+	}
+	want := map[string]string{
+		"Source":   "192.0.2.1",
+		"Location": "Amsterdam, Netherlands",
+		"Username": "root",
+		"Attempts": "100",
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("Field %s = %q, want %q", k, fields[k], v)
+		}
+	}
+	if _, ok := fields["Network"]; ok {
+		t.Error("Expected unknown fields to be skipped")
+	}
+	if len([]rune(fields["Password"])) != discordFieldLimit {
+		t.Errorf("Expected long values to be truncated, got %d characters", len(fields["Password"]))
+	}
+}
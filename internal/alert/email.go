@@ -0,0 +1,249 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Connection security of the SMTP server
+const (
+	// STARTTLS upgrade of a plain connection, usually on port 587
+	SMTPStartTLS = "starttls"
+	// TLS from the start, usually on port 465
+	SMTPTLS = "tls"
+	// No encryption, for local relays only
+	SMTPNone = "none"
+)
+
+// EmailConfig contains settings of the email notifier
+type EmailConfig struct {
+	// SMTP server host and port
+	Host string
+	Port int
+	// Connection security: SMTPStartTLS, SMTPTLS or SMTPNone
+	Security string
+	// Credentials of PLAIN authentication, no authentication if Username is empty
+	Username string
+	Password string
+	// Sender and recipients
+	From string
+	To   []string
+	// Template of the message body, DefaultTemplate if nil
+	Template *template.Template
+}
+
+// Email sends alerts as email messages
+type Email struct {
+	config   EmailConfig
+	template *template.Template
+}
+
+// NewEmail creates an email notifier
+func NewEmail(config EmailConfig) (*Email, error) {
+	t := config.Template
+	if t == nil {
+		var err error
+		if t, err = ParseTemplate(""); err != nil {
+			return nil, err
+		}
+	}
+	return &Email{config: config, template: t}, nil
+}
+
+// Name identifies the notifier
+func (e *Email) Name() string {
+	return "email"
+}
+
+// Notify sends the alert as a message
+func (e *Email) Notify(ctx context.Context, a Alert) error {
+	body, err := render(e.template, a)
+	if err != nil {
+		return err
+	}
+	return e.Send(ctx, "[fakessh] "+a.Message, body)
+}
+
+// Send sends a plain text message to the recipients
+func (e *Email) Send(ctx context.Context, subject, body string) error {
+	msg, err := e.message(subject, body, nil)
+	if err != nil {
+		return err
+	}
+	return e.send(ctx, msg)
+}
+
+// SendReport sends the summary of a report with its file attached
+func (e *Email) SendReport(ctx context.Context, r Report) error {
+	msg, err := e.message(r.Subject, r.Summary, &r)
+	if err != nil {
+		return err
+	}
+	return e.send(ctx, msg)
+}
+
+// send delivers a formatted message to the recipients
+func (e *Email) send(ctx context.Context, msg []byte) error {
+	c, err := e.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if e.config.Username != "" {
+		auth := smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.Host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication error: %w", err)
+		}
+	}
+	if err := c.Mail(e.config.From); err != nil {
+		return fmt.Errorf("SMTP sender rejected: %w", err)
+	}
+	for _, to := range e.config.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("SMTP recipient %s rejected: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP data error: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("SMTP data error: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP message rejected: %w", err)
+	}
+	return c.Quit()
+}
+
+// dial connects to the SMTP server with the configured security
+func (e *Email) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	tlsConfig := &tls.Config{ServerName: e.config.Host}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("SMTP connection error: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if e.config.Security == SMTPTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, e.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SMTP connection error: %w", err)
+	}
+	if e.config.Security == SMTPStartTLS || e.config.Security == "" {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("SMTP STARTTLS error: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// message formats the headers and the quoted-printable body, followed by
+// the file of a report if there is one
+func (e *Email) message(subject, body string, r *Report) ([]byte, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "fakessh"
+	if i := strings.LastIndex(e.config.From, "@"); i >= 0 {
+		domain = e.config.From[i+1:]
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", e.config.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.config.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	var mw *multipart.Writer
+	if r != nil && r.Data != nil {
+		mw = multipart.NewWriter(&buf)
+		fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+		if _, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}); err != nil {
+			return nil, err
+		}
+	} else {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	}
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\r\n")
+
+	if mw != nil {
+		if _, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {r.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": r.Filename})},
+		}); err != nil {
+			return nil, err
+		}
+		// Base64 lines are limited to 76 characters
+		encoded := base64.StdEncoding.EncodeToString(r.Data)
+		for len(encoded) > 76 {
+			buf.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		buf.WriteString(encoded + "\r\n")
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
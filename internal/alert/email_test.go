@@ -0,0 +1,175 @@
+package alert
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpMessage is a message received by the fake SMTP server
+type smtpMessage struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// startSMTP runs a minimal plain SMTP server receiving one message per connection
+func startSMTP(t *testing.T) (string, int, <-chan smtpMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, messages
+}
+
+func serveSMTP(conn net.Conn, messages chan<- smtpMessage) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+
+	var msg smtpMessage
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			msg.auth = line
+			reply("235 Authentication successful")
+		case "MAIL":
+			msg.from = line
+			reply("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, line)
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			msg.data = data.String()
+			reply("250 OK")
+			messages <- msg
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// body decodes the quoted-printable body of a message
+func body(t *testing.T, data string) string {
+	t.Helper()
+	i := strings.Index(data, "\r\n\r\n")
+	if i < 0 {
+		t.Fatalf("No body in message %q", data)
+	}
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(data[i+4:])))
+	if err != nil {
+		t.Fatalf("Failed to decode body: %v", err)
+	}
+	return strings.ReplaceAll(string(decoded), "\r\n", "\n")
+}
+
+func TestEmailNotify(t *testing.T) {
+	host, port, messages := startSMTP(t)
+	e, err := NewEmail(EmailConfig{
+		Host:     host,
+		Port:     port,
+		Security: SMTPNone,
+		From:     "fakessh@example.com",
+		To:       []string{"soc@example.com", "oncall@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("NewEmail() error: %v", err)
+	}
+
+	a := Alert{Message: "New attacker 192.0.2.1", Fields: map[string]interface{}{"username": "root", "password": "päss"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.Notify(ctx, a); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+
+	msg := <-messages
+	if msg.from != "MAIL FROM:<fakessh@example.com> BODY=8BITMIME" && msg.from != "MAIL FROM:<fakessh@example.com>" {
+		t.Errorf("Unexpected sender: %q", msg.from)
+	}
+	if len(msg.to) != 2 {
+		t.Errorf("Expected 2 recipients, got %v", msg.to)
+	}
+	if !strings.Contains(msg.data, "Subject: [fakessh] New attacker 192.0.2.1\r\n") {
+		t.Errorf("Missing subject in %q", msg.data)
+	}
+	if !strings.Contains(msg.data, "To: soc@example.com, oncall@example.com\r\n") {
+		t.Errorf("Missing recipients in %q", msg.data)
+	}
+	if got, want := body(t, msg.data), "New attacker 192.0.2.1\nusername: root\npassword: päss\n"; got != want {
+		t.Errorf("Body = %q, want %q", got, want)
+	}
+}
+
+func TestEmailStartTLSRequired(t *testing.T) {
+	host, port, _ := startSMTP(t)
+	e, _ := NewEmail(EmailConfig{Host: host, Port: port, From: "a@example.com", To: []string{"b@example.com"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := e.Send(ctx, "test", "test")
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Expected a STARTTLS error from a server without it, got %v", err)
+	}
+}
+
+func TestEmailConnectionError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	e, _ := NewEmail(EmailConfig{Host: "127.0.0.1", Port: port, Security: SMTPNone, From: "a@example.com", To: []string{"b@example.com"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.Send(ctx, "test", "test"); err == nil {
+		t.Error("Expected a connection error")
+	}
+}
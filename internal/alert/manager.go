@@ -0,0 +1,150 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package alert
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/rs/zerolog/log"
+)
+
+// Config contains settings of alert delivery
+type Config struct {
+	// Alerts waiting for delivery, further alerts are dropped
+	QueueSize int
+	// Timeout of a single delivery
+	Timeout time.Duration
+	// Alerts of a rule about a source are suppressed for this long after
+	// one was delivered, disabled if 0
+	Cooldown time.Duration
+	// Cooldowns of single rules, overriding Cooldown
+	RuleCooldowns map[string]time.Duration
+	// Alerts of a rule following a delivered one within this window are
+	// summarized in one alert, disabled if 0
+	BatchWindow time.Duration
+}
+
+// Manager checks events against the triggers and delivers the raised alerts
+// to their notifiers in the background, so that slow services do not delay
+// logging. The triggers of custom rules can be replaced while it runs.
+type Manager struct {
+	triggers  []Trigger
+	rules     atomic.Pointer[[]*RuleTrigger]
+	notifiers []Notifier
+	timeout   time.Duration
+	throttle  *throttle
+	queue     chan Alert
+	wg        sync.WaitGroup
+
+	mu       sync.Mutex
+	dropping bool
+}
+
+// NewManager creates a manager and starts delivering alerts
+func NewManager(config Config, triggers []Trigger, notifiers []Notifier) *Manager {
+	m := &Manager{
+		triggers:  triggers,
+		notifiers: notifiers,
+		timeout:   config.Timeout,
+		queue:     make(chan Alert, config.QueueSize),
+	}
+	m.throttle = newThrottle(config, m.enqueue)
+	m.wg.Add(1)
+	go m.deliverLoop()
+	return m
+}
+
+// Process checks an event against the triggers
+func (m *Manager) Process(event *logger.Event) {
+	for _, t := range m.triggers {
+		if a, ok := t.Check(event); ok && m.throttle.admit(a) {
+			m.enqueue(a)
+		}
+	}
+	if rules := m.rules.Load(); rules != nil {
+		for _, t := range *rules {
+			if a, ok := t.Check(event); ok && m.throttle.admit(a) {
+				m.enqueue(a)
+			}
+		}
+	}
+}
+
+// SetRules replaces the triggers of the custom rules, checked after the
+// triggers of the manager, and their cooldowns
+func (m *Manager) SetRules(rules []*RuleTrigger, cooldowns map[string]time.Duration) {
+	m.throttle.setCooldowns(cooldowns)
+	m.rules.Store(&rules)
+}
+
+// enqueue queues an alert for delivery, dropping it if the queue is full
+func (m *Manager) enqueue(a Alert) {
+	select {
+	case m.queue <- a:
+		m.setDropping(false)
+	default:
+		if m.setDropping(true) {
+			log.Warn().Str("rule", a.Rule).Msg("alert queue is full, dropping alerts")
+		}
+	}
+}
+
+// setDropping records whether alerts are dropped and reports a change
+func (m *Manager) setDropping(dropping bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := m.dropping != dropping
+	m.dropping = dropping
+	return changed
+}
+
+func (m *Manager) deliverLoop() {
+	defer m.wg.Done()
+	failing := make([]bool, len(m.notifiers))
+	for a := range m.queue {
+		for i, n := range m.notifiers {
+			if !a.For(n.Name()) {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+			err := n.Notify(ctx, a)
+			cancel()
+
+			if err != nil && !failing[i] {
+				log.Warn().Err(err).Str("notifier", n.Name()).Str("rule", a.Rule).Msg("alert delivery failed")
+			} else if err == nil && failing[i] {
+				log.Info().Str("notifier", n.Name()).Msg("alert delivery recovered")
+			}
+			failing[i] = err != nil
+		}
+	}
+}
+
+// Close delivers the queued alerts and open batches, and stops the manager
+func (m *Manager) Close() error {
+	m.throttle.close()
+	close(m.queue)
+	m.wg.Wait()
+	return nil
+}
@@ -0,0 +1,100 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// recorder is a notifier remembering the delivered alerts
+type recorder struct {
+	mu     sync.Mutex
+	alerts []Alert
+	err    error
+}
+
+func (r *recorder) Name() string { return "recorder" }
+
+func (r *recorder) Notify(ctx context.Context, a Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, a)
+	return r.err
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.alerts)
+}
+
+func TestManagerDelivers(t *testing.T) {
+	ok := &recorder{}
+	failing := &recorder{err: errors.New("service unavailable")}
+	m := NewManager(Config{QueueSize: 10, Timeout: time.Second}, []Trigger{NewAttackerTrigger{}}, []Notifier{failing, ok})
+
+	event := attempt("192.0.2.1:4000", time.Now())
+	event.Set("new_attacker", true)
+	m.Process(event)
+	m.Process(attempt("192.0.2.2:4000", time.Now()))
+	m.Process(&logger.Event{Type: "heartbeat"})
+	m.Close()
+
+	if ok.count() != 1 || failing.count() != 1 {
+		t.Errorf("Expected one alert per notifier, got %d and %d", ok.count(), failing.count())
+	}
+	if ok.alerts[0].Rule != "new_attacker" {
+		t.Errorf("Unexpected alert: %+v", ok.alerts[0])
+	}
+}
+
+// blocking is a notifier waiting until released
+type blocking struct {
+	recorder
+	release chan struct{}
+}
+
+func (b *blocking) Notify(ctx context.Context, a Alert) error {
+	<-b.release
+	return b.recorder.Notify(ctx, a)
+}
+
+func TestManagerDropsWhenFull(t *testing.T) {
+	n := &blocking{release: make(chan struct{})}
+	m := NewManager(Config{QueueSize: 2, Timeout: time.Second}, []Trigger{NewAttackerTrigger{}}, []Notifier{n})
+
+	event := attempt("192.0.2.1:4000", time.Now())
+	event.Set("new_attacker", true)
+	for i := 0; i < 10; i++ {
+		m.Process(event)
+	}
+	close(n.release)
+	m.Close()
+
+	// One alert in delivery and two queued
+	if got := n.count(); got > 3 {
+		t.Errorf("Expected at most 3 delivered alerts, got %d", got)
+	}
+}
+
+func TestManagerSetRules(t *testing.T) {
+	r := &recorder{}
+	m := NewManager(Config{QueueSize: 10, Timeout: time.Second}, nil, []Notifier{r})
+
+	m.Process(attempt("192.0.2.1:4000", time.Now()))
+	m.SetRules([]*RuleTrigger{NewRuleTrigger(Rule{Name: "any_attempt", Severity: SeverityInfo})}, map[string]time.Duration{"any_attempt": time.Hour})
+	m.Process(attempt("192.0.2.1:4000", time.Now()))
+	m.Process(attempt("192.0.2.1:4000", time.Now()))
+	m.SetRules(nil, nil)
+	m.Process(attempt("192.0.2.2:4000", time.Now()))
+	m.Close()
+
+	// The cooldown of the rule suppresses the second alert
+	if r.count() != 1 || r.alerts[0].Rule != "any_attempt" {
+		t.Errorf("Expected one alert of the added rule, got %+v", r.alerts)
+	}
+}
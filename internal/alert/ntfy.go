@@ -0,0 +1,115 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// NtfyServer is the public ntfy server
+const NtfyServer = "https://ntfy.sh"
+
+// ntfy priorities by severity, 3 is the default priority
+var ntfyPriorities = map[Severity]int{
+	SeverityInfo:     3,
+	SeverityWarning:  4,
+	SeverityCritical: 5,
+}
+
+// NtfyConfig contains settings of the ntfy notifier
+type NtfyConfig struct {
+	// Server URL, NtfyServer if empty
+	Server string
+	// Topic the messages are published to
+	Topic string
+	// Access token of protected topics, none if empty
+	Token string
+	// Message template, DefaultTemplate if nil
+	Template *template.Template
+}
+
+// Ntfy publishes alerts to an ntfy topic
+type Ntfy struct {
+	url      string
+	topic    string
+	header   http.Header
+	template *template.Template
+	client   *http.Client
+}
+
+type ntfyMessage struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags"`
+}
+
+// NewNtfy creates an ntfy notifier
+func NewNtfy(config NtfyConfig) (*Ntfy, error) {
+	t := config.Template
+	if t == nil {
+		var err error
+		if t, err = ParseTemplate(""); err != nil {
+			return nil, err
+		}
+	}
+	server := config.Server
+	if server == "" {
+		server = NtfyServer
+	}
+	n := &Ntfy{
+		url:      strings.TrimSuffix(server, "/"),
+		topic:    config.Topic,
+		template: t,
+		client:   &http.Client{},
+	}
+	if config.Token != "" {
+		n.header = http.Header{"Authorization": {"Bearer " + config.Token}}
+	}
+	return n, nil
+}
+
+// Name identifies the notifier
+func (n *Ntfy) Name() string {
+	return "ntfy"
+}
+
+// Notify publishes the alert with the summary as title
+func (n *Ntfy) Notify(ctx context.Context, a Alert) error {
+	text, err := render(n.template, a)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(ntfyMessage{
+		Topic:    n.topic,
+		Title:    a.Message,
+		Message:  text,
+		Priority: ntfyPriorities[a.Severity],
+		Tags:     []string{"fakessh", a.Rule},
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.client, n.url, n.header, body)
+}
@@ -0,0 +1,57 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNtfyNotify(t *testing.T) {
+	var msg ntfyMessage
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&msg)
+		w.Write([]byte(`{"id":"x"}`))
+	}))
+	defer srv.Close()
+
+	tmpl, _ := ParseTemplate("{{.Fields.username}} from {{.Source}}")
+	n, err := NewNtfy(NtfyConfig{Server: srv.URL + "/", Topic: "honeypot", Token: "tk_secret", Template: tmpl})
+	if err != nil {
+		t.Fatalf("NewNtfy() error: %v", err)
+	}
+	a := Alert{
+		Rule:     "threshold",
+		Severity: SeverityWarning,
+		Message:  "192.0.2.1 reached 100 attempts",
+		Source:   "192.0.2.1",
+		Fields:   map[string]interface{}{"username": "root"},
+	}
+	if err := n.Notify(context.Background(), a); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+
+	if auth != "Bearer tk_secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if msg.Topic != "honeypot" || msg.Title != a.Message || msg.Message != "root from 192.0.2.1" || msg.Priority != 4 {
+		t.Errorf("Unexpected message: %+v", msg)
+	}
+}
+
+func TestNtfyNotifyError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	n, _ := NewNtfy(NtfyConfig{Server: srv.URL, Topic: "honeypot"})
+	err := n.Notify(context.Background(), Alert{Message: "test"})
+	if err == nil || !strings.Contains(err.Error(), "forbidden") {
+		t.Errorf("Expected the error response, got %v", err)
+	}
+}
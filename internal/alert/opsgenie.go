@@ -0,0 +1,129 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+)
+
+// OpsgenieAPI is the base URL of the Opsgenie API, use
+// https://api.eu.opsgenie.com for accounts in the EU region
+const OpsgenieAPI = "https://api.opsgenie.com"
+
+// Maximum lengths of an alert message and alias
+const (
+	opsgenieMessageLimit = 130
+	opsgenieAliasLimit   = 512
+)
+
+// Opsgenie priorities by severity
+var opsgeniePriorities = map[Severity]string{
+	SeverityInfo:     "P5",
+	SeverityWarning:  "P3",
+	SeverityCritical: "P1",
+}
+
+// OpsgenieConfig contains settings of the Opsgenie notifier
+type OpsgenieConfig struct {
+	// Key of an API integration
+	APIKey string
+	// Base URL of the API, OpsgenieAPI if empty
+	APIURL string
+	// Template of the alert description, DefaultTemplate if nil
+	Template *template.Template
+}
+
+// Opsgenie creates Opsgenie alerts
+type Opsgenie struct {
+	url      string
+	header   http.Header
+	template *template.Template
+	client   *http.Client
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Entity      string            `json:"entity,omitempty"`
+	Source      string            `json:"source"`
+	Priority    string            `json:"priority"`
+	Tags        []string          `json:"tags"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// NewOpsgenie creates an Opsgenie notifier
+func NewOpsgenie(config OpsgenieConfig) (*Opsgenie, error) {
+	t := config.Template
+	if t == nil {
+		var err error
+		if t, err = ParseTemplate(""); err != nil {
+			return nil, err
+		}
+	}
+	api := config.APIURL
+	if api == "" {
+		api = OpsgenieAPI
+	}
+	return &Opsgenie{
+		url:      api + "/v2/alerts",
+		header:   http.Header{"Authorization": {"GenieKey " + config.APIKey}},
+		template: t,
+		client:   &http.Client{},
+	}, nil
+}
+
+// Name identifies the notifier
+func (o *Opsgenie) Name() string {
+	return "opsgenie"
+}
+
+// Notify creates an alert. Repeated alerts of a rule about the same source
+// are deduplicated by Opsgenie while the first one is open.
+func (o *Opsgenie) Notify(ctx context.Context, a Alert) error {
+	description, err := render(o.template, a)
+	if err != nil {
+		return err
+	}
+	details := make(map[string]string, len(a.Fields))
+	for k, v := range a.Fields {
+		if v != nil {
+			details[k] = fmt.Sprint(v)
+		}
+	}
+
+	body, err := json.Marshal(opsgenieAlert{
+		Message:     truncate(a.Message, opsgenieMessageLimit),
+		Alias:       truncate(dedupKey(a), opsgenieAliasLimit),
+		Description: description,
+		Entity:      a.Source,
+		Source:      "fakessh",
+		Priority:    opsgeniePriorities[a.Severity],
+		Tags:        []string{"fakessh", a.Rule},
+		Details:     details,
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, o.client, o.url, o.header, body)
+}
@@ -0,0 +1,68 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpsgenieNotify(t *testing.T) {
+	var payload opsgenieAlert
+	var path, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	o, err := NewOpsgenie(OpsgenieConfig{APIKey: "k3y", APIURL: srv.URL})
+	if err != nil {
+		t.Fatalf("NewOpsgenie() error: %v", err)
+	}
+	a := Alert{
+		Rule:     "threshold",
+		Severity: SeverityWarning,
+		Message:  strings.Repeat("m", 200),
+		Source:   "192.0.2.1",
+		Fields:   map[string]interface{}{"username": "root", "attempt_number": 100, "asn": nil},
+	}
+	if err := o.Notify(context.Background(), a); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+
+	if path != "/v2/alerts" || auth != "GenieKey k3y" {
+		t.Errorf("Unexpected request: %s, Authorization %q", path, auth)
+	}
+	if len(payload.Message) != opsgenieMessageLimit || !strings.HasSuffix(payload.Message, "...") {
+		t.Errorf("Expected a truncated message, got %q", payload.Message)
+	}
+	if payload.Alias != "fakessh/threshold/192.0.2.1" || payload.Priority != "P3" || payload.Entity != "192.0.2.1" {
+		t.Errorf("Unexpected alert: %+v", payload)
+	}
+	if payload.Details["username"] != "root" || payload.Details["attempt_number"] != "100" {
+		t.Errorf("Details = %v", payload.Details)
+	}
+	if _, ok := payload.Details["asn"]; ok {
+		t.Error("Expected nil fields to be skipped")
+	}
+	if !strings.Contains(payload.Description, "root") {
+		t.Errorf("Expected the default template as description, got %q", payload.Description)
+	}
+}
+
+func TestOpsgenieNotifyError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Key format is not valid!"}`, http.StatusUnprocessableEntity)
+	}))
+	defer srv.Close()
+
+	o, _ := NewOpsgenie(OpsgenieConfig{APIKey: "bad", APIURL: srv.URL})
+	err := o.Notify(context.Background(), Alert{Message: "test"})
+	if err == nil || !strings.Contains(err.Error(), "Key format") {
+		t.Errorf("Expected the error response, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// PagerDutyAPI is the endpoint of the PagerDuty Events API v2
+const PagerDutyAPI = "https://events.pagerduty.com/v2/enqueue"
+
+// Maximum length of an event summary
+const pagerDutySummaryLimit = 1024
+
+// PagerDutyConfig contains settings of the PagerDuty notifier
+type PagerDutyConfig struct {
+	// Integration (routing) key of an Events API v2 integration
+	RoutingKey string
+	// Events API endpoint, PagerDutyAPI if empty
+	URL string
+}
+
+// PagerDuty triggers PagerDuty incidents through the Events API v2
+type PagerDuty struct {
+	url        string
+	routingKey string
+	client     *http.Client
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key,omitempty"`
+	Payload     pagerDutyPayload `json:"payload"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      Severity               `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Component     string                 `json:"component"`
+	Class         string                 `json:"class"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+// NewPagerDuty creates a PagerDuty notifier
+func NewPagerDuty(config PagerDutyConfig) *PagerDuty {
+	endpoint := config.URL
+	if endpoint == "" {
+		endpoint = PagerDutyAPI
+	}
+	return &PagerDuty{url: endpoint, routingKey: config.RoutingKey, client: &http.Client{}}
+}
+
+// Name identifies the notifier
+func (p *PagerDuty) Name() string {
+	return "pagerduty"
+}
+
+// Notify triggers an incident. Repeated alerts of a rule about the same
+// source are grouped into one incident while it is open.
+func (p *PagerDuty) Notify(ctx context.Context, a Alert) error {
+	source := a.Source
+	if source == "" {
+		source = "fakessh"
+	}
+	event := pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "trigger",
+		DedupKey:    dedupKey(a),
+		Payload: pagerDutyPayload{
+			Summary:       truncate(a.Message, pagerDutySummaryLimit),
+			Source:        source,
+			Severity:      a.Severity,
+			Component:     "fakessh",
+			Class:         a.Rule,
+			CustomDetails: a.Fields,
+		},
+	}
+	if !a.Time.IsZero() {
+		event.Payload.Timestamp = a.Time.UTC().Format(time.RFC3339)
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, p.client, p.url, nil, body)
+}
+
+// dedupKey identifies the alerts of a rule about a source
+func dedupKey(a Alert) string {
+	return "fakessh/" + a.Rule + "/" + a.Source
+}
@@ -0,0 +1,64 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPagerDutyNotify(t *testing.T) {
+	var event pagerDutyEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&event)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status":"success","dedup_key":"x"}`))
+	}))
+	defer srv.Close()
+
+	p := NewPagerDuty(PagerDutyConfig{RoutingKey: "R0UT1NG", URL: srv.URL})
+	a := Alert{
+		Rule:     "threshold",
+		Severity: SeverityWarning,
+		Time:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Message:  "192.0.2.1 reached 100 attempts",
+		Source:   "192.0.2.1",
+		Fields:   map[string]interface{}{"username": "root"},
+	}
+	if err := p.Notify(context.Background(), a); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+
+	if event.RoutingKey != "R0UT1NG" || event.EventAction != "trigger" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+	if event.DedupKey != "fakessh/threshold/192.0.2.1" {
+		t.Errorf("DedupKey = %q", event.DedupKey)
+	}
+	payload := event.Payload
+	if payload.Summary != a.Message || payload.Source != "192.0.2.1" || payload.Severity != SeverityWarning {
+		t.Errorf("Unexpected payload: %+v", payload)
+	}
+	if payload.Timestamp != "2024-05-01T12:00:00Z" || payload.Class != "threshold" {
+		t.Errorf("Unexpected payload: %+v", payload)
+	}
+	if payload.CustomDetails["username"] != "root" {
+		t.Errorf("CustomDetails = %v", payload.CustomDetails)
+	}
+}
+
+func TestPagerDutyNotifyError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"status":"invalid event"}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	p := NewPagerDuty(PagerDutyConfig{RoutingKey: "R0UT1NG", URL: srv.URL})
+	err := p.Notify(context.Background(), Alert{Message: strings.Repeat("x", 2000)})
+	if err == nil || !strings.Contains(err.Error(), "invalid event") {
+		t.Errorf("Expected the error response, got %v", err)
+	}
+}
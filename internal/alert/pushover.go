@@ -0,0 +1,118 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"text/template"
+)
+
+// PushoverAPI is the message endpoint of the Pushover API
+const PushoverAPI = "https://api.pushover.net/1/messages.json"
+
+// Maximum lengths of a message and its title
+const (
+	pushoverMessageLimit = 1024
+	pushoverTitleLimit   = 250
+)
+
+// Pushover priorities by severity: quiet, normal and high priority
+var pushoverPriorities = map[Severity]int{
+	SeverityInfo:     -1,
+	SeverityWarning:  0,
+	SeverityCritical: 1,
+}
+
+// PushoverConfig contains settings of the Pushover notifier
+type PushoverConfig struct {
+	// API token of the Pushover application
+	AppToken string
+	// User or group key receiving the messages
+	UserKey string
+	// Devices of the user receiving the messages, all if empty
+	Device string
+	// Message template, DefaultTemplate if nil
+	Template *template.Template
+	// Message endpoint, PushoverAPI if empty
+	URL string
+}
+
+// Pushover sends alerts as Pushover messages
+type Pushover struct {
+	config   PushoverConfig
+	template *template.Template
+	client   *http.Client
+}
+
+type pushoverMessage struct {
+	Token     string `json:"token"`
+	User      string `json:"user"`
+	Device    string `json:"device,omitempty"`
+	Title     string `json:"title"`
+	Message   string `json:"message"`
+	Priority  int    `json:"priority"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+}
+
+// NewPushover creates a Pushover notifier
+func NewPushover(config PushoverConfig) (*Pushover, error) {
+	t := config.Template
+	if t == nil {
+		var err error
+		if t, err = ParseTemplate(""); err != nil {
+			return nil, err
+		}
+	}
+	if config.URL == "" {
+		config.URL = PushoverAPI
+	}
+	return &Pushover{config: config, template: t, client: &http.Client{}}, nil
+}
+
+// Name identifies the notifier
+func (p *Pushover) Name() string {
+	return "pushover"
+}
+
+// Notify sends the alert with the summary as title
+func (p *Pushover) Notify(ctx context.Context, a Alert) error {
+	text, err := render(p.template, a)
+	if err != nil {
+		return err
+	}
+	msg := pushoverMessage{
+		Token:    p.config.AppToken,
+		User:     p.config.UserKey,
+		Device:   p.config.Device,
+		Title:    truncate(a.Message, pushoverTitleLimit),
+		Message:  truncate(text, pushoverMessageLimit),
+		Priority: pushoverPriorities[a.Severity],
+	}
+	if !a.Time.IsZero() {
+		msg.Timestamp = a.Time.Unix()
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, p.client, p.config.URL, nil, body)
+}
@@ -0,0 +1,59 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushoverNotify(t *testing.T) {
+	var msg pushoverMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&msg)
+		w.Write([]byte(`{"status":1}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewPushover(PushoverConfig{AppToken: "app", UserKey: "user", URL: srv.URL})
+	if err != nil {
+		t.Fatalf("NewPushover() error: %v", err)
+	}
+	a := Alert{
+		Rule:     "new_attacker",
+		Severity: SeverityInfo,
+		Time:     time.Unix(1714564800, 0),
+		Message:  "New attacker 192.0.2.1",
+		Source:   "192.0.2.1",
+		Fields:   map[string]interface{}{"username": strings.Repeat("u", 2000)},
+	}
+	if err := p.Notify(context.Background(), a); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+
+	if msg.Token != "app" || msg.User != "user" || msg.Title != a.Message {
+		t.Errorf("Unexpected message: %+v", msg)
+	}
+	if msg.Priority != -1 || msg.Timestamp != 1714564800 {
+		t.Errorf("Unexpected priority or timestamp: %+v", msg)
+	}
+	if n := len([]rune(msg.Message)); n != pushoverMessageLimit {
+		t.Errorf("Expected a message truncated to %d characters, got %d", pushoverMessageLimit, n)
+	}
+}
+
+func TestPushoverNotifyError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"user":"invalid","status":0}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	p, _ := NewPushover(PushoverConfig{AppToken: "app", UserKey: "bad", URL: srv.URL})
+	err := p.Notify(context.Background(), Alert{Message: "test"})
+	if err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("Expected the error response, got %v", err)
+	}
+}
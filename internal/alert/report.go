@@ -0,0 +1,125 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package alert
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/schedule"
+	"github.com/rs/zerolog/log"
+)
+
+// Report is a periodic report delivered by notifiers
+type Report struct {
+	// Subject of the message
+	Subject string
+	// Plain text summary
+	Summary string
+	// File attached where the service allows it, none if Data is nil
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// ReportSender delivers reports to a service
+type ReportSender interface {
+	// Name identifies the notifier in logs
+	Name() string
+	// SendReport delivers a report
+	SendReport(ctx context.Context, r Report) error
+}
+
+// ReportConfig contains settings of scheduled reports
+type ReportConfig struct {
+	// When reports are generated
+	Schedule *schedule.Schedule
+	// Timeout of delivering a report through a notifier
+	Timeout time.Duration
+}
+
+// ScheduledReports generates reports on a schedule and delivers them
+// through every sender
+type ScheduledReports struct {
+	config   ReportConfig
+	generate func(now time.Time) (Report, error)
+	senders  []ReportSender
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// StartReports starts generating reports with generate at the times of the schedule
+func StartReports(config ReportConfig, generate func(now time.Time) (Report, error), senders []ReportSender) *ScheduledReports {
+	s := &ScheduledReports{
+		config:   config,
+		generate: generate,
+		senders:  senders,
+		done:     make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.loop()
+	return s
+}
+
+func (s *ScheduledReports) loop() {
+	defer s.wg.Done()
+	for {
+		next := s.config.Schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Warn().Msg("report schedule never fires")
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.deliver(next)
+		}
+	}
+}
+
+// deliver generates the report of now and sends it through every sender
+func (s *ScheduledReports) deliver(now time.Time) {
+	r, err := s.generate(now)
+	if err != nil {
+		log.Error().Err(err).Msg("report generation failed")
+		return
+	}
+	for _, sender := range s.senders {
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+		err := sender.SendReport(ctx, r)
+		cancel()
+		if err != nil {
+			log.Warn().Err(err).Str("notifier", sender.Name()).Msg("report delivery failed")
+			continue
+		}
+		log.Info().Str("notifier", sender.Name()).Str("subject", r.Subject).Msg("report delivered")
+	}
+}
+
+// Close stops the schedule, a report being delivered is finished first
+func (s *ScheduledReports) Close() {
+	close(s.done)
+	s.wg.Wait()
+}
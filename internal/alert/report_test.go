@@ -0,0 +1,167 @@
+package alert
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/schedule"
+)
+
+// fakeReportSender records the reports it receives
+type fakeReportSender struct {
+	name    string
+	err     error
+	reports []Report
+}
+
+func (f *fakeReportSender) Name() string {
+	return f.name
+}
+
+func (f *fakeReportSender) SendReport(ctx context.Context, r Report) error {
+	f.reports = append(f.reports, r)
+	return f.err
+}
+
+func TestScheduledReportsDeliver(t *testing.T) {
+	at := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	sched, err := schedule.Parse("0 8 * * mon", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := &fakeReportSender{name: "slack", err: errors.New("unavailable")}
+	working := &fakeReportSender{name: "email"}
+	var generated time.Time
+	s := &ScheduledReports{
+		config: ReportConfig{Schedule: sched, Timeout: time.Second},
+		generate: func(now time.Time) (Report, error) {
+			generated = now
+			return Report{Subject: "Weekly report"}, nil
+		},
+		senders: []ReportSender{failing, working},
+	}
+
+	// A failing notifier does not keep the others from receiving the report
+	s.deliver(at)
+	if !generated.Equal(at) || len(failing.reports) != 1 || len(working.reports) != 1 || working.reports[0].Subject != "Weekly report" {
+		t.Errorf("Unexpected delivery: %v %+v %+v", generated, failing.reports, working.reports)
+	}
+
+	s.generate = func(time.Time) (Report, error) { return Report{}, errors.New("log missing") }
+	s.deliver(at)
+	if len(working.reports) != 1 {
+		t.Errorf("Reports that failed to generate must not be sent")
+	}
+}
+
+func TestScheduledReportsClose(t *testing.T) {
+	sched, err := schedule.Parse("@yearly", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := StartReports(ReportConfig{Schedule: sched, Timeout: time.Second}, func(time.Time) (Report, error) {
+		t.Error("Report generated before its time")
+		return Report{}, nil
+	}, nil)
+	s.Close()
+}
+
+func TestEmailSendReport(t *testing.T) {
+	host, port, messages := startSMTP(t)
+	e, err := NewEmail(EmailConfig{Host: host, Port: port, Security: SMTPNone, From: "fakessh@example.com", To: []string{"soc@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := []byte("<html>" + strings.Repeat("report ", 50) + "</html>")
+	r := Report{Subject: "Weekly report", Summary: "Attempts: 42\n", Filename: "report.html", ContentType: "text/html; charset=utf-8", Data: html}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.SendReport(ctx, r); err != nil {
+		t.Fatalf("SendReport() error: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader((<-messages).data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Unexpected content type %q: %v", msg.Header.Get("Content-Type"), err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	text, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(text); strings.TrimSpace(string(data)) != "Attempts: 42" {
+		t.Errorf("Unexpected summary %q", data)
+	}
+	file, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, _ := io.ReadAll(file)
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil || string(decoded) != string(html) || file.FileName() != "report.html" {
+		t.Errorf("Unexpected attachment %q: %q, %v", file.FileName(), decoded, err)
+	}
+}
+
+func TestSlackSendReport(t *testing.T) {
+	var payload map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer srv.Close()
+
+	s, err := NewSlack(SlackConfig{WebhookURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SendReport(context.Background(), Report{Subject: "Weekly report", Summary: "Attempts: 42\n", Data: []byte("<html>")}); err != nil {
+		t.Fatal(err)
+	}
+	if payload["text"] != "*Weekly report*\n```Attempts: 42\n```" {
+		t.Errorf("Unexpected payload: %v", payload)
+	}
+}
+
+func TestDiscordSendReport(t *testing.T) {
+	var payload map[string]string
+	var file string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("Invalid form: %v", err)
+			return
+		}
+		json.Unmarshal([]byte(r.FormValue("payload_json")), &payload)
+		f, header, err := r.FormFile("files[0]")
+		if err != nil {
+			t.Errorf("Missing file: %v", err)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		file = header.Filename + ":" + string(data)
+	}))
+	defer srv.Close()
+
+	d := NewDiscord(DiscordConfig{WebhookURL: srv.URL})
+	r := Report{Subject: "Weekly report", Summary: "Attempts: 42\n", Filename: "report.html", ContentType: "text/html", Data: []byte("<html>")}
+	if err := d.SendReport(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if payload["content"] != "**Weekly report**\n```Attempts: 42\n```" || file != "report.html:<html>" {
+		t.Errorf("Unexpected message: %v %q", payload, file)
+	}
+}
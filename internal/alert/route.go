@@ -0,0 +1,74 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package alert
+
+import (
+	"context"
+)
+
+// filtered passes only the alerts of some rules to a notifier
+type filtered struct {
+	Notifier
+	rules map[string]bool
+}
+
+// ForRules restricts a notifier to the alerts raised by the given rules.
+// Without rules, the notifier receives every alert.
+func ForRules(n Notifier, rules ...string) Notifier {
+	if len(rules) == 0 {
+		return n
+	}
+	f := &filtered{Notifier: n, rules: make(map[string]bool, len(rules))}
+	for _, r := range rules {
+		f.rules[r] = true
+	}
+	return f
+}
+
+// Notify delivers the alert if its rule is selected
+func (f *filtered) Notify(ctx context.Context, a Alert) error {
+	if !f.rules[a.Rule] {
+		return nil
+	}
+	return f.Notifier.Notify(ctx, a)
+}
+
+// severe passes only the alerts of a minimum severity to a notifier
+type severe struct {
+	Notifier
+	min Severity
+}
+
+// MinSeverity restricts a notifier to the alerts of the given severity or
+// higher. Without a severity, the notifier receives every alert.
+func MinSeverity(n Notifier, min Severity) Notifier {
+	if min == "" {
+		return n
+	}
+	return &severe{Notifier: n, min: min}
+}
+
+// Notify delivers the alert if it is severe enough
+func (s *severe) Notify(ctx context.Context, a Alert) error {
+	if !a.Severity.AtLeast(s.min) {
+		return nil
+	}
+	return s.Notifier.Notify(ctx, a)
+}
@@ -0,0 +1,38 @@
+package alert
+
+import (
+	"context"
+	"testing"
+)
+
+func TestForRules(t *testing.T) {
+	r := &recorder{}
+	n := ForRules(r, "new_attacker")
+	n.Notify(context.Background(), Alert{Rule: "threshold"})
+	n.Notify(context.Background(), Alert{Rule: "new_attacker"})
+	if r.count() != 1 || r.alerts[0].Rule != "new_attacker" {
+		t.Errorf("Expected only the new_attacker alert, got %+v", r.alerts)
+	}
+	if n.Name() != "recorder" {
+		t.Errorf("Name() = %q, want the wrapped notifier's name", n.Name())
+	}
+
+	if ForRules(r) != Notifier(r) {
+		t.Error("Expected the notifier itself without rules")
+	}
+}
+
+func TestMinSeverity(t *testing.T) {
+	r := &recorder{}
+	n := MinSeverity(r, SeverityWarning)
+	n.Notify(context.Background(), Alert{Rule: "new_attacker", Severity: SeverityInfo})
+	n.Notify(context.Background(), Alert{Rule: "threshold", Severity: SeverityWarning})
+	n.Notify(context.Background(), Alert{Rule: "honeytoken", Severity: SeverityCritical})
+	if r.count() != 2 || r.alerts[0].Rule != "threshold" || r.alerts[1].Rule != "honeytoken" {
+		t.Errorf("Expected the warning and critical alerts, got %+v", r.alerts)
+	}
+
+	if MinSeverity(r, "") != Notifier(r) {
+		t.Error("Expected the notifier itself without a severity")
+	}
+}
@@ -0,0 +1,301 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package alert
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// SourceField names the source address without the port in conditions
+// and groupings
+const SourceField = "source"
+
+// Condition selects events by the value of a field. All of the set
+// criteria must match; fields holding lists match if any element does.
+type Condition struct {
+	// Event field, or SourceField
+	Field string
+	// Matches any of the values, compared as strings
+	In []string
+	// Matches the regular expression
+	Regex *regexp.Regexp
+	// Matches numbers within the bounds
+	Min, Max *float64
+	// Matches addresses, with or without a port, inside any of the networks
+	Networks []netip.Prefix
+	// Matches when the field is present (true) or missing (false)
+	Exists *bool
+	// Inverts the condition
+	Not bool
+}
+
+// Match reports whether an event matches the condition
+func (c Condition) Match(event *logger.Event) bool {
+	return c.match(event) != c.Not
+}
+
+func (c Condition) match(event *logger.Event) bool {
+	var v interface{}
+	var ok bool
+	if c.Field == SourceField {
+		v = sourceIP(event)
+		ok = v != ""
+	} else {
+		v, ok = event.Get(c.Field)
+		ok = ok && v != nil
+	}
+	if c.Exists != nil && ok != *c.Exists {
+		return false
+	}
+	if !ok {
+		return c.Exists != nil
+	}
+
+	values := fieldValues(v)
+	if len(c.In) > 0 && !anyValue(values, func(s string) bool { return contains(c.In, s) }) {
+		return false
+	}
+	if c.Regex != nil && !anyValue(values, c.Regex.MatchString) {
+		return false
+	}
+	if len(c.Networks) > 0 {
+		addrs := values
+		if event.OriginalAddr != "" && (c.Field == SourceField || c.Field == "remote_addr") {
+			// Sources are matched before anonymization
+			addrs = []string{event.OriginalAddr}
+		}
+		if !anyValue(addrs, func(s string) bool { return inNetworks(s, c.Networks) }) {
+			return false
+		}
+	}
+	if c.Min != nil || c.Max != nil {
+		n, ok := number(v)
+		if !ok || (c.Min != nil && n < *c.Min) || (c.Max != nil && n > *c.Max) {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldValues returns a field value as strings, one per element of lists
+func fieldValues(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, e := range v {
+			values[i] = fmt.Sprint(e)
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+func anyValue(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// PrivateNetworks are the networks selected by the keyword "private":
+// RFC 1918 and unique local IPv6 addresses
+var PrivateNetworks = []netip.Prefix{
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("fc00::/7"),
+}
+
+// ParseNetworks parses networks in CIDR notation, single addresses, and the
+// keyword "private" for PrivateNetworks
+func ParseNetworks(specs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, spec := range specs {
+		if spec == "private" {
+			prefixes = append(prefixes, PrivateNetworks...)
+			continue
+		}
+		if p, err := netip.ParsePrefix(spec); err == nil {
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network '%s'", spec)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// inNetworks reports whether an address, with or without a port, is inside
+// any of the networks
+func inNetworks(s string, networks []netip.Prefix) bool {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range networks {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// number converts a numeric field value
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// Rule describes the events raising an alert
+type Rule struct {
+	// Name of the rule, used as the alert rule
+	Name string
+	// Severity of the alerts
+	Severity Severity
+	// Template of the alert summary, executed with the alert; a summary
+	// naming the rule and source if nil
+	Message *template.Template
+	// Event types checked, auth_attempt if empty
+	Events []string
+	// Conditions all matching events meet
+	Conditions []Condition
+	// Matching events within Window raising an alert, every matching event
+	// raises one if 0. Each group raises at most one alert per window.
+	Threshold int
+	Window    time.Duration
+	// Field grouping the events counted for Threshold, SourceField if empty
+	GroupBy string
+	// Notifiers receiving the alerts, all if empty
+	Notifiers []string
+}
+
+// RuleTrigger raises the alerts of a rule
+type RuleTrigger struct {
+	rule    Rule
+	counter *windowCounter
+}
+
+// NewRuleTrigger creates a trigger for a rule
+func NewRuleTrigger(rule Rule) *RuleTrigger {
+	if len(rule.Events) == 0 {
+		rule.Events = []string{"auth_attempt"}
+	}
+	if rule.GroupBy == "" {
+		rule.GroupBy = SourceField
+	}
+	t := &RuleTrigger{rule: rule}
+	if rule.Threshold > 0 {
+		t.counter = newWindowCounter(rule.Window)
+	}
+	return t
+}
+
+// Check raises an alert for matching events, or when a group of matching
+// events reaches the threshold
+func (t *RuleTrigger) Check(event *logger.Event) (Alert, bool) {
+	if !contains(t.rule.Events, event.Type) {
+		return Alert{}, false
+	}
+	for _, c := range t.rule.Conditions {
+		if !c.Match(event) {
+			return Alert{}, false
+		}
+	}
+
+	var message string
+	if t.counter == nil {
+		message = fmt.Sprintf("Rule %s matched %s from %s", t.rule.Name, strings.ReplaceAll(event.Type, "_", " "), sourceIP(event))
+	} else {
+		group := t.group(event)
+		count, reached := t.counter.add(group, event.Time, eventCount(event), t.rule.Threshold)
+		if !reached {
+			return Alert{}, false
+		}
+		message = fmt.Sprintf("Rule %s: %s reached %d events within %s", t.rule.Name, group, count, t.rule.Window)
+	}
+
+	a := newAlert(t.rule.Name, t.rule.Severity, message, event)
+	a.Notifiers = t.rule.Notifiers
+	if t.rule.Message != nil {
+		if custom, err := render(t.rule.Message, a); err == nil && custom != "" {
+			a.Message = custom
+		}
+	}
+	return a, true
+}
+
+// group returns the value of the grouping field of an event
+func (t *RuleTrigger) group(event *logger.Event) string {
+	if t.rule.GroupBy == SourceField {
+		return sourceIP(event)
+	}
+	v, ok := event.Get(t.rule.GroupBy)
+	if !ok || v == nil {
+		return "-"
+	}
+	return strings.Join(fieldValues(v), ",")
+}
@@ -0,0 +1,136 @@
+package alert
+
+import (
+	"net/netip"
+	"regexp"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestConditionMatch(t *testing.T) {
+	event := attempt("192.0.2.1:4000", time.Now())
+	event.Set("country", "CN")
+	event.Set("dictionaries", []string{"mirai", "vendor"})
+	event.Set("abuseipdb_score", 87)
+
+	yes, no := true, false
+	low, high := 50.0, 90.0
+	tests := []struct {
+		name      string
+		condition Condition
+		want      bool
+	}{
+		{"in", Condition{Field: "country", In: []string{"RU", "CN"}}, true},
+		{"not in", Condition{Field: "country", In: []string{"RU"}}, false},
+		{"negated", Condition{Field: "country", In: []string{"RU"}, Not: true}, true},
+		{"regex", Condition{Field: "username", Regex: regexp.MustCompile("^(root|admin)$")}, true},
+		{"list element", Condition{Field: "dictionaries", In: []string{"mirai"}}, true},
+		{"source", Condition{Field: SourceField, In: []string{"192.0.2.1"}}, true},
+		{"within bounds", Condition{Field: "abuseipdb_score", Min: &low, Max: &high}, true},
+		{"below minimum", Condition{Field: "abuseipdb_score", Min: &high}, false},
+		{"not a number", Condition{Field: "country", Min: &low}, false},
+		{"exists", Condition{Field: "country", Exists: &yes}, true},
+		{"missing", Condition{Field: "rdns", Exists: &no}, true},
+		{"missing field", Condition{Field: "rdns", In: []string{"x"}}, false},
+		{"network", Condition{Field: "remote_addr", Networks: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}}, true},
+		{"other network", Condition{Field: SourceField, Networks: PrivateNetworks}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.condition.Match(event); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleTriggerEveryEvent(t *testing.T) {
+	trigger := NewRuleTrigger(Rule{
+		Name:       "root_from_cn",
+		Severity:   SeverityCritical,
+		Conditions: []Condition{{Field: "country", In: []string{"CN"}}},
+		Notifiers:  []string{"pagerduty"},
+	})
+
+	event := attempt("192.0.2.1:4000", time.Now())
+	if _, ok := trigger.Check(event); ok {
+		t.Error("Expected no alert for an event without a country")
+	}
+	event.Set("country", "CN")
+	a, ok := trigger.Check(event)
+	if !ok {
+		t.Fatal("Expected an alert")
+	}
+	if a.Rule != "root_from_cn" || a.Severity != SeverityCritical || a.Message != "Rule root_from_cn matched auth attempt from 192.0.2.1" {
+		t.Errorf("Unexpected alert: %+v", a)
+	}
+	if !a.For("pagerduty") || a.For("slack") {
+		t.Errorf("Expected the alert for pagerduty only, got %v", a.Notifiers)
+	}
+
+	event.Type = "connection"
+	if _, ok := trigger.Check(event); ok {
+		t.Error("Expected no alert for other event types")
+	}
+}
+
+func TestRuleTriggerThreshold(t *testing.T) {
+	msg := template.Must(template.New("").Parse("Spray of {{.Fields.password}}"))
+	trigger := NewRuleTrigger(Rule{
+		Name:      "spray",
+		Severity:  SeverityWarning,
+		Message:   msg,
+		Threshold: 3,
+		Window:    time.Minute,
+		GroupBy:   "password",
+	})
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var alerts int
+	for i, addr := range []string{"192.0.2.1:1", "192.0.2.2:1", "192.0.2.3:1", "192.0.2.4:1"} {
+		if a, ok := trigger.Check(attempt(addr, start.Add(time.Duration(i)*time.Second))); ok {
+			alerts++
+			if a.Message != "Spray of 123456" {
+				t.Errorf("Message = %q", a.Message)
+			}
+		}
+	}
+	if alerts != 1 {
+		t.Errorf("Expected one alert per window, got %d", alerts)
+	}
+
+	// A new window starts after the first one ended
+	for i := 0; i < 3; i++ {
+		if _, ok := trigger.Check(attempt("192.0.2.1:1", start.Add(2*time.Minute))); ok {
+			alerts++
+		}
+	}
+	if alerts != 2 {
+		t.Errorf("Expected an alert in the next window, got %d alerts", alerts)
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"private", "198.51.100.7/24", "203.0.113.9", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("ParseNetworks() error: %v", err)
+	}
+	if len(networks) != len(PrivateNetworks)+3 {
+		t.Fatalf("Expected %d networks, got %v", len(PrivateNetworks)+3, networks)
+	}
+	for _, addr := range []string{"10.1.2.3", "172.31.0.1:22", "::ffff:192.168.1.1", "fd00::1", "198.51.100.200", "203.0.113.9", "[2001:db8::1]:22"} {
+		if !inNetworks(addr, networks) {
+			t.Errorf("Expected %s to be inside the networks", addr)
+		}
+	}
+	for _, addr := range []string{"172.32.0.1", "203.0.113.10", "example.com", ""} {
+		if inNetworks(addr, networks) {
+			t.Errorf("Expected %s to be outside the networks", addr)
+		}
+	}
+
+	if _, err := ParseNetworks([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("Expected an error for an invalid network")
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/template"
+)
+
+// Maximum length of report summaries, Slack truncates longer messages
+const slackReportLimit = 3500
+
+// SlackConfig contains settings of the Slack notifier
+type SlackConfig struct {
+	// Incoming webhook URL
+	WebhookURL string
+	// Message template, DefaultTemplate if nil
+	Template *template.Template
+}
+
+// Slack posts alerts to a Slack incoming webhook
+type Slack struct {
+	url      string
+	template *template.Template
+	client   *http.Client
+}
+
+// NewSlack creates a Slack notifier
+func NewSlack(config SlackConfig) (*Slack, error) {
+	t := config.Template
+	if t == nil {
+		var err error
+		if t, err = ParseTemplate(""); err != nil {
+			return nil, err
+		}
+	}
+	return &Slack{url: config.WebhookURL, template: t, client: &http.Client{}}, nil
+}
+
+// Name identifies the notifier
+func (s *Slack) Name() string {
+	return "slack"
+}
+
+// Notify posts the alert as a message
+func (s *Slack) Notify(ctx context.Context, a Alert) error {
+	text, err := render(s.template, a)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, s.client, s.url, nil, body)
+}
+
+// SendReport posts the summary of a report, incoming webhooks take no files
+func (s *Slack) SendReport(ctx context.Context, r Report) error {
+	text := "*" + r.Subject + "*\n```" + truncate(r.Summary, slackReportLimit) + "```"
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, s.client, s.url, nil, body)
+}
+
+// postJSON posts a JSON body with optional extra headers and checks the response status
+func postJSON(ctx context.Context, client *http.Client, endpoint string, header http.Header, body []byte) error {
+	h := http.Header{}
+	for k, v := range header {
+		h[k] = v
+	}
+	h.Set("Content-Type", "application/json")
+	return post(ctx, client, endpoint, h, body)
+}
+
+// post posts a body with the given headers and checks the response status
+func post(ctx context.Context, client *http.Client, endpoint string, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Webhook URLs contain secrets, keep them out of the log
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
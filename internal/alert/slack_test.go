@@ -0,0 +1,58 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlackNotify(t *testing.T) {
+	var payload map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	tmpl, err := ParseTemplate("*{{.Message}}* ({{.Fields.username}})")
+	if err != nil {
+		t.Fatalf("ParseTemplate() error: %v", err)
+	}
+	s, err := NewSlack(SlackConfig{WebhookURL: srv.URL, Template: tmpl})
+	if err != nil {
+		t.Fatalf("NewSlack() error: %v", err)
+	}
+
+	a := Alert{Message: "New attacker 192.0.2.1", Fields: map[string]interface{}{"username": "root"}}
+	if err := s.Notify(context.Background(), a); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+	if payload["text"] != "*New attacker 192.0.2.1* (root)" {
+		t.Errorf("Unexpected payload: %v", payload)
+	}
+}
+
+func TestSlackNotifyError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	s, _ := NewSlack(SlackConfig{WebhookURL: srv.URL + "/services/secret"})
+	err := s.Notify(context.Background(), Alert{Message: "test"})
+	if err == nil || !strings.Contains(err.Error(), "invalid_token") {
+		t.Errorf("Expected the error response, got %v", err)
+	}
+
+	srv.Close()
+	err = s.Notify(context.Background(), Alert{Message: "test"})
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("Expected an error without the webhook URL, got %v", err)
+	}
+}
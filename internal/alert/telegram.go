@@ -0,0 +1,93 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"text/template"
+)
+
+// TelegramAPI is the base URL of the Telegram Bot API
+const TelegramAPI = "https://api.telegram.org"
+
+// TelegramConfig contains settings of the Telegram notifier
+type TelegramConfig struct {
+	// Bot token issued by @BotFather
+	BotToken string
+	// Chat receiving the messages: a numeric ID or @channelname
+	ChatID string
+	// Message template, DefaultTemplate if nil
+	Template *template.Template
+	// Base URL of the Bot API, TelegramAPI if empty
+	APIURL string
+}
+
+// Telegram sends alerts as messages of a Telegram bot
+type Telegram struct {
+	url      string
+	chatID   string
+	template *template.Template
+	client   *http.Client
+}
+
+// NewTelegram creates a Telegram notifier
+func NewTelegram(config TelegramConfig) (*Telegram, error) {
+	t := config.Template
+	if t == nil {
+		var err error
+		if t, err = ParseTemplate(""); err != nil {
+			return nil, err
+		}
+	}
+	api := config.APIURL
+	if api == "" {
+		api = TelegramAPI
+	}
+	return &Telegram{
+		url:      api + "/bot" + config.BotToken + "/sendMessage",
+		chatID:   config.ChatID,
+		template: t,
+		client:   &http.Client{},
+	}, nil
+}
+
+// Name identifies the notifier
+func (t *Telegram) Name() string {
+	return "telegram"
+}
+
+// Notify sends the alert as a plain text message
+func (t *Telegram) Notify(ctx context.Context, a Alert) error {
+	text, err := render(t.template, a)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id":                  t.chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, t.client, t.url, nil, body)
+}
@@ -0,0 +1,54 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTelegramNotify(t *testing.T) {
+	var path string
+	var payload map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	n, err := NewTelegram(TelegramConfig{BotToken: "123:abc", ChatID: "-1001234", APIURL: srv.URL})
+	if err != nil {
+		t.Fatalf("NewTelegram() error: %v", err)
+	}
+	a := Alert{Message: "New attacker 192.0.2.1", Fields: map[string]interface{}{"username": "root"}}
+	if err := n.Notify(context.Background(), a); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+
+	if path != "/bot123:abc/sendMessage" {
+		t.Errorf("Unexpected path %q", path)
+	}
+	if payload["chat_id"] != "-1001234" || payload["text"] != "New attacker 192.0.2.1\nusername: root" {
+		t.Errorf("Unexpected payload: %v", payload)
+	}
+}
+
+func TestTelegramNotifyError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+	}))
+	defer srv.Close()
+
+	n, _ := NewTelegram(TelegramConfig{BotToken: "123:secret", ChatID: "42", APIURL: srv.URL})
+	err := n.Notify(context.Background(), Alert{Message: "test"})
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("Expected the error description, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "secret") {
+		t.Errorf("Error contains the bot token: %v", err)
+	}
+}
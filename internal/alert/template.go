@@ -0,0 +1,57 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package alert
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate formats the summary of an alert with the key event fields
+const DefaultTemplate = `{{.Message}}
+{{with .Fields.username}}username: {{.}}
+{{end}}{{with .Fields.password}}password: {{.}}
+{{end}}{{with .Fields.country}}country: {{.}}
+{{end}}{{with .Fields.as_org}}network: {{.}}
+{{end}}`
+
+// ParseTemplate parses a message template, DefaultTemplate if text is empty.
+// Templates are executed with the Alert.
+func ParseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	t, err := template.New("alert").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("alert template error: %w", err)
+	}
+	return t, nil
+}
+
+// render executes a message template
+func render(t *template.Template, a Alert) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, a); err != nil {
+		return "", fmt.Errorf("alert template error: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,49 @@
+package alert
+
+import (
+	"testing"
+)
+
+func TestDefaultTemplate(t *testing.T) {
+	tmpl, err := ParseTemplate("")
+	if err != nil {
+		t.Fatalf("ParseTemplate() error: %v", err)
+	}
+	a := Alert{
+		Message: "New attacker 192.0.2.1",
+		Fields:  map[string]interface{}{"username": "root", "password": "123456", "country": "NL"},
+	}
+	got, err := render(tmpl, a)
+	if err != nil {
+		t.Fatalf("render() error: %v", err)
+	}
+	want := "New attacker 192.0.2.1\nusername: root\npassword: 123456\ncountry: NL"
+	if got != want {
+		t.Errorf("render() = %q, want %q", got, want)
+	}
+}
+
+func TestCustomTemplate(t *testing.T) {
+	tmpl, err := ParseTemplate(`{{.Severity}} {{.Rule}}: {{.Source}} as {{.Fields.username}}`)
+	if err != nil {
+		t.Fatalf("ParseTemplate() error: %v", err)
+	}
+	got, err := render(tmpl, Alert{
+		Rule:     "threshold",
+		Severity: SeverityWarning,
+		Source:   "192.0.2.1",
+		Fields:   map[string]interface{}{"username": "admin"},
+	})
+	if err != nil {
+		t.Fatalf("render() error: %v", err)
+	}
+	if want := "warning threshold: 192.0.2.1 as admin"; got != want {
+		t.Errorf("render() = %q, want %q", got, want)
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	if _, err := ParseTemplate("{{.Message"); err == nil {
+		t.Error("Expected a parse error")
+	}
+}
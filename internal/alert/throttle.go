@@ -0,0 +1,206 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package alert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Sources listed in the summary of a batch
+const batchSources = 20
+
+// throttle suppresses repeated alerts about a source during a cooldown,
+// and batches the alerts of a rule: the first alert is delivered at once,
+// the following ones within the batch window are summarized in one alert
+type throttle struct {
+	cooldown    time.Duration
+	cooldowns   map[string]time.Duration
+	batchWindow time.Duration
+	emit        func(Alert)
+	now         func() time.Time
+
+	mu      sync.Mutex
+	last    map[string]time.Time
+	swept   time.Time
+	batches map[string]*batch
+	closed  bool
+}
+
+// batch collects the alerts of a rule within a batch window
+type batch struct {
+	start     time.Time
+	count     int
+	severity  Severity
+	sources   []string
+	seen      map[string]bool
+	notifiers []string
+	timer     *time.Timer
+}
+
+func newThrottle(config Config, emit func(Alert)) *throttle {
+	return &throttle{
+		cooldown:    config.Cooldown,
+		cooldowns:   config.RuleCooldowns,
+		batchWindow: config.BatchWindow,
+		emit:        emit,
+		now:         time.Now,
+		last:        make(map[string]time.Time),
+		batches:     make(map[string]*batch),
+	}
+}
+
+// admit reports whether an alert is delivered now
+func (t *throttle) admit(a Alert) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+
+	if cooldown := t.cooldownOf(a.Rule); cooldown > 0 {
+		t.sweep(now)
+		key := a.Rule + "\x00" + a.Source
+		if last, ok := t.last[key]; ok && now.Sub(last) < cooldown {
+			return false
+		}
+		t.last[key] = now
+	}
+
+	if t.batchWindow <= 0 || t.closed {
+		return true
+	}
+	if b, ok := t.batches[a.Rule]; ok {
+		b.add(a)
+		return false
+	}
+	rule := a.Rule
+	t.batches[rule] = &batch{
+		start:     now,
+		seen:      make(map[string]bool),
+		notifiers: a.Notifiers,
+		timer:     time.AfterFunc(t.batchWindow, func() { t.flush(rule) }),
+	}
+	return true
+}
+
+// setCooldowns replaces the cooldowns of single rules
+func (t *throttle) setCooldowns(cooldowns map[string]time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cooldowns = cooldowns
+}
+
+// cooldownOf returns the cooldown of a rule
+func (t *throttle) cooldownOf(rule string) time.Duration {
+	if d, ok := t.cooldowns[rule]; ok {
+		return d
+	}
+	return t.cooldown
+}
+
+// sweep drops the alerts whose cooldown ended, at most once per cooldown
+func (t *throttle) sweep(now time.Time) {
+	longest := t.cooldown
+	for _, d := range t.cooldowns {
+		if d > longest {
+			longest = d
+		}
+	}
+	if now.Sub(t.swept) < longest {
+		return
+	}
+	for key, last := range t.last {
+		if now.Sub(last) >= longest {
+			delete(t.last, key)
+		}
+	}
+	t.swept = now
+}
+
+// add counts an alert in the batch
+func (b *batch) add(a Alert) {
+	b.count++
+	if severityRank[a.Severity] > severityRank[b.severity] {
+		b.severity = a.Severity
+	}
+	if a.Source != "" && !b.seen[a.Source] {
+		b.seen[a.Source] = true
+		if len(b.sources) < batchSources {
+			b.sources = append(b.sources, a.Source)
+		}
+	}
+}
+
+// flush emits the summary of a batch at the end of its window. The batch
+// stays open for another window while alerts keep arriving.
+func (t *throttle) flush(rule string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	b, ok := t.batches[rule]
+	if !ok {
+		return
+	}
+	if b.count == 0 {
+		delete(t.batches, rule)
+		return
+	}
+	t.emit(b.summary(rule, t.now()))
+	t.batches[rule] = &batch{
+		start:     t.now(),
+		seen:      make(map[string]bool),
+		notifiers: b.notifiers,
+		timer:     time.AfterFunc(t.batchWindow, func() { t.flush(rule) }),
+	}
+}
+
+// summary returns the alert summarizing a batch
+func (b *batch) summary(rule string, now time.Time) Alert {
+	message := fmt.Sprintf("%d more %s alerts from %d sources within %s", b.count, rule, len(b.seen), now.Sub(b.start).Round(time.Second))
+	return Alert{
+		Rule:     rule,
+		Severity: b.severity,
+		Time:     now,
+		Message:  message,
+		Fields: map[string]interface{}{
+			"alerts":  b.count,
+			"sources": b.sources,
+		},
+		Notifiers: b.notifiers,
+	}
+}
+
+// close emits the summaries of the open batches and stops batching
+func (t *throttle) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	t.closed = true
+	for rule, b := range t.batches {
+		b.timer.Stop()
+		if b.count > 0 {
+			t.emit(b.summary(rule, t.now()))
+		}
+	}
+	t.batches = nil
+}
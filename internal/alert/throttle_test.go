@@ -0,0 +1,94 @@
+package alert
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThrottleCooldown(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	th := newThrottle(Config{
+		Cooldown:      time.Hour,
+		RuleCooldowns: map[string]time.Duration{"new_attacker": 0},
+	}, func(Alert) {})
+	th.now = func() time.Time { return now }
+
+	a := Alert{Rule: "threshold", Source: "192.0.2.1"}
+	if !th.admit(a) {
+		t.Fatal("Expected the first alert to be admitted")
+	}
+	if th.admit(a) {
+		t.Error("Expected a repeated alert to be suppressed")
+	}
+	if !th.admit(Alert{Rule: "threshold", Source: "192.0.2.2"}) {
+		t.Error("Expected an alert about another source to be admitted")
+	}
+	if !th.admit(Alert{Rule: "new_attacker", Source: "192.0.2.1"}) || !th.admit(Alert{Rule: "new_attacker", Source: "192.0.2.1"}) {
+		t.Error("Expected alerts of a rule without cooldown to be admitted")
+	}
+
+	now = now.Add(time.Hour)
+	if !th.admit(a) {
+		t.Error("Expected the alert to be admitted after the cooldown")
+	}
+}
+
+func TestThrottleBatch(t *testing.T) {
+	var mu sync.Mutex
+	var emitted []Alert
+	th := newThrottle(Config{BatchWindow: 50 * time.Millisecond}, func(a Alert) {
+		mu.Lock()
+		emitted = append(emitted, a)
+		mu.Unlock()
+	})
+
+	if !th.admit(Alert{Rule: "threshold", Source: "192.0.2.1", Severity: SeverityWarning}) {
+		t.Fatal("Expected the first alert to be admitted")
+	}
+	for _, src := range []string{"192.0.2.2", "192.0.2.3", "192.0.2.2"} {
+		if th.admit(Alert{Rule: "threshold", Source: src, Severity: SeverityWarning}) {
+			t.Errorf("Expected the alert from %s to be batched", src)
+		}
+	}
+	if !th.admit(Alert{Rule: "new_attacker", Source: "192.0.2.9"}) {
+		t.Error("Expected the first alert of another rule to be admitted")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(emitted)
+		mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	th.close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(emitted) != 1 {
+		t.Fatalf("Expected one summary, got %+v", emitted)
+	}
+	s := emitted[0]
+	if s.Rule != "threshold" || s.Severity != SeverityWarning || s.Fields["alerts"] != 3 {
+		t.Errorf("Unexpected summary: %+v", s)
+	}
+	if sources := s.Fields["sources"].([]string); len(sources) != 2 {
+		t.Errorf("Expected two distinct sources, got %v", sources)
+	}
+}
+
+func TestThrottleCloseFlushes(t *testing.T) {
+	var emitted []Alert
+	th := newThrottle(Config{BatchWindow: time.Hour}, func(a Alert) { emitted = append(emitted, a) })
+	th.admit(Alert{Rule: "threshold", Source: "192.0.2.1"})
+	th.admit(Alert{Rule: "threshold", Source: "192.0.2.2"})
+	th.close()
+
+	if len(emitted) != 1 || emitted[0].Fields["alerts"] != 1 {
+		t.Errorf("Expected the open batch to be summarized on close, got %+v", emitted)
+	}
+}
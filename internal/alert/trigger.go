@@ -0,0 +1,270 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package alert
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Trigger raises an alert for the events it selects
+type Trigger interface {
+	// Check returns the alert raised by an event, if any
+	Check(event *logger.Event) (Alert, bool)
+}
+
+// NewAttackerTrigger alerts on the first attempt of a source, as tagged
+// by attacker tracking
+type NewAttackerTrigger struct{}
+
+// Check raises an alert for attempts with new_attacker set
+func (NewAttackerTrigger) Check(event *logger.Event) (Alert, bool) {
+	if event.Type != "auth_attempt" {
+		return Alert{}, false
+	}
+	if v, _ := event.Get("new_attacker"); v != true {
+		return Alert{}, false
+	}
+	return newAlert("new_attacker", SeverityInfo, fmt.Sprintf("New attacker %s", sourceIP(event)), event), true
+}
+
+// NewCountryTrigger alerts on the first attempt from a country, as tagged
+// by attacker tracking
+type NewCountryTrigger struct{}
+
+// Check raises an alert for attempts with new_country set
+func (NewCountryTrigger) Check(event *logger.Event) (Alert, bool) {
+	if event.Type != "auth_attempt" {
+		return Alert{}, false
+	}
+	if v, _ := event.Get("new_country"); v != true {
+		return Alert{}, false
+	}
+	message := "First attempt from country " + event.GetString("country")
+	if name := event.GetString("country_name"); name != "" {
+		message += " (" + name + ")"
+	}
+	return newAlert("new_country", SeverityInfo, message, event), true
+}
+
+// NewASNTrigger alerts on the first attempt from an autonomous system, as
+// tagged by attacker tracking
+type NewASNTrigger struct{}
+
+// Check raises an alert for attempts with new_asn set
+func (NewASNTrigger) Check(event *logger.Event) (Alert, bool) {
+	if event.Type != "auth_attempt" {
+		return Alert{}, false
+	}
+	if v, _ := event.Get("new_asn"); v != true {
+		return Alert{}, false
+	}
+	asn, _ := event.Get("asn")
+	message := fmt.Sprintf("First attempt from AS%v", asn)
+	if org := event.GetString("as_org"); org != "" {
+		message += " " + org
+	}
+	return newAlert("new_asn", SeverityInfo, message, event), true
+}
+
+// InternalSourceTrigger raises a critical alert for attempts from internal
+// networks: a machine on the LAN brute-forcing the honeypot is usually
+// compromised
+type InternalSourceTrigger struct {
+	networks []netip.Prefix
+}
+
+// NewInternalSourceTrigger creates a trigger for attempts from the networks
+func NewInternalSourceTrigger(networks []netip.Prefix) *InternalSourceTrigger {
+	return &InternalSourceTrigger{networks: networks}
+}
+
+// Check raises an alert for attempts from an internal network. Sources are
+// matched before anonymization, and reported as logged.
+func (t *InternalSourceTrigger) Check(event *logger.Event) (Alert, bool) {
+	if event.Type != "auth_attempt" {
+		return Alert{}, false
+	}
+	if !inNetworks(originalSourceIP(event), t.networks) {
+		return Alert{}, false
+	}
+	return newAlert("internal_source", SeverityCritical, fmt.Sprintf("Attempt from internal address %s", sourceIP(event)), event), true
+}
+
+// SprayTrigger alerts on password sprays, as reported by the spray detection
+type SprayTrigger struct{}
+
+// Check raises an alert for password_spray events
+func (SprayTrigger) Check(event *logger.Event) (Alert, bool) {
+	if event.Type != "password_spray" {
+		return Alert{}, false
+	}
+	usernames, _ := event.Get("distinct_usernames")
+	sources, _ := event.Get("distinct_sources")
+	var message string
+	if event.GetString("spray_type") == "username" {
+		message = fmt.Sprintf("Username spray: %s tried from %v sources", event.GetString("spray_value"), sources)
+	} else {
+		message = fmt.Sprintf("Password spray: one password tried with %v usernames from %v sources", usernames, sources)
+	}
+	return newAlert("password_spray", SeverityWarning, message, event), true
+}
+
+// SurgeTrigger alerts on attack surges, as reported by the surge detection
+type SurgeTrigger struct{}
+
+// Check raises an alert for attack_surge events
+func (SurgeTrigger) Check(event *logger.Event) (Alert, bool) {
+	if event.Type != "attack_surge" {
+		return Alert{}, false
+	}
+	attempts, _ := event.Get("attempts")
+	baseline, _ := event.Get("baseline")
+	interval, _ := event.Get("interval_seconds")
+	message := fmt.Sprintf("Attack surge: %v attempts in %vs, baseline %v", attempts, interval, baseline)
+	return newAlert("attack_surge", SeverityWarning, message, event), true
+}
+
+// ThresholdTrigger alerts when a source reaches a number of attempts
+// within a window. Each source raises at most one alert per window. The
+// threshold can be changed while events are checked, 0 disables the trigger.
+type ThresholdTrigger struct {
+	attempts atomic.Int64
+	counter  *windowCounter
+}
+
+// NewThresholdTrigger creates a trigger for sources reaching attempts within window
+func NewThresholdTrigger(attempts int, window time.Duration) *ThresholdTrigger {
+	t := &ThresholdTrigger{counter: newWindowCounter(window)}
+	t.attempts.Store(int64(attempts))
+	return t
+}
+
+// SetThreshold changes the number of attempts and the window of the trigger.
+// Counting starts over if the window changes.
+func (t *ThresholdTrigger) SetThreshold(attempts int, window time.Duration) {
+	t.attempts.Store(int64(attempts))
+	t.counter.setWindow(window)
+}
+
+// Threshold returns the number of attempts and the window of the trigger
+func (t *ThresholdTrigger) Threshold() (int, time.Duration) {
+	return int(t.attempts.Load()), t.counter.length()
+}
+
+// Check counts attempts and raises an alert when a source reaches the threshold
+func (t *ThresholdTrigger) Check(event *logger.Event) (Alert, bool) {
+	if event.Type != "auth_attempt" {
+		return Alert{}, false
+	}
+	attempts := int(t.attempts.Load())
+	if attempts <= 0 {
+		return Alert{}, false
+	}
+	ip := sourceIP(event)
+	count, reached := t.counter.add(ip, event.Time, eventCount(event), attempts)
+	if !reached {
+		return Alert{}, false
+	}
+	message := fmt.Sprintf("%s reached %d attempts within %s", ip, count, t.counter.length())
+	return newAlert("threshold", SeverityWarning, message, event), true
+}
+
+// eventCount returns the number of attempts of an event, collapsed
+// attempts carry a count field
+func eventCount(event *logger.Event) int {
+	if v, ok := event.Get("count"); ok {
+		if n, ok := v.(int); ok && n > 0 {
+			return n
+		}
+	}
+	return 1
+}
+
+// windowCounter counts per key within fixed windows starting at the
+// first count of the key
+type windowCounter struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	counts map[string]*windowCount
+	swept  time.Time
+}
+
+type windowCount struct {
+	start time.Time
+	count int
+}
+
+func newWindowCounter(window time.Duration) *windowCounter {
+	return &windowCounter{window: window, counts: make(map[string]*windowCount)}
+}
+
+// setWindow changes the window, dropping the counts of the old one
+func (w *windowCounter) setWindow(window time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if window != w.window {
+		w.window = window
+		w.counts = make(map[string]*windowCount)
+	}
+}
+
+// length returns the window
+func (w *windowCounter) length() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.window
+}
+
+// add counts n for a key and reports whether the count of its window has
+// just reached the threshold
+func (w *windowCounter) add(key string, now time.Time, n, threshold int) (int, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.sweep(now)
+	c, ok := w.counts[key]
+	if !ok || now.Sub(c.start) >= w.window {
+		c = &windowCount{start: now}
+		w.counts[key] = c
+	}
+	before := c.count
+	c.count += n
+	return c.count, before < threshold && c.count >= threshold
+}
+
+// sweep drops the keys whose window ended, at most once per window
+func (w *windowCounter) sweep(now time.Time) {
+	if now.Sub(w.swept) < w.window {
+		return
+	}
+	for key, c := range w.counts {
+		if now.Sub(c.start) >= w.window {
+			delete(w.counts, key)
+		}
+	}
+	w.swept = now
+}
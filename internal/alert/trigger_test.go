@@ -0,0 +1,233 @@
+package alert
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/privacy"
+)
+
+func attempt(addr string, at time.Time) *logger.Event {
+	event := logger.NewAuthEvent(logger.CredentialAttempt{
+		Timestamp:  at,
+		RemoteAddr: addr,
+		Username:   "root",
+		Password:   "123456",
+	})
+	event.ID = "event-1"
+	return event
+}
+
+func TestNewAttackerTrigger(t *testing.T) {
+	event := attempt("192.0.2.1:4000", time.Now())
+	if _, ok := (NewAttackerTrigger{}).Check(event); ok {
+		t.Error("Expected no alert without new_attacker")
+	}
+
+	event.Set("new_attacker", true)
+	a, ok := NewAttackerTrigger{}.Check(event)
+	if !ok {
+		t.Fatal("Expected an alert for a new attacker")
+	}
+	if a.Rule != "new_attacker" || a.Source != "192.0.2.1" || a.Message != "New attacker 192.0.2.1" {
+		t.Errorf("Unexpected alert: %+v", a)
+	}
+	if a.Fields["username"] != "root" || a.Fields["event_id"] != "event-1" {
+		t.Errorf("Unexpected fields: %v", a.Fields)
+	}
+}
+
+func TestNewCountryTrigger(t *testing.T) {
+	event := attempt("192.0.2.1:4000", time.Now())
+	event.Set("country", "CN")
+	event.Set("new_country", false)
+	if _, ok := (NewCountryTrigger{}).Check(event); ok {
+		t.Error("Expected no alert for a known country")
+	}
+
+	event.Set("new_country", true)
+	event.Set("country_name", "China")
+	a, ok := NewCountryTrigger{}.Check(event)
+	if !ok {
+		t.Fatal("Expected an alert for a new country")
+	}
+	if a.Rule != "new_country" || a.Severity != SeverityInfo || a.Message != "First attempt from country CN (China)" {
+		t.Errorf("Unexpected alert: %+v", a)
+	}
+}
+
+func TestNewASNTrigger(t *testing.T) {
+	event := attempt("192.0.2.1:4000", time.Now())
+	event.Set("asn", 4134)
+	if _, ok := (NewASNTrigger{}).Check(event); ok {
+		t.Error("Expected no alert without new_asn")
+	}
+
+	event.Set("new_asn", true)
+	a, ok := NewASNTrigger{}.Check(event)
+	if !ok {
+		t.Fatal("Expected an alert for a new ASN")
+	}
+	if a.Rule != "new_asn" || a.Message != "First attempt from AS4134" {
+		t.Errorf("Unexpected alert: %+v", a)
+	}
+
+	event.Set("as_org", "CHINANET")
+	if a, _ := (NewASNTrigger{}).Check(event); a.Message != "First attempt from AS4134 CHINANET" {
+		t.Errorf("Unexpected message: %q", a.Message)
+	}
+}
+
+func TestThresholdTrigger(t *testing.T) {
+	trigger := NewThresholdTrigger(3, time.Hour)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var alerts []Alert
+	check := func(addr string, at time.Time) {
+		if a, ok := trigger.Check(attempt(addr, at)); ok {
+			alerts = append(alerts, a)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		check("192.0.2.1:4000", start.Add(time.Duration(i)*time.Minute))
+	}
+	check("192.0.2.2:4000", start)
+	if len(alerts) != 1 {
+		t.Fatalf("Expected one alert within the window, got %d", len(alerts))
+	}
+	if alerts[0].Severity != SeverityWarning || alerts[0].Message != "192.0.2.1 reached 3 attempts within 1h0m0s" {
+		t.Errorf("Unexpected alert: %+v", alerts[0])
+	}
+
+	// A new window starts counting again
+	for i := 0; i < 3; i++ {
+		check("192.0.2.1:4000", start.Add(2*time.Hour))
+	}
+	if len(alerts) != 2 {
+		t.Errorf("Expected a second alert in the next window, got %d", len(alerts))
+	}
+}
+
+func TestThresholdTriggerChange(t *testing.T) {
+	trigger := NewThresholdTrigger(0, time.Hour)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, ok := trigger.Check(attempt("192.0.2.1:4000", now)); ok {
+			t.Fatal("Expected a disabled trigger not to alert")
+		}
+	}
+
+	trigger.SetThreshold(2, time.Minute)
+	if attempts, window := trigger.Threshold(); attempts != 2 || window != time.Minute {
+		t.Errorf("Threshold() = %d, %s", attempts, window)
+	}
+	// Counting starts over in the new window
+	trigger.Check(attempt("192.0.2.1:4000", now))
+	a, ok := trigger.Check(attempt("192.0.2.1:4000", now))
+	if !ok || a.Message != "192.0.2.1 reached 2 attempts within 1m0s" {
+		t.Errorf("Unexpected alert after the change: %v, %+v", ok, a)
+	}
+}
+
+func TestThresholdTriggerAggregated(t *testing.T) {
+	trigger := NewThresholdTrigger(10, time.Hour)
+	event := attempt("192.0.2.1:4000", time.Now())
+	event.Set("count", 12)
+
+	a, ok := trigger.Check(event)
+	if !ok {
+		t.Fatal("Expected an aggregated event to reach the threshold")
+	}
+	if a.Message != "192.0.2.1 reached 12 attempts within 1h0m0s" {
+		t.Errorf("Unexpected message: %q", a.Message)
+	}
+}
+
+func TestSprayTrigger(t *testing.T) {
+	if _, ok := (SprayTrigger{}).Check(attempt("192.0.2.1:4000", time.Now())); ok {
+		t.Error("Expected no alert for an attempt")
+	}
+
+	event := &logger.Event{Type: "password_spray", Time: time.Now()}
+	event.Set("spray_type", "username")
+	event.Set("spray_value", "deploy")
+	event.Set("distinct_usernames", 1)
+	event.Set("distinct_sources", 25)
+	event.Set("sources", []string{"192.0.2.1", "192.0.2.2"})
+	a, ok := SprayTrigger{}.Check(event)
+	if !ok {
+		t.Fatal("Expected an alert")
+	}
+	if a.Rule != "password_spray" || a.Message != "Username spray: deploy tried from 25 sources" {
+		t.Errorf("Unexpected alert: %+v", a)
+	}
+	if a.Source != "" {
+		t.Errorf("Expected no single source, got %q", a.Source)
+	}
+}
+
+func TestSurgeTrigger(t *testing.T) {
+	event := &logger.Event{Type: "attack_surge", Time: time.Now()}
+	event.Set("attempts", 400)
+	event.Set("baseline", 12.5)
+	event.Set("interval_seconds", 60)
+	a, ok := SurgeTrigger{}.Check(event)
+	if !ok {
+		t.Fatal("Expected an alert")
+	}
+	if a.Rule != "attack_surge" || a.Message != "Attack surge: 400 attempts in 60s, baseline 12.5" {
+		t.Errorf("Unexpected alert: %+v", a)
+	}
+}
+
+func TestInternalSourceTrigger(t *testing.T) {
+	trigger := NewInternalSourceTrigger(PrivateNetworks)
+	if _, ok := trigger.Check(attempt("192.0.2.1:4000", time.Now())); ok {
+		t.Error("Expected no alert for an external source")
+	}
+	a, ok := trigger.Check(attempt("10.20.30.40:4000", time.Now()))
+	if !ok {
+		t.Fatal("Expected an alert for an internal source")
+	}
+	if a.Rule != "internal_source" || a.Severity != SeverityCritical || a.Source != "10.20.30.40" {
+		t.Errorf("Unexpected alert: %+v", a)
+	}
+}
+
+func TestInternalSourceAnonymized(t *testing.T) {
+	host := []netip.Prefix{netip.MustParsePrefix("10.20.30.40/32")}
+	for _, mode := range []string{privacy.IPCryptoPAn, privacy.IPTruncate} {
+		anonymizer, err := privacy.NewIPAnonymizer(mode, []byte("test-key"))
+		if err != nil {
+			t.Fatalf("Failed to create anonymizer: %v", err)
+		}
+		// Alerts get a copy of the event as logged
+		event := attempt("10.20.30.40:4000", time.Now())
+		anonymizer.Process(event)
+		event = event.Clone()
+
+		for name, trigger := range map[string]*InternalSourceTrigger{
+			"private": NewInternalSourceTrigger(PrivateNetworks),
+			"host":    NewInternalSourceTrigger(host),
+		} {
+			a, ok := trigger.Check(event)
+			if !ok {
+				t.Errorf("%s: expected an alert for the %s network", mode, name)
+				continue
+			}
+			if a.Source == "10.20.30.40" || strings.Contains(a.Message, "10.20.30.40") {
+				t.Errorf("%s: expected the anonymized source in the alert, got %s: %s", mode, a.Source, a.Message)
+			}
+		}
+
+		for _, field := range []string{SourceField, "remote_addr"} {
+			if !(Condition{Field: field, Networks: host}).Match(event) {
+				t.Errorf("%s: expected the condition on %s to match the address before anonymization", mode, field)
+			}
+		}
+	}
+}
@@ -0,0 +1,669 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+// Package collector receives the events of remote sensors over mutually
+// authenticated TLS, so that the events of a fleet are logged in one place
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/rs/zerolog/log"
+)
+
+// EventsPath is the endpoint sensors post batches of events to, as JSON
+// lines, optionally gzip-compressed
+const EventsPath = "/v1/events"
+
+// SensorsPath is the endpoint listing the sensors, to which sensors POST
+// their registration
+const SensorsPath = "/v1/sensors"
+
+// SensorHeader carries the ID a sensor registered, for the events of a batch
+const SensorHeader = "Fakessh-Sensor-Id"
+
+// SensorField is the event field naming the sensor an event came from
+const SensorField = "sensor_id"
+
+// validSensorID matches the IDs sensors can register
+var validSensorID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,127}$`)
+
+// Identification errors
+var (
+	errNoCertificateName = errors.New("missing client certificate or certificate without a name")
+	errInvalidSensorID   = errors.New("invalid sensor ID")
+	errSensorIDTaken     = errors.New("sensor ID is registered with another certificate")
+)
+
+// Config contains settings of the collector server
+type Config struct {
+	// Address of the HTTPS listener, e.g. ":8443"
+	Listen string
+	// Server certificate and private key (PEM)
+	CertFile string
+	KeyFile  string
+	// CA certificates (PEM) the client certificates of sensors must chain to
+	ClientCAFile string
+	// Largest accepted batch in bytes, after decompression
+	MaxBatchBytes int64
+	// Number of recent event keys remembered to drop events sent again
+	RecentIDs int
+	// Period within which the sources of events are correlated across the
+	// sensors of a tenant, 0 disables the correlation
+	CorrelationWindow time.Duration
+	// Largest number of sources followed by the correlation
+	MaxCorrelatedSources int
+	// Sources correlated on at least FleetSensors sensors of a tenant, or
+	// with at least FleetAttempts attempts across them, are listed for the
+	// sensors of the tenant; 0 disables a threshold
+	FleetSensors  int
+	FleetAttempts int
+	// What the sensors do with the listed sources, FleetDeny or FleetTarpit
+	FleetAction string
+	// Configuration profiles of the sensors, signed with ProfileKey
+	Profiles   []Profile
+	ProfileKey ed25519.PrivateKey
+	// Tenants sharing the collector, each with its own sensors and events
+	Tenants []Tenant
+}
+
+// Tenant is a customer of a shared collector. The events of its sensors are
+// logged apart from the others, and its API tokens only show its sensors and
+// events. Sensors belonging to no tenant are the operator's.
+type Tenant struct {
+	// Name of the tenant, shown with its sensors
+	Name string
+	// Patterns (as of path.Match) of the client certificate names of its
+	// sensors; a sensor belongs to the first tenant matching its certificate
+	Sensors []string
+	// Log records the events of its sensors
+	Log LogFunc
+	// Query API of its events, available if Query.Tokens is not empty
+	Query QueryConfig
+}
+
+// owns reports whether a sensor certificate belongs to the tenant
+func (t *Tenant) owns(certificate string) bool {
+	return matchesCertificate(t.Sensors, certificate)
+}
+
+// matchesCertificate reports whether a certificate name matches a pattern
+func matchesCertificate(patterns []string, certificate string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, certificate); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// LogFunc records an event received from a sensor
+type LogFunc func(event *logger.Event) error
+
+// Registration describes a sensor, sent by sensors when they connect
+type Registration struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Location string `json:"location,omitempty"`
+	Version  string `json:"version,omitempty"`
+}
+
+// Sensor describes a sensor that registered or sent events
+type Sensor struct {
+	Registration
+	// Tenant the sensor belongs to, empty for the operator
+	Tenant string `json:"tenant,omitempty"`
+	// Name of the client certificate of the sensor
+	Certificate string `json:"certificate"`
+	// Remote address of the last request
+	Address   string    `json:"address"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Events    int64     `json:"events"`
+}
+
+// Server is the collector HTTPS server
+type Server struct {
+	config Config
+	log    LogFunc
+	mux    *http.ServeMux
+	srv    *http.Server
+
+	tenants []*Tenant
+
+	mu sync.Mutex
+	// Sensors and certificate names by sensor key, the sensor ID within
+	// its tenant
+	sensors  map[string]*Sensor
+	bindings map[string]string
+	recent   *recentIDs
+	query    *QueryConfig
+
+	correlator *correlator
+}
+
+// New creates a collector server passing the received events to log
+func New(config Config, log LogFunc) (*Server, error) {
+	tlsConfig, err := serverTLS(config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		config:   config,
+		log:      log,
+		mux:      http.NewServeMux(),
+		sensors:  make(map[string]*Sensor),
+		bindings: make(map[string]string),
+		recent:   newRecentIDs(config.RecentIDs),
+	}
+	if config.CorrelationWindow > 0 {
+		s.correlator = newCorrelator(config.CorrelationWindow, config.MaxCorrelatedSources)
+	}
+	for i := range config.Tenants {
+		s.tenants = append(s.tenants, &config.Tenants[i])
+	}
+	s.mux.HandleFunc("POST "+EventsPath, s.handleEvents)
+	s.mux.HandleFunc("GET "+SensorsPath, s.handleSensors)
+	s.mux.HandleFunc("POST "+SensorsPath, s.handleRegister)
+	s.mux.HandleFunc("GET "+FleetPath, s.handleFleet)
+	s.mux.HandleFunc("GET "+ProfilePath, s.handleProfile)
+	s.srv = &http.Server{
+		Handler:           s.mux,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+// serverTLS loads the server certificate and requires client certificates
+// issued by the client CA
+func serverTLS(config Config) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("collector certificate loading error: %w", err)
+	}
+	data, err := os.ReadFile(config.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("collector client CA loading error: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("collector client CA loading error: no certificates in %s", config.ClientCAFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Handle registers an additional endpoint
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Start binds the listener and serves requests in the background
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		return fmt.Errorf("collector start error: %w", err)
+	}
+	log.Info().Str("listen", ln.Addr().String()).Msg("collector started")
+
+	go func() {
+		if err := s.srv.ServeTLS(ln, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("collector error")
+		}
+	}()
+	return nil
+}
+
+// Close stops the server, waiting for batches being received
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
+
+// Sensors returns the sensors that sent events, ordered by tenant and ID
+func (s *Server) Sensors() []Sensor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sensors := make([]Sensor, 0, len(s.sensors))
+	for _, sensor := range s.sensors {
+		sensors = append(sensors, *sensor)
+	}
+	sort.Slice(sensors, func(i, j int) bool {
+		if sensors[i].Tenant != sensors[j].Tenant {
+			return sensors[i].Tenant < sensors[j].Tenant
+		}
+		return sensors[i].ID < sensors[j].ID
+	})
+	return sensors
+}
+
+// tenantOf returns the tenant a sensor certificate belongs to, nil for
+// the operator
+func (s *Server) tenantOf(certificate string) *Tenant {
+	for _, t := range s.tenants {
+		if t.owns(certificate) {
+			return t
+		}
+	}
+	return nil
+}
+
+// tenantName returns the name of a tenant, empty for the operator
+func tenantName(t *Tenant) string {
+	if t == nil {
+		return ""
+	}
+	return t.Name
+}
+
+// sensorKey identifies a sensor within its tenant, so that tenants can not
+// take each other's sensor IDs
+func sensorKey(t *Tenant, id string) string {
+	if t == nil {
+		return id
+	}
+	return t.Name + "/" + id
+}
+
+// CertificateName returns the name of the client certificate of a request:
+// its common name, or its first DNS name
+func CertificateName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+// BatchResponse is the response to a batch of events. The first Accepted
+// events are logged, or were logged before and are among the Duplicates;
+// the others are to be sent again.
+type BatchResponse struct {
+	Accepted   int    `json:"accepted"`
+	Duplicates int    `json:"duplicates,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// handleEvents logs a batch of events tagged with the sensor that sent it,
+// with the log of its tenant. Batches with an invalid record are rejected
+// as a whole. Events recently logged for the sensor, by ID or by content
+// for events without one, are dropped, so that batches can be sent again
+// after a lost response. Events still being logged for an earlier request
+// stop the batch, so that the sensor sends them again once that request is
+// done. The others are correlated with the events of the other sensors of
+// the tenant.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	tenant, sensorID, err := s.identify(r, r.Header.Get(SensorHeader))
+	if err != nil {
+		writeJSON(w, identifyStatus(err), BatchResponse{Error: err.Error()})
+		return
+	}
+
+	events, err := s.readBatch(w, r)
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeJSON(w, status, BatchResponse{Error: err.Error()})
+		return
+	}
+
+	logEvent := s.log
+	if tenant != nil {
+		logEvent = tenant.Log
+	}
+	var resp BatchResponse
+	for _, event := range events {
+		key := sensorKey(tenant, sensorID) + "/" + eventKey(event)
+		switch s.recent.reserve(key) {
+		case keyLogged:
+			resp.Accepted++
+			resp.Duplicates++
+			continue
+		case keyPending:
+			s.seen(tenant, sensorID, r, resp.Accepted-resp.Duplicates)
+			resp.Error = "events are being logged for an earlier request"
+			writeJSON(w, http.StatusServiceUnavailable, resp)
+			return
+		}
+		event.Set(SensorField, sensorID)
+		if s.correlator != nil {
+			s.correlator.observe(tenant, sensorID, event)
+		}
+		if err := logEvent(event); err != nil {
+			s.recent.release(key)
+			log.Error().Err(err).Str("tenant", tenantName(tenant)).Str("sensor", sensorID).Msg("collected event logging error")
+			s.seen(tenant, sensorID, r, resp.Accepted-resp.Duplicates)
+			resp.Error = "events could not be logged"
+			writeJSON(w, http.StatusServiceUnavailable, resp)
+			return
+		}
+		s.recent.commit(key)
+		resp.Accepted++
+	}
+	s.seen(tenant, sensorID, r, resp.Accepted-resp.Duplicates)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// readBatch parses the events of a request body
+func (s *Server) readBatch(w http.ResponseWriter, r *http.Request) ([]*logger.Event, error) {
+	body, err := logger.Decompress(http.MaxBytesReader(w, r.Body, s.config.MaxBatchBytes))
+	if err != nil {
+		return nil, err
+	}
+	// Compressed batches are limited after decompression too
+	data, err := io.ReadAll(&limitedReader{r: body, max: s.config.MaxBatchBytes})
+	if err != nil {
+		return nil, err
+	}
+	reader, err := logger.NewReader(bytes.NewReader(data), logger.TimeFormat{})
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*logger.Event
+	for {
+		event, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+}
+
+// limitedReader fails with an http.MaxBytesError once more than max bytes
+// are read
+type limitedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, &http.MaxBytesError{Limit: l.max}
+	}
+	return n, err
+}
+
+// eventKey identifies an event among those of its sensor: its ID, or a hash
+// of its content for events without one
+func eventKey(event *logger.Event) string {
+	if event.ID != "" {
+		return event.ID
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%s\x00%s", event.Time.UnixNano(), event.Type, event.Message)
+	for _, f := range event.Fields {
+		fmt.Fprintf(h, "\x00%s=%v", f.Key, f.Value)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// States of keys in recentIDs
+const (
+	// keyReserved is a key that was not seen and is now reserved
+	keyReserved = iota
+	// keyPending is a key reserved by a request still logging its event
+	keyPending
+	// keyLogged is a key whose event was logged
+	keyLogged
+)
+
+// recentIDs is a set of the last reserved keys. It is kept in memory, so
+// events are recognized as sent again only within its size and until the
+// collector restarts.
+type recentIDs struct {
+	mu      sync.Mutex
+	keys    map[string]int
+	pending map[string]struct{}
+	ring    []string
+	next    int
+}
+
+func newRecentIDs(size int) *recentIDs {
+	return &recentIDs{
+		keys:    make(map[string]int, size),
+		pending: make(map[string]struct{}),
+		ring:    make([]string, size),
+	}
+}
+
+// reserve inserts a key unless it is already in the set, and returns the
+// state it was in. The oldest key is evicted when the set is full. A
+// reserved key is pending until it is committed or released.
+func (r *recentIDs) reserve(key string) int {
+	if len(r.ring) == 0 {
+		return keyReserved
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[key]; ok {
+		if _, ok := r.pending[key]; ok {
+			return keyPending
+		}
+		return keyLogged
+	}
+	if old := r.ring[r.next]; old != "" {
+		delete(r.keys, old)
+		delete(r.pending, old)
+	}
+	r.ring[r.next] = key
+	r.keys[key] = r.next
+	r.pending[key] = struct{}{}
+	r.next = (r.next + 1) % len(r.ring)
+	return keyReserved
+}
+
+// commit marks the event of a reserved key as logged
+func (r *recentIDs) commit(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, key)
+}
+
+// release removes a reserved key whose event could not be logged, so that
+// it is accepted when sent again
+func (r *recentIDs) release(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.pending[key]; !ok {
+		return
+	}
+	r.ring[r.keys[key]] = ""
+	delete(r.keys, key)
+	delete(r.pending, key)
+}
+
+// identify returns the tenant and the ID of the sensor that sent a request:
+// the ID it claims, bound to its certificate on first use, or the
+// certificate name. The bindings are kept in memory, sensors claim their ID
+// again with every batch.
+func (s *Server) identify(r *http.Request, claimed string) (*Tenant, string, error) {
+	certificate := CertificateName(r)
+	if certificate == "" {
+		return nil, "", errNoCertificateName
+	}
+	id := certificate
+	if claimed != "" {
+		if !validSensorID.MatchString(claimed) {
+			return nil, "", errInvalidSensorID
+		}
+		id = claimed
+	}
+	tenant := s.tenantOf(certificate)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sensorKey(tenant, id)
+	if bound, ok := s.bindings[key]; ok && bound != certificate {
+		return nil, "", errSensorIDTaken
+	}
+	s.bindings[key] = certificate
+	// Other sensors cannot claim the certificate name either
+	if key := sensorKey(tenant, certificate); s.bindings[key] == "" {
+		s.bindings[key] = certificate
+	}
+	return tenant, id, nil
+}
+
+// identifyStatus returns the response status of an identification error
+func identifyStatus(err error) int {
+	switch err {
+	case errNoCertificateName:
+		return http.StatusForbidden
+	case errSensorIDTaken:
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// sensor returns the record of a sensor, creating it if needed. The caller
+// holds the lock.
+func (s *Server) sensor(tenant *Tenant, id string, r *http.Request) *Sensor {
+	key := sensorKey(tenant, id)
+	sensor, ok := s.sensors[key]
+	if !ok {
+		sensor = &Sensor{
+			Registration: Registration{ID: id},
+			Tenant:       tenantName(tenant),
+			Certificate:  CertificateName(r),
+			FirstSeen:    time.Now(),
+		}
+		s.sensors[key] = sensor
+	}
+	sensor.Address = r.RemoteAddr
+	sensor.LastSeen = time.Now()
+	return sensor
+}
+
+// seen records a batch of a sensor
+func (s *Server) seen(tenant *Tenant, id string, r *http.Request, events int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sensors[sensorKey(tenant, id)]; !ok {
+		log.Info().Str("tenant", tenantName(tenant)).Str("sensor", id).Str("address", r.RemoteAddr).Msg("sensor connected")
+	}
+	s.sensor(tenant, id, r).Events += int64(events)
+}
+
+// handleRegister records the description of a sensor
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var reg Registration
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&reg); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid registration"})
+		return
+	}
+	tenant, id, err := s.identify(r, reg.ID)
+	if err != nil {
+		writeJSON(w, identifyStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	sensor := s.sensor(tenant, id, r)
+	reg.ID = id
+	sensor.Registration = reg
+	registered := *sensor
+	s.mu.Unlock()
+
+	log.Info().
+		Str("tenant", registered.Tenant).
+		Str("sensor", id).
+		Str("name", reg.Name).
+		Str("location", reg.Location).
+		Str("version", reg.Version).
+		Str("certificate", registered.Certificate).
+		Str("address", r.RemoteAddr).
+		Msg("sensor registered")
+	writeJSON(w, http.StatusOK, registered)
+}
+
+// handleSensors lists the sensors to sensors and API clients. Sensors see
+// the sensors of their tenant, clients of a tenant those of the tenant, and
+// the operator sees all of them.
+func (s *Server) handleSensors(w http.ResponseWriter, r *http.Request) {
+	var tenant *Tenant
+	all := false
+	if certificate := CertificateName(r); certificate != "" {
+		tenant = s.tenantOf(certificate)
+	} else if t, ok := s.tokenOwner(r); ok {
+		tenant, all = t, t == nil
+	} else {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing client certificate or API token"})
+		return
+	}
+
+	sensors := s.Sensors()
+	if !all {
+		name := tenantName(tenant)
+		sensors = slices.DeleteFunc(sensors, func(sensor Sensor) bool { return sensor.Tenant != name })
+	}
+	writeJSON(w, http.StatusOK, sensors)
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debug().Err(err).Msg("collector response write error")
+	}
+}
@@ -0,0 +1,596 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// testPKI is a CA issuing the certificates of a test collector and its sensors
+type testPKI struct {
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	p := &testPKI{dir: t.TempDir(), cert: cert, key: key, pool: pool}
+	p.write(t, "ca.pem", "CERTIFICATE", der)
+	return p
+}
+
+func (p *testPKI) write(t *testing.T, name, kind string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(p.dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issue returns a certificate for the common name, usable by servers on
+// 127.0.0.1 and by clients
+func (p *testPKI) issue(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.cert, &key.PublicKey, p.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.LoadX509KeyPair(
+		p.write(t, name+".pem", "CERTIFICATE", der),
+		p.write(t, name+".key", "EC PRIVATE KEY", keyDER),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// eventLog records the events passed to the collector
+type eventLog struct {
+	mu     sync.Mutex
+	events []*logger.Event
+	fail   bool
+}
+
+func (l *eventLog) log(event *logger.Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fail {
+		return errors.New("sinks failing")
+	}
+	l.events = append(l.events, event)
+	return nil
+}
+
+// startCollector serves a collector over TLS, returning its URL and a client
+// authenticated as the sensor
+func startCollector(t *testing.T, pki *testPKI, log LogFunc, sensor string) (*Server, string, *http.Client) {
+	t.Helper()
+	pki.issue(t, "collector")
+	s, err := New(Config{
+		CertFile:      filepath.Join(pki.dir, "collector.pem"),
+		KeyFile:       filepath.Join(pki.dir, "collector.key"),
+		ClientCAFile:  filepath.Join(pki.dir, "ca.pem"),
+		MaxBatchBytes: 1024,
+		RecentIDs:     10,
+	}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(s.mux)
+	ts.TLS = s.srv.TLSConfig
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	clientTLS := &tls.Config{RootCAs: pki.pool}
+	if sensor != "" {
+		clientTLS.Certificates = []tls.Certificate{pki.issue(t, sensor)}
+	}
+	return s, ts.URL, &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+}
+
+const testBatch = `{"time":"2024-01-15T10:00:00.5Z","event":"auth_attempt","event_id":"0191","remote_addr":"1.2.3.4:5","username":"root","password":"x","sensor_id":"spoofed"}
+{"time":"2024-01-15T10:00:01Z","event":"auth_attempt","remote_addr":"1.2.3.4:6","username":"admin","password":"y"}
+`
+
+func TestCollectorEvents(t *testing.T) {
+	pki := newTestPKI(t)
+	events := &eventLog{}
+	s, url, client := startCollector(t, pki, events.log, "sensor-1")
+
+	resp, err := client.Post(url+EventsPath, "application/x-ndjson", strings.NewReader(testBatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result BatchResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || result.Accepted != 2 {
+		t.Fatalf("Expected 2 accepted events, got %d %+v", resp.StatusCode, result)
+	}
+
+	if len(events.events) != 2 {
+		t.Fatalf("Expected 2 logged events, got %d", len(events.events))
+	}
+	first := events.events[0]
+	if first.ID != "0191" || first.GetString("username") != "root" || !first.Time.Equal(time.Date(2024, 1, 15, 10, 0, 0, 5e8, time.UTC)) {
+		t.Errorf("Unexpected event: %+v", first)
+	}
+	for _, event := range events.events {
+		if got := event.GetString(SensorField); got != "sensor-1" {
+			t.Errorf("Expected sensor from the certificate, got '%s'", got)
+		}
+	}
+
+	sensors := s.Sensors()
+	if len(sensors) != 1 || sensors[0].ID != "sensor-1" || sensors[0].Events != 2 {
+		t.Errorf("Unexpected sensors: %+v", sensors)
+	}
+}
+
+func TestCollectorRegistration(t *testing.T) {
+	pki := newTestPKI(t)
+	events := &eventLog{}
+	s, url, client := startCollector(t, pki, events.log, "sensor-1")
+
+	reg := `{"id":"0c1f6d2e-honeypot","name":"Frankfurt 1","location":"fra1","version":"v1.5.0"}`
+	resp, err := client.Post(url+SensorsPath, "application/json", strings.NewReader(reg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected registration, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, url+EventsPath, strings.NewReader(testBatch))
+	req.Header.Set(SensorHeader, "0c1f6d2e-honeypot")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := events.events[0].GetString(SensorField); got != "0c1f6d2e-honeypot" {
+		t.Errorf("Expected the registered sensor ID, got '%s'", got)
+	}
+
+	sensors := s.Sensors()
+	if len(sensors) != 1 || sensors[0].Name != "Frankfurt 1" || sensors[0].Location != "fra1" ||
+		sensors[0].Certificate != "sensor-1" || sensors[0].Events != 2 {
+		t.Errorf("Unexpected sensors: %+v", sensors)
+	}
+}
+
+func TestCollectorSensorIDConflict(t *testing.T) {
+	pki := newTestPKI(t)
+	events := &eventLog{}
+	_, url, client := startCollector(t, pki, events.log, "sensor-1")
+	other := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      pki.pool,
+		Certificates: []tls.Certificate{pki.issue(t, "sensor-2")},
+	}}}
+
+	tests := []struct {
+		name    string
+		client  *http.Client
+		claimed string
+		status  int
+	}{
+		{"First claim", client, "fra1", http.StatusOK},
+		{"Claim of another certificate", other, "fra1", http.StatusConflict},
+		{"Certificate name of another sensor", other, "sensor-1", http.StatusConflict},
+		{"Invalid ID", other, "fra 1", http.StatusBadRequest},
+		{"Own certificate name", other, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, url+EventsPath, strings.NewReader(testBatch))
+			req.Header.Set(SensorHeader, tt.claimed)
+			resp, err := tt.client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestCollectorDuplicates(t *testing.T) {
+	pki := newTestPKI(t)
+	events := &eventLog{}
+	_, url, client := startCollector(t, pki, events.log, "sensor-1")
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(url+EventsPath, "application/x-ndjson", strings.NewReader(testBatch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result BatchResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if result.Accepted != 2 || result.Duplicates != 2*i {
+			t.Errorf("Unexpected response to batch %d: %+v", i, result)
+		}
+	}
+	// The event without ID is recognized by its content
+	if len(events.events) != 2 {
+		t.Errorf("Expected the events to be logged once, got %d events", len(events.events))
+	}
+}
+
+func TestEventKey(t *testing.T) {
+	event := &logger.Event{Time: time.Unix(1700000000, 0), Type: "auth_attempt", Fields: []logger.Field{{Key: "username", Value: "root"}}}
+	key := eventKey(event)
+	if !strings.HasPrefix(key, "sha256:") || eventKey(event.Clone()) != key {
+		t.Errorf("Expected a stable content key, got '%s'", key)
+	}
+	other := event.Clone()
+	other.Set("username", "admin")
+	if eventKey(other) == key {
+		t.Errorf("Expected events with other fields to have other keys")
+	}
+	event.ID = "0191"
+	if eventKey(event) != "0191" {
+		t.Errorf("Expected the ID as key of events with one")
+	}
+}
+
+func TestRecentIDs(t *testing.T) {
+	r := newRecentIDs(2)
+	for _, key := range []string{"a", "b", "c"} {
+		if r.reserve(key) != keyReserved {
+			t.Errorf("Expected %s to be reserved", key)
+		}
+		r.commit(key)
+	}
+	if r.reserve("b") != keyLogged || r.reserve("c") != keyLogged {
+		t.Errorf("Expected the last keys to be logged")
+	}
+	if r.reserve("a") != keyReserved {
+		t.Errorf("Expected the oldest key to be evicted")
+	}
+
+	// Reserved keys are pending until committed, released keys are free
+	if r.reserve("a") != keyPending {
+		t.Errorf("Expected a reserved key to be pending")
+	}
+	r.release("a")
+	if r.reserve("a") != keyReserved {
+		t.Errorf("Expected a released key to be reserved again")
+	}
+}
+
+func TestCollectorResentWhileLogging(t *testing.T) {
+	pki := newTestPKI(t)
+	events := &eventLog{}
+	logging, stalled := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	logEvent := func(event *logger.Event) error {
+		// The first event stalls until the batch was sent again
+		once.Do(func() {
+			close(logging)
+			<-stalled
+		})
+		return events.log(event)
+	}
+	_, url, client := startCollector(t, pki, logEvent, "sensor-1")
+
+	post := func() (int, BatchResponse) {
+		resp, err := client.Post(url+EventsPath, "application/x-ndjson", strings.NewReader(testBatch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var result BatchResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	first := make(chan BatchResponse)
+	go func() {
+		_, result := post()
+		first <- result
+	}()
+	<-logging
+	if status, result := post(); status != http.StatusServiceUnavailable || result.Accepted != 0 {
+		t.Errorf("Expected the batch sent again to wait for the first one, got %d: %+v", status, result)
+	}
+	close(stalled)
+	if result := <-first; result.Accepted != 2 || result.Duplicates != 0 {
+		t.Errorf("Unexpected response to the first batch: %+v", result)
+	}
+	if status, result := post(); status != http.StatusOK || result.Duplicates != 2 {
+		t.Errorf("Expected the batch to be dropped as duplicate, got %d: %+v", status, result)
+	}
+	if len(events.events) != 2 {
+		t.Errorf("Expected the events to be logged once, got %d events", len(events.events))
+	}
+}
+
+func TestCollectorLoggingError(t *testing.T) {
+	pki := newTestPKI(t)
+	events := &eventLog{fail: true}
+	_, url, client := startCollector(t, pki, events.log, "sensor-1")
+
+	for _, fail := range []bool{true, false} {
+		events.mu.Lock()
+		events.fail = fail
+		events.mu.Unlock()
+		resp, err := client.Post(url+EventsPath, "application/x-ndjson", strings.NewReader(testBatch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		expected := http.StatusOK
+		if fail {
+			expected = http.StatusServiceUnavailable
+		}
+		if resp.StatusCode != expected {
+			t.Errorf("Expected status %d, got %d", expected, resp.StatusCode)
+		}
+	}
+	// Events that failed are logged when sent again
+	if len(events.events) != 2 {
+		t.Errorf("Expected the events to be logged when sent again, got %d events", len(events.events))
+	}
+}
+
+func TestCollectorCompressedBatch(t *testing.T) {
+	pki := newTestPKI(t)
+	events := &eventLog{}
+	_, url, client := startCollector(t, pki, events.log, "sensor-1")
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(testBatch))
+	gz.Close()
+	req, _ := http.NewRequest(http.MethodPost, url+EventsPath, &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(events.events) != 2 {
+		t.Errorf("Expected compressed batch to be logged, got %d and %d events", resp.StatusCode, len(events.events))
+	}
+}
+
+func TestCollectorRejectsBatches(t *testing.T) {
+	pki := newTestPKI(t)
+	events := &eventLog{}
+	_, url, client := startCollector(t, pki, events.log, "sensor-1")
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"Invalid record", testBatch + "not json\n", http.StatusBadRequest},
+		{"Too large", strings.Repeat(testBatch, 10), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Post(url+EventsPath, "application/x-ndjson", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+	if len(events.events) != 0 {
+		t.Errorf("Expected rejected batches not to be logged, got %d events", len(events.events))
+	}
+}
+
+func TestCollectorLoggingFailure(t *testing.T) {
+	pki := newTestPKI(t)
+	events := &eventLog{fail: true}
+	_, url, client := startCollector(t, pki, events.log, "sensor-1")
+
+	resp, err := client.Post(url+EventsPath, "application/x-ndjson", strings.NewReader(testBatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result BatchResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || result.Accepted != 0 {
+		t.Errorf("Expected unavailable collector, got %d %+v", resp.StatusCode, result)
+	}
+}
+
+func TestCollectorRequiresClientCertificate(t *testing.T) {
+	pki := newTestPKI(t)
+	events := &eventLog{}
+	_, url, client := startCollector(t, pki, events.log, "")
+
+	if resp, err := client.Post(url+EventsPath, "application/x-ndjson", strings.NewReader(testBatch)); err == nil {
+		resp.Body.Close()
+		t.Errorf("Expected handshake failure without client certificate, got %d", resp.StatusCode)
+	}
+	if len(events.events) != 0 {
+		t.Errorf("Expected no logged events, got %d", len(events.events))
+	}
+}
+
+func TestNewInvalidCA(t *testing.T) {
+	pki := newTestPKI(t)
+	pki.issue(t, "collector")
+	empty := filepath.Join(pki.dir, "empty.pem")
+	os.WriteFile(empty, nil, 0600)
+
+	_, err := New(Config{
+		CertFile:     filepath.Join(pki.dir, "collector.pem"),
+		KeyFile:      filepath.Join(pki.dir, "collector.key"),
+		ClientCAFile: empty,
+	}, (&eventLog{}).log)
+	if err == nil {
+		t.Errorf("Expected error for client CA without certificates")
+	}
+}
+
+func TestCollectorTenants(t *testing.T) {
+	pki := newTestPKI(t)
+	pki.issue(t, "collector")
+	dir := t.TempDir()
+	operatorLog, acmeLog := filepath.Join(dir, "fleet.log"), filepath.Join(dir, "acme.log")
+	os.WriteFile(operatorLog, []byte(`{"time":"2024-01-15T10:00:00Z","event":"auth_attempt","event_id":"op1","sensor_id":"fra1"}`+"\n"), 0600)
+	os.WriteFile(acmeLog, []byte(`{"time":"2024-01-15T10:00:00Z","event":"auth_attempt","event_id":"acme1","sensor_id":"fra1"}`+"\n"), 0600)
+
+	operator, acme := &eventLog{}, &eventLog{}
+	s, err := New(Config{
+		CertFile:      filepath.Join(pki.dir, "collector.pem"),
+		KeyFile:       filepath.Join(pki.dir, "collector.key"),
+		ClientCAFile:  filepath.Join(pki.dir, "ca.pem"),
+		MaxBatchBytes: 1024,
+		RecentIDs:     10,
+		Tenants: []Tenant{{
+			Name:    "acme",
+			Sensors: []string{"acme-*"},
+			Log:     acme.log,
+			Query: QueryConfig{
+				Tokens: []string{"acme-secret"},
+				Logs:   func(time.Time) ([]string, error) { return []string{acmeLog}, nil },
+			},
+		}},
+	}, operator.log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.EnableQuery(QueryConfig{
+		Tokens: []string{"secret"},
+		Logs:   func(time.Time) ([]string, error) { return []string{operatorLog}, nil },
+	})
+	ts := httptest.NewUnstartedServer(s.mux)
+	ts.TLS = s.srv.TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	newClient := func(certificate string) *http.Client {
+		clientTLS := &tls.Config{RootCAs: pki.pool}
+		if certificate != "" {
+			clientTLS.Certificates = []tls.Certificate{pki.issue(t, certificate)}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+	}
+	operatorSensor, acmeSensor, apiClient := newClient("sensor-1"), newClient("acme-fra1"), newClient("")
+
+	// Both sensors claim the same ID, within their own tenant
+	for _, client := range []*http.Client{operatorSensor, acmeSensor} {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+EventsPath, strings.NewReader(testBatch))
+		req.Header.Set(SensorHeader, "fra1")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected the batch to be accepted, got %d", resp.StatusCode)
+		}
+	}
+	if len(operator.events) != 2 || len(acme.events) != 2 {
+		t.Errorf("Expected 2 events in each partition, got %d and %d", len(operator.events), len(acme.events))
+	}
+
+	sensorsOf := func(client *http.Client, token string) []string {
+		var sensors []Sensor
+		if status := get(t, client, ts.URL+SensorsPath, token, &sensors); status != http.StatusOK {
+			t.Fatalf("Expected sensors, got %d", status)
+		}
+		var names []string
+		for _, sensor := range sensors {
+			names = append(names, sensor.Tenant+"/"+sensor.ID)
+		}
+		return names
+	}
+	if got := strings.Join(sensorsOf(apiClient, "secret"), ","); got != "/fra1,acme/fra1" {
+		t.Errorf("Operator sensors: %s", got)
+	}
+	if got := strings.Join(sensorsOf(apiClient, "acme-secret"), ","); got != "acme/fra1" {
+		t.Errorf("Tenant sensors: %s", got)
+	}
+	if got := strings.Join(sensorsOf(operatorSensor, ""), ","); got != "/fra1" {
+		t.Errorf("Sensors seen by an operator sensor: %s", got)
+	}
+
+	var page EventPage
+	get(t, apiClient, ts.URL+EventsPath, "acme-secret", &page)
+	if ids := eventIDs(page); len(ids) != 1 || ids[0] != "acme1" {
+		t.Errorf("Expected the events of the tenant, got %v", ids)
+	}
+	get(t, apiClient, ts.URL+EventsPath, "secret", &page)
+	if ids := eventIDs(page); len(ids) != 1 || ids[0] != "op1" {
+		t.Errorf("Expected the events of the operator, got %v", ids)
+	}
+	if status := get(t, apiClient, ts.URL+StreamPath, "acme-secret", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 without a stream, got %d", status)
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package collector
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/rs/zerolog/log"
+)
+
+// Fields the collector adds to the events of sources seen on several sensors
+const (
+	// Number of sensors of the tenant that saw the source within the window
+	SeenOnField = "seen_on_sensors"
+	// ID shared by the events of the sources attacking several sensors
+	FleetCampaignField = "fleet_campaign_id"
+	// Campaign ID a sensor attached to the event
+	campaignField = "campaign_id"
+)
+
+// correlator follows the sources of events across the sensors of a tenant.
+// A source seen by a second sensor within the window starts a fleet
+// campaign, which the other sources of the sensor campaigns it belongs to
+// join as well.
+type correlator struct {
+	window     time.Duration
+	maxSources int
+
+	mu        sync.Mutex
+	sources   map[string]*fleetSource
+	campaigns map[string]*fleetCampaign
+	swept     time.Time
+	full      bool
+	// Time of the latest event, the clock of the correlation
+	latest time.Time
+}
+
+// fleetSource is a source address of a tenant
+type fleetSource struct {
+	// Last time each sensor saw the source
+	sensors map[string]time.Time
+	// Sensor campaigns the source belongs to
+	locals map[string]struct{}
+	// Authentication attempts since the source was first seen
+	attempts int
+	last     time.Time
+	campaign *fleetCampaign
+}
+
+// fleetCampaign links sensor campaigns across the fleet
+type fleetCampaign struct {
+	id   string
+	last time.Time
+}
+
+func newCorrelator(window time.Duration, maxSources int) *correlator {
+	return &correlator{
+		window:     window,
+		maxSources: maxSources,
+		sources:    make(map[string]*fleetSource),
+		campaigns:  make(map[string]*fleetCampaign),
+	}
+}
+
+// observe records the event of a sensor and adds the number of sensors that
+// saw its source and, if any, its fleet campaign. Events without a source
+// address are left as they are.
+func (c *correlator) observe(tenant *Tenant, sensorID string, event *logger.Event) {
+	host, _, err := net.SplitHostPort(event.GetString("remote_addr"))
+	if err != nil || host == "" {
+		return
+	}
+	at := event.Time
+	prefix := tenantName(tenant) + "/"
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweep(at)
+	if at.After(c.latest) {
+		c.latest = at
+	}
+
+	src, ok := c.sources[prefix+host]
+	if !ok {
+		if len(c.sources) >= c.maxSources {
+			if !c.full {
+				log.Warn().Int("max_sources", c.maxSources).Msg("correlated sources limit reached, new sources are not correlated")
+				c.full = true
+			}
+			return
+		}
+		src = &fleetSource{sensors: make(map[string]time.Time), locals: make(map[string]struct{})}
+		c.sources[prefix+host] = src
+	}
+	if at.After(src.sensors[sensorID]) {
+		src.sensors[sensorID] = at
+	}
+	if at.After(src.last) {
+		src.last = at
+	}
+	if event.Type == "auth_attempt" {
+		src.attempts++
+	}
+	seenOn := src.seenOn(at, c.window)
+
+	// Sources join the fleet campaign of their sensor campaign, or start one
+	// once a second sensor sees them
+	local := event.GetString(campaignField)
+	if local != "" {
+		local = prefix + sensorID + "/" + local
+		src.locals[local] = struct{}{}
+	}
+	if src.campaign == nil || at.Sub(src.campaign.last) >= c.window {
+		src.campaign = nil
+		if camp, ok := c.campaigns[local]; ok && at.Sub(camp.last) < c.window {
+			src.campaign = camp
+		} else if seenOn > 1 {
+			src.campaign = &fleetCampaign{id: fleetCampaignID(prefix+host, at)}
+			log.Debug().Str("fleet_campaign_id", src.campaign.id).Str("tenant", tenantName(tenant)).Str("ip", host).Msg("fleet campaign started")
+		}
+	}
+	if src.campaign != nil {
+		if at.After(src.campaign.last) {
+			src.campaign.last = at
+		}
+		for local := range src.locals {
+			c.campaigns[local] = src.campaign
+		}
+		event.Set(FleetCampaignField, src.campaign.id)
+	}
+	event.Set(SeenOnField, seenOn)
+}
+
+// seenOn returns the number of sensors that saw the source within the
+// window before a time
+func (src *fleetSource) seenOn(at time.Time, window time.Duration) int {
+	n := 0
+	for _, last := range src.sensors {
+		if at.Sub(last) < window {
+			n++
+		}
+	}
+	return n
+}
+
+// listed returns the addresses of the sources of a tenant seen within the
+// window on at least minSensors sensors or with at least minAttempts
+// attempts, sorted; 0 disables a threshold
+func (c *correlator) listed(tenant *Tenant, minSensors, minAttempts int) []string {
+	prefix := tenantName(tenant) + "/"
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var addrs []netip.Addr
+	for key, src := range c.sources {
+		host, ok := strings.CutPrefix(key, prefix)
+		if !ok || c.latest.Sub(src.last) >= c.window {
+			continue
+		}
+		if (minSensors > 0 && src.seenOn(c.latest, c.window) >= minSensors) ||
+			(minAttempts > 0 && src.attempts >= minAttempts) {
+			if addr, err := netip.ParseAddr(host); err == nil {
+				addrs = append(addrs, addr.Unmap())
+			}
+		}
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+	listed := make([]string, len(addrs))
+	for i, addr := range addrs {
+		listed[i] = addr.String()
+	}
+	return listed
+}
+
+// sweep forgets the sources and campaigns not seen within the window, at
+// most once per window
+func (c *correlator) sweep(now time.Time) {
+	if now.Sub(c.swept) < c.window {
+		return
+	}
+	for key, src := range c.sources {
+		if now.Sub(src.last) >= c.window {
+			delete(c.sources, key)
+		}
+	}
+	for key, camp := range c.campaigns {
+		if now.Sub(camp.last) >= c.window {
+			delete(c.campaigns, key)
+		}
+	}
+	c.swept = now
+	c.full = false
+}
+
+// fleetCampaignID derives the ID of a fleet campaign from the source that
+// started it
+func fleetCampaignID(source string, first time.Time) string {
+	h := fnv.New64a()
+	fmt.Fprint(h, source, first.UnixNano())
+	return fmt.Sprintf("fleet-%016x", h.Sum64())
+}
@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func attempt(at time.Time, addr, campaign string) *logger.Event {
+	event := &logger.Event{Time: at, Type: "auth_attempt", Fields: []logger.Field{{Key: "remote_addr", Value: addr}}}
+	if campaign != "" {
+		event.Set(campaignField, campaign)
+	}
+	return event
+}
+
+func TestCorrelatorSeenOn(t *testing.T) {
+	c := newCorrelator(time.Hour, 100)
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	first := attempt(start, "1.2.3.4:5", "")
+	c.observe(nil, "fra1", first)
+	if v, _ := first.Get(SeenOnField); v != 1 {
+		t.Errorf("Expected the source to be seen on 1 sensor, got %v", v)
+	}
+	if first.GetString(FleetCampaignField) != "" {
+		t.Errorf("Expected no fleet campaign for a single sensor")
+	}
+
+	second := attempt(start.Add(time.Minute), "1.2.3.4:6", "")
+	c.observe(nil, "ams1", second)
+	if v, _ := second.Get(SeenOnField); v != 2 {
+		t.Errorf("Expected the source to be seen on 2 sensors, got %v", v)
+	}
+	id := second.GetString(FleetCampaignField)
+	if id == "" {
+		t.Fatalf("Expected a fleet campaign for a source seen on 2 sensors")
+	}
+	third := attempt(start.Add(2*time.Minute), "1.2.3.4:7", "")
+	c.observe(nil, "fra1", third)
+	if third.GetString(FleetCampaignField) != id {
+		t.Errorf("Expected the fleet campaign to be kept")
+	}
+
+	// Sources of other tenants are not correlated
+	acme := &Tenant{Name: "acme"}
+	other := attempt(start.Add(2*time.Minute), "1.2.3.4:8", "")
+	c.observe(acme, "ams1", other)
+	if v, _ := other.Get(SeenOnField); v != 1 || other.GetString(FleetCampaignField) != "" {
+		t.Errorf("Expected sources to be correlated within tenants, got %+v", other.Fields)
+	}
+
+	// Sensors that did not see the source within the window are not counted
+	late := attempt(start.Add(2*time.Hour), "1.2.3.4:9", "")
+	c.observe(nil, "ams1", late)
+	if v, _ := late.Get(SeenOnField); v != 1 || late.GetString(FleetCampaignField) != "" {
+		t.Errorf("Expected the correlation to expire, got %+v", late.Fields)
+	}
+}
+
+func TestCorrelatorCampaigns(t *testing.T) {
+	c := newCorrelator(time.Hour, 100)
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	c.observe(nil, "fra1", attempt(start, "1.2.3.4:5", "c1"))
+	shared := attempt(start.Add(time.Second), "1.2.3.4:6", "a7")
+	c.observe(nil, "ams1", shared)
+	id := shared.GetString(FleetCampaignField)
+	if id == "" {
+		t.Fatalf("Expected a fleet campaign")
+	}
+
+	// Other members of the sensor campaigns join the fleet campaign
+	for _, e := range []struct{ sensor, addr, campaign string }{
+		{"fra1", "5.6.7.8:1", "c1"},
+		{"ams1", "9.9.9.9:1", "a7"},
+	} {
+		event := attempt(start.Add(time.Minute), e.addr, e.campaign)
+		c.observe(nil, e.sensor, event)
+		if event.GetString(FleetCampaignField) != id {
+			t.Errorf("Expected %s of campaign %s to join the fleet campaign", e.addr, e.campaign)
+		}
+	}
+
+	// Campaign IDs are local to their sensor
+	unrelated := attempt(start.Add(time.Minute), "8.8.8.8:1", "c1")
+	c.observe(nil, "lon1", unrelated)
+	if unrelated.GetString(FleetCampaignField) != "" {
+		t.Errorf("Expected campaigns of other sensors not to be joined")
+	}
+}
+
+func TestCorrelatorLimit(t *testing.T) {
+	c := newCorrelator(time.Hour, 1)
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	c.observe(nil, "fra1", attempt(start, "1.2.3.4:5", ""))
+	dropped := attempt(start, "5.6.7.8:5", "")
+	c.observe(nil, "fra1", dropped)
+	if _, ok := dropped.Get(SeenOnField); ok {
+		t.Errorf("Expected sources over the limit not to be correlated")
+	}
+
+	// Expired sources make room
+	later := attempt(start.Add(2*time.Hour), "5.6.7.8:5", "")
+	c.observe(nil, "fra1", later)
+	if _, ok := later.Get(SeenOnField); !ok {
+		t.Errorf("Expected expired sources to be forgotten")
+	}
+
+	// Events without a source address are left alone
+	event := &logger.Event{Time: start, Type: "config_change"}
+	c.observe(nil, "fra1", event)
+	if len(event.Fields) != 0 {
+		t.Errorf("Unexpected fields: %+v", event.Fields)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package collector
+
+import (
+	"net/http"
+)
+
+// FleetPath is the endpoint sensors poll for the fleet-wide lists of their
+// tenant
+const FleetPath = "/v1/fleet"
+
+// Actions on the sources listed for the fleet
+const (
+	FleetDeny   = "deny"
+	FleetTarpit = "tarpit"
+)
+
+// Fleet contains the sources the sensors of a tenant are to deny or hold in
+// the tarpit, from the events of all of them
+type Fleet struct {
+	Denylist []string `json:"denylist"`
+	Tarpit   []string `json:"tarpit"`
+}
+
+// fleet returns the lists of the sensors of a tenant
+func (s *Server) fleet(tenant *Tenant) Fleet {
+	fleet := Fleet{Denylist: []string{}, Tarpit: []string{}}
+	c := s.config
+	if s.correlator == nil || (c.FleetSensors <= 0 && c.FleetAttempts <= 0) {
+		return fleet
+	}
+	listed := s.correlator.listed(tenant, c.FleetSensors, c.FleetAttempts)
+	if c.FleetAction == FleetTarpit {
+		fleet.Tarpit = listed
+	} else {
+		fleet.Denylist = listed
+	}
+	return fleet
+}
+
+// handleFleet returns the lists of the tenant of a sensor, or of the tenant
+// of an API token
+func (s *Server) handleFleet(w http.ResponseWriter, r *http.Request) {
+	var tenant *Tenant
+	if certificate := CertificateName(r); certificate != "" {
+		tenant = s.tenantOf(certificate)
+	} else if t, ok := s.tokenOwner(r); ok {
+		tenant = t
+	} else {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing client certificate or API token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.fleet(tenant))
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getFleet(t *testing.T, client *http.Client, url string) Fleet {
+	t.Helper()
+	resp, err := client.Get(url + FleetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	var fleet Fleet
+	if err := json.NewDecoder(resp.Body).Decode(&fleet); err != nil {
+		t.Fatal(err)
+	}
+	return fleet
+}
+
+func TestCollectorFleet(t *testing.T) {
+	pki := newTestPKI(t)
+	events := &eventLog{}
+	s, url, client := startCollector(t, pki, events.log, "sensor-1")
+	s.correlator = newCorrelator(time.Hour, 100)
+	s.config.FleetSensors = 2
+	s.config.FleetAction = FleetTarpit
+	other := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      pki.pool,
+		Certificates: []tls.Certificate{pki.issue(t, "sensor-2")},
+	}}}
+
+	if fleet := getFleet(t, client, url); len(fleet.Denylist) != 0 || len(fleet.Tarpit) != 0 {
+		t.Errorf("Expected empty lists, got %+v", fleet)
+	}
+
+	for _, c := range []*http.Client{client, other} {
+		resp, err := c.Post(url+EventsPath, "application/x-ndjson", strings.NewReader(testBatch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	fleet := getFleet(t, other, url)
+	if !reflect.DeepEqual(fleet, Fleet{Denylist: []string{}, Tarpit: []string{"1.2.3.4"}}) {
+		t.Errorf("Expected the source seen on 2 sensors in the tarpit list, got %+v", fleet)
+	}
+	last := events.events[len(events.events)-1]
+	if v, _ := last.Get(SeenOnField); v != 2 || last.GetString(FleetCampaignField) == "" {
+		t.Errorf("Expected the correlation fields, got %+v", last.Fields)
+	}
+
+	// Attempts across the fleet list sources too
+	s.config.FleetSensors = 0
+	s.config.FleetAttempts = 5
+	s.config.FleetAction = FleetDeny
+	if fleet := getFleet(t, client, url); len(fleet.Denylist) != 0 {
+		t.Errorf("Expected no source over 5 attempts, got %+v", fleet)
+	}
+	s.config.FleetAttempts = 4
+	if fleet := getFleet(t, client, url); !reflect.DeepEqual(fleet.Denylist, []string{"1.2.3.4"}) {
+		t.Errorf("Expected the source with 4 attempts denied, got %+v", fleet)
+	}
+}
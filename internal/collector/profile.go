@@ -0,0 +1,98 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package collector
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ProfilePath is the endpoint sensors fetch their configuration profile from
+const ProfilePath = "/v1/profile"
+
+// SignatureHeader carries the Ed25519 signature of a profile, base64-encoded
+const SignatureHeader = "Fakessh-Signature"
+
+// Profile is a configuration profile for the sensors matching its patterns
+type Profile struct {
+	// Patterns (as of path.Match) of the client certificate names of its
+	// sensors; a sensor gets the first profile matching its certificate
+	Sensors []string
+	// Load returns the profile as sent to the sensors. It is called for
+	// every request, so that profiles can be changed without a restart.
+	Load func() ([]byte, error)
+}
+
+// ParseSigningKey parses the PEM-encoded Ed25519 private key (PKCS #8)
+// signing profiles
+func ParseSigningKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data in the profile signing key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("the profile signing key is not an Ed25519 key")
+	}
+	return signer, nil
+}
+
+// profileOf returns the profile of a sensor certificate, nil if none matches
+func (s *Server) profileOf(certificate string) *Profile {
+	for i := range s.config.Profiles {
+		if matchesCertificate(s.config.Profiles[i].Sensors, certificate) {
+			return &s.config.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// handleProfile sends the signed profile of a sensor
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	certificate := CertificateName(r)
+	if certificate == "" {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": errNoCertificateName.Error()})
+		return
+	}
+	profile := s.profileOf(certificate)
+	if profile == nil || s.config.ProfileKey == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no profile for the sensor"})
+		return
+	}
+	data, err := profile.Load()
+	if err != nil {
+		log.Error().Err(err).Str("certificate", certificate).Msg("profile loading error")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "profile could not be loaded"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(SignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(s.config.ProfileKey, data)))
+	w.Write(data)
+}
@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestCollectorProfile(t *testing.T) {
+	pki := newTestPKI(t)
+	s, url, client := startCollector(t, pki, (&eventLog{}).log, "sensor-1")
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	s.config.ProfileKey = key
+	s.config.Profiles = []Profile{
+		{Sensors: []string{"lab-*"}, Load: func() ([]byte, error) { return nil, errors.New("unreadable") }},
+		{Sensors: []string{"sensor-*"}, Load: func() ([]byte, error) { return []byte(`{"Name":"dmz"}`), nil }},
+	}
+
+	resp, err := client.Get(url + ProfilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != `{"Name":"dmz"}` {
+		t.Fatalf("Unexpected profile response: %d %s", resp.StatusCode, body)
+	}
+	signature, _ := base64.StdEncoding.DecodeString(resp.Header.Get(SignatureHeader))
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), body, signature) {
+		t.Errorf("Expected a valid signature")
+	}
+
+	s.config.Profiles = s.config.Profiles[:1]
+	resp, err = client.Get(url + ProfilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a sensor without profile, got %d", resp.StatusCode)
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil || !parsed.Equal(key) {
+		t.Errorf("ParseSigningKey() = %v, %v", parsed, err)
+	}
+	if _, err := ParseSigningKey([]byte("not a key")); err == nil {
+		t.Errorf("Expected an error without PEM data")
+	}
+}
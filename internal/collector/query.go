@@ -0,0 +1,301 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package collector
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/admin"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/rs/zerolog/log"
+)
+
+// Paths of the query API; GET EventsPath queries the stored events
+const (
+	TopPath     = "/v1/top/{column}"
+	SummaryPath = "/v1/summary"
+	StreamPath  = "/v1/stream"
+)
+
+// Limits of the query API
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+	// Largest offset of a page, as pages are collected while reading
+	maxOffset  = 100000
+	defaultTop = 10
+	maxTop     = 1000
+)
+
+// validColumn matches the columns top lists can count
+var validColumn = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]{0,63}$`)
+
+// QueryConfig contains settings of the query API
+type QueryConfig struct {
+	// Bearer tokens accepted by the API
+	Tokens []string
+	// Logs returns the paths of the logs written at or after since, oldest first
+	Logs func(since time.Time) ([]string, error)
+	// Timestamp format of the logs
+	Times logger.TimeFormat
+	// Live stream of the events as they are logged, served under
+	// StreamPath if not nil
+	Stream http.Handler
+}
+
+// EnableQuery serves the events stored in the logs to clients presenting
+// one of the tokens: GET EventsPath lists them, TopPath and SummaryPath
+// aggregate them and StreamPath streams new ones. The tokens of a tenant
+// query the events of the tenant instead. Clients of the API need no
+// certificate; sensors still do. It must be called before Start.
+func (s *Server) EnableQuery(config QueryConfig) {
+	s.query = &config
+	s.srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	s.mux.Handle("GET "+EventsPath, s.requireToken(s.handleQueryEvents))
+	s.mux.Handle("GET "+TopPath, s.requireToken(s.handleTop))
+	s.mux.Handle("GET "+SummaryPath, s.requireToken(s.handleSummary))
+	s.mux.Handle("GET "+StreamPath, s.requireToken(s.handleStream))
+}
+
+// tokenOwner returns the tenant whose token a request carries, nil for the
+// operator, and false if it carries no valid token
+func (s *Server) tokenOwner(r *http.Request) (*Tenant, bool) {
+	if s.query == nil {
+		return nil, false
+	}
+	if admin.HasToken(r, s.query.Tokens) {
+		return nil, true
+	}
+	for _, t := range s.tenants {
+		if admin.HasToken(r, t.Query.Tokens) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// requireToken passes the requests carrying a token to h, with the query
+// settings of the owner of the token, and rejects the others
+func (s *Server) requireToken(h func(http.ResponseWriter, *http.Request, *QueryConfig)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, ok := s.tokenOwner(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fakessh"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid API token"})
+			return
+		}
+		query := s.query
+		if tenant != nil {
+			query = &tenant.Query
+		}
+		h(w, r, query)
+	})
+}
+
+// handleStream streams the events of the owner of the token
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request, query *QueryConfig) {
+	if query.Stream == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "the event stream is not available"})
+		return
+	}
+	query.Stream.ServeHTTP(w, r)
+}
+
+// read calls fn for the stored events matching the query, oldest first
+func read(query *QueryConfig, q *report.Query, fn func(*logger.Event)) error {
+	paths, err := query.Logs(q.Since)
+	if err != nil {
+		return err
+	}
+	return logger.ReadLogs(paths, query.Times, func(event *logger.Event) error {
+		if q.Match(event) {
+			fn(event)
+		}
+		return nil
+	})
+}
+
+// intParam returns an integer query parameter between 0 and max, or def if
+// it is not given
+func intParam(values url.Values, name string, def, max int) (int, error) {
+	v := values.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > max {
+		return 0, fmt.Errorf("invalid %s: must be a number from 0 to %d", name, max)
+	}
+	return n, nil
+}
+
+// EventPage is a page of the events matching a query
+type EventPage struct {
+	// Number of matching events
+	Total  int               `json:"total"`
+	Events []json.RawMessage `json:"events"`
+	// Offset of the next page, if there is one
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+// handleQueryEvents returns a page of the matching events, newest first
+// unless order=asc
+func (s *Server) handleQueryEvents(w http.ResponseWriter, r *http.Request, query *QueryConfig) {
+	values := r.URL.Query()
+	q, err := report.ParseQuery(values, time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	limit, err := intParam(values, "limit", defaultLimit, maxLimit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	offset, err := intParam(values, "offset", 0, maxOffset)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	order := values.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid order: must be asc or desc"})
+		return
+	}
+
+	// Newest first keeps the last offset+limit matches in a ring
+	var page []*logger.Event
+	total := 0
+	err = read(query, q, func(event *logger.Event) {
+		total++
+		if order == "asc" {
+			if total > offset && len(page) < limit {
+				page = append(page, event)
+			}
+			return
+		}
+		if window := offset + limit; window > 0 {
+			if len(page) < window {
+				page = append(page, event)
+			} else {
+				page[(total-1)%window] = event
+			}
+		}
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("collector query error")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "events could not be read"})
+		return
+	}
+	if order != "asc" {
+		page = newestFirst(page, total, offset, limit)
+	}
+
+	resp := EventPage{Total: total, Events: make([]json.RawMessage, 0, len(page))}
+	var buf bytes.Buffer
+	exporter, _ := report.NewExporter(report.ExportJSON, &buf, nil)
+	for _, event := range page {
+		buf.Reset()
+		exporter.Write(event)
+		resp.Events = append(resp.Events, append(json.RawMessage(nil), bytes.TrimSpace(buf.Bytes())...))
+	}
+	if next := offset + len(page); len(page) > 0 && next < total {
+		resp.NextOffset = &next
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// newestFirst returns the page after offset of the events of a ring that
+// holds the last matches of total, newest first
+func newestFirst(ring []*logger.Event, total, offset, limit int) []*logger.Event {
+	window := len(ring)
+	var page []*logger.Event
+	for i := offset; i < offset+limit && i < total && i < window; i++ {
+		// The i-th newest match is the (total-1-i)-th one
+		page = append(page, ring[(total-1-i)%window])
+	}
+	return page
+}
+
+// TopResponse lists the values of a column with the most attempts
+type TopResponse struct {
+	Column   string         `json:"column"`
+	Distinct int            `json:"distinct"`
+	Top      []report.Count `json:"top"`
+}
+
+// handleTop counts the matching attempts by the value of a column
+func (s *Server) handleTop(w http.ResponseWriter, r *http.Request, query *QueryConfig) {
+	column := r.PathValue("column")
+	if !validColumn.MatchString(column) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid column"})
+		return
+	}
+	values := r.URL.Query()
+	q, err := report.ParseQuery(values, time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	n, err := intParam(values, "n", defaultTop, maxTop)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	counter := report.NewTopCounter(column)
+	if err := read(query, q, counter.Add); err != nil {
+		log.Error().Err(err).Msg("collector query error")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "events could not be read"})
+		return
+	}
+	writeJSON(w, http.StatusOK, TopResponse{Column: column, Distinct: counter.Distinct(), Top: counter.Top(n)})
+}
+
+// handleSummary summarizes the matching attempts
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request, query *QueryConfig) {
+	values := r.URL.Query()
+	q, err := report.ParseQuery(values, time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	n, err := intParam(values, "n", defaultTop, maxTop)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	summarizer := report.NewSummarizer(n)
+	if err := read(query, q, summarizer.Add); err != nil {
+		log.Error().Err(err).Msg("collector query error")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "events could not be read"})
+		return
+	}
+	writeJSON(w, http.StatusOK, summarizer.Summary())
+}
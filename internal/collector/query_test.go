@@ -0,0 +1,208 @@
+package collector
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+const testLog = `{"time":"2024-01-15T10:00:00Z","event":"auth_attempt","event_id":"e1","remote_addr":"192.0.2.1:4000","username":"root","password":"123456","country":"CN","sensor_id":"fra1"}
+{"time":"2024-01-15T10:00:01Z","event":"auth_attempt","event_id":"e2","remote_addr":"192.0.2.1:4001","username":"admin","password":"admin","country":"CN","sensor_id":"fra1"}
+{"time":"2024-01-15T10:00:02Z","event":"connection","event_id":"e3","remote_addr":"198.51.100.7:22","sensor_id":"ams1"}
+{"time":"2024-01-16T10:00:00Z","event":"auth_attempt","event_id":"e4","remote_addr":"198.51.100.7:23","username":"root","password":"root","country":"NL","sensor_id":"ams1","count":3}
+{"time":"2024-01-17T10:00:00Z","event":"auth_attempt","event_id":"e5","remote_addr":"[2001:db8::1]:22","username":"root","password":"toor","sensor_id":"fra1"}
+`
+
+// startQueryCollector serves a collector with the query API over the test
+// log, returning its URL and a client without certificate
+func startQueryCollector(t *testing.T) (string, *http.Client) {
+	t.Helper()
+	pki := newTestPKI(t)
+	pki.issue(t, "collector")
+	path := filepath.Join(t.TempDir(), "fleet.log")
+	if err := os.WriteFile(path, []byte(testLog), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(Config{
+		CertFile:      filepath.Join(pki.dir, "collector.pem"),
+		KeyFile:       filepath.Join(pki.dir, "collector.key"),
+		ClientCAFile:  filepath.Join(pki.dir, "ca.pem"),
+		MaxBatchBytes: 1024,
+	}, (&eventLog{}).log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.EnableQuery(QueryConfig{
+		Tokens: []string{"secret"},
+		Logs:   func(time.Time) ([]string, error) { return []string{path}, nil },
+	})
+	ts := httptest.NewUnstartedServer(s.mux)
+	ts.TLS = s.srv.TLSConfig
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	return ts.URL, &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pki.pool}}}
+}
+
+// get requests an API path with the token, decoding the response into v
+func get(t *testing.T, client *http.Client, url, token string, v interface{}) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		json.NewDecoder(resp.Body).Decode(v)
+	}
+	return resp.StatusCode
+}
+
+// eventIDs returns the event_id of the events of a page
+func eventIDs(page EventPage) []string {
+	var ids []string
+	for _, raw := range page.Events {
+		var event struct {
+			ID string `json:"event_id"`
+		}
+		json.Unmarshal(raw, &event)
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestQueryRequiresToken(t *testing.T) {
+	url, client := startQueryCollector(t)
+
+	for _, token := range []string{"", "wrong"} {
+		if status := get(t, client, url+EventsPath, token, nil); status != http.StatusUnauthorized {
+			t.Errorf("Expected 401 with token %q, got %d", token, status)
+		}
+	}
+	if status := get(t, client, url+SensorsPath, "", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for sensors without certificate or token, got %d", status)
+	}
+	if status := get(t, client, url+SensorsPath, "secret", nil); status != http.StatusOK {
+		t.Errorf("Expected sensors with the token, got %d", status)
+	}
+}
+
+func TestQueryEvents(t *testing.T) {
+	url, client := startQueryCollector(t)
+
+	tests := []struct {
+		name  string
+		query string
+		ids   []string
+		total int
+		next  int
+	}{
+		{"newest first", "", []string{"e5", "e4", "e3", "e2", "e1"}, 5, -1},
+		{"oldest first", "?order=asc", []string{"e1", "e2", "e3", "e4", "e5"}, 5, -1},
+		{"first page", "?limit=2", []string{"e5", "e4"}, 5, 2},
+		{"second page", "?limit=2&offset=2", []string{"e3", "e2"}, 5, 4},
+		{"last page", "?limit=2&offset=4&order=asc", []string{"e5"}, 5, -1},
+		{"beyond the end", "?offset=10", nil, 5, -1},
+		{"time range", "?since=2024-01-15T10:00:01Z&until=2024-01-17", []string{"e4", "e3", "e2"}, 3, -1},
+		{"type", "?type=connection", []string{"e3"}, 1, -1},
+		{"address", "?ip=192.0.2.1", []string{"e2", "e1"}, 2, -1},
+		{"prefixes", "?ip=198.51.100.0/24&ip=2001:db8::/32", []string{"e5", "e4", "e3"}, 3, -1},
+		{"username", "?username=root&order=asc", []string{"e1", "e4", "e5"}, 3, -1},
+		{"sensor and country", "?sensor=fra1&country=CN&country=NL", []string{"e2", "e1"}, 2, -1},
+		{"expression", "?q=" + "password%20%3D~%20%22^ro%22", []string{"e4"}, 1, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var page EventPage
+			if status := get(t, client, url+EventsPath+tt.query, "secret", &page); status != http.StatusOK {
+				t.Fatalf("Expected 200, got %d", status)
+			}
+			ids := eventIDs(page)
+			if len(ids) != len(tt.ids) {
+				t.Fatalf("Expected events %v, got %v", tt.ids, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.ids[i] {
+					t.Fatalf("Expected events %v, got %v", tt.ids, ids)
+				}
+			}
+			if page.Total != tt.total {
+				t.Errorf("Expected total %d, got %d", tt.total, page.Total)
+			}
+			if (tt.next < 0) != (page.NextOffset == nil) || (page.NextOffset != nil && *page.NextOffset != tt.next) {
+				t.Errorf("Expected next offset %d, got %v", tt.next, page.NextOffset)
+			}
+		})
+	}
+}
+
+func TestQueryInvalidParameters(t *testing.T) {
+	url, client := startQueryCollector(t)
+
+	for _, query := range []string{"?limit=5000", "?offset=-1", "?order=random", "?since=yesterday", "?ip=host", "?q=username%20%3D%3D"} {
+		if status := get(t, client, url+EventsPath+query, "secret", nil); status != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, status)
+		}
+	}
+	if status := get(t, client, url+"/v1/top/bad%20column", "secret", nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid column, got %d", status)
+	}
+}
+
+func TestQueryTop(t *testing.T) {
+	url, client := startQueryCollector(t)
+
+	var top TopResponse
+	if status := get(t, client, url+"/v1/top/username?n=1", "secret", &top); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if top.Column != "username" || top.Distinct != 2 || len(top.Top) != 1 || top.Top[0].Value != "root" || top.Top[0].Count != 5 {
+		t.Errorf("Unexpected top usernames: %+v", top)
+	}
+
+	if status := get(t, client, url+"/v1/top/sensor_id?since=2024-01-16", "secret", &top); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if len(top.Top) != 2 || top.Top[0].Value != "ams1" || top.Top[0].Count != 3 {
+		t.Errorf("Unexpected top sensors: %+v", top)
+	}
+}
+
+func TestQuerySummary(t *testing.T) {
+	url, client := startQueryCollector(t)
+
+	var summary struct {
+		Attempts  int `json:"attempts"`
+		UniqueIPs int `json:"unique_ips"`
+	}
+	if status := get(t, client, url+SummaryPath+"?sensor=fra1", "secret", &summary); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if summary.Attempts != 3 || summary.UniqueIPs != 2 {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+}
+
+func TestNewestFirst(t *testing.T) {
+	ring := make([]*logger.Event, 3)
+	for i := 0; i < 7; i++ {
+		ring[i%3] = &logger.Event{ID: string(rune('a' + i))}
+	}
+	// Matches a..g, the ring holds e, f, g
+	page := newestFirst(ring, 7, 1, 5)
+	if len(page) != 2 || page[0].ID != "f" || page[1].ID != "e" {
+		t.Errorf("Unexpected page: %+v", page)
+	}
+}
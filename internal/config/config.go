@@ -20,18 +20,45 @@
 package config
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"net"
+	"net/netip"
 	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/abehterev/fakessh/internal/schedule"
+	"github.com/abehterev/fakessh/internal/secrets"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+// ErrConfigInvalid is wrapped by the errors of settings that can not be
+// parsed or are not valid
+var ErrConfigInvalid = errors.New("invalid configuration")
+
 // Config contains all settings for the fake SSH server
 type Config struct {
+	// Configuration files whose settings this file overrides, merged in
+	// order; relative paths are relative to the including file, and
+	// patterns like "conf.d/*.yaml" match files in name order
+	Includes []string `mapstructure:"includes"`
 	// Server port
 	Port int `mapstructure:"port"`
 	// Logging settings
 	Log LogConfig `mapstructure:"log"`
+	// Operational logging settings
+	OpsLog OpsLogConfig `mapstructure:"ops_log"`
 	// SSH greeting banner
 	Banner string `mapstructure:"banner"`
 	// SSH server version
@@ -40,6 +67,983 @@ type Config struct {
 	PrivateKeyPath string `mapstructure:"private_key_path"`
 	// If true, will generate a new key on each start
 	GenerateKey bool `mapstructure:"generate_key"`
+	// Directory of the files the server keeps: relative paths of the host
+	// key, the sensor ID file, log files, caches, databases and the spool
+	// are taken beneath it, so that the rest of the filesystem can be
+	// read-only (default: empty, the working directory)
+	StateDir string `mapstructure:"state_dir"`
+	// File the process ID is written to while the server runs, for init
+	// scripts and logrotate (default: empty, no file)
+	PIDFile string `mapstructure:"pidfile"`
+	// Time open connections are given to end on SIGTERM before they are
+	// closed
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// Confinement of the process once the server is listening
+	Sandbox SandboxConfig `mapstructure:"sandbox"`
+	// Static key/value pairs attached to every event (sensor_id, datacenter, ...)
+	Tags map[string]string `mapstructure:"tags"`
+	// Identity of the sensor, attached to every event
+	Sensor SensorConfig `mapstructure:"sensor"`
+	// Privacy settings for logged data
+	Privacy PrivacyConfig `mapstructure:"privacy"`
+	// Enrichment of events with data about the source
+	Enrichment EnrichmentConfig `mapstructure:"enrichment"`
+	// Export of operational metrics
+	Metrics MetricsConfig `mapstructure:"metrics"`
+	// OpenTelemetry tracing of connection handling
+	Tracing TracingConfig `mapstructure:"tracing"`
+	// Handling of connections by source
+	Access AccessConfig `mapstructure:"access"`
+	// Administrative HTTP endpoints
+	Admin AdminConfig `mapstructure:"admin"`
+	// Authenticated admin API changing the sensor at runtime
+	API APIConfig `mapstructure:"api"`
+	// Periodic heartbeat events
+	Heartbeat HeartbeatConfig `mapstructure:"heartbeat"`
+	// Notifications about notable events
+	Alerts AlertsConfig `mapstructure:"alerts"`
+	// Scheduled reports delivered through notifiers
+	Reports ReportsConfig `mapstructure:"reports"`
+	// Collector mode, receiving the events of remote sensors
+	Collector CollectorConfig `mapstructure:"collector"`
+	// Forwarding of events to a collector
+	Forward ForwardConfig `mapstructure:"forward"`
+}
+
+// SandboxConfig contains settings of the confinement of the process, applied
+// once the server is listening (Linux only)
+type SandboxConfig struct {
+	// Directory the process changes its root to, empty to keep it; paths
+	// opened later, such as rotated logs, are found beneath it
+	Chroot string `mapstructure:"chroot"`
+	// User the process switches to, as "name", "name:group" or numeric
+	// IDs, empty to keep the user
+	User string `mapstructure:"user"`
+	// Limit filesystem access with Landlock to the directories of the
+	// configured files, read_paths and write_paths (kernel 5.13+)
+	Landlock bool `mapstructure:"landlock"`
+	// Further directories that can be read, or read and written
+	ReadPaths  []string `mapstructure:"read_paths"`
+	WritePaths []string `mapstructure:"write_paths"`
+	// Limit system calls with a seccomp filter (amd64 and arm64)
+	Seccomp bool `mapstructure:"seccomp"`
+	// Result of system calls outside the filter: "errno" to fail them,
+	// "kill" to kill the process or "log" to allow and audit them
+	SeccompAction string `mapstructure:"seccomp_action"`
+}
+
+// SensorConfig contains the identity of the sensor
+type SensorConfig struct {
+	// Stable ID of the sensor; if empty, the sensor_id tag, or an ID
+	// generated on first start and kept in IDFile
+	ID string `mapstructure:"id"`
+	// File keeping the generated ID
+	IDFile string `mapstructure:"id_file"`
+	// Human-readable name, e.g. "Frankfurt 1"
+	Name string `mapstructure:"name"`
+	// Location, e.g. "fra1" or "Frankfurt, DE"
+	Location string `mapstructure:"location"`
+}
+
+// validSensorID matches sensor IDs
+var validSensorID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,127}$`)
+
+// CollectorConfig contains settings of the collector mode
+type CollectorConfig struct {
+	// Address of the HTTPS listener
+	Listen string `mapstructure:"listen"`
+	// Server certificate and private key (PEM)
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// CA certificates (PEM) the client certificates of sensors must chain to
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	// Largest accepted batch of events in bytes, after decompression
+	MaxBatchBytes int `mapstructure:"max_batch_bytes"`
+	// Number of recent event IDs remembered to drop events sent again
+	RecentIDs int `mapstructure:"recent_ids"`
+	// Period within which sources are correlated across the sensors of a
+	// tenant, 0 disables the correlation
+	CorrelationWindow time.Duration `mapstructure:"correlation_window"`
+	// Largest number of sources followed by the correlation
+	MaxCorrelatedSources int `mapstructure:"max_correlated_sources"`
+	// Sources the sensors deny or hold in the tarpit, from the correlation
+	FleetDenylist FleetDenylistConfig `mapstructure:"fleet_denylist"`
+	// Bearer token of the query API, disabled if empty
+	APIToken string `mapstructure:"api_token"`
+	// File containing the API token, used if api_token is empty
+	APITokenFile string `mapstructure:"api_token_file"`
+	// Serve the web dashboard under /dashboard/, requires the API token
+	Dashboard bool `mapstructure:"dashboard"`
+	// Tenants sharing the collector, each with its own sensors and log
+	Tenants []CollectorTenantConfig `mapstructure:"tenants"`
+	// Configuration profiles of the sensors
+	Profiles []CollectorProfileConfig `mapstructure:"profiles"`
+	// Ed25519 private key (PEM) signing the profiles
+	ProfileKey string `mapstructure:"profile_key"`
+	// File containing the profile key, used if profile_key is empty
+	ProfileKeyFile string `mapstructure:"profile_key_file"`
+}
+
+// CollectorProfileConfig assigns a configuration profile to sensors
+type CollectorProfileConfig struct {
+	// Patterns of the client certificate names of its sensors, e.g. "dmz-*";
+	// a sensor gets the first profile matching its certificate
+	Sensors []string `mapstructure:"sensors"`
+	// Profile file (YAML or JSON), read again for every request
+	File string `mapstructure:"file"`
+}
+
+// CollectorTenantConfig contains settings of a tenant of the collector
+type CollectorTenantConfig struct {
+	// Name of the tenant
+	Name string `mapstructure:"name"`
+	// Patterns of the client certificate names of its sensors, e.g. "acme-*"
+	Sensors []string `mapstructure:"sensors"`
+	// Log file of the events of its sensors
+	LogFile string `mapstructure:"log_file"`
+	// Bearer token of its query API, disabled if empty
+	APIToken string `mapstructure:"api_token"`
+	// File containing the API token, used if api_token is empty
+	APITokenFile string `mapstructure:"api_token_file"`
+}
+
+// HasAPIToken reports whether the tenant can use the query API
+func (t CollectorTenantConfig) HasAPIToken() bool {
+	return t.APIToken != "" || t.APITokenFile != ""
+}
+
+// ForwardConfig contains settings of the forwarding of events to a collector
+type ForwardConfig struct {
+	// Base URL of the collector, e.g. "https://collector.example.com:8443",
+	// disabled if empty
+	URL string `mapstructure:"url"`
+	// Client certificate and private key (PEM) authenticating the sensor
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// CA certificates (PEM) of the collector certificate, the system roots if empty
+	CAFile string `mapstructure:"ca_file"`
+	// Directory of the spool keeping events until the collector stores them
+	SpoolDir string `mapstructure:"spool_dir"`
+	// Largest size of the spool in bytes, new events are dropped beyond it
+	MaxSpoolBytes int `mapstructure:"max_spool_bytes"`
+	// Maximum number of events per batch
+	BatchSize int `mapstructure:"batch_size"`
+	// Interval between batches
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// Timeout of a batch request
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Interval between polls of the fleet denylist of the collector, 0
+	// disables it
+	FleetInterval time.Duration `mapstructure:"fleet_interval"`
+	// Ed25519 public key (PEM) verifying the profiles of the collector,
+	// which are not fetched without it
+	ProfileKeyFile string `mapstructure:"profile_key_file"`
+	// Interval between polls of the profile after the one fetched on
+	// startup, 0 disables them
+	ProfileInterval time.Duration `mapstructure:"profile_interval"`
+}
+
+// Actions of the fleet denylist
+const (
+	FleetDeny   = "deny"
+	FleetTarpit = "tarpit"
+)
+
+// FleetDenylistConfig contains settings of the sources the collector lists
+// for the sensors of a tenant, which deny them or hold them in the tarpit
+type FleetDenylistConfig struct {
+	// Sources seen on at least this many sensors within the correlation
+	// window, 0 disables it
+	MinSensors int `mapstructure:"min_sensors"`
+	// Sources with at least this many attempts across the sensors within the
+	// correlation window, 0 disables it
+	MinAttempts int `mapstructure:"min_attempts"`
+	// "deny" or "tarpit"
+	Action string `mapstructure:"action"`
+}
+
+// Enabled reports whether the collector lists sources for its sensors
+func (f FleetDenylistConfig) Enabled() bool {
+	return f.MinSensors > 0 || f.MinAttempts > 0
+}
+
+// Report formats
+const (
+	ReportHTML = "html"
+	ReportText = "text"
+)
+
+// ReportsConfig contains settings of scheduled reports
+type ReportsConfig struct {
+	// Cron schedule (minute hour day month weekday) or a macro such as
+	// "@weekly", disabled if empty
+	Schedule string `mapstructure:"schedule"`
+	// Timezone of the schedule: "UTC", "Local" or an IANA name
+	Timezone string `mapstructure:"timezone"`
+	// Period covered by a report, ending when it is generated
+	Period time.Duration `mapstructure:"period"`
+	// "html" attaches the HTML report to the summary, "text" sends the summary only
+	Format string `mapstructure:"format"`
+	// Title of the reports
+	Title string `mapstructure:"title"`
+	// Entries of each top list
+	Top int `mapstructure:"top"`
+	// Notifiers delivering the reports: "email", "slack" and "discord";
+	// all configured ones if empty
+	Notifiers []string `mapstructure:"notifiers"`
+}
+
+// Enabled reports whether reports are scheduled
+func (c ReportsConfig) Enabled() bool {
+	return c.Schedule != ""
+}
+
+// Names of the notifiers that can deliver reports
+var reportNotifiers = map[string]bool{
+	"email":   true,
+	"slack":   true,
+	"discord": true,
+}
+
+// Delivers reports whether a notifier delivers the reports
+func (c ReportsConfig) Delivers(notifier string) bool {
+	return len(c.Notifiers) == 0 || slices.Contains(c.Notifiers, notifier)
+}
+
+// AlertsConfig contains the alert triggers and notifiers
+type AlertsConfig struct {
+	// Alert on the first attempt of a source, requires attacker tracking
+	NewAttacker bool `mapstructure:"new_attacker"`
+	// Alert on the first attempt from a country, requires attacker tracking
+	// and a GeoIP database
+	NewCountry bool `mapstructure:"new_country"`
+	// Alert on the first attempt from an autonomous system, requires
+	// attacker tracking and an ASN database
+	NewASN bool `mapstructure:"new_asn"`
+	// Alert when a source reaches this many attempts within ThresholdWindow, disabled if 0
+	AttemptsThreshold int `mapstructure:"attempts_threshold"`
+	// Window of AttemptsThreshold
+	ThresholdWindow time.Duration `mapstructure:"threshold_window"`
+	// Alert on password sprays, requires spray detection
+	PasswordSpray bool `mapstructure:"password_spray"`
+	// Alert on attack surges, requires surge detection
+	AttackSurge bool `mapstructure:"attack_surge"`
+	// Raise a critical alert for attempts from these networks (CIDR, single
+	// addresses or "private"), disabled if empty
+	InternalNetworks []string `mapstructure:"internal_networks"`
+	// Alerts waiting for delivery, further alerts are dropped
+	QueueSize int `mapstructure:"queue_size"`
+	// Timeout of a single delivery
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Alerts of a rule about a source are suppressed for this long after one
+	// was sent, disabled if 0
+	Cooldown time.Duration `mapstructure:"cooldown"`
+	// Alerts of a rule following a sent one within this window are
+	// summarized in one alert, disabled if 0
+	BatchWindow time.Duration `mapstructure:"batch_window"`
+	// Slack incoming webhook
+	Slack SlackConfig `mapstructure:"slack"`
+	// Telegram bot
+	Telegram TelegramConfig `mapstructure:"telegram"`
+	// Discord webhook
+	Discord DiscordConfig `mapstructure:"discord"`
+	// Email alerts and digests
+	Email EmailConfig `mapstructure:"email"`
+	// PagerDuty Events API
+	PagerDuty PagerDutyConfig `mapstructure:"pagerduty"`
+	// Opsgenie Alert API
+	Opsgenie OpsgenieConfig `mapstructure:"opsgenie"`
+	// ntfy topic
+	Ntfy NtfyConfig `mapstructure:"ntfy"`
+	// Pushover application
+	Pushover PushoverConfig `mapstructure:"pushover"`
+	// Custom alert rules
+	Rules []AlertRuleConfig `mapstructure:"rules"`
+}
+
+// AlertRuleConfig describes the events raising the alerts of a custom rule
+type AlertRuleConfig struct {
+	// Rule name, used to route the alerts
+	Name string `mapstructure:"name"`
+	// Severity of the alerts: "info", "warning" (default) or "critical"
+	Severity string `mapstructure:"severity"`
+	// Template of the alert summary (Go text/template), a summary naming the
+	// rule and source if empty
+	Message string `mapstructure:"message"`
+	// Event types checked, auth_attempt if empty
+	Events []string `mapstructure:"events"`
+	// Conditions all matching events meet
+	Conditions []AlertConditionConfig `mapstructure:"conditions"`
+	// Matching events within window raising an alert, every matching event
+	// raises one if 0
+	Threshold int           `mapstructure:"threshold"`
+	Window    time.Duration `mapstructure:"window"`
+	// Field grouping the events counted for the threshold, the source address
+	// if empty
+	GroupBy string `mapstructure:"group_by"`
+	// Cooldown of the rule, alerts.cooldown if 0
+	Cooldown time.Duration `mapstructure:"cooldown"`
+	// Notifiers receiving the alerts, all if empty
+	Notifiers []string `mapstructure:"notifiers"`
+}
+
+// AlertConditionConfig selects events by the value of a field
+type AlertConditionConfig struct {
+	// Event field, "source" for the source address
+	Field string `mapstructure:"field"`
+	// Any of the values
+	In []string `mapstructure:"in"`
+	// Regular expression
+	Regex string `mapstructure:"regex"`
+	// Bounds of numeric values
+	Min *float64 `mapstructure:"min"`
+	Max *float64 `mapstructure:"max"`
+	// Addresses inside any of the networks (CIDR, single addresses or "private")
+	Networks []string `mapstructure:"networks"`
+	// Presence (true) or absence (false) of the field
+	Exists *bool `mapstructure:"exists"`
+	// Inverts the condition
+	Not bool `mapstructure:"not"`
+}
+
+// Email modes
+const (
+	EmailAlerts = "alerts"
+	EmailDigest = "digest"
+	EmailBoth   = "both"
+)
+
+// EmailConfig contains settings of email alerts and digests
+type EmailConfig struct {
+	// SMTP server, disabled if empty
+	Host string `mapstructure:"host"`
+	Port int    `mapstructure:"port"`
+	// Connection security: "starttls", "tls" or "none"
+	Security string `mapstructure:"security"`
+	// Credentials, no authentication if the username is empty
+	Username     string `mapstructure:"username"`
+	Password     string `mapstructure:"password"`
+	PasswordFile string `mapstructure:"password_file"`
+	// Sender and recipients
+	From string   `mapstructure:"from"`
+	To   []string `mapstructure:"to"`
+	// What is sent: "alerts" (immediately), "digest" (periodic summary) or "both"
+	Mode string `mapstructure:"mode"`
+	// Period of a digest
+	DigestInterval time.Duration `mapstructure:"digest_interval"`
+	// Entries of the top lists of a digest
+	DigestTop int `mapstructure:"digest_top"`
+	// Message template of alerts (Go text/template), a summary with the key fields if empty
+	Template string `mapstructure:"template"`
+	// Rules whose alerts are sent, all if empty
+	Rules []string `mapstructure:"rules"`
+}
+
+// Enabled reports whether an SMTP server is configured
+func (c EmailConfig) Enabled() bool {
+	return c.Host != ""
+}
+
+// SendsAlerts reports whether alerts are sent immediately
+func (c EmailConfig) SendsAlerts() bool {
+	return c.Enabled() && c.Mode != EmailDigest
+}
+
+// SendsDigest reports whether digests are sent
+func (c EmailConfig) SendsDigest() bool {
+	return c.Enabled() && (c.Mode == EmailDigest || c.Mode == EmailBoth)
+}
+
+// Names of the built-in alert rules
+var alertRules = map[string]bool{
+	"new_attacker":    true,
+	"new_country":     true,
+	"new_asn":         true,
+	"threshold":       true,
+	"password_spray":  true,
+	"attack_surge":    true,
+	"internal_source": true,
+}
+
+// Names of the notifiers that custom rules can be routed to
+var alertNotifiers = map[string]bool{
+	"slack":     true,
+	"telegram":  true,
+	"discord":   true,
+	"email":     true,
+	"pagerduty": true,
+	"opsgenie":  true,
+	"ntfy":      true,
+	"pushover":  true,
+}
+
+// Enabled reports whether any notifier is configured
+func (c AlertsConfig) Enabled() bool {
+	return c.Slack.Enabled() || c.Telegram.Enabled() || c.Discord.Enabled() || c.Email.SendsAlerts() ||
+		c.PagerDuty.Enabled() || c.Opsgenie.Enabled() || c.Ntfy.Enabled() || c.Pushover.Enabled()
+}
+
+// SlackConfig contains settings of the Slack notifier
+type SlackConfig struct {
+	// Incoming webhook URL, or a file containing it; disabled if both are empty
+	WebhookURL     string `mapstructure:"webhook_url"`
+	WebhookURLFile string `mapstructure:"webhook_url_file"`
+	// Message template (Go text/template), a summary with the key fields if empty
+	Template string `mapstructure:"template"`
+	// Rules whose alerts are sent, all if empty
+	Rules []string `mapstructure:"rules"`
+}
+
+// Enabled reports whether the Slack notifier is configured
+func (c SlackConfig) Enabled() bool {
+	return c.WebhookURL != "" || c.WebhookURLFile != ""
+}
+
+// TelegramConfig contains settings of the Telegram notifier
+type TelegramConfig struct {
+	// Bot token, or a file containing it; disabled if both are empty
+	BotToken     string `mapstructure:"bot_token"`
+	BotTokenFile string `mapstructure:"bot_token_file"`
+	// Chat receiving the alerts: a numeric chat ID or @channelname
+	ChatID string `mapstructure:"chat_id"`
+	// Message template (Go text/template), a summary with the key fields if empty
+	Template string `mapstructure:"template"`
+	// Rules whose alerts are sent, all if empty
+	Rules []string `mapstructure:"rules"`
+}
+
+// Enabled reports whether the Telegram notifier is configured
+func (c TelegramConfig) Enabled() bool {
+	return c.BotToken != "" || c.BotTokenFile != ""
+}
+
+// DiscordConfig contains settings of the Discord notifier
+type DiscordConfig struct {
+	// Webhook URL, or a file containing it; disabled if both are empty
+	WebhookURL     string `mapstructure:"webhook_url"`
+	WebhookURLFile string `mapstructure:"webhook_url_file"`
+	// Template of the embed description (Go text/template), none if empty
+	Template string `mapstructure:"template"`
+	// Rules whose alerts are sent, all if empty
+	Rules []string `mapstructure:"rules"`
+}
+
+// Enabled reports whether the Discord notifier is configured
+func (c DiscordConfig) Enabled() bool {
+	return c.WebhookURL != "" || c.WebhookURLFile != ""
+}
+
+// PagerDutyConfig contains settings of the PagerDuty notifier
+type PagerDutyConfig struct {
+	// Integration key of an Events API v2 integration, or a file containing
+	// it; disabled if both are empty
+	RoutingKey     string `mapstructure:"routing_key"`
+	RoutingKeyFile string `mapstructure:"routing_key_file"`
+	// Minimum severity of the alerts sent: "info", "warning" or "critical"
+	MinSeverity string `mapstructure:"min_severity"`
+	// Rules whose alerts are sent, all if empty
+	Rules []string `mapstructure:"rules"`
+}
+
+// Enabled reports whether the PagerDuty notifier is configured
+func (c PagerDutyConfig) Enabled() bool {
+	return c.RoutingKey != "" || c.RoutingKeyFile != ""
+}
+
+// OpsgenieConfig contains settings of the Opsgenie notifier
+type OpsgenieConfig struct {
+	// Key of an API integration, or a file containing it; disabled if both are empty
+	APIKey     string `mapstructure:"api_key"`
+	APIKeyFile string `mapstructure:"api_key_file"`
+	// Base URL of the API, https://api.eu.opsgenie.com for the EU region
+	APIURL string `mapstructure:"api_url"`
+	// Template of the alert description (Go text/template), a summary with
+	// the key fields if empty
+	Template string `mapstructure:"template"`
+	// Minimum severity of the alerts sent: "info", "warning" or "critical"
+	MinSeverity string `mapstructure:"min_severity"`
+	// Rules whose alerts are sent, all if empty
+	Rules []string `mapstructure:"rules"`
+}
+
+// Enabled reports whether the Opsgenie notifier is configured
+func (c OpsgenieConfig) Enabled() bool {
+	return c.APIKey != "" || c.APIKeyFile != ""
+}
+
+// NtfyConfig contains settings of the ntfy notifier
+type NtfyConfig struct {
+	// Server URL, the public https://ntfy.sh by default
+	Server string `mapstructure:"server"`
+	// Topic the alerts are published to, disabled if empty
+	Topic string `mapstructure:"topic"`
+	// Access token of protected topics, or a file containing it
+	Token     string `mapstructure:"token"`
+	TokenFile string `mapstructure:"token_file"`
+	// Message template (Go text/template), a summary with the key fields if empty
+	Template string `mapstructure:"template"`
+	// Rules whose alerts are sent, all if empty
+	Rules []string `mapstructure:"rules"`
+}
+
+// Enabled reports whether the ntfy notifier is configured
+func (c NtfyConfig) Enabled() bool {
+	return c.Topic != ""
+}
+
+// PushoverConfig contains settings of the Pushover notifier
+type PushoverConfig struct {
+	// API token of the application, or a file containing it; disabled if both are empty
+	AppToken     string `mapstructure:"app_token"`
+	AppTokenFile string `mapstructure:"app_token_file"`
+	// User or group key receiving the alerts
+	UserKey string `mapstructure:"user_key"`
+	// Devices receiving the alerts, all devices of the user if empty
+	Device string `mapstructure:"device"`
+	// Message template (Go text/template), a summary with the key fields if empty
+	Template string `mapstructure:"template"`
+	// Rules whose alerts are sent, all if empty
+	Rules []string `mapstructure:"rules"`
+}
+
+// Enabled reports whether the Pushover notifier is configured
+func (c PushoverConfig) Enabled() bool {
+	return c.AppToken != "" || c.AppTokenFile != ""
+}
+
+// HeartbeatConfig contains settings of heartbeat events
+type HeartbeatConfig struct {
+	// Interval between heartbeat events, disabled if 0
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// AdminConfig contains settings of the admin HTTP server
+type AdminConfig struct {
+	// Address of the admin listener, e.g. "127.0.0.1:9090", disabled if empty
+	Listen string `mapstructure:"listen"`
+	// Serve net/http/pprof profiles under /debug/pprof/
+	Pprof bool `mapstructure:"pprof"`
+	// Number of recent sessions served under /sessions, disabled if 0 or
+	// without an admin token
+	Sessions int `mapstructure:"sessions"`
+	// Bearer token of the endpoints serving credentials: /sessions and the
+	// data of the dashboard
+	Token string `mapstructure:"token"`
+	// File containing the admin token, used if token is empty
+	TokenFile string `mapstructure:"token_file"`
+	// Bearer token of the live event stream under /stream, disabled if empty
+	StreamToken string `mapstructure:"stream_token"`
+	// File containing the stream token, used if stream_token is empty
+	StreamTokenFile string `mapstructure:"stream_token_file"`
+	// Serve the web dashboard under /dashboard/, requires the admin token
+	Dashboard bool `mapstructure:"dashboard"`
+}
+
+// HasToken reports whether the admin token is configured
+func (c AdminConfig) HasToken() bool {
+	return c.Token != "" || c.TokenFile != ""
+}
+
+// SessionsEnabled reports whether the sessions are served, which requires
+// the admin token as they contain passwords
+func (c AdminConfig) SessionsEnabled() bool {
+	return c.Sessions > 0 && c.HasToken()
+}
+
+// StreamEnabled reports whether the live event stream is served
+func (c AdminConfig) StreamEnabled() bool {
+	return c.StreamToken != "" || c.StreamTokenFile != ""
+}
+
+// AccessConfig contains settings of the handling of connections by source
+type AccessConfig struct {
+	// Addresses and CIDR ranges disconnected before the handshake
+	Denylist []string `mapstructure:"denylist"`
+	// Addresses and CIDR ranges never denied nor held in the tarpit
+	Allowlist []string `mapstructure:"allowlist"`
+	// Hold every authentication attempt for TarpitDelay
+	Tarpit bool `mapstructure:"tarpit"`
+	// Time an attempt is held in the tarpit
+	TarpitDelay time.Duration `mapstructure:"tarpit_delay"`
+	// Bounds of the random delay before an attempt is rejected
+	DelayMin time.Duration `mapstructure:"delay_min"`
+	DelayMax time.Duration `mapstructure:"delay_max"`
+}
+
+// APIConfig contains settings of the authenticated admin API
+type APIConfig struct {
+	// Address of the API listener, e.g. "127.0.0.1:9443", disabled if empty
+	Listen string `mapstructure:"listen"`
+	// Bearer token of clients, or a file containing it
+	Token     string `mapstructure:"token"`
+	TokenFile string `mapstructure:"token_file"`
+	// Server certificate and private key (PEM), plain HTTP if empty
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// CA certificates (PEM) of client certificates accepted instead of the token
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+// TracingConfig contains settings of the OTLP trace export
+type TracingConfig struct {
+	// Base URL of the OTLP/HTTP collector, disabled if empty
+	Endpoint string `mapstructure:"endpoint"`
+	// Headers added to export requests, e.g. for authentication
+	Headers map[string]string `mapstructure:"headers"`
+	// Share of connections traced, from 0 to 1
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+	// Maximum number of spans per export request
+	BatchSize int `mapstructure:"batch_size"`
+	// Maximum number of spans waiting for export
+	QueueSize int `mapstructure:"queue_size"`
+	// How often spans are exported
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// Timeout of a single export request
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// MetricsConfig contains settings of the metric exporters
+type MetricsConfig struct {
+	// StatsD/DogStatsD exporter
+	StatsD StatsDConfig `mapstructure:"statsd"`
+	// OTLP push exporter
+	OTLP OTLPMetricsConfig `mapstructure:"otlp"`
+}
+
+// OTLPMetricsConfig contains settings of the OTLP metrics exporter
+type OTLPMetricsConfig struct {
+	// Base URL of the OTLP/HTTP collector, disabled if empty
+	Endpoint string `mapstructure:"endpoint"`
+	// Headers added to export requests, e.g. for authentication
+	Headers map[string]string `mapstructure:"headers"`
+	// How often metrics are pushed
+	Interval time.Duration `mapstructure:"interval"`
+	// Timeout of a single export request
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// StatsDConfig contains settings of the StatsD exporter
+type StatsDConfig struct {
+	// UDP address of the StatsD server, disabled if empty
+	Address string `mapstructure:"address"`
+	// Prefix of metric names
+	Prefix string `mapstructure:"prefix"`
+	// Tags attached to every metric
+	Tags map[string]string `mapstructure:"tags"`
+	// Send tags in the DogStatsD format
+	DogStatsD bool `mapstructure:"dogstatsd"`
+	// How often buffered metrics are sent
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+}
+
+// EnrichmentConfig contains settings of the event enrichers
+type EnrichmentConfig struct {
+	// GeoIP location lookup
+	GeoIP MMDBConfig `mapstructure:"geoip"`
+	// Autonomous system lookup
+	ASN MMDBConfig `mapstructure:"asn"`
+	// Automatic MaxMind database updates
+	MaxMind MaxMindConfig `mapstructure:"maxmind"`
+	// Cache of reverse DNS and reputation results
+	Cache EnrichmentCacheConfig `mapstructure:"cache"`
+	// Reverse DNS lookup
+	RDNS RDNSConfig `mapstructure:"rdns"`
+	// Cloud and hosting provider tagging
+	Cloud CloudConfig `mapstructure:"cloud"`
+	// Reputation lookups
+	Reputation ReputationConfig `mapstructure:"reputation"`
+	// Blocklist membership tagging
+	Blocklists BlocklistsConfig `mapstructure:"blocklists"`
+	// Well-known credential tagging
+	Dictionaries DictionariesConfig `mapstructure:"dictionaries"`
+	// Add password length, entropy, character classes and patterns
+	PasswordAnalysis bool `mapstructure:"password_analysis"`
+	// Username classification
+	Usernames UsernamesConfig `mapstructure:"usernames"`
+	// Have I Been Pwned password check
+	HIBP HIBPConfig `mapstructure:"hibp"`
+	// First-seen/last-seen tracking of source addresses
+	Attackers AttackersConfig `mapstructure:"attackers"`
+	// Campaign clustering
+	Campaigns CampaignsConfig `mapstructure:"campaigns"`
+	// Password spray detection
+	Spray SprayConfig `mapstructure:"spray"`
+	// Attack surge detection
+	Surge SurgeConfig `mapstructure:"surge"`
+	// Indicator of compromise extraction
+	IOC IOCConfig `mapstructure:"ioc"`
+}
+
+// IOCConfig contains settings of the indicator of compromise extraction
+type IOCConfig struct {
+	// Emit ioc events for the URLs, addresses, domains and hashes in commands
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// SurgeConfig contains settings of the attack surge detection
+type SurgeConfig struct {
+	// Emit attack_surge events
+	Enabled bool `mapstructure:"enabled"`
+	// Length of the intervals attempts are counted in
+	Interval time.Duration `mapstructure:"interval"`
+	// Period of the rolling baseline
+	Baseline time.Duration `mapstructure:"baseline"`
+	// An interval is a surge when its attempts exceed this multiple of the baseline
+	Multiplier float64 `mapstructure:"multiplier"`
+	// Attempts an interval needs at least to be a surge
+	MinAttempts int `mapstructure:"min_attempts"`
+}
+
+// SprayConfig contains settings of the password spray detection
+type SprayConfig struct {
+	// Emit password_spray events
+	Enabled bool `mapstructure:"enabled"`
+	// Window in which the attempts of a spray are counted
+	Window time.Duration `mapstructure:"window"`
+	// Distinct usernames one password is tried with to be a spray
+	MinUsernames int `mapstructure:"min_usernames"`
+	// Distinct sources one username is tried from to be a spray
+	MinSources int `mapstructure:"min_sources"`
+	// Maximum number of tracked passwords and usernames each
+	MaxEntries int `mapstructure:"max_entries"`
+}
+
+// CampaignsConfig contains settings of the campaign clustering
+type CampaignsConfig struct {
+	// Attach campaign_id to attempts
+	Enabled bool `mapstructure:"enabled"`
+	// Attempts from a source before it is assigned to a campaign
+	MinAttempts int `mapstructure:"min_attempts"`
+	// How long sources and campaigns are remembered after their last attempt
+	Window time.Duration `mapstructure:"window"`
+	// Maximum number of tracked sources
+	MaxSources int `mapstructure:"max_sources"`
+}
+
+// AttackersConfig contains settings of the attacker tracking store
+type AttackersConfig struct {
+	// Attach new_attacker and attempt_number to attempts, and new_country and
+	// new_asn when GeoIP or ASN lookups are enabled
+	Enabled bool `mapstructure:"enabled"`
+	// Maximum number of tracked addresses, the least recently seen are dropped
+	MaxEntries int `mapstructure:"max_entries"`
+	// File the store is persisted to across restarts, in-memory only if empty
+	File string `mapstructure:"file"`
+	// How often the store is saved to the file
+	SaveInterval time.Duration `mapstructure:"save_interval"`
+}
+
+// HIBPConfig contains settings of the Pwned Passwords check
+type HIBPConfig struct {
+	// Check attempted passwords against Pwned Passwords
+	Enabled bool `mapstructure:"enabled"`
+	// Maximum number of concurrent queries
+	Concurrency int `mapstructure:"concurrency"`
+	// Timeout of a single query
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Number of cached passwords
+	CacheSize int `mapstructure:"cache_size"`
+	// How long results are cached
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+// UsernamesConfig contains settings of the username classification
+type UsernamesConfig struct {
+	// Attach the username category to attempts
+	Enabled bool `mapstructure:"enabled"`
+	// Classification rules checked in order, the built-in rules are used if empty
+	Rules []UsernameRuleConfig `mapstructure:"rules"`
+}
+
+// UsernameRuleConfig assigns a category to usernames from a list or matching a pattern
+type UsernameRuleConfig struct {
+	// Category attached to events
+	Category string `mapstructure:"category"`
+	// Usernames in this category, compared case-insensitively
+	Usernames []string `mapstructure:"usernames"`
+	// Regular expression matching usernames in this category
+	Pattern string `mapstructure:"pattern"`
+}
+
+// DictionariesConfig contains settings of the well-known credential tagging
+type DictionariesConfig struct {
+	// Tag attempts using credentials from the dictionaries
+	Enabled bool `mapstructure:"enabled"`
+	// Bundled dictionaries to use: "mirai" and "vendor"
+	Builtin []string `mapstructure:"builtin"`
+	// Custom dictionaries with one username:password pair per line
+	Custom []DictionaryConfig `mapstructure:"custom"`
+}
+
+// DictionaryConfig is a custom credential dictionary
+type DictionaryConfig struct {
+	// Dictionary name attached to events
+	Name string `mapstructure:"name"`
+	// URL or file path of the dictionary
+	URL string `mapstructure:"url"`
+}
+
+// BlocklistsConfig contains settings of the blocklist tagging
+type BlocklistsConfig struct {
+	// How often the lists are downloaded again
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+	// Blocklists, disabled if empty
+	Lists []BlocklistConfig `mapstructure:"lists"`
+}
+
+// BlocklistConfig is a single blocklist
+type BlocklistConfig struct {
+	// List name attached to events
+	Name string `mapstructure:"name"`
+	// URL or file path of the list
+	URL string `mapstructure:"url"`
+}
+
+// ReputationConfig contains settings of the reputation lookups
+type ReputationConfig struct {
+	// AbuseIPDB confidence score
+	AbuseIPDB AbuseIPDBConfig `mapstructure:"abuseipdb"`
+	// GreyNoise classification
+	GreyNoise GreyNoiseConfig `mapstructure:"greynoise"`
+	// Maximum number of concurrent queries per service
+	Concurrency int `mapstructure:"concurrency"`
+	// Timeout of a single query
+	Timeout time.Duration `mapstructure:"timeout"`
+	// How long results are cached
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+// AbuseIPDBConfig contains settings of the AbuseIPDB lookup
+type AbuseIPDBConfig struct {
+	// Query AbuseIPDB for new source addresses
+	Enabled bool `mapstructure:"enabled"`
+	// API key
+	APIKey string `mapstructure:"api_key"`
+	// File containing the API key, used if api_key is empty
+	APIKeyFile string `mapstructure:"api_key_file"`
+	// Only reports of this many last days are considered
+	MaxAgeDays int `mapstructure:"max_age_days"`
+}
+
+// GreyNoiseConfig contains settings of the GreyNoise lookup
+type GreyNoiseConfig struct {
+	// Query the GreyNoise community API for new source addresses
+	Enabled bool `mapstructure:"enabled"`
+	// API key, optional for the community API
+	APIKey string `mapstructure:"api_key"`
+	// File containing the API key, used if api_key is empty
+	APIKeyFile string `mapstructure:"api_key_file"`
+}
+
+// CloudConfig contains settings of the cloud provider tagging
+type CloudConfig struct {
+	// Tag events from published cloud provider ranges
+	Enabled bool `mapstructure:"enabled"`
+	// How often the ranges are downloaded again
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+	// Provider range lists, the built-in AWS, GCP and DigitalOcean lists are used if empty
+	Sources []CloudSourceConfig `mapstructure:"sources"`
+}
+
+// CloudSourceConfig is a list of networks operated by a provider
+type CloudSourceConfig struct {
+	// Provider name attached to events
+	Provider string `mapstructure:"provider"`
+	// URL or file path of the list
+	URL string `mapstructure:"url"`
+	// List format: "aws", "gcp", "azure" or "text"
+	Format string `mapstructure:"format"`
+}
+
+// UsesCache reports whether an enricher using the shared cache is enabled
+func (c EnrichmentConfig) UsesCache() bool {
+	return c.RDNS.Enabled || c.Reputation.AbuseIPDB.Enabled || c.Reputation.GreyNoise.Enabled
+}
+
+// EnrichmentCacheConfig contains settings of the cache shared by the
+// enrichers querying other services
+type EnrichmentCacheConfig struct {
+	// Number of cached results
+	Size int `mapstructure:"size"`
+	// File the cache is persisted to, in-memory only if empty
+	File string `mapstructure:"file"`
+	// How often the cache is saved to the file
+	SaveInterval time.Duration `mapstructure:"save_interval"`
+}
+
+// RDNSConfig contains settings of the reverse DNS enricher
+type RDNSConfig struct {
+	// Resolve PTR records of source addresses
+	Enabled bool `mapstructure:"enabled"`
+	// Maximum number of concurrent lookups
+	Concurrency int `mapstructure:"concurrency"`
+	// Timeout of a single lookup
+	Timeout time.Duration `mapstructure:"timeout"`
+	// How long results are cached
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+// MMDBConfig contains settings of an enricher using a MaxMind database
+type MMDBConfig struct {
+	// Path to the database, disabled if empty
+	Database string `mapstructure:"database"`
+	// How often the database file is checked for changes, 0 disables reloading
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+	// MaxMind edition ID of the database, used for automatic updates
+	Edition string `mapstructure:"edition"`
+}
+
+// MaxMindConfig contains the MaxMind account used to update the databases
+type MaxMindConfig struct {
+	// Account ID
+	AccountID string `mapstructure:"account_id"`
+	// License key, updates are disabled if empty
+	LicenseKey string `mapstructure:"license_key"`
+	// File containing the license key, used if license_key is empty
+	LicenseKeyFile string `mapstructure:"license_key_file"`
+	// How often the databases are checked for updates
+	UpdateInterval time.Duration `mapstructure:"update_interval"`
+}
+
+// Enabled reports whether databases are downloaded automatically
+func (c MaxMindConfig) Enabled() bool {
+	return c.LicenseKey != "" || c.LicenseKeyFile != ""
+}
+
+// validate checks the database settings of the named enricher. Databases
+// that are downloaded automatically do not have to exist yet.
+func (c MMDBConfig) validate(name string, downloaded bool) error {
+	if downloaded {
+		if c.Database != "" && c.Edition == "" {
+			return fmt.Errorf("invalid %s settings: edition is required for automatic updates", name)
+		}
+	} else if c.Database != "" {
+		if _, err := os.Stat(c.Database); err != nil {
+			return fmt.Errorf("invalid %s database: %w", name, err)
+		}
+	}
+	if c.ReloadInterval < 0 {
+		return fmt.Errorf("invalid %s reload interval: must not be negative", name)
+	}
+	return nil
+}
+
+// PrivacyConfig contains settings controlling how sensitive data is logged
+type PrivacyConfig struct {
+	// Password mode: "plain", "sha256", "hmac", "truncate" or "redact"
+	PasswordMode string `mapstructure:"password_mode"`
+	// Salt (sha256) or key (hmac) for password hashing
+	PasswordKey string `mapstructure:"password_key"`
+	// File containing the password salt or key, used if password_key is empty
+	PasswordKeyFile string `mapstructure:"password_key_file"`
+	// Number of characters kept in truncate mode
+	PasswordTruncate int `mapstructure:"password_truncate"`
+	// IP anonymization mode: "none", "truncate" or "cryptopan"
+	IPMode string `mapstructure:"ip_mode"`
+	// Key for cryptopan IP anonymization
+	IPKey string `mapstructure:"ip_key"`
+	// File containing the cryptopan key, used if ip_key is empty
+	IPKeyFile string `mapstructure:"ip_key_file"`
 }
 
 // LogConfig contains logging settings
@@ -48,6 +1052,91 @@ type LogConfig struct {
 	File string `mapstructure:"file"`
 	// Log format: "json" or "pretty"
 	Format string `mapstructure:"format"`
+	// Timestamp format: "rfc3339", "rfc3339nano", "unix", "unixms" or a Go time layout
+	TimeFormat string `mapstructure:"time_format"`
+	// Timezone of timestamps: "UTC", "Local" or an IANA name
+	Timezone string `mapstructure:"timezone"`
+	// Window in which identical attempts are collapsed into one event, 0 to disable
+	AggregateWindow time.Duration `mapstructure:"aggregate_window"`
+	// Path to the file used when all sinks are failing, empty to disable
+	EmergencyFile string `mapstructure:"emergency_file"`
+	// Key for the tamper-evident HMAC chain of JSON log files, disabled if empty
+	ChainKey string `mapstructure:"chain_key"`
+	// File containing the HMAC chain key, used if chain_key is empty
+	ChainKeyFile string `mapstructure:"chain_key_file"`
+	// Encryption of log files at rest
+	Encryption EncryptionConfig `mapstructure:"encryption"`
+	// Field selection and renaming for the main log
+	FieldsConfig `mapstructure:",squash"`
+	// Additional log destinations
+	Sinks []SinkConfig `mapstructure:"sinks"`
+}
+
+// OpsLogConfig contains settings for operational messages (startup, errors,
+// connections), which are kept apart from credential events
+type OpsLogConfig struct {
+	// "stderr", "stdout" or path to a log file
+	File string `mapstructure:"file"`
+	// Minimum level: "debug", "info", "warn" or "error"
+	Level string `mapstructure:"level"`
+	// Log format: "json" or "pretty"
+	Format string `mapstructure:"format"`
+}
+
+// SinkConfig contains settings for an additional log destination
+type SinkConfig struct {
+	// Sink type: "file" or "stdout"
+	Type string `mapstructure:"type"`
+	// Path to log file for file sinks
+	Path string `mapstructure:"path"`
+	// Log format: "json" or "pretty"
+	Format string `mapstructure:"format"`
+	// Field selection and renaming
+	FieldsConfig `mapstructure:",squash"`
+}
+
+// EncryptionConfig contains settings for encrypting log files at rest
+type EncryptionConfig struct {
+	// age X25519 recipients (age1...), encryption is disabled if empty
+	Recipients []string `mapstructure:"recipients"`
+	// File with one recipient per line
+	RecipientsFile string `mapstructure:"recipients_file"`
+	// Number of records after which an encrypted segment is finished
+	SegmentRecords int `mapstructure:"segment_records"`
+	// Time after which an encrypted segment is finished
+	SegmentInterval time.Duration `mapstructure:"segment_interval"`
+}
+
+// LoadRecipients returns the configured recipients together with the ones
+// listed in the recipients file
+func (c EncryptionConfig) LoadRecipients() ([]string, error) {
+	recipients := append([]string{}, c.Recipients...)
+	if c.RecipientsFile == "" {
+		return recipients, nil
+	}
+
+	data, err := os.ReadFile(c.RecipientsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipients file: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		recipients = append(recipients, line)
+	}
+	return recipients, nil
+}
+
+// FieldsConfig selects which event fields are emitted and under what names
+type FieldsConfig struct {
+	// Fields to emit, all fields if empty
+	Fields []string `mapstructure:"fields"`
+	// Fields to drop
+	Exclude []string `mapstructure:"exclude"`
+	// Output names of fields, keyed by the original name
+	Rename map[string]string `mapstructure:"rename"`
 }
 
 // DefaultConfig returns the default configuration
@@ -55,94 +1144,1647 @@ func DefaultConfig() *Config {
 	return &Config{
 		Port: 2222,
 		Log: LogConfig{
-			File:   "credentials.log",
+			File:          "credentials.log",
+			Format:        "json",
+			TimeFormat:    "rfc3339",
+			Timezone:      "UTC",
+			EmergencyFile: "credentials.emergency.log",
+			Encryption: EncryptionConfig{
+				SegmentRecords:  100,
+				SegmentInterval: time.Minute,
+			},
+		},
+		OpsLog: OpsLogConfig{
+			File:   "stderr",
+			Level:  "info",
 			Format: "json",
 		},
-		Banner:         "Ubuntu-4ubuntu0.5",
-		ServerVersion:  "OpenSSH_8.2p1",
-		PrivateKeyPath: "",
-		GenerateKey:    true,
+		Banner:          "Ubuntu-4ubuntu0.5",
+		ServerVersion:   "OpenSSH_8.2p1",
+		PrivateKeyPath:  "",
+		GenerateKey:     true,
+		ShutdownTimeout: 10 * time.Second,
+		Sandbox: SandboxConfig{
+			SeccompAction: "errno",
+		},
+		Sensor: SensorConfig{
+			IDFile: "sensor-id",
+		},
+		Privacy: PrivacyConfig{
+			PasswordMode:     "plain",
+			PasswordTruncate: 3,
+			IPMode:           "none",
+		},
+		Enrichment: EnrichmentConfig{
+			GeoIP: MMDBConfig{
+				ReloadInterval: time.Minute,
+				Edition:        "GeoLite2-City",
+			},
+			ASN: MMDBConfig{
+				ReloadInterval: time.Minute,
+				Edition:        "GeoLite2-ASN",
+			},
+			MaxMind: MaxMindConfig{
+				UpdateInterval: 24 * time.Hour,
+			},
+			Cache: EnrichmentCacheConfig{
+				Size:         100000,
+				SaveInterval: 5 * time.Minute,
+			},
+			RDNS: RDNSConfig{
+				Concurrency: 16,
+				Timeout:     2 * time.Second,
+				CacheTTL:    time.Hour,
+			},
+			Cloud: CloudConfig{
+				RefreshInterval: 24 * time.Hour,
+			},
+			Reputation: ReputationConfig{
+				AbuseIPDB: AbuseIPDBConfig{
+					MaxAgeDays: 90,
+				},
+				Concurrency: 4,
+				Timeout:     5 * time.Second,
+				CacheTTL:    24 * time.Hour,
+			},
+			Blocklists: BlocklistsConfig{
+				RefreshInterval: time.Hour,
+			},
+			Dictionaries: DictionariesConfig{
+				Builtin: []string{"mirai", "vendor"},
+			},
+			HIBP: HIBPConfig{
+				Concurrency: 4,
+				Timeout:     5 * time.Second,
+				CacheSize:   100000,
+				CacheTTL:    24 * time.Hour,
+			},
+			Attackers: AttackersConfig{
+				MaxEntries:   100000,
+				SaveInterval: 5 * time.Minute,
+			},
+			Campaigns: CampaignsConfig{
+				MinAttempts: 3,
+				Window:      24 * time.Hour,
+				MaxSources:  100000,
+			},
+			Spray: SprayConfig{
+				Window:       time.Hour,
+				MinUsernames: 10,
+				MinSources:   10,
+				MaxEntries:   100000,
+			},
+			Surge: SurgeConfig{
+				Interval:    time.Minute,
+				Baseline:    24 * time.Hour,
+				Multiplier:  5,
+				MinAttempts: 100,
+			},
+		},
+		Access: AccessConfig{
+			TarpitDelay: 30 * time.Second,
+			DelayMin:    200 * time.Millisecond,
+			DelayMax:    500 * time.Millisecond,
+		},
+		Admin: AdminConfig{
+			Sessions: 1000,
+		},
+		Metrics: MetricsConfig{
+			StatsD: StatsDConfig{
+				Prefix:        "fakessh.",
+				DogStatsD:     true,
+				FlushInterval: time.Second,
+			},
+			OTLP: OTLPMetricsConfig{
+				Interval: time.Minute,
+				Timeout:  10 * time.Second,
+			},
+		},
+		Alerts: AlertsConfig{
+			ThresholdWindow: time.Hour,
+			QueueSize:       1000,
+			Timeout:         10 * time.Second,
+			Email: EmailConfig{
+				Port:           587,
+				Security:       "starttls",
+				Mode:           EmailAlerts,
+				DigestInterval: 24 * time.Hour,
+				DigestTop:      10,
+			},
+			PagerDuty: PagerDutyConfig{
+				MinSeverity: "warning",
+			},
+			Opsgenie: OpsgenieConfig{
+				APIURL:      "https://api.opsgenie.com",
+				MinSeverity: "warning",
+			},
+			Ntfy: NtfyConfig{
+				Server: "https://ntfy.sh",
+			},
+		},
+		Reports: ReportsConfig{
+			Timezone: "UTC",
+			Period:   24 * time.Hour,
+			Format:   ReportHTML,
+			Title:    "fakessh report",
+			Top:      10,
+		},
+		Collector: CollectorConfig{
+			Listen:        ":8443",
+			MaxBatchBytes: 10 << 20,
+			RecentIDs:     100000,
+
+			CorrelationWindow:    24 * time.Hour,
+			MaxCorrelatedSources: 100000,
+			FleetDenylist:        FleetDenylistConfig{Action: FleetDeny},
+		},
+		Forward: ForwardConfig{
+			SpoolDir:      "spool",
+			MaxSpoolBytes: 1 << 30,
+			BatchSize:     500,
+			FlushInterval: time.Second,
+			Timeout:       10 * time.Second,
+			FleetInterval: time.Minute,
+
+			ProfileInterval: 5 * time.Minute,
+		},
+		Tracing: TracingConfig{
+			SampleRatio:   1,
+			BatchSize:     512,
+			QueueSize:     4096,
+			FlushInterval: 5 * time.Second,
+			Timeout:       10 * time.Second,
+		},
 	}
 }
 
-// LoadConfig loads configuration from file and/or environment variables
-func LoadConfig(configPath string) (*Config, error) {
-	config := DefaultConfig()
+// UnknownKeys returns the keys of a configuration file that match no
+// setting, like "server-version" or "log.sinks[0].pth", in key order
+func UnknownKeys(configPath string) ([]string, error) {
+	v := viper.New()
+	v.SetConfigFile(configPath)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading configuration file: %w", err)
+	}
+	var metadata mapstructure.Metadata
+	if err := v.Unmarshal(DefaultConfig(), decodeStrict(&metadata)); err != nil {
+		return nil, fmt.Errorf("error parsing configuration: %w", err)
+	}
+	slices.Sort(metadata.Unused)
+	return metadata.Unused, nil
+}
 
-	if configPath != "" {
-		// Use viper to read configuration
-		viper.SetConfigFile(configPath)
+// decodeStrict records the keys that match no setting in metadata
+func decodeStrict(metadata *mapstructure.Metadata) viper.DecoderConfigOption {
+	return func(c *mapstructure.DecoderConfig) {
+		c.Metadata = metadata
+	}
+}
 
-		if err := viper.ReadInConfig(); err != nil {
-			return nil, fmt.Errorf("error reading configuration file: %w", err)
+// unknownKeysError describes the unknown keys of a configuration of type t,
+// suggesting the closest valid key for each or listing the valid keys
+func unknownKeysError(keys []string, t reflect.Type) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	slices.Sort(keys)
+	descriptions := make([]string, len(keys))
+	for i, key := range keys {
+		parent, name := "", key
+		if i := strings.LastIndexByte(key, '.'); i >= 0 {
+			parent, name = key[:i+1], key[i+1:]
 		}
-
-		if err := viper.Unmarshal(config); err != nil {
-			return nil, fmt.Errorf("error parsing configuration: %w", err)
+		valid := validKeys(t, parent)
+		if suggestion := closestKey(name, valid); suggestion != "" {
+			descriptions[i] = fmt.Sprintf("%q (did you mean %q?)", key, parent+suggestion)
+		} else {
+			descriptions[i] = fmt.Sprintf("%q (valid keys: %s)", key, strings.Join(valid, ", "))
 		}
 	}
+	return fmt.Errorf("unknown keys %s", strings.Join(descriptions, ", "))
+}
 
-	// Override through environment variables
-	viper.SetEnvPrefix("FAKESSH")
-	viper.AutomaticEnv()
-
-	if viper.IsSet("PORT") {
-		config.Port = viper.GetInt("PORT")
+// validKeys returns the keys of the settings under a dotted prefix like
+// "log.sinks[0]." of a configuration of type t, in key order
+func validKeys(t reflect.Type, prefix string) []string {
+	for _, name := range strings.Split(strings.TrimSuffix(prefix, "."), ".") {
+		if name == "" {
+			continue
+		}
+		name, _, _ = strings.Cut(name, "[")
+		field, ok := settingField(t, name)
+		if !ok {
+			return nil
+		}
+		t = field.Type
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
 	}
-
-	if viper.IsSet("LOG_FILE") {
-		config.Log.File = viper.GetString("LOG_FILE")
+	if t.Kind() != reflect.Struct {
+		return nil
 	}
-
-	if viper.IsSet("LOG_FORMAT") {
-		config.Log.Format = viper.GetString("LOG_FORMAT")
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, opts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if opts == "squash" {
+			keys = append(keys, validKeys(field.Type, "")...)
+		} else if key != "" && key != "-" && field.IsExported() {
+			keys = append(keys, key)
+		}
 	}
+	slices.Sort(keys)
+	return keys
+}
 
-	if viper.IsSet("BANNER") {
-		config.Banner = viper.GetString("BANNER")
+// settingField returns the field of struct type t with the key, looking into
+// squashed fields
+func settingField(t reflect.Type, key string) (reflect.StructField, bool) {
+	if t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
 	}
-
-	if viper.IsSet("SERVER_VERSION") {
-		config.ServerVersion = viper.GetString("SERVER_VERSION")
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if opts == "squash" {
+			if f, ok := settingField(field.Type, key); ok {
+				return f, true
+			}
+		} else if name == key {
+			return field, true
+		}
 	}
+	return reflect.StructField{}, false
+}
 
-	if viper.IsSet("PRIVATE_KEY_PATH") {
-		config.PrivateKeyPath = viper.GetString("PRIVATE_KEY_PATH")
+// closestKey returns the valid key a misspelled key most likely meant, or ""
+// if none is close enough
+func closestKey(key string, valid []string) string {
+	normalized := strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	// Allow a typo for short keys and two for longer ones
+	best, bestDistance := "", max(1, min(len(normalized)/4, 2))+1
+	for _, v := range valid {
+		if d := editDistance(normalized, v); d < bestDistance {
+			best, bestDistance = v, d
+		}
 	}
+	return best
+}
 
-	if viper.IsSet("GENERATE_KEY") {
-		config.GenerateKey = viper.GetBool("GENERATE_KEY")
+// editDistance returns the number of insertions, deletions, substitutions
+// and transpositions of adjacent characters turning a into b
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
 	}
-
-	return config, nil
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
 }
 
-// Validate checks the configuration validity
-func (c *Config) Validate() error {
-	// Check port range
-	if c.Port < 0 {
-		return fmt.Errorf("invalid port: must be positive")
+// readLayers returns the settings of a configuration file merged over those
+// of the files it includes, in order. including lists the files including
+// it, to detect cycles.
+func readLayers(path string, including []string) (map[string]interface{}, error) {
+	if slices.Contains(including, path) {
+		return nil, fmt.Errorf("configuration files include each other: %s", strings.Join(append(including, path), " -> "))
 	}
-	if c.Port > 65535 {
-		return fmt.Errorf("invalid port: must be less than 65536")
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading configuration file: %w", err)
 	}
-
-	// Check log format
-	if c.Log.Format != "json" && c.Log.Format != "pretty" && c.Log.Format != "text" {
-		return fmt.Errorf("invalid log format: must be 'json', 'pretty', or 'text'")
+	includes := v.GetStringSlice("includes")
+	if len(includes) == 0 {
+		return v.AllSettings(), nil
 	}
 
-	// If a private key path is specified, check that it exists and is readable
-	if c.PrivateKeyPath != "" && !c.GenerateKey {
-		if _, err := os.Stat(c.PrivateKeyPath); os.IsNotExist(err) {
-			return fmt.Errorf("private key not found: %s", c.PrivateKeyPath)
+	merged := viper.New()
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		paths := []string{include}
+		if strings.ContainsAny(include, "*?[") {
+			var err error
+			if paths, err = filepath.Glob(include); err != nil {
+				return nil, fmt.Errorf("invalid include pattern %s: %w", include, err)
+			}
+		}
+		for _, p := range paths {
+			settings, err := readLayers(p, append(including, path))
+			if err != nil {
+				return nil, err
+			}
+			if err := merged.MergeConfigMap(settings); err != nil {
+				return nil, fmt.Errorf("error merging %s: %w", p, err)
+			}
 		}
 	}
-
-	return nil
+	if err := merged.MergeConfigMap(v.AllSettings()); err != nil {
+		return nil, fmt.Errorf("error merging %s: %w", path, err)
+	}
+	return merged.AllSettings(), nil
 }
 
-// GetFullServerVersion returns the full SSH server version string
+// LoadConfig loads configuration from file and/or environment variables
+func LoadConfig(configPath string) (*Config, error) {
+	return LoadConfigFlags(configPath, nil)
+}
+
+// LoadConfigFlags loads the configuration like LoadConfig, with the flags
+// added by AddFlag and AddFlags that were given taking precedence. Relative
+// paths are resolved against the state directory once all are set.
+func LoadConfigFlags(configPath string, flags *pflag.FlagSet) (*Config, error) {
+	config := DefaultConfig()
+
+	if configPath != "" {
+		// Use viper to read configuration
+		viper.SetConfigFile(configPath)
+
+		if err := viper.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("error reading configuration file: %w", err)
+		}
+		if viper.IsSet("includes") {
+			settings, err := readLayers(configPath, nil)
+			if err != nil {
+				return nil, err
+			}
+			if err := viper.MergeConfigMap(settings); err != nil {
+				return nil, fmt.Errorf("error merging included files: %w", err)
+			}
+		}
+
+		var metadata mapstructure.Metadata
+		if err := viper.Unmarshal(config, decodeStrict(&metadata)); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+		}
+		if err := unknownKeysError(metadata.Unused, reflect.TypeOf(*config)); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+		}
+		// Secrets of external stores are read once, at load time
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err := expandValues(ctx, reflect.ValueOf(config).Elem(), "", secrets.NewResolver())
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing configuration: %w", err)
+		}
+	}
+
+	// Override through environment variables, then command line flags
+	if err := applyEnv(config); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+	if flags != nil {
+		ApplyFlags(config, flags)
+	}
+
+	config.resolveStatePaths()
+	return config, nil
+}
+
+// statePaths returns the settings of the files the server keeps
+func (c *Config) statePaths() []*string {
+	paths := []*string{
+		&c.PrivateKeyPath, &c.Sensor.IDFile, &c.Log.File, &c.Log.EmergencyFile, &c.OpsLog.File,
+		&c.Enrichment.GeoIP.Database, &c.Enrichment.ASN.Database,
+		&c.Enrichment.Cache.File, &c.Enrichment.Attackers.File, &c.Forward.SpoolDir,
+	}
+	for i := range c.Log.Sinks {
+		paths = append(paths, &c.Log.Sinks[i].Path)
+	}
+	return paths
+}
+
+// resolveStatePaths makes the relative paths of the files the server keeps
+// relative to the state directory
+func (c *Config) resolveStatePaths() {
+	if c.StateDir == "" {
+		return
+	}
+	for _, path := range c.statePaths() {
+		if *path != "" && *path != "stdout" && *path != "stderr" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(c.StateDir, *path)
+		}
+	}
+}
+
+// Validate checks the configuration validity. Its errors wrap
+// ErrConfigInvalid.
+func (c *Config) Validate() error {
+	if err := c.validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+	return nil
+}
+
+// validate checks the settings one at a time
+func (c *Config) validate() error {
+	// Check port range
+	if c.Port < 0 {
+		return fmt.Errorf("invalid port: must be positive")
+	}
+	if c.Port > 65535 {
+		return fmt.Errorf("invalid port: must be less than 65536")
+	}
+
+	// Check log format
+	if c.Log.Format != "json" && c.Log.Format != "pretty" && c.Log.Format != "text" {
+		return fmt.Errorf("invalid log format: must be 'json', 'pretty', or 'text'")
+	}
+
+	// Check timestamp timezone
+	if c.Log.Timezone != "" {
+		if _, err := time.LoadLocation(c.Log.Timezone); err != nil {
+			return fmt.Errorf("invalid log timezone: %w", err)
+		}
+	}
+
+	if c.Log.AggregateWindow < 0 {
+		return fmt.Errorf("invalid aggregation window: must not be negative")
+	}
+
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("invalid shutdown timeout: must not be negative")
+	}
+	if c.StateDir != "" {
+		if info, err := os.Stat(c.StateDir); err != nil {
+			return fmt.Errorf("invalid state directory: %w", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("invalid state directory: %s is not a directory", c.StateDir)
+		}
+	}
+	if c.Sandbox.Chroot != "" && !filepath.IsAbs(c.Sandbox.Chroot) {
+		return fmt.Errorf("invalid sandbox chroot: must be an absolute path")
+	}
+	switch c.Sandbox.SeccompAction {
+	case "", "errno", "kill", "log":
+	default:
+		return fmt.Errorf("invalid sandbox seccomp action: must be 'errno', 'kill', or 'log'")
+	}
+
+	// Check operational log settings
+	switch c.OpsLog.Level {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("invalid operational log level: must be 'debug', 'info', 'warn', or 'error'")
+	}
+	if c.OpsLog.Format != "" && c.OpsLog.Format != "json" && c.OpsLog.Format != "pretty" {
+		return fmt.Errorf("invalid operational log format: must be 'json' or 'pretty'")
+	}
+
+	// HMAC chaining works on JSON records only
+	chained := c.Log.ChainKey != "" || c.Log.ChainKeyFile != ""
+	if chained && c.Log.File != "stdout" && c.Log.Format == "pretty" {
+		return fmt.Errorf("invalid log settings: HMAC chaining requires json or text format")
+	}
+
+	// Check encryption
+	for _, r := range c.Log.Encryption.Recipients {
+		if !strings.HasPrefix(strings.TrimSpace(r), "age1") {
+			return fmt.Errorf("invalid encryption recipient '%s': must be an age X25519 public key", r)
+		}
+	}
+	if c.Log.Encryption.SegmentRecords < 0 || c.Log.Encryption.SegmentInterval < 0 {
+		return fmt.Errorf("invalid encryption settings: segment limits must not be negative")
+	}
+
+	// Check additional sinks
+	for i, sink := range c.Log.Sinks {
+		switch sink.Type {
+		case "file":
+			if sink.Path == "" {
+				return fmt.Errorf("invalid sink #%d: file sink requires a path", i+1)
+			}
+		case "stdout":
+		default:
+			return fmt.Errorf("invalid sink #%d: type must be 'file' or 'stdout'", i+1)
+		}
+		if sink.Format != "" && sink.Format != "json" && sink.Format != "pretty" && sink.Format != "text" {
+			return fmt.Errorf("invalid sink #%d: format must be 'json', 'pretty', or 'text'", i+1)
+		}
+		if chained && sink.Type == "file" && (sink.Format == "pretty" || sink.Format == "" && c.Log.Format == "pretty") {
+			return fmt.Errorf("invalid sink #%d: HMAC chaining requires json or text format", i+1)
+		}
+	}
+
+	// Check tags
+	for k := range c.Tags {
+		if strings.TrimSpace(k) == "" {
+			return fmt.Errorf("invalid tag: key must not be empty")
+		}
+		if reservedFields[k] {
+			return fmt.Errorf("invalid tag: '%s' is a reserved event field", k)
+		}
+	}
+
+	// Check sensor identity
+	if id := c.Sensor.ID; id != "" {
+		if !validSensorID.MatchString(id) {
+			return fmt.Errorf("invalid sensor ID '%s': letters, digits, '.', '_', ':' and '-' only", id)
+		}
+		if tag := c.Tags["sensor_id"]; tag != "" && tag != id {
+			return fmt.Errorf("invalid sensor identity: sensor.id and the sensor_id tag differ")
+		}
+	}
+
+	// Check password privacy mode
+	switch c.Privacy.PasswordMode {
+	case "", "plain", "sha256", "redact":
+	case "hmac":
+		if c.Privacy.PasswordKey == "" && c.Privacy.PasswordKeyFile == "" {
+			return fmt.Errorf("invalid privacy settings: hmac password mode requires password_key or password_key_file")
+		}
+	case "truncate":
+		if c.Privacy.PasswordTruncate < 0 {
+			return fmt.Errorf("invalid privacy settings: password_truncate must not be negative")
+		}
+	default:
+		return fmt.Errorf("invalid password mode: must be 'plain', 'sha256', 'hmac', 'truncate', or 'redact'")
+	}
+
+	// Check IP anonymization mode
+	switch c.Privacy.IPMode {
+	case "", "none", "truncate":
+	case "cryptopan":
+		if c.Privacy.IPKey == "" && c.Privacy.IPKeyFile == "" {
+			return fmt.Errorf("invalid privacy settings: cryptopan IP mode requires ip_key or ip_key_file")
+		}
+	default:
+		return fmt.Errorf("invalid IP mode: must be 'none', 'truncate', or 'cryptopan'")
+	}
+
+	// Check enrichment databases
+	maxMind := c.Enrichment.MaxMind
+	if err := c.Enrichment.GeoIP.validate("GeoIP", maxMind.Enabled()); err != nil {
+		return err
+	}
+	if err := c.Enrichment.ASN.validate("ASN", maxMind.Enabled()); err != nil {
+		return err
+	}
+	if maxMind.Enabled() {
+		if maxMind.AccountID == "" {
+			return fmt.Errorf("invalid MaxMind settings: account_id is required for automatic updates")
+		}
+		if maxMind.UpdateInterval < 0 {
+			return fmt.Errorf("invalid MaxMind settings: update_interval must not be negative")
+		}
+	}
+
+	// Check enrichment cache settings
+	if c.Enrichment.UsesCache() && c.Enrichment.Cache.Size <= 0 {
+		return fmt.Errorf("invalid enrichment cache settings: size must be positive")
+	}
+	if c.Enrichment.Cache.SaveInterval < 0 {
+		return fmt.Errorf("invalid enrichment cache settings: save_interval must not be negative")
+	}
+
+	// Check reverse DNS settings
+	if c.Enrichment.RDNS.Enabled {
+		if c.Enrichment.RDNS.Concurrency <= 0 {
+			return fmt.Errorf("invalid reverse DNS settings: concurrency must be positive")
+		}
+		if c.Enrichment.RDNS.Timeout <= 0 {
+			return fmt.Errorf("invalid reverse DNS settings: timeout must be positive")
+		}
+		if c.Enrichment.RDNS.CacheTTL < 0 {
+			return fmt.Errorf("invalid reverse DNS settings: cache_ttl must not be negative")
+		}
+	}
+
+	// Check reputation lookups
+	reputation := c.Enrichment.Reputation
+	if reputation.AbuseIPDB.Enabled || reputation.GreyNoise.Enabled {
+		if reputation.AbuseIPDB.Enabled && reputation.AbuseIPDB.APIKey == "" && reputation.AbuseIPDB.APIKeyFile == "" {
+			return fmt.Errorf("invalid reputation settings: AbuseIPDB requires api_key or api_key_file")
+		}
+		if reputation.AbuseIPDB.Enabled && reputation.AbuseIPDB.MaxAgeDays <= 0 {
+			return fmt.Errorf("invalid reputation settings: max_age_days must be positive")
+		}
+		if reputation.Concurrency <= 0 || reputation.Timeout <= 0 {
+			return fmt.Errorf("invalid reputation settings: concurrency and timeout must be positive")
+		}
+		if reputation.CacheTTL < 0 {
+			return fmt.Errorf("invalid reputation settings: cache_ttl must not be negative")
+		}
+	}
+
+	// Check blocklists
+	if c.Enrichment.Blocklists.RefreshInterval < 0 {
+		return fmt.Errorf("invalid blocklist settings: refresh_interval must not be negative")
+	}
+	blocklists := make(map[string]bool)
+	for i, list := range c.Enrichment.Blocklists.Lists {
+		if list.Name == "" || list.URL == "" {
+			return fmt.Errorf("invalid blocklist #%d: name and url are required", i+1)
+		}
+		if blocklists[list.Name] {
+			return fmt.Errorf("invalid blocklist #%d: duplicate name '%s'", i+1, list.Name)
+		}
+		blocklists[list.Name] = true
+	}
+
+	// Check credential dictionaries
+	dictionaries := make(map[string]bool)
+	for _, name := range c.Enrichment.Dictionaries.Builtin {
+		dictionaries[name] = true
+	}
+	for i, dict := range c.Enrichment.Dictionaries.Custom {
+		if dict.Name == "" || dict.URL == "" {
+			return fmt.Errorf("invalid dictionary #%d: name and url are required", i+1)
+		}
+		if dictionaries[dict.Name] {
+			return fmt.Errorf("invalid dictionary #%d: duplicate name '%s'", i+1, dict.Name)
+		}
+		dictionaries[dict.Name] = true
+	}
+
+	// Check Pwned Passwords settings
+	if hibp := c.Enrichment.HIBP; hibp.Enabled {
+		if hibp.Concurrency <= 0 || hibp.Timeout <= 0 || hibp.CacheSize <= 0 {
+			return fmt.Errorf("invalid HIBP settings: concurrency, timeout and cache_size must be positive")
+		}
+		if hibp.CacheTTL < 0 {
+			return fmt.Errorf("invalid HIBP settings: cache_ttl must not be negative")
+		}
+	}
+
+	// Check attacker tracking settings
+	if attackers := c.Enrichment.Attackers; attackers.Enabled {
+		if attackers.MaxEntries <= 0 {
+			return fmt.Errorf("invalid attacker tracking settings: max_entries must be positive")
+		}
+		if attackers.SaveInterval < 0 {
+			return fmt.Errorf("invalid attacker tracking settings: save_interval must not be negative")
+		}
+	}
+
+	// Check campaign clustering settings
+	if campaigns := c.Enrichment.Campaigns; campaigns.Enabled {
+		if campaigns.MinAttempts < 2 {
+			return fmt.Errorf("invalid campaign settings: min_attempts must be at least 2")
+		}
+		if campaigns.Window <= 0 || campaigns.MaxSources <= 0 {
+			return fmt.Errorf("invalid campaign settings: window and max_sources must be positive")
+		}
+	}
+
+	// Check admin listener
+	if c.Admin.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Admin.Listen); err != nil {
+			return fmt.Errorf("invalid admin listen address '%s': %w", c.Admin.Listen, err)
+		}
+	} else if c.Admin.Pprof {
+		return fmt.Errorf("pprof requires an admin listen address")
+	} else if c.Admin.StreamEnabled() {
+		return fmt.Errorf("the event stream requires an admin listen address")
+	} else if c.Admin.Dashboard {
+		return fmt.Errorf("the dashboard requires an admin listen address")
+	}
+	if c.Admin.Dashboard && !c.Admin.HasToken() {
+		return fmt.Errorf("the dashboard requires admin.token or admin.token_file")
+	}
+	if c.Admin.Sessions < 0 {
+		return fmt.Errorf("number of admin sessions cannot be negative")
+	}
+
+	// Check connection handling and the admin API
+	for _, entry := range c.Access.Denylist {
+		if err := validateAddressOrRange(entry); err != nil {
+			return fmt.Errorf("invalid denylist entry: %w", err)
+		}
+	}
+	for _, entry := range c.Access.Allowlist {
+		if err := validateAddressOrRange(entry); err != nil {
+			return fmt.Errorf("invalid allowlist entry: %w", err)
+		}
+	}
+	if c.Access.TarpitDelay < 0 {
+		return fmt.Errorf("invalid tarpit delay: %s", c.Access.TarpitDelay)
+	}
+	if c.Access.DelayMin < 0 || c.Access.DelayMax < c.Access.DelayMin {
+		return fmt.Errorf("invalid attempt delay range: %s-%s", c.Access.DelayMin, c.Access.DelayMax)
+	}
+	if err := c.validateAPI(); err != nil {
+		return err
+	}
+
+	if c.Heartbeat.Interval < 0 {
+		return fmt.Errorf("invalid heartbeat interval: %s", c.Heartbeat.Interval)
+	}
+
+	// Check alerts
+	// Check password spray detection settings
+	if spray := c.Enrichment.Spray; spray.Enabled {
+		if spray.Window <= 0 || spray.MinUsernames <= 0 || spray.MinSources <= 0 || spray.MaxEntries <= 0 {
+			return fmt.Errorf("invalid password spray settings: window, min_usernames, min_sources and max_entries must be positive")
+		}
+	}
+
+	// Check attack surge detection settings
+	if surge := c.Enrichment.Surge; surge.Enabled {
+		if surge.Interval <= 0 || surge.Baseline < surge.Interval {
+			return fmt.Errorf("invalid attack surge settings: interval must be positive and not longer than baseline")
+		}
+		if surge.Multiplier <= 1 {
+			return fmt.Errorf("invalid attack surge settings: multiplier must be greater than 1")
+		}
+		if surge.MinAttempts < 0 {
+			return fmt.Errorf("invalid attack surge settings: min_attempts must not be negative")
+		}
+	}
+
+	if err := c.Alerts.validate(c.Enrichment); err != nil {
+		return err
+	}
+	if err := c.validateForward(); err != nil {
+		return err
+	}
+	if err := c.validateReports(); err != nil {
+		return err
+	}
+
+	// Check metric exporters
+	if statsd := c.Metrics.StatsD; statsd.Address != "" {
+		if _, _, err := net.SplitHostPort(statsd.Address); err != nil {
+			return fmt.Errorf("invalid StatsD address '%s': %w", statsd.Address, err)
+		}
+		if statsd.FlushInterval <= 0 {
+			return fmt.Errorf("invalid StatsD settings: flush_interval must be positive")
+		}
+	}
+
+	if otlp := c.Metrics.OTLP; otlp.Endpoint != "" {
+		if !isHTTPURL(otlp.Endpoint) {
+			return fmt.Errorf("invalid OTLP metrics endpoint '%s': must be an http or https URL", otlp.Endpoint)
+		}
+		if otlp.Interval <= 0 || otlp.Timeout <= 0 {
+			return fmt.Errorf("invalid OTLP metrics settings: interval and timeout must be positive")
+		}
+	}
+
+	// Check trace export
+	if tracing := c.Tracing; tracing.Endpoint != "" {
+		if !isHTTPURL(tracing.Endpoint) {
+			return fmt.Errorf("invalid tracing endpoint '%s': must be an http or https URL", tracing.Endpoint)
+		}
+		if tracing.SampleRatio < 0 || tracing.SampleRatio > 1 {
+			return fmt.Errorf("invalid tracing sample_ratio: %g (must be between 0 and 1)", tracing.SampleRatio)
+		}
+		if tracing.BatchSize <= 0 || tracing.QueueSize <= 0 || tracing.FlushInterval <= 0 || tracing.Timeout <= 0 {
+			return fmt.Errorf("invalid tracing settings: batch_size, queue_size, flush_interval and timeout must be positive")
+		}
+	}
+
+	// Check username classification rules
+	for i, rule := range c.Enrichment.Usernames.Rules {
+		if rule.Category == "" {
+			return fmt.Errorf("invalid username rule #%d: category is required", i+1)
+		}
+		if len(rule.Usernames) == 0 && rule.Pattern == "" {
+			return fmt.Errorf("invalid username rule #%d: usernames or pattern is required", i+1)
+		}
+		if rule.Pattern != "" {
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("invalid username rule #%d: %w", i+1, err)
+			}
+		}
+	}
+
+	// Check cloud provider sources
+	if c.Enrichment.Cloud.RefreshInterval < 0 {
+		return fmt.Errorf("invalid cloud settings: refresh_interval must not be negative")
+	}
+	for i, src := range c.Enrichment.Cloud.Sources {
+		if src.Provider == "" || src.URL == "" {
+			return fmt.Errorf("invalid cloud source #%d: provider and url are required", i+1)
+		}
+		switch src.Format {
+		case "aws", "gcp", "azure", "text":
+		default:
+			return fmt.Errorf("invalid cloud source #%d: format must be 'aws', 'gcp', 'azure', or 'text'", i+1)
+		}
+	}
+
+	// If a private key path is specified, check that it exists and is readable
+	if c.PrivateKeyPath != "" && !c.GenerateKey {
+		if _, err := os.Stat(c.PrivateKeyPath); os.IsNotExist(err) {
+			return fmt.Errorf("private key not found: %s", c.PrivateKeyPath)
+		}
+	}
+
+	return nil
+}
+
+// reservedFields are event fields that can not be used as tag keys
+var reservedFields = map[string]bool{
+	"level":     true,
+	"time":      true,
+	"message":   true,
+	"event":     true,
+	"event_id":  true,
+	"component": true,
+}
+
+// ParseTags parses a comma-separated list of key=value pairs
+func ParseTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tag '%s': expected key=value", pair)
+		}
+		tags[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return tags, nil
+}
+
+// ReadSecret returns the secret given literally, or the trimmed contents of
+// the file if the literal value is empty
+func ReadSecret(value, path string) ([]byte, error) {
+	if value != "" || path == "" {
+		return []byte(value), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return []byte(strings.TrimSpace(string(data))), nil
+}
+
+// envPlaceholder matches ${NAME} placeholders of environment variables, and
+// $${NAME} escaping them
+var envPlaceholder = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandValue replaces the ${NAME} placeholders of a configuration value
+// with environment variables, a file:///path value with the content of the
+// file without surrounding whitespace, as ReadSecret does, and a reference
+// to a secret store such as vault://secret/data/fakessh#api_key with the
+// secret
+func expandValue(ctx context.Context, value string, resolver *secrets.Resolver) (string, error) {
+	if secrets.IsReference(value) {
+		return resolver.Resolve(ctx, value)
+	}
+	if path, ok := strings.CutPrefix(value, "file://"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read value file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	var err error
+	expanded := envPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+		if strings.HasPrefix(placeholder, "$$") {
+			return placeholder[1:]
+		}
+		name := placeholder[2 : len(placeholder)-1]
+		env, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return env
+	})
+	return expanded, err
+}
+
+// expandValues expands the placeholders of the string settings under a
+// configuration value, naming the key of a failing one
+func expandValues(ctx context.Context, v reflect.Value, key string, resolver *secrets.Resolver) error {
+	switch v.Kind() {
+	case reflect.String:
+		value, err := expandValue(ctx, v.String(), resolver)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		v.SetString(value)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			fieldKey := key
+			if opts != "squash" {
+				fieldKey = strings.TrimPrefix(key+"."+name, ".")
+			}
+			if err := expandValues(ctx, v.Field(i), fieldKey, resolver); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := expandValues(ctx, v.Index(i), fmt.Sprintf("%s[%d]", key, i), resolver); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		for iter := v.MapRange(); iter.Next(); {
+			value, err := expandValue(ctx, iter.Value().String(), resolver)
+			if err != nil {
+				return fmt.Errorf("%s.%v: %w", key, iter.Key(), err)
+			}
+			v.SetMapIndex(iter.Key(), reflect.ValueOf(value).Convert(v.Type().Elem()))
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return expandValues(ctx, v.Elem(), key, resolver)
+		}
+	}
+	return nil
+}
+
+// LoadSensorID returns the ID of the sensor: sensor.id, the sensor_id tag,
+// or the ID kept in sensor.id_file, generated and written there when the
+// file does not exist
+func (c *Config) LoadSensorID() (string, error) {
+	if c.Sensor.ID != "" {
+		return c.Sensor.ID, nil
+	}
+	if id := c.Tags["sensor_id"]; id != "" {
+		return id, nil
+	}
+	if c.Sensor.IDFile == "" {
+		return "", fmt.Errorf("no sensor ID: set sensor.id or sensor.id_file")
+	}
+
+	data, err := os.ReadFile(c.Sensor.IDFile)
+	if err == nil {
+		id := strings.TrimSpace(string(data))
+		if !validSensorID.MatchString(id) {
+			return "", fmt.Errorf("invalid sensor ID in %s", c.Sensor.IDFile)
+		}
+		return id, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read sensor ID: %w", err)
+	}
+
+	// A random UUID (version 4)
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	id := fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+	if err := os.WriteFile(c.Sensor.IDFile, []byte(id+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write sensor ID: %w", err)
+	}
+	return id, nil
+}
+
+// SandboxPaths returns the directories the sandbox lets the server read,
+// those of the files it reads, and read and write, those of the files it
+// writes, including sandbox.read_paths and sandbox.write_paths. Files are
+// replaced by renaming, so their directories are allowed rather than the
+// files.
+func (c *Config) SandboxPaths() (read, write []string) {
+	written := []string{
+		c.Log.File, c.Log.EmergencyFile, c.OpsLog.File, c.PIDFile,
+		c.Enrichment.Cache.File, c.Enrichment.Attackers.File,
+	}
+	for _, sink := range c.Log.Sinks {
+		if sink.Type == "file" {
+			written = append(written, sink.Path)
+		}
+	}
+	// Downloaded databases are written next to the old ones
+	if c.Enrichment.MaxMind.Enabled() {
+		written = append(written, c.Enrichment.GeoIP.Database, c.Enrichment.ASN.Database)
+	}
+
+	// Every other file setting is read
+	v := reflect.ValueOf(*c)
+	var files []string
+	for _, opt := range Options() {
+		name := opt.Key[strings.LastIndex(opt.Key, ".")+1:]
+		if opt.typ.Kind() == reflect.String && (name == "file" || name == "database" || strings.HasSuffix(name, "_file") || strings.HasSuffix(name, "_path")) {
+			files = append(files, v.FieldByIndex(opt.index).String())
+		}
+	}
+	for _, list := range c.Enrichment.Dictionaries.Custom {
+		files = append(files, list.URL)
+	}
+	for _, list := range c.Enrichment.Blocklists.Lists {
+		files = append(files, list.URL)
+	}
+
+	absolute := func(path string) string {
+		if abs, err := filepath.Abs(path); err == nil {
+			return abs
+		}
+		return path
+	}
+	add := func(paths []string, path string) []string {
+		if path = absolute(path); slices.Contains(paths, path) {
+			return paths
+		}
+		return append(paths, path)
+	}
+	isFile := func(path string) bool {
+		return path != "" && path != "stdout" && path != "stderr" && !strings.Contains(path, "://")
+	}
+	for _, file := range written {
+		if isFile(file) {
+			write = add(write, filepath.Dir(file))
+		}
+	}
+	if c.StateDir != "" {
+		write = add(write, c.StateDir)
+	}
+	if c.Forward.URL != "" {
+		write = add(write, c.Forward.SpoolDir)
+	}
+	for _, path := range c.Sandbox.WritePaths {
+		write = add(write, path)
+	}
+	for _, file := range files {
+		if isFile(file) {
+			if dir := absolute(filepath.Dir(file)); !slices.Contains(write, dir) {
+				read = add(read, dir)
+			}
+		}
+	}
+	for _, path := range c.Sandbox.ReadPaths {
+		read = add(read, path)
+	}
+	return read, write
+}
+
+// GetFullServerVersion returns the full SSH server version string
 func (c *Config) GetFullServerVersion() string {
-	return fmt.Sprintf("SSH-2.0-%s %s", c.ServerVersion, c.Banner)
+	return FullServerVersion(c.ServerVersion, c.Banner)
+}
+
+// FullServerVersion returns the SSH version string of a server version and
+// banner
+func FullServerVersion(serverVersion, banner string) string {
+	return fmt.Sprintf("SSH-2.0-%s %s", serverVersion, banner)
+}
+
+// redacted replaces the values of secrets in Settings
+const redacted = "REDACTED"
+
+// Settings returns the configuration as nested maps keyed like the
+// configuration file, with the values of secrets replaced, to be shown by
+// the admin API
+func (c *Config) Settings() map[string]interface{} {
+	return settings(reflect.ValueOf(*c), true)
+}
+
+// Change is a setting that differs between two configurations, with the
+// values of secrets replaced like in Settings
+type Change struct {
+	Key      string
+	Previous interface{}
+	Value    interface{}
+}
+
+// Diff returns the settings that differ between two configurations, in key
+// order. Keys name the levels of the configuration file separated by dots,
+// like "access.delay_min"; lists are compared as a whole.
+func Diff(previous, current *Config) []Change {
+	before := flatSettings(settings(reflect.ValueOf(*previous), false))
+	after := flatSettings(settings(reflect.ValueOf(*current), false))
+	shownBefore := flatSettings(previous.Settings())
+	shownAfter := flatSettings(current.Settings())
+
+	keys := make([]string, 0, len(after))
+	for key := range after {
+		keys = append(keys, key)
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	var changes []Change
+	for _, key := range keys {
+		if !reflect.DeepEqual(before[key], after[key]) {
+			changes = append(changes, Change{Key: key, Previous: shownBefore[key], Value: shownAfter[key]})
+		}
+	}
+	return changes
+}
+
+// flatSettings returns the values of nested settings by their dotted keys
+func flatSettings(m map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if nested, ok := v.(map[string]interface{}); ok {
+				walk(prefix+k+".", nested)
+				continue
+			}
+			flat[prefix+k] = v
+		}
+	}
+	walk("", m)
+	return flat
+}
+
+// settings returns the fields of a configuration struct by their keys,
+// with the values of secrets replaced if redact is set
+func settings(v reflect.Value, redact bool) map[string]interface{} {
+	m := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, opts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if opts == "squash" {
+			for k, value := range settings(v.Field(i), redact) {
+				m[k] = value
+			}
+			continue
+		}
+		if key == "" || key == "-" || !field.IsExported() {
+			continue
+		}
+		m[key] = setting(key, v.Field(i), redact)
+	}
+	return m
+}
+
+// setting returns the value of a setting, redacted if the key names a
+// secret rather than the file of one
+func setting(key string, v reflect.Value, redact bool) interface{} {
+	switch v.Kind() {
+	case reflect.Struct:
+		return settings(v, redact)
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			k := fmt.Sprint(iter.Key().Interface())
+			if redact && key == "headers" {
+				// Headers carry the credentials of exporters
+				m[k] = redacted
+			} else {
+				m[k] = setting(k, iter.Value(), redact)
+			}
+		}
+		return m
+	case reflect.Slice:
+		l := make([]interface{}, v.Len())
+		for i := range l {
+			l[i] = setting(key, v.Index(i), redact)
+		}
+		return l
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return setting(key, v.Elem(), redact)
+	case reflect.String:
+		secret := key == "password" || key == "token" || key == "webhook_url" ||
+			strings.HasSuffix(key, "_key") || strings.HasSuffix(key, "_token")
+		if redact && secret && v.String() != "" {
+			return redacted
+		}
+	}
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return v.Interface()
+}
+
+// ValidateCollector checks the settings of the collector mode, which are
+// not required by the SSH server
+func (c *Config) ValidateCollector() error {
+	if err := c.validateCollector(); err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+	return nil
+}
+
+// validateCollector checks the collector settings one at a time
+func (c *Config) validateCollector() error {
+	col := c.Collector
+	if col.Listen == "" {
+		return fmt.Errorf("collector requires collector.listen")
+	}
+	if col.CertFile == "" || col.KeyFile == "" {
+		return fmt.Errorf("collector requires a server certificate: set collector.cert_file and collector.key_file")
+	}
+	if col.ClientCAFile == "" {
+		return fmt.Errorf("collector requires collector.client_ca_file to authenticate sensors")
+	}
+	if col.MaxBatchBytes <= 0 {
+		return fmt.Errorf("invalid collector.max_batch_bytes: must be positive")
+	}
+	if col.RecentIDs < 0 {
+		return fmt.Errorf("invalid collector.recent_ids: must not be negative")
+	}
+	if col.CorrelationWindow < 0 {
+		return fmt.Errorf("invalid collector.correlation_window: must not be negative")
+	}
+	if col.CorrelationWindow > 0 && col.MaxCorrelatedSources <= 0 {
+		return fmt.Errorf("invalid collector.max_correlated_sources: must be positive")
+	}
+	if fleet := col.FleetDenylist; fleet.MinSensors < 0 || fleet.MinAttempts < 0 {
+		return fmt.Errorf("invalid collector.fleet_denylist: thresholds must not be negative")
+	} else if fleet.Enabled() {
+		if col.CorrelationWindow == 0 {
+			return fmt.Errorf("collector.fleet_denylist requires collector.correlation_window")
+		}
+		if fleet.Action != FleetDeny && fleet.Action != FleetTarpit {
+			return fmt.Errorf("invalid collector.fleet_denylist.action '%s': must be %s or %s", fleet.Action, FleetDeny, FleetTarpit)
+		}
+	}
+	if col.APIToken != "" || col.APITokenFile != "" {
+		if c.Log.File == "" || c.Log.File == "stdout" || c.Log.Format != "json" {
+			return fmt.Errorf("the collector API queries the log file and requires log.file in json format")
+		}
+		if len(c.Log.Encryption.Recipients) > 0 || c.Log.Encryption.RecipientsFile != "" {
+			return fmt.Errorf("the collector API cannot query an encrypted log")
+		}
+	} else if col.Dashboard {
+		return fmt.Errorf("the collector dashboard requires collector.api_token")
+	}
+	for i, p := range col.Profiles {
+		if len(p.Sensors) == 0 || p.File == "" {
+			return fmt.Errorf("collector profile #%d requires sensors and a file", i+1)
+		}
+		for _, pattern := range p.Sensors {
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				return fmt.Errorf("invalid sensor pattern '%s' of collector profile #%d", pattern, i+1)
+			}
+		}
+	}
+	if len(col.Profiles) > 0 && col.ProfileKey == "" && col.ProfileKeyFile == "" {
+		return fmt.Errorf("collector profiles require collector.profile_key_file to sign them")
+	}
+	return c.validateTenants()
+}
+
+// validTenantName matches the names of collector tenants
+var validTenantName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// validateTenants checks the tenants of the collector: each has a unique
+// name, sensors and a log file of its own
+func (c *Config) validateTenants() error {
+	names := make(map[string]bool)
+	logs := map[string]bool{filepath.Clean(c.Log.File): true}
+	for _, t := range c.Collector.Tenants {
+		if !validTenantName.MatchString(t.Name) {
+			return fmt.Errorf("invalid collector tenant name '%s'", t.Name)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("duplicate collector tenant '%s'", t.Name)
+		}
+		names[t.Name] = true
+		if len(t.Sensors) == 0 {
+			return fmt.Errorf("collector tenant %s requires sensors", t.Name)
+		}
+		for _, pattern := range t.Sensors {
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				return fmt.Errorf("invalid sensor pattern '%s' of collector tenant %s", pattern, t.Name)
+			}
+		}
+		if t.LogFile == "" || t.LogFile == "stdout" {
+			return fmt.Errorf("collector tenant %s requires a log_file", t.Name)
+		}
+		if logs[filepath.Clean(t.LogFile)] {
+			return fmt.Errorf("collector tenant %s requires a log_file of its own", t.Name)
+		}
+		logs[filepath.Clean(t.LogFile)] = true
+		if t.HasAPIToken() {
+			if c.Log.Format != "json" {
+				return fmt.Errorf("the collector API queries the log files and requires log.format json")
+			}
+			if len(c.Log.Encryption.Recipients) > 0 || c.Log.Encryption.RecipientsFile != "" {
+				return fmt.Errorf("the collector API cannot query an encrypted log")
+			}
+		}
+	}
+	return nil
+}
+
+// validateAddressOrRange checks an IP address or CIDR range
+func validateAddressOrRange(entry string) error {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		_, err := netip.ParsePrefix(entry)
+		return err
+	}
+	_, err := netip.ParseAddr(entry)
+	return err
+}
+
+// validateAPI checks the listener and the authentication of the admin API
+func (c *Config) validateAPI() error {
+	api := c.API
+	if api.Listen == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(api.Listen); err != nil {
+		return fmt.Errorf("invalid API listen address '%s': %w", api.Listen, err)
+	}
+	if (api.CertFile == "") != (api.KeyFile == "") {
+		return fmt.Errorf("the admin API requires both api.cert_file and api.key_file")
+	}
+	if api.ClientCAFile != "" && api.CertFile == "" {
+		return fmt.Errorf("client certificates of the admin API require api.cert_file and api.key_file")
+	}
+	if api.Token == "" && api.TokenFile == "" && api.ClientCAFile == "" {
+		return fmt.Errorf("the admin API requires api.token or api.client_ca_file")
+	}
+	return nil
+}
+
+// validateForward checks the collector URL and the spool of forwarding
+func (c *Config) validateForward() error {
+	f := c.Forward
+	if f.URL == "" {
+		return nil
+	}
+	if !strings.HasPrefix(f.URL, "https://") {
+		return fmt.Errorf("invalid forward URL '%s': must be an https URL", f.URL)
+	}
+	if f.CertFile == "" || f.KeyFile == "" {
+		return fmt.Errorf("forwarding requires a client certificate: set forward.cert_file and forward.key_file")
+	}
+	if f.SpoolDir == "" {
+		return fmt.Errorf("forwarding requires forward.spool_dir")
+	}
+	if f.MaxSpoolBytes <= 0 || f.BatchSize <= 0 || f.FlushInterval <= 0 || f.Timeout <= 0 {
+		return fmt.Errorf("invalid forward settings: max_spool_bytes, batch_size, flush_interval and timeout must be positive")
+	}
+	if f.FleetInterval < 0 || f.ProfileInterval < 0 {
+		return fmt.Errorf("invalid forward settings: fleet_interval and profile_interval must not be negative")
+	}
+	return nil
+}
+
+// validateReports checks the schedule of reports, the log they are
+// generated from and the notifiers delivering them
+func (c *Config) validateReports() error {
+	r := c.Reports
+	if !r.Enabled() {
+		return nil
+	}
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid reports timezone '%s': %w", r.Timezone, err)
+	}
+	if _, err := schedule.Parse(r.Schedule, loc); err != nil {
+		return fmt.Errorf("invalid reports schedule: %w", err)
+	}
+	if r.Period <= 0 || r.Top < 1 {
+		return fmt.Errorf("invalid reports settings: period and top must be positive")
+	}
+	if r.Format != ReportHTML && r.Format != ReportText {
+		return fmt.Errorf("invalid reports format '%s': must be html or text", r.Format)
+	}
+	if c.Log.File == "" || c.Log.File == "stdout" || c.Log.Format != "json" {
+		return fmt.Errorf("reports are generated from the log file and require log.file in json format")
+	}
+	if len(c.Log.Encryption.Recipients) > 0 || c.Log.Encryption.RecipientsFile != "" {
+		return fmt.Errorf("reports cannot be generated from an encrypted log")
+	}
+
+	configured := map[string]bool{
+		"email":   c.Alerts.Email.Enabled(),
+		"slack":   c.Alerts.Slack.Enabled(),
+		"discord": c.Alerts.Discord.Enabled(),
+	}
+	for _, n := range r.Notifiers {
+		if !reportNotifiers[n] {
+			return fmt.Errorf("unknown reports notifier '%s': must be email, slack or discord", n)
+		}
+		if !configured[n] {
+			return fmt.Errorf("reports notifier '%s' is not configured", n)
+		}
+	}
+	if !configured["email"] && !configured["slack"] && !configured["discord"] {
+		return fmt.Errorf("reports require an email, Slack or Discord notifier")
+	}
+	return nil
+}
+
+// validate checks the alert triggers and notifiers
+func (c AlertsConfig) validate(enrichment EnrichmentConfig) error {
+	if c.NewAttacker && !enrichment.Attackers.Enabled {
+		return fmt.Errorf("new attacker alerts require enrichment.attackers to be enabled")
+	}
+	if (c.NewCountry || c.NewASN) && !enrichment.Attackers.Enabled {
+		return fmt.Errorf("new country and ASN alerts require enrichment.attackers to be enabled")
+	}
+	if c.NewCountry && enrichment.GeoIP.Database == "" {
+		return fmt.Errorf("new country alerts require enrichment.geoip.database")
+	}
+	if c.NewASN && enrichment.ASN.Database == "" {
+		return fmt.Errorf("new ASN alerts require enrichment.asn.database")
+	}
+	if c.PasswordSpray && !enrichment.Spray.Enabled {
+		return fmt.Errorf("password spray alerts require enrichment.spray to be enabled")
+	}
+	if c.AttackSurge && !enrichment.Surge.Enabled {
+		return fmt.Errorf("attack surge alerts require enrichment.surge to be enabled")
+	}
+	for _, n := range c.InternalNetworks {
+		if !isNetwork(n) {
+			return fmt.Errorf("invalid internal network '%s': must be a CIDR network, an address or \"private\"", n)
+		}
+	}
+	if c.AttemptsThreshold < 0 {
+		return fmt.Errorf("invalid alert attempts threshold: must not be negative")
+	}
+	if c.AttemptsThreshold > 0 && c.ThresholdWindow <= 0 {
+		return fmt.Errorf("invalid alert threshold window: must be positive")
+	}
+	if c.Enabled() && (c.QueueSize <= 0 || c.Timeout <= 0) {
+		return fmt.Errorf("invalid alert settings: queue_size and timeout must be positive")
+	}
+	if c.Cooldown < 0 || c.BatchWindow < 0 {
+		return fmt.Errorf("invalid alert settings: cooldown and batch_window must not be negative")
+	}
+
+	if c.Slack.WebhookURL != "" && !isHTTPURL(c.Slack.WebhookURL) {
+		return fmt.Errorf("invalid Slack webhook URL: must be an http(s) URL")
+	}
+	if c.Discord.WebhookURL != "" && !isHTTPURL(c.Discord.WebhookURL) {
+		return fmt.Errorf("invalid Discord webhook URL: must be an http(s) URL")
+	}
+	if c.Telegram.Enabled() && c.Telegram.ChatID == "" {
+		return fmt.Errorf("Telegram alerts require a chat_id")
+	}
+	if c.Ntfy.Enabled() && !isHTTPURL(c.Ntfy.Server) {
+		return fmt.Errorf("invalid ntfy server: must be an http(s) URL")
+	}
+	if c.Pushover.Enabled() && c.Pushover.UserKey == "" {
+		return fmt.Errorf("Pushover alerts require a user_key")
+	}
+	if c.Opsgenie.APIURL != "" && !isHTTPURL(c.Opsgenie.APIURL) {
+		return fmt.Errorf("invalid Opsgenie API URL: must be an http(s) URL")
+	}
+	for name, severity := range map[string]string{"PagerDuty": c.PagerDuty.MinSeverity, "Opsgenie": c.Opsgenie.MinSeverity} {
+		switch severity {
+		case "", "info", "warning", "critical":
+		default:
+			return fmt.Errorf("invalid %s minimum severity '%s': must be info, warning or critical", name, severity)
+		}
+	}
+	if err := c.Email.validate(); err != nil {
+		return err
+	}
+
+	rules := make(map[string]bool, len(alertRules)+len(c.Rules))
+	for r := range alertRules {
+		rules[r] = true
+	}
+	for _, r := range c.Rules {
+		if err := r.validate(); err != nil {
+			return err
+		}
+		if rules[r.Name] {
+			return fmt.Errorf("duplicate alert rule '%s'", r.Name)
+		}
+		rules[r.Name] = true
+	}
+
+	notifiers := []struct {
+		name     string
+		template string
+		rules    []string
+	}{
+		{"Slack", c.Slack.Template, c.Slack.Rules},
+		{"Telegram", c.Telegram.Template, c.Telegram.Rules},
+		{"Discord", c.Discord.Template, c.Discord.Rules},
+		{"email", c.Email.Template, c.Email.Rules},
+		{"PagerDuty", "", c.PagerDuty.Rules},
+		{"Opsgenie", c.Opsgenie.Template, c.Opsgenie.Rules},
+		{"ntfy", c.Ntfy.Template, c.Ntfy.Rules},
+		{"Pushover", c.Pushover.Template, c.Pushover.Rules},
+	}
+	for _, n := range notifiers {
+		if _, err := template.New(n.name).Parse(n.template); err != nil {
+			return fmt.Errorf("invalid %s message template: %w", n.name, err)
+		}
+		for _, r := range n.rules {
+			if !rules[r] {
+				return fmt.Errorf("unknown alert rule '%s' of the %s notifier", r, n.name)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks the conditions and routing of a custom alert rule
+func (r AlertRuleConfig) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("alert rules require a name")
+	}
+	switch r.Severity {
+	case "", "info", "warning", "critical":
+	default:
+		return fmt.Errorf("invalid severity '%s' of alert rule '%s': must be info, warning or critical", r.Severity, r.Name)
+	}
+	if _, err := template.New(r.Name).Parse(r.Message); err != nil {
+		return fmt.Errorf("invalid message template of alert rule '%s': %w", r.Name, err)
+	}
+	if r.Threshold < 0 {
+		return fmt.Errorf("invalid threshold of alert rule '%s': must not be negative", r.Name)
+	}
+	if r.Threshold > 0 && r.Window <= 0 {
+		return fmt.Errorf("invalid window of alert rule '%s': must be positive", r.Name)
+	}
+	if r.Cooldown < 0 {
+		return fmt.Errorf("invalid cooldown of alert rule '%s': must not be negative", r.Name)
+	}
+	for _, cond := range r.Conditions {
+		if cond.Field == "" {
+			return fmt.Errorf("conditions of alert rule '%s' require a field", r.Name)
+		}
+		if len(cond.In) == 0 && cond.Regex == "" && cond.Min == nil && cond.Max == nil && len(cond.Networks) == 0 && cond.Exists == nil {
+			return fmt.Errorf("condition on '%s' of alert rule '%s' has no criteria: set in, regex, min, max, networks or exists", cond.Field, r.Name)
+		}
+		for _, n := range cond.Networks {
+			if !isNetwork(n) {
+				return fmt.Errorf("invalid network '%s' of alert rule '%s'", n, r.Name)
+			}
+		}
+		if _, err := regexp.Compile(cond.Regex); err != nil {
+			return fmt.Errorf("invalid regex of alert rule '%s': %w", r.Name, err)
+		}
+	}
+	for _, n := range r.Notifiers {
+		if !alertNotifiers[n] {
+			return fmt.Errorf("unknown notifier '%s' of alert rule '%s'", n, r.Name)
+		}
+	}
+	return nil
+}
+
+// isNetwork reports whether s is a CIDR network, an address or "private"
+func isNetwork(s string) bool {
+	if s == "private" {
+		return true
+	}
+	if _, err := netip.ParsePrefix(s); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+// validate checks the SMTP server and the email mode
+func (c EmailConfig) validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid SMTP port: %d", c.Port)
+	}
+	switch c.Security {
+	case "starttls", "tls", "none":
+	default:
+		return fmt.Errorf("invalid SMTP security '%s': must be starttls, tls or none", c.Security)
+	}
+	if c.From == "" || len(c.To) == 0 {
+		return fmt.Errorf("email alerts require a sender and at least one recipient")
+	}
+	switch c.Mode {
+	case EmailAlerts:
+	case EmailDigest, EmailBoth:
+		if c.DigestInterval <= 0 || c.DigestTop <= 0 {
+			return fmt.Errorf("invalid digest settings: digest_interval and digest_top must be positive")
+		}
+	default:
+		return fmt.Errorf("invalid email mode '%s': must be alerts, digest or both", c.Mode)
+	}
+	return nil
+}
+
+// isHTTPURL reports whether s is an http or https URL
+func isHTTPURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
 }
@@ -1,8 +1,20 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -23,6 +35,11 @@ func TestDefaultConfig(t *testing.T) {
 		t.Errorf("Expected default log format 'json', got '%s'", cfg.Log.Format)
 	}
 
+	// Check default emergency file
+	if cfg.Log.EmergencyFile != "credentials.emergency.log" {
+		t.Errorf("Expected default emergency file 'credentials.emergency.log', got '%s'", cfg.Log.EmergencyFile)
+	}
+
 	// Check default banner
 	if cfg.Banner != "Ubuntu-4ubuntu0.5" {
 		t.Errorf("Expected default banner 'Ubuntu-4ubuntu0.5', got '%s'", cfg.Banner)
@@ -42,6 +59,11 @@ func TestDefaultConfig(t *testing.T) {
 	if !cfg.GenerateKey {
 		t.Error("Expected default generate key flag to be true")
 	}
+
+	// Check default password mode
+	if cfg.Privacy.PasswordMode != "plain" {
+		t.Errorf("Expected default password mode 'plain', got '%s'", cfg.Privacy.PasswordMode)
+	}
 }
 
 func TestValidate(t *testing.T) {
@@ -62,9 +84,26 @@ func TestValidate(t *testing.T) {
 				ServerVersion:  "OpenSSH_8.2p1",
 				PrivateKeyPath: "",
 				GenerateKey:    true,
+				Privacy: PrivacyConfig{
+					PasswordMode: "plain",
+				},
 			},
 			expectError: false,
 		},
+		{
+			name: "HMAC password mode without key",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Privacy: PrivacyConfig{
+					PasswordMode: "hmac",
+				},
+			},
+			expectError: true,
+		},
 		{
 			name: "Negative port",
 			config: &Config{
@@ -79,11 +118,1195 @@ func TestValidate(t *testing.T) {
 		{
 			name: "Too large port",
 			config: &Config{
-				Port: 70000,
+				Port: 70000,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Sink without path",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+					Sinks:  []SinkConfig{{Type: "file"}},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Unknown sink type",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+					Sinks:  []SinkConfig{{Type: "carrier-pigeon"}},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Cryptopan IP mode without key",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Privacy: PrivacyConfig{
+					IPMode: "cryptopan",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Missing GeoIP database",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					GeoIP: MMDBConfig{
+						Database: "/nonexistent/GeoLite2-City.mmdb",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Reverse DNS without timeout",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					RDNS: RDNSConfig{
+						Enabled:     true,
+						Concurrency: 4,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Cloud source with unknown format",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					Cloud: CloudConfig{
+						Enabled: true,
+						Sources: []CloudSourceConfig{
+							{Provider: "ovh", URL: "/etc/fakessh/ovh.txt", Format: "yaml"},
+						},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "AbuseIPDB without API key",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					Reputation: ReputationConfig{
+						AbuseIPDB: AbuseIPDBConfig{
+							Enabled:    true,
+							MaxAgeDays: 90,
+						},
+						Concurrency: 4,
+						Timeout:     5 * time.Second,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Duplicate blocklist name",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					Blocklists: BlocklistsConfig{
+						Lists: []BlocklistConfig{
+							{Name: "drop", URL: "https://www.spamhaus.org/drop/drop.txt"},
+							{Name: "drop", URL: "/etc/fakessh/drop.txt"},
+						},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Custom dictionary named like a built-in one",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					Dictionaries: DictionariesConfig{
+						Enabled: true,
+						Builtin: []string{"mirai"},
+						Custom: []DictionaryConfig{
+							{Name: "mirai", URL: "/etc/fakessh/mirai.txt"},
+						},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Username rule with invalid pattern",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					Usernames: UsernamesConfig{
+						Enabled: true,
+						Rules: []UsernameRuleConfig{
+							{Category: "corporate", Pattern: "[a-z+"},
+						},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "HIBP without cache",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					HIBP: HIBPConfig{
+						Enabled:     true,
+						Concurrency: 4,
+						Timeout:     5 * time.Second,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Attacker tracking without capacity",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					Attackers: AttackersConfig{
+						Enabled: true,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Campaigns with single attempt",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					Campaigns: CampaignsConfig{
+						Enabled:     true,
+						MinAttempts: 1,
+						Window:      time.Hour,
+						MaxSources:  1000,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid StatsD address",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Metrics: MetricsConfig{
+					StatsD: StatsDConfig{
+						Address:       "localhost",
+						FlushInterval: time.Second,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid tracing sample ratio",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Tracing: TracingConfig{
+					Endpoint:      "http://localhost:4318",
+					SampleRatio:   1.5,
+					BatchSize:     512,
+					QueueSize:     4096,
+					FlushInterval: time.Second,
+					Timeout:       time.Second,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "OTLP metrics endpoint without scheme",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Metrics: MetricsConfig{
+					OTLP: OTLPMetricsConfig{
+						Endpoint: "localhost:4318",
+						Interval: time.Minute,
+						Timeout:  time.Second,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid admin listen address",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Admin: AdminConfig{
+					Listen: "9090",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Event stream without admin listener",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Admin: AdminConfig{
+					StreamToken: "secret",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Dashboard without admin listener",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Admin: AdminConfig{
+					Dashboard: true,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Dashboard without admin token",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Admin: AdminConfig{
+					Listen:    "127.0.0.1:9090",
+					Dashboard: true,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Dashboard with admin token",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Admin: AdminConfig{
+					Listen:    "127.0.0.1:9090",
+					Dashboard: true,
+					Token:     "secret",
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid denylist entry",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Access: AccessConfig{
+					Denylist: []string{"192.0.2.0/24", "192.0.2.300"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Inverted attempt delay range",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Access: AccessConfig{
+					Allowlist: []string{"192.0.2.7"},
+					DelayMin:  time.Second,
+					DelayMax:  500 * time.Millisecond,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Admin API with token",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Access: AccessConfig{
+					Denylist: []string{"192.0.2.0/24", "2001:db8::1"},
+				},
+				API: APIConfig{
+					Listen: "127.0.0.1:9443",
+					Token:  "secret",
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Admin API without authentication",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				API: APIConfig{
+					Listen: "127.0.0.1:9443",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Admin API client certificates without server certificate",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				API: APIConfig{
+					Listen:       "127.0.0.1:9443",
+					ClientCAFile: "ca.pem",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Pprof without admin listener",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Admin: AdminConfig{
+					Pprof: true,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Weekly reports by email",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					QueueSize: 100,
+					Timeout:   time.Second,
+					Email:     EmailConfig{Host: "smtp.example.com", Port: 587, Security: "starttls", From: "fakessh@example.com", To: []string{"soc@example.com"}, Mode: EmailAlerts},
+				},
+				Reports: ReportsConfig{Schedule: "0 8 * * mon", Timezone: "Europe/Berlin", Period: 168 * time.Hour, Format: ReportHTML, Top: 10, Notifiers: []string{"email"}},
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid reports schedule",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					QueueSize: 100,
+					Timeout:   time.Second,
+					Slack:     SlackConfig{WebhookURL: "https://hooks.slack.com/services/x"},
+				},
+				Reports: ReportsConfig{Schedule: "0 25 * * *", Period: time.Hour, Format: ReportText, Top: 10},
+			},
+			expectError: true,
+		},
+		{
+			name: "Reports without notifier",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Reports: ReportsConfig{Schedule: "@daily", Period: 24 * time.Hour, Format: ReportHTML, Top: 10},
+			},
+			expectError: true,
+		},
+		{
+			name: "Reports from stdout",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "stdout",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					QueueSize: 100,
+					Timeout:   time.Second,
+					Slack:     SlackConfig{WebhookURL: "https://hooks.slack.com/services/x"},
+				},
+				Reports: ReportsConfig{Schedule: "@daily", Period: 24 * time.Hour, Format: ReportHTML, Top: 10},
+			},
+			expectError: true,
+		},
+		{
+			name: "Forwarding to a collector",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Forward: ForwardConfig{
+					URL:           "https://collector.example.com:8443",
+					CertFile:      "sensor.pem",
+					KeyFile:       "sensor.key",
+					SpoolDir:      "spool",
+					MaxSpoolBytes: 1 << 20,
+					BatchSize:     100,
+					FlushInterval: time.Second,
+					Timeout:       time.Second,
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Forwarding over plain HTTP",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Forward: ForwardConfig{
+					URL:           "http://collector.example.com:8443",
+					CertFile:      "sensor.pem",
+					KeyFile:       "sensor.key",
+					SpoolDir:      "spool",
+					MaxSpoolBytes: 1 << 20,
+					BatchSize:     100,
+					FlushInterval: time.Second,
+					Timeout:       time.Second,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Forwarding without client certificate",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Forward: ForwardConfig{
+					URL:           "https://collector.example.com:8443",
+					SpoolDir:      "spool",
+					MaxSpoolBytes: 1 << 20,
+					BatchSize:     100,
+					FlushInterval: time.Second,
+					Timeout:       time.Second,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Negative fleet interval",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Forward: ForwardConfig{
+					URL:           "https://collector.example.com:8443",
+					CertFile:      "sensor.pem",
+					KeyFile:       "sensor.key",
+					SpoolDir:      "spool",
+					MaxSpoolBytes: 1 << 20,
+					BatchSize:     100,
+					FlushInterval: time.Second,
+					Timeout:       time.Second,
+					FleetInterval: -time.Minute,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Negative admin sessions",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Admin: AdminConfig{
+					Listen:   "127.0.0.1:9090",
+					Sessions: -1,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Negative heartbeat interval",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Heartbeat: HeartbeatConfig{
+					Interval: -time.Minute,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Relative sandbox chroot",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Sandbox: SandboxConfig{
+					Chroot: "var/empty",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid seccomp action",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Sandbox: SandboxConfig{
+					Seccomp:       true,
+					SeccompAction: "trap",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "New attacker alerts without attacker tracking",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					NewAttacker: true,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "New country alerts without a GeoIP database",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					Attackers: AttackersConfig{
+						Enabled:    true,
+						MaxEntries: 100,
+					},
+				},
+				Alerts: AlertsConfig{
+					NewCountry: true,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "New ASN alerts without attacker tracking",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					NewASN: true,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Slack alerts on an attempts threshold",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					AttemptsThreshold: 100,
+					ThresholdWindow:   time.Hour,
+					QueueSize:         1000,
+					Timeout:           10 * time.Second,
+					Slack: SlackConfig{
+						WebhookURL: "https://hooks.slack.com/services/T000/B000/XXXX",
+						Template:   "{{.Message}} from {{.Fields.country}}",
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid Slack webhook URL",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					QueueSize: 1000,
+					Timeout:   10 * time.Second,
+					Slack:     SlackConfig{WebhookURL: "hooks.slack.com/services/T000/B000/XXXX"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid Slack message template",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					QueueSize: 1000,
+					Timeout:   10 * time.Second,
+					Slack: SlackConfig{
+						WebhookURL: "https://hooks.slack.com/services/T000/B000/XXXX",
+						Template:   "{{.Message",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Telegram alerts without chat ID",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					QueueSize: 1000,
+					Timeout:   10 * time.Second,
+					Telegram:  TelegramConfig{BotToken: "123456:ABC-DEF"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Discord alerts of an unknown rule",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					QueueSize: 1000,
+					Timeout:   10 * time.Second,
+					Discord: DiscordConfig{
+						WebhookURL: "https://discord.com/api/webhooks/1/abc",
+						Rules:      []string{"new_attacker", "honeytoken"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Email digest",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					Email: EmailConfig{
+						Host:           "smtp.example.com",
+						Port:           465,
+						Security:       "tls",
+						From:           "fakessh@example.com",
+						To:             []string{"soc@example.com"},
+						Mode:           EmailDigest,
+						DigestInterval: time.Hour,
+						DigestTop:      10,
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Email alerts without recipients",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					QueueSize: 1000,
+					Timeout:   10 * time.Second,
+					Email: EmailConfig{
+						Host:     "smtp.example.com",
+						Port:     587,
+						Security: "starttls",
+						From:     "fakessh@example.com",
+						Mode:     EmailAlerts,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid email mode",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					Email: EmailConfig{
+						Host:     "smtp.example.com",
+						Port:     587,
+						Security: "starttls",
+						From:     "fakessh@example.com",
+						To:       []string{"soc@example.com"},
+						Mode:     "weekly",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "PagerDuty for critical alerts",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					AttemptsThreshold: 100,
+					ThresholdWindow:   time.Hour,
+					QueueSize:         1000,
+					Timeout:           10 * time.Second,
+					PagerDuty: PagerDutyConfig{
+						RoutingKeyFile: "/etc/fakessh/pagerduty-key",
+						MinSeverity:    "critical",
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid Opsgenie minimum severity",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					AttemptsThreshold: 100,
+					ThresholdWindow:   time.Hour,
+					QueueSize:         1000,
+					Timeout:           10 * time.Second,
+					Opsgenie: OpsgenieConfig{
+						APIKey:      "key",
+						APIURL:      "https://api.eu.opsgenie.com",
+						MinSeverity: "P1",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "ntfy on a self-hosted server",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					AttemptsThreshold: 100,
+					ThresholdWindow:   time.Hour,
+					QueueSize:         1000,
+					Timeout:           10 * time.Second,
+					Ntfy: NtfyConfig{
+						Server: "https://ntfy.example.com",
+						Topic:  "honeypot",
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Pushover without user key",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					AttemptsThreshold: 100,
+					ThresholdWindow:   time.Hour,
+					QueueSize:         1000,
+					Timeout:           10 * time.Second,
+					Pushover: PushoverConfig{
+						AppToken: "token",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Custom alert rule",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					QueueSize: 1000,
+					Timeout:   10 * time.Second,
+					Slack: SlackConfig{
+						WebhookURL: "https://hooks.slack.com/services/T/B/X",
+						Rules:      []string{"root_burst"},
+					},
+					Rules: []AlertRuleConfig{{
+						Name:     "root_burst",
+						Severity: "critical",
+						Conditions: []AlertConditionConfig{
+							{Field: "username", Regex: "^(root|admin)$"},
+							{Field: "country", In: []string{"RU", "CN"}, Not: true},
+						},
+						Threshold: 100,
+						Window:    5 * time.Minute,
+						Notifiers: []string{"slack"},
+					}},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Alert rule with unknown notifier",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					Rules: []AlertRuleConfig{{
+						Name:       "root",
+						Conditions: []AlertConditionConfig{{Field: "username", In: []string{"root"}}},
+						Notifiers:  []string{"irc"},
+					}},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Alert rule condition without criteria",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					Rules: []AlertRuleConfig{{
+						Name:       "root",
+						Conditions: []AlertConditionConfig{{Field: "username"}},
+					}},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Alert rule shadowing a built-in rule",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					Rules: []AlertRuleConfig{{Name: "threshold"}},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Negative alert cooldown",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					Rules: []AlertRuleConfig{{Name: "all", Cooldown: -time.Minute}},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Password spray alerts without detection",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					PasswordSpray: true,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid password spray window",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					Spray: SprayConfig{
+						Enabled:      true,
+						MinUsernames: 10,
+						MinSources:   10,
+						MaxEntries:   1000,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Attack surge multiplier too low",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					Surge: SurgeConfig{
+						Enabled:     true,
+						Interval:    time.Minute,
+						Baseline:    time.Hour,
+						Multiplier:  0.5,
+						MinAttempts: 100,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Internal networks",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					InternalNetworks: []string{"private", "100.64.0.0/10", "203.0.113.7"},
+					Rules: []AlertRuleConfig{{
+						Name:       "corporate",
+						Conditions: []AlertConditionConfig{{Field: "source", Networks: []string{"198.51.100.0/24"}}},
+					}},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid internal network",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Alerts: AlertsConfig{
+					InternalNetworks: []string{"10.0.0.0/8", "lan"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Reverse DNS without cache",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					RDNS: RDNSConfig{
+						Enabled:     true,
+						Concurrency: 4,
+						Timeout:     time.Second,
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "MaxMind updates without account ID",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					GeoIP: MMDBConfig{
+						Database: "/nonexistent/GeoLite2-City.mmdb",
+						Edition:  "GeoLite2-City",
+					},
+					MaxMind: MaxMindConfig{
+						LicenseKey: "license",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "MaxMind updates of a database not downloaded yet",
+			config: &Config{
+				Port: 2222,
+				Log: LogConfig{
+					File:   "credentials.log",
+					Format: "json",
+				},
+				Enrichment: EnrichmentConfig{
+					GeoIP: MMDBConfig{
+						Database: "/nonexistent/GeoLite2-City.mmdb",
+						Edition:  "GeoLite2-City",
+					},
+					MaxMind: MaxMindConfig{
+						AccountID:  "12345",
+						LicenseKey: "license",
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid operational log level",
+			config: &Config{
+				Port: 2222,
 				Log: LogConfig{
 					File:   "credentials.log",
 					Format: "json",
 				},
+				OpsLog: OpsLogConfig{
+					Level: "verbose",
+				},
 			},
 			expectError: true,
 		},
@@ -103,8 +1326,8 @@ func TestValidate(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			err := tt.config.Validate()
-			if tt.expectError && err == nil {
-				t.Errorf("Expected validation error, but got none")
+			if tt.expectError && !errors.Is(err, ErrConfigInvalid) {
+				t.Errorf("Expected a validation error wrapping ErrConfigInvalid, got: %v", err)
 			}
 			if !tt.expectError && err != nil {
 				t.Errorf("Expected no validation error, but got: %v", err)
@@ -127,6 +1350,12 @@ port: 2223
 log:
   file: "test.log"
   format: "pretty"
+  exclude: ["password"]
+  sinks:
+    - type: "file"
+      path: "siem.log"
+      rename:
+        remote_addr: "src_ip"
 banner: "Test-Banner"
 server_version: "TestSSH_1.0"
 private_key_path: ""
@@ -153,6 +1382,12 @@ generate_key: false
 	if cfg.Log.Format != "pretty" {
 		t.Errorf("Expected log format 'pretty', got '%s'", cfg.Log.Format)
 	}
+	if len(cfg.Log.Exclude) != 1 || cfg.Log.Exclude[0] != "password" {
+		t.Errorf("Expected log exclude [password], got %v", cfg.Log.Exclude)
+	}
+	if len(cfg.Log.Sinks) != 1 || cfg.Log.Sinks[0].Path != "siem.log" || cfg.Log.Sinks[0].Rename["remote_addr"] != "src_ip" {
+		t.Errorf("Expected sink with renamed remote_addr, got %+v", cfg.Log.Sinks)
+	}
 	if cfg.Banner != "Test-Banner" {
 		t.Errorf("Expected banner 'Test-Banner', got '%s'", cfg.Banner)
 	}
@@ -224,3 +1459,813 @@ func TestGetFullServerVersion(t *testing.T) {
 		t.Errorf("Expected version '%s', got '%s'", expected, version)
 	}
 }
+
+func TestSandboxPaths(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Log.File = "/var/log/fakessh/credentials.log"
+	cfg.Log.EmergencyFile = "/var/log/fakessh/emergency.log"
+	cfg.Log.Sinks = []SinkConfig{{Type: "file", Path: "/srv/events/fakessh.log"}, {Type: "stdout"}}
+	cfg.PrivateKeyPath = "/etc/fakessh/host_key"
+	cfg.Sensor.IDFile = "/var/lib/fakessh/sensor-id"
+	cfg.Enrichment.GeoIP.Database = "/usr/share/GeoIP/GeoLite2-City.mmdb"
+	cfg.Enrichment.Attackers.File = "/var/lib/fakessh/attackers.json"
+	cfg.Enrichment.Dictionaries.Custom = []DictionaryConfig{
+		{Name: "local", URL: "/etc/fakessh/dictionaries/local.txt"},
+		{Name: "remote", URL: "https://example.com/list.txt"},
+	}
+	cfg.Sandbox.ReadPaths = []string{"/etc/ssl"}
+	cfg.Sandbox.WritePaths = []string{"/var/lib/fakessh"}
+
+	read, write := cfg.SandboxPaths()
+	wantRead := []string{"/etc/fakessh", "/usr/share/GeoIP", "/etc/fakessh/dictionaries", "/etc/ssl"}
+	wantWrite := []string{"/var/log/fakessh", "/var/lib/fakessh", "/srv/events"}
+	if !reflect.DeepEqual(read, wantRead) {
+		t.Errorf("Expected read paths %v, got %v", wantRead, read)
+	}
+	if !reflect.DeepEqual(write, wantWrite) {
+		t.Errorf("Expected write paths %v, got %v", wantWrite, write)
+	}
+
+	// Downloaded databases are replaced in their directory, and the spool
+	// is written when forwarding
+	cfg.Enrichment.MaxMind.LicenseKey = "key"
+	cfg.Forward.URL = "https://collector.example.com:8443"
+	cfg.Forward.SpoolDir = "/var/spool/fakessh"
+	read, write = cfg.SandboxPaths()
+	if slices.Contains(read, "/usr/share/GeoIP") || !slices.Contains(write, "/usr/share/GeoIP") {
+		t.Errorf("Expected the GeoIP directory to be written, got read %v, write %v", read, write)
+	}
+	if !slices.Contains(write, "/var/spool/fakessh") {
+		t.Errorf("Expected the spool directory to be written, got %v", write)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags("sensor_id=s1, datacenter = fra1,,owner=secops")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"sensor_id":  "s1",
+		"datacenter": "fra1",
+		"owner":      "secops",
+	}
+	if len(tags) != len(expected) {
+		t.Fatalf("Expected %d tags, got %d", len(expected), len(tags))
+	}
+	for k, v := range expected {
+		if tags[k] != v {
+			t.Errorf("Expected tag %s='%s', got '%s'", k, v, tags[k])
+		}
+	}
+
+	if _, err := ParseTags("novalue"); err == nil {
+		t.Errorf("Expected error for tag without value")
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Tags = map[string]string{"sensor_id": "s1"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected no validation error, but got: %v", err)
+	}
+
+	cfg.Tags = map[string]string{"message": "overwritten"}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("Expected validation error for reserved tag key")
+	}
+}
+
+func TestValidateSensor(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Sensor.ID = "fra1.honeypot-01"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected no validation error, but got: %v", err)
+	}
+
+	cfg.Tags = map[string]string{"sensor_id": "other"}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("Expected validation error for differing sensor_id tag")
+	}
+
+	cfg.Tags = nil
+	cfg.Sensor.ID = "fra1 honeypot"
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("Expected validation error for invalid sensor ID")
+	}
+}
+
+func TestLoadSensorID(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Sensor.IDFile = filepath.Join(t.TempDir(), "sensor-id")
+
+	// A generated ID is kept for later starts
+	id, err := cfg.LoadSensorID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+		t.Errorf("Expected a random UUID, got '%s'", id)
+	}
+	if again, err := cfg.LoadSensorID(); err != nil || again != id {
+		t.Errorf("Expected the same ID on the next start, got '%s' (%v)", again, err)
+	}
+
+	cfg.Tags = map[string]string{"sensor_id": "tagged"}
+	if id, _ := cfg.LoadSensorID(); id != "tagged" {
+		t.Errorf("Expected the sensor_id tag, got '%s'", id)
+	}
+	cfg.Sensor.ID = "configured"
+	if id, _ := cfg.LoadSensorID(); id != "configured" {
+		t.Errorf("Expected the configured ID, got '%s'", id)
+	}
+
+	cfg = DefaultConfig()
+	cfg.Sensor.IDFile = filepath.Join(t.TempDir(), "sensor-id")
+	os.WriteFile(cfg.Sensor.IDFile, []byte("not an id!\n"), 0644)
+	if _, err := cfg.LoadSensorID(); err == nil {
+		t.Errorf("Expected error for an invalid ID file")
+	}
+}
+
+func TestValidateCollector(t *testing.T) {
+	cfg := DefaultConfig()
+	if err := cfg.ValidateCollector(); err == nil {
+		t.Errorf("Expected validation error for collector without certificates")
+	}
+
+	cfg.Collector.CertFile = "server.pem"
+	cfg.Collector.KeyFile = "server.key"
+	if err := cfg.ValidateCollector(); err == nil {
+		t.Errorf("Expected validation error for collector without client CA")
+	}
+
+	cfg.Collector.ClientCAFile = "ca.pem"
+	if err := cfg.ValidateCollector(); err != nil {
+		t.Errorf("Expected no validation error, but got: %v", err)
+	}
+
+	cfg.Collector.MaxCorrelatedSources = 0
+	if err := cfg.ValidateCollector(); err == nil {
+		t.Errorf("Expected validation error for correlation without sources")
+	}
+	cfg.Collector.CorrelationWindow = 0
+	if err := cfg.ValidateCollector(); err != nil {
+		t.Errorf("Expected no validation error for disabled correlation, but got: %v", err)
+	}
+	cfg.Collector.CorrelationWindow = -time.Hour
+	if err := cfg.ValidateCollector(); err == nil {
+		t.Errorf("Expected validation error for negative correlation window")
+	}
+	cfg.Collector.CorrelationWindow = time.Hour
+	cfg.Collector.MaxCorrelatedSources = 1000
+
+	cfg.Collector.FleetDenylist = FleetDenylistConfig{MinSensors: 3, Action: "block"}
+	if err := cfg.ValidateCollector(); err == nil {
+		t.Errorf("Expected validation error for invalid fleet denylist action")
+	}
+	cfg.Collector.FleetDenylist.Action = FleetTarpit
+	cfg.Collector.Profiles = []CollectorProfileConfig{{Sensors: []string{"dmz-*"}, File: "dmz.yaml"}}
+	if err := cfg.ValidateCollector(); err == nil {
+		t.Errorf("Expected validation error for profiles without signing key")
+	}
+	cfg.Collector.ProfileKeyFile = "profile.key"
+	cfg.Collector.Profiles[0].Sensors = []string{"dmz-["}
+	if err := cfg.ValidateCollector(); err == nil {
+		t.Errorf("Expected validation error for invalid profile pattern")
+	}
+	cfg.Collector.Profiles[0].Sensors = []string{"dmz-*"}
+	cfg.Collector.CorrelationWindow = 0
+	if err := cfg.ValidateCollector(); err == nil {
+		t.Errorf("Expected validation error for fleet denylist without correlation")
+	}
+	cfg.Collector.CorrelationWindow = time.Hour
+	if err := cfg.ValidateCollector(); err != nil {
+		t.Errorf("Expected no validation error, but got: %v", err)
+	}
+
+	cfg.Collector.Dashboard = true
+	if err := cfg.ValidateCollector(); err == nil {
+		t.Errorf("Expected validation error for dashboard without API token")
+	}
+
+	cfg.Collector.APIToken = "secret"
+	cfg.Log.File = "stdout"
+	if err := cfg.ValidateCollector(); err == nil {
+		t.Errorf("Expected validation error for API without log file")
+	}
+
+	cfg.Log.File = "fleet.log"
+	if err := cfg.ValidateCollector(); err != nil {
+		t.Errorf("Expected no validation error, but got: %v", err)
+	}
+
+	tenant := CollectorTenantConfig{Name: "acme", Sensors: []string{"acme-*"}, LogFile: "acme.log", APIToken: "acme-secret"}
+	cfg.Collector.Tenants = []CollectorTenantConfig{tenant}
+	if err := cfg.ValidateCollector(); err != nil {
+		t.Errorf("Expected no validation error, but got: %v", err)
+	}
+	for name, invalid := range map[string]func(t *CollectorTenantConfig){
+		"invalid name":    func(t *CollectorTenantConfig) { t.Name = "acme corp" },
+		"no sensors":      func(t *CollectorTenantConfig) { t.Sensors = nil },
+		"invalid pattern": func(t *CollectorTenantConfig) { t.Sensors = []string{"acme-["} },
+		"no log file":     func(t *CollectorTenantConfig) { t.LogFile = "" },
+		"shared log file": func(t *CollectorTenantConfig) { t.LogFile = "./fleet.log" },
+	} {
+		changed := tenant
+		invalid(&changed)
+		cfg.Collector.Tenants = []CollectorTenantConfig{changed}
+		if err := cfg.ValidateCollector(); err == nil {
+			t.Errorf("Expected validation error for tenant with %s", name)
+		}
+	}
+	cfg.Collector.Tenants = []CollectorTenantConfig{tenant, tenant}
+	if err := cfg.ValidateCollector(); err == nil {
+		t.Errorf("Expected validation error for duplicate tenants")
+	}
+	cfg.Collector.Tenants = nil
+
+	cfg.Collector.MaxBatchBytes = 0
+	if err := cfg.ValidateCollector(); err == nil {
+		t.Errorf("Expected validation error for zero batch size")
+	}
+}
+
+func TestSettings(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Admin.StreamToken = "stream-secret"
+	cfg.Privacy.PasswordKeyFile = "/etc/fakessh/password.key"
+	cfg.Alerts.Email.Password = "smtp-secret"
+	cfg.Tracing.Headers = map[string]string{"Authorization": "Bearer otlp-secret"}
+	cfg.Tags = map[string]string{"datacenter": "fra1"}
+
+	settings := cfg.Settings()
+	data, err := json.Marshal(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"stream-secret", "smtp-secret", "otlp-secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Expected %s to be redacted: %s", secret, data)
+		}
+	}
+
+	admin := settings["admin"].(map[string]interface{})
+	if admin["stream_token"] != redacted || admin["sessions"] != 1000 {
+		t.Errorf("Unexpected admin settings: %v", admin)
+	}
+	if settings["privacy"].(map[string]interface{})["password_key_file"] != "/etc/fakessh/password.key" {
+		t.Errorf("Expected the paths of secrets to be shown")
+	}
+	if settings["access"].(map[string]interface{})["tarpit_delay"] != "30s" {
+		t.Errorf("Expected durations as strings: %v", settings["access"])
+	}
+	if settings["tags"].(map[string]interface{})["datacenter"] != "fra1" {
+		t.Errorf("Expected the tags to be shown: %v", settings["tags"])
+	}
+	if _, ok := settings["log"].(map[string]interface{})["encryption"]; !ok {
+		t.Errorf("Expected nested settings: %v", settings["log"])
+	}
+}
+
+func TestDiff(t *testing.T) {
+	previous := DefaultConfig()
+	previous.Alerts.Email.Password = "old-secret"
+	current := DefaultConfig()
+	current.Alerts.Email.Password = "new-secret"
+	current.Access.DelayMin = time.Second
+	current.Access.Denylist = []string{"192.0.2.0/24"}
+	current.Tags = map[string]string{"datacenter": "fra1"}
+
+	if changes := Diff(previous, previous); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v", changes)
+	}
+
+	changes := Diff(previous, current)
+	want := []Change{
+		{Key: "access.delay_min", Previous: "200ms", Value: "1s"},
+		{Key: "access.denylist", Previous: []interface{}{}, Value: []interface{}{"192.0.2.0/24"}},
+		{Key: "alerts.email.password", Previous: redacted, Value: redacted},
+		{Key: "tags.datacenter", Previous: nil, Value: "fra1"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Expected %v, got %v", want, changes)
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	secret, err := ReadSecret("literal", "/non/existing/file")
+	if err != nil || string(secret) != "literal" {
+		t.Errorf("Expected literal secret, got '%s' (%v)", secret, err)
+	}
+
+	tmpFile, err := os.CreateTemp("", "secret-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.WriteString("from-file\n")
+	tmpFile.Close()
+
+	secret, err = ReadSecret("", tmpFile.Name())
+	if err != nil || string(secret) != "from-file" {
+		t.Errorf("Expected secret from file, got '%s' (%v)", secret, err)
+	}
+
+	if _, err := ReadSecret("", "/non/existing/file"); err == nil {
+		t.Errorf("Expected error for missing secret file")
+	}
+}
+
+func TestProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dmz.yaml")
+	os.WriteFile(path, []byte(`name: dmz
+server_version: OpenSSH_9.6p1
+banner: Ubuntu-3ubuntu13
+access:
+  delay_min: 1s
+  delay_max: 3s
+  tarpit: true
+alerts:
+  attempts_threshold: 50
+  threshold_window: 5m
+  rules:
+    - name: root_login
+      conditions:
+        - field: username
+          in: [root]
+`), 0644)
+	p, err := LoadProfile(path)
+	if err != nil {
+		t.Fatalf("LoadProfile() error: %v", err)
+	}
+
+	// Profiles are sent to the sensors as JSON
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = ParseProfile(data)
+	if err != nil {
+		t.Fatalf("ParseProfile() error: %v", err)
+	}
+
+	cfg := DefaultConfig()
+	profiled, err := cfg.WithProfile(p)
+	if err != nil {
+		t.Fatalf("WithProfile() error: %v", err)
+	}
+	if profiled.ServerVersion != "OpenSSH_9.6p1" || profiled.Banner != "Ubuntu-3ubuntu13" {
+		t.Errorf("Unexpected identity %s %s", profiled.ServerVersion, profiled.Banner)
+	}
+	if profiled.Access.DelayMin != time.Second || profiled.Access.DelayMax != 3*time.Second || !profiled.Access.Tarpit {
+		t.Errorf("Unexpected access settings %+v", profiled.Access)
+	}
+	if profiled.Alerts.AttemptsThreshold != 50 || len(profiled.Alerts.Rules) != 1 || profiled.Alerts.Rules[0].Conditions[0].In[0] != "root" {
+		t.Errorf("Unexpected alert settings %+v", profiled.Alerts)
+	}
+	if cfg.Banner == profiled.Banner || cfg.Access.Tarpit {
+		t.Errorf("Expected the configuration to be left unchanged")
+	}
+
+	// The result must be valid
+	p.Access.DelayMax = 500 * time.Millisecond
+	if _, err := cfg.WithProfile(p); err == nil {
+		t.Errorf("Expected an error for a delay range inverted by the profile")
+	}
+
+	for name, invalid := range map[string]string{
+		"no name":        `{"ServerVersion": "OpenSSH_9.6p1"}`,
+		"spaces":         `{"Name": "dmz", "ServerVersion": "OpenSSH 9.6p1"}`,
+		"newline":        `{"Name": "dmz", "Banner": "Ubuntu\r\nSSH-2.0-x"}`,
+		"invalid rule":   `{"Name": "dmz", "Alerts": {"Rules": [{"Name": ""}]}}`,
+		"invalid JSON":   `{"Name": `,
+		"negative delay": `{"Name": "dmz", "Access": {"DelayMin": -1}}`,
+	} {
+		if _, err := ParseProfile([]byte(invalid)); err == nil {
+			t.Errorf("Expected an error for a profile with %s", name)
+		}
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+server-version: OpenSSH_9.6p1
+tags:
+  any-tag: value
+log:
+  file: credentials.log
+  sinks:
+    - type: file
+      pth: /var/log/fakessh.log
+access:
+  delay_min: 1s
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := UnknownKeys(path)
+	if err != nil {
+		t.Fatalf("UnknownKeys() error: %v", err)
+	}
+	if want := []string{"log.sinks[0].pth", "server-version"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Expected %v, got %v", want, keys)
+	}
+}
+
+func TestLoadConfigUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+server-version: OpenSSH_9.6p1
+prot: 22
+log:
+  sinks:
+    - type: file
+      wibble: true
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadConfig(path)
+	if !errors.Is(err, ErrConfigInvalid) {
+		t.Fatalf("Expected an error wrapping ErrConfigInvalid for unknown keys, got: %v", err)
+	}
+	for _, want := range []string{
+		`"server-version" (did you mean "server_version"?)`,
+		`"prot" (did you mean "port"?)`,
+		`"log.sinks[0].wibble" (valid keys: exclude, fields, format, path, rename, type)`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestLoadProfileUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.yaml")
+	if err := os.WriteFile(path, []byte("name: edge\nbaner: Debian\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProfile(path); err == nil || !strings.Contains(err.Error(), `did you mean "banner"?`) {
+		t.Errorf("Expected a suggestion for a misspelled key, got: %v", err)
+	}
+}
+
+func TestExample(t *testing.T) {
+	data, err := Example()
+	if err != nil {
+		t.Fatalf("Example() error: %v", err)
+	}
+	for _, want := range []string{
+		"# Server port\nport: 2222\n",
+		"  # Additional log destinations\n  sinks: []\n  # - type: \"\"\n",
+		"  #   conditions:\n  #     - field: \"\"\n",
+		"    segment_interval: 1m\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected example to contain %q", want)
+		}
+	}
+
+	// The example loads as the default configuration
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if changes := Diff(DefaultConfig(), loaded); len(changes) > 0 {
+		t.Errorf("Expected the default configuration, got changes %v", changes)
+	}
+}
+
+func TestLoadConfigExpansion(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "password.key")
+	if err := os.WriteFile(keyFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKESSH_TEST_TOKEN", "abc123")
+	t.Setenv("FAKESSH_TEST_DC", "fra1")
+
+	path := filepath.Join(dir, "config.yaml")
+	content := `
+tags:
+  datacenter: ${FAKESSH_TEST_DC}
+privacy:
+  password_mode: hmac
+  password_key: file://` + keyFile + `
+alerts:
+  slack:
+    webhook_url: https://hooks.slack.com/services/${FAKESSH_TEST_TOKEN}
+    template: "cost: $${FAKESSH_TEST_TOKEN}"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if got := config.Tags["datacenter"]; got != "fra1" {
+		t.Errorf("Expected datacenter tag fra1, got %q", got)
+	}
+	if got := config.Privacy.PasswordKey; got != "s3cret" {
+		t.Errorf("Expected password key from file, got %q", got)
+	}
+	if got := config.Alerts.Slack.WebhookURL; got != "https://hooks.slack.com/services/abc123" {
+		t.Errorf("Expected expanded webhook URL, got %q", got)
+	}
+	if got := config.Alerts.Slack.Template; got != "cost: ${FAKESSH_TEST_TOKEN}" {
+		t.Errorf("Expected escaped placeholder, got %q", got)
+	}
+
+	for name, content := range map[string]string{
+		"unset variable": "banner: ${FAKESSH_TEST_UNSET}\n",
+		"missing file":   "banner: file://" + filepath.Join(dir, "missing") + "\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "banner:") {
+			t.Errorf("Expected an error naming the key for %s, got: %v", name, err)
+		}
+	}
+}
+
+func TestLoadConfigSecretReferences(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/fakessh" || r.Header.Get("X-Vault-Token") != "hvs.test" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"password_key":"k3y"},"metadata":{"version":1}}}`))
+	}))
+	defer srv.Close()
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "hvs.test")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+privacy:
+  password_mode: hmac
+  password_key: vault://secret/data/fakessh#password_key
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if config.Privacy.PasswordKey != "k3y" {
+		t.Errorf("Expected the password key of Vault, got %q", config.Privacy.PasswordKey)
+	}
+
+	content = strings.Replace(content, "#password_key", "#ip_key", 1)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "privacy.password_key: vault:") {
+		t.Errorf("Expected an error naming the key and the store, got: %v", err)
+	}
+}
+
+func TestLoadConfigIncludes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.yaml": `
+port: 2200
+server_version: OpenSSH_9.6p1
+log:
+  format: pretty
+tags:
+  fleet: eu
+`,
+		"conf.d/10-site.yaml": `
+tags:
+  site: fra1
+log:
+  file: /var/log/fakessh/credentials.log
+`,
+		"sensor.yaml": `
+includes:
+  - base.yaml
+  - conf.d/*.yaml
+port: 2222
+tags:
+  sensor_id: fra1-01
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := LoadConfig(filepath.Join(dir, "sensor.yaml"))
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if config.Port != 2222 || config.ServerVersion != "OpenSSH_9.6p1" {
+		t.Errorf("Expected port 2222 and the base server version, got %d and %s", config.Port, config.ServerVersion)
+	}
+	if config.Log.Format != "pretty" || config.Log.File != "/var/log/fakessh/credentials.log" {
+		t.Errorf("Expected log settings of the base and site files, got %+v", config.Log)
+	}
+	want := map[string]string{"fleet": "eu", "site": "fra1", "sensor_id": "fra1-01"}
+	if !reflect.DeepEqual(config.Tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, config.Tags)
+	}
+
+	// Files including each other are rejected
+	if err := os.WriteFile(filepath.Join(dir, "base.yaml"), []byte("includes: [sensor.yaml]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(filepath.Join(dir, "sensor.yaml")); err == nil || !strings.Contains(err.Error(), "include each other") {
+		t.Errorf("Expected an error for an include cycle, got: %v", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	flags := make(map[string]bool)
+	envs := make(map[string]bool)
+	var logFile *Option
+	for _, opt := range Options() {
+		if flags[opt.Flag] || envs[opt.Env] {
+			t.Errorf("Duplicate flag or environment variable of %s", opt.Key)
+		}
+		flags[opt.Flag], envs[opt.Env] = true, true
+		if opt.Key == "log.file" {
+			logFile = &opt
+		}
+		if strings.HasPrefix(opt.Key, "log.sinks") {
+			t.Errorf("Unexpected option for list of structs: %s", opt.Key)
+		}
+	}
+	if logFile == nil {
+		t.Fatal("Expected an option for log.file")
+	}
+	if logFile.Flag != "log-file" || logFile.Env != "FAKESSH_LOG_FILE" || logFile.Default != "credentials.log" {
+		t.Errorf("Unexpected option: %+v", *logFile)
+	}
+	if !strings.HasPrefix(logFile.Usage, "Path to log file") {
+		t.Errorf("Expected the description of the field, got %q", logFile.Usage)
+	}
+}
+
+func TestLoadConfigEnvOptions(t *testing.T) {
+	t.Setenv("FAKESSH_ENRICHMENT_RDNS_TIMEOUT", "5s")
+	t.Setenv("FAKESSH_ENRICHMENT_ABUSEIPDB_API_KEY", "former")
+	t.Setenv("FAKESSH_ACCESS_DENYLIST", "192.0.2.0/24, 198.51.100.1")
+	config, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if config.Enrichment.RDNS.Timeout != 5*time.Second {
+		t.Errorf("Expected rDNS timeout 5s, got %v", config.Enrichment.RDNS.Timeout)
+	}
+	if config.Enrichment.Reputation.AbuseIPDB.APIKey != "former" {
+		t.Errorf("Expected the API key of the former variable, got %q", config.Enrichment.Reputation.AbuseIPDB.APIKey)
+	}
+	if want := []string{"192.0.2.0/24", "198.51.100.1"}; !reflect.DeepEqual(config.Access.Denylist, want) {
+		t.Errorf("Expected denylist %v, got %v", want, config.Access.Denylist)
+	}
+
+	t.Setenv("FAKESSH_PORT", "ssh")
+	if _, err := LoadConfig(""); err == nil || !strings.Contains(err.Error(), "FAKESSH_PORT") {
+		t.Errorf("Expected an error naming the variable, got: %v", err)
+	}
+}
+
+func TestApplyFlags(t *testing.T) {
+	flags := pflag.NewFlagSet("fakessh", pflag.ContinueOnError)
+	if err := AddFlag(flags, "tag", "tags", "static tag"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFlag(flags, "missing", "no.such.key", ""); err == nil {
+		t.Error("Expected an error for an unknown key")
+	}
+	AddFlags(flags)
+	if f := flags.Lookup("log-file"); f == nil || !f.Hidden {
+		t.Errorf("Expected a hidden flag for log.file, got %+v", f)
+	}
+
+	err := flags.Parse([]string{
+		"--log-file", "/tmp/credentials.log",
+		"--tag", "dc=fra1", "--tag", "rack=r1",
+		"--enrichment-rdns-enabled",
+		"--enrichment-rdns-timeout", "3s",
+		"--access-allowlist", "10.0.0.0/8",
+	})
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	config := DefaultConfig()
+	ApplyFlags(config, flags)
+	if config.Log.File != "/tmp/credentials.log" || !config.Enrichment.RDNS.Enabled || config.Enrichment.RDNS.Timeout != 3*time.Second {
+		t.Errorf("Flags not applied: %+v %+v", config.Log, config.Enrichment.RDNS)
+	}
+	if want := map[string]string{"dc": "fra1", "rack": "r1"}; !reflect.DeepEqual(config.Tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, config.Tags)
+	}
+	if want := []string{"10.0.0.0/8"}; !reflect.DeepEqual(config.Access.Allowlist, want) {
+		t.Errorf("Expected allowlist %v, got %v", want, config.Access.Allowlist)
+	}
+	if config.Port != 2222 {
+		t.Errorf("Expected the default port, got %d", config.Port)
+	}
+
+	if err := flags.Parse([]string{"--port", "ssh"}); err == nil {
+		t.Error("Expected an error for an invalid port")
+	}
+}
+
+func TestLoadConfigStateDir(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	data := `state_dir: "/data"
+private_key_path: "keys/host_key"
+log:
+  file: "/var/log/fakessh/credentials.log"
+  sinks:
+    - type: "file"
+      path: "events.log"
+    - type: "stdout"
+enrichment:
+  cache:
+    file: "cache.json"
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	for _, tt := range []struct{ got, want string }{
+		{cfg.PrivateKeyPath, "/data/keys/host_key"},
+		{cfg.Sensor.IDFile, "/data/sensor-id"},
+		{cfg.Log.File, "/var/log/fakessh/credentials.log"},
+		{cfg.Log.EmergencyFile, "/data/credentials.emergency.log"},
+		{cfg.Log.Sinks[0].Path, "/data/events.log"},
+		{cfg.Log.Sinks[1].Path, ""},
+		{cfg.OpsLog.File, "stderr"},
+		{cfg.Enrichment.Cache.File, "/data/cache.json"},
+		{cfg.Enrichment.GeoIP.Database, ""},
+		{cfg.Forward.SpoolDir, "/data/spool"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, tt.got)
+		}
+	}
+
+	// Paths are resolved against the state directory of the flags
+	flags := pflag.NewFlagSet("fakessh", pflag.ContinueOnError)
+	AddFlags(flags)
+	if err := flags.Parse([]string{"--state-dir", dir, "--sensor-id-file", "id"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = LoadConfigFlags(path, flags); err != nil {
+		t.Fatalf("LoadConfigFlags() error: %v", err)
+	}
+	if want := filepath.Join(dir, "keys/host_key"); cfg.PrivateKeyPath != want {
+		t.Errorf("Expected %q, got %q", want, cfg.PrivateKeyPath)
+	}
+	if want := filepath.Join(dir, "id"); cfg.Sensor.IDFile != want {
+		t.Errorf("Expected %q, got %q", want, cfg.Sensor.IDFile)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error: %v", err)
+	}
+
+	cfg.StateDir = filepath.Join(dir, "missing")
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an error for a missing state directory")
+	}
+}
+
+func TestAdminSessionsEnabled(t *testing.T) {
+	admin := DefaultConfig().Admin
+	if admin.SessionsEnabled() {
+		t.Error("Expected sessions to be disabled without an admin token")
+	}
+	admin.TokenFile = "/etc/fakessh/admin.token"
+	if !admin.SessionsEnabled() {
+		t.Error("Expected sessions to be enabled with an admin token")
+	}
+	admin.Sessions = 0
+	if admin.SessionsEnabled() {
+		t.Error("Expected sessions to be disabled with 0 sessions")
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package config
+
+import (
+	"bytes"
+	_ "embed"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configSource is the source of the configuration structs, whose field
+// comments document the settings of the example configuration
+//
+//go:embed config.go
+var configSource []byte
+
+// durationType is the type of duration settings, written as "5m" rather
+// than nanoseconds
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Example returns a YAML configuration with every setting at its default
+// value, each preceded by the comment of its field. Lists of structs are
+// empty, with their entries shown commented out.
+func Example() ([]byte, error) {
+	docs, err := fieldDocs()
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString("# fakessh configuration with the default settings\n")
+	b.WriteString("#\n")
+	b.WriteString("# Generated by \"fakessh config init\". Settings can also be set through\n")
+	b.WriteString("# FAKESSH_* environment variables and command line flags.\n")
+	e := &exampleWriter{b: &b, docs: docs}
+	e.writeStruct(reflect.ValueOf(*DefaultConfig()), "", true)
+	return b.Bytes(), nil
+}
+
+// fieldDocs returns the comments of the fields of the configuration structs
+// by "Type.Field"
+func fieldDocs() (map[string]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "config.go", configSource, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	docs := make(map[string]string)
+	ast.Inspect(file, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		s, ok := spec.Type.(*ast.StructType)
+		if !ok {
+			return false
+		}
+		for _, field := range s.Fields.List {
+			doc := strings.TrimSpace(field.Doc.Text() + field.Comment.Text())
+			if doc == "" {
+				continue
+			}
+			for _, name := range field.Names {
+				docs[spec.Name.Name+"."+name.Name] = doc
+			}
+			if len(field.Names) == 0 {
+				// Embedded fields are named by their type
+				if ident, ok := field.Type.(*ast.Ident); ok {
+					docs[spec.Name.Name+"."+ident.Name] = doc
+				}
+			}
+		}
+		return false
+	})
+	return docs, nil
+}
+
+// exampleWriter writes the settings of the example configuration
+type exampleWriter struct {
+	b    *bytes.Buffer
+	docs map[string]string
+}
+
+// writeStruct writes the settings of a configuration struct at an
+// indentation, with the comments of their fields if documented is set
+func (e *exampleWriter) writeStruct(v reflect.Value, indent string, documented bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, opts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if documented {
+			if indent == "" {
+				// Separate the sections of the configuration
+				e.b.WriteString("\n")
+			}
+			if doc := e.docs[t.Name()+"."+field.Name]; doc != "" {
+				for _, line := range strings.Split(doc, "\n") {
+					e.b.WriteString(strings.TrimRight(indent+"# "+line, " ") + "\n")
+				}
+			}
+		}
+		if opts == "squash" {
+			e.writeStruct(v.Field(i), indent, documented)
+			continue
+		}
+		if key == "" || key == "-" || !field.IsExported() {
+			continue
+		}
+		e.writeSetting(key, v.Field(i), indent, documented)
+	}
+}
+
+// writeSetting writes a setting and its value
+func (e *exampleWriter) writeSetting(key string, v reflect.Value, indent string, documented bool) {
+	switch {
+	case v.Type() == durationType:
+		e.b.WriteString(indent + key + ": " + formatDuration(time.Duration(v.Int())) + "\n")
+	case v.Kind() == reflect.Struct:
+		e.b.WriteString(indent + key + ":\n")
+		e.writeStruct(v, indent+"  ", documented)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		if v.Len() == 0 {
+			entry := reflect.New(v.Type().Elem()).Elem()
+			if !documented {
+				// Entries are commented out as a whole
+				e.b.WriteString(indent + key + ":\n")
+				e.writeEntry(entry, indent+"  ")
+				return
+			}
+			// Show the settings of an entry commented out
+			e.b.WriteString(indent + key + ": []\n")
+			e.writeEntry(entry, indent+"# ")
+			return
+		}
+		e.b.WriteString(indent + key + ":\n")
+		for i := 0; i < v.Len(); i++ {
+			e.writeEntry(v.Index(i), indent+"  ")
+		}
+	case v.Kind() == reflect.Map:
+		if v.Len() == 0 {
+			e.b.WriteString(indent + key + ": {}\n")
+			return
+		}
+		e.b.WriteString(indent + key + ":\n")
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		for _, k := range keys {
+			e.writeSetting(k.String(), v.MapIndex(k), indent+"  ", documented)
+		}
+	case v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface:
+		if v.IsNil() {
+			e.b.WriteString(indent + key + ":\n")
+			return
+		}
+		e.writeSetting(key, v.Elem(), indent, documented)
+	default:
+		e.b.WriteString(indent + key + ": " + formatScalar(v.Interface()) + "\n")
+	}
+}
+
+// writeEntry writes a struct as an entry of a list, without the comments of
+// its fields
+func (e *exampleWriter) writeEntry(v reflect.Value, indent string) {
+	var entry bytes.Buffer
+	(&exampleWriter{b: &entry, docs: e.docs}).writeStruct(v, "", false)
+	prefix := "- "
+	for _, line := range strings.SplitAfter(entry.String(), "\n") {
+		if line != "" {
+			e.b.WriteString(indent + prefix + line)
+			prefix = "  "
+		}
+	}
+}
+
+// formatScalar returns the YAML of a value in flow style, such as "" or
+// [a, b]
+func formatScalar(value interface{}) string {
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return ""
+	}
+	node.Style |= yaml.FlowStyle
+	if err := enc.Encode(node); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// formatDuration returns a duration without zero units, such as "5m"
+// rather than "5m0s"
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
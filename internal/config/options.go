@@ -0,0 +1,340 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// EnvPrefix is the prefix of the environment variables of settings
+const EnvPrefix = "FAKESSH_"
+
+// Option is a setting that can be given with a command line flag and an
+// environment variable, both named after its key: log.file is --log-file and
+// FAKESSH_LOG_FILE. Lists of structs, such as log.sinks, and includes are
+// only set in configuration files.
+type Option struct {
+	// Key of the setting, such as "log.file"
+	Key string
+	// Flag name, such as "log-file"
+	Flag string
+	// Environment variable, such as "FAKESSH_LOG_FILE"
+	Env string
+	// First line of the description of the setting
+	Usage string
+	// Default value, formatted as in a flag
+	Default string
+
+	index []int
+	typ   reflect.Type
+}
+
+// envAliases are the former environment variables of settings, which are
+// still read
+var envAliases = map[string]string{
+	"FAKESSH_ENRICHMENT_ABUSEIPDB_ENABLED":      "enrichment.reputation.abuseipdb.enabled",
+	"FAKESSH_ENRICHMENT_ABUSEIPDB_API_KEY":      "enrichment.reputation.abuseipdb.api_key",
+	"FAKESSH_ENRICHMENT_ABUSEIPDB_API_KEY_FILE": "enrichment.reputation.abuseipdb.api_key_file",
+	"FAKESSH_ENRICHMENT_GREYNOISE_ENABLED":      "enrichment.reputation.greynoise.enabled",
+	"FAKESSH_ENRICHMENT_GREYNOISE_API_KEY":      "enrichment.reputation.greynoise.api_key",
+	"FAKESSH_ENRICHMENT_GREYNOISE_API_KEY_FILE": "enrichment.reputation.greynoise.api_key_file",
+}
+
+// options returns the options of the configuration in key order, built once
+var options = sync.OnceValues(func() ([]Option, error) {
+	docs, err := fieldDocs()
+	if err != nil {
+		return nil, err
+	}
+	var opts []Option
+	collectOptions(reflect.ValueOf(*DefaultConfig()), "", nil, docs, &opts)
+	return opts, nil
+})
+
+// Options returns the settings that can be given with flags and environment
+// variables, in the order of the configuration
+func Options() []Option {
+	opts, err := options()
+	if err != nil {
+		// The source of the configuration is embedded, it always parses
+		panic(err)
+	}
+	return opts
+}
+
+// collectOptions adds the options of the settings of a struct
+func collectOptions(v reflect.Value, prefix string, index []int, docs map[string]string, opts *[]Option) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+		key, tagOpts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if tagOpts == "squash" {
+			collectOptions(v.Field(i), prefix, fieldIndex, docs, opts)
+			continue
+		}
+		if key == "" || key == "-" || !field.IsExported() {
+			continue
+		}
+		key = prefix + key
+		if key == "includes" {
+			// Includes are read while loading files, before any option
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			collectOptions(v.Field(i), key+".", fieldIndex, docs, opts)
+			continue
+		}
+		if !optionType(field.Type) {
+			continue
+		}
+		usage, _, _ := strings.Cut(docs[t.Name()+"."+field.Name], "\n")
+		*opts = append(*opts, Option{
+			Key:     key,
+			Flag:    strings.NewReplacer(".", "-", "_", "-").Replace(key),
+			Env:     EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_")),
+			Usage:   usage,
+			Default: formatOption(v.Field(i)),
+			index:   fieldIndex,
+			typ:     field.Type,
+		})
+	}
+}
+
+// optionType reports whether settings of a type can be given as text
+func optionType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// formatOption formats a value as it is given: durations like "5m", lists
+// and maps separated by commas
+func formatOption(v reflect.Value) string {
+	switch {
+	case v.Type() == durationType && v.Int() == 0:
+		return "0"
+	case v.Type() == durationType:
+		return formatDuration(time.Duration(v.Int()))
+	case v.Kind() == reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).String()
+		}
+		return strings.Join(items, ",")
+	case v.Kind() == reflect.Map:
+		pairs := make([]string, 0, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			pairs = append(pairs, iter.Key().String()+"="+iter.Value().String())
+		}
+		return strings.Join(pairs, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// parseOption parses the text of an option into a value of its type. Lists
+// and maps are merged into the previous value if merge is set, for flags
+// that are repeated.
+func parseOption(t reflect.Type, s string, previous reflect.Value, merge bool) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch {
+	case t == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(int64(d))
+	case t.Kind() == reflect.String:
+		v.SetString(s)
+	case t.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	case t.Kind() == reflect.Int || t.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(n)
+	case t.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(f)
+	case t.Kind() == reflect.Slice:
+		if merge && previous.IsValid() {
+			v = reflect.AppendSlice(v, previous)
+		}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				v = reflect.Append(v, reflect.ValueOf(item))
+			}
+		}
+	case t.Kind() == reflect.Map:
+		pairs, err := ParseTags(s)
+		if err != nil {
+			return v, err
+		}
+		v.Set(reflect.MakeMap(t))
+		if merge && previous.IsValid() {
+			for iter := previous.MapRange(); iter.Next(); {
+				v.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+		for k, value := range pairs {
+			v.SetMapIndex(reflect.ValueOf(k), reflect.ValueOf(value))
+		}
+	}
+	return v, nil
+}
+
+// applyEnv sets the settings given with environment variables. Empty
+// variables are ignored.
+func applyEnv(config *Config) error {
+	set := func(opt Option, env string) error {
+		s := os.Getenv(env)
+		if s == "" {
+			return nil
+		}
+		value, err := parseOption(opt.typ, s, reflect.Value{}, false)
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %w", env, err)
+		}
+		reflect.ValueOf(config).Elem().FieldByIndex(opt.index).Set(value)
+		return nil
+	}
+
+	opts := Options()
+	for env, key := range envAliases {
+		for _, opt := range opts {
+			if opt.Key == key {
+				if err := set(opt, env); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, opt := range opts {
+		if err := set(opt, opt.Env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// optionValue is the flag of an option, keeping the parsed value until it
+// is applied to a configuration
+type optionValue struct {
+	option Option
+	value  reflect.Value
+}
+
+// String returns the value of the flag, or the default before it is set
+func (o *optionValue) String() string {
+	if !o.value.IsValid() {
+		return o.option.Default
+	}
+	return formatOption(o.value)
+}
+
+// Set parses a value of the flag; lists and maps of repeated flags are
+// merged
+func (o *optionValue) Set(s string) error {
+	value, err := parseOption(o.option.typ, s, o.value, true)
+	if err != nil {
+		return err
+	}
+	o.value = value
+	return nil
+}
+
+// Type names the type of the flag in the usage
+func (o *optionValue) Type() string {
+	t := o.option.typ
+	switch {
+	case t == durationType:
+		return "duration"
+	case t.Kind() == reflect.Slice:
+		return "strings"
+	case t.Kind() == reflect.Map:
+		return "stringToString"
+	case t.Kind() == reflect.Int64:
+		return "int"
+	}
+	return t.Kind().String()
+}
+
+// AddFlag adds a flag with a name and usage for the setting with a key
+func AddFlag(flags *pflag.FlagSet, name, key, usage string) error {
+	for _, opt := range Options() {
+		if opt.Key == key {
+			addOptionFlag(flags, name, usage, opt)
+			return nil
+		}
+	}
+	return fmt.Errorf("no setting %s", key)
+}
+
+// AddFlags adds a hidden flag for every option whose flag is not in the set
+// yet, so that flags added with AddFlag under the same name are kept
+func AddFlags(flags *pflag.FlagSet) {
+	for _, opt := range Options() {
+		if flags.Lookup(opt.Flag) != nil {
+			continue
+		}
+		addOptionFlag(flags, opt.Flag, opt.Usage, opt)
+		flags.MarkHidden(opt.Flag)
+	}
+}
+
+// addOptionFlag adds the flag of an option
+func addOptionFlag(flags *pflag.FlagSet, name, usage string, opt Option) {
+	f := flags.VarPF(&optionValue{option: opt}, name, "", usage)
+	if opt.typ.Kind() == reflect.Bool {
+		f.NoOptDefVal = "true"
+	}
+}
+
+// ApplyFlags sets the settings of the flags added by AddFlag and AddFlags
+// that were given, which take precedence over files and the environment
+func ApplyFlags(config *Config, flags *pflag.FlagSet) {
+	flags.Visit(func(f *pflag.Flag) {
+		if o, ok := f.Value.(*optionValue); ok && o.value.IsValid() {
+			reflect.ValueOf(config).Elem().FieldByIndex(o.option.index).Set(o.value)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+)
+
+// maxProfileBannerLength keeps the version string of a profile within the
+// 255 characters of SSH
+const maxProfileBannerLength = 200
+
+// Profile is the part of the sensor settings a collector distributes to its
+// sensors: the SSH identity, the attempt delays and the alerts. Settings
+// left empty keep the local value.
+type Profile struct {
+	// Name of the profile, logged when it is applied
+	Name string `mapstructure:"name"`
+	// Server version and banner shown to clients
+	ServerVersion string `mapstructure:"server_version"`
+	Banner        string `mapstructure:"banner"`
+	// Attempt delays and tarpit
+	Access ProfileAccessConfig `mapstructure:"access"`
+	// Alert threshold and rules
+	Alerts ProfileAlertsConfig `mapstructure:"alerts"`
+}
+
+// ProfileAccessConfig contains the access settings of a profile
+type ProfileAccessConfig struct {
+	// Bounds of the random delay before an attempt is rejected, set if not 0
+	DelayMin time.Duration `mapstructure:"delay_min"`
+	DelayMax time.Duration `mapstructure:"delay_max"`
+	// Hold every attempt for the tarpit delay, set if not empty
+	Tarpit *bool `mapstructure:"tarpit"`
+}
+
+// ProfileAlertsConfig contains the alert settings of a profile
+type ProfileAlertsConfig struct {
+	// Alert when a source reaches this many attempts within ThresholdWindow,
+	// set if not empty
+	AttemptsThreshold *int          `mapstructure:"attempts_threshold"`
+	ThresholdWindow   time.Duration `mapstructure:"threshold_window"`
+	// Custom alert rules replacing the local ones, if there are any
+	Rules []AlertRuleConfig `mapstructure:"rules"`
+}
+
+// LoadProfile reads a profile from a YAML or JSON file
+func LoadProfile(path string) (*Profile, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading profile: %w", err)
+	}
+	var p Profile
+	var metadata mapstructure.Metadata
+	if err := v.Unmarshal(&p, decodeStrict(&metadata)); err != nil {
+		return nil, fmt.Errorf("error parsing profile: %w", err)
+	}
+	if err := unknownKeysError(metadata.Unused, reflect.TypeOf(p)); err != nil {
+		return nil, fmt.Errorf("error parsing profile: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid profile %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// ParseProfile decodes a profile sent by a collector
+func ParseProfile(data []byte) (*Profile, error) {
+	var p Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("error parsing profile: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid profile %s: %w", p.Name, err)
+	}
+	return &p, nil
+}
+
+// Validate checks the settings of a profile that do not depend on the local
+// configuration
+func (p *Profile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("profiles require a name")
+	}
+	if strings.ContainsFunc(p.ServerVersion, func(c rune) bool { return c <= ' ' || c > '~' }) {
+		return fmt.Errorf("invalid server version '%s': must be printable ASCII without spaces", p.ServerVersion)
+	}
+	if len(p.Banner) > maxProfileBannerLength || strings.ContainsFunc(p.Banner, func(c rune) bool { return c < ' ' || c > '~' }) {
+		return fmt.Errorf("invalid banner: must be printable ASCII of at most %d characters", maxProfileBannerLength)
+	}
+	if p.Access.DelayMin < 0 || p.Access.DelayMax < 0 {
+		return fmt.Errorf("invalid delay: must not be negative")
+	}
+	if p.Alerts.AttemptsThreshold != nil && *p.Alerts.AttemptsThreshold < 0 {
+		return fmt.Errorf("invalid alert attempts threshold: must not be negative")
+	}
+	for _, r := range p.Alerts.Rules {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithProfile returns a copy of the configuration with the settings of a
+// profile, or an error if the result is invalid
+func (c *Config) WithProfile(p *Profile) (*Config, error) {
+	profiled := *c
+	if p.ServerVersion != "" {
+		profiled.ServerVersion = p.ServerVersion
+	}
+	if p.Banner != "" {
+		profiled.Banner = p.Banner
+	}
+	if p.Access.DelayMin != 0 {
+		profiled.Access.DelayMin = p.Access.DelayMin
+	}
+	if p.Access.DelayMax != 0 {
+		profiled.Access.DelayMax = p.Access.DelayMax
+	}
+	if p.Access.Tarpit != nil {
+		profiled.Access.Tarpit = *p.Access.Tarpit
+	}
+	if p.Alerts.AttemptsThreshold != nil {
+		profiled.Alerts.AttemptsThreshold = *p.Alerts.AttemptsThreshold
+	}
+	if p.Alerts.ThresholdWindow != 0 {
+		profiled.Alerts.ThresholdWindow = p.Alerts.ThresholdWindow
+	}
+	if len(p.Alerts.Rules) > 0 {
+		profiled.Alerts.Rules = p.Alerts.Rules
+	}
+	if err := profiled.Validate(); err != nil {
+		return nil, fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	return &profiled, nil
+}
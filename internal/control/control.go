@@ -0,0 +1,396 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+// Package control serves the authenticated admin API, which shows the state
+// of the sensor and changes it at runtime
+package control
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/admin"
+	"github.com/abehterev/fakessh/internal/alert"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/sshserver"
+	"github.com/abehterev/fakessh/internal/stats"
+	"github.com/rs/zerolog/log"
+)
+
+// Endpoints of the API
+const (
+	StatusPath      = "/v1/status"
+	ConfigPath      = "/v1/config"
+	TarpitPath      = "/v1/tarpit"
+	DenylistPath    = "/v1/denylist"
+	RotateLogsPath  = "/v1/logs/rotate"
+	ReloadGeoIPPath = "/v1/geoip/reload"
+)
+
+// maxRequestBytes limits the bodies of requests
+const maxRequestBytes = 64 << 10
+
+// Config contains settings of the API server
+type Config struct {
+	// Address of the listener
+	Listen string
+	// Bearer tokens of clients
+	Tokens []string
+	// Server certificate and private key (PEM), plain HTTP if empty
+	CertFile string
+	KeyFile  string
+	// CA certificates (PEM) of client certificates accepted instead of a token
+	ClientCAFile string
+}
+
+// Sensor gives the API access to the parts of the sensor it shows and
+// changes. Functions that are nil are not available.
+type Sensor struct {
+	// Version of the binary and ID of the sensor
+	Version string
+	ID      string
+	// Listening reports an error if the SSH listener is not accepting connections
+	Listening func() error
+	// Stats returns the runtime statistics
+	Stats func() stats.Snapshot
+	// Settings returns the configuration with the secrets redacted
+	Settings func() map[string]interface{}
+	// Governor decides how connections are handled
+	Governor *sshserver.Governor
+	// RotateLogs rotates the log files and returns the rotated files
+	RotateLogs func() ([]string, error)
+	// ReloadGeoIP reopens the GeoIP and ASN databases
+	ReloadGeoIP func() error
+	// Banner and SetBanner show and change the SSH version banner
+	Banner    func() string
+	SetBanner func(banner string)
+	// Threshold is the attempts threshold alert, nil if alerting is disabled
+	Threshold *alert.ThresholdTrigger
+	// LogLevel and SetLogLevel show and change the operational log level
+	LogLevel    func() string
+	SetLogLevel func(level string) error
+	// Audit logs the events recording changes
+	Audit func(event *logger.Event) error
+}
+
+// Server is the API server
+type Server struct {
+	config Config
+	sensor Sensor
+	mux    *http.ServeMux
+	srv    *http.Server
+}
+
+// New creates an API server for the sensor
+func New(config Config, sensor Sensor) (*Server, error) {
+	s := &Server{
+		config: config,
+		sensor: sensor,
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET "+StatusPath, s.handleStatus)
+	s.mux.HandleFunc("GET "+ConfigPath, s.handleConfig)
+	s.mux.HandleFunc("GET "+TarpitPath, s.handleTarpit)
+	s.mux.HandleFunc("PUT "+TarpitPath, s.handleSetTarpit)
+	s.mux.HandleFunc("GET "+DenylistPath, s.handleDenylist)
+	s.mux.HandleFunc("POST "+DenylistPath, s.handleDeny)
+	s.mux.HandleFunc("DELETE "+DenylistPath+"/{entry...}", s.handleUndeny)
+	s.mux.HandleFunc("POST "+RotateLogsPath, s.handleRotateLogs)
+	s.mux.HandleFunc("POST "+ReloadGeoIPPath, s.handleReloadGeoIP)
+	s.mux.HandleFunc("GET "+RuntimePath, s.handleRuntime)
+	s.mux.HandleFunc("PATCH "+RuntimePath, s.handleChangeRuntime)
+	s.srv = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if config.CertFile != "" {
+		tlsConfig, err := serverTLS(config)
+		if err != nil {
+			return nil, err
+		}
+		s.srv.TLSConfig = tlsConfig
+	}
+	return s, nil
+}
+
+// serverTLS loads the server certificate and accepts client certificates
+// issued by the client CA, if one is configured
+func serverTLS(config Config) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("admin API certificate loading error: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if config.ClientCAFile != "" {
+		data, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("admin API client CA loading error: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("admin API client CA loading error: no certificates in %s", config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// Start binds the listener and serves requests in the background
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		return fmt.Errorf("admin API start error: %w", err)
+	}
+	log.Info().Str("listen", ln.Addr().String()).Bool("tls", s.srv.TLSConfig != nil).Msg("admin API started")
+
+	go func() {
+		var err error
+		if s.srv.TLSConfig != nil {
+			err = s.srv.ServeTLS(ln, "", "")
+		} else {
+			err = s.srv.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("admin API error")
+		}
+	}()
+	return nil
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
+
+// ServeHTTP passes the requests of authenticated clients to the endpoints
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if client(r) == "" && !admin.HasToken(r, s.config.Tokens) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="fakessh"`)
+		writeError(w, http.StatusUnauthorized, "missing or invalid API token or client certificate")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	s.mux.ServeHTTP(w, r)
+}
+
+// client returns the name of the verified client certificate of a request,
+// or "" if there is none
+func client(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.SerialNumber.String()
+}
+
+// clientName names the client of a request in the log of changes
+func clientName(r *http.Request) string {
+	if name := client(r); name != "" {
+		return name
+	}
+	return "token"
+}
+
+// Status is the state of the sensor
+type Status struct {
+	Version   string          `json:"version"`
+	SensorID  string          `json:"sensor_id"`
+	Listening bool            `json:"listening"`
+	Tarpit    TarpitState     `json:"tarpit"`
+	Denylist  int             `json:"denylist_entries"`
+	Stats     *stats.Snapshot `json:"stats,omitempty"`
+}
+
+// TarpitState is the state of the tarpit
+type TarpitState struct {
+	Enabled bool    `json:"enabled"`
+	Delay   float64 `json:"delay_seconds"`
+}
+
+// DenylistEntry is an address or CIDR range of the denylist
+type DenylistEntry struct {
+	Entry string `json:"entry"`
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := Status{
+		Version:   s.sensor.Version,
+		SensorID:  s.sensor.ID,
+		Listening: s.sensor.Listening != nil && s.sensor.Listening() == nil,
+		Tarpit:    s.tarpit(),
+		Denylist:  len(s.sensor.Governor.Denylist()),
+	}
+	if s.sensor.Stats != nil {
+		snapshot := s.sensor.Stats()
+		status.Stats = &snapshot
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if s.sensor.Settings == nil {
+		writeError(w, http.StatusNotFound, "configuration is not available")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.sensor.Settings())
+}
+
+// tarpit returns the state of the tarpit
+func (s *Server) tarpit() TarpitState {
+	enabled, delay := s.sensor.Governor.Tarpit()
+	return TarpitState{Enabled: enabled, Delay: delay.Seconds()}
+}
+
+func (s *Server) handleTarpit(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.tarpit())
+}
+
+func (s *Server) handleSetTarpit(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := readJSON(r, &req); err != nil || req.Enabled == nil {
+		writeError(w, http.StatusBadRequest, `expected {"enabled": true|false}`)
+		return
+	}
+	enabled, _ := s.sensor.Governor.Tarpit()
+	s.sensor.Governor.SetTarpit(*req.Enabled)
+	if enabled != *req.Enabled {
+		s.audit(r, "tarpit", enabled, *req.Enabled)
+	}
+	writeJSON(w, http.StatusOK, s.tarpit())
+}
+
+func (s *Server) handleDenylist(w http.ResponseWriter, r *http.Request) {
+	deny, tarpit := s.sensor.Governor.Fleet()
+	writeJSON(w, http.StatusOK, map[string][]string{
+		"entries":      s.sensor.Governor.Denylist(),
+		"fleet":        deny,
+		"fleet_tarpit": tarpit,
+	})
+}
+
+func (s *Server) handleDeny(w http.ResponseWriter, r *http.Request) {
+	var req DenylistEntry
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	before := s.sensor.Governor.Denylist()
+	prefix, err := s.sensor.Governor.Deny(req.Entry)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if after := s.sensor.Governor.Denylist(); !slices.Equal(before, after) {
+		s.audit(r, "denylist", before, after)
+	}
+	writeJSON(w, http.StatusCreated, DenylistEntry{Entry: prefix.String()})
+}
+
+func (s *Server) handleUndeny(w http.ResponseWriter, r *http.Request) {
+	before := s.sensor.Governor.Denylist()
+	ok, err := s.sensor.Governor.Undeny(r.PathValue("entry"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "entry is not in the denylist")
+		return
+	}
+	s.audit(r, "denylist", before, s.sensor.Governor.Denylist())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleRotateLogs(w http.ResponseWriter, r *http.Request) {
+	if s.sensor.RotateLogs == nil {
+		writeError(w, http.StatusNotFound, "log rotation is not available")
+		return
+	}
+	rotated, err := s.sensor.RotateLogs()
+	if rotated == nil {
+		rotated = []string{}
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("log rotation through the admin API failed")
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": err.Error(), "rotated": rotated})
+		return
+	}
+	log.Info().Str("client", clientName(r)).Strs("rotated", rotated).Msg("logs rotated through the admin API")
+	writeJSON(w, http.StatusOK, map[string][]string{"rotated": rotated})
+}
+
+func (s *Server) handleReloadGeoIP(w http.ResponseWriter, r *http.Request) {
+	if s.sensor.ReloadGeoIP == nil {
+		writeError(w, http.StatusNotFound, "no GeoIP or ASN database is configured")
+		return
+	}
+	if err := s.sensor.ReloadGeoIP(); err != nil {
+		log.Error().Err(err).Msg("GeoIP reload through the admin API failed")
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Info().Str("client", clientName(r)).Msg("GeoIP databases reloaded through the admin API")
+	writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+}
+
+// readJSON decodes the JSON body of a request into v
+func readJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// writeError writes an error message as the JSON response body
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debug().Err(err).Msg("admin API response write error")
+	}
+}
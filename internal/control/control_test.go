@@ -0,0 +1,252 @@
+package control
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/sshserver"
+	"github.com/abehterev/fakessh/internal/stats"
+)
+
+func testSensor(t *testing.T) Sensor {
+	t.Helper()
+	governor, err := sshserver.NewGovernor(config.AccessConfig{Denylist: []string{"192.0.2.1"}, TarpitDelay: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Sensor{
+		Version:   "v1.0.0",
+		ID:        "sensor-1",
+		Listening: func() error { return nil },
+		Stats:     func() stats.Snapshot { return stats.Snapshot{AttemptsTotal: 42} },
+		Settings:  func() map[string]interface{} { return map[string]interface{}{"port": 2222} },
+		Governor:  governor,
+	}
+}
+
+// call sends a request with the token and decodes the JSON response into v
+func call(t *testing.T, client *http.Client, method, url, token, body string, v interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if v != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("%s %s: invalid response %q: %v", method, url, data, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAuthentication(t *testing.T) {
+	s, err := New(Config{Tokens: []string{"secret"}}, testSensor(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	for _, token := range []string{"", "wrong"} {
+		if code := call(t, ts.Client(), "GET", ts.URL+StatusPath, token, "", nil); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for token %q, got %d", token, code)
+		}
+	}
+	var status Status
+	if code := call(t, ts.Client(), "GET", ts.URL+StatusPath, "secret", "", &status); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	expected := Status{
+		Version:   "v1.0.0",
+		SensorID:  "sensor-1",
+		Listening: true,
+		Tarpit:    TarpitState{Enabled: false, Delay: 60},
+		Denylist:  1,
+		Stats:     &stats.Snapshot{AttemptsTotal: 42, Started: status.Stats.Started},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	var settings map[string]interface{}
+	if code := call(t, ts.Client(), "GET", ts.URL+ConfigPath, "secret", "", &settings); code != http.StatusOK || settings["port"] != 2222.0 {
+		t.Errorf("Unexpected config: %d %v", code, settings)
+	}
+}
+
+func TestRuntimeChanges(t *testing.T) {
+	sensor := testSensor(t)
+	rotated := false
+	sensor.RotateLogs = func() ([]string, error) {
+		rotated = true
+		return []string{"fakessh.log.20240101-000000"}, nil
+	}
+	s, _ := New(Config{Tokens: []string{"secret"}}, sensor)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c := ts.Client()
+
+	var tarpit TarpitState
+	if code := call(t, c, "PUT", ts.URL+TarpitPath, "secret", `{"enabled":true}`, &tarpit); code != http.StatusOK || !tarpit.Enabled {
+		t.Errorf("Unexpected tarpit response: %d %+v", code, tarpit)
+	}
+	if enabled, _ := sensor.Governor.Tarpit(); !enabled {
+		t.Errorf("Expected the tarpit to be enabled")
+	}
+	if code := call(t, c, "PUT", ts.URL+TarpitPath, "secret", `{}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without enabled, got %d", code)
+	}
+
+	var entry DenylistEntry
+	if code := call(t, c, "POST", ts.URL+DenylistPath, "secret", `{"entry":"198.51.100.7/24"}`, &entry); code != http.StatusCreated || entry.Entry != "198.51.100.0/24" {
+		t.Errorf("Unexpected denylist response: %d %+v", code, entry)
+	}
+	if code := call(t, c, "POST", ts.URL+DenylistPath, "secret", `{"entry":"nope"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid entry, got %d", code)
+	}
+	if code := call(t, c, "DELETE", ts.URL+DenylistPath+"/192.0.2.1", "secret", "", nil); code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", code)
+	}
+	if code := call(t, c, "DELETE", ts.URL+DenylistPath+"/192.0.2.1", "secret", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a removed entry, got %d", code)
+	}
+	var list map[string][]string
+	call(t, c, "GET", ts.URL+DenylistPath, "secret", "", &list)
+	if !reflect.DeepEqual(list["entries"], []string{"198.51.100.0/24"}) {
+		t.Errorf("Unexpected denylist: %v", list)
+	}
+	if err := sensor.Governor.SetFleet([]string{"192.0.2.9"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	call(t, c, "GET", ts.URL+DenylistPath, "secret", "", &list)
+	if !reflect.DeepEqual(list["fleet"], []string{"192.0.2.9/32"}) || !reflect.DeepEqual(list["entries"], []string{"198.51.100.0/24"}) {
+		t.Errorf("Unexpected denylist with fleet lists: %v", list)
+	}
+
+	var result map[string][]string
+	if code := call(t, c, "POST", ts.URL+RotateLogsPath, "secret", "", &result); code != http.StatusOK || !rotated || len(result["rotated"]) != 1 {
+		t.Errorf("Unexpected rotation response: %d %v", code, result)
+	}
+	// Without GeoIP databases there is nothing to reload
+	if code := call(t, c, "POST", ts.URL+ReloadGeoIPPath, "secret", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 without databases, got %d", code)
+	}
+	s.sensor.ReloadGeoIP = func() error { return errors.New("database missing") }
+	if code := call(t, c, "POST", ts.URL+ReloadGeoIPPath, "secret", "", nil); code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 for a failed reload, got %d", code)
+	}
+}
+
+// writePEM writes a PEM block to a file in dir
+func writePEM(t *testing.T, dir, name, kind string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issue creates a certificate for 127.0.0.1 signed by parent, self-signed
+// if parent is nil
+func issue(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key, der
+}
+
+func TestClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caDER := issue(t, "test CA", nil, nil)
+	_, serverKey, serverDER := issue(t, "api", ca, caKey)
+	_, clientKey, clientDER := issue(t, "operator", ca, caKey)
+	serverKeyDER, _ := x509.MarshalECPrivateKey(serverKey)
+	clientKeyDER, _ := x509.MarshalECPrivateKey(clientKey)
+
+	s, err := New(Config{
+		Listen:       "127.0.0.1:0",
+		CertFile:     writePEM(t, dir, "api.pem", "CERTIFICATE", serverDER),
+		KeyFile:      writePEM(t, dir, "api.key", "EC PRIVATE KEY", serverKeyDER),
+		ClientCAFile: writePEM(t, dir, "ca.pem", "CERTIFICATE", caDER),
+	}, testSensor(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(s)
+	ts.TLS = s.srv.TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if code := call(t, anonymous, "GET", ts.URL+StatusPath, "", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a certificate, got %d", code)
+	}
+
+	clientCert, err := tls.X509KeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: clientKeyDER}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	operator := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}}}}
+	if code := call(t, operator, "GET", ts.URL+StatusPath, "", "", nil); code != http.StatusOK {
+		t.Errorf("Expected 200 with a client certificate, got %d", code)
+	}
+
+	if _, err := New(Config{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: filepath.Join(dir, "api.key")}, testSensor(t)); err == nil {
+		t.Errorf("Expected an error for a missing certificate")
+	}
+}
@@ -0,0 +1,282 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package control
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/sshserver"
+	"github.com/rs/zerolog/log"
+)
+
+// RuntimePath is the endpoint of the settings that can be changed without
+// restarting the listener
+const RuntimePath = "/v1/runtime"
+
+// maxBannerLength keeps the version string within the 255 characters
+// allowed by RFC 4253
+const maxBannerLength = 200
+
+// Runtime contains the settings that can be changed at runtime
+type Runtime struct {
+	// Bounds of the random delay before an attempt is rejected
+	Delay DelayProfile `json:"delay"`
+	// Version banner shown to new connections
+	Banner string `json:"banner,omitempty"`
+	// Attempts threshold of alerts, absent if alerting is disabled
+	Alerts *AlertThreshold `json:"alerts,omitempty"`
+	// Denied and allowed addresses and CIDR ranges
+	Denylist  []string `json:"denylist"`
+	Allowlist []string `json:"allowlist"`
+	// Minimum level of operational messages
+	LogLevel string `json:"log_level,omitempty"`
+}
+
+// DelayProfile contains the bounds of the random delay, as durations like "500ms"
+type DelayProfile struct {
+	Min string `json:"min"`
+	Max string `json:"max"`
+}
+
+// AlertThreshold contains the attempts of a source within the window that
+// raise an alert, 0 disables the alert
+type AlertThreshold struct {
+	Attempts int    `json:"attempts"`
+	Window   string `json:"window,omitempty"`
+}
+
+// RuntimeChange contains the settings to change, absent settings are kept
+type RuntimeChange struct {
+	Delay     *DelayProfile   `json:"delay,omitempty"`
+	Banner    *string         `json:"banner,omitempty"`
+	Alerts    *AlertThreshold `json:"alerts,omitempty"`
+	Denylist  []string        `json:"denylist,omitempty"`
+	Allowlist []string        `json:"allowlist,omitempty"`
+	LogLevel  *string         `json:"log_level,omitempty"`
+}
+
+// runtime returns the current runtime settings
+func (s *Server) runtime() Runtime {
+	min, max := s.sensor.Governor.Delay()
+	rt := Runtime{
+		Delay:     DelayProfile{Min: min.String(), Max: max.String()},
+		Denylist:  s.sensor.Governor.Denylist(),
+		Allowlist: s.sensor.Governor.Allowlist(),
+	}
+	if s.sensor.Banner != nil {
+		rt.Banner = s.sensor.Banner()
+	}
+	if s.sensor.Threshold != nil {
+		attempts, window := s.sensor.Threshold.Threshold()
+		rt.Alerts = &AlertThreshold{Attempts: attempts, Window: window.String()}
+	}
+	if s.sensor.LogLevel != nil {
+		rt.LogLevel = s.sensor.LogLevel()
+	}
+	return rt
+}
+
+func (s *Server) handleRuntime(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.runtime())
+}
+
+// handleChangeRuntime applies a change of the runtime settings. The change
+// is checked as a whole first, so that an invalid setting changes nothing.
+func (s *Server) handleChangeRuntime(w http.ResponseWriter, r *http.Request) {
+	var change RuntimeChange
+	if err := readJSON(r, &change); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	apply, err := s.prepare(change)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	before := s.runtime()
+	if err := apply(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	after := s.runtime()
+
+	if before.Delay != after.Delay {
+		s.audit(r, "delay", before.Delay, after.Delay)
+	}
+	if before.Banner != after.Banner {
+		s.audit(r, "banner", before.Banner, after.Banner)
+	}
+	if before.Alerts != nil && *before.Alerts != *after.Alerts {
+		s.audit(r, "alerts", *before.Alerts, *after.Alerts)
+	}
+	if !slices.Equal(before.Denylist, after.Denylist) {
+		s.audit(r, "denylist", before.Denylist, after.Denylist)
+	}
+	if !slices.Equal(before.Allowlist, after.Allowlist) {
+		s.audit(r, "allowlist", before.Allowlist, after.Allowlist)
+	}
+	if before.LogLevel != after.LogLevel {
+		s.audit(r, "log_level", before.LogLevel, after.LogLevel)
+	}
+	writeJSON(w, http.StatusOK, after)
+}
+
+// prepare checks a change and returns the function applying it. Only the
+// log level is checked while it is applied, before anything else changes.
+func (s *Server) prepare(change RuntimeChange) (func() error, error) {
+	var steps []func()
+
+	if d := change.Delay; d != nil {
+		min, err := time.ParseDuration(d.Min)
+		if err != nil {
+			return nil, fmt.Errorf("invalid minimum delay: %w", err)
+		}
+		max, err := time.ParseDuration(d.Max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maximum delay: %w", err)
+		}
+		if min < 0 || max < min {
+			return nil, fmt.Errorf("invalid delay range %s-%s", min, max)
+		}
+		steps = append(steps, func() { s.sensor.Governor.SetDelay(min, max) })
+	}
+
+	if change.Banner != nil {
+		if s.sensor.SetBanner == nil {
+			return nil, fmt.Errorf("the banner can not be changed")
+		}
+		banner := *change.Banner
+		if err := validateBanner(banner); err != nil {
+			return nil, err
+		}
+		steps = append(steps, func() { s.sensor.SetBanner(banner) })
+	}
+
+	if a := change.Alerts; a != nil {
+		if s.sensor.Threshold == nil {
+			return nil, fmt.Errorf("alerting is not configured")
+		}
+		_, window := s.sensor.Threshold.Threshold()
+		if a.Window != "" {
+			var err error
+			if window, err = time.ParseDuration(a.Window); err != nil {
+				return nil, fmt.Errorf("invalid alert threshold window: %w", err)
+			}
+		}
+		if a.Attempts < 0 {
+			return nil, fmt.Errorf("alert threshold cannot be negative")
+		}
+		if a.Attempts > 0 && window <= 0 {
+			return nil, fmt.Errorf("alert threshold requires a positive window")
+		}
+		attempts := a.Attempts
+		steps = append(steps, func() { s.sensor.Threshold.SetThreshold(attempts, window) })
+	}
+
+	if change.Denylist != nil {
+		if err := validateEntries(change.Denylist); err != nil {
+			return nil, fmt.Errorf("invalid denylist entry: %w", err)
+		}
+		steps = append(steps, func() { s.sensor.Governor.SetDenylist(change.Denylist) })
+	}
+	if change.Allowlist != nil {
+		if err := validateEntries(change.Allowlist); err != nil {
+			return nil, fmt.Errorf("invalid allowlist entry: %w", err)
+		}
+		steps = append(steps, func() { s.sensor.Governor.SetAllowlist(change.Allowlist) })
+	}
+
+	if change.LogLevel != nil && s.sensor.SetLogLevel == nil {
+		return nil, fmt.Errorf("the log level can not be changed")
+	}
+
+	return func() error {
+		if change.LogLevel != nil {
+			if err := s.sensor.SetLogLevel(*change.LogLevel); err != nil {
+				return err
+			}
+		}
+		for _, step := range steps {
+			step()
+		}
+		return nil
+	}, nil
+}
+
+// validateBanner checks that a banner fits in an SSH version string
+func validateBanner(banner string) error {
+	if banner == "" || len(banner) > maxBannerLength {
+		return fmt.Errorf("banner must have 1 to %d characters", maxBannerLength)
+	}
+	for _, c := range banner {
+		if c < 0x20 || c > 0x7e {
+			return fmt.Errorf("banner must consist of printable ASCII characters")
+		}
+	}
+	return nil
+}
+
+// validateEntries checks addresses and CIDR ranges
+func validateEntries(entries []string) error {
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			return fmt.Errorf("empty entry")
+		}
+		if _, err := sshserver.ParsePrefix(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// audit records a change of a setting in the operational log and, as a
+// config_change event, in the event log
+func (s *Server) audit(r *http.Request, setting string, previous, value interface{}) {
+	client := clientName(r)
+	log.Info().
+		Str("client", client).
+		Str("setting", setting).
+		Interface("previous", previous).
+		Interface("value", value).
+		Msg("setting changed through the admin API")
+
+	if s.sensor.Audit == nil {
+		return
+	}
+	event := &logger.Event{
+		Time:    time.Now(),
+		Type:    "config_change",
+		Message: "setting changed through the admin API",
+		Fields: []logger.Field{
+			{Key: "setting", Value: setting},
+			{Key: "previous", Value: previous},
+			{Key: "value", Value: value},
+			{Key: "client", Value: client},
+		},
+	}
+	if err := s.sensor.Audit(event); err != nil {
+		log.Error().Err(err).Str("setting", setting).Msg("audit event logging error")
+	}
+}
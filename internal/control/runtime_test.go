@@ -0,0 +1,122 @@
+package control
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/alert"
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestRuntimeSettings(t *testing.T) {
+	sensor := testSensor(t)
+	banner, level := "Ubuntu-4ubuntu0.5", "info"
+	sensor.Banner = func() string { return banner }
+	sensor.SetBanner = func(b string) { banner = b }
+	sensor.LogLevel = func() string { return level }
+	sensor.SetLogLevel = func(l string) error {
+		if l != "debug" && l != "info" {
+			return http.ErrNotSupported
+		}
+		level = l
+		return nil
+	}
+	sensor.Threshold = alert.NewThresholdTrigger(0, time.Hour)
+	var audit []*logger.Event
+	sensor.Audit = func(event *logger.Event) error {
+		audit = append(audit, event)
+		return nil
+	}
+
+	s, err := New(Config{Tokens: []string{"secret"}}, sensor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c := ts.Client()
+
+	var rt Runtime
+	if code := call(t, c, "GET", ts.URL+RuntimePath, "secret", "", &rt); code != http.StatusOK {
+		t.Fatalf("GET runtime: %d", code)
+	}
+	expected := Runtime{
+		Delay:     DelayProfile{Min: "200ms", Max: "500ms"},
+		Banner:    "Ubuntu-4ubuntu0.5",
+		Alerts:    &AlertThreshold{Attempts: 0, Window: "1h0m0s"},
+		Denylist:  []string{"192.0.2.1/32"},
+		Allowlist: []string{},
+		LogLevel:  "info",
+	}
+	if !reflect.DeepEqual(rt, expected) {
+		t.Errorf("GET runtime = %+v, expected %+v", rt, expected)
+	}
+
+	change := `{"delay": {"min": "1s", "max": "3s"}, "banner": "Debian-5", "alerts": {"attempts": 50},
+		"denylist": [], "allowlist": ["10.0.0.0/8"], "log_level": "debug"}`
+	if code := call(t, c, "PATCH", ts.URL+RuntimePath, "secret", change, &rt); code != http.StatusOK {
+		t.Fatalf("PATCH runtime: %d", code)
+	}
+	expected = Runtime{
+		Delay:     DelayProfile{Min: "1s", Max: "3s"},
+		Banner:    "Debian-5",
+		Alerts:    &AlertThreshold{Attempts: 50, Window: "1h0m0s"},
+		Denylist:  []string{},
+		Allowlist: []string{"10.0.0.0/8"},
+		LogLevel:  "debug",
+	}
+	if !reflect.DeepEqual(rt, expected) {
+		t.Errorf("PATCH runtime = %+v, expected %+v", rt, expected)
+	}
+	if attempts, window := sensor.Threshold.Threshold(); attempts != 50 || window != time.Hour {
+		t.Errorf("Threshold() = %d, %s", attempts, window)
+	}
+
+	var settings []string
+	for _, event := range audit {
+		if event.Type != "config_change" || event.GetString("client") != "token" {
+			t.Errorf("Unexpected audit event %+v", event)
+		}
+		settings = append(settings, event.GetString("setting"))
+	}
+	if want := []string{"delay", "banner", "alerts", "denylist", "allowlist", "log_level"}; !reflect.DeepEqual(settings, want) {
+		t.Errorf("Audited settings %v, expected %v", settings, want)
+	}
+
+	// An invalid setting rejects the whole change
+	audit = nil
+	for _, body := range []string{
+		`{"banner": "Debian-6", "delay": {"min": "2s", "max": "1s"}}`,
+		`{"banner": "Debian-6", "denylist": ["not-an-address"]}`,
+		`{"banner": "bad\nbanner"}`,
+		`{"banner": "Debian-6", "alerts": {"attempts": -1}}`,
+		`{"banner": "Debian-6", "log_level": "trace"}`,
+		`{"unknown": true}`,
+	} {
+		if code := call(t, c, "PATCH", ts.URL+RuntimePath, "secret", body, nil); code != http.StatusBadRequest {
+			t.Errorf("PATCH %s: expected 400, got %d", body, code)
+		}
+	}
+	if banner != "Debian-5" || len(audit) != 0 {
+		t.Errorf("Rejected changes should not be applied, banner %q, %d audit events", banner, len(audit))
+	}
+
+	// Unchanged settings are not audited
+	if code := call(t, c, "PATCH", ts.URL+RuntimePath, "secret", `{"banner": "Debian-5"}`, nil); code != http.StatusOK {
+		t.Errorf("PATCH runtime: %d", code)
+	}
+	if len(audit) != 0 {
+		t.Errorf("Expected no audit events, got %d", len(audit))
+	}
+
+	sensor.Threshold = nil
+	s, _ = New(Config{Tokens: []string{"secret"}}, sensor)
+	ts2 := httptest.NewServer(s)
+	defer ts2.Close()
+	if code := call(t, ts2.Client(), "PATCH", ts2.URL+RuntimePath, "secret", `{"alerts": {"attempts": 5}}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without alerting, got %d", code)
+	}
+}
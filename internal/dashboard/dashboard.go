@@ -0,0 +1,396 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+// Package dashboard serves a single-page web dashboard of the recent
+// activity: a live feed, attempts over time, a world map of the sources,
+// and the top credentials, attackers and countries
+package dashboard
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/rs/zerolog/log"
+)
+
+//go:embed static
+var static embed.FS
+
+// Defaults of the settings
+const (
+	defaultWindow = 24 * time.Hour
+	defaultTop    = 10
+	defaultRecent = 50
+	// Bars of the timeline chart
+	timelineBars = 96
+	// Values counted per bucket, further values are not counted
+	maxBucketValues = 10000
+)
+
+// Config contains settings of the dashboard
+type Config struct {
+	// Period covered by the dashboard
+	Window time.Duration
+	// Entries of the top lists
+	Top int
+	// Events shown in the live feed
+	Recent int
+}
+
+// Dashboard aggregates the logged events of the window. It is a
+// logger.Processor, to be added after the privacy processors.
+type Dashboard struct {
+	config Config
+	step   time.Duration
+	files  http.Handler
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets []*bucket
+	recent  []json.RawMessage
+	next    int
+	buf     bytes.Buffer
+	export  report.Exporter
+}
+
+// bucket holds the counts of a step of the timeline
+type bucket struct {
+	start       time.Time
+	attempts    int
+	credentials map[credential]int
+	sources     map[string]*source
+	countries   map[string]int
+	points      map[point]int
+}
+
+type credential struct {
+	username string
+	password string
+}
+
+type source struct {
+	country  string
+	attempts int
+	last     time.Time
+}
+
+type point struct {
+	latitude  float64
+	longitude float64
+}
+
+// New creates a dashboard without events
+func New(config Config) *Dashboard {
+	if config.Window <= 0 {
+		config.Window = defaultWindow
+	}
+	if config.Top <= 0 {
+		config.Top = defaultTop
+	}
+	if config.Recent <= 0 {
+		config.Recent = defaultRecent
+	}
+	files, _ := fs.Sub(static, "static")
+	d := &Dashboard{
+		config: config,
+		step:   config.Window / timelineBars,
+		files:  http.FileServerFS(files),
+		now:    time.Now,
+	}
+	d.export, _ = report.NewExporter(report.ExportJSON, &d.buf, nil)
+	return d
+}
+
+// Process counts an event of the window, and keeps it for the live feed
+func (d *Dashboard) Process(event *logger.Event) {
+	if event.Type == "heartbeat" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.buf.Reset()
+	if err := d.export.Write(event); err == nil {
+		raw := append(json.RawMessage(nil), bytes.TrimSpace(d.buf.Bytes())...)
+		if len(d.recent) < d.config.Recent {
+			d.recent = append(d.recent, raw)
+		} else {
+			d.recent[d.next] = raw
+		}
+		d.next = (d.next + 1) % d.config.Recent
+	}
+	if event.Type != "auth_attempt" {
+		return
+	}
+
+	now := d.now()
+	b := d.bucket(now)
+	n := 1
+	if v, ok := event.Get("count"); ok {
+		if c, ok := v.(int); ok && c > 0 {
+			n = c
+		}
+	}
+	b.attempts += n
+
+	c := credential{event.GetString("username"), event.GetString("password")}
+	if _, ok := b.credentials[c]; ok || len(b.credentials) < maxBucketValues {
+		b.credentials[c] += n
+	}
+	ip := event.GetString("remote_addr")
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	country := event.GetString("country")
+	if s, ok := b.sources[ip]; ok {
+		s.attempts += n
+		s.last = now
+	} else if len(b.sources) < maxBucketValues {
+		b.sources[ip] = &source{country: country, attempts: n, last: now}
+	}
+	if country != "" {
+		b.countries[country] += n
+	}
+	if lat, ok := coordinate(event, "latitude"); ok {
+		if lon, ok := coordinate(event, "longitude"); ok {
+			p := point{math.Round(lat), math.Round(lon)}
+			if _, ok := b.points[p]; ok || len(b.points) < maxBucketValues {
+				b.points[p] += n
+			}
+		}
+	}
+}
+
+// bucket returns the bucket of the current step, dropping the buckets that
+// left the window. The caller holds the lock.
+func (d *Dashboard) bucket(now time.Time) *bucket {
+	d.expire(now)
+	start := now.Truncate(d.step)
+	if len(d.buckets) == 0 || d.buckets[len(d.buckets)-1].start.Before(start) {
+		d.buckets = append(d.buckets, &bucket{
+			start:       start,
+			credentials: make(map[credential]int),
+			sources:     make(map[string]*source),
+			countries:   make(map[string]int),
+			points:      make(map[point]int),
+		})
+	}
+	return d.buckets[len(d.buckets)-1]
+}
+
+// expire drops the buckets before the first bar of the timeline. The caller
+// holds the lock.
+func (d *Dashboard) expire(now time.Time) {
+	start := d.start(now)
+	i := 0
+	for i < len(d.buckets) && d.buckets[i].start.Before(start) {
+		i++
+	}
+	d.buckets = d.buckets[i:]
+}
+
+// start returns the start of the first bar of the timeline
+func (d *Dashboard) start(now time.Time) time.Time {
+	return now.Truncate(d.step).Add(d.step - timelineBars*d.step)
+}
+
+// coordinate returns a numeric field
+func coordinate(event *logger.Event, key string) (float64, bool) {
+	switch v, _ := event.Get(key); v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// Snapshot is the state of the dashboard
+type Snapshot struct {
+	Generated   time.Time         `json:"generated"`
+	Window      float64           `json:"window_seconds"`
+	Attempts    int               `json:"attempts"`
+	Sources     int               `json:"sources"`
+	Timeline    Timeline          `json:"timeline"`
+	Credentials []Credential      `json:"credentials"`
+	Attackers   []Attacker        `json:"attackers"`
+	Countries   []report.Count    `json:"countries"`
+	Points      []Point           `json:"points"`
+	Recent      []json.RawMessage `json:"recent"`
+}
+
+// Timeline is the number of attempts per step of the window, oldest first
+type Timeline struct {
+	Start  time.Time `json:"start"`
+	Step   float64   `json:"step_seconds"`
+	Counts []int     `json:"counts"`
+}
+
+// Credential is a username and password pair with its attempts
+type Credential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Count    int    `json:"count"`
+}
+
+// Attacker is a source address with its attempts
+type Attacker struct {
+	IP       string    `json:"ip"`
+	Country  string    `json:"country,omitempty"`
+	Attempts int       `json:"attempts"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Point is a location, rounded to a degree, with its attempts
+type Point struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+	Count     int     `json:"count"`
+}
+
+// Snapshot returns the counts of the window and the recent events, newest first
+func (d *Dashboard) Snapshot() Snapshot {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.expire(now)
+	s := Snapshot{
+		Generated: now.UTC(),
+		Window:    d.config.Window.Seconds(),
+		Timeline: Timeline{
+			Start:  d.start(now).UTC(),
+			Step:   d.step.Seconds(),
+			Counts: make([]int, timelineBars),
+		},
+		Credentials: []Credential{},
+		Attackers:   []Attacker{},
+		Countries:   []report.Count{},
+		Points:      []Point{},
+		Recent:      make([]json.RawMessage, 0, len(d.recent)),
+	}
+
+	credentials := make(map[credential]int)
+	sources := make(map[string]*source)
+	countries := make(map[string]int)
+	points := make(map[point]int)
+	for _, b := range d.buckets {
+		s.Attempts += b.attempts
+		if i := int(b.start.Sub(s.Timeline.Start) / d.step); i >= 0 && i < timelineBars {
+			s.Timeline.Counts[i] += b.attempts
+		}
+		for c, n := range b.credentials {
+			credentials[c] += n
+		}
+		for ip, src := range b.sources {
+			if total, ok := sources[ip]; ok {
+				total.attempts += src.attempts
+				total.last = src.last
+			} else {
+				copied := *src
+				sources[ip] = &copied
+			}
+		}
+		for c, n := range b.countries {
+			countries[c] += n
+		}
+		for p, n := range b.points {
+			points[p] += n
+		}
+	}
+	s.Sources = len(sources)
+
+	for c, n := range credentials {
+		s.Credentials = append(s.Credentials, Credential{Username: c.username, Password: c.password, Count: n})
+	}
+	sort.Slice(s.Credentials, func(i, j int) bool {
+		a, b := s.Credentials[i], s.Credentials[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Username != b.Username {
+			return a.Username < b.Username
+		}
+		return a.Password < b.Password
+	})
+	if len(s.Credentials) > d.config.Top {
+		s.Credentials = s.Credentials[:d.config.Top]
+	}
+
+	for ip, src := range sources {
+		s.Attackers = append(s.Attackers, Attacker{IP: ip, Country: src.country, Attempts: src.attempts, LastSeen: src.last.UTC()})
+	}
+	sort.Slice(s.Attackers, func(i, j int) bool {
+		if s.Attackers[i].Attempts != s.Attackers[j].Attempts {
+			return s.Attackers[i].Attempts > s.Attackers[j].Attempts
+		}
+		return s.Attackers[i].IP < s.Attackers[j].IP
+	})
+	if len(s.Attackers) > d.config.Top {
+		s.Attackers = s.Attackers[:d.config.Top]
+	}
+
+	for c, n := range countries {
+		s.Countries = append(s.Countries, report.Count{Value: c, Count: n})
+	}
+	sort.Slice(s.Countries, func(i, j int) bool {
+		if s.Countries[i].Count != s.Countries[j].Count {
+			return s.Countries[i].Count > s.Countries[j].Count
+		}
+		return s.Countries[i].Value < s.Countries[j].Value
+	})
+	if len(s.Countries) > d.config.Top {
+		s.Countries = s.Countries[:d.config.Top]
+	}
+
+	for p, n := range points {
+		s.Points = append(s.Points, Point{Latitude: p.latitude, Longitude: p.longitude, Count: n})
+	}
+	sort.Slice(s.Points, func(i, j int) bool { return s.Points[i].Count > s.Points[j].Count })
+
+	for i := 0; i < len(d.recent); i++ {
+		// Newest first, from the last written entry backwards
+		s.Recent = append(s.Recent, d.recent[(d.next-1-i+2*len(d.recent))%len(d.recent)])
+	}
+	return s
+}
+
+// ServeHTTP returns the snapshot, which the page loads from data.json next
+// to it
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(d.Snapshot()); err != nil {
+		log.Debug().Err(err).Msg("dashboard response write error")
+	}
+}
+
+// Page serves the files of the page, to be mounted with http.StripPrefix
+func (d *Dashboard) Page() http.Handler {
+	return d.files
+}
@@ -0,0 +1,116 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func attempt(id, addr, username string) *logger.Event {
+	event := logger.NewAuthEvent(logger.CredentialAttempt{
+		Timestamp:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		RemoteAddr: addr + ":4000",
+		Username:   username,
+		Password:   "123456",
+	})
+	event.ID = id
+	return event
+}
+
+func TestSnapshot(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := New(Config{Window: time.Hour, Top: 2, Recent: 3})
+	d.now = func() time.Time { return now }
+
+	old := attempt("e1", "192.0.2.9", "guest")
+	d.Process(old)
+	now = now.Add(2 * time.Hour)
+
+	a := attempt("e2", "192.0.2.1", "root")
+	a.Set("country", "NL")
+	a.Set("latitude", 52.37)
+	a.Set("longitude", 4.89)
+	d.Process(a)
+	b := attempt("e3", "192.0.2.1", "root")
+	b.Set("country", "NL")
+	b.Set("count", 3)
+	d.Process(b)
+	d.Process(attempt("e4", "192.0.2.2", "admin"))
+	d.Process(attempt("e5", "192.0.2.3", "user"))
+	d.Process(&logger.Event{Type: "heartbeat"})
+	d.Process(&logger.Event{Type: "session_end", ID: "e6"})
+
+	s := d.Snapshot()
+	if s.Attempts != 6 || s.Sources != 3 {
+		t.Errorf("Expected 6 attempts from 3 sources, got %d from %d", s.Attempts, s.Sources)
+	}
+	if s.Window != 3600 || s.Timeline.Step != (time.Hour/timelineBars).Seconds() || len(s.Timeline.Counts) != timelineBars {
+		t.Errorf("Unexpected timeline: %+v", s.Timeline)
+	}
+	if s.Timeline.Counts[timelineBars-1] != 6 {
+		t.Errorf("Expected the attempts in the last bar, got %v", s.Timeline.Counts)
+	}
+	if len(s.Credentials) != 2 || s.Credentials[0] != (Credential{"root", "123456", 4}) || s.Credentials[1].Username != "admin" {
+		t.Errorf("Unexpected credentials: %+v", s.Credentials)
+	}
+	if len(s.Attackers) != 2 || s.Attackers[0].IP != "192.0.2.1" || s.Attackers[0].Country != "NL" || s.Attackers[0].Attempts != 4 || !s.Attackers[0].LastSeen.Equal(now) {
+		t.Errorf("Unexpected attackers: %+v", s.Attackers)
+	}
+	if len(s.Countries) != 1 || s.Countries[0].Value != "NL" || s.Countries[0].Count != 4 {
+		t.Errorf("Unexpected countries: %+v", s.Countries)
+	}
+	if len(s.Points) != 1 || s.Points[0] != (Point{52, 5, 1}) {
+		t.Errorf("Unexpected points: %+v", s.Points)
+	}
+
+	var ids []string
+	for _, raw := range s.Recent {
+		var e struct {
+			ID string `json:"event_id"`
+		}
+		if err := json.Unmarshal(raw, &e); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.ID)
+	}
+	if strings.Join(ids, ",") != "e6,e5,e4" {
+		t.Errorf("Expected the recent events newest first, got %v", ids)
+	}
+
+	now = now.Add(time.Hour)
+	if s := d.Snapshot(); s.Attempts != 0 || len(s.Attackers) != 0 {
+		t.Errorf("Expected the window to be empty, got %+v", s)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	d := New(Config{})
+	d.Process(attempt("e1", "192.0.2.1", "root"))
+	mux := http.NewServeMux()
+	mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", d.Page()))
+	mux.Handle("GET /dashboard/data.json", d)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for path, want := range map[string]string{
+		"/dashboard/":          "<title>fakessh</title>",
+		"/dashboard/app.js":    "data.json",
+		"/dashboard/data.json": `"attempts":1`,
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), want) {
+			t.Errorf("%s: expected %q, got %d %.100q", path, want, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Polls the snapshot of the dashboard and renders it. Values of the events
+// come from the attackers, so they are only ever set as text.
+(function () {
+  "use strict";
+
+  var interval = 5000;
+  var svg = "http://www.w3.org/2000/svg";
+  var seen = {};
+  var timer;
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function el(name, attrs) {
+    var e = document.createElementNS(svg, name);
+    for (var k in attrs) {
+      e.setAttribute(k, attrs[k]);
+    }
+    return e;
+  }
+
+  function clear(e) {
+    while (e.firstChild) {
+      e.removeChild(e.firstChild);
+    }
+  }
+
+  function cell(tr, text, cls) {
+    var td = document.createElement("td");
+    td.textContent = text == null ? "" : String(text);
+    if (cls) {
+      td.className = cls;
+    }
+    tr.appendChild(td);
+  }
+
+  function time(value) {
+    var d = new Date(value);
+    return isNaN(d) ? "" : d.toLocaleTimeString();
+  }
+
+  function duration(seconds) {
+    if (seconds % 86400 === 0) {
+      return seconds / 86400 + "d";
+    }
+    if (seconds % 3600 === 0) {
+      return seconds / 3600 + "h";
+    }
+    return Math.round(seconds / 60) + "m";
+  }
+
+  function rows(id, items, fn) {
+    var tbody = $(id).tBodies[0];
+    clear(tbody);
+    (items || []).forEach(function (item) {
+      var tr = document.createElement("tr");
+      fn(tr, item);
+      tbody.appendChild(tr);
+    });
+  }
+
+  function path(ring) {
+    return ring.map(function (p, i) {
+      return (i ? "L" : "M") + p[0] + " " + -p[1];
+    }).join("") + "Z";
+  }
+
+  function drawWorld() {
+    var map = $("map");
+    window.WORLD.land.forEach(function (ring) {
+      map.appendChild(el("path", { d: path(ring) }));
+    });
+    window.WORLD.water.forEach(function (ring) {
+      map.appendChild(el("path", { d: path(ring), "class": "water" }));
+    });
+  }
+
+  function drawTimeline(timeline) {
+    var chart = $("timeline");
+    clear(chart);
+    var counts = timeline.counts || [];
+    var max = Math.max.apply(null, counts.concat([1]));
+    var width = 960 / Math.max(counts.length, 1);
+    counts.forEach(function (n, i) {
+      if (!n) {
+        return;
+      }
+      var h = Math.max(150 * n / max, 1);
+      var bar = el("rect", { x: i * width + 1, y: 160 - h, width: Math.max(width - 2, 1), height: h });
+      var title = el("title", {});
+      title.textContent = n + " attempts";
+      bar.appendChild(title);
+      chart.appendChild(bar);
+    });
+    $("timeline-start").textContent = new Date(timeline.start).toLocaleString();
+  }
+
+  function drawPoints(points) {
+    var map = $("map");
+    Array.prototype.slice.call(map.querySelectorAll("circle")).forEach(function (c) {
+      map.removeChild(c);
+    });
+    var max = Math.max.apply(null, (points || []).map(function (p) { return p.count; }).concat([1]));
+    // Smallest first, so that the large circles do not hide them
+    (points || []).slice().reverse().forEach(function (p) {
+      var c = el("circle", { cx: p.lon, cy: -p.lat, r: 1 + 5 * Math.sqrt(p.count / max) });
+      var title = el("title", {});
+      title.textContent = p.count + " attempts";
+      c.appendChild(title);
+      map.appendChild(c);
+    });
+  }
+
+  function render(s) {
+    $("attempts").textContent = s.attempts;
+    $("sources").textContent = s.sources;
+    $("window").textContent = duration(s.window_seconds);
+    drawTimeline(s.timeline);
+    drawPoints(s.points);
+
+    var fresh = {};
+    rows("feed", s.recent, function (tr, e) {
+      var key = e.event_id || e.time + e.remote_addr + e.event;
+      fresh[key] = true;
+      if (Object.keys(seen).length && !seen[key]) {
+        tr.className = "new";
+      }
+      cell(tr, time(e.time));
+      cell(tr, e.remote_addr, "v");
+      cell(tr, e.event === "auth_attempt" ? e.username + " / " + e.password : e.event, "v");
+      cell(tr, e.country);
+    });
+    seen = fresh;
+    rows("credentials", s.credentials, function (tr, c) {
+      cell(tr, c.username, "v");
+      cell(tr, c.password, "v");
+      cell(tr, c.count, "n");
+    });
+    rows("attackers", s.attackers, function (tr, a) {
+      cell(tr, a.ip, "v");
+      cell(tr, a.country);
+      cell(tr, a.attempts, "n");
+      cell(tr, time(a.last_seen));
+    });
+    rows("countries", s.countries, function (tr, c) {
+      cell(tr, c.value);
+      cell(tr, c.count, "n");
+    });
+  }
+
+  function status(text, error) {
+    $("status").textContent = text;
+    $("status").className = error ? "error" : "";
+  }
+
+  function refresh() {
+    var headers = {};
+    var token = sessionStorage.getItem("fakessh-token");
+    if (token) {
+      headers.Authorization = "Bearer " + token;
+    }
+    fetch("data.json", { headers: headers, cache: "no-store" }).then(function (r) {
+      if (r.status === 401) {
+        sessionStorage.removeItem("fakessh-token");
+        $("dashboard").hidden = true;
+        $("login").hidden = false;
+        status(token ? "invalid token" : "token required", !!token);
+        return;
+      }
+      if (!r.ok) {
+        throw new Error(r.status + " " + r.statusText);
+      }
+      return r.json().then(function (s) {
+        $("login").hidden = true;
+        $("dashboard").hidden = false;
+        render(s);
+        status("updated " + time(s.generated));
+        timer = setTimeout(refresh, interval);
+      });
+    }).catch(function (err) {
+      status(err.message, true);
+      timer = setTimeout(refresh, interval);
+    });
+  }
+
+  $("login").addEventListener("submit", function (e) {
+    e.preventDefault();
+    sessionStorage.setItem("fakessh-token", $("token").value);
+    $("token").value = "";
+    clearTimeout(timer);
+    refresh();
+  });
+
+  drawWorld();
+  refresh();
+})();
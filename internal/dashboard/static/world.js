@@ -0,0 +1,54 @@
+// Coarse outlines of the continents and large islands as [longitude,
+// latitude] rings, for the map of the sources. Inland seas are drawn over
+// the land.
+window.WORLD = {
+  land: [
+    // North America
+    [[-168,66],[-162,70],[-156,71.5],[-141,69.6],[-128,70],[-115,68.5],[-95,72],[-82,73],[-80,69],[-86,66],[-94,60],[-92,57],[-82,55],[-79,52],[-76,56],[-78,62],[-72,61],[-65,60],[-61,56],[-56,52],[-59,48],[-66,45],[-70,43],[-70,41.5],[-74,40.5],[-76,37],[-76,35],[-81,31],[-80,26],[-81,25],[-83,29],[-85,30],[-89,30],[-94,29.5],[-97,27],[-97.5,22],[-95,19],[-91,19],[-87,21.5],[-88,16],[-84,15],[-83.5,11],[-80,9],[-77.5,8.5],[-79.5,7.5],[-82,8],[-86,11],[-88,13.5],[-92,14.5],[-96,16],[-105,20],[-106,23],[-110,27],[-112.5,31],[-114.5,30],[-110,23],[-112,25],[-115,29],[-117,32.5],[-120.5,34.5],[-122.5,37.5],[-124,40.5],[-124,46],[-123,48],[-127,50.5],[-131,54],[-135,58],[-140,60],[-146,61],[-152,59],[-158,57],[-164,55],[-160,58.5],[-165,60.5],[-166,64]],
+    // Greenland and the Arctic islands of Canada
+    [[-73,78],[-60,82],[-35,83.5],[-20,82],[-18,77],[-22,72],[-22,70],[-33,68],[-40,65],[-43,60],[-48,61],[-52,65],[-54,69],[-58,75],[-67,76.5]],
+    [[-65,62],[-62,66.5],[-68,70],[-80,73.5],[-90,73],[-85,70],[-78,69],[-72,67],[-78,64.5]],
+    [[-80,76],[-62,82],[-90,81],[-95,77]],
+    [[-118,69.5],[-101,69],[-101,73.5],[-117,72.8]],
+    // Caribbean
+    [[-84.9,21.9],[-82,23.1],[-77,22],[-74.2,20.2],[-77.7,19.9],[-80,21.8]],
+    [[-74.4,19.8],[-68.4,18.6],[-71,18],[-74.4,18.4]],
+    // South America
+    [[-77.5,8.5],[-72,12],[-64,10.5],[-60,8.5],[-55,6],[-51,4],[-50,0],[-44,-2.5],[-35,-5],[-35,-9],[-39,-14],[-41,-22],[-48,-26],[-53,-34],[-57.5,-35],[-57,-38],[-62,-39],[-65,-42],[-67,-46],[-66,-48],[-69,-51],[-68.5,-54.5],[-71,-55],[-75,-52],[-74,-46],[-73.5,-40],[-71.5,-30],[-70.5,-18],[-76,-14],[-81,-6],[-80,-2],[-80,1],[-77.5,4]],
+    // Africa and Madagascar
+    [[-17,21],[-13,27.5],[-9.5,30.5],[-6,35.8],[0,35.8],[10,37],[11,33.5],[20,31],[25,31.8],[32,31.3],[34,28],[38,22],[43,13],[51,12],[51,10],[47,4],[41,-2],[39.5,-6],[40.5,-11],[40.5,-15.5],[35,-22],[32.8,-26],[31,-29.5],[27,-33.8],[20,-34.8],[18.4,-34],[17,-29],[15,-26],[11.8,-17],[13.5,-12],[12,-5],[9,-1],[9.5,3.5],[6,4.3],[1,6],[-4,5],[-7.5,4.3],[-12,7],[-15,11],[-17,14.5]],
+    [[44,-25],[47,-25],[50.5,-15.5],[49.3,-12],[44,-16.5],[43.5,-22]],
+    // Eurasia
+    [[-9.5,36.9],[-9,43],[-2,43.5],[-1.5,46],[-4.5,48.5],[-1.5,49.5],[2,51],[4.5,52.5],[8.5,53.5],[8,57],[10.5,57.5],[10.5,54.5],[14,54],[19,54.5],[21,56.5],[24,57.5],[23.5,59.5],[29.5,60],[22,60.5],[21.5,63],[25,65],[21.5,65.8],[17,61],[18.7,60],[16,56.3],[12.7,56],[11,59],[6,58],[5,62],[10,64],[15,68],[19,70],[26,71],[31,70],[41,67],[44,68.5],[54,68.5],[60,69.5],[69,73],[80,73.5],[87,75],[100,76.5],[113,73.5],[129,71],[140,72.5],[150,71],[160,69.5],[170,70],[180,69],[180,65],[176,62.5],[170,60],[163,60],[163,56],[156.5,51],[155.5,57.5],[160,61.5],[156,61.5],[149,59.5],[143,59.3],[137,54],[140.5,52],[141,48],[135,43],[130,42.5],[129.5,36],[126.5,34.5],[125,39.5],[121.5,40],[118,39],[122,37],[120,34],[122,31],[121.5,28.5],[119,25],[114,22.3],[110,21],[108,21.5],[106.5,19],[109,15],[109,11.5],[105,8.7],[103,10.5],[100.5,13.5],[100,9],[103.5,1.3],[101,3],[98,8],[98.5,12],[98,16],[94.5,16],[94,19],[92,21.5],[90,22],[87,21.5],[85,19.5],[80.5,15.5],[80,10],[77.5,8],[76,10.5],[73,17],[72.5,21],[69,22.5],[66.5,25],[61.5,25.2],[57,25.8],[56.5,27],[54,26.7],[51.5,27.9],[48.5,30],[47.5,29.5],[50,25],[51.5,24.2],[54,24],[56,24.5],[56.3,26.2],[59.8,22.5],[58.5,20.5],[55,17],[52,15.5],[45,13],[43,12.7],[42.5,16],[39,21.5],[35,28],[34.5,29.5],[34.5,31.5],[35.9,35],[36,36.5],[32,36.2],[28,36.7],[26.3,38.5],[26.5,40.3],[23,40.5],[24,38],[22,36.5],[21,38.5],[19.5,41.5],[19,42.5],[16,43.5],[13.7,45.7],[12.3,45.3],[12.5,44],[14,42],[16,41],[18.5,40.2],[16.5,38.9],[15.7,38],[16,39.5],[15.6,40],[13,41.3],[10.5,43],[8.8,44.4],[7.5,43.8],[4.5,43.4],[3,42.5],[3.2,41.9],[0.8,41],[-0.3,39.5],[0.2,38.7],[-0.7,37.6],[-2.2,36.7],[-4.5,36.7],[-5.6,36],[-6.5,36.9],[-8.9,37]],
+    [[11,78.5],[18,80.5],[27,80],[20,77]],
+    [[52,71],[57,70.5],[69,77],[58,76]],
+    // British Isles and Iceland
+    [[-5.7,50],[1.5,51.2],[1.7,52.7],[0,53.5],[-1.5,55],[-2,56],[-1.8,57.6],[-3.5,58.6],[-5,58.6],[-6.2,56.5],[-5,55],[-3,54.5],[-3.2,53.4],[-4.7,52.8],[-4,51.6]],
+    [[-6,52.2],[-6.2,54],[-7.5,55.3],[-9.9,54],[-10.3,51.9],[-8.5,51.6]],
+    [[-22.5,64],[-24,65.5],[-22,66.4],[-16,66.5],[-13.6,65.2],[-15,64.3],[-18.5,63.4]],
+    // Japan, Taiwan and the Philippines
+    [[130,31.3],[131.5,31.5],[132,33.8],[135,33.5],[136.8,34.5],[139.8,35],[140.8,36],[141,38.5],[142,40],[141.3,41.4],[140,40.5],[139.8,38],[137,37],[133,35.5],[130.9,34]],
+    [[140,41.5],[141.5,42.5],[145.5,43.3],[142,45.4],[140,43.2]],
+    [[120.2,22.5],[121,22],[122,25],[121,25.2]],
+    [[120,14.5],[121.5,14],[124,12.5],[122,18.5],[120.5,18.5]],
+    [[122,7],[126.5,6.3],[126,9.8],[123.5,8.5]],
+    // Indonesia and New Guinea
+    [[109,1.5],[110,-1.5],[114.5,-3.5],[116.5,-2],[119,1],[117.5,4.5],[119,5.5],[117,7],[115.5,5],[113,3],[111,1.8]],
+    [[95.3,5.5],[98,4],[103.7,-1],[106,-3],[105.8,-5.8],[104.5,-5.9],[101,-2.5],[98.5,1]],
+    [[105.2,-6.8],[108,-6.3],[112.5,-6.9],[114.5,-7.8],[110,-8.2],[106,-7.4]],
+    [[119.5,-5.5],[120.5,-2],[120,0.5],[124.8,1.5],[121,-1],[122,-4.5],[120.5,-5.5]],
+    [[131,-1.5],[135,-3.3],[138,-1.7],[141,-2.6],[145.5,-4.5],[147.5,-6.3],[150,-10.5],[147,-10],[144,-7.7],[141,-9],[138,-8.4],[137.5,-5],[133,-4]],
+    // Australia and New Zealand
+    [[113.5,-22],[114,-26.5],[115,-34],[118,-35],[123.5,-33.9],[126,-32.3],[131,-31.5],[135.5,-34.8],[137.5,-33],[138,-35.6],[140,-38],[144,-38.3],[146.4,-39],[150,-37.5],[153,-31],[153.5,-28],[153,-25],[150.5,-22.5],[146.5,-19],[145.3,-15],[143.5,-14],[142.5,-10.7],[141.5,-13],[141.4,-17],[139.5,-17.5],[135.8,-15],[137,-12],[132.5,-11.5],[130,-13],[128,-15],[125,-14.5],[122,-17.5],[121,-19.5],[117,-20.7]],
+    [[144.6,-40.7],[148.3,-40.9],[148,-43],[146,-43.5]],
+    [[172.7,-34.4],[175,-36.8],[178.5,-37.7],[177,-39.2],[175,-41.5],[174.6,-39.8],[173.8,-39.2],[174.5,-37]],
+    [[172.7,-40.5],[174.3,-41.7],[173,-43.8],[171,-45],[169,-46.6],[166.5,-46],[168,-44],[171,-42]],
+    // Antarctica
+    [[-180,-90],[-180,-78],[-160,-78],[-150,-76],[-120,-74],[-100,-73.5],[-75,-73],[-68,-68],[-57,-63.3],[-60,-71],[-45,-78],[-30,-77],[-20,-73],[0,-70],[30,-69.5],[60,-67],[90,-66],[120,-66.5],[150,-68.5],[165,-71],[170,-77],[180,-78],[180,-90]]
+  ],
+  water: [
+    // Black Sea and Caspian Sea
+    [[28,41.2],[28,43.5],[29.7,45.3],[30.8,46.5],[33,46],[33.5,44.5],[36.5,45.2],[38,44.4],[40,43.4],[41.6,41.6],[38,41],[35,42],[33,42],[31,41.1]],
+    [[47,45],[49,46.5],[51.5,47],[53,45.3],[51,44.5],[51,42.7],[52.7,42],[53.9,40.2],[53,39],[54,37.3],[51.5,36.8],[49,37.6],[49.5,40.3],[48.5,41.8],[47.4,43.2]]
+  ]
+};
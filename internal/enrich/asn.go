@@ -0,0 +1,77 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/rs/zerolog/log"
+)
+
+// ASNRecord is the autonomous system an IP address belongs to
+type ASNRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// ASN enriches events with the autonomous system number and organization
+// from a GeoLite2/GeoIP2 ASN database
+type ASN struct {
+	*mmdbDatabase
+}
+
+// NewASN opens an ASN database, reloading it when the file changes
+func NewASN(path string, reloadInterval time.Duration) (*ASN, error) {
+	db, err := openMMDB(path, reloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	return &ASN{mmdbDatabase: db}, nil
+}
+
+// Lookup returns the autonomous system of an address
+func (a *ASN) Lookup(ip netip.Addr) (ASNRecord, bool) {
+	var record ASNRecord
+	ok, err := a.lookup(ip, &record)
+	if err != nil {
+		log.Debug().Err(err).Str("ip", ip.String()).Msg("ASN lookup failed")
+		return record, false
+	}
+	return record, ok && record.Number != 0
+}
+
+// Process adds the asn and as_org fields to the event
+func (a *ASN) Process(event *logger.Event) {
+	ip, ok := remoteIP(event)
+	if !ok {
+		return
+	}
+	record, ok := a.Lookup(ip)
+	if !ok {
+		return
+	}
+
+	event.Set("asn", int(record.Number))
+	if record.Organization != "" {
+		event.Set("as_org", record.Organization)
+	}
+}
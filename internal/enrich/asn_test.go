@@ -0,0 +1,40 @@
+package enrich
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+func TestASNProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.mmdb")
+	writeTestDB(t, path, "GeoLite2-ASN", map[string]mmdbtype.Map{
+		"203.0.113.0/24": {
+			"autonomous_system_number":       mmdbtype.Uint32(64500),
+			"autonomous_system_organization": mmdbtype.String("Example Hosting"),
+		},
+	})
+
+	asn, err := NewASN(path, 0)
+	if err != nil {
+		t.Fatalf("Failed to open ASN database: %v", err)
+	}
+	defer asn.Close()
+
+	event := logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "203.0.113.10:40000"})
+	asn.Process(event)
+	if got, _ := event.Get("asn"); got != 64500 {
+		t.Errorf("Expected asn 64500, got %v", got)
+	}
+	if got := event.GetString("as_org"); got != "Example Hosting" {
+		t.Errorf("Expected as_org 'Example Hosting', got '%s'", got)
+	}
+
+	event = logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "192.0.2.1:40000"})
+	asn.Process(event)
+	if _, ok := event.Get("asn"); ok {
+		t.Errorf("Expected no asn field for unknown address")
+	}
+}
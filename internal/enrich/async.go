@@ -0,0 +1,115 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// resultCache stores the results of lookups
+type resultCache[K comparable, V any] interface {
+	get(key K) (V, bool)
+	add(key K, value V)
+}
+
+// asyncLookup runs slow lookups (DNS, remote APIs) in the background so
+// that they never delay logging. Results are cached; events logged while a
+// lookup is still running are written without its result.
+type asyncLookup[K comparable, V any] struct {
+	name    string
+	cache   resultCache[K, V]
+	timeout time.Duration
+	sem     chan struct{}
+	fn      func(ctx context.Context, key K) (V, error)
+
+	mu       sync.Mutex
+	inflight map[K]bool
+	wg       sync.WaitGroup
+}
+
+// newAsyncLookup creates a lookup running at most concurrency lookups at a
+// time, each limited to timeout
+func newAsyncLookup[K comparable, V any](name string, concurrency int, timeout time.Duration, cache resultCache[K, V],
+	fn func(ctx context.Context, key K) (V, error)) *asyncLookup[K, V] {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &asyncLookup[K, V]{
+		name:     name,
+		cache:    cache,
+		timeout:  timeout,
+		sem:      make(chan struct{}, concurrency),
+		fn:       fn,
+		inflight: make(map[K]bool),
+	}
+}
+
+// get returns the cached result for key, or starts a lookup and returns false
+func (a *asyncLookup[K, V]) get(key K) (V, bool) {
+	if v, ok := a.cache.get(key); ok {
+		return v, true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var zero V
+	if a.inflight[key] {
+		return zero, false
+	}
+	select {
+	case a.sem <- struct{}{}:
+	default:
+		// All workers are busy, the key is looked up on a later event
+		return zero, false
+	}
+	a.inflight[key] = true
+	a.wg.Add(1)
+	go a.run(key)
+	return zero, false
+}
+
+// run performs a single lookup and caches its result. Failed lookups are
+// cached as empty results so that they are not retried on every event.
+func (a *asyncLookup[K, V]) run(key K) {
+	defer a.wg.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	v, err := a.fn(ctx, key)
+	cancel()
+	if err != nil {
+		log.Debug().Err(err).Interface("key", key).Msgf("%s lookup failed", a.name)
+	}
+	a.cache.add(key, v)
+
+	a.mu.Lock()
+	delete(a.inflight, key)
+	a.mu.Unlock()
+	<-a.sem
+}
+
+// wait blocks until all running lookups have finished
+func (a *asyncLookup[K, V]) wait() {
+	a.wg.Wait()
+}
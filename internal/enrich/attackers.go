@@ -0,0 +1,344 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/rs/zerolog/log"
+)
+
+// maxDistinct limits the number of distinct usernames and passwords
+// remembered per address
+const maxDistinct = 1000
+
+// maxNetworks limits the number of remembered countries and ASNs each
+const maxNetworks = 100000
+
+// AttackerStats are the statistics of a single source address
+type AttackerStats struct {
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Number of authentication attempts
+	Attempts int
+	// Number of distinct usernames and passwords, counted up to 1000
+	Usernames int
+	Passwords int
+}
+
+// attackerRecord is the tracked state of an address
+type attackerRecord struct {
+	FirstSeen time.Time           `json:"first_seen"`
+	LastSeen  time.Time           `json:"last_seen"`
+	Attempts  int                 `json:"attempts"`
+	Usernames map[uint64]struct{} `json:"-"`
+	Passwords map[uint64]struct{} `json:"-"`
+}
+
+func (r *attackerRecord) stats() AttackerStats {
+	return AttackerStats{
+		FirstSeen: r.FirstSeen,
+		LastSeen:  r.LastSeen,
+		Attempts:  r.Attempts,
+		Usernames: len(r.Usernames),
+		Passwords: len(r.Passwords),
+	}
+}
+
+// AttackerTracker keeps first-seen/last-seen statistics of source
+// addresses in a small store that can be persisted to a file. The least
+// recently seen addresses are dropped when the store is full. The store
+// also remembers when each country and ASN was first seen.
+type AttackerTracker struct {
+	mu        sync.Mutex
+	records   *lruCache[netip.Addr, *attackerRecord]
+	countries map[string]time.Time
+	asns      map[string]time.Time
+	path      string
+
+	saveMu sync.Mutex
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// attackersFile is the format of the persisted store
+type attackersFile struct {
+	Attackers []attackerFileEntry  `json:"attackers"`
+	Countries map[string]time.Time `json:"countries,omitempty"`
+	ASNs      map[string]time.Time `json:"asns,omitempty"`
+}
+
+type attackerFileEntry struct {
+	IP string `json:"ip"`
+	attackerRecord
+	Usernames []uint64 `json:"usernames"`
+	Passwords []uint64 `json:"passwords"`
+}
+
+// NewAttackerTracker creates a store of up to maxEntries addresses. If path
+// is not empty, the store is loaded from it and saved to it every
+// saveInterval and when the tracker is closed.
+func NewAttackerTracker(maxEntries int, path string, saveInterval time.Duration) (*AttackerTracker, error) {
+	t := &AttackerTracker{
+		records:   newLRUCache[netip.Addr, *attackerRecord](maxEntries, 0),
+		countries: make(map[string]time.Time),
+		asns:      make(map[string]time.Time),
+		path:      path,
+		done:      make(chan struct{}),
+	}
+
+	if path != "" {
+		if err := t.load(); err != nil {
+			return nil, err
+		}
+		if saveInterval > 0 {
+			t.wg.Add(1)
+			go t.saveLoop(saveInterval)
+		}
+	}
+	return t, nil
+}
+
+// Observe records attempts of an address and returns its updated statistics
+func (t *AttackerTracker) Observe(ip netip.Addr, username, password string, attempts int, at time.Time) AttackerStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.records.get(ip)
+	if !ok {
+		r = &attackerRecord{
+			FirstSeen: at,
+			Usernames: make(map[uint64]struct{}),
+			Passwords: make(map[uint64]struct{}),
+		}
+	}
+	if at.After(r.LastSeen) {
+		r.LastSeen = at
+	}
+	r.Attempts += attempts
+	addDistinct(r.Usernames, username)
+	addDistinct(r.Passwords, password)
+	t.records.add(ip, r)
+
+	return r.stats()
+}
+
+// ObserveNetwork records a country code and an ASN, either may be empty, and
+// reports which of them were seen for the first time
+func (t *AttackerTracker) ObserveNetwork(country, asn string, at time.Time) (newCountry, newASN bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return firstSeen(t.countries, country, at), firstSeen(t.asns, asn, at)
+}
+
+// firstSeen remembers when a key was first seen and reports whether it is new
+func firstSeen(seen map[string]time.Time, key string, at time.Time) bool {
+	if key == "" {
+		return false
+	}
+	if _, ok := seen[key]; ok || len(seen) >= maxNetworks {
+		return false
+	}
+	seen[key] = at
+	return true
+}
+
+// Lookup returns the statistics of an address
+func (t *AttackerTracker) Lookup(ip netip.Addr) (AttackerStats, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.records.get(ip)
+	if !ok {
+		return AttackerStats{}, false
+	}
+	return r.stats(), true
+}
+
+// Len returns the number of tracked addresses
+func (t *AttackerTracker) Len() int {
+	return t.records.len()
+}
+
+// Process adds the new_attacker and attempt_number fields to
+// authentication attempts, and new_country and new_asn to attempts with a
+// known country or ASN
+func (t *AttackerTracker) Process(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	ip, ok := remoteIP(event)
+	if !ok {
+		return
+	}
+
+	attempts := attemptCount(event)
+	stats := t.Observe(ip, event.GetString("username"), event.GetString("password"), attempts, event.Time)
+	event.Set("new_attacker", stats.Attempts == attempts)
+	event.Set("attempt_number", stats.Attempts)
+
+	country := event.GetString("country")
+	var asn string
+	if v, ok := event.Get("asn"); ok && v != nil {
+		asn = fmt.Sprint(v)
+	}
+	newCountry, newASN := t.ObserveNetwork(country, asn, event.Time)
+	if country != "" {
+		event.Set("new_country", newCountry)
+	}
+	if asn != "" {
+		event.Set("new_asn", newASN)
+	}
+}
+
+// attemptCount returns the number of attempts an event stands for, which
+// is more than one for aggregated events
+func attemptCount(event *logger.Event) int {
+	if v, ok := event.Get("count"); ok {
+		if n, ok := v.(int); ok && n > 0 {
+			return n
+		}
+	}
+	return 1
+}
+
+// addDistinct remembers the hash of a value in a bounded set
+func addDistinct(set map[uint64]struct{}, value string) {
+	if len(set) >= maxDistinct {
+		return
+	}
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	set[h.Sum64()] = struct{}{}
+}
+
+// load reads the persisted store, a missing file is not an error
+func (t *AttackerTracker) load() error {
+	data, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read attacker store: %w", err)
+	}
+
+	var file attackersFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse attacker store %s: %w", t.path, err)
+	}
+
+	for _, e := range file.Attackers {
+		ip, err := netip.ParseAddr(e.IP)
+		if err != nil {
+			continue
+		}
+		r := e.attackerRecord
+		r.Usernames = make(map[uint64]struct{}, len(e.Usernames))
+		for _, h := range e.Usernames {
+			r.Usernames[h] = struct{}{}
+		}
+		r.Passwords = make(map[uint64]struct{}, len(e.Passwords))
+		for _, h := range e.Passwords {
+			r.Passwords[h] = struct{}{}
+		}
+		t.records.add(ip, &r)
+	}
+	for country, at := range file.Countries {
+		t.countries[country] = at
+	}
+	for asn, at := range file.ASNs {
+		t.asns[asn] = at
+	}
+	log.Debug().Int("attackers", t.records.len()).Str("file", t.path).Msg("attacker store loaded")
+	return nil
+}
+
+// Save writes the store to its file
+func (t *AttackerTracker) Save() error {
+	if t.path == "" {
+		return nil
+	}
+
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+
+	var file attackersFile
+	t.mu.Lock()
+	t.records.each(func(ip netip.Addr, r *attackerRecord, _ time.Time) {
+		e := attackerFileEntry{IP: ip.String(), attackerRecord: *r}
+		for h := range r.Usernames {
+			e.Usernames = append(e.Usernames, h)
+		}
+		for h := range r.Passwords {
+			e.Passwords = append(e.Passwords, h)
+		}
+		file.Attackers = append(file.Attackers, e)
+	})
+	file.Countries = make(map[string]time.Time, len(t.countries))
+	for country, at := range t.countries {
+		file.Countries[country] = at
+	}
+	file.ASNs = make(map[string]time.Time, len(t.asns))
+	for asn, at := range t.asns {
+		file.ASNs[asn] = at
+	}
+	t.mu.Unlock()
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := replaceFile(t.path, data, time.Now()); err != nil {
+		return fmt.Errorf("failed to save attacker store: %w", err)
+	}
+	return nil
+}
+
+func (t *AttackerTracker) saveLoop(interval time.Duration) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.Save(); err != nil {
+				log.Warn().Err(err).Msg("attacker store save failed")
+			}
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// Close stops the periodic saving and saves the store a last time
+func (t *AttackerTracker) Close() error {
+	close(t.done)
+	t.wg.Wait()
+	return t.Save()
+}
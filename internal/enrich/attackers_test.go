@@ -0,0 +1,163 @@
+package enrich
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestAttackerTrackerProcess(t *testing.T) {
+	tracker, err := NewAttackerTracker(100, "", 0)
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+	defer tracker.Close()
+
+	attempt := func(addr, username, password string) *logger.Event {
+		event := logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: addr, Username: username, Password: password})
+		tracker.Process(event)
+		return event
+	}
+
+	first := attempt("203.0.113.10:40000", "root", "123456")
+	if got, _ := first.Get("new_attacker"); got != true {
+		t.Errorf("Expected first attempt to be from a new attacker, got %v", got)
+	}
+	if got, _ := first.Get("attempt_number"); got != 1 {
+		t.Errorf("Expected attempt_number 1, got %v", got)
+	}
+
+	attempt("203.0.113.10:40001", "admin", "123456")
+	aggregated := logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "203.0.113.10:40002", Username: "admin", Password: "admin"})
+	aggregated.Set("count", 3)
+	tracker.Process(aggregated)
+	if got, _ := aggregated.Get("new_attacker"); got != false {
+		t.Errorf("Expected known attacker, got %v", got)
+	}
+	if got, _ := aggregated.Get("attempt_number"); got != 5 {
+		t.Errorf("Expected aggregated attempts to be counted, got %v", got)
+	}
+
+	stats, ok := tracker.Lookup(mustAddr("203.0.113.10"))
+	if !ok {
+		t.Fatalf("Expected statistics of tracked address")
+	}
+	if stats.Attempts != 5 || stats.Usernames != 2 || stats.Passwords != 2 {
+		t.Errorf("Unexpected statistics: %+v", stats)
+	}
+
+	other := attempt("[2001:db8::1]:22", "root", "123456")
+	if got, _ := other.Get("new_attacker"); got != true {
+		t.Errorf("Expected other address to be a new attacker, got %v", got)
+	}
+}
+
+func TestAttackerTrackerEviction(t *testing.T) {
+	tracker, err := NewAttackerTracker(2, "", 0)
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+	defer tracker.Close()
+
+	now := time.Now()
+	tracker.Observe(mustAddr("203.0.113.1"), "root", "root", 1, now)
+	tracker.Observe(mustAddr("203.0.113.2"), "root", "root", 1, now)
+	tracker.Observe(mustAddr("203.0.113.1"), "root", "root", 1, now)
+	tracker.Observe(mustAddr("203.0.113.3"), "root", "root", 1, now)
+
+	if _, ok := tracker.Lookup(mustAddr("203.0.113.2")); ok {
+		t.Errorf("Expected least recently seen address to be dropped")
+	}
+	if tracker.Len() != 2 {
+		t.Errorf("Expected 2 addresses, got %d", tracker.Len())
+	}
+}
+
+func TestAttackerTrackerPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "attackers.json")
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tracker, err := NewAttackerTracker(100, path, 0)
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+	tracker.Observe(mustAddr("203.0.113.10"), "root", "123456", 1, first)
+	tracker.Observe(mustAddr("203.0.113.10"), "admin", "123456", 1, first.Add(time.Hour))
+	if err := tracker.Close(); err != nil {
+		t.Fatalf("Failed to save tracker: %v", err)
+	}
+
+	tracker, err = NewAttackerTracker(100, path, 0)
+	if err != nil {
+		t.Fatalf("Failed to load tracker: %v", err)
+	}
+	defer tracker.Close()
+
+	stats := tracker.Observe(mustAddr("203.0.113.10"), "root", "password", 1, first.Add(2*time.Hour))
+	if !stats.FirstSeen.Equal(first) {
+		t.Errorf("Expected first seen %v, got %v", first, stats.FirstSeen)
+	}
+	if stats.Attempts != 3 || stats.Usernames != 2 || stats.Passwords != 2 {
+		t.Errorf("Unexpected statistics after reload: %+v", stats)
+	}
+}
+
+func TestAttackerTrackerNetworks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "attackers.json")
+	tracker, err := NewAttackerTracker(100, path, 0)
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+
+	attempt := func(addr, country string, asn int) *logger.Event {
+		event := logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: addr, Username: "root", Password: "root"})
+		if country != "" {
+			event.Set("country", country)
+		}
+		if asn != 0 {
+			event.Set("asn", asn)
+		}
+		tracker.Process(event)
+		return event
+	}
+
+	first := attempt("203.0.113.1:22", "CN", 4134)
+	if got, _ := first.Get("new_country"); got != true {
+		t.Errorf("Expected new country, got %v", got)
+	}
+	if got, _ := first.Get("new_asn"); got != true {
+		t.Errorf("Expected new ASN, got %v", got)
+	}
+
+	second := attempt("203.0.113.2:22", "CN", 4837)
+	if got, _ := second.Get("new_country"); got != false {
+		t.Errorf("Expected known country, got %v", got)
+	}
+	if got, _ := second.Get("new_asn"); got != true {
+		t.Errorf("Expected new ASN, got %v", got)
+	}
+
+	unknown := attempt("203.0.113.3:22", "", 0)
+	if _, ok := unknown.Get("new_country"); ok {
+		t.Errorf("Expected no new_country without a country")
+	}
+	if _, ok := unknown.Get("new_asn"); ok {
+		t.Errorf("Expected no new_asn without an ASN")
+	}
+
+	if err := tracker.Close(); err != nil {
+		t.Fatalf("Failed to save tracker: %v", err)
+	}
+	tracker, err = NewAttackerTracker(100, path, 0)
+	if err != nil {
+		t.Fatalf("Failed to load tracker: %v", err)
+	}
+	defer tracker.Close()
+
+	newCountry, newASN := tracker.ObserveNetwork("CN", "4134", time.Now())
+	if newCountry || newASN {
+		t.Errorf("Expected country and ASN to be remembered after reload")
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// BlocklistSource is a blocklist of networks, such as Spamhaus DROP, a
+// FireHOL list or a custom CIDR file
+type BlocklistSource struct {
+	// List name attached to events
+	Name string
+	// File path or http(s) URL of the list
+	Location string
+}
+
+// Blocklists tags events with the blocklists containing the source
+// address. The lists are downloaded again periodically.
+type Blocklists struct {
+	lists *networkLists
+}
+
+// NewBlocklists loads the blocklists and refreshes them at the given
+// interval. Lists that can not be loaded are skipped with a warning.
+func NewBlocklists(sources []BlocklistSource, refreshInterval time.Duration) *Blocklists {
+	lists := make([]networkList, 0, len(sources))
+	for _, src := range sources {
+		lists = append(lists, networkList{
+			name:     src.Name,
+			location: src.Location,
+			parse:    parsePrefixList,
+		})
+	}
+	return &Blocklists{lists: newNetworkLists("blocklist", lists, refreshInterval)}
+}
+
+// Refresh loads all blocklists again
+func (b *Blocklists) Refresh(ctx context.Context) {
+	b.lists.refresh(ctx)
+}
+
+// Lookup returns the names of the blocklists containing an address
+func (b *Blocklists) Lookup(ip netip.Addr) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range b.lists.lookup(ip) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Process adds the blocklists field if the source is listed
+func (b *Blocklists) Process(event *logger.Event) {
+	ip, ok := remoteIP(event)
+	if !ok {
+		return
+	}
+	if names := b.Lookup(ip); len(names) > 0 {
+		event.Set("blocklists", names)
+	}
+}
+
+// Close stops refreshing the blocklists
+func (b *Blocklists) Close() error {
+	b.lists.close()
+	return nil
+}
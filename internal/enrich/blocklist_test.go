@@ -0,0 +1,61 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestBlocklistsProcess(t *testing.T) {
+	var version atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Spamhaus DROP format
+		if version.Load() == 0 {
+			w.Write([]byte("; Spamhaus DROP List\n203.0.113.0/24 ; SBL1\n"))
+		} else {
+			w.Write([]byte("; Spamhaus DROP List\n198.51.100.0/24 ; SBL2\n"))
+		}
+	}))
+	defer server.Close()
+
+	custom := filepath.Join(t.TempDir(), "custom.txt")
+	if err := os.WriteFile(custom, []byte("# scanners\n203.0.113.10\n203.0.113.0/28\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBlocklists([]BlocklistSource{
+		{Name: "spamhaus_drop", Location: server.URL + "/drop.txt"},
+		{Name: "custom", Location: custom},
+	}, 0)
+	defer b.Close()
+
+	event := logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "203.0.113.10:40000"})
+	b.Process(event)
+	got, _ := event.Get("blocklists")
+	if expected := []string{"spamhaus_drop", "custom"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected blocklists %v, got %v", expected, got)
+	}
+
+	event = logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "192.0.2.1:40000"})
+	b.Process(event)
+	if _, ok := event.Get("blocklists"); ok {
+		t.Errorf("Expected no blocklists field for unlisted address")
+	}
+
+	// Refreshing picks up changes of the lists
+	version.Store(1)
+	b.Refresh(context.Background())
+	if names := b.Lookup(mustAddr("198.51.100.1")); !reflect.DeepEqual(names, []string{"spamhaus_drop"}) {
+		t.Errorf("Expected updated list to match, got %v", names)
+	}
+	if names := b.Lookup(mustAddr("203.0.113.200")); names != nil {
+		t.Errorf("Expected removed network not to match, got %v", names)
+	}
+}
@@ -0,0 +1,228 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// cacheKey identifies the result of one enricher for one address
+type cacheKey struct {
+	namespace string
+	ip        netip.Addr
+}
+
+// Cache is an in-memory cache of enrichment results keyed by source
+// address and shared by the enrichers, so that the thousands of attempts
+// of a single botnet address cause a single lookup. The cache can be
+// persisted to a file to survive restarts.
+type Cache struct {
+	lru  *lruCache[cacheKey, interface{}]
+	path string
+
+	saveMu sync.Mutex
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// cacheFile is the format of the persisted cache
+type cacheFile struct {
+	Entries []cacheFileEntry `json:"entries"`
+}
+
+type cacheFileEntry struct {
+	Namespace string          `json:"ns"`
+	IP        string          `json:"ip"`
+	Expires   time.Time       `json:"expires,omitempty"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// NewCache creates a cache holding up to size results. If path is not
+// empty, results are loaded from it and saved to it every saveInterval
+// and when the cache is closed.
+func NewCache(size int, path string, saveInterval time.Duration) (*Cache, error) {
+	c := &Cache{
+		lru:  newLRUCache[cacheKey, interface{}](size, 0),
+		path: path,
+		done: make(chan struct{}),
+	}
+
+	if path != "" {
+		if err := c.load(); err != nil {
+			return nil, err
+		}
+		if saveInterval > 0 {
+			c.wg.Add(1)
+			go c.saveLoop(saveInterval)
+		}
+	}
+	return c, nil
+}
+
+// load reads the persisted results, a missing file is not an error
+func (c *Cache) load() error {
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read enrichment cache: %w", err)
+	}
+
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse enrichment cache %s: %w", c.path, err)
+	}
+
+	now := time.Now()
+	for _, e := range file.Entries {
+		ip, err := netip.ParseAddr(e.IP)
+		if err != nil || (!e.Expires.IsZero() && now.After(e.Expires)) {
+			continue
+		}
+		// Values are decoded into their type on first use
+		c.lru.addUntil(cacheKey{namespace: e.Namespace, ip: ip}, e.Value, e.Expires)
+	}
+	log.Debug().Int("entries", c.lru.len()).Str("file", c.path).Msg("enrichment cache loaded")
+	return nil
+}
+
+// Save writes the cached results to the cache file
+func (c *Cache) Save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	var file cacheFile
+	c.lru.each(func(key cacheKey, value interface{}, expires time.Time) {
+		raw, ok := value.(json.RawMessage)
+		if !ok {
+			var err error
+			if raw, err = json.Marshal(value); err != nil {
+				return
+			}
+		}
+		file.Entries = append(file.Entries, cacheFileEntry{
+			Namespace: key.namespace,
+			IP:        key.ip.String(),
+			Expires:   expires,
+			Value:     raw,
+		})
+	})
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	// Replace the file atomically so that a crash never leaves it truncated
+	if err := replaceFile(c.path, data, time.Now()); err != nil {
+		return fmt.Errorf("failed to save enrichment cache: %w", err)
+	}
+	return nil
+}
+
+func (c *Cache) saveLoop(interval time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Save(); err != nil {
+				log.Warn().Err(err).Msg("enrichment cache save failed")
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Len returns the number of cached results
+func (c *Cache) Len() int {
+	return c.lru.len()
+}
+
+// Close stops the periodic saving and saves the cache a last time
+func (c *Cache) Close() error {
+	close(c.done)
+	c.wg.Wait()
+	return c.Save()
+}
+
+// cacheNamespace is the part of a shared cache holding the results of one
+// enricher, with its own TTL
+type cacheNamespace[V any] struct {
+	cache *Cache
+	name  string
+	ttl   time.Duration
+}
+
+// privateCacheSize is the size of the cache of an enricher without a shared cache
+const privateCacheSize = 10000
+
+// newCacheNamespace returns the results of the named enricher in cache, or
+// in a private in-memory cache if cache is nil
+func newCacheNamespace[V any](cache *Cache, name string, ttl time.Duration) *cacheNamespace[V] {
+	if cache == nil {
+		cache, _ = NewCache(privateCacheSize, "", 0)
+	}
+	return &cacheNamespace[V]{cache: cache, name: name, ttl: ttl}
+}
+
+func (n *cacheNamespace[V]) get(ip netip.Addr) (V, bool) {
+	var zero V
+	key := cacheKey{namespace: n.name, ip: ip}
+	value, expires, ok := n.cache.lru.getEntry(key)
+	if !ok {
+		return zero, false
+	}
+
+	switch v := value.(type) {
+	case V:
+		return v, true
+	case json.RawMessage:
+		// Loaded from the cache file
+		var decoded V
+		if err := json.Unmarshal(v, &decoded); err != nil {
+			return zero, false
+		}
+		n.cache.lru.addUntil(key, decoded, expires)
+		return decoded, true
+	default:
+		return zero, false
+	}
+}
+
+func (n *cacheNamespace[V]) add(ip netip.Addr, value V) {
+	n.cache.lru.addTTL(cacheKey{namespace: n.name, ip: ip}, value, n.ttl)
+}
@@ -0,0 +1,82 @@
+package enrich
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheNamespaces(t *testing.T) {
+	cache, err := NewCache(100, "", 0)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+
+	rdns := newCacheNamespace[string](cache, "rdns", time.Hour)
+	abuse := newCacheNamespace[AbuseIPDBResult](cache, "abuseipdb", time.Hour)
+
+	ip := mustAddr("203.0.113.10")
+	rdns.add(ip, "scanner.example.net")
+	abuse.add(ip, AbuseIPDBResult{Found: true, Score: 90})
+
+	if got, ok := rdns.get(ip); !ok || got != "scanner.example.net" {
+		t.Errorf("Expected cached hostname, got '%s' (%v)", got, ok)
+	}
+	if got, ok := abuse.get(ip); !ok || got.Score != 90 {
+		t.Errorf("Expected cached score 90, got %+v (%v)", got, ok)
+	}
+	if _, ok := rdns.get(mustAddr("203.0.113.11")); ok {
+		t.Errorf("Expected no result for other address")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.Len())
+	}
+}
+
+func TestCachePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	cache, err := NewCache(100, path, 0)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	newCacheNamespace[string](cache, "rdns", time.Hour).add(mustAddr("203.0.113.10"), "scanner.example.net")
+	newCacheNamespace[GreyNoiseResult](cache, "greynoise", time.Hour).add(mustAddr("2001:db8::1"), GreyNoiseResult{Found: true, Classification: "malicious", Noise: true})
+	newCacheNamespace[string](cache, "rdns", time.Nanosecond).add(mustAddr("203.0.113.11"), "expired.example.net")
+	time.Sleep(time.Millisecond)
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Failed to save cache: %v", err)
+	}
+
+	cache, err = NewCache(100, path, 0)
+	if err != nil {
+		t.Fatalf("Failed to load cache: %v", err)
+	}
+	defer cache.Close()
+
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 entries without the expired one, got %d", cache.Len())
+	}
+	if got, ok := newCacheNamespace[string](cache, "rdns", time.Hour).get(mustAddr("203.0.113.10")); !ok || got != "scanner.example.net" {
+		t.Errorf("Expected persisted hostname, got '%s' (%v)", got, ok)
+	}
+	greyNoise := newCacheNamespace[GreyNoiseResult](cache, "greynoise", time.Hour)
+	for i := 0; i < 2; i++ {
+		got, ok := greyNoise.get(mustAddr("2001:db8::1"))
+		if !ok || got.Classification != "malicious" || !got.Noise {
+			t.Errorf("Expected persisted classification, got %+v (%v)", got, ok)
+		}
+	}
+}
+
+func TestCacheInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	if err := os.WriteFile(path, []byte("{broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCache(100, path, 0); err == nil {
+		t.Errorf("Expected error for broken cache file")
+	}
+}
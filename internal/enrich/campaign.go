@@ -0,0 +1,325 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/rs/zerolog/log"
+)
+
+// A source joins the campaign it scores best against if the score reaches
+// campaignThreshold. The score is the share of the source's credentials
+// already tried by the campaign, plus bonuses for a client version and a
+// timing class seen in the campaign, so a shared wordlist is always needed.
+const (
+	campaignWordlistWeight = 0.6
+	campaignClientWeight   = 0.2
+	campaignTimingWeight   = 0.2
+	campaignThreshold      = 0.6
+)
+
+// Limits of the remembered campaigns and credentials
+const (
+	maxCampaigns           = 10000
+	maxCampaignCredentials = 10000
+	maxSourceCredentials   = 100
+)
+
+// Timing classes of sources, by the mean interval between their attempts
+const (
+	TimingBurst  = "burst"
+	TimingFast   = "fast"
+	TimingSteady = "steady"
+	TimingSlow   = "slow"
+)
+
+// CampaignConfig contains settings of the campaign clustering
+type CampaignConfig struct {
+	// Attempts from a source before it is assigned to a campaign, at least 2
+	MinAttempts int
+	// How long sources and campaigns are remembered after their last attempt
+	Window time.Duration
+	// Maximum number of tracked sources
+	MaxSources int
+}
+
+// Campaign is a summary of a group of sources attacking alike
+type Campaign struct {
+	ID        string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Number of sources and attempts assigned to the campaign
+	Sources  int
+	Attempts int
+	// Client versions and timing classes of the sources
+	ClientVersions []string
+	Timings        []string
+}
+
+type campaignState struct {
+	Campaign
+	credentials map[uint64]struct{}
+	clients     map[string]struct{}
+	timings     map[string]struct{}
+}
+
+type campaignSource struct {
+	first         time.Time
+	last          time.Time
+	attempts      int
+	credentials   map[uint64]struct{}
+	clientVersion string
+	campaign      *campaignState
+}
+
+// Campaigns groups sources into campaigns by shared wordlists, timing
+// patterns and client versions, and attaches a campaign_id to attempts.
+// Sources are assigned once they made MinAttempts attempts; earlier
+// attempts carry no campaign ID.
+type Campaigns struct {
+	mu          sync.Mutex
+	minAttempts int
+	sources     *lruCache[netip.Addr, *campaignSource]
+	campaigns   *lruCache[string, *campaignState]
+}
+
+// NewCampaigns creates a campaign clustering
+func NewCampaigns(cfg CampaignConfig) *Campaigns {
+	return &Campaigns{
+		minAttempts: cfg.MinAttempts,
+		sources:     newLRUCache[netip.Addr, *campaignSource](cfg.MaxSources, cfg.Window),
+		campaigns:   newLRUCache[string, *campaignState](maxCampaigns, cfg.Window),
+	}
+}
+
+// Observe records attempts of a source and returns the ID of its campaign,
+// or an empty string if it is not assigned yet
+func (c *Campaigns) Observe(ip netip.Addr, username, password, clientVersion string, attempts int, at time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	src, ok := c.sources.get(ip)
+	if !ok {
+		src = &campaignSource{first: at, credentials: make(map[uint64]struct{})}
+	}
+	if at.After(src.last) {
+		src.last = at
+	}
+	src.attempts += attempts
+	if clientVersion != "" {
+		src.clientVersion = clientVersion
+	}
+	cred := credentialHash(username, password)
+	if len(src.credentials) < maxSourceCredentials {
+		src.credentials[cred] = struct{}{}
+	}
+	c.sources.add(ip, src)
+
+	// A campaign may have expired while its source was still active
+	if src.campaign != nil {
+		if _, ok := c.campaigns.get(src.campaign.ID); !ok {
+			src.campaign = nil
+		}
+	}
+
+	if src.campaign == nil {
+		if src.attempts < c.minAttempts {
+			return ""
+		}
+		c.assign(ip, src)
+		return src.campaign.ID
+	}
+
+	camp := src.campaign
+	camp.Attempts += attempts
+	if at.After(camp.LastSeen) {
+		camp.LastSeen = at
+	}
+	if len(camp.credentials) < maxCampaignCredentials {
+		camp.credentials[cred] = struct{}{}
+	}
+	if clientVersion != "" {
+		camp.clients[clientVersion] = struct{}{}
+	}
+	c.campaigns.add(camp.ID, camp)
+	return camp.ID
+}
+
+// assign adds a source to the best matching campaign, or starts a new one
+func (c *Campaigns) assign(ip netip.Addr, src *campaignSource) {
+	timing := timingClass(src)
+
+	var best *campaignState
+	var bestScore float64
+	c.campaigns.each(func(_ string, camp *campaignState, _ time.Time) {
+		if score := campaignScore(camp, src, timing); score >= campaignThreshold && score > bestScore {
+			best, bestScore = camp, score
+		}
+	})
+
+	if best == nil {
+		best = &campaignState{
+			Campaign: Campaign{
+				ID:        campaignID(ip, src.first),
+				FirstSeen: src.first,
+			},
+			credentials: make(map[uint64]struct{}),
+			clients:     make(map[string]struct{}),
+			timings:     make(map[string]struct{}),
+		}
+		log.Debug().Str("campaign_id", best.ID).Str("ip", ip.String()).Msg("campaign started")
+	}
+
+	best.Sources++
+	best.Attempts += src.attempts
+	if src.first.Before(best.FirstSeen) {
+		best.FirstSeen = src.first
+	}
+	if src.last.After(best.LastSeen) {
+		best.LastSeen = src.last
+	}
+	for cred := range src.credentials {
+		if len(best.credentials) >= maxCampaignCredentials {
+			break
+		}
+		best.credentials[cred] = struct{}{}
+	}
+	if src.clientVersion != "" {
+		best.clients[src.clientVersion] = struct{}{}
+	}
+	best.timings[timing] = struct{}{}
+	c.campaigns.add(best.ID, best)
+	src.campaign = best
+
+	if best.Sources == 2 {
+		log.Info().Str("campaign_id", best.ID).Msg("campaign spanning several sources detected")
+	}
+}
+
+// campaignScore rates how well a source matches a campaign
+func campaignScore(camp *campaignState, src *campaignSource, timing string) float64 {
+	shared := 0
+	for cred := range src.credentials {
+		if _, ok := camp.credentials[cred]; ok {
+			shared++
+		}
+	}
+	if shared == 0 {
+		return 0
+	}
+
+	score := campaignWordlistWeight * float64(shared) / float64(len(src.credentials))
+	if _, ok := camp.clients[src.clientVersion]; ok {
+		score += campaignClientWeight
+	}
+	if _, ok := camp.timings[timing]; ok {
+		score += campaignTimingWeight
+	}
+	return score
+}
+
+// timingClass classifies a source by the mean interval between its attempts
+func timingClass(src *campaignSource) string {
+	if src.attempts < 2 {
+		return TimingSlow
+	}
+	interval := src.last.Sub(src.first) / time.Duration(src.attempts-1)
+	switch {
+	case interval < time.Second:
+		return TimingBurst
+	case interval < 10*time.Second:
+		return TimingFast
+	case interval < time.Minute:
+		return TimingSteady
+	default:
+		return TimingSlow
+	}
+}
+
+// credentialHash returns the hash of a username and password pair
+func credentialHash(username, password string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(username))
+	h.Write([]byte{0})
+	h.Write([]byte(password))
+	return h.Sum64()
+}
+
+// campaignID derives the ID of a campaign from its first source
+func campaignID(ip netip.Addr, first time.Time) string {
+	h := fnv.New64a()
+	h.Write(ip.AsSlice())
+	fmt.Fprint(h, first.UnixNano())
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// Campaigns returns the active campaigns, the largest first
+func (c *Campaigns) Campaigns() []Campaign {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var campaigns []Campaign
+	c.campaigns.each(func(_ string, camp *campaignState, _ time.Time) {
+		summary := camp.Campaign
+		summary.ClientVersions = sortedKeys(camp.clients)
+		summary.Timings = sortedKeys(camp.timings)
+		campaigns = append(campaigns, summary)
+	})
+	sort.Slice(campaigns, func(i, j int) bool {
+		if campaigns[i].Sources != campaigns[j].Sources {
+			return campaigns[i].Sources > campaigns[j].Sources
+		}
+		return campaigns[i].Attempts > campaigns[j].Attempts
+	})
+	return campaigns
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Process adds the campaign_id field to authentication attempts
+func (c *Campaigns) Process(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	ip, ok := remoteIP(event)
+	if !ok {
+		return
+	}
+
+	id := c.Observe(ip, event.GetString("username"), event.GetString("password"),
+		event.GetString("client_version"), attemptCount(event), event.Time)
+	if id != "" {
+		event.Set("campaign_id", id)
+	}
+}
@@ -0,0 +1,110 @@
+package enrich
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+var campaignWordlist = [][2]string{
+	{"root", "root"},
+	{"admin", "admin"},
+	{"root", "123456"},
+	{"ubnt", "ubnt"},
+}
+
+// attack makes attempts from a source with the given credentials, one per interval
+func attack(c *Campaigns, ip netip.Addr, client string, creds [][2]string, start time.Time, interval time.Duration) string {
+	var id string
+	for i, cred := range creds {
+		id = c.Observe(ip, cred[0], cred[1], client, 1, start.Add(time.Duration(i)*interval))
+	}
+	return id
+}
+
+func TestCampaignsClustering(t *testing.T) {
+	c := NewCampaigns(CampaignConfig{MinAttempts: 3, Window: time.Hour, MaxSources: 100})
+	start := time.Now()
+	client := "SSH-2.0-Go"
+
+	first := attack(c, mustAddr("203.0.113.1"), client, campaignWordlist, start, 2*time.Second)
+	if first == "" {
+		t.Fatalf("Expected source to be assigned to a campaign")
+	}
+	second := attack(c, mustAddr("198.51.100.7"), client, campaignWordlist[1:], start, 3*time.Second)
+	if second != first {
+		t.Errorf("Expected source with the same wordlist to join campaign %s, got %s", first, second)
+	}
+
+	other := [][2]string{{"oracle", "oracle"}, {"postgres", "postgres"}, {"git", "git"}}
+	third := attack(c, mustAddr("192.0.2.20"), client, other, start, 2*time.Second)
+	if third == "" || third == first {
+		t.Errorf("Expected source with another wordlist to start a new campaign, got %s", third)
+	}
+
+	// One shared credential is not enough on its own
+	mixed := [][2]string{{"root", "root"}, {"pi", "raspberry"}, {"test", "test"}, {"user", "user"}}
+	fourth := attack(c, mustAddr("192.0.2.30"), "SSH-2.0-libssh_0.9.6", mixed, start, time.Minute)
+	if fourth == first {
+		t.Errorf("Expected weakly matching source to start a new campaign")
+	}
+
+	campaigns := c.Campaigns()
+	if len(campaigns) != 3 {
+		t.Fatalf("Expected 3 campaigns, got %d", len(campaigns))
+	}
+	if campaigns[0].ID != first || campaigns[0].Sources != 2 || campaigns[0].Attempts != 7 {
+		t.Errorf("Unexpected largest campaign: %+v", campaigns[0])
+	}
+	if len(campaigns[0].ClientVersions) != 1 || campaigns[0].ClientVersions[0] != client {
+		t.Errorf("Expected client version %s, got %v", client, campaigns[0].ClientVersions)
+	}
+	if len(campaigns[0].Timings) != 1 || campaigns[0].Timings[0] != TimingFast {
+		t.Errorf("Expected fast timing, got %v", campaigns[0].Timings)
+	}
+}
+
+func TestCampaignsProcess(t *testing.T) {
+	c := NewCampaigns(CampaignConfig{MinAttempts: 2, Window: time.Hour, MaxSources: 100})
+
+	for i, cred := range campaignWordlist {
+		event := logger.NewAuthEvent(logger.CredentialAttempt{
+			Timestamp:     time.Now(),
+			RemoteAddr:    fmt.Sprintf("203.0.113.1:%d", 40000+i),
+			Username:      cred[0],
+			Password:      cred[1],
+			ClientVersion: "SSH-2.0-Go",
+		})
+		c.Process(event)
+
+		_, ok := event.Get("campaign_id")
+		if i == 0 && ok {
+			t.Errorf("Expected no campaign before min_attempts")
+		}
+		if i > 0 && !ok {
+			t.Errorf("Expected campaign_id on attempt %d", i+1)
+		}
+	}
+}
+
+func TestTimingClass(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		interval time.Duration
+		expected string
+	}{
+		{100 * time.Millisecond, TimingBurst},
+		{5 * time.Second, TimingFast},
+		{30 * time.Second, TimingSteady},
+		{5 * time.Minute, TimingSlow},
+	}
+	for _, tt := range tests {
+		src := &campaignSource{first: start, last: start.Add(3 * tt.interval), attempts: 4}
+		if got := timingClass(src); got != tt.expected {
+			t.Errorf("Interval %v: expected %s, got %s", tt.interval, tt.expected, got)
+		}
+	}
+}
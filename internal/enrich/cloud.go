@@ -0,0 +1,189 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Formats of published cloud IP ranges
+const (
+	// AWS ip-ranges.json
+	CloudFormatAWS = "aws"
+	// Google Cloud cloud.json
+	CloudFormatGCP = "gcp"
+	// Azure ServiceTags_Public.json
+	CloudFormatAzure = "azure"
+	// One network per line, or CSV with the network in the first column
+	CloudFormatText = "text"
+)
+
+// CloudSource is a list of networks operated by a provider
+type CloudSource struct {
+	// Provider name attached to events
+	Provider string
+	// File path or http(s) URL of the list
+	Location string
+	// List format
+	Format string
+}
+
+// DefaultCloudSources are the ranges published at stable URLs. Azure and
+// OVH do not publish such a URL and have to be configured explicitly.
+var DefaultCloudSources = []CloudSource{
+	{Provider: "aws", Location: "https://ip-ranges.amazonaws.com/ip-ranges.json", Format: CloudFormatAWS},
+	{Provider: "gcp", Location: "https://www.gstatic.com/ipranges/cloud.json", Format: CloudFormatGCP},
+	{Provider: "digitalocean", Location: "https://digitalocean.com/geo/google.csv", Format: CloudFormatText},
+}
+
+// Cloud tags events with the cloud or hosting provider operating the
+// source network. The ranges are downloaded again periodically.
+type Cloud struct {
+	lists *networkLists
+}
+
+// NewCloud loads the provider ranges and refreshes them at the given
+// interval. Sources that can not be loaded are skipped with a warning.
+func NewCloud(sources []CloudSource, refreshInterval time.Duration) (*Cloud, error) {
+	lists := make([]networkList, 0, len(sources))
+	for _, src := range sources {
+		switch src.Format {
+		case CloudFormatAWS, CloudFormatGCP, CloudFormatAzure, CloudFormatText:
+		default:
+			return nil, fmt.Errorf("unknown format of %s ranges: %s", src.Provider, src.Format)
+		}
+		format := src.Format
+		lists = append(lists, networkList{
+			name:     src.Provider,
+			location: src.Location,
+			parse: func(data []byte) ([]netip.Prefix, error) {
+				return parseCloudRanges(data, format)
+			},
+		})
+	}
+
+	return &Cloud{lists: newNetworkLists("cloud provider ranges", lists, refreshInterval)}, nil
+}
+
+// Refresh loads all sources again. A source that fails keeps its
+// previously loaded ranges.
+func (c *Cloud) Refresh(ctx context.Context) {
+	c.lists.refresh(ctx)
+}
+
+// Lookup returns the provider operating the network of an address
+func (c *Cloud) Lookup(ip netip.Addr) (string, bool) {
+	providers := c.lists.lookup(ip)
+	if len(providers) == 0 {
+		return "", false
+	}
+	// The most specific network wins
+	return providers[len(providers)-1], true
+}
+
+// Process adds the cloud_provider field to the event
+func (c *Cloud) Process(event *logger.Event) {
+	ip, ok := remoteIP(event)
+	if !ok {
+		return
+	}
+	if provider, ok := c.Lookup(ip); ok {
+		event.Set("cloud_provider", provider)
+	}
+}
+
+// Close stops refreshing the ranges
+func (c *Cloud) Close() error {
+	c.lists.close()
+	return nil
+}
+
+// parseCloudRanges parses the published ranges of a provider
+func parseCloudRanges(data []byte, format string) ([]netip.Prefix, error) {
+	var networks []string
+	switch format {
+	case CloudFormatAWS:
+		var doc struct {
+			Prefixes []struct {
+				IPPrefix string `json:"ip_prefix"`
+			} `json:"prefixes"`
+			IPv6Prefixes []struct {
+				IPv6Prefix string `json:"ipv6_prefix"`
+			} `json:"ipv6_prefixes"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		for _, p := range doc.Prefixes {
+			networks = append(networks, p.IPPrefix)
+		}
+		for _, p := range doc.IPv6Prefixes {
+			networks = append(networks, p.IPv6Prefix)
+		}
+	case CloudFormatGCP:
+		var doc struct {
+			Prefixes []struct {
+				IPv4Prefix string `json:"ipv4Prefix"`
+				IPv6Prefix string `json:"ipv6Prefix"`
+			} `json:"prefixes"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		for _, p := range doc.Prefixes {
+			networks = append(networks, p.IPv4Prefix+p.IPv6Prefix)
+		}
+	case CloudFormatAzure:
+		var doc struct {
+			Values []struct {
+				Properties struct {
+					AddressPrefixes []string `json:"addressPrefixes"`
+				} `json:"properties"`
+			} `json:"values"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		for _, v := range doc.Values {
+			networks = append(networks, v.Properties.AddressPrefixes...)
+		}
+	default:
+		return parsePrefixList(data)
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, n := range networks {
+		if n == "" {
+			continue
+		}
+		prefix, err := parsePrefix(n)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,104 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestCloudProcess(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"aws.json":   `{"prefixes":[{"ip_prefix":"192.0.2.0/24","service":"EC2"}],"ipv6_prefixes":[{"ipv6_prefix":"2001:db8:a::/48"}]}`,
+		"gcp.json":   `{"prefixes":[{"ipv4Prefix":"198.51.100.0/24"},{"ipv6Prefix":"2001:db8:b::/48"}]}`,
+		"azure.json": `{"values":[{"name":"AzureCloud","properties":{"addressPrefixes":["203.0.113.0/25","2001:db8:c::/48"]}}]}`,
+		"ovh.txt":    "# OVH\n203.0.113.128/25\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cloud, err := NewCloud([]CloudSource{
+		{Provider: "aws", Location: filepath.Join(dir, "aws.json"), Format: CloudFormatAWS},
+		{Provider: "gcp", Location: filepath.Join(dir, "gcp.json"), Format: CloudFormatGCP},
+		{Provider: "azure", Location: filepath.Join(dir, "azure.json"), Format: CloudFormatAzure},
+		{Provider: "ovh", Location: filepath.Join(dir, "ovh.txt"), Format: CloudFormatText},
+		{Provider: "missing", Location: filepath.Join(dir, "missing.txt"), Format: CloudFormatText},
+	}, 0)
+	if err != nil {
+		t.Fatalf("Failed to create cloud matcher: %v", err)
+	}
+	defer cloud.Close()
+
+	tests := map[string]string{
+		"192.0.2.10:22":      "aws",
+		"[2001:db8:a::1]:22": "aws",
+		"198.51.100.1:22":    "gcp",
+		"[2001:db8:b::1]:22": "gcp",
+		"203.0.113.1:22":     "azure",
+		"203.0.113.200:22":   "ovh",
+		"10.0.0.1:22":        "",
+	}
+	for addr, expected := range tests {
+		event := logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: addr})
+		cloud.Process(event)
+		if got := event.GetString("cloud_provider"); got != expected {
+			t.Errorf("%s: expected provider '%s', got '%s'", addr, expected, got)
+		}
+	}
+
+	// A source that can no longer be read keeps its ranges
+	os.Remove(filepath.Join(dir, "ovh.txt"))
+	cloud.Refresh(context.Background())
+	if provider, _ := cloud.Lookup(mustAddr("203.0.113.200")); provider != "ovh" {
+		t.Errorf("Expected ovh ranges to be kept after failed refresh, got '%s'", provider)
+	}
+}
+
+func TestCloudInvalidRefresh(t *testing.T) {
+	var valid atomic.Bool
+	valid.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case !valid.Load():
+			w.Write([]byte("<html>maintenance</html>\n"))
+		case r.URL.Path == "/aws.json":
+			w.Write([]byte(`{"prefixes":[{"ip_prefix":"192.0.2.0/24"}]}`))
+		default:
+			w.Write([]byte("203.0.113.0/24\n"))
+		}
+	}))
+	defer server.Close()
+
+	cloud, err := NewCloud([]CloudSource{
+		{Provider: "aws", Location: server.URL + "/aws.json", Format: CloudFormatAWS},
+		{Provider: "ovh", Location: server.URL + "/ovh.txt", Format: CloudFormatText},
+	}, 0)
+	if err != nil {
+		t.Fatalf("Failed to create cloud matcher: %v", err)
+	}
+	defer cloud.Close()
+
+	// Lists that can not be parsed keep the networks loaded before
+	valid.Store(false)
+	cloud.Refresh(context.Background())
+	for addr, expected := range map[string]string{"192.0.2.10": "aws", "203.0.113.1": "ovh"} {
+		if provider, _ := cloud.Lookup(mustAddr(addr)); provider != expected {
+			t.Errorf("%s: expected provider '%s' after invalid refresh, got '%s'", addr, expected, provider)
+		}
+	}
+}
+
+func TestCloudUnknownFormat(t *testing.T) {
+	if _, err := NewCloud([]CloudSource{{Provider: "x", Location: "x", Format: "yaml"}}, 0); err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+//go:embed dictionaries/*.txt
+var builtinDictionaries embed.FS
+
+// BuiltinDictionaries returns the names of the bundled dictionaries
+func BuiltinDictionaries() []string {
+	entries, _ := builtinDictionaries.ReadDir("dictionaries")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DictionarySource is a list of well-known credentials
+type DictionarySource struct {
+	// Dictionary name attached to events
+	Name string
+	// File path or http(s) URL of the dictionary, a bundled dictionary is
+	// used if empty
+	Location string
+}
+
+// credential is a username/password pair
+type credential struct {
+	username string
+	password string
+}
+
+// Dictionaries tags authentication attempts with the dictionaries of
+// well-known credentials (botnet lists, vendor defaults) they appear in
+type Dictionaries struct {
+	names map[credential][]string
+}
+
+// NewDictionaries loads the given dictionaries
+func NewDictionaries(sources []DictionarySource) (*Dictionaries, error) {
+	d := &Dictionaries{names: make(map[credential][]string)}
+
+	for _, src := range sources {
+		var data []byte
+		var err error
+		if src.Location == "" {
+			data, err = builtinDictionaries.ReadFile("dictionaries/" + src.Name + ".txt")
+			if err != nil {
+				return nil, fmt.Errorf("unknown built-in dictionary: %s", src.Name)
+			}
+		} else {
+			data, err = readSource(context.Background(), src.Location)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read dictionary %s: %w", src.Name, err)
+			}
+		}
+
+		creds, err := parseDictionary(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dictionary %s: %w", src.Name, err)
+		}
+		for _, c := range creds {
+			if !slices.Contains(d.names[c], src.Name) {
+				d.names[c] = append(d.names[c], src.Name)
+			}
+		}
+	}
+
+	return d, nil
+}
+
+// parseDictionary parses a dictionary with one username:password pair per
+// line. Lines starting with '#' are comments.
+func parseDictionary(data []byte) ([]credential, error) {
+	var creds []credential
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(strings.TrimSpace(text), "#") {
+			continue
+		}
+		username, password, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected username:password", line)
+		}
+		creds = append(creds, credential{username: username, password: password})
+	}
+	return creds, scanner.Err()
+}
+
+// Lookup returns the names of the dictionaries containing a credential
+func (d *Dictionaries) Lookup(username, password string) []string {
+	return d.names[credential{username: username, password: password}]
+}
+
+// Len returns the number of distinct credentials in all dictionaries
+func (d *Dictionaries) Len() int {
+	return len(d.names)
+}
+
+// Process adds the dictionaries field to authentication attempts using
+// well-known credentials
+func (d *Dictionaries) Process(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	names := d.Lookup(event.GetString("username"), event.GetString("password"))
+	if len(names) > 0 {
+		event.Set("dictionaries", names)
+	}
+}
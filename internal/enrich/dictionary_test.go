@@ -0,0 +1,81 @@
+package enrich
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestBuiltinDictionaries(t *testing.T) {
+	names := BuiltinDictionaries()
+	if !reflect.DeepEqual(names, []string{"mirai", "vendor"}) {
+		t.Fatalf("Unexpected built-in dictionaries: %v", names)
+	}
+
+	var sources []DictionarySource
+	for _, name := range names {
+		sources = append(sources, DictionarySource{Name: name})
+	}
+	d, err := NewDictionaries(sources)
+	if err != nil {
+		t.Fatalf("Failed to load built-in dictionaries: %v", err)
+	}
+
+	tests := []struct {
+		username string
+		password string
+		expected []string
+	}{
+		{"root", "xc3511", []string{"mirai"}},
+		{"root", "", []string{"mirai"}},
+		{"pi", "raspberry", []string{"vendor"}},
+		{"ubnt", "ubnt", []string{"mirai", "vendor"}},
+		{"root", "correct horse battery staple", nil},
+	}
+	for _, tt := range tests {
+		if got := d.Lookup(tt.username, tt.password); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Lookup(%s, %s): expected %v, got %v", tt.username, tt.password, tt.expected, got)
+		}
+	}
+
+	if _, err := NewDictionaries([]DictionarySource{{Name: "unknown"}}); err == nil {
+		t.Errorf("Expected error for unknown built-in dictionary")
+	}
+}
+
+func TestDictionariesProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom.txt")
+	if err := os.WriteFile(path, []byte("# custom wordlist\r\ndeploy:deploy\r\nadmin:p:ss\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDictionaries([]DictionarySource{{Name: "custom", Location: path}})
+	if err != nil {
+		t.Fatalf("Failed to load dictionary: %v", err)
+	}
+	if d.Len() != 2 {
+		t.Errorf("Expected 2 credentials, got %d", d.Len())
+	}
+
+	event := logger.NewAuthEvent(logger.CredentialAttempt{Username: "admin", Password: "p:ss"})
+	d.Process(event)
+	if got, _ := event.Get("dictionaries"); !reflect.DeepEqual(got, []string{"custom"}) {
+		t.Errorf("Expected dictionaries [custom], got %v", got)
+	}
+
+	event = logger.NewAuthEvent(logger.CredentialAttempt{Username: "deploy", Password: "Deploy"})
+	d.Process(event)
+	if _, ok := event.Get("dictionaries"); ok {
+		t.Errorf("Expected no match for different password")
+	}
+
+	if err := os.WriteFile(path, []byte("no separator\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDictionaries([]DictionarySource{{Name: "custom", Location: path}}); err == nil {
+		t.Errorf("Expected error for invalid dictionary line")
+	}
+}
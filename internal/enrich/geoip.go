@@ -0,0 +1,95 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/rs/zerolog/log"
+)
+
+// GeoRecord is the location of an IP address
+type GeoRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// GeoIP enriches events with country, city and coordinates from a
+// GeoLite2/GeoIP2 City or Country database
+type GeoIP struct {
+	*mmdbDatabase
+}
+
+// NewGeoIP opens a GeoIP database, reloading it when the file changes
+func NewGeoIP(path string, reloadInterval time.Duration) (*GeoIP, error) {
+	db, err := openMMDB(path, reloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	return &GeoIP{mmdbDatabase: db}, nil
+}
+
+// Lookup returns the location of an address
+func (g *GeoIP) Lookup(ip netip.Addr) (GeoRecord, bool) {
+	var record GeoRecord
+	ok, err := g.lookup(ip, &record)
+	if err != nil {
+		log.Debug().Err(err).Str("ip", ip.String()).Msg("GeoIP lookup failed")
+		return record, false
+	}
+	return record, ok
+}
+
+// Process adds the location fields to the event
+func (g *GeoIP) Process(event *logger.Event) {
+	ip, ok := remoteIP(event)
+	if !ok {
+		return
+	}
+	record, ok := g.Lookup(ip)
+	if !ok {
+		return
+	}
+
+	if record.Country.ISOCode != "" {
+		event.Set("country", record.Country.ISOCode)
+	}
+	if name := record.Country.Names["en"]; name != "" {
+		event.Set("country_name", name)
+	}
+	if name := record.City.Names["en"]; name != "" {
+		event.Set("city", name)
+	}
+	if record.Location.Latitude != 0 || record.Location.Longitude != 0 {
+		event.Set("latitude", record.Location.Latitude)
+		event.Set("longitude", record.Location.Longitude)
+	}
+}
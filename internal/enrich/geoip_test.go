@@ -0,0 +1,79 @@
+package enrich
+
+import (
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+func mustAddr(s string) netip.Addr {
+	return netip.MustParseAddr(s)
+}
+
+func TestGeoIPProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeTestDB(t, path, "GeoLite2-City", map[string]mmdbtype.Map{
+		"203.0.113.0/24": {
+			"country": mmdbtype.Map{
+				"iso_code": mmdbtype.String("NL"),
+				"names":    mmdbtype.Map{"en": mmdbtype.String("Netherlands")},
+			},
+			"city": mmdbtype.Map{
+				"names": mmdbtype.Map{"en": mmdbtype.String("Amsterdam")},
+			},
+			"location": mmdbtype.Map{
+				"latitude":  mmdbtype.Float64(52.37),
+				"longitude": mmdbtype.Float64(4.89),
+			},
+		},
+		"2001:db8::/32": {
+			"country": mmdbtype.Map{
+				"iso_code": mmdbtype.String("DE"),
+			},
+		},
+	})
+
+	geoIP, err := NewGeoIP(path, 0)
+	if err != nil {
+		t.Fatalf("Failed to open GeoIP database: %v", err)
+	}
+	defer geoIP.Close()
+
+	event := logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "203.0.113.10:40000"})
+	geoIP.Process(event)
+
+	expected := map[string]interface{}{
+		"country":      "NL",
+		"country_name": "Netherlands",
+		"city":         "Amsterdam",
+		"latitude":     52.37,
+		"longitude":    4.89,
+	}
+	for key, value := range expected {
+		if got, _ := event.Get(key); got != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, got)
+		}
+	}
+
+	// Only the fields present in the database are added
+	event = logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "[2001:db8::1]:40000"})
+	geoIP.Process(event)
+	if got := event.GetString("country"); got != "DE" {
+		t.Errorf("Expected country DE, got '%s'", got)
+	}
+	for _, key := range []string{"country_name", "city", "latitude", "longitude"} {
+		if _, ok := event.Get(key); ok {
+			t.Errorf("Expected no %s field", key)
+		}
+	}
+
+	// Unknown addresses are left alone
+	event = logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "192.0.2.1:40000"})
+	geoIP.Process(event)
+	if len(event.Fields) != 3 {
+		t.Errorf("Expected no fields added for unknown address, got %v", event.Fields)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// HIBPConfig contains settings of the Pwned Passwords check
+type HIBPConfig struct {
+	// Maximum number of concurrent queries
+	Concurrency int
+	// Timeout of a single query
+	Timeout time.Duration
+	// Number of cached passwords
+	CacheSize int
+	// How long results are cached
+	CacheTTL time.Duration
+}
+
+// hibpResult is the number of breaches a password appeared in
+type hibpResult struct {
+	ok    bool
+	count int
+}
+
+// HIBP checks attempted passwords against the Have I Been Pwned Pwned
+// Passwords range API. Only the first 5 characters of the SHA-1 hash leave
+// the process (k-anonymity). Queries run in the background, so the first
+// attempts with a new password are written without the count.
+type HIBP struct {
+	baseURL string
+	lookup  *asyncLookup[string, hibpResult]
+}
+
+// NewHIBP creates a Pwned Passwords checker
+func NewHIBP(cfg HIBPConfig) *HIBP {
+	h := &HIBP{baseURL: "https://api.pwnedpasswords.com"}
+	cache := newLRUCache[string, hibpResult](cfg.CacheSize, cfg.CacheTTL)
+	h.lookup = newAsyncLookup("Pwned Passwords", cfg.Concurrency, cfg.Timeout, cache, h.query)
+	return h
+}
+
+// query looks up the range of a SHA-1 hash and returns the breach count
+func (h *HIBP) query(ctx context.Context, hash string) (hibpResult, error) {
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return hibpResult{}, err
+	}
+	req.Header.Set("User-Agent", "fakessh")
+	// Padding hides the size of the response from observers
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := reputationClient.Do(req)
+	if err != nil {
+		return hibpResult{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return hibpResult{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		s, countStr, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(s, suffix) {
+			continue
+		}
+		count, err := strconv.Atoi(countStr)
+		if err != nil {
+			return hibpResult{}, fmt.Errorf("invalid count: %w", err)
+		}
+		// Padding entries have a count of 0
+		return hibpResult{ok: true, count: count}, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return hibpResult{}, err
+	}
+	return hibpResult{ok: true}, nil
+}
+
+// Process adds the password_pwned_count field to authentication attempts
+// once the count of their password is known
+func (h *HIBP) Process(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	password, ok := event.Get("password")
+	if !ok {
+		return
+	}
+	s, _ := password.(string)
+
+	sum := sha1.Sum([]byte(s))
+	if result, ok := h.lookup.get(strings.ToUpper(hex.EncodeToString(sum[:]))); ok && result.ok {
+		event.Set("password_pwned_count", result.count)
+	}
+}
+
+// Close waits for running queries to finish
+func (h *HIBP) Close() error {
+	h.lookup.wait()
+	return nil
+}
@@ -0,0 +1,47 @@
+package enrich
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestHIBPProcess(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+		if r.URL.Path != "/range/5BAA6" {
+			w.Write([]byte("0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n"))
+			return
+		}
+		w.Write([]byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"))
+	}))
+	defer server.Close()
+
+	h := NewHIBP(HIBPConfig{Concurrency: 2, Timeout: time.Second, CacheSize: 100, CacheTTL: time.Hour})
+	h.baseURL = server.URL
+	defer h.Close()
+
+	check := func(password string) (interface{}, bool) {
+		h.Process(logger.NewAuthEvent(logger.CredentialAttempt{Username: "root", Password: password}))
+		h.lookup.wait()
+		event := logger.NewAuthEvent(logger.CredentialAttempt{Username: "root", Password: password})
+		h.Process(event)
+		return event.Get("password_pwned_count")
+	}
+
+	if got, _ := check("password"); got != 9545824 {
+		t.Errorf("Expected count 9545824, got %v", got)
+	}
+	if got, ok := check("b7c1f0e2-unique"); !ok || got != 0 {
+		t.Errorf("Expected count 0 for unknown password, got %v (%v)", got, ok)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Expected 2 queries, got %d", got)
+	}
+}
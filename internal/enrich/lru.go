@@ -0,0 +1,139 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCache is a fixed-size cache evicting the least recently used entries,
+// whose entries expire after a TTL
+type lruCache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	items    map[K]*list.Element
+	order    *list.List
+	now      func() time.Time
+}
+
+type lruEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// newLRUCache creates a cache holding up to capacity entries for ttl,
+// entries do not expire if ttl is 0
+func newLRUCache[K comparable, V any](capacity int, ttl time.Duration) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// get returns the cached value of key if it has not expired
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	v, _, ok := c.getEntry(key)
+	return v, ok
+}
+
+// getEntry returns the cached value of key and its expiry time
+func (c *lruCache[K, V]) getEntry(key K) (V, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, time.Time{}, false
+	}
+	entry := el.Value.(*lruEntry[K, V])
+	if !entry.expires.IsZero() && c.now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return zero, time.Time{}, false
+	}
+	c.order.MoveToFront(el)
+	return entry.value, entry.expires, true
+}
+
+// add stores a value for the TTL of the cache
+func (c *lruCache[K, V]) add(key K, value V) {
+	c.addTTL(key, value, c.ttl)
+}
+
+// addTTL stores a value for the given TTL, entries do not expire if ttl is 0
+func (c *lruCache[K, V]) addTTL(key K, value V, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+	c.addUntil(key, value, expires)
+}
+
+// addUntil stores a value until the given time, evicting the oldest entry
+// if the cache is full
+func (c *lruCache[K, V]) addUntil(key K, value V, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry[K, V])
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value, expires: expires})
+	if c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+// each calls fn for every entry that has not expired, from the least to
+// the most recently used one
+func (c *lruCache[K, V]) each(fn func(key K, value V, expires time.Time)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for el := c.order.Back(); el != nil; el = el.Prev() {
+		entry := el.Value.(*lruEntry[K, V])
+		if entry.expires.IsZero() || !now.After(entry.expires) {
+			fn(entry.key, entry.value, entry.expires)
+		}
+	}
+}
+
+// len returns the number of cached entries, including expired ones
+func (c *lruCache[K, V]) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,48 @@
+package enrich
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := newLRUCache[string, int](2, 0)
+	c.add("a", 1)
+	c.add("b", 2)
+
+	// Using "a" makes "b" the least recently used entry
+	if v, ok := c.get("a"); !ok || v != 1 {
+		t.Errorf("Expected a=1, got %d (%v)", v, ok)
+	}
+	c.add("c", 3)
+
+	if _, ok := c.get("b"); ok {
+		t.Errorf("Expected b to be evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Errorf("Expected a to be kept")
+	}
+	if c.len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", c.len())
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newLRUCache[string, string](10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.add("a", "x")
+	now = now.Add(30 * time.Second)
+	if _, ok := c.get("a"); !ok {
+		t.Errorf("Expected entry before TTL")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.get("a"); ok {
+		t.Errorf("Expected entry to expire after TTL")
+	}
+	if c.len() != 0 {
+		t.Errorf("Expected expired entry to be removed, got %d entries", c.len())
+	}
+}
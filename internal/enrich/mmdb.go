@@ -0,0 +1,156 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/rs/zerolog/log"
+)
+
+// mmdbDatabase is a MaxMind database that is loaded into memory and
+// reloaded when the file changes, so it can be replaced while running
+type mmdbDatabase struct {
+	path   string
+	reader atomic.Pointer[maxminddb.Reader]
+
+	mu      sync.Mutex
+	modTime time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// openMMDB loads the database at path and, if interval is positive,
+// checks the file for changes at that interval
+func openMMDB(path string, interval time.Duration) (*mmdbDatabase, error) {
+	db := &mmdbDatabase{
+		path: path,
+		done: make(chan struct{}),
+	}
+	if err := db.Reload(); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		db.wg.Add(1)
+		go db.watch(interval)
+	}
+
+	return db, nil
+}
+
+// Reload reads the database file again. Lookups in progress keep using the
+// previous version.
+func (db *mmdbDatabase) Reload() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// The database is read into memory rather than mapped, so that replacing
+	// the file can not affect a reader that is still in use
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		return fmt.Errorf("failed to read database: %w", err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse database %s: %w", db.path, err)
+	}
+
+	db.reader.Store(reader)
+	db.modTime = info.ModTime()
+	return nil
+}
+
+// watch reloads the database when its modification time changes
+func (db *mmdbDatabase) watch(interval time.Duration) {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(db.path)
+			if err != nil {
+				continue
+			}
+			db.mu.Lock()
+			changed := !info.ModTime().Equal(db.modTime)
+			db.mu.Unlock()
+
+			if changed {
+				if err := db.Reload(); err != nil {
+					log.Warn().Err(err).Str("database", db.path).Msg("database reload failed")
+					continue
+				}
+				log.Info().Str("database", db.path).Msg("database reloaded")
+			}
+		case <-db.done:
+			return
+		}
+	}
+}
+
+// lookup decodes the record of an address into result
+func (db *mmdbDatabase) lookup(ip netip.Addr, result interface{}) (bool, error) {
+	reader := db.reader.Load()
+	_, ok, err := reader.LookupNetwork(net.IP(ip.AsSlice()), result)
+	return ok, err
+}
+
+// Metadata returns the metadata of the loaded database
+func (db *mmdbDatabase) Metadata() maxminddb.Metadata {
+	return db.reader.Load().Metadata
+}
+
+// Close stops watching the database file
+func (db *mmdbDatabase) Close() error {
+	close(db.done)
+	db.wg.Wait()
+	return nil
+}
+
+// remoteIP returns the source address of an event
+func remoteIP(event *logger.Event) (netip.Addr, bool) {
+	addr := event.GetString("remote_addr")
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
@@ -0,0 +1,118 @@
+package enrich
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// writeTestDB writes a MaxMind database with the given records to path
+func writeTestDB(t *testing.T, path, dbType string, records map[string]mmdbtype.Map) {
+	t.Helper()
+
+	tree, err := mmdbwriter.New(mmdbwriter.Options{
+		DatabaseType:            dbType,
+		IncludeReservedNetworks: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	for cidr, record := range records {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("Invalid network %s: %v", cidr, err)
+		}
+		if err := tree.Insert(network, record); err != nil {
+			t.Fatalf("Failed to insert %s: %v", cidr, err)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create database file: %v", err)
+	}
+	defer f.Close()
+	if _, err := tree.WriteTo(f); err != nil {
+		t.Fatalf("Failed to write database: %v", err)
+	}
+}
+
+func TestOpenMMDBReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	writeTestDB(t, path, "Test", map[string]mmdbtype.Map{
+		"203.0.113.0/24": {"value": mmdbtype.String("old")},
+	})
+
+	db, err := openMMDB(path, 0)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	lookup := func() string {
+		var record struct {
+			Value string `maxminddb:"value"`
+		}
+		if _, err := db.lookup(mustAddr("203.0.113.5"), &record); err != nil {
+			t.Fatalf("Lookup failed: %v", err)
+		}
+		return record.Value
+	}
+
+	if got := lookup(); got != "old" {
+		t.Errorf("Expected 'old', got '%s'", got)
+	}
+
+	writeTestDB(t, path, "Test", map[string]mmdbtype.Map{
+		"203.0.113.0/24": {"value": mmdbtype.String("new")},
+	})
+	if err := db.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got := lookup(); got != "new" {
+		t.Errorf("Expected 'new' after reload, got '%s'", got)
+	}
+
+	// A broken file keeps the loaded database
+	if err := os.WriteFile(path, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Reload(); err == nil {
+		t.Errorf("Expected error reloading a broken database")
+	}
+	if got := lookup(); got != "new" {
+		t.Errorf("Expected 'new' after failed reload, got '%s'", got)
+	}
+}
+
+func TestOpenMMDBMissing(t *testing.T) {
+	if _, err := openMMDB(filepath.Join(t.TempDir(), "missing.mmdb"), 0); err == nil {
+		t.Errorf("Expected error for missing database")
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.1:22":            "192.0.2.1",
+		"[2001:db8::1]:2222":      "2001:db8::1",
+		"[::ffff:192.0.2.7]:2222": "192.0.2.7",
+		"198.51.100.3":            "198.51.100.3",
+	}
+	for input, expected := range tests {
+		event := &logger.Event{Fields: []logger.Field{{Key: "remote_addr", Value: input}}}
+		ip, ok := remoteIP(event)
+		if !ok || ip.String() != expected {
+			t.Errorf("remoteIP(%s): expected %s, got %s (%v)", input, expected, ip, ok)
+		}
+	}
+
+	event := &logger.Event{Fields: []logger.Field{{Key: "remote_addr", Value: "not-an-address"}}}
+	if _, ok := remoteIP(event); ok {
+		t.Errorf("Expected no address for invalid remote_addr")
+	}
+}
@@ -0,0 +1,220 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Password patterns
+const (
+	PatternKeyboardWalk = "keyboard_walk"
+	PatternDate         = "date"
+	PatternYear         = "year"
+	PatternSequence     = "sequence"
+	PatternRepeat       = "repeat"
+)
+
+// minPatternRun is the shortest run of characters reported as a keyboard
+// walk, sequence or repetition
+const minPatternRun = 4
+
+// keyboardRows is the QWERTY layout used to detect keyboard walks
+var keyboardRows = []string{
+	"1234567890-=",
+	"qwertyuiop[]",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+// keyPositions maps a key to its row and column
+var keyPositions = func() map[rune][2]int {
+	positions := make(map[rune][2]int)
+	for r, row := range keyboardRows {
+		for c, key := range row {
+			positions[key] = [2]int{r, c}
+		}
+	}
+	return positions
+}()
+
+var datePatterns = []*regexp.Regexp{
+	// YYYY-MM-DD
+	regexp.MustCompile(`(19|20)\d\d[-./]?(0[1-9]|1[0-2])[-./]?(0[1-9]|[12]\d|3[01])`),
+	// DD-MM-YYYY and MM-DD-YYYY
+	regexp.MustCompile(`(0[1-9]|[12]\d|3[01])[-./]?(0[1-9]|[12]\d|3[01])[-./]?(19|20)\d\d`),
+}
+
+var yearPattern = regexp.MustCompile(`(^|\D)(19[5-9]\d|20[0-4]\d)($|\D)`)
+
+// PasswordAnalysis contains lightweight statistics of a password
+type PasswordAnalysis struct {
+	// Length in characters
+	Length int
+	// Entropy estimate in bits, based on the character classes used
+	Entropy float64
+	// Character classes: lower, upper, digit, symbol and other
+	Charset []string
+	// Detected patterns
+	Patterns []string
+}
+
+// AnalyzePassword computes statistics of a password
+func AnalyzePassword(password string) PasswordAnalysis {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	a := PasswordAnalysis{Length: utf8.RuneCountInString(password)}
+	pool := 0
+	for _, class := range []struct {
+		name string
+		used bool
+		size int
+	}{
+		{"lower", lower, 26},
+		{"upper", upper, 26},
+		{"digit", digit, 10},
+		{"symbol", symbol, 33},
+		{"other", other, 100},
+	} {
+		if class.used {
+			a.Charset = append(a.Charset, class.name)
+			pool += class.size
+		}
+	}
+	if pool > 0 {
+		a.Entropy = math.Round(float64(a.Length)*math.Log2(float64(pool))*10) / 10
+	}
+
+	a.Patterns = passwordPatterns(password)
+	return a
+}
+
+// passwordPatterns returns the patterns found in a password
+func passwordPatterns(password string) []string {
+	var patterns []string
+	runes := []rune(strings.ToLower(password))
+
+	if longestRun(runes, keysAdjacent) >= minPatternRun {
+		patterns = append(patterns, PatternKeyboardWalk)
+	}
+	// A full date is reported instead of the year it contains
+	if matchesDate(password) {
+		patterns = append(patterns, PatternDate)
+	} else if yearPattern.MatchString(password) {
+		patterns = append(patterns, PatternYear)
+	}
+	if longestRun(runes, func(a, b rune) bool { return b-a == 1 }) >= minPatternRun ||
+		longestRun(runes, func(a, b rune) bool { return a-b == 1 }) >= minPatternRun {
+		patterns = append(patterns, PatternSequence)
+	}
+	if longestRun(runes, func(a, b rune) bool { return a == b }) >= minPatternRun {
+		patterns = append(patterns, PatternRepeat)
+	}
+	return patterns
+}
+
+// matchesDate reports whether a password contains a date
+func matchesDate(password string) bool {
+	for _, re := range datePatterns {
+		if re.MatchString(password) {
+			return true
+		}
+	}
+	return false
+}
+
+// longestRun returns the length of the longest run of characters in which
+// every pair of neighbours satisfies next
+func longestRun(runes []rune, next func(a, b rune) bool) int {
+	if len(runes) == 0 {
+		return 0
+	}
+	longest, run := 1, 1
+	for i := 1; i < len(runes); i++ {
+		if next(runes[i-1], runes[i]) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
+
+// keysAdjacent reports whether two different keys are neighbours on the
+// keyboard, horizontally, vertically or diagonally
+func keysAdjacent(a, b rune) bool {
+	pa, ok := keyPositions[a]
+	if !ok {
+		return false
+	}
+	pb, ok := keyPositions[b]
+	if !ok || a == b {
+		return false
+	}
+	dr, dc := pb[0]-pa[0], pb[1]-pa[1]
+	return dr >= -1 && dr <= 1 && dc >= -1 && dc <= 1
+}
+
+// PasswordAnalyzer adds password statistics to authentication attempts
+type PasswordAnalyzer struct{}
+
+// Process adds the password_length, password_entropy, password_charset
+// and password_patterns fields
+func (PasswordAnalyzer) Process(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	if _, ok := event.Get("password"); !ok {
+		return
+	}
+
+	a := AnalyzePassword(event.GetString("password"))
+	event.Set("password_length", a.Length)
+	event.Set("password_entropy", a.Entropy)
+	if len(a.Charset) > 0 {
+		event.Set("password_charset", a.Charset)
+	}
+	if len(a.Patterns) > 0 {
+		event.Set("password_patterns", a.Patterns)
+	}
+}
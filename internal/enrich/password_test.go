@@ -0,0 +1,62 @@
+package enrich
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestAnalyzePassword(t *testing.T) {
+	tests := []struct {
+		password string
+		length   int
+		entropy  float64
+		charset  []string
+		patterns []string
+	}{
+		{"", 0, 0, nil, nil},
+		{"admin", 5, 23.5, []string{"lower"}, nil},
+		{"qwerty", 6, 28.2, []string{"lower"}, []string{PatternKeyboardWalk}},
+		{"1qaz2wsx", 8, 41.4, []string{"lower", "digit"}, []string{PatternKeyboardWalk}},
+		{"123456", 6, 19.9, []string{"digit"}, []string{PatternKeyboardWalk, PatternSequence}},
+		{"19870412", 8, 26.6, []string{"digit"}, []string{PatternDate}},
+		{"Summer2023!", 11, 72.3, []string{"lower", "upper", "digit", "symbol"}, []string{PatternYear}},
+		{"aaaaaa", 6, 28.2, []string{"lower"}, []string{PatternRepeat}},
+		{"dcba", 4, 18.8, []string{"lower"}, []string{PatternSequence}},
+		{"пароль", 6, 39.9, []string{"other"}, nil},
+	}
+	for _, tt := range tests {
+		a := AnalyzePassword(tt.password)
+		if a.Length != tt.length {
+			t.Errorf("%q: expected length %d, got %d", tt.password, tt.length, a.Length)
+		}
+		if a.Entropy != tt.entropy {
+			t.Errorf("%q: expected entropy %.1f, got %.1f", tt.password, tt.entropy, a.Entropy)
+		}
+		if !reflect.DeepEqual(a.Charset, tt.charset) {
+			t.Errorf("%q: expected charset %v, got %v", tt.password, tt.charset, a.Charset)
+		}
+		if !reflect.DeepEqual(a.Patterns, tt.patterns) {
+			t.Errorf("%q: expected patterns %v, got %v", tt.password, tt.patterns, a.Patterns)
+		}
+	}
+}
+
+func TestPasswordAnalyzerProcess(t *testing.T) {
+	event := logger.NewAuthEvent(logger.CredentialAttempt{Username: "root", Password: "qwerty"})
+	PasswordAnalyzer{}.Process(event)
+
+	if got, _ := event.Get("password_length"); got != 6 {
+		t.Errorf("Expected password_length 6, got %v", got)
+	}
+	if got, _ := event.Get("password_patterns"); !reflect.DeepEqual(got, []string{PatternKeyboardWalk}) {
+		t.Errorf("Expected keyboard walk pattern, got %v", got)
+	}
+
+	other := &logger.Event{Type: "session"}
+	PasswordAnalyzer{}.Process(other)
+	if len(other.Fields) != 0 {
+		t.Errorf("Expected other events to be left alone, got %v", other.Fields)
+	}
+}
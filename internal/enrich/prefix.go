@@ -0,0 +1,92 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"net/netip"
+)
+
+// prefixTrie is a binary trie of IP networks, used to find the networks
+// an address belongs to
+type prefixTrie[V any] struct {
+	v4    *trieNode[V]
+	v6    *trieNode[V]
+	count int
+}
+
+type trieNode[V any] struct {
+	children [2]*trieNode[V]
+	values   []V
+}
+
+// newPrefixTrie creates an empty trie
+func newPrefixTrie[V any]() *prefixTrie[V] {
+	return &prefixTrie[V]{
+		v4: &trieNode[V]{},
+		v6: &trieNode[V]{},
+	}
+}
+
+// insert adds a network with a value
+func (t *prefixTrie[V]) insert(prefix netip.Prefix, value V) {
+	prefix = prefix.Masked()
+	addr := prefix.Addr().Unmap()
+	node := t.root(addr)
+	bytes := addr.AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := bytes[i/8] >> (7 - i%8) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &trieNode[V]{}
+		}
+		node = node.children[bit]
+	}
+	node.values = append(node.values, value)
+	t.count++
+}
+
+// lookup returns the values of all networks containing addr, from the
+// least to the most specific network
+func (t *prefixTrie[V]) lookup(addr netip.Addr) []V {
+	addr = addr.Unmap()
+	node := t.root(addr)
+	bytes := addr.AsSlice()
+
+	var values []V
+	for i := 0; node != nil; i++ {
+		values = append(values, node.values...)
+		if i == len(bytes)*8 {
+			break
+		}
+		node = node.children[bytes[i/8]>>(7-i%8)&1]
+	}
+	return values
+}
+
+// len returns the number of inserted networks
+func (t *prefixTrie[V]) len() int {
+	return t.count
+}
+
+func (t *prefixTrie[V]) root(addr netip.Addr) *trieNode[V] {
+	if addr.Is4() {
+		return t.v4
+	}
+	return t.v6
+}
@@ -0,0 +1,36 @@
+package enrich
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestPrefixTrie(t *testing.T) {
+	trie := newPrefixTrie[string]()
+	trie.insert(netip.MustParsePrefix("10.0.0.0/8"), "wide")
+	trie.insert(netip.MustParsePrefix("10.1.0.0/16"), "narrow")
+	trie.insert(netip.MustParsePrefix("192.0.2.7/32"), "host")
+	trie.insert(netip.MustParsePrefix("2001:db8::/32"), "v6")
+	trie.insert(netip.MustParsePrefix("0.0.0.0/0"), "all")
+
+	tests := map[string][]string{
+		"10.1.2.3":        {"all", "wide", "narrow"},
+		"10.2.0.1":        {"all", "wide"},
+		"192.0.2.7":       {"all", "host"},
+		"192.0.2.8":       {"all"},
+		"::ffff:10.1.0.1": {"all", "wide", "narrow"},
+		"2001:db8:1::1":   {"v6"},
+		"2001:db9::1":     nil,
+	}
+	for addr, expected := range tests {
+		got := trie.lookup(netip.MustParseAddr(addr))
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("lookup(%s): expected %v, got %v", addr, expected, got)
+		}
+	}
+
+	if trie.len() != 5 {
+		t.Errorf("Expected 5 networks, got %d", trie.len())
+	}
+}
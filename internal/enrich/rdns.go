@@ -0,0 +1,87 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// RDNSConfig contains settings of the reverse DNS enricher
+type RDNSConfig struct {
+	// Maximum number of concurrent lookups
+	Concurrency int
+	// Timeout of a single lookup
+	Timeout time.Duration
+	// Shared cache of results, a private in-memory cache is used if nil
+	Cache *Cache
+	// How long results are cached
+	CacheTTL time.Duration
+}
+
+// RDNS enriches events with the PTR record of the source address. Lookups
+// run in the background, so the first events of a new address are written
+// without the hostname.
+type RDNS struct {
+	lookup *asyncLookup[netip.Addr, string]
+}
+
+// NewRDNS creates a reverse DNS enricher using the system resolver
+func NewRDNS(cfg RDNSConfig) *RDNS {
+	return newRDNS(cfg, net.DefaultResolver.LookupAddr)
+}
+
+// newRDNS creates a reverse DNS enricher with the given resolver function
+func newRDNS(cfg RDNSConfig, lookupAddr func(ctx context.Context, addr string) ([]string, error)) *RDNS {
+	resolve := func(ctx context.Context, ip netip.Addr) (string, error) {
+		names, err := lookupAddr(ctx, ip.String())
+		if err != nil || len(names) == 0 {
+			return "", err
+		}
+		return strings.TrimSuffix(names[0], "."), nil
+	}
+
+	cache := newCacheNamespace[string](cfg.Cache, "rdns", cfg.CacheTTL)
+	return &RDNS{
+		lookup: newAsyncLookup("reverse DNS", cfg.Concurrency, cfg.Timeout, cache, resolve),
+	}
+}
+
+// Process adds the rdns field if the hostname of the source is known
+func (r *RDNS) Process(event *logger.Event) {
+	ip, ok := remoteIP(event)
+	if !ok {
+		return
+	}
+	if name, ok := r.lookup.get(ip); ok && name != "" {
+		event.Set("rdns", name)
+	}
+}
+
+// Close waits for running lookups to finish
+func (r *RDNS) Close() error {
+	r.lookup.wait()
+	return nil
+}
@@ -0,0 +1,113 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/privacy"
+)
+
+func TestRDNSProcess(t *testing.T) {
+	var calls atomic.Int32
+	resolver := func(ctx context.Context, addr string) ([]string, error) {
+		calls.Add(1)
+		switch addr {
+		case "203.0.113.10":
+			return []string{"scanner.example.net."}, nil
+		default:
+			return nil, errors.New("no such host")
+		}
+	}
+
+	r := newRDNS(RDNSConfig{Concurrency: 4, Timeout: time.Second, CacheTTL: time.Hour}, resolver)
+	defer r.Close()
+
+	// The first event starts the lookup and is not delayed by it
+	event := logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "203.0.113.10:40000"})
+	r.Process(event)
+	if _, ok := event.Get("rdns"); ok {
+		t.Errorf("Expected no rdns field before the lookup finished")
+	}
+	r.lookup.wait()
+
+	event = logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "203.0.113.10:40001"})
+	r.Process(event)
+	if got := event.GetString("rdns"); got != "scanner.example.net" {
+		t.Errorf("Expected rdns 'scanner.example.net', got '%s'", got)
+	}
+
+	// Failed lookups are cached too
+	for i := 0; i < 3; i++ {
+		event = logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "192.0.2.1:40000"})
+		r.Process(event)
+		r.lookup.wait()
+		if _, ok := event.Get("rdns"); ok {
+			t.Errorf("Expected no rdns field for unresolvable address")
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Expected 2 lookups, got %d", got)
+	}
+}
+
+func TestRDNSConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	resolver := func(ctx context.Context, addr string) ([]string, error) {
+		calls.Add(1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return []string{"host.example.net"}, nil
+	}
+
+	r := newRDNS(RDNSConfig{Concurrency: 1, Timeout: time.Second, CacheTTL: time.Hour}, resolver)
+
+	for _, addr := range []string{"192.0.2.1:1", "192.0.2.1:2", "192.0.2.2:1"} {
+		r.Process(logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: addr}))
+	}
+	close(release)
+	r.Close()
+
+	// The second address was skipped while the single worker was busy
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected 1 lookup, got %d", got)
+	}
+}
+
+func TestRDNSAnonymized(t *testing.T) {
+	resolver := func(ctx context.Context, addr string) ([]string, error) {
+		return []string{"scanner.example.net."}, nil
+	}
+	r := newRDNS(RDNSConfig{Concurrency: 1, Timeout: time.Second, CacheTTL: time.Hour}, resolver)
+	defer r.Close()
+
+	for _, mode := range []string{privacy.IPTruncate, privacy.IPCryptoPAn} {
+		anonymizer, err := privacy.NewIPAnonymizer(mode, []byte("test-key"))
+		if err != nil {
+			t.Fatalf("Failed to create anonymizer: %v", err)
+		}
+
+		// Enrichers run before the privacy processors, as in the server
+		pipeline := &logger.Pipeline{}
+		pipeline.AddProcessor(r)
+		pipeline.AddProcessor(anonymizer)
+
+		pipeline.Process(logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "203.0.113.10:40000"}))
+		r.lookup.wait()
+
+		event := logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "203.0.113.10:40001"})
+		pipeline.Process(event)
+		if got := event.GetString("remote_addr"); got == "203.0.113.10:40001" {
+			t.Errorf("%s: expected anonymized remote_addr, got '%s'", mode, got)
+		}
+		if got, ok := event.Get("rdns"); ok {
+			t.Errorf("%s: expected no rdns field, got '%v'", mode, got)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// ReputationConfig contains settings shared by the reputation enrichers
+type ReputationConfig struct {
+	// API key of the service
+	APIKey string
+	// Maximum number of concurrent queries
+	Concurrency int
+	// Timeout of a single query
+	Timeout time.Duration
+	// Shared cache of results, a private in-memory cache is used if nil
+	Cache *Cache
+	// How long results are cached
+	CacheTTL time.Duration
+}
+
+// reputationClient is used to query the reputation services
+var reputationClient = &http.Client{}
+
+// getJSON sends a GET request and decodes the JSON response into result.
+// It returns false if the service does not know the address.
+func getJSON(ctx context.Context, rawURL string, header http.Header, result interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header = header
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := reputationClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return true, nil
+}
+
+// publicIP reports whether an address is worth looking up in a public
+// reputation service
+func publicIP(ip netip.Addr) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+// AbuseIPDBResult is the reputation of an address reported by AbuseIPDB
+type AbuseIPDBResult struct {
+	Found bool
+	// Confidence that the address is abusive, 0 to 100
+	Score int
+	// Number of reports in the checked period
+	Reports int
+}
+
+// AbuseIPDB enriches events with the AbuseIPDB confidence score of the
+// source. Queries run in the background, so the first events of a new
+// address are written without the score.
+type AbuseIPDB struct {
+	baseURL    string
+	apiKey     string
+	maxAgeDays int
+	lookup     *asyncLookup[netip.Addr, AbuseIPDBResult]
+}
+
+// NewAbuseIPDB creates an AbuseIPDB enricher checking reports of the last
+// maxAgeDays days
+func NewAbuseIPDB(cfg ReputationConfig, maxAgeDays int) *AbuseIPDB {
+	a := &AbuseIPDB{
+		baseURL:    "https://api.abuseipdb.com/api/v2",
+		apiKey:     cfg.APIKey,
+		maxAgeDays: maxAgeDays,
+	}
+	cache := newCacheNamespace[AbuseIPDBResult](cfg.Cache, "abuseipdb", cfg.CacheTTL)
+	a.lookup = newAsyncLookup("AbuseIPDB", cfg.Concurrency, cfg.Timeout, cache, a.query)
+	return a
+}
+
+// query checks an address with the AbuseIPDB API
+func (a *AbuseIPDB) query(ctx context.Context, ip netip.Addr) (AbuseIPDBResult, error) {
+	params := url.Values{}
+	params.Set("ipAddress", ip.String())
+	params.Set("maxAgeInDays", strconv.Itoa(a.maxAgeDays))
+
+	var resp struct {
+		Data struct {
+			AbuseConfidenceScore int `json:"abuseConfidenceScore"`
+			TotalReports         int `json:"totalReports"`
+		} `json:"data"`
+	}
+	found, err := getJSON(ctx, a.baseURL+"/check?"+params.Encode(), http.Header{"Key": {a.apiKey}}, &resp)
+	if err != nil || !found {
+		return AbuseIPDBResult{}, err
+	}
+	return AbuseIPDBResult{
+		Found:   true,
+		Score:   resp.Data.AbuseConfidenceScore,
+		Reports: resp.Data.TotalReports,
+	}, nil
+}
+
+// Process adds the abuseipdb_score and abuseipdb_reports fields if the
+// reputation of the source is known
+func (a *AbuseIPDB) Process(event *logger.Event) {
+	ip, ok := remoteIP(event)
+	if !ok || !publicIP(ip) {
+		return
+	}
+	if result, ok := a.lookup.get(ip); ok && result.Found {
+		event.Set("abuseipdb_score", result.Score)
+		event.Set("abuseipdb_reports", result.Reports)
+	}
+}
+
+// Close waits for running queries to finish
+func (a *AbuseIPDB) Close() error {
+	a.lookup.wait()
+	return nil
+}
+
+// GreyNoiseResult is the classification of an address by GreyNoise
+type GreyNoiseResult struct {
+	Found bool
+	// "benign", "malicious" or "unknown"
+	Classification string
+	// Address is seen scanning the internet
+	Noise bool
+	// Address belongs to a common business service
+	RIOT bool
+}
+
+// GreyNoise enriches events with the GreyNoise community classification
+// of the source, which separates internet background noise from targeted
+// attacks. Queries run in the background like those of AbuseIPDB.
+type GreyNoise struct {
+	baseURL string
+	apiKey  string
+	lookup  *asyncLookup[netip.Addr, GreyNoiseResult]
+}
+
+// NewGreyNoise creates a GreyNoise enricher. The API key is optional for
+// the community API, which is rate limited without it.
+func NewGreyNoise(cfg ReputationConfig) *GreyNoise {
+	g := &GreyNoise{
+		baseURL: "https://api.greynoise.io/v3/community",
+		apiKey:  cfg.APIKey,
+	}
+	cache := newCacheNamespace[GreyNoiseResult](cfg.Cache, "greynoise", cfg.CacheTTL)
+	g.lookup = newAsyncLookup("GreyNoise", cfg.Concurrency, cfg.Timeout, cache, g.query)
+	return g
+}
+
+// query checks an address with the GreyNoise community API
+func (g *GreyNoise) query(ctx context.Context, ip netip.Addr) (GreyNoiseResult, error) {
+	header := http.Header{}
+	if g.apiKey != "" {
+		header.Set("Key", g.apiKey)
+	}
+
+	var resp struct {
+		Noise          bool   `json:"noise"`
+		RIOT           bool   `json:"riot"`
+		Classification string `json:"classification"`
+	}
+	found, err := getJSON(ctx, g.baseURL+"/"+ip.String(), header, &resp)
+	if err != nil || !found {
+		return GreyNoiseResult{}, err
+	}
+	return GreyNoiseResult{
+		Found:          true,
+		Classification: resp.Classification,
+		Noise:          resp.Noise,
+		RIOT:           resp.RIOT,
+	}, nil
+}
+
+// Process adds the greynoise_classification, greynoise_noise and
+// greynoise_riot fields if GreyNoise has seen the source
+func (g *GreyNoise) Process(event *logger.Event) {
+	ip, ok := remoteIP(event)
+	if !ok || !publicIP(ip) {
+		return
+	}
+	if result, ok := g.lookup.get(ip); ok && result.Found {
+		if result.Classification != "" {
+			event.Set("greynoise_classification", result.Classification)
+		}
+		event.Set("greynoise_noise", result.Noise)
+		event.Set("greynoise_riot", result.RIOT)
+	}
+}
+
+// Close waits for running queries to finish
+func (g *GreyNoise) Close() error {
+	g.lookup.wait()
+	return nil
+}
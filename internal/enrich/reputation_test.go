@@ -0,0 +1,110 @@
+package enrich
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+var testReputationConfig = ReputationConfig{
+	APIKey:      "test-key",
+	Concurrency: 2,
+	Timeout:     time.Second,
+	CacheTTL:    time.Hour,
+}
+
+func TestAbuseIPDBProcess(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("Key") != "test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/check" || r.URL.Query().Get("maxAgeInDays") != "30" {
+			t.Errorf("Unexpected request: %s", r.URL)
+		}
+		if r.URL.Query().Get("ipAddress") == "203.0.113.10" {
+			w.Write([]byte(`{"data":{"ipAddress":"203.0.113.10","abuseConfidenceScore":87,"totalReports":12}}`))
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	a := NewAbuseIPDB(testReputationConfig, 30)
+	a.baseURL = server.URL
+	defer a.Close()
+
+	for i := 0; i < 2; i++ {
+		a.Process(logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "203.0.113.10:40000"}))
+		a.lookup.wait()
+	}
+	event := logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "203.0.113.10:40001"})
+	a.Process(event)
+	if got, _ := event.Get("abuseipdb_score"); got != 87 {
+		t.Errorf("Expected score 87, got %v", got)
+	}
+	if got, _ := event.Get("abuseipdb_reports"); got != 12 {
+		t.Errorf("Expected 12 reports, got %v", got)
+	}
+
+	// Failed queries add no fields
+	event = logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "198.51.100.1:40000"})
+	a.Process(event)
+	a.lookup.wait()
+	a.Process(event)
+	if _, ok := event.Get("abuseipdb_score"); ok {
+		t.Errorf("Expected no score after failed query")
+	}
+
+	// Private addresses are never sent to the service
+	a.Process(logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "10.0.0.1:40000"}))
+	a.lookup.wait()
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Expected 2 queries, got %d", got)
+	}
+}
+
+func TestGreyNoiseProcess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/") {
+		case "203.0.113.10":
+			w.Write([]byte(`{"ip":"203.0.113.10","noise":true,"riot":false,"classification":"malicious","name":"unknown"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"ip":"198.51.100.1","noise":false,"riot":false,"message":"IP not observed scanning the internet or contained in RIOT data set."}`))
+		}
+	}))
+	defer server.Close()
+
+	g := NewGreyNoise(testReputationConfig)
+	g.baseURL = server.URL
+	defer g.Close()
+
+	for _, addr := range []string{"203.0.113.10:1", "198.51.100.1:1"} {
+		g.Process(logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: addr}))
+	}
+	g.lookup.wait()
+
+	event := logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "203.0.113.10:2"})
+	g.Process(event)
+	if got := event.GetString("greynoise_classification"); got != "malicious" {
+		t.Errorf("Expected classification 'malicious', got '%s'", got)
+	}
+	if got, _ := event.Get("greynoise_noise"); got != true {
+		t.Errorf("Expected greynoise_noise true, got %v", got)
+	}
+
+	event = logger.NewAuthEvent(logger.CredentialAttempt{RemoteAddr: "198.51.100.1:2"})
+	g.Process(event)
+	if _, ok := event.Get("greynoise_classification"); ok {
+		t.Errorf("Expected no classification for unknown address")
+	}
+}
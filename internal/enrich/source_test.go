@@ -0,0 +1,61 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestParsePrefixList(t *testing.T) {
+	data := []byte(`# comment
+192.0.2.0/24 ; SBL123
+198.51.100.7
+2001:db8::/32,NL,NL-NH,Amsterdam,
+
+	203.0.113.0/25	extra
+`)
+	prefixes, err := parsePrefixList(data)
+	if err != nil {
+		t.Fatalf("Failed to parse list: %v", err)
+	}
+
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("198.51.100.7/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("203.0.113.0/25"),
+	}
+	if !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("Expected %v, got %v", expected, prefixes)
+	}
+
+	if _, err := parsePrefixList([]byte("192.0.2.0/24\nnot-a-network\n")); err == nil {
+		t.Errorf("Expected error for invalid network")
+	}
+}
+
+func TestReadSourceURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/list.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("192.0.2.0/24\n"))
+	}))
+	defer server.Close()
+
+	data, err := readSource(context.Background(), server.URL+"/list.txt")
+	if err != nil {
+		t.Fatalf("Failed to read source: %v", err)
+	}
+	if string(data) != "192.0.2.0/24\n" {
+		t.Errorf("Unexpected contents: %q", data)
+	}
+
+	if _, err := readSource(context.Background(), server.URL+"/missing"); err == nil {
+		t.Errorf("Expected error for missing list")
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package enrich
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/rs/zerolog/log"
+)
+
+// Kinds of password sprays
+const (
+	// One password tried with many usernames
+	SprayPassword = "password"
+	// One username tried from many source addresses
+	SprayUsername = "username"
+)
+
+// maxSpraySources limits the source addresses listed in a spray event
+const maxSpraySources = 100
+
+// SprayConfig contains settings of the password spray detection
+type SprayConfig struct {
+	// Window in which the attempts of a spray are counted
+	Window time.Duration
+	// Distinct usernames a password is tried with to be a spray
+	MinUsernames int
+	// Distinct sources a username is tried from to be a spray
+	MinSources int
+	// Maximum number of tracked passwords and usernames each
+	MaxEntries int
+}
+
+// sprayState counts the attempts sharing a password or username
+type sprayState struct {
+	start     time.Time
+	attempts  int
+	usernames map[string]struct{}
+	sources   map[string]struct{}
+	listed    []string
+	reported  bool
+}
+
+// SprayDetector emits a "password_spray" event when one password is tried
+// with many usernames, or one username from many sources, within a window.
+// Each password or username is reported at most once per window.
+type SprayDetector struct {
+	config   SprayConfig
+	logEvent func(event *logger.Event) error
+
+	mu        sync.Mutex
+	passwords *lruCache[string, *sprayState]
+	usernames *lruCache[string, *sprayState]
+}
+
+// NewSprayDetector creates a detector passing spray events to logEvent,
+// usually the LogEvent method of the credentials logger
+func NewSprayDetector(config SprayConfig, logEvent func(event *logger.Event) error) *SprayDetector {
+	return &SprayDetector{
+		config:    config,
+		logEvent:  logEvent,
+		passwords: newLRUCache[string, *sprayState](config.MaxEntries, config.Window),
+		usernames: newLRUCache[string, *sprayState](config.MaxEntries, config.Window),
+	}
+}
+
+// Process counts an authentication attempt and emits the sprays it completes
+func (d *SprayDetector) Process(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	username := event.GetString("username")
+	password := event.GetString("password")
+	source := event.GetString("remote_addr")
+	if host, _, err := net.SplitHostPort(source); err == nil {
+		source = host
+	}
+	attempts := 1
+	if v, ok := event.Get("count"); ok {
+		if n, ok := v.(int); ok && n > 0 {
+			attempts = n
+		}
+	}
+
+	var sprays []*logger.Event
+	d.mu.Lock()
+	if s := d.observe(d.passwords, password, username, source, attempts, event.Time); len(s.usernames) >= d.config.MinUsernames && !s.reported {
+		s.reported = true
+		sprays = append(sprays, d.event(SprayPassword, password, s, event.Time))
+	}
+	if s := d.observe(d.usernames, username, username, source, attempts, event.Time); len(s.sources) >= d.config.MinSources && !s.reported {
+		s.reported = true
+		sprays = append(sprays, d.event(SprayUsername, username, s, event.Time))
+	}
+	d.mu.Unlock()
+
+	for _, spray := range sprays {
+		log.Info().Str("spray_type", spray.GetString("spray_type")).Msg("password spray detected")
+		if err := d.logEvent(spray); err != nil {
+			log.Warn().Err(err).Msg("password spray event logging error")
+		}
+	}
+}
+
+// observe counts an attempt in the state of key, starting a new window
+// when the previous one ended
+func (d *SprayDetector) observe(cache *lruCache[string, *sprayState], key, username, source string, attempts int, at time.Time) *sprayState {
+	s, ok := cache.get(key)
+	if !ok || at.Sub(s.start) >= d.config.Window {
+		s = &sprayState{
+			start:     at,
+			usernames: make(map[string]struct{}),
+			sources:   make(map[string]struct{}),
+		}
+	}
+	s.attempts += attempts
+	if len(s.usernames) < maxDistinct {
+		s.usernames[username] = struct{}{}
+	}
+	if _, seen := s.sources[source]; !seen && len(s.sources) < maxDistinct {
+		s.sources[source] = struct{}{}
+		if len(s.listed) < maxSpraySources {
+			s.listed = append(s.listed, source)
+		}
+	}
+	cache.addUntil(key, s, s.start.Add(d.config.Window))
+	return s
+}
+
+// event creates the event reporting a spray
+func (d *SprayDetector) event(kind, value string, s *sprayState, at time.Time) *logger.Event {
+	event := &logger.Event{
+		Time:    at,
+		Type:    "password_spray",
+		Message: fmt.Sprintf("%s spray", kind),
+	}
+	event.Set("spray_type", kind)
+	event.Set("spray_value", value)
+	event.Set("attempts", s.attempts)
+	event.Set("distinct_usernames", len(s.usernames))
+	event.Set("distinct_sources", len(s.sources))
+	event.Set("sources", append([]string(nil), s.listed...))
+	event.Set("window_start", s.start.UTC().Format(time.RFC3339))
+	return event
+}
@@ -0,0 +1,85 @@
+package enrich
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func sprayAttempt(addr, username, password string, at time.Time) *logger.Event {
+	return logger.NewAuthEvent(logger.CredentialAttempt{
+		Timestamp:  at,
+		RemoteAddr: addr,
+		Username:   username,
+		Password:   password,
+	})
+}
+
+func TestSprayDetectorPassword(t *testing.T) {
+	var events []*logger.Event
+	d := NewSprayDetector(SprayConfig{Window: time.Hour, MinUsernames: 3, MinSources: 100, MaxEntries: 100},
+		func(e *logger.Event) error { events = append(events, e); return nil })
+
+	now := time.Now()
+	for i, user := range []string{"root", "admin", "root", "oracle", "postgres"} {
+		d.Process(sprayAttempt(fmt.Sprintf("192.0.2.%d:4000", i%2+1), user, "Summer2024!", now))
+	}
+	d.Process(sprayAttempt("192.0.2.1:4000", "root", "123456", now))
+
+	if len(events) != 1 {
+		t.Fatalf("Expected one spray event, got %d", len(events))
+	}
+	e := events[0]
+	if e.Type != "password_spray" || e.GetString("spray_type") != SprayPassword || e.GetString("spray_value") != "Summer2024!" {
+		t.Errorf("Unexpected event: %+v", e.Fields)
+	}
+	if v, _ := e.Get("distinct_usernames"); v != 3 {
+		t.Errorf("distinct_usernames = %v, want 3", v)
+	}
+	if v, _ := e.Get("attempts"); v != 4 {
+		t.Errorf("attempts = %v, want 4", v)
+	}
+	if v, _ := e.Get("sources"); len(v.([]string)) != 2 {
+		t.Errorf("sources = %v, want both addresses", v)
+	}
+}
+
+func TestSprayDetectorUsername(t *testing.T) {
+	var events []*logger.Event
+	d := NewSprayDetector(SprayConfig{Window: time.Hour, MinUsernames: 100, MinSources: 3, MaxEntries: 100},
+		func(e *logger.Event) error { events = append(events, e); return nil })
+
+	now := time.Now()
+	for i := 1; i <= 5; i++ {
+		d.Process(sprayAttempt(fmt.Sprintf("198.51.100.%d:22", i), "deploy", fmt.Sprintf("pass%d", i), now))
+	}
+
+	if len(events) != 1 || events[0].GetString("spray_type") != SprayUsername || events[0].GetString("spray_value") != "deploy" {
+		t.Fatalf("Expected one username spray event, got %d", len(events))
+	}
+	if v, _ := events[0].Get("distinct_sources"); v != 3 {
+		t.Errorf("distinct_sources = %v, want 3", v)
+	}
+}
+
+func TestSprayDetectorWindow(t *testing.T) {
+	var events []*logger.Event
+	d := NewSprayDetector(SprayConfig{Window: time.Minute, MinUsernames: 2, MinSources: 100, MaxEntries: 100},
+		func(e *logger.Event) error { events = append(events, e); return nil })
+
+	now := time.Now()
+	d.Process(sprayAttempt("192.0.2.1:1", "root", "x", now.Add(-2*time.Minute)))
+	d.Process(sprayAttempt("192.0.2.1:1", "admin", "x", now))
+	if len(events) != 0 {
+		t.Errorf("Expected attempts in different windows not to be a spray, got %d events", len(events))
+	}
+
+	// Further attempts of a reported spray are not reported again
+	d.Process(sprayAttempt("192.0.2.1:1", "oracle", "x", now))
+	d.Process(sprayAttempt("192.0.2.1:1", "ubuntu", "x", now))
+	if len(events) != 1 {
+		t.Errorf("Expected one spray event per window, got %d", len(events))
+	}
+}
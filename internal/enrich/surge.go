@@ -0,0 +1,188 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package enrich
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/rs/zerolog/log"
+)
+
+// SurgeConfig contains settings of the attack surge detection
+type SurgeConfig struct {
+	// Length of the intervals attempts are counted in
+	Interval time.Duration
+	// Period of the rolling baseline, the mean count of its intervals
+	Baseline time.Duration
+	// An interval is a surge when its count exceeds this multiple of the baseline
+	Multiplier float64
+	// Attempts an interval needs at least to be a surge
+	MinAttempts int
+}
+
+// SurgeDetector emits an "attack_surge" event when the attempts of an
+// interval exceed a multiple of the rolling baseline. A surge is reported
+// once, and ends with the first interval below the threshold. Surges are
+// detected once a full baseline period was observed.
+type SurgeDetector struct {
+	config   SurgeConfig
+	logEvent func(event *logger.Event) error
+
+	mu       sync.Mutex
+	history  []int
+	next     int
+	filled   int
+	current  time.Time
+	count    int
+	sources  map[string]struct{}
+	surging  bool
+	reported bool
+}
+
+// NewSurgeDetector creates a detector passing surge events to logEvent,
+// usually the LogEvent method of the credentials logger
+func NewSurgeDetector(config SurgeConfig, logEvent func(event *logger.Event) error) *SurgeDetector {
+	intervals := int(config.Baseline / config.Interval)
+	if intervals < 1 {
+		intervals = 1
+	}
+	return &SurgeDetector{
+		config:   config,
+		logEvent: logEvent,
+		history:  make([]int, intervals),
+		sources:  make(map[string]struct{}),
+	}
+}
+
+// Process counts an authentication attempt and emits the surge it starts
+func (d *SurgeDetector) Process(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	attempts := 1
+	if v, ok := event.Get("count"); ok {
+		if n, ok := v.(int); ok && n > 0 {
+			attempts = n
+		}
+	}
+	source := event.GetString("remote_addr")
+	if host, _, err := net.SplitHostPort(source); err == nil {
+		source = host
+	}
+
+	d.mu.Lock()
+	d.advance(event.Time.Truncate(d.config.Interval))
+	d.count += attempts
+	if len(d.sources) < maxDistinct {
+		d.sources[source] = struct{}{}
+	}
+	var surge *logger.Event
+	count := d.count
+	baseline, ready := d.baseline()
+	if ready && !d.reported && float64(d.count) > d.threshold(baseline) {
+		d.surging, d.reported = true, true
+		surge = d.event(baseline, event.Time)
+	}
+	d.mu.Unlock()
+
+	if surge != nil {
+		log.Warn().Int("attempts", count).Msg("attack surge detected")
+		if err := d.logEvent(surge); err != nil {
+			log.Warn().Err(err).Msg("attack surge event logging error")
+		}
+	}
+}
+
+// advance moves to the interval starting at start, recording the counts
+// of the finished intervals
+func (d *SurgeDetector) advance(start time.Time) {
+	if d.current.IsZero() {
+		d.current = start
+		return
+	}
+	if !start.After(d.current) {
+		return
+	}
+
+	baseline, ready := d.baseline()
+	if d.surging && (!ready || float64(d.count) <= d.threshold(baseline)) {
+		d.surging = false
+		log.Info().Msg("attack surge ended")
+	}
+	d.record(d.count)
+
+	// Intervals without attempts count as zero
+	gaps := int(start.Sub(d.current)/d.config.Interval) - 1
+	for i := 0; i < gaps && i < len(d.history); i++ {
+		d.record(0)
+	}
+	d.current = start
+	d.count = 0
+	d.sources = make(map[string]struct{})
+	d.reported = d.surging
+}
+
+// record adds the count of a finished interval to the history
+func (d *SurgeDetector) record(count int) {
+	d.history[d.next] = count
+	d.next = (d.next + 1) % len(d.history)
+	if d.filled < len(d.history) {
+		d.filled++
+	}
+}
+
+// baseline returns the mean count of the recorded intervals, and whether a
+// full baseline period was observed
+func (d *SurgeDetector) baseline() (float64, bool) {
+	if d.filled < len(d.history) {
+		return 0, false
+	}
+	total := 0
+	for _, c := range d.history {
+		total += c
+	}
+	return float64(total) / float64(len(d.history)), true
+}
+
+// threshold returns the count above which an interval is a surge
+func (d *SurgeDetector) threshold(baseline float64) float64 {
+	return math.Max(baseline*d.config.Multiplier, float64(d.config.MinAttempts))
+}
+
+// event creates the event reporting a surge
+func (d *SurgeDetector) event(baseline float64, at time.Time) *logger.Event {
+	event := &logger.Event{
+		Time:    at,
+		Type:    "attack_surge",
+		Message: "attack surge",
+	}
+	event.Set("attempts", d.count)
+	event.Set("baseline", math.Round(baseline*10)/10)
+	if baseline > 0 {
+		event.Set("ratio", math.Round(float64(d.count)/baseline*10)/10)
+	}
+	event.Set("distinct_sources", len(d.sources))
+	event.Set("interval_seconds", int(d.config.Interval.Seconds()))
+	event.Set("interval_start", d.current.UTC().Format(time.RFC3339))
+	return event
+}
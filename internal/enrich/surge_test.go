@@ -0,0 +1,82 @@
+package enrich
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestSurgeDetector(t *testing.T) {
+	var events []*logger.Event
+	d := NewSurgeDetector(SurgeConfig{Interval: time.Minute, Baseline: 5 * time.Minute, Multiplier: 3, MinAttempts: 10},
+		func(e *logger.Event) error { events = append(events, e); return nil })
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	attempts := func(minute, n int) {
+		for i := 0; i < n; i++ {
+			at := start.Add(time.Duration(minute)*time.Minute + time.Duration(i)*time.Millisecond)
+			d.Process(sprayAttempt(fmt.Sprintf("192.0.2.%d:22", i%4+1), "root", "x", at))
+		}
+	}
+
+	// Surges are not detected before a full baseline period was observed
+	attempts(0, 50)
+	// Baseline of 5 intervals: 50, 10, 10, 0 (no attempts), 5
+	attempts(1, 10)
+	attempts(2, 10)
+	attempts(4, 5)
+	if len(events) != 0 {
+		t.Fatalf("Expected no surge during warm-up, got %d events", len(events))
+	}
+
+	// Baseline 15, threshold 45
+	attempts(5, 40)
+	if len(events) != 0 {
+		t.Fatalf("Expected no surge below the threshold, got %d events", len(events))
+	}
+
+	// Baseline (10+10+0+5+40)/5 = 13, threshold 39; the surge continues
+	// in the next interval without being reported again
+	attempts(6, 60)
+	attempts(7, 100)
+	if len(events) != 1 {
+		t.Fatalf("Expected one surge event, got %d", len(events))
+	}
+	e := events[0]
+	if e.Type != "attack_surge" {
+		t.Errorf("Type = %q", e.Type)
+	}
+	if v, _ := e.Get("attempts"); v != 40 {
+		t.Errorf("attempts = %v, want 40", v)
+	}
+	if v, _ := e.Get("baseline"); v != 13.0 {
+		t.Errorf("baseline = %v, want 13", v)
+	}
+	if v, _ := e.Get("distinct_sources"); v != 4 {
+		t.Errorf("distinct_sources = %v, want 4", v)
+	}
+
+	// A quiet interval ends the surge, and a later one is reported again
+	attempts(8, 1)
+	attempts(9, 500)
+	if len(events) != 2 {
+		t.Errorf("Expected a second surge after the first ended, got %d events", len(events))
+	}
+}
+
+func TestSurgeDetectorMinAttempts(t *testing.T) {
+	var events []*logger.Event
+	d := NewSurgeDetector(SurgeConfig{Interval: time.Minute, Baseline: time.Minute, Multiplier: 2, MinAttempts: 10},
+		func(e *logger.Event) error { events = append(events, e); return nil })
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d.Process(sprayAttempt("192.0.2.1:22", "root", "x", start))
+	for i := 0; i < 5; i++ {
+		d.Process(sprayAttempt("192.0.2.1:22", "root", "x", start.Add(time.Minute)))
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no surge below min_attempts, got %d events", len(events))
+	}
+}
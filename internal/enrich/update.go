@@ -0,0 +1,226 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/rs/zerolog/log"
+)
+
+// MMDBDownload is a MaxMind database kept up to date by the Updater
+type MMDBDownload struct {
+	// Edition ID, e.g. "GeoLite2-City" or "GeoLite2-ASN"
+	Edition string
+	// Local path of the database
+	Path string
+}
+
+// UpdaterConfig contains settings of the MaxMind database updates
+type UpdaterConfig struct {
+	// MaxMind account ID
+	AccountID string
+	// MaxMind license key
+	LicenseKey string
+	// How often the databases are checked for updates
+	Interval time.Duration
+	// Databases to update
+	Databases []MMDBDownload
+}
+
+// Updater downloads MaxMind databases on a schedule and atomically
+// replaces the local files. The enrichers pick up the new files when they
+// check for changes.
+type Updater struct {
+	cfg     UpdaterConfig
+	baseURL string
+	client  *http.Client
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewUpdater creates an updater, call Start to update on a schedule
+func NewUpdater(cfg UpdaterConfig) *Updater {
+	return &Updater{
+		cfg:     cfg,
+		baseURL: "https://download.maxmind.com/geoip/databases",
+		client:  &http.Client{Timeout: 10 * time.Minute},
+		done:    make(chan struct{}),
+	}
+}
+
+// Start checks for updates every configured interval
+func (u *Updater) Start() {
+	if u.cfg.Interval <= 0 {
+		return
+	}
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+
+		ticker := time.NewTicker(u.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := u.Update(context.Background()); err != nil {
+					log.Warn().Err(err).Msg("MaxMind database update failed")
+				}
+			case <-u.done:
+				return
+			}
+		}
+	}()
+}
+
+// Update downloads every database that changed since the local file was
+// written
+func (u *Updater) Update(ctx context.Context) error {
+	var errs []error
+	for _, db := range u.cfg.Databases {
+		updated, err := u.update(ctx, db)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", db.Edition, err))
+			continue
+		}
+		if updated {
+			log.Info().Str("edition", db.Edition).Str("database", db.Path).Msg("MaxMind database updated")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// update downloads a single database if it is newer than the local file
+func (u *Updater) update(ctx context.Context, db MMDBDownload) (bool, error) {
+	downloadURL := u.baseURL + "/" + url.PathEscape(db.Edition) + "/download?suffix=tar.gz"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.SetBasicAuth(u.cfg.AccountID, u.cfg.LicenseKey)
+	if info, err := os.Stat(db.Path); err == nil {
+		req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := extractMMDB(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	// Never replace a working database with a broken download
+	if _, err := maxminddb.FromBytes(data); err != nil {
+		return false, fmt.Errorf("downloaded database is invalid: %w", err)
+	}
+
+	modTime := time.Now()
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		modTime = t
+	}
+	if err := replaceFile(db.Path, data, modTime); err != nil {
+		return false, fmt.Errorf("failed to replace database: %w", err)
+	}
+	return true, nil
+}
+
+// extractMMDB returns the .mmdb file of a MaxMind tar.gz archive
+func extractMMDB(r io.Reader) ([]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("archive contains no database")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeReg && strings.HasSuffix(hdr.Name, ".mmdb") {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// replaceFile atomically replaces the file at path, so that a crash never
+// leaves it truncated, and sets its modification time
+func replaceFile(path string, data []byte, modTime time.Time) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), modTime, modTime); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close stops the scheduled updates
+func (u *Updater) Close() error {
+	close(u.done)
+	u.wg.Wait()
+	return nil
+}
@@ -0,0 +1,128 @@
+package enrich
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// testArchive packs a database into a tar.gz archive like the MaxMind downloads
+func testArchive(t *testing.T, mmdb []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"GeoLite2-City_20240101/COPYRIGHT.txt", []byte("copyright")},
+		{"GeoLite2-City_20240101/GeoLite2-City.mmdb", mmdb},
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(f.data)
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestUpdaterUpdate(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.mmdb")
+	writeTestDB(t, source, "GeoLite2-City", map[string]mmdbtype.Map{
+		"203.0.113.0/24": {"country": mmdbtype.Map{"iso_code": mmdbtype.String("NL")}},
+	})
+	mmdb, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastModified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "12345" || pass != "license" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/GeoLite2-City/download" {
+			http.NotFound(w, r)
+			return
+		}
+		if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Write(testArchive(t, mmdb))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(dir, "GeoLite2-City.mmdb")
+	u := NewUpdater(UpdaterConfig{
+		AccountID:  "12345",
+		LicenseKey: "license",
+		Databases:  []MMDBDownload{{Edition: "GeoLite2-City", Path: path}},
+	})
+	u.baseURL = server.URL
+	defer u.Close()
+
+	if err := u.Update(context.Background()); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	geoIP, err := NewGeoIP(path, 0)
+	if err != nil {
+		t.Fatalf("Failed to open downloaded database: %v", err)
+	}
+	defer geoIP.Close()
+	if record, ok := geoIP.Lookup(mustAddr("203.0.113.1")); !ok || record.Country.ISOCode != "NL" {
+		t.Errorf("Expected country NL from downloaded database, got %+v", record)
+	}
+
+	// An unchanged database is not downloaded again
+	if err := u.Update(context.Background()); err != nil {
+		t.Fatalf("Second update failed: %v", err)
+	}
+	if downloads != 1 {
+		t.Errorf("Expected 1 download, got %d", downloads)
+	}
+}
+
+func TestUpdaterKeepsDatabaseOnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testArchive(t, []byte("not a database")))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "GeoLite2-ASN.mmdb")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, time.Unix(0, 0), time.Unix(0, 0))
+
+	u := NewUpdater(UpdaterConfig{Databases: []MMDBDownload{{Edition: "GeoLite2-ASN", Path: path}}})
+	u.baseURL = server.URL
+	defer u.Close()
+
+	if err := u.Update(context.Background()); err == nil {
+		t.Errorf("Expected error for invalid download")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Errorf("Expected the old database to be kept, got %q", data)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package enrich
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// UsernameOther is the category of usernames not matching any rule
+const UsernameOther = "other"
+
+// UsernameRule assigns a category to usernames from a list or matching a
+// regular expression
+type UsernameRule struct {
+	// Category attached to events
+	Category string
+	// Usernames in this category, compared case-insensitively
+	Usernames []string
+	// Regular expression matching usernames in this category
+	Pattern string
+}
+
+// DefaultUsernameRules are used when no rules are configured
+var DefaultUsernameRules = []UsernameRule{
+	{
+		Category:  "privileged",
+		Usernames: []string{"root", "admin", "administrator", "superuser", "sysadmin", "toor", "supervisor", "manager", "sa"},
+	},
+	{
+		Category: "service",
+		Usernames: []string{
+			"git", "postgres", "oracle", "mysql", "mssql", "redis", "mongodb", "elastic", "elasticsearch",
+			"hadoop", "spark", "kafka", "zookeeper", "tomcat", "jenkins", "nginx", "apache", "www-data",
+			"ftp", "ftpuser", "mail", "postfix", "nagios", "zabbix", "ansible", "deploy", "docker",
+			"minecraft", "steam", "teamspeak", "ts3", "backup", "test", "guest", "support", "user",
+		},
+	},
+	{
+		Category:  "cloud_default",
+		Usernames: []string{"ubuntu", "ec2-user", "centos", "debian", "fedora", "azureuser", "opc", "pi", "vagrant", "kali"},
+	},
+	{
+		Category: "email",
+		Pattern:  `^[^@\s]+@[^@\s]+\.[A-Za-z]{2,}$`,
+	},
+	{
+		Category: "numeric",
+		Pattern:  `^[0-9]+$`,
+	},
+	{
+		// Name-like usernames: john, jsmith, john.smith, John_Smith
+		Category: "personal",
+		Pattern:  `^[A-Za-z][a-z]{1,15}([._-]?[A-Za-z][a-z]{1,15})?$`,
+	},
+}
+
+type usernameMatcher struct {
+	category  string
+	usernames map[string]bool
+	pattern   *regexp.Regexp
+}
+
+// UsernameClassifier assigns usernames to categories. Rules are checked in
+// order and the first match wins.
+type UsernameClassifier struct {
+	rules []usernameMatcher
+}
+
+// NewUsernameClassifier compiles the classification rules
+func NewUsernameClassifier(rules []UsernameRule) (*UsernameClassifier, error) {
+	c := &UsernameClassifier{}
+	for i, rule := range rules {
+		if rule.Category == "" {
+			return nil, fmt.Errorf("username rule #%d has no category", i+1)
+		}
+		m := usernameMatcher{
+			category:  rule.Category,
+			usernames: make(map[string]bool),
+		}
+		for _, u := range rule.Usernames {
+			m.usernames[strings.ToLower(u)] = true
+		}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("username rule #%d: invalid pattern: %w", i+1, err)
+			}
+			m.pattern = re
+		}
+		c.rules = append(c.rules, m)
+	}
+	return c, nil
+}
+
+// Classify returns the category of a username
+func (c *UsernameClassifier) Classify(username string) string {
+	lower := strings.ToLower(username)
+	for _, rule := range c.rules {
+		if rule.usernames[lower] || (rule.pattern != nil && rule.pattern.MatchString(username)) {
+			return rule.category
+		}
+	}
+	return UsernameOther
+}
+
+// Process adds the username_category field to authentication attempts
+func (c *UsernameClassifier) Process(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	if _, ok := event.Get("username"); !ok {
+		return
+	}
+	event.Set("username_category", c.Classify(event.GetString("username")))
+}
@@ -0,0 +1,63 @@
+package enrich
+
+import (
+	"testing"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestUsernameClassifierDefaults(t *testing.T) {
+	c, err := NewUsernameClassifier(DefaultUsernameRules)
+	if err != nil {
+		t.Fatalf("Failed to compile default rules: %v", err)
+	}
+
+	tests := map[string]string{
+		"root":             "privileged",
+		"Administrator":    "privileged",
+		"postgres":         "service",
+		"www-data":         "service",
+		"ec2-user":         "cloud_default",
+		"pi":               "cloud_default",
+		"john@example.com": "email",
+		"123456":           "numeric",
+		"jsmith":           "personal",
+		"john.smith":       "personal",
+		"x1_admin$":        UsernameOther,
+		"":                 UsernameOther,
+	}
+	for username, expected := range tests {
+		if got := c.Classify(username); got != expected {
+			t.Errorf("Classify(%q): expected '%s', got '%s'", username, expected, got)
+		}
+	}
+}
+
+func TestUsernameClassifierCustomRules(t *testing.T) {
+	c, err := NewUsernameClassifier([]UsernameRule{
+		{Category: "iot", Usernames: []string{"ubnt", "telecomadmin"}},
+		{Category: "corporate", Pattern: `^[a-z]+\.[a-z]+$`},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+
+	event := logger.NewAuthEvent(logger.CredentialAttempt{Username: "UBNT"})
+	c.Process(event)
+	if got := event.GetString("username_category"); got != "iot" {
+		t.Errorf("Expected category 'iot', got '%s'", got)
+	}
+	if got := c.Classify("jane.doe"); got != "corporate" {
+		t.Errorf("Expected category 'corporate', got '%s'", got)
+	}
+	if got := c.Classify("root"); got != UsernameOther {
+		t.Errorf("Expected category '%s', got '%s'", UsernameOther, got)
+	}
+
+	if _, err := NewUsernameClassifier([]UsernameRule{{Category: "x", Pattern: "("}}); err == nil {
+		t.Errorf("Expected error for invalid pattern")
+	}
+	if _, err := NewUsernameClassifier([]UsernameRule{{Usernames: []string{"a"}}}); err == nil {
+		t.Errorf("Expected error for rule without category")
+	}
+}
@@ -0,0 +1,454 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+// Package forward sends the events of a sensor to a collector, keeping them
+// in a spool on disk until the collector has stored them
+package forward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/collector"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Size after which a new spool segment is started
+	segmentBytes = 16 << 20
+	// Uncompressed size after which a batch is sent without more events
+	batchBytes = 1 << 20
+	// Longest pause between attempts while the collector is unreachable
+	maxBackoff = time.Minute
+)
+
+// Config contains settings of the forwarding to a collector
+type Config struct {
+	// Base URL of the collector, e.g. "https://collector.example.com:8443"
+	URL string
+	// Client certificate and private key (PEM) authenticating the sensor
+	CertFile string
+	KeyFile  string
+	// CA certificates (PEM) of the collector certificate, the system roots if empty
+	CAFile string
+	// Directory of the spool
+	SpoolDir string
+	// Largest size of the spool in bytes, new events are rejected beyond it
+	MaxSpoolBytes int64
+	// Maximum number of events per batch
+	BatchSize int
+	// Interval between batches
+	FlushInterval time.Duration
+	// Timeout of a batch request
+	Timeout time.Duration
+	// Interval between polls of the fleet lists, 0 disables them
+	FleetInterval time.Duration
+	// Key verifying the profiles of the collector, and interval between
+	// polls of the profile, 0 disables them
+	ProfileKey      ed25519.PublicKey
+	ProfileInterval time.Duration
+	// Identity of the sensor registered with the collector; the name of
+	// the client certificate is the sensor ID if the ID is empty
+	Sensor collector.Registration
+}
+
+// Sink is a logger sink writing events to the spool, from which they are
+// sent in batches to the collector. Events are removed from the spool once
+// the collector has stored them. The collector drops events it receives
+// again by their ID while they are among its recently stored events, so
+// that batches sent again after a lost response are not stored twice.
+type Sink struct {
+	config Config
+	client *http.Client
+	base   string
+
+	mu       sync.Mutex
+	spool    *spool
+	buf      bytes.Buffer
+	exporter report.Exporter
+	unsent   int
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	failing bool
+	// Whether the sensor registered since the last failure
+	registered bool
+
+	onFleet     func(collector.Fleet)
+	fleetSynced time.Time
+
+	// Last profile received, under mu
+	profile       []byte
+	onProfile     func([]byte)
+	profileSynced time.Time
+}
+
+// New creates a sink forwarding events to the collector and starts sending
+// the events left in the spool
+func New(config Config) (*Sink, error) {
+	tlsConfig, err := clientTLS(config)
+	if err != nil {
+		return nil, err
+	}
+	return newSink(config, &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}})
+}
+
+// Check connects to the collector with the client certificate without
+// sending events, so that certificate, CA and address problems show before
+// a sensor is started. Any response of the collector passes.
+func Check(config Config) error {
+	tlsConfig, err := clientTLS(config)
+	if err != nil {
+		return err
+	}
+	return check(config, &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}})
+}
+
+func check(config Config, client *http.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.URL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid collector URL: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("collector connection error: %w", err)
+	}
+	return resp.Body.Close()
+}
+
+// clientTLS loads the client certificate and the CA of the collector
+func clientTLS(config Config) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("forward client certificate loading error: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if config.CAFile != "" {
+		data, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("forward CA loading error: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("forward CA loading error: no certificates in %s", config.CAFile)
+		}
+	}
+	return tlsConfig, nil
+}
+
+func newSink(config Config, client *http.Client) (*Sink, error) {
+	spool, err := openSpool(config.SpoolDir, config.MaxSpoolBytes, segmentBytes)
+	if err != nil {
+		return nil, err
+	}
+	if pending := spool.pending(); pending > 0 {
+		log.Info().Int64("bytes", pending).Str("spool", config.SpoolDir).Msg("resuming forwarding of spooled events")
+	}
+
+	s := &Sink{
+		config:  config,
+		client:  client,
+		base:    strings.TrimSuffix(config.URL, "/"),
+		spool:   spool,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	s.exporter, _ = report.NewExporter(report.ExportJSON, &s.buf, nil)
+	go s.run()
+	return s, nil
+}
+
+// Name identifies the sink in health reports
+func (s *Sink) Name() string {
+	return "forward"
+}
+
+// Write adds the event to the spool. It fails only if the spool is full or
+// cannot be written, not while the collector is unreachable.
+func (s *Sink) Write(event *logger.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Reset()
+	if err := s.exporter.Write(event); err != nil {
+		return err
+	}
+	if err := s.spool.append(s.buf.Bytes()); err != nil {
+		return err
+	}
+
+	// Full batches are sent without waiting for the next interval
+	s.unsent++
+	if s.unsent >= s.config.BatchSize {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// OnFleet sets the function receiving the fleet lists of the collector,
+// polled every FleetInterval while the collector is reachable
+func (s *Sink) OnFleet(fn func(collector.Fleet)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onFleet = fn
+}
+
+// Close makes a last attempt to send the spooled events and closes the
+// spool. Events that could not be sent are sent after the next start.
+func (s *Sink) Close() error {
+	close(s.done)
+	<-s.stopped
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.spool.close()
+}
+
+// run sends the spooled events at every interval, backing off while the
+// collector is unreachable
+func (s *Sink) run() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	var backoff time.Duration
+	var retry time.Time
+	for {
+		select {
+		case <-s.done:
+			if err := s.flush(); err != nil {
+				log.Warn().Err(err).Msg("events left in the forward spool")
+			}
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		if time.Now().Before(retry) {
+			continue
+		}
+
+		if err := s.flush(); err != nil {
+			backoff = min(max(2*backoff, s.config.FlushInterval), maxBackoff)
+			retry = time.Now().Add(backoff)
+			if !s.failing {
+				log.Warn().Err(err).Msg("collector unreachable, spooling events")
+				s.failing = true
+			}
+			continue
+		}
+		backoff = 0
+		if s.failing {
+			log.Info().Msg("collector reachable again, spooled events sent")
+			s.failing = false
+		}
+		if err := s.syncFleet(); err != nil {
+			log.Warn().Err(err).Msg("fleet lists could not be fetched from the collector")
+		}
+		if err := s.syncProfile(); err != nil {
+			log.Warn().Err(err).Msg("profile could not be fetched from the collector")
+		}
+	}
+}
+
+// flush sends batches until the spool is empty or a batch fails. The
+// sensor registers first after starting and after failures, when the
+// collector may have restarted.
+func (s *Sink) flush() error {
+	if !s.registered {
+		if err := s.register(); err != nil {
+			return err
+		}
+		s.registered = true
+	}
+	for {
+		s.mu.Lock()
+		records, err := s.spool.read(s.config.BatchSize, batchBytes)
+		s.unsent = 0
+		s.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to read forward spool: %w", err)
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		accepted, err := s.send(records)
+		if accepted > 0 {
+			var size int64
+			for _, r := range records[:accepted] {
+				size += int64(len(r.data))
+			}
+			s.mu.Lock()
+			commitErr := s.spool.commit(records[accepted-1].end, size)
+			s.mu.Unlock()
+			if commitErr != nil {
+				return fmt.Errorf("failed to commit forward spool: %w", commitErr)
+			}
+		}
+		if err != nil {
+			s.registered = false
+			return err
+		}
+	}
+}
+
+// register sends the identity of the sensor to the collector
+func (s *Sink) register() error {
+	body, err := json.Marshal(s.config.Sensor)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+	resp, err := s.post(ctx, collector.SensorsPath, "application/json", false, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sensor registration failed: collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// syncFleet fetches the fleet lists once they are due and passes them to
+// the OnFleet function
+func (s *Sink) syncFleet() error {
+	s.mu.Lock()
+	fn := s.onFleet
+	s.mu.Unlock()
+	if fn == nil || s.config.FleetInterval <= 0 || time.Since(s.fleetSynced) < s.config.FleetInterval {
+		return nil
+	}
+	s.fleetSynced = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+	resp, err := s.get(ctx, collector.FleetPath)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	var fleet collector.Fleet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&fleet); err != nil {
+		return fmt.Errorf("invalid fleet lists: %w", err)
+	}
+	fn(fleet)
+	return nil
+}
+
+// get requests an endpoint of the collector
+func (s *Sink) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.Sensor.ID != "" {
+		req.Header.Set(collector.SensorHeader, s.config.Sensor.ID)
+	}
+	return s.client.Do(req)
+}
+
+// post sends a request to an endpoint of the collector
+func (s *Sink) post(ctx context.Context, path, contentType string, compressed bool, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.base+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if s.config.Sensor.ID != "" {
+		req.Header.Set(collector.SensorHeader, s.config.Sensor.ID)
+	}
+	return s.client.Do(req)
+}
+
+// send posts a gzip-compressed batch and returns the number of records the
+// collector stored
+func (s *Sink) send(records []record) (int, error) {
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	for _, r := range records {
+		gz.Write(r.data)
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+	resp, err := s.post(ctx, collector.EventsPath, "application/x-ndjson", true, body.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result collector.BatchResponse
+	json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&result)
+	accepted := min(max(result.Accepted, 0), len(records))
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if accepted < len(records) {
+			return accepted, fmt.Errorf("collector stored %d of %d events", accepted, len(records))
+		}
+		return accepted, nil
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		// Sending the batch again would fail again
+		log.Error().Str("error", result.Error).Int("events", len(records)).Msg("batch rejected by the collector, dropped")
+		return len(records), nil
+	}
+	if result.Error != "" {
+		return accepted, fmt.Errorf("collector returned %s: %s", resp.Status, result.Error)
+	}
+	return accepted, fmt.Errorf("collector returned %s", resp.Status)
+}
@@ -0,0 +1,269 @@
+package forward
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/collector"
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// fakeCollector stores the event IDs of batches, accepting at most limit
+// events of the next batch if set
+type fakeCollector struct {
+	mu            sync.Mutex
+	ids           []string
+	down          bool
+	limit         int
+	header        http.Header
+	registrations []collector.Registration
+	fleet         collector.Fleet
+	profile       []byte
+	signature     []byte
+}
+
+func (c *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		http.Error(w, "down", http.StatusBadGateway)
+		return
+	}
+	if r.URL.Path == collector.SensorsPath {
+		var reg collector.Registration
+		json.NewDecoder(r.Body).Decode(&reg)
+		c.registrations = append(c.registrations, reg)
+		return
+	}
+	if r.URL.Path == collector.ProfilePath {
+		if c.profile == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set(collector.SignatureHeader, base64.StdEncoding.EncodeToString(c.signature))
+		w.Write(c.profile)
+		return
+	}
+	if r.URL.Path == collector.FleetPath {
+		c.header = r.Header.Clone()
+		json.NewEncoder(w).Encode(c.fleet)
+		return
+	}
+	c.header = r.Header.Clone()
+
+	reader, err := logger.NewReader(r.Body, logger.TimeFormat{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := collector.BatchResponse{}
+	status := http.StatusOK
+	for {
+		event, err := reader.Next()
+		if err != nil {
+			break
+		}
+		if c.limit > 0 && resp.Accepted == c.limit {
+			c.limit = 0
+			status = http.StatusServiceUnavailable
+			resp.Error = "events could not be logged"
+			break
+		}
+		c.ids = append(c.ids, event.ID)
+		resp.Accepted++
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (c *fakeCollector) received() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.ids...)
+}
+
+func newTestSink(t *testing.T, c *fakeCollector, dir string) *Sink {
+	t.Helper()
+	ts := httptest.NewTLSServer(c)
+	t.Cleanup(ts.Close)
+	s, err := newSink(Config{
+		URL:             ts.URL,
+		SpoolDir:        dir,
+		MaxSpoolBytes:   1 << 20,
+		BatchSize:       3,
+		FlushInterval:   10 * time.Millisecond,
+		Timeout:         time.Second,
+		FleetInterval:   10 * time.Millisecond,
+		ProfileKey:      testProfileKey.Public().(ed25519.PublicKey),
+		ProfileInterval: 10 * time.Millisecond,
+		Sensor:          collector.Registration{ID: "sensor-1", Name: "Frankfurt 1", Version: "v1.5.0"},
+	}, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func writeEvents(t *testing.T, s *Sink, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		event := logger.NewAuthEvent(logger.CredentialAttempt{Timestamp: time.Now(), RemoteAddr: "1.2.3.4:5", Username: "root", Password: "x"})
+		event.ID = fmt.Sprintf("id-%d", i)
+		if err := s.Write(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func waitFor(t *testing.T, c *fakeCollector, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if ids := c.received(); len(ids) >= n {
+			return ids
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d events at the collector, got %d", n, len(c.received()))
+	return nil
+}
+
+func TestSinkForwards(t *testing.T) {
+	c := &fakeCollector{}
+	s := newTestSink(t, c, t.TempDir())
+	writeEvents(t, s, 0, 7)
+	ids := waitFor(t, c, 7)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, id := range ids {
+		if id != fmt.Sprintf("id-%d", i) {
+			t.Errorf("Expected events in order, got %v", ids)
+			break
+		}
+	}
+	if got := c.header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Expected compressed batches, got encoding '%s'", got)
+	}
+	if got := c.header.Get(collector.SensorHeader); got != "sensor-1" {
+		t.Errorf("Expected batches with the sensor ID, got '%s'", got)
+	}
+	if len(c.registrations) != 1 || c.registrations[0].Name != "Frankfurt 1" {
+		t.Errorf("Expected the sensor to register once, got %+v", c.registrations)
+	}
+	if s.spool.pending() != 0 {
+		t.Errorf("Expected empty spool, got %d bytes", s.spool.pending())
+	}
+}
+
+func TestSinkPartialBatch(t *testing.T) {
+	c := &fakeCollector{limit: 1}
+	s := newTestSink(t, c, t.TempDir())
+	writeEvents(t, s, 0, 3)
+	ids := waitFor(t, c, 3)
+	s.Close()
+
+	// The events after the first one are sent again, once, after the
+	// sensor registered again
+	want := []string{"id-0", "id-1", "id-2"}
+	if fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, ids)
+	}
+	if len(c.registrations) != 2 {
+		t.Errorf("Expected 2 registrations, got %d", len(c.registrations))
+	}
+}
+
+func TestSinkResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	c := &fakeCollector{down: true}
+	s := newTestSink(t, c, dir)
+	writeEvents(t, s, 0, 4)
+	time.Sleep(30 * time.Millisecond)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.received()) != 0 {
+		t.Fatalf("Expected no events while the collector is down")
+	}
+
+	c.mu.Lock()
+	c.down = false
+	c.mu.Unlock()
+	s = newTestSink(t, c, dir)
+	defer s.Close()
+	writeEvents(t, s, 4, 5)
+	ids := waitFor(t, c, 5)
+	if fmt.Sprint(ids) != "[id-0 id-1 id-2 id-3 id-4]" {
+		t.Errorf("Expected spooled events before new ones, got %v", ids)
+	}
+}
+
+func TestSinkSpoolFull(t *testing.T) {
+	c := &fakeCollector{down: true}
+	s := newTestSink(t, c, t.TempDir())
+	defer s.Close()
+	s.spool.maxBytes = 100
+
+	event := &logger.Event{ID: "x", Type: "auth_attempt", Fields: []logger.Field{{Key: "password", Value: string(bytes.Repeat([]byte("a"), 200))}}}
+	if err := s.Write(event); err == nil {
+		t.Errorf("Expected error with a full spool")
+	}
+}
+
+func TestSinkFleet(t *testing.T) {
+	c := &fakeCollector{fleet: collector.Fleet{Denylist: []string{"192.0.2.7"}, Tarpit: []string{}}}
+	s := newTestSink(t, c, t.TempDir())
+	defer s.Close()
+
+	received := make(chan collector.Fleet, 10)
+	s.OnFleet(func(fleet collector.Fleet) { received <- fleet })
+	select {
+	case fleet := <-received:
+		if fmt.Sprint(fleet.Denylist) != "[192.0.2.7]" {
+			t.Errorf("Unexpected fleet lists: %+v", fleet)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the fleet lists to be fetched")
+	}
+
+	c.mu.Lock()
+	c.fleet = collector.Fleet{Denylist: []string{}, Tarpit: []string{"198.51.100.0/24"}}
+	sensor := c.header.Get(collector.SensorHeader)
+	c.mu.Unlock()
+	if sensor != "sensor-1" {
+		t.Errorf("Expected the fleet lists to be fetched with the sensor ID, got '%s'", sensor)
+	}
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case fleet := <-received:
+			if len(fleet.Tarpit) == 1 {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("Expected the fleet lists to be polled again")
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ts := httptest.NewTLSServer(&fakeCollector{})
+	config := Config{URL: ts.URL, Timeout: time.Second}
+	if err := check(config, ts.Client()); err != nil {
+		t.Errorf("check() error: %v", err)
+	}
+	ts.Close()
+	if err := check(config, ts.Client()); err == nil {
+		t.Error("Expected an error for a collector that is down")
+	}
+}
@@ -0,0 +1,187 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package forward
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/collector"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// File in the spool directory keeping the last verified profile
+	profileFile = "profile.json"
+	// Largest accepted profile
+	maxProfileBytes = 1 << 20
+)
+
+// cachedProfile is a profile with its signature as kept in the spool
+// directory, so that a sensor starting while the collector is unreachable
+// keeps its profile
+type cachedProfile struct {
+	Profile   []byte `json:"profile"`
+	Signature []byte `json:"signature"`
+}
+
+// ParseProfileKey parses the PEM-encoded Ed25519 public key (PKIX)
+// verifying profiles
+func ParseProfileKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data in the profile key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	verifier, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("the profile key is not an Ed25519 key")
+	}
+	return verifier, nil
+}
+
+// OnProfile sets the function receiving the profile of the sensor when it
+// changes, nil once the collector has none, polled every ProfileInterval
+// while the collector is reachable
+func (s *Sink) OnProfile(fn func(profile []byte)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onProfile = fn
+}
+
+// FetchProfile returns the profile of the sensor, nil if the collector has
+// none. While the collector is unreachable, it returns the last profile
+// received.
+func (s *Sink) FetchProfile() ([]byte, error) {
+	profile, err := s.fetchProfile()
+	if err != nil {
+		cached, cacheErr := s.cachedProfile()
+		if cacheErr != nil || cached == nil {
+			return nil, err
+		}
+		log.Warn().Err(err).Msg("profile could not be fetched from the collector, using the last one received")
+		profile = cached
+	}
+	s.mu.Lock()
+	s.profile = profile
+	s.mu.Unlock()
+	return profile, nil
+}
+
+// syncProfile fetches the profile once it is due and passes it to the
+// OnProfile function if it changed
+func (s *Sink) syncProfile() error {
+	s.mu.Lock()
+	fn, last := s.onProfile, s.profile
+	s.mu.Unlock()
+	if fn == nil || s.config.ProfileInterval <= 0 || time.Since(s.profileSynced) < s.config.ProfileInterval {
+		return nil
+	}
+	s.profileSynced = time.Now()
+
+	profile, err := s.fetchProfile()
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(profile, last) {
+		return nil
+	}
+	s.mu.Lock()
+	s.profile = profile
+	s.mu.Unlock()
+	fn(profile)
+	return nil
+}
+
+// fetchProfile requests the profile of the sensor and verifies its
+// signature, keeping a copy in the spool directory
+func (s *Sink) fetchProfile() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+	resp, err := s.get(ctx, collector.ProfilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	cache := filepath.Join(s.config.SpoolDir, profileFile)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		if err := os.Remove(cache); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("collector returned %s", resp.Status)
+	}
+
+	profile, err := io.ReadAll(io.LimitReader(resp.Body, maxProfileBytes))
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(resp.Header.Get(collector.SignatureHeader))
+	if err != nil || !ed25519.Verify(s.config.ProfileKey, profile, signature) {
+		return nil, errors.New("invalid profile signature")
+	}
+
+	data, err := json.Marshal(cachedProfile{Profile: profile, Signature: signature})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(cache, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to keep profile: %w", err)
+	}
+	return profile, nil
+}
+
+// cachedProfile returns the profile kept in the spool directory if its
+// signature is valid, nil if there is none
+func (s *Sink) cachedProfile() ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.config.SpoolDir, profileFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cached cachedProfile
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(s.config.ProfileKey, cached.Profile, cached.Signature) {
+		return nil, errors.New("invalid signature of the kept profile")
+	}
+	return cached.Profile, nil
+}
@@ -0,0 +1,107 @@
+package forward
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+// testProfileKey signs the profiles of the fake collector
+var testProfileKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+// setProfile makes the fake collector send a profile, signed with key
+func (c *fakeCollector) setProfile(profile string, key ed25519.PrivateKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.profile = []byte(profile)
+	c.signature = ed25519.Sign(key, c.profile)
+}
+
+func TestSinkFetchProfile(t *testing.T) {
+	dir := t.TempDir()
+	c := &fakeCollector{}
+	s := newTestSink(t, c, dir)
+	defer s.Close()
+
+	if profile, err := s.FetchProfile(); err != nil || profile != nil {
+		t.Errorf("Expected no profile, got %q, %v", profile, err)
+	}
+
+	c.setProfile(`{"Name": "dmz"}`, testProfileKey)
+	profile, err := s.FetchProfile()
+	if err != nil || string(profile) != `{"Name": "dmz"}` {
+		t.Fatalf("FetchProfile() = %q, %v", profile, err)
+	}
+
+	// The last profile is used while the collector is unreachable
+	c.mu.Lock()
+	c.down = true
+	c.mu.Unlock()
+	if profile, err := s.FetchProfile(); err != nil || string(profile) != `{"Name": "dmz"}` {
+		t.Errorf("Expected the kept profile, got %q, %v", profile, err)
+	}
+}
+
+func TestSinkRejectsUnsignedProfile(t *testing.T) {
+	c := &fakeCollector{}
+	s := newTestSink(t, c, t.TempDir())
+	defer s.Close()
+
+	seed := make([]byte, ed25519.SeedSize)
+	seed[0] = 1
+	c.setProfile(`{"Name": "evil"}`, ed25519.NewKeyFromSeed(seed))
+	if _, err := s.FetchProfile(); err == nil {
+		t.Errorf("Expected an error for a profile signed with another key")
+	}
+}
+
+func TestSinkProfileChanges(t *testing.T) {
+	c := &fakeCollector{}
+	c.setProfile(`{"Name": "dmz"}`, testProfileKey)
+	s := newTestSink(t, c, t.TempDir())
+	defer s.Close()
+	if _, err := s.FetchProfile(); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan []byte, 10)
+	s.OnProfile(func(profile []byte) { received <- profile })
+	c.setProfile(`{"Name": "lab"}`, testProfileKey)
+	select {
+	case profile := <-received:
+		if string(profile) != `{"Name": "lab"}` {
+			t.Errorf("Unexpected profile %q", profile)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the changed profile")
+	}
+
+	// A removed profile is passed as nil
+	c.mu.Lock()
+	c.profile = nil
+	c.mu.Unlock()
+	select {
+	case profile := <-received:
+		if profile != nil {
+			t.Errorf("Expected no profile, got %q", profile)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the removed profile")
+	}
+}
+
+func TestParseProfileKey(t *testing.T) {
+	der, err := x509.MarshalPKIXPublicKey(testProfileKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseProfileKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil || !key.Equal(testProfileKey.Public()) {
+		t.Errorf("ParseProfileKey() = %v, %v", key, err)
+	}
+	if _, err := ParseProfileKey([]byte("not a key")); err == nil {
+		t.Errorf("Expected an error without PEM data")
+	}
+}
@@ -0,0 +1,236 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// errSpoolFull is returned when the spool cannot take more records
+var errSpoolFull = errors.New("forward spool is full")
+
+// Spool files: segments of records named by their sequence number, and
+// the position of the first record not stored by the collector yet
+const (
+	segmentSuffix = ".spool"
+	offsetFile    = "offset"
+)
+
+// position is a place in the spool: a segment and a byte offset in it
+type position struct {
+	segment int
+	offset  int64
+}
+
+// record is a spooled event and the position following it
+type record struct {
+	data []byte
+	end  position
+}
+
+// spool is a queue of records, one per line, kept in segment files so that
+// events survive collector outages and restarts. It is not safe for
+// concurrent use.
+type spool struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	w    *os.File
+	head position // end of the written records
+	tail position // first record not committed
+	size int64    // bytes of the records after tail
+}
+
+// openSpool opens the spool in dir, creating it if needed
+func openSpool(dir string, maxBytes, segmentBytes int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	s := &spool{dir: dir, maxBytes: maxBytes, segmentBytes: segmentBytes}
+
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	s.tail = position{segment: 1}
+	if len(segments) > 0 {
+		s.tail.segment = segments[0]
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, offsetFile)); err == nil {
+		if _, err := fmt.Sscanf(string(data), "%d %d", &s.tail.segment, &s.tail.offset); err != nil {
+			return nil, fmt.Errorf("invalid spool offset: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Segments before the tail were committed but not removed yet
+	s.head = s.tail
+	for _, n := range segments {
+		if n < s.tail.segment {
+			os.Remove(s.path(n))
+			continue
+		}
+		size, err := s.repair(n)
+		if err != nil {
+			return nil, err
+		}
+		s.size += size
+		s.head = position{segment: n, offset: size}
+	}
+	s.size -= s.tail.offset
+	if s.size < 0 {
+		return nil, fmt.Errorf("invalid spool offset: beyond the spooled records")
+	}
+
+	s.w, err = os.OpenFile(s.path(s.head.segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// segments returns the sequence numbers of the segment files in order
+func (s *spool) segments() ([]int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []int
+	for _, e := range entries {
+		if n, err := strconv.Atoi(strings.TrimSuffix(e.Name(), segmentSuffix)); err == nil && strings.HasSuffix(e.Name(), segmentSuffix) {
+			segments = append(segments, n)
+		}
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+func (s *spool) path(segment int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%010d%s", segment, segmentSuffix))
+}
+
+// repair truncates a segment after its last complete record, dropping a
+// record cut short by a crash, and returns its size
+func (s *spool) repair(segment int) (int64, error) {
+	data, err := os.ReadFile(s.path(segment))
+	if err != nil {
+		return 0, err
+	}
+	size := int64(bytes.LastIndexByte(data, '\n') + 1)
+	if size < int64(len(data)) {
+		if err := os.Truncate(s.path(segment), size); err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
+
+// append adds a record, a line ending with a newline
+func (s *spool) append(line []byte) error {
+	if s.size+int64(len(line)) > s.maxBytes {
+		return errSpoolFull
+	}
+	if s.head.offset > 0 && s.head.offset+int64(len(line)) > s.segmentBytes {
+		w, err := os.OpenFile(s.path(s.head.segment+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		s.w.Close()
+		s.w = w
+		s.head = position{segment: s.head.segment + 1}
+	}
+
+	n, err := s.w.Write(line)
+	s.head.offset += int64(n)
+	s.size += int64(n)
+	return err
+}
+
+// read returns up to max records after the tail, stopping after maxBytes
+func (s *spool) read(max int, maxBytes int64) ([]record, error) {
+	var records []record
+	var size int64
+	pos := s.tail
+	for len(records) < max && size < maxBytes && pos != s.head {
+		f, err := os.Open(s.path(pos.segment))
+		if err != nil {
+			return nil, err
+		}
+		// Older segments are complete, the last one is read up to the head
+		var section io.Reader = io.NewSectionReader(f, pos.offset, 1<<62)
+		if pos.segment == s.head.segment {
+			section = io.NewSectionReader(f, pos.offset, s.head.offset-pos.offset)
+		}
+		r := bufio.NewReader(section)
+		for len(records) < max && size < maxBytes {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				break
+			}
+			pos.offset += int64(len(line))
+			size += int64(len(line))
+			records = append(records, record{data: line, end: pos})
+		}
+		f.Close()
+
+		// Continue with the next segment at the end of this one
+		if pos.segment != s.head.segment && (len(records) < max && size < maxBytes) {
+			pos = position{segment: pos.segment + 1}
+		}
+	}
+	return records, nil
+}
+
+// commit moves the tail to pos, after records of the given size were
+// stored by the collector, and removes the segments before it
+func (s *spool) commit(pos position, size int64) error {
+	tmp := filepath.Join(s.dir, offsetFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", pos.segment, pos.offset)), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, offsetFile)); err != nil {
+		return err
+	}
+	for n := s.tail.segment; n < pos.segment; n++ {
+		os.Remove(s.path(n))
+	}
+	s.tail = pos
+	s.size -= size
+	return nil
+}
+
+// pending returns the size of the records not committed
+func (s *spool) pending() int64 {
+	return s.size
+}
+
+func (s *spool) close() error {
+	return s.w.Close()
+}
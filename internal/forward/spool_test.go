@@ -0,0 +1,92 @@
+package forward
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSpoolSegments(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir, 1024, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := s.append([]byte(fmt.Sprintf("record %d\n", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if segments, _ := s.segments(); len(segments) != 2 {
+		t.Errorf("Expected records in 2 segments, got %v", segments)
+	}
+
+	// Reading continues across segments
+	records, err := s.read(4, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || string(records[3].data) != "record 3\n" {
+		t.Fatalf("Unexpected records: %q", records)
+	}
+
+	// Committed segments are removed
+	if err := s.commit(records[3].end, 36); err != nil {
+		t.Fatal(err)
+	}
+	if segments, _ := s.segments(); len(segments) != 1 {
+		t.Errorf("Expected the first segment to be removed, got %v", segments)
+	}
+	if s.pending() != 9 {
+		t.Errorf("Expected 9 pending bytes, got %d", s.pending())
+	}
+	records, _ = s.read(10, 1024)
+	if len(records) != 1 || string(records[0].data) != "record 4\n" {
+		t.Errorf("Expected the last record, got %q", records)
+	}
+	s.close()
+}
+
+func TestSpoolReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir, 1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.append([]byte("first\n"))
+	s.append([]byte("second\n"))
+	records, _ := s.read(1, 1024)
+	s.commit(records[0].end, int64(len(records[0].data)))
+	s.close()
+
+	// A record cut short by a crash is dropped
+	f, _ := os.OpenFile(s.path(1), os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString(`{"partial`)
+	f.Close()
+
+	s, err = openSpool(dir, 1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	s.append([]byte("third\n"))
+	records, _ = s.read(10, 1024)
+	if len(records) != 2 || string(records[0].data) != "second\n" || string(records[1].data) != "third\n" {
+		t.Errorf("Expected uncommitted records after reopening, got %q", records)
+	}
+}
+
+func TestSpoolFull(t *testing.T) {
+	s, err := openSpool(filepath.Join(t.TempDir(), "spool"), 10, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if err := s.append([]byte("12345\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append([]byte("12345\n")); err != errSpoolFull {
+		t.Errorf("Expected full spool, got %v", err)
+	}
+}
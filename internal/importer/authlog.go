@@ -0,0 +1,120 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package importer
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+var (
+	// Syslog header with a traditional or an RFC3339 timestamp, followed
+	// by the host, the sshd process and the message
+	authLogHeader = regexp.MustCompile(`^(?:([A-Z][a-z]{2} [ 0-9]\d \d\d:\d\d:\d\d)|(\d{4}-\d\d-\d\dT\S+)) (\S+) sshd(?:-session)?\[(\d+)\]: (.*)$`)
+	// Authentication results, the user name may contain spaces
+	authLogAttempt = regexp.MustCompile(`^(Failed|Accepted) (\S+) for (invalid user )?(.*) from (\S+) port (\d+)`)
+	// Messages collapsed by syslog
+	authLogRepeated = regexp.MustCompile(`^message repeated (\d+) times: \[ ?(.*?) ?\]$`)
+)
+
+// authLog converts the syslog output of OpenSSH: failed and accepted
+// authentications become auth_attempt events without a password, with the
+// method in auth_method and the sshd process as session
+type authLog struct {
+	config Config
+}
+
+func newAuthLog(config Config) *authLog {
+	return &authLog{config: config}
+}
+
+func (a *authLog) Convert(line []byte) ([]*logger.Event, error) {
+	header := authLogHeader.FindSubmatch(line)
+	if header == nil {
+		// Lines of other programs are not errors
+		return nil, nil
+	}
+	at, err := a.parseTime(string(header[1]), string(header[2]))
+	if err != nil {
+		return nil, err
+	}
+	host, pid, message := string(header[3]), string(header[4]), string(header[5])
+
+	count := 1
+	if repeated := authLogRepeated.FindStringSubmatch(message); repeated != nil {
+		count, _ = strconv.Atoi(repeated[1])
+		message = repeated[2]
+	}
+	attempt := authLogAttempt.FindStringSubmatch(message)
+	if attempt == nil {
+		return nil, nil
+	}
+
+	event := logger.NewAuthEvent(logger.CredentialAttempt{
+		Timestamp:  at,
+		RemoteAddr: net.JoinHostPort(attempt[5], attempt[6]),
+		Username:   attempt[4],
+	})
+	// sshd never logs passwords
+	event.Delete("password")
+	event.Set("auth_method", attempt[2])
+	if attempt[3] != "" {
+		event.Set("invalid_user", true)
+	}
+	if attempt[1] == "Accepted" {
+		event.Set("accepted", true)
+	}
+	if count > 1 {
+		event.Set("count", count)
+	}
+	event.Set("session_id", host+"/"+pid)
+	event.Set("sensor_id", host)
+	return []*logger.Event{event}, nil
+}
+
+// parseTime parses a traditional syslog timestamp, which has no year and
+// no timezone, or an RFC3339 timestamp
+func (a *authLog) parseTime(traditional, rfc3339 string) (time.Time, error) {
+	if rfc3339 != "" {
+		at, err := time.Parse(time.RFC3339Nano, rfc3339)
+		if err != nil {
+			return at, fmt.Errorf("invalid timestamp: %w", err)
+		}
+		return at, nil
+	}
+
+	year := a.config.Year
+	if year == 0 {
+		year = a.config.Now.In(a.config.Location).Year()
+	}
+	at, err := time.ParseInLocation("2006 Jan _2 15:04:05", strconv.Itoa(year)+" "+traditional, a.config.Location)
+	if err != nil {
+		return at, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	// Without a year, December lines read in January are from last year
+	if a.config.Year == 0 && at.After(a.config.Now.Add(24*time.Hour)) {
+		at = at.AddDate(-1, 0, 0)
+	}
+	return at, nil
+}
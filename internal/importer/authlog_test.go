@@ -0,0 +1,93 @@
+package importer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthLog(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	a := newAuthLog(Config{Location: time.UTC, Now: now})
+
+	tests := []struct {
+		name     string
+		line     string
+		expected map[string]interface{}
+		time     time.Time
+	}{
+		{
+			name: "Failed password",
+			line: "Jan  1 14:02:11 web1 sshd[1234]: Failed password for root from 203.0.113.45 port 50000 ssh2",
+			expected: map[string]interface{}{
+				"remote_addr": "203.0.113.45:50000",
+				"username":    "root",
+				"auth_method": "password",
+				"session_id":  "web1/1234",
+				"sensor_id":   "web1",
+			},
+			time: time.Date(2024, 1, 1, 14, 2, 11, 0, time.UTC),
+		},
+		{
+			name: "Invalid user with spaces from last year",
+			line: "Dec 31 23:59:59 web1 sshd[1235]: Failed password for invalid user admin user from 2001:db8::1 port 22 ssh2",
+			expected: map[string]interface{}{
+				"remote_addr":  "[2001:db8::1]:22",
+				"username":     "admin user",
+				"invalid_user": true,
+			},
+			time: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name: "Repeated message",
+			line: "2024-01-01T10:00:00.5+01:00 web1 sshd-session[99]: message repeated 3 times: [ Failed password for root from 203.0.113.45 port 50001 ssh2]",
+			expected: map[string]interface{}{
+				"username": "root",
+				"count":    3,
+			},
+			time: time.Date(2024, 1, 1, 9, 0, 0, 500000000, time.UTC),
+		},
+		{
+			name: "Accepted public key",
+			line: "Jan  1 08:00:00 web1 sshd[7]: Accepted publickey for deploy from 192.0.2.1 port 40000 ssh2: ED25519 SHA256:abc",
+			expected: map[string]interface{}{
+				"username":    "deploy",
+				"auth_method": "publickey",
+				"accepted":    true,
+			},
+			time: time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := a.Convert([]byte(tt.line))
+			if err != nil {
+				t.Fatalf("Convert failed: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(events))
+			}
+			event := events[0]
+			if event.Type != "auth_attempt" || !event.Time.Equal(tt.time) {
+				t.Errorf("Unexpected event %s at %v", event.Type, event.Time)
+			}
+			if _, ok := event.Get("password"); ok {
+				t.Errorf("Events of sshd should have no password")
+			}
+			for key, expected := range tt.expected {
+				if got, _ := event.Get(key); got != expected {
+					t.Errorf("Expected %s %v, got %v", key, expected, got)
+				}
+			}
+		})
+	}
+
+	for _, line := range []string{
+		"Jan  1 14:02:11 web1 sshd[1234]: Invalid user admin from 203.0.113.45 port 50000",
+		"Jan  1 14:02:11 web1 CRON[1]: pam_unix(cron:session): session opened for user root",
+	} {
+		if events, err := a.Convert([]byte(line)); err != nil || len(events) != 0 {
+			t.Errorf("Expected no events for %q, got %v, %v", line, events, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Limit of open Cowrie sessions remembered for their address and client version
+const maxCowrieSessions = 100000
+
+// cowrieRecord holds the fields of Cowrie events that are converted
+type cowrieRecord struct {
+	EventID   string `json:"eventid"`
+	Timestamp string `json:"timestamp"`
+	Session   string `json:"session"`
+	Sensor    string `json:"sensor"`
+	SrcIP     string `json:"src_ip"`
+	SrcPort   int    `json:"src_port"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Version   string `json:"version"`
+	Input     string `json:"input"`
+}
+
+// cowrieSession is what earlier events told about a session
+type cowrieSession struct {
+	port          int
+	clientVersion string
+}
+
+// cowrie converts Cowrie JSON logs: login attempts become auth_attempt
+// events and command input becomes command events. The source port and
+// client version are taken from earlier events of the session.
+type cowrie struct {
+	sessions map[string]*cowrieSession
+}
+
+func newCowrie() *cowrie {
+	return &cowrie{sessions: make(map[string]*cowrieSession)}
+}
+
+func (c *cowrie) Convert(line []byte) ([]*logger.Event, error) {
+	var record cowrieRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, fmt.Errorf("invalid record: %w", err)
+	}
+	if !strings.HasPrefix(record.EventID, "cowrie.") {
+		return nil, fmt.Errorf("not a Cowrie event")
+	}
+	at, err := time.Parse(time.RFC3339Nano, record.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	var event *logger.Event
+	switch record.EventID {
+	case "cowrie.session.connect":
+		c.session(record.Session).port = record.SrcPort
+		return nil, nil
+	case "cowrie.client.version":
+		c.session(record.Session).clientVersion = cowrieString(record.Version)
+		return nil, nil
+	case "cowrie.session.closed":
+		delete(c.sessions, record.Session)
+		return nil, nil
+	case "cowrie.login.failed", "cowrie.login.success":
+		attempt := logger.CredentialAttempt{
+			Timestamp:  at,
+			RemoteAddr: c.remoteAddr(record),
+			Username:   record.Username,
+			Password:   record.Password,
+		}
+		if s := c.sessions[record.Session]; s != nil {
+			attempt.ClientVersion = s.clientVersion
+		}
+		event = logger.NewAuthEvent(attempt)
+		if record.EventID == "cowrie.login.success" {
+			event.Set("accepted", true)
+		}
+	case "cowrie.command.input":
+		event = &logger.Event{Time: at, Type: "command", Message: "command"}
+		event.Set("remote_addr", c.remoteAddr(record))
+		event.Set("command", record.Input)
+	default:
+		return nil, nil
+	}
+
+	if record.Session != "" {
+		event.Set("session_id", record.Session)
+	}
+	if record.Sensor != "" {
+		event.Set("sensor_id", record.Sensor)
+	}
+	return []*logger.Event{event}, nil
+}
+
+// session returns the session with the given ID, remembering it if new
+func (c *cowrie) session(id string) *cowrieSession {
+	s := c.sessions[id]
+	if s == nil {
+		if len(c.sessions) >= maxCowrieSessions {
+			// Sessions that were never closed are forgotten at random
+			for old := range c.sessions {
+				delete(c.sessions, old)
+				break
+			}
+		}
+		s = &cowrieSession{}
+		c.sessions[id] = s
+	}
+	return s
+}
+
+// remoteAddr returns the source address of a record with the port of its session
+func (c *cowrie) remoteAddr(record cowrieRecord) string {
+	if s := c.sessions[record.Session]; s != nil && s.port != 0 {
+		return net.JoinHostPort(record.SrcIP, strconv.Itoa(s.port))
+	}
+	return record.SrcIP
+}
+
+// cowrieString removes the Python quoting of values logged by older Cowrie
+// versions, e.g. "b'SSH-2.0-Go'"
+func cowrieString(s string) string {
+	if quoted := strings.TrimPrefix(s, "b"); len(quoted) >= 2 && quoted[0] == '\'' && quoted[len(quoted)-1] == '\'' {
+		return quoted[1 : len(quoted)-1]
+	}
+	return s
+}
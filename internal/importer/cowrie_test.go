@@ -0,0 +1,62 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestCowrie(t *testing.T) {
+	c := newCowrie()
+	var events []*logger.Event
+	for _, line := range []string{
+		`{"eventid":"cowrie.session.connect","src_ip":"203.0.113.45","src_port":50000,"dst_port":22,"session":"a1","sensor":"cowrie-01","timestamp":"2024-03-07T14:02:10.000000Z"}`,
+		`{"eventid":"cowrie.client.version","version":"b'SSH-2.0-Go'","src_ip":"203.0.113.45","session":"a1","sensor":"cowrie-01","timestamp":"2024-03-07T14:02:10.500000Z"}`,
+		`{"eventid":"cowrie.login.failed","username":"root","password":"123456","src_ip":"203.0.113.45","session":"a1","sensor":"cowrie-01","timestamp":"2024-03-07T14:02:11.123456Z"}`,
+		`{"eventid":"cowrie.login.success","username":"root","password":"root","src_ip":"203.0.113.45","session":"a1","sensor":"cowrie-01","timestamp":"2024-03-07T14:02:12Z"}`,
+		`{"eventid":"cowrie.command.input","input":"uname -a","src_ip":"203.0.113.45","session":"a1","sensor":"cowrie-01","timestamp":"2024-03-07T14:02:13Z"}`,
+		`{"eventid":"cowrie.session.closed","duration":3.2,"src_ip":"203.0.113.45","session":"a1","sensor":"cowrie-01","timestamp":"2024-03-07T14:02:14Z"}`,
+		`{"eventid":"cowrie.login.failed","username":"admin","password":"admin","src_ip":"203.0.113.45","session":"a1","timestamp":"2024-03-07T14:02:15Z"}`,
+	} {
+		converted, err := c.Convert([]byte(line))
+		if err != nil {
+			t.Fatalf("Failed to convert %s: %v", line, err)
+		}
+		events = append(events, converted...)
+	}
+
+	if len(events) != 4 {
+		t.Fatalf("Expected 4 events, got %d", len(events))
+	}
+	failed := events[0]
+	if failed.Type != "auth_attempt" || !failed.Time.Equal(time.Date(2024, 3, 7, 14, 2, 11, 123456000, time.UTC)) {
+		t.Errorf("Unexpected attempt: %+v", failed)
+	}
+	for key, expected := range map[string]string{
+		"remote_addr":    "203.0.113.45:50000",
+		"username":       "root",
+		"password":       "123456",
+		"client_version": "SSH-2.0-Go",
+		"session_id":     "a1",
+		"sensor_id":      "cowrie-01",
+	} {
+		if got := failed.GetString(key); got != expected {
+			t.Errorf("Expected %s %q, got %q", key, expected, got)
+		}
+	}
+	if accepted, _ := events[1].Get("accepted"); accepted != true {
+		t.Errorf("Successful login should be accepted")
+	}
+	if events[2].Type != "command" || events[2].GetString("command") != "uname -a" {
+		t.Errorf("Unexpected command event: %+v", events[2])
+	}
+	// The port is forgotten with the closed session
+	if got := events[3].GetString("remote_addr"); got != "203.0.113.45" {
+		t.Errorf("Expected address without port, got %s", got)
+	}
+
+	if _, err := c.Convert([]byte(`{"eventid":"kippo.login.failed"}`)); err == nil {
+		t.Errorf("Expected error for a record of another program")
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package importer converts the logs of other honeypots and of sshd into
+// events, so that they can be analyzed like credential logs
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/enrich"
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Supported input formats
+const (
+	// FormatCowrie is the JSON log of the Cowrie honeypot
+	FormatCowrie = "cowrie"
+	// FormatAuthLog is the syslog output of OpenSSH, e.g. /var/log/auth.log
+	FormatAuthLog = "authlog"
+)
+
+// Converter turns the lines of a log into events
+type Converter interface {
+	// Convert returns the events of a line, none for lines without events
+	// of interest, or an error for lines that can not be parsed
+	Convert(line []byte) ([]*logger.Event, error)
+}
+
+// Config contains settings of the converters
+type Config struct {
+	// Timezone of timestamps without one, UTC if nil
+	Location *time.Location
+	// Year of syslog timestamps without one, the latest year that does not
+	// put them in the future if 0
+	Year int
+	// Current time, used for the year of syslog timestamps
+	Now time.Time
+	// Emit ioc events for the indicators of compromise found in commands
+	IOC bool
+}
+
+// NewConverter creates a converter of the given format
+func NewConverter(format string, config Config) (Converter, error) {
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	if config.Now.IsZero() {
+		config.Now = time.Now()
+	}
+
+	var converter Converter
+	switch format {
+	case FormatCowrie:
+		converter = newCowrie()
+	case FormatAuthLog:
+		converter = newAuthLog(config)
+	default:
+		return nil, fmt.Errorf("unknown import format: %s", format)
+	}
+	if config.IOC {
+		converter = iocConverter{converter}
+	}
+	return converter, nil
+}
+
+// iocConverter adds ioc events after the command events of a converter,
+// linked to them by their event ID. Events get their ID here, as they are
+// written without passing through a logger.
+type iocConverter struct {
+	Converter
+}
+
+func (c iocConverter) Convert(line []byte) ([]*logger.Event, error) {
+	events, err := c.Converter.Convert(line)
+	if err != nil {
+		return nil, err
+	}
+	var iocs []*logger.Event
+	for _, event := range events {
+		command := event.GetString("command")
+		if command == "" {
+			continue
+		}
+		if event.ID == "" {
+			event.ID = logger.NewEventID(event.Time)
+		}
+		for _, ioc := range enrich.NewIOCEvents(event, "command", enrich.ExtractIOCs(command)) {
+			ioc.ID = logger.NewEventID(ioc.Time)
+			iocs = append(iocs, ioc)
+		}
+	}
+	return append(events, iocs...), nil
+}
+
+// Result counts the lines of an import
+type Result struct {
+	// Lines read
+	Lines int
+	// Events converted
+	Events int
+	// Lines that could not be parsed
+	Invalid int
+}
+
+// Import converts the log in r line by line and calls fn for every event.
+// Gzip-compressed logs are decompressed transparently, lines that can not
+// be parsed are counted and skipped.
+func Import(r io.Reader, converter Converter, fn func(*logger.Event) error) (Result, error) {
+	var result Result
+	r, err := logger.Decompress(r)
+	if err != nil {
+		return result, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		result.Lines++
+		events, err := converter.Convert(line)
+		if err != nil {
+			result.Invalid++
+			continue
+		}
+		for _, event := range events {
+			result.Events++
+			if err := fn(event); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("failed to read log: %w", err)
+	}
+	return result, nil
+}
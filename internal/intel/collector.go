@@ -0,0 +1,241 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package intel packages the indicators observed by the honeypot, such as
+// attacker addresses, credentials and indicators of compromise, for threat
+// intelligence sharing
+package intel
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Source is an address attempts came from
+type Source struct {
+	Addr     netip.Addr
+	Attempts int
+	First    time.Time
+	Last     time.Time
+	Country  string
+}
+
+// Credential is a username and password pair tried by attackers
+type Credential struct {
+	Username string
+	Password string
+	Attempts int
+	First    time.Time
+	Last     time.Time
+}
+
+// Indicator is an indicator of compromise extracted from commands or
+// payloads, e.g. a download URL or a file hash
+type Indicator struct {
+	// Type as in ioc events: url, ip, domain, md5, sha1 or sha256
+	Type  string
+	Value string
+	// Number of ioc events with the indicator
+	Count int
+	First time.Time
+	Last  time.Time
+}
+
+// Collector gathers the indicators of events. Anonymized, private and local
+// addresses and masked passwords are left out as they are of no use to others.
+type Collector struct {
+	sources     map[netip.Addr]*Source
+	credentials map[[2]string]*Credential
+	indicators  map[[2]string]*Indicator
+	first       time.Time
+	last        time.Time
+}
+
+// NewCollector creates an empty collector
+func NewCollector() *Collector {
+	return &Collector{
+		sources:     make(map[netip.Addr]*Source),
+		credentials: make(map[[2]string]*Credential),
+		indicators:  make(map[[2]string]*Indicator),
+	}
+}
+
+// Add collects the indicators of authentication attempts and ioc events,
+// other events are ignored
+func (c *Collector) Add(event *logger.Event) {
+	switch event.Type {
+	case "auth_attempt":
+		c.addAttempt(event)
+	case "ioc":
+		c.addIndicator(event)
+	default:
+		return
+	}
+	if c.first.IsZero() || event.Time.Before(c.first) {
+		c.first = event.Time
+	}
+	if event.Time.After(c.last) {
+		c.last = event.Time
+	}
+}
+
+func (c *Collector) addAttempt(event *logger.Event) {
+	n := 1
+	if v, ok := event.Get("count"); ok {
+		if count, ok := v.(int); ok && count > 0 {
+			n = count
+		}
+	}
+
+	if mode := event.GetString("ip_mode"); mode == "" || mode == "none" {
+		// Private and local addresses are of no use outside the network
+		if addr, ok := eventAddr(event); ok && addr.IsGlobalUnicast() && !addr.IsPrivate() {
+			s := c.sources[addr]
+			if s == nil {
+				s = &Source{Addr: addr, First: event.Time, Last: event.Time}
+				c.sources[addr] = s
+			}
+			s.Attempts += n
+			s.First, s.Last = earliest(s.First, event.Time), latest(s.Last, event.Time)
+			if country := event.GetString("country"); country != "" {
+				s.Country = country
+			}
+		}
+	}
+
+	if _, ok := event.Get("password"); !ok {
+		return
+	}
+	if mode := event.GetString("password_mode"); mode != "" && mode != "plain" {
+		return
+	}
+	key := [2]string{event.GetString("username"), event.GetString("password")}
+	cred := c.credentials[key]
+	if cred == nil {
+		cred = &Credential{Username: key[0], Password: key[1], First: event.Time, Last: event.Time}
+		c.credentials[key] = cred
+	}
+	cred.Attempts += n
+	cred.First, cred.Last = earliest(cred.First, event.Time), latest(cred.Last, event.Time)
+}
+
+func (c *Collector) addIndicator(event *logger.Event) {
+	key := [2]string{event.GetString("ioc_type"), event.GetString("ioc_value")}
+	if key[0] == "" || key[1] == "" {
+		return
+	}
+	i := c.indicators[key]
+	if i == nil {
+		i = &Indicator{Type: key[0], Value: key[1], First: event.Time, Last: event.Time}
+		c.indicators[key] = i
+	}
+	i.Count++
+	i.First, i.Last = earliest(i.First, event.Time), latest(i.Last, event.Time)
+}
+
+// Period returns the times of the first and the last collected event
+func (c *Collector) Period() (first, last time.Time) {
+	return c.first, c.last
+}
+
+// Sources returns the sources with at least minAttempts attempts, the most
+// active first
+func (c *Collector) Sources(minAttempts int) []Source {
+	var sources []Source
+	for _, s := range c.sources {
+		if s.Attempts >= minAttempts {
+			sources = append(sources, *s)
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Attempts != sources[j].Attempts {
+			return sources[i].Attempts > sources[j].Attempts
+		}
+		return sources[i].Addr.Less(sources[j].Addr)
+	})
+	return sources
+}
+
+// Credentials returns the n most tried credentials, all if n is 0
+func (c *Collector) Credentials(n int) []Credential {
+	credentials := make([]Credential, 0, len(c.credentials))
+	for _, cred := range c.credentials {
+		credentials = append(credentials, *cred)
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		a, b := credentials[i], credentials[j]
+		if a.Attempts != b.Attempts {
+			return a.Attempts > b.Attempts
+		}
+		if a.Username != b.Username {
+			return a.Username < b.Username
+		}
+		return a.Password < b.Password
+	})
+	if n > 0 && len(credentials) > n {
+		credentials = credentials[:n]
+	}
+	return credentials
+}
+
+// Indicators returns the indicators of compromise ordered by type and value
+func (c *Collector) Indicators() []Indicator {
+	indicators := make([]Indicator, 0, len(c.indicators))
+	for _, i := range c.indicators {
+		indicators = append(indicators, *i)
+	}
+	sort.Slice(indicators, func(i, j int) bool {
+		if indicators[i].Type != indicators[j].Type {
+			return indicators[i].Type < indicators[j].Type
+		}
+		return indicators[i].Value < indicators[j].Value
+	})
+	return indicators
+}
+
+// eventAddr returns the source address of an event without the port
+func eventAddr(event *logger.Event) (netip.Addr, bool) {
+	host := event.GetString("remote_addr")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return addr, false
+	}
+	return addr.Unmap(), true
+}
+
+func earliest(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
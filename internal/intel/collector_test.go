@@ -0,0 +1,77 @@
+package intel
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func attempt(addr, username, password string, at time.Time) *logger.Event {
+	return logger.NewAuthEvent(logger.CredentialAttempt{Timestamp: at, RemoteAddr: addr, Username: username, Password: password})
+}
+
+func ioc(kind, value string, at time.Time) *logger.Event {
+	event := &logger.Event{Type: "ioc", Time: at}
+	event.Set("ioc_type", kind)
+	event.Set("ioc_value", value)
+	return event
+}
+
+// testCollector returns a collector with two sources, two credentials and
+// two indicators between at and an hour later
+func testCollector(at time.Time) *Collector {
+	c := NewCollector()
+	first := attempt("192.0.2.1:4000", "root", "123456", at)
+	first.Set("country", "CN")
+	c.Add(first)
+	aggregated := attempt("192.0.2.1:4001", "root", "123456", at.Add(time.Hour))
+	aggregated.Set("count", 3)
+	c.Add(aggregated)
+	c.Add(attempt("[2001:db8::1]:22", "admin", "admin", at.Add(time.Minute)))
+	c.Add(ioc("url", "http://198.51.100.1/x.sh", at.Add(time.Minute)))
+	c.Add(ioc("sha256", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", at.Add(time.Minute)))
+	return c
+}
+
+func TestCollector(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := testCollector(at)
+
+	anonymized := attempt("192.0.2.0:1", "root", "5e88", at)
+	anonymized.Set("ip_mode", "truncate")
+	anonymized.Set("password_mode", "sha256")
+	c.Add(anonymized)
+	c.Add(attempt("10.0.0.1:22", "admin", "admin", at))
+	c.Add(&logger.Event{Type: "heartbeat", Time: at.Add(24 * time.Hour)})
+
+	sources := c.Sources(1)
+	if len(sources) != 2 || sources[0].Addr != netip.MustParseAddr("192.0.2.1") || sources[0].Attempts != 4 || sources[0].Country != "CN" {
+		t.Errorf("Unexpected sources: %+v", sources)
+	}
+	if !sources[0].First.Equal(at) || !sources[0].Last.Equal(at.Add(time.Hour)) {
+		t.Errorf("Unexpected source period: %v - %v", sources[0].First, sources[0].Last)
+	}
+	if len(c.Sources(2)) != 1 {
+		t.Errorf("Expected 1 source with 2 attempts")
+	}
+
+	credentials := c.Credentials(1)
+	if len(credentials) != 1 || credentials[0].Username != "root" || credentials[0].Attempts != 4 {
+		t.Errorf("Unexpected credentials: %+v", credentials)
+	}
+	if len(c.Credentials(0)) != 2 {
+		t.Errorf("Masked passwords should be left out")
+	}
+
+	indicators := c.Indicators()
+	if len(indicators) != 2 || indicators[0].Type != "sha256" || indicators[1].Type != "url" {
+		t.Errorf("Unexpected indicators: %+v", indicators)
+	}
+
+	first, last := c.Period()
+	if !first.Equal(at) || !last.Equal(at.Add(time.Hour)) {
+		t.Errorf("Unexpected period: %v - %v", first, last)
+	}
+}
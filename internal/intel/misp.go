@@ -0,0 +1,229 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package intel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Template of MISP credential objects
+const mispCredentialTemplate = "a27e98c9-9b0e-414c-8076-d201e039ca09"
+
+// MISP attribute types and categories of indicator types
+var mispIndicatorTypes = map[string][2]string{
+	"url":    {"url", "Network activity"},
+	"domain": {"domain", "Network activity"},
+	"ip":     {"ip-dst", "Network activity"},
+	"md5":    {"md5", "Payload delivery"},
+	"sha1":   {"sha1", "Payload delivery"},
+	"sha256": {"sha256", "Payload delivery"},
+}
+
+// MISPConfig contains settings of MISP events
+type MISPConfig struct {
+	// Event description
+	Info string
+	// Tags of the event, e.g. "tlp:green"
+	Tags []string
+	// Distribution: 0 organisation, 1 community, 2 connected communities, 3 all
+	Distribution int
+	// Threat level: 1 high, 2 medium, 3 low, 4 undefined
+	ThreatLevel int
+	// Attempts of a source before its address is included
+	MinAttempts int
+	// Number of most tried credentials included, all if 0
+	Credentials int
+}
+
+// MISPEvent is an event in the MISP JSON format
+type MISPEvent struct {
+	Event mispEvent `json:"Event"`
+}
+
+type mispEvent struct {
+	UUID          string          `json:"uuid"`
+	Info          string          `json:"info"`
+	Date          string          `json:"date"`
+	Timestamp     string          `json:"timestamp"`
+	ThreatLevelID string          `json:"threat_level_id"`
+	Analysis      string          `json:"analysis"`
+	Distribution  string          `json:"distribution"`
+	Published     bool            `json:"published"`
+	Tag           []mispTag       `json:"Tag,omitempty"`
+	Attribute     []mispAttribute `json:"Attribute"`
+	Object        []mispObject    `json:"Object"`
+}
+
+type mispTag struct {
+	Name string `json:"name"`
+}
+
+type mispAttribute struct {
+	Type           string `json:"type"`
+	Category       string `json:"category,omitempty"`
+	ObjectRelation string `json:"object_relation,omitempty"`
+	Value          string `json:"value"`
+	ToIDS          bool   `json:"to_ids"`
+	Comment        string `json:"comment,omitempty"`
+	FirstSeen      string `json:"first_seen,omitempty"`
+	LastSeen       string `json:"last_seen,omitempty"`
+}
+
+type mispObject struct {
+	Name         string          `json:"name"`
+	MetaCategory string          `json:"meta-category"`
+	TemplateUUID string          `json:"template_uuid"`
+	Comment      string          `json:"comment,omitempty"`
+	FirstSeen    string          `json:"first_seen,omitempty"`
+	LastSeen     string          `json:"last_seen,omitempty"`
+	Attribute    []mispAttribute `json:"Attribute"`
+}
+
+// NewMISPEvent packages the collected indicators into an unpublished MISP
+// event: source addresses as ip-src attributes, indicators of compromise as
+// attributes of their type, and credentials as credential objects
+func NewMISPEvent(c *Collector, config MISPConfig, created time.Time) *MISPEvent {
+	first, last := c.Period()
+	info := config.Info
+	if info == "" {
+		info = "fakessh SSH honeypot activity"
+		if !first.IsZero() {
+			info += fmt.Sprintf(" %s to %s", first.UTC().Format(time.DateOnly), last.UTC().Format(time.DateOnly))
+		}
+	}
+
+	event := mispEvent{
+		UUID:          logger.NewEventID(created),
+		Info:          info,
+		Date:          created.UTC().Format(time.DateOnly),
+		Timestamp:     strconv.FormatInt(created.Unix(), 10),
+		ThreatLevelID: strconv.Itoa(config.ThreatLevel),
+		// Analysis completed
+		Analysis:     "2",
+		Distribution: strconv.Itoa(config.Distribution),
+		Attribute:    []mispAttribute{},
+		Object:       []mispObject{},
+	}
+	for _, tag := range config.Tags {
+		event.Tag = append(event.Tag, mispTag{Name: tag})
+	}
+
+	for _, s := range c.Sources(config.MinAttempts) {
+		comment := fmt.Sprintf("%d SSH login attempts", s.Attempts)
+		if s.Attempts == 1 {
+			comment = "1 SSH login attempt"
+		}
+		if s.Country != "" {
+			comment += " from " + s.Country
+		}
+		event.Attribute = append(event.Attribute, mispAttribute{
+			Type:      "ip-src",
+			Category:  "Network activity",
+			Value:     s.Addr.String(),
+			ToIDS:     true,
+			Comment:   comment,
+			FirstSeen: mispTime(s.First),
+			LastSeen:  mispTime(s.Last),
+		})
+	}
+
+	for _, i := range c.Indicators() {
+		kind, ok := mispIndicatorTypes[i.Type]
+		if !ok {
+			continue
+		}
+		event.Attribute = append(event.Attribute, mispAttribute{
+			Type:      kind[0],
+			Category:  kind[1],
+			Value:     i.Value,
+			ToIDS:     true,
+			Comment:   "Found in attacker commands",
+			FirstSeen: mispTime(i.First),
+			LastSeen:  mispTime(i.Last),
+		})
+	}
+
+	for _, cred := range c.Credentials(config.Credentials) {
+		event.Object = append(event.Object, mispObject{
+			Name:         "credential",
+			MetaCategory: "misc",
+			TemplateUUID: mispCredentialTemplate,
+			Comment:      fmt.Sprintf("Tried %d times against an SSH honeypot", cred.Attempts),
+			FirstSeen:    mispTime(cred.First),
+			LastSeen:     mispTime(cred.Last),
+			Attribute: []mispAttribute{
+				{Type: "text", ObjectRelation: "username", Value: cred.Username},
+				{Type: "text", ObjectRelation: "password", Value: cred.Password},
+			},
+		})
+	}
+
+	return &MISPEvent{Event: event}
+}
+
+// mispTime formats first and last seen times
+func mispTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// PushMISP creates the event on a MISP server with the API key of a user
+// allowed to add events, and returns its ID
+func PushMISP(ctx context.Context, client *http.Client, server, key string, event *MISPEvent) (string, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(server, "/")+"/events/add", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", key)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var created struct {
+		Event struct {
+			ID string `json:"id"`
+		} `json:"Event"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("invalid response: %w", err)
+	}
+	return created.Event.ID, nil
+}
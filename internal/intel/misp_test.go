@@ -0,0 +1,80 @@
+package intel
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMISPEvent(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := NewMISPEvent(testCollector(at), MISPConfig{
+		Tags:        []string{"tlp:green"},
+		ThreatLevel: 3,
+		MinAttempts: 1,
+		Credentials: 1,
+	}, at.Add(48*time.Hour))
+
+	e := event.Event
+	if e.Info != "fakessh SSH honeypot activity 2024-01-01 to 2024-01-01" || e.Date != "2024-01-03" {
+		t.Errorf("Unexpected event: %+v", e)
+	}
+	if e.ThreatLevelID != "3" || e.Distribution != "0" || e.Published || len(e.Tag) != 1 {
+		t.Errorf("Unexpected event settings: %+v", e)
+	}
+
+	types := make(map[string]string)
+	for _, a := range e.Attribute {
+		types[a.Value] = a.Type + "/" + a.Category
+	}
+	expected := map[string]string{
+		"192.0.2.1":                "ip-src/Network activity",
+		"2001:db8::1":              "ip-src/Network activity",
+		"http://198.51.100.1/x.sh": "url/Network activity",
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855": "sha256/Payload delivery",
+	}
+	if len(types) != len(expected) {
+		t.Errorf("Unexpected attributes: %v", types)
+	}
+	for value, kind := range expected {
+		if types[value] != kind {
+			t.Errorf("Expected %s for %s, got %s", kind, value, types[value])
+		}
+	}
+
+	if len(e.Object) != 1 || e.Object[0].Name != "credential" || e.Object[0].Attribute[1].Value != "123456" {
+		t.Errorf("Unexpected objects: %+v", e.Object)
+	}
+}
+
+func TestPushMISP(t *testing.T) {
+	var received MISPEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events/add" || r.Header.Get("Authorization") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"message":"Authentication failed"}`)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		io.WriteString(w, `{"Event":{"id":"42"}}`)
+	}))
+	defer server.Close()
+
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := NewMISPEvent(testCollector(at), MISPConfig{Info: "test"}, at)
+	id, err := PushMISP(context.Background(), server.Client(), server.URL+"/", "secret", event)
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if id != "42" || received.Event.Info != "test" {
+		t.Errorf("Unexpected push: id %s, event %+v", id, received.Event)
+	}
+
+	if _, err := PushMISP(context.Background(), server.Client(), server.URL, "wrong", event); err == nil {
+		t.Errorf("Expected error for rejected key")
+	}
+}
@@ -0,0 +1,290 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package intel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Namespace of the deterministic IDs of STIX cyber observables
+var stixNamespace = [16]byte{0x00, 0xab, 0xed, 0xb4, 0xaa, 0x42, 0x46, 0x6c, 0x9c, 0x01, 0xfe, 0xd2, 0x33, 0x15, 0xa9, 0xb7}
+
+// STIX hash names of indicator types
+var stixHashes = map[string]string{
+	"md5":    "MD5",
+	"sha1":   "SHA-1",
+	"sha256": "SHA-256",
+}
+
+// STIXConfig contains settings of STIX bundles
+type STIXConfig struct {
+	// Name of the identity sighting the observables, e.g. the sensor
+	Identity string
+	// Attempts of a source before its address is included
+	MinAttempts int
+	// Number of most tried credentials included, all if 0
+	Credentials int
+}
+
+// STIXBundle is a STIX 2.1 bundle
+type STIXBundle struct {
+	Type    string       `json:"type"`
+	ID      string       `json:"id"`
+	Objects []stixObject `json:"objects"`
+}
+
+// stixObject holds the properties of all the object types in bundles
+type stixObject struct {
+	Type             string            `json:"type"`
+	SpecVersion      string            `json:"spec_version"`
+	ID               string            `json:"id"`
+	Created          string            `json:"created,omitempty"`
+	Modified         string            `json:"modified,omitempty"`
+	CreatedByRef     string            `json:"created_by_ref,omitempty"`
+	Name             string            `json:"name,omitempty"`
+	IdentityClass    string            `json:"identity_class,omitempty"`
+	Value            string            `json:"value,omitempty"`
+	AccountLogin     string            `json:"account_login,omitempty"`
+	Credential       string            `json:"credential,omitempty"`
+	Hashes           map[string]string `json:"hashes,omitempty"`
+	IndicatorTypes   []string          `json:"indicator_types,omitempty"`
+	Pattern          string            `json:"pattern,omitempty"`
+	PatternType      string            `json:"pattern_type,omitempty"`
+	ValidFrom        string            `json:"valid_from,omitempty"`
+	FirstObserved    string            `json:"first_observed,omitempty"`
+	LastObserved     string            `json:"last_observed,omitempty"`
+	NumberObserved   int               `json:"number_observed,omitempty"`
+	ObjectRefs       []string          `json:"object_refs,omitempty"`
+	SightingOfRef    string            `json:"sighting_of_ref,omitempty"`
+	ObservedDataRefs []string          `json:"observed_data_refs,omitempty"`
+	WhereSightedRefs []string          `json:"where_sighted_refs,omitempty"`
+	FirstSeen        string            `json:"first_seen,omitempty"`
+	LastSeen         string            `json:"last_seen,omitempty"`
+	Count            int               `json:"count,omitempty"`
+}
+
+// observation is an observable with when and how often it was seen
+type observation struct {
+	observable stixObject
+	pattern    string
+	name       string
+	count      int
+	first      time.Time
+	last       time.Time
+}
+
+// NewSTIXBundle packages the collected indicators into a STIX 2.1 bundle.
+// Every observable (ipv4-addr and ipv6-addr of sources, user-account of
+// credentials, file hashes, url and domain-name of indicators of
+// compromise) comes with an indicator matching it, the observed data and a
+// sighting by the identity of the honeypot.
+func NewSTIXBundle(c *Collector, config STIXConfig, created time.Time) *STIXBundle {
+	now := stixTime(created)
+	identity := stixObject{
+		Type:          "identity",
+		SpecVersion:   "2.1",
+		ID:            "identity--" + uuid5(stixNamespace, "identity:"+config.Identity),
+		Created:       now,
+		Modified:      now,
+		Name:          config.Identity,
+		IdentityClass: "system",
+	}
+	bundle := &STIXBundle{
+		Type:    "bundle",
+		ID:      "bundle--" + uuid4(),
+		Objects: []stixObject{identity},
+	}
+
+	var observations []observation
+	for _, s := range c.Sources(config.MinAttempts) {
+		kind := "ipv4-addr"
+		if s.Addr.Is6() {
+			kind = "ipv6-addr"
+		}
+		observations = append(observations, observation{
+			observable: stixObservable(kind, map[string]interface{}{"value": s.Addr.String()}),
+			pattern:    fmt.Sprintf("[%s:value = %s]", kind, stixString(s.Addr.String())),
+			name:       "SSH brute force source " + s.Addr.String(),
+			count:      s.Attempts,
+			first:      s.First,
+			last:       s.Last,
+		})
+	}
+	for _, cred := range c.Credentials(config.Credentials) {
+		// The credential is part of the ID, so that the pairs of a login
+		// are distinct objects
+		observable := stixObservable("user-account", map[string]interface{}{"account_login": cred.Username, "credential": cred.Password})
+		observable.Credential = cred.Password
+		observations = append(observations, observation{
+			observable: observable,
+			pattern:    fmt.Sprintf("[user-account:account_login = %s AND user-account:credential = %s]", stixString(cred.Username), stixString(cred.Password)),
+			name:       "Credential tried against SSH honeypot for " + cred.Username,
+			count:      cred.Attempts,
+			first:      cred.First,
+			last:       cred.Last,
+		})
+	}
+	for _, i := range c.Indicators() {
+		o := observation{count: i.Count, first: i.First, last: i.Last}
+		switch i.Type {
+		case "url":
+			o.observable = stixObservable("url", map[string]interface{}{"value": i.Value})
+			o.pattern = fmt.Sprintf("[url:value = %s]", stixString(i.Value))
+		case "domain":
+			o.observable = stixObservable("domain-name", map[string]interface{}{"value": i.Value})
+			o.pattern = fmt.Sprintf("[domain-name:value = %s]", stixString(i.Value))
+		case "ip":
+			kind := "ipv4-addr"
+			if strings.Contains(i.Value, ":") {
+				kind = "ipv6-addr"
+			}
+			o.observable = stixObservable(kind, map[string]interface{}{"value": i.Value})
+			o.pattern = fmt.Sprintf("[%s:value = %s]", kind, stixString(i.Value))
+		default:
+			hash, ok := stixHashes[i.Type]
+			if !ok {
+				continue
+			}
+			o.observable = stixObservable("file", map[string]interface{}{"hashes": map[string]string{hash: i.Value}})
+			o.pattern = fmt.Sprintf("[file:hashes.'%s' = %s]", hash, stixString(i.Value))
+		}
+		o.name = fmt.Sprintf("%s found in attacker commands: %s", i.Type, i.Value)
+		observations = append(observations, o)
+	}
+
+	seen := make(map[string]bool)
+	for _, o := range observations {
+		// An address can be both a source and an indicator
+		if !seen[o.observable.ID] {
+			seen[o.observable.ID] = true
+			bundle.Objects = append(bundle.Objects, o.observable)
+		}
+		indicator := stixObject{
+			Type:           "indicator",
+			SpecVersion:    "2.1",
+			ID:             "indicator--" + uuid5(stixNamespace, "indicator:"+o.pattern),
+			Created:        now,
+			Modified:       now,
+			CreatedByRef:   identity.ID,
+			Name:           o.name,
+			IndicatorTypes: []string{"malicious-activity"},
+			Pattern:        o.pattern,
+			PatternType:    "stix",
+			ValidFrom:      stixTime(o.first),
+		}
+		observed := stixObject{
+			Type:           "observed-data",
+			SpecVersion:    "2.1",
+			ID:             "observed-data--" + uuid4(),
+			Created:        now,
+			Modified:       now,
+			CreatedByRef:   identity.ID,
+			FirstObserved:  stixTime(o.first),
+			LastObserved:   stixTime(o.last),
+			NumberObserved: o.count,
+			ObjectRefs:     []string{o.observable.ID},
+		}
+		sighting := stixObject{
+			Type:             "sighting",
+			SpecVersion:      "2.1",
+			ID:               "sighting--" + uuid4(),
+			Created:          now,
+			Modified:         now,
+			CreatedByRef:     identity.ID,
+			SightingOfRef:    indicator.ID,
+			ObservedDataRefs: []string{observed.ID},
+			WhereSightedRefs: []string{identity.ID},
+			FirstSeen:        stixTime(o.first),
+			LastSeen:         stixTime(o.last),
+			Count:            o.count,
+		}
+		bundle.Objects = append(bundle.Objects, indicator, observed, sighting)
+	}
+	return bundle
+}
+
+// stixObservable creates a cyber observable with the ID derived from its
+// ID contributing properties
+func stixObservable(kind string, properties map[string]interface{}) stixObject {
+	// Maps are marshalled with sorted keys, the canonical form of these
+	// properties
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(properties)
+
+	o := stixObject{
+		Type:        kind,
+		SpecVersion: "2.1",
+		ID:          kind + "--" + uuid5(stixNamespace, strings.TrimSpace(buf.String())),
+	}
+	if v, ok := properties["value"].(string); ok {
+		o.Value = v
+	}
+	if v, ok := properties["account_login"].(string); ok {
+		o.AccountLogin = v
+	}
+	if v, ok := properties["hashes"].(map[string]string); ok {
+		o.Hashes = v
+	}
+	return o
+}
+
+// stixString quotes a string for STIX patterns
+func stixString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// stixTime formats timestamps with millisecond precision
+func stixTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// uuid4 returns a random UUID
+func uuid4() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = 0x40 | u[6]&0x0f
+	u[8] = 0x80 | u[8]&0x3f
+	return formatUUID(u)
+}
+
+// uuid5 returns the name-based UUID of a name in a namespace
+func uuid5(namespace [16]byte, name string) string {
+	h := sha1.New()
+	h.Write(namespace[:])
+	h.Write([]byte(name))
+	var u [16]byte
+	copy(u[:], h.Sum(nil))
+	u[6] = 0x50 | u[6]&0x0f
+	u[8] = 0x80 | u[8]&0x3f
+	return formatUUID(u)
+}
+
+func formatUUID(u [16]byte) string {
+	s := hex.EncodeToString(u[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
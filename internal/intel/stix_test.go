@@ -0,0 +1,105 @@
+package intel
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSTIXBundle(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	config := STIXConfig{Identity: "sensor-1", MinAttempts: 1, Credentials: 1}
+	bundle := NewSTIXBundle(testCollector(at), config, at.Add(48*time.Hour))
+
+	if bundle.Type != "bundle" || !strings.HasPrefix(bundle.ID, "bundle--") {
+		t.Errorf("Unexpected bundle: %s %s", bundle.Type, bundle.ID)
+	}
+	identity := bundle.Objects[0]
+	if identity.Type != "identity" || identity.Name != "sensor-1" || identity.Created != "2024-01-03T00:00:00.000Z" {
+		t.Errorf("Unexpected identity: %+v", identity)
+	}
+
+	objects := make(map[string]stixObject)
+	types := make(map[string]int)
+	for _, o := range bundle.Objects {
+		if _, ok := objects[o.ID]; ok {
+			t.Errorf("Duplicate object %s", o.ID)
+		}
+		if o.SpecVersion != "2.1" || !strings.HasPrefix(o.ID, o.Type+"--") {
+			t.Errorf("Invalid object: %+v", o)
+		}
+		objects[o.ID] = o
+		types[o.Type]++
+	}
+	// Two sources, one credential, one url and one hash
+	expected := map[string]int{
+		"identity":      1,
+		"ipv4-addr":     1,
+		"ipv6-addr":     1,
+		"user-account":  1,
+		"url":           1,
+		"file":          1,
+		"indicator":     5,
+		"observed-data": 5,
+		"sighting":      5,
+	}
+	for kind, n := range expected {
+		if types[kind] != n {
+			t.Errorf("Expected %d %s objects, got %d", n, kind, types[kind])
+		}
+	}
+
+	for _, o := range bundle.Objects {
+		switch o.Type {
+		case "user-account":
+			if o.AccountLogin != "root" || o.Credential != "123456" {
+				t.Errorf("Unexpected account: %+v", o)
+			}
+		case "file":
+			if o.Hashes["SHA-256"] != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+				t.Errorf("Unexpected hashes: %v", o.Hashes)
+			}
+		case "sighting":
+			indicator := objects[o.SightingOfRef]
+			observed := objects[o.ObservedDataRefs[0]]
+			if indicator.Type != "indicator" || observed.Type != "observed-data" || o.WhereSightedRefs[0] != identity.ID {
+				t.Errorf("Unresolved sighting references: %+v", o)
+			}
+			if _, ok := objects[observed.ObjectRefs[0]]; !ok || observed.NumberObserved != o.Count {
+				t.Errorf("Unexpected observed data: %+v", observed)
+			}
+			if indicator.Pattern == "[ipv4-addr:value = '192.0.2.1']" &&
+				(o.Count != 4 || o.FirstSeen != "2024-01-01T00:00:00.000Z" || o.LastSeen != "2024-01-01T01:00:00.000Z") {
+				t.Errorf("Unexpected sighting of the source: %+v", o)
+			}
+		}
+	}
+
+	// Observables and indicators keep their IDs across exports
+	again := NewSTIXBundle(testCollector(at), config, at.Add(72*time.Hour))
+	for _, o := range again.Objects {
+		switch o.Type {
+		case "identity", "ipv4-addr", "ipv6-addr", "user-account", "url", "file", "indicator":
+			if _, ok := objects[o.ID]; !ok {
+				t.Errorf("ID of %s %s changed", o.Type, o.ID)
+			}
+		}
+	}
+}
+
+func TestSTIXString(t *testing.T) {
+	if s := stixString(`it's a \ test`); s != `'it\'s a \\ test'` {
+		t.Errorf("Unexpected pattern string %s", s)
+	}
+}
+
+func TestUUID(t *testing.T) {
+	// Test vector of RFC 9562 (DNS namespace, "www.example.com")
+	dns := [16]byte{0x6b, 0xa7, 0xb8, 0x10, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+	if u := uuid5(dns, "www.example.com"); u != "2ed6657d-e927-568b-95e1-2665a8aea6a2" {
+		t.Errorf("Unexpected UUIDv5 %s", u)
+	}
+	if u := uuid4(); len(u) != 36 || u[14] != '4' || !strings.ContainsRune("89ab", rune(u[19])) {
+		t.Errorf("Invalid UUIDv4 %s", u)
+	}
+}
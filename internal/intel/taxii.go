@@ -0,0 +1,192 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package intel
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Media types of TAXII 2.1 responses and of the STIX objects they carry
+const (
+	taxiiMediaType = "application/taxii+json;version=2.1"
+	stixMediaType  = "application/stix+json;version=2.1"
+)
+
+// TAXIIConfig contains settings of the TAXII server
+type TAXIIConfig struct {
+	// Title of the server and of its collection
+	Title string
+	// Credentials of HTTP basic authentication, none if the username is empty
+	Username string
+	Password string
+}
+
+// TAXII serves the objects of a STIX bundle as the only collection of a
+// read-only TAXII 2.1 API root at /api/, with discovery at /taxii2/
+type TAXII struct {
+	config     TAXIIConfig
+	collection string
+	mux        *http.ServeMux
+
+	mu     sync.RWMutex
+	bundle *STIXBundle
+}
+
+// taxiiCollection describes the collection
+type taxiiCollection struct {
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	CanRead    bool     `json:"can_read"`
+	CanWrite   bool     `json:"can_write"`
+	MediaTypes []string `json:"media_types"`
+}
+
+// NewTAXII creates a TAXII server with an empty collection
+func NewTAXII(config TAXIIConfig) *TAXII {
+	t := &TAXII{
+		config:     config,
+		collection: uuid5(stixNamespace, "collection:"+config.Title),
+		mux:        http.NewServeMux(),
+		bundle:     &STIXBundle{},
+	}
+	t.mux.HandleFunc("GET /taxii2/", t.discovery)
+	t.mux.HandleFunc("GET /api/", t.apiRoot)
+	t.mux.HandleFunc("GET /api/collections/", t.collections)
+	t.mux.HandleFunc("GET /api/collections/{id}/", t.collectionInfo)
+	t.mux.HandleFunc("GET /api/collections/{id}/objects/", t.objects)
+	return t
+}
+
+// Update replaces the objects of the collection
+func (t *TAXII) Update(bundle *STIXBundle) {
+	t.mu.Lock()
+	t.bundle = bundle
+	t.mu.Unlock()
+}
+
+// ServeHTTP checks the credentials and serves the TAXII endpoints
+func (t *TAXII) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if t.config.Username != "" {
+		username, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(username), []byte(t.config.Username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(t.config.Password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fakessh"`)
+			t.error(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+	}
+	t.mux.ServeHTTP(w, r)
+}
+
+func (t *TAXII) discovery(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/taxii2/" {
+		t.error(w, http.StatusNotFound, "not found")
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	root := scheme + "://" + r.Host + "/api/"
+	t.write(w, map[string]interface{}{
+		"title":     t.config.Title,
+		"default":   root,
+		"api_roots": []string{root},
+	})
+}
+
+func (t *TAXII) apiRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/" {
+		t.error(w, http.StatusNotFound, "not found")
+		return
+	}
+	t.write(w, map[string]interface{}{
+		"title":              t.config.Title,
+		"versions":           []string{taxiiMediaType},
+		"max_content_length": 0,
+	})
+}
+
+func (t *TAXII) collections(w http.ResponseWriter, r *http.Request) {
+	t.write(w, map[string]interface{}{
+		"collections": []taxiiCollection{t.describe()},
+	})
+}
+
+func (t *TAXII) collectionInfo(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("id") != t.collection {
+		t.error(w, http.StatusNotFound, "unknown collection")
+		return
+	}
+	t.write(w, t.describe())
+}
+
+// objects returns the objects of the collection, optionally only those of
+// the types given with match[type]
+func (t *TAXII) objects(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("id") != t.collection {
+		t.error(w, http.StatusNotFound, "unknown collection")
+		return
+	}
+	types := make(map[string]bool)
+	for _, v := range r.URL.Query()["match[type]"] {
+		for _, kind := range strings.Split(v, ",") {
+			types[kind] = true
+		}
+	}
+
+	t.mu.RLock()
+	objects := make([]stixObject, 0, len(t.bundle.Objects))
+	for _, o := range t.bundle.Objects {
+		if len(types) == 0 || types[o.Type] {
+			objects = append(objects, o)
+		}
+	}
+	t.mu.RUnlock()
+
+	t.write(w, map[string]interface{}{
+		"more":    false,
+		"objects": objects,
+	})
+}
+
+func (t *TAXII) describe() taxiiCollection {
+	return taxiiCollection{
+		ID:         t.collection,
+		Title:      t.config.Title,
+		CanRead:    true,
+		MediaTypes: []string{stixMediaType},
+	}
+}
+
+func (t *TAXII) write(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", taxiiMediaType)
+	json.NewEncoder(w).Encode(v)
+}
+
+// error writes a TAXII error message
+func (t *TAXII) error(w http.ResponseWriter, status int, title string) {
+	w.Header().Set("Content-Type", taxiiMediaType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"title": title})
+}
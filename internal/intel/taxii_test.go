@@ -0,0 +1,77 @@
+package intel
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTAXII(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	taxii := NewTAXII(TAXIIConfig{Title: "fakessh", Username: "user", Password: "secret"})
+	taxii.Update(NewSTIXBundle(testCollector(at), STIXConfig{Identity: "fakessh", MinAttempts: 1}, at))
+	server := httptest.NewServer(taxii)
+	defer server.Close()
+
+	get := func(path string, v interface{}) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.SetBasicAuth("user", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != taxiiMediaType {
+			t.Errorf("Unexpected content type %s", ct)
+		}
+		if v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	resp, err := http.Get(server.URL + "/taxii2/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected authentication to be required, got %d", resp.StatusCode)
+	}
+
+	var discovery struct {
+		APIRoots []string `json:"api_roots"`
+	}
+	if get("/taxii2/", &discovery); len(discovery.APIRoots) != 1 || discovery.APIRoots[0] != server.URL+"/api/" {
+		t.Errorf("Unexpected discovery: %+v", discovery)
+	}
+
+	var collections struct {
+		Collections []taxiiCollection `json:"collections"`
+	}
+	get("/api/collections/", &collections)
+	if len(collections.Collections) != 1 || !collections.Collections[0].CanRead || collections.Collections[0].CanWrite {
+		t.Fatalf("Unexpected collections: %+v", collections)
+	}
+	id := collections.Collections[0].ID
+
+	var envelope struct {
+		More    bool         `json:"more"`
+		Objects []stixObject `json:"objects"`
+	}
+	if status := get("/api/collections/"+id+"/objects/?match[type]=ipv4-addr,ipv6-addr", &envelope); status != http.StatusOK {
+		t.Fatalf("Unexpected status %d", status)
+	}
+	if envelope.More || len(envelope.Objects) != 2 {
+		t.Errorf("Unexpected envelope: %+v", envelope)
+	}
+
+	if status := get("/api/collections/unknown/objects/", nil); status != http.StatusNotFound {
+		t.Errorf("Expected unknown collection to be not found, got %d", status)
+	}
+}
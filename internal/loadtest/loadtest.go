@@ -0,0 +1,197 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package loadtest generates SSH login attempts against a server at a fixed
+// rate, for capacity planning and regression tests under load
+package loadtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Usernames cycled through by the simulated clients
+var usernames = []string{"root", "admin", "user", "test", "ubuntu", "oracle", "postgres", "git"}
+
+// Config contains settings of a load test
+type Config struct {
+	// Address of the server, host:port
+	Target string
+	// Connections started per second
+	Rate float64
+	// Maximum number of connections open at the same time
+	Concurrency int
+	// Password attempts per connection
+	AttemptsPerConn int
+	// How long connections are started
+	Duration time.Duration
+	// Timeout of a single connection
+	Timeout time.Duration
+}
+
+// Result summarizes a load test
+type Result struct {
+	// Connections started
+	Connections int
+	// Connections whose attempts were all rejected, as expected
+	Rejected int
+	// Connections that failed before or during authentication
+	Errors int
+	// Most recent connection error
+	LastError string
+	// Connections not started because Concurrency were already open
+	Skipped int
+	// Time from the first connection to the last one finished
+	Elapsed time.Duration
+	// Latency of completed connections
+	Latency Latency
+}
+
+// Latency summarizes the duration of connections
+type Latency struct {
+	Min, Mean, P50, P95, Max time.Duration
+}
+
+// Run starts connections at the configured rate until the duration ends
+// or ctx is cancelled, waits for the open ones and returns the summary
+func Run(ctx context.Context, config Config) (Result, error) {
+	if config.Rate <= 0 || config.Concurrency <= 0 || config.AttemptsPerConn <= 0 {
+		return Result{}, errors.New("rate, concurrency and attempts per connection must be positive")
+	}
+
+	var (
+		mu        sync.Mutex
+		result    Result
+		latencies []time.Duration
+		wg        sync.WaitGroup
+	)
+	slots := make(chan struct{}, config.Concurrency)
+
+	ctx, cancel := context.WithTimeout(ctx, config.Duration)
+	defer cancel()
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / config.Rate))
+	defer ticker.Stop()
+
+	start := time.Now()
+loop:
+	for n := 0; ; n++ {
+		select {
+		case slots <- struct{}{}:
+			result.Connections++
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				begin := time.Now()
+				err := attempt(config, usernames[n%len(usernames)])
+				elapsed := time.Since(begin)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					result.Errors++
+					result.LastError = err.Error()
+					return
+				}
+				result.Rejected++
+				latencies = append(latencies, elapsed)
+			}(n)
+		default:
+			result.Skipped++
+		}
+
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+		}
+	}
+	wg.Wait()
+
+	result.Elapsed = time.Since(start)
+	result.Latency = summarize(latencies)
+	return result, nil
+}
+
+// attempt opens a connection and tries passwords until the server gives up
+// or every attempt is rejected
+func attempt(config Config, username string) error {
+	passwords := 0
+	password := ssh.PasswordCallback(func() (string, error) {
+		passwords++
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(b), nil
+	})
+
+	conn, err := net.DialTimeout("tcp", config.Target, config.Timeout)
+	if err != nil {
+		return fmt.Errorf("connection error: %w", err)
+	}
+	defer conn.Close()
+	// The timeout covers the handshake and all attempts
+	conn.SetDeadline(time.Now().Add(config.Timeout))
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, config.Target, &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{ssh.RetryableAuthMethod(password, config.AttemptsPerConn)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err == nil {
+		ssh.NewClient(c, chans, reqs).Close()
+		return errors.New("authentication was accepted")
+	}
+	if passwords > 0 && strings.Contains(err.Error(), "unable to authenticate") {
+		return nil
+	}
+	return fmt.Errorf("connection error: %w", err)
+}
+
+// summarize computes the latency summary
+func summarize(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var sum time.Duration
+	for _, l := range latencies {
+		sum += l
+	}
+	return Latency{
+		Min:  latencies[0],
+		Mean: sum / time.Duration(len(latencies)),
+		P50:  latencies[len(latencies)/2],
+		P95:  latencies[len(latencies)*95/100],
+		Max:  latencies[len(latencies)-1],
+	}
+}
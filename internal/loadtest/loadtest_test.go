@@ -0,0 +1,135 @@
+package loadtest
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startServer runs an SSH server rejecting every password and counts the attempts
+func startServer(t *testing.T) (string, *atomic.Int64) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	var attempts atomic.Int64
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			attempts.Add(1)
+			return nil, errors.New("permission denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				ssh.NewServerConn(conn, config)
+			}()
+		}
+	}()
+	return ln.Addr().String(), &attempts
+}
+
+func TestRun(t *testing.T) {
+	addr, attempts := startServer(t)
+
+	result, err := Run(context.Background(), Config{
+		Target:          addr,
+		Rate:            50,
+		Concurrency:     10,
+		AttemptsPerConn: 2,
+		Duration:        200 * time.Millisecond,
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	if result.Connections < 5 {
+		t.Errorf("Expected at least 5 connections, got %d", result.Connections)
+	}
+	if result.Errors != 0 {
+		t.Errorf("Expected no errors, got %d: %s", result.Errors, result.LastError)
+	}
+	if result.Rejected+result.Errors != result.Connections {
+		t.Errorf("Connections %d do not add up: %d rejected, %d errors", result.Connections, result.Rejected, result.Errors)
+	}
+	if got := attempts.Load(); got != int64(2*result.Rejected) {
+		t.Errorf("Server saw %d attempts, want %d", got, 2*result.Rejected)
+	}
+	if result.Latency.Min <= 0 || result.Latency.Max < result.Latency.P95 || result.Latency.P95 < result.Latency.P50 {
+		t.Errorf("Inconsistent latency: %+v", result.Latency)
+	}
+}
+
+func TestRunConnectionErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	result, err := Run(context.Background(), Config{
+		Target:          addr,
+		Rate:            20,
+		Concurrency:     5,
+		AttemptsPerConn: 1,
+		Duration:        100 * time.Millisecond,
+		Timeout:         time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if result.Errors != result.Connections || result.LastError == "" {
+		t.Errorf("Expected every connection to fail, got %+v", result)
+	}
+}
+
+func TestRunInvalidConfig(t *testing.T) {
+	if _, err := Run(context.Background(), Config{Target: "127.0.0.1:1", Concurrency: 1, AttemptsPerConn: 1}); err == nil {
+		t.Error("Expected an error for a zero rate")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	got := summarize(latencies)
+	want := Latency{
+		Min:  time.Millisecond,
+		Mean: 50500 * time.Microsecond,
+		P50:  51 * time.Millisecond,
+		P95:  96 * time.Millisecond,
+		Max:  100 * time.Millisecond,
+	}
+	if got != want {
+		t.Errorf("summarize() = %+v, want %+v", got, want)
+	}
+}
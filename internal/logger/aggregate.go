@@ -0,0 +1,128 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package logger
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// aggregateKey identifies identical attempts
+type aggregateKey struct {
+	ip       string
+	username string
+	password string
+}
+
+// pendingAttempt is the first attempt of a window and its repetitions
+type pendingAttempt struct {
+	event    *Event
+	count    int
+	lastSeen time.Time
+	timer    *time.Timer
+}
+
+// aggregator collapses identical authentication attempts arriving within a
+// window into a single event with a count field. The event is emitted when
+// the window that was opened by the first attempt ends.
+type aggregator struct {
+	mu      sync.Mutex
+	window  time.Duration
+	pending map[aggregateKey]*pendingAttempt
+	emit    func(event *Event) error
+	times   TimeFormat
+}
+
+func newAggregator(window time.Duration, times TimeFormat, emit func(event *Event) error) *aggregator {
+	return &aggregator{
+		window:  window,
+		pending: make(map[aggregateKey]*pendingAttempt),
+		emit:    emit,
+		times:   times,
+	}
+}
+
+// add holds an authentication attempt until its window ends and reports
+// whether the event was taken over. Other events are not aggregated.
+func (a *aggregator) add(event *Event) bool {
+	if event.Type != "auth_attempt" {
+		return false
+	}
+
+	// Source ports change on every connection, only the address matters
+	ip := event.GetString("remote_addr")
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	key := aggregateKey{
+		ip:       ip,
+		username: event.GetString("username"),
+		password: event.GetString("password"),
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if p, ok := a.pending[key]; ok {
+		p.count++
+		p.lastSeen = event.Time
+		return true
+	}
+
+	p := &pendingAttempt{event: event, count: 1, lastSeen: event.Time}
+	p.timer = time.AfterFunc(a.window, func() { a.flush(key) })
+	a.pending[key] = p
+	return true
+}
+
+// flush emits the aggregated event of a finished window
+func (a *aggregator) flush(key aggregateKey) {
+	a.mu.Lock()
+	p, ok := a.pending[key]
+	delete(a.pending, key)
+	a.mu.Unlock()
+
+	if ok {
+		a.emitPending(p)
+	}
+}
+
+// emitPending adds the aggregation fields and passes the event on
+func (a *aggregator) emitPending(p *pendingAttempt) {
+	p.event.Set("count", p.count)
+	if p.count > 1 {
+		p.event.Set("last_seen", a.times.Format(p.lastSeen))
+	}
+	a.emit(p.event)
+}
+
+// close emits all pending events without waiting for their windows to end
+func (a *aggregator) close() {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = make(map[aggregateKey]*pendingAttempt)
+	a.mu.Unlock()
+
+	for _, p := range pending {
+		p.timer.Stop()
+		a.emitPending(p)
+	}
+}
@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAggregation(t *testing.T) {
+	sink := &lockedSink{}
+	l := &CredentialsLogger{sinks: []*trackedSink{newTrackedSink(sink, nil)}}
+	l.aggregator = newAggregator(100*time.Millisecond, TimeFormat{}, l.emit)
+
+	attempt := CredentialAttempt{
+		Timestamp:  time.Now(),
+		RemoteAddr: "10.0.0.1:40000",
+		Username:   "root",
+		Password:   "123456",
+	}
+
+	// Identical attempts from different source ports
+	for i := 0; i < 5; i++ {
+		attempt.RemoteAddr = "10.0.0.1:" + string(rune('0'+i)) + "0000"
+		l.Log(attempt)
+	}
+	// A different password is a separate event
+	attempt.Password = "password"
+	l.Log(attempt)
+
+	if n := len(sink.snapshot()); n != 0 {
+		t.Fatalf("Expected events to be held during the window, got %d", n)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	events := sink.snapshot()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 aggregated events, got %d", len(events))
+	}
+	counts := map[string]interface{}{}
+	for _, e := range events {
+		c, _ := e.Get("count")
+		counts[e.GetString("password")] = c
+	}
+	if counts["123456"] != 5 {
+		t.Errorf("Expected count 5 for repeated attempt, got %v", counts["123456"])
+	}
+	if counts["password"] != 1 {
+		t.Errorf("Expected count 1 for single attempt, got %v", counts["password"])
+	}
+}
+
+func TestAggregationFlushOnClose(t *testing.T) {
+	sink := &lockedSink{}
+	l := &CredentialsLogger{sinks: []*trackedSink{newTrackedSink(sink, nil)}}
+	l.aggregator = newAggregator(time.Hour, TimeFormat{}, l.emit)
+
+	l.Log(CredentialAttempt{Timestamp: time.Now(), RemoteAddr: "10.0.0.2:1", Username: "admin", Password: "admin"})
+	l.Log(CredentialAttempt{Timestamp: time.Now(), RemoteAddr: "10.0.0.2:2", Username: "admin", Password: "admin"})
+	l.Close()
+
+	events := sink.snapshot()
+	if len(events) != 1 {
+		t.Fatalf("Expected pending event to be flushed on close, got %d events", len(events))
+	}
+	if c, _ := events[0].Get("count"); c != 2 {
+		t.Errorf("Expected count 2, got %v", c)
+	}
+	if events[0].GetString("last_seen") == "" {
+		t.Errorf("Expected last_seen to be set")
+	}
+}
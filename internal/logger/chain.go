@@ -0,0 +1,164 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ChainField is the name of the field holding the HMAC chain value
+const ChainField = "chain"
+
+// chainSuffix matches the chain field appended to the end of a JSON record
+var chainSuffix = regexp.MustCompile(`,"` + ChainField + `":"([0-9a-f]{64})"}$`)
+
+// hmacChain links records together: the chain value of every record is the
+// HMAC over the previous chain value and the record itself, so modifying,
+// removing or reordering records breaks the chain
+type hmacChain struct {
+	key  []byte
+	prev string
+}
+
+// chainValue computes the chain value of a record without the chain field
+func chainValue(key []byte, prev string, record []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(prev))
+	mac.Write(record)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal appends the chain field to a JSON record and returns the new record
+// together with its chain value
+func (c *hmacChain) seal(record []byte) ([]byte, string) {
+	record = bytes.TrimRight(record, "\n")
+	sum := chainValue(c.key, c.prev, record)
+
+	sealed := make([]byte, 0, len(record)+len(ChainField)+72)
+	sealed = append(sealed, record[:len(record)-1]...)
+	sealed = append(sealed, `,"`+ChainField+`":"`+sum+`"}`+"\n"...)
+	return sealed, sum
+}
+
+// chainStateSuffix is appended to the path of encrypted logs to store the
+// last chain value
+const chainStateSuffix = ".chain"
+
+// saveChainValue stores the last chain value of an encrypted log
+func saveChainValue(path, value string) error {
+	return os.WriteFile(path+chainStateSuffix, []byte(value+"\n"), 0644)
+}
+
+// lastChainValue returns the chain value of the last record in a file, or ""
+// if the file does not exist or the last record is not chained. For encrypted
+// files the value saved on close is used.
+func lastChainValue(path string, encrypted bool) (string, error) {
+	if encrypted {
+		data, err := os.ReadFile(path + chainStateSuffix)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	// Records are short, the tail of the file is enough
+	const tailSize = 64 * 1024
+	offset := info.Size() - tailSize
+	if offset < 0 {
+		offset = 0
+	}
+	tail := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return "", err
+	}
+
+	lines := bytes.Split(bytes.TrimRight(tail, "\n"), []byte("\n"))
+	if m := chainSuffix.FindSubmatch(lines[len(lines)-1]); m != nil {
+		return string(m[1]), nil
+	}
+	return "", nil
+}
+
+// VerifyChain checks the HMAC chain of a log and returns the number of
+// verified records. The first broken, unchained or reordered record is
+// reported as an error with its line number. Blank lines are skipped. Records
+// removed from the end of the log, or a chain restarted in a new file after
+// rotation, cannot be detected from the log alone.
+func VerifyChain(r io.Reader, key []byte) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	prev := ""
+	line := 0
+	records := 0
+	for scanner.Scan() {
+		line++
+		record := scanner.Bytes()
+		if len(bytes.TrimSpace(record)) == 0 {
+			continue
+		}
+
+		m := chainSuffix.FindSubmatchIndex(record)
+		if m == nil {
+			return records, fmt.Errorf("line %d: record is not chained", line)
+		}
+
+		// Restore the record as it was before sealing
+		original := append(append([]byte{}, record[:m[0]]...), '}')
+		expected := chainValue(key, prev, original)
+		actual := string(record[m[2]:m[3]])
+		if !hmac.Equal([]byte(expected), []byte(actual)) {
+			return records, fmt.Errorf("line %d: chain mismatch, record was modified or records before it were removed", line)
+		}
+		prev = actual
+		records++
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("failed to read log: %w", err)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeChainedLog(t *testing.T, path string, key []byte, users ...string) {
+	t.Helper()
+
+	l, err := NewCredentialsLogger(Config{
+		LogFile:   path,
+		LogFormat: "json",
+		ChainKey:  key,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer l.Close()
+
+	for _, user := range users {
+		if err := l.Log(CredentialAttempt{
+			Timestamp:  time.Now(),
+			RemoteAddr: "127.0.0.1:12345",
+			Username:   user,
+			Password:   "password",
+		}); err != nil {
+			t.Fatalf("Logging error: %v", err)
+		}
+	}
+}
+
+func TestHMACChain(t *testing.T) {
+	key := []byte("chain-key")
+	path := filepath.Join(t.TempDir(), "chained.log")
+
+	writeChainedLog(t, path, key, "user1", "user2")
+	// Reopening the log continues the existing chain
+	writeChainedLog(t, path, key, "user3")
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+
+	records, err := VerifyChain(bytes.NewReader(content), key)
+	if err != nil {
+		t.Fatalf("Expected valid chain, got: %v", err)
+	}
+	if records != 3 {
+		t.Errorf("Expected 3 verified records, got %d", records)
+	}
+
+	if _, err := VerifyChain(bytes.NewReader(content), []byte("wrong-key")); err == nil {
+		t.Errorf("Expected verification with wrong key to fail")
+	}
+
+	// Modified record
+	modified := strings.Replace(string(content), "user2", "userX", 1)
+	if _, err := VerifyChain(strings.NewReader(modified), key); err == nil {
+		t.Errorf("Expected verification of modified log to fail")
+	}
+
+	// Removed record
+	lines := strings.SplitAfter(string(content), "\n")
+	removed := lines[0] + lines[2]
+	if _, err := VerifyChain(strings.NewReader(removed), key); err == nil {
+		t.Errorf("Expected verification of log with removed record to fail")
+	}
+
+	// Blank lines are not records
+	blank := "\n" + lines[0] + "\n \n" + lines[1] + lines[2] + "\n"
+	if records, err := VerifyChain(strings.NewReader(blank), key); err != nil || records != 3 {
+		t.Errorf("Expected 3 verified records with blank lines, got %d: %v", records, err)
+	}
+}
+
+func TestHMACChainRequiresJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pretty.log")
+	if _, err := NewCredentialsLogger(Config{
+		LogFile:   path,
+		LogFormat: "pretty",
+		ChainKey:  []byte("chain-key"),
+	}); err == nil {
+		t.Errorf("Expected error for chained pretty log")
+	}
+}
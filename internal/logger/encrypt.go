@@ -0,0 +1,222 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// EncryptionConfig contains settings for encrypting log files at rest
+type EncryptionConfig struct {
+	// age X25519 recipients (age1...), encryption is disabled if empty
+	Recipients []string
+	// Number of records after which the current segment is finished
+	SegmentRecords int
+	// Time after which the current segment is finished
+	SegmentInterval time.Duration
+}
+
+// Enabled reports whether encryption is configured
+func (c EncryptionConfig) Enabled() bool {
+	return len(c.Recipients) > 0
+}
+
+// segmentWriter encrypts data to age recipients in independent armored
+// segments. Every finished segment is a complete age file, so a log that was
+// cut off (e.g. by a crash) loses at most the records of the last segment.
+type segmentWriter struct {
+	mu         sync.Mutex
+	w          io.Writer
+	recipients []age.Recipient
+	maxRecords int
+
+	armor   io.WriteCloser
+	crypt   io.WriteCloser
+	records int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newSegmentWriter creates a writer encrypting records written to w
+func newSegmentWriter(w io.Writer, config EncryptionConfig) (*segmentWriter, error) {
+	recipients := make([]age.Recipient, 0, len(config.Recipients))
+	for _, r := range config.Recipients {
+		recipient, err := age.ParseX25519Recipient(strings.TrimSpace(r))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient: %w", err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	s := &segmentWriter{
+		w:          w,
+		recipients: recipients,
+		maxRecords: config.SegmentRecords,
+		done:       make(chan struct{}),
+	}
+
+	if config.SegmentInterval > 0 {
+		s.wg.Add(1)
+		go s.finishPeriodically(config.SegmentInterval)
+	}
+
+	return s, nil
+}
+
+// Write encrypts a single record into the current segment
+func (s *segmentWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crypt == nil {
+		s.armor = armor.NewWriter(s.w)
+		crypt, err := age.Encrypt(s.armor, s.recipients...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to start encrypted segment: %w", err)
+		}
+		s.crypt = crypt
+	}
+
+	n, err := s.crypt.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	s.records++
+	if s.maxRecords > 0 && s.records >= s.maxRecords {
+		if err := s.finish(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// finish completes the current segment, the caller must hold the lock
+func (s *segmentWriter) finish() error {
+	if s.crypt == nil {
+		return nil
+	}
+
+	err := s.crypt.Close()
+	if armorErr := s.armor.Close(); err == nil {
+		err = armorErr
+	}
+	s.crypt = nil
+	s.armor = nil
+	s.records = 0
+
+	if err != nil {
+		return fmt.Errorf("failed to finish encrypted segment: %w", err)
+	}
+	return nil
+}
+
+// finishPeriodically completes the current segment at a fixed interval, so
+// records do not stay unwritten for long during quiet periods
+func (s *segmentWriter) finishPeriodically(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			s.finish()
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close completes the current segment and closes the underlying writer
+func (s *segmentWriter) Close() error {
+	close(s.done)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.finish()
+	if c, ok := s.w.(io.Closer); ok {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Decrypt decrypts every complete segment of an encrypted log to w. An
+// incomplete trailing segment is reported as an error after all complete
+// segments were written.
+func Decrypt(r io.Reader, w io.Writer, identities ...age.Identity) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var segment bytes.Buffer
+	inSegment := false
+	segments := 0
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == armor.Header:
+			segment.Reset()
+			inSegment = true
+		case line == armor.Footer && inSegment:
+			segment.WriteString(line + "\n")
+			inSegment = false
+
+			plain, err := age.Decrypt(armor.NewReader(&segment), identities...)
+			if err != nil {
+				return segments, fmt.Errorf("segment %d: %w", segments+1, err)
+			}
+			if _, err := io.Copy(w, plain); err != nil {
+				return segments, fmt.Errorf("segment %d: %w", segments+1, err)
+			}
+			segments++
+			continue
+		}
+
+		if inSegment {
+			segment.WriteString(line + "\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return segments, fmt.Errorf("failed to read encrypted log: %w", err)
+	}
+	if inSegment {
+		return segments, fmt.Errorf("segment %d is incomplete", segments+1)
+	}
+
+	return segments, nil
+}
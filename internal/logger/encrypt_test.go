@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+func TestEncryptedLog(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "encrypted.log")
+	l, err := NewCredentialsLogger(Config{
+		LogFile:   path,
+		LogFormat: "json",
+		Encryption: EncryptionConfig{
+			Recipients:     []string{identity.Recipient().String()},
+			SegmentRecords: 2,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	for _, user := range []string{"user1", "user2", "user3"} {
+		if err := l.Log(CredentialAttempt{
+			Timestamp:  time.Now(),
+			RemoteAddr: "127.0.0.1:12345",
+			Username:   user,
+			Password:   "secret_password",
+		}); err != nil {
+			t.Fatalf("Logging error: %v", err)
+		}
+	}
+
+	// The first segment is complete, the second one is still open
+	partial, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if bytes.Contains(partial, []byte("secret_password")) {
+		t.Fatalf("Log file contains plaintext password")
+	}
+
+	var plain bytes.Buffer
+	segments, err := Decrypt(bytes.NewReader(partial), &plain, identity)
+	if err == nil {
+		t.Errorf("Expected the open segment to be reported as incomplete")
+	}
+	if segments != 1 || strings.Count(plain.String(), "\n") != 2 {
+		t.Errorf("Expected 1 segment with 2 records, got %d segments: %s", segments, plain.String())
+	}
+
+	// Closing finishes the last segment
+	l.Close()
+	full, _ := os.ReadFile(path)
+	plain.Reset()
+	segments, err = Decrypt(bytes.NewReader(full), &plain, identity)
+	if err != nil {
+		t.Fatalf("Failed to decrypt log: %v", err)
+	}
+	if segments != 2 || !strings.Contains(plain.String(), "user3") {
+		t.Errorf("Expected 2 segments including user3, got %d: %s", segments, plain.String())
+	}
+
+	// A segment cut off in the middle is reported, earlier ones are kept
+	truncated := full[:len(full)-40]
+	plain.Reset()
+	segments, err = Decrypt(bytes.NewReader(truncated), &plain, identity)
+	if err == nil {
+		t.Errorf("Expected error for truncated segment")
+	}
+	if segments != 1 || !strings.Contains(plain.String(), "user2") {
+		t.Errorf("Expected first segment to be decrypted, got %d: %s", segments, plain.String())
+	}
+}
+
+func TestEncryptedLogInvalidRecipient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "encrypted.log")
+	if _, err := NewCredentialsLogger(Config{
+		LogFile:    path,
+		LogFormat:  "json",
+		Encryption: EncryptionConfig{Recipients: []string{"not-a-key"}},
+	}); err == nil {
+		t.Errorf("Expected error for invalid recipient")
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package logger
+
+import (
+	"time"
+)
+
+// Field is a single key/value pair of an event
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Event is a single record passed to the sinks
+type Event struct {
+	// Unique event ID (UUIDv7), assigned when the event is logged
+	ID string
+	// Time the event happened
+	Time time.Time
+	// Event type, e.g. "auth_attempt"
+	Type string
+	// Human-readable message
+	Message string
+	// Event fields in output order
+	Fields []Field
+	// Remote address before it was anonymized, for checks against networks.
+	// It is kept in memory and never written.
+	OriginalAddr string
+}
+
+// NewAuthEvent converts an authentication attempt into an event
+func NewAuthEvent(attempt CredentialAttempt) *Event {
+	event := &Event{
+		Time:    attempt.Timestamp,
+		Type:    "auth_attempt",
+		Message: "authentication attempt",
+		Fields: []Field{
+			{Key: "remote_addr", Value: attempt.RemoteAddr},
+			{Key: "username", Value: attempt.Username},
+			{Key: "password", Value: attempt.Password},
+		},
+	}
+	if attempt.ClientVersion != "" {
+		event.Set("client_version", attempt.ClientVersion)
+	}
+	return event
+}
+
+// Get returns the value of the field with the given key
+func (e *Event) Get(key string) (interface{}, bool) {
+	for _, f := range e.Fields {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// GetString returns the value of the field as a string, or "" if it is missing or not a string
+func (e *Event) GetString(key string) string {
+	v, _ := e.Get(key)
+	s, _ := v.(string)
+	return s
+}
+
+// Set replaces the value of an existing field or appends a new one
+func (e *Event) Set(key string, value interface{}) {
+	for i := range e.Fields {
+		if e.Fields[i].Key == key {
+			e.Fields[i].Value = value
+			return
+		}
+	}
+	e.Fields = append(e.Fields, Field{Key: key, Value: value})
+}
+
+// Delete removes the field with the given key
+func (e *Event) Delete(key string) {
+	for i := range e.Fields {
+		if e.Fields[i].Key == key {
+			e.Fields = append(e.Fields[:i], e.Fields[i+1:]...)
+			return
+		}
+	}
+}
+
+// Clone returns a copy of the event that can be modified independently
+func (e *Event) Clone() *Event {
+	c := *e
+	c.Fields = make([]Field, len(e.Fields))
+	copy(c.Fields, e.Fields)
+	return &c
+}
@@ -0,0 +1,163 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultFeedBuffer is the number of events queued for a subscriber by default
+const DefaultFeedBuffer = 1024
+
+// Feed passes the logged events, once processed, to subscribers reading them
+// from buffered channels. It is the single in-process stream of events for
+// the components observing them, such as statistics, the dashboard and
+// alerts. Events are dropped for subscribers falling behind rather than
+// holding the connections they are logged for. The zero Feed has no
+// subscribers and is ready to use.
+type Feed struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscription receives the events of a feed until it or the feed is closed
+type Subscription struct {
+	feed    *Feed
+	events  chan *Event
+	dropped atomic.Uint64
+	// Closed by the goroutine of Consume once the queued events are processed
+	done chan struct{}
+	// Guarded by the mutex of the feed
+	closed bool
+}
+
+// Subscribe returns a subscription receiving the events published from now
+// on, queuing up to buffer of them, or DefaultFeedBuffer if 0. The channel of
+// a subscription to a closed feed is closed already.
+func (f *Feed) Subscribe(buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultFeedBuffer
+	}
+	s := &Subscription{feed: f, events: make(chan *Event, buffer)}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		s.closed = true
+		close(s.events)
+		return s
+	}
+	if f.subs == nil {
+		f.subs = make(map[*Subscription]struct{})
+	}
+	f.subs[s] = struct{}{}
+	return s
+}
+
+// Consume runs a processor on the events of a new subscription in its own
+// goroutine. Closing the subscription waits for the queued events to be
+// processed.
+func (f *Feed) Consume(buffer int, p Processor) *Subscription {
+	s := f.Subscribe(buffer)
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		for event := range s.events {
+			p.Process(event)
+		}
+	}()
+	return s
+}
+
+// Publish passes a copy of the event to the subscribers. The copy is shared
+// by them and must not be modified.
+func (f *Feed) Publish(event *Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.subs) == 0 {
+		return
+	}
+
+	clone := event.Clone()
+	for s := range f.subs {
+		select {
+		case s.events <- clone:
+		default:
+			if s.dropped.Add(1) == 1 {
+				log.Warn().Msg("event subscriber falling behind, dropping events")
+			}
+		}
+	}
+}
+
+// Process publishes the event, for the feed to be used as a processor
+func (f *Feed) Process(event *Event) {
+	f.Publish(event)
+}
+
+// Close closes the channels of the subscriptions, after the events queued
+// for them. Events published afterwards are ignored.
+func (f *Feed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	f.closed = true
+	for s := range f.subs {
+		s.closed = true
+		close(s.events)
+	}
+	f.subs = nil
+}
+
+// Events returns the channel of the events, closed with the subscription
+func (s *Subscription) Events() <-chan *Event {
+	return s.events
+}
+
+// Dropped returns the number of events dropped as the channel was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops the subscription and closes its channel. For a subscription
+// of Consume, it returns once the queued events are processed.
+func (s *Subscription) Close() {
+	s.feed.mu.Lock()
+	closing := !s.closed
+	if closing {
+		s.closed = true
+		delete(s.feed.subs, s)
+		close(s.events)
+	}
+	s.feed.mu.Unlock()
+
+	if s.done != nil {
+		<-s.done
+	}
+	if n := s.Dropped(); closing && n > 0 {
+		log.Info().Uint64("dropped", n).Msg("event subscriber closed after dropped events")
+	}
+}
@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFeed(t *testing.T) {
+	sink := &lockedSink{}
+	l := &CredentialsLogger{sinks: []*trackedSink{newTrackedSink(sink, nil)}}
+	l.AddProcessor(ProcessorFunc(func(event *Event) { event.Set("processed", true) }))
+	sub := l.Subscribe(1)
+
+	l.Log(CredentialAttempt{Timestamp: time.Now(), RemoteAddr: "10.0.0.1:1", Username: "root", Password: "root"})
+	l.Log(CredentialAttempt{Timestamp: time.Now(), RemoteAddr: "10.0.0.1:2", Username: "admin", Password: "admin"})
+
+	event := <-sub.Events()
+	if event.GetString("username") != "root" {
+		t.Errorf("Expected the first event, got %q", event.GetString("username"))
+	}
+	if v, _ := event.Get("processed"); v != true {
+		t.Error("Expected the event to be processed before being published")
+	}
+	if sub.Dropped() != 1 {
+		t.Errorf("Expected 1 dropped event, got %d", sub.Dropped())
+	}
+	if n := len(sink.snapshot()); n != 2 {
+		t.Errorf("Expected the sink to get 2 events, got %d", n)
+	}
+
+	l.Close()
+	if _, ok := <-sub.Events(); ok {
+		t.Error("Expected the channel to be closed with the logger")
+	}
+	if _, ok := <-l.Subscribe(1).Events(); ok {
+		t.Error("Expected the channel of a subscription after closing to be closed")
+	}
+}
+
+func TestFeedConsume(t *testing.T) {
+	var feed Feed
+	var mu sync.Mutex
+	var got []string
+	sub := feed.Consume(10, ProcessorFunc(func(event *Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, event.GetString("username"))
+	}))
+	other := feed.Subscribe(10)
+
+	for _, username := range []string{"root", "admin", "test"} {
+		feed.Publish(NewAuthEvent(CredentialAttempt{Username: username}))
+	}
+	sub.Close()
+	sub.Close()
+
+	mu.Lock()
+	if len(got) != 3 {
+		t.Errorf("Expected the queued events to be processed on close, got %v", got)
+	}
+	mu.Unlock()
+
+	feed.Publish(NewAuthEvent(CredentialAttempt{Username: "guest"}))
+	if n := len(other.Events()); n != 4 {
+		t.Errorf("Expected 4 events for the other subscriber, got %d", n)
+	}
+	feed.Close()
+	other.Close()
+}
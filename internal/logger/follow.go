@@ -0,0 +1,145 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FollowConfig contains settings of following a log
+type FollowConfig struct {
+	// Path of the log file
+	Path string
+	// Timestamp format of the log
+	Times TimeFormat
+	// Read the events already in the file first, otherwise only new ones
+	FromStart bool
+	// How often the file is checked for new records
+	Poll time.Duration
+	// Called once the end of the file is first reached, optional
+	CaughtUp func()
+}
+
+// Follow calls fn for every event appended to a log until ctx is done or fn
+// fails, like tail -F: the file is reopened when it is rotated or
+// truncated, and waited for while it does not exist. Records that are not
+// valid JSON are skipped.
+func Follow(ctx context.Context, config FollowConfig, fn func(*Event) error) error {
+	poll := config.Poll
+	if poll <= 0 {
+		poll = 250 * time.Millisecond
+	}
+	fromStart := config.FromStart
+	if config.CaughtUp != nil {
+		var once sync.Once
+		caughtUp := config.CaughtUp
+		config.CaughtUp = func() { once.Do(caughtUp) }
+	}
+
+	for {
+		f, err := os.Open(config.Path)
+		if err == nil {
+			err = follow(ctx, f, config, fromStart, poll, fn)
+			f.Close()
+			if !errors.Is(err, errReopen) {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		} else if config.CaughtUp != nil {
+			config.CaughtUp()
+		}
+
+		// A new or recreated file is read from the start
+		fromStart = true
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(poll):
+		}
+	}
+}
+
+// errReopen reports that the followed file was rotated or truncated
+var errReopen = errors.New("log file replaced")
+
+// follow reads an open log until it is replaced
+func follow(ctx context.Context, f *os.File, config FollowConfig, fromStart bool, poll time.Duration, fn func(*Event) error) error {
+	opened, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	var offset int64
+	if !fromStart {
+		if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+
+	r := bufio.NewReader(f)
+	var pending []byte
+	replaced := false
+	for {
+		line, err := r.ReadBytes('\n')
+		offset += int64(len(line))
+		if err == nil {
+			line = append(pending, line...)
+			pending = nil
+			if record := bytes.TrimSpace(line); len(record) > 0 {
+				if event, err := ParseRecord(record, config.Times); err == nil {
+					if err := fn(event); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+
+		// Keep an incomplete record until the rest is written
+		pending = append(pending, line...)
+		if replaced {
+			return errReopen
+		}
+		if config.CaughtUp != nil {
+			config.CaughtUp()
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(poll):
+		}
+
+		// A rotated file is read to its end before the new one is opened
+		current, err := os.Stat(config.Path)
+		if err == nil && current.Size() < offset && os.SameFile(opened, current) {
+			return errReopen
+		}
+		replaced = err != nil || !os.SameFile(opened, current)
+	}
+}
@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.log")
+	appendRecord := func(username string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatalf("Failed to open log: %v", err)
+		}
+		fmt.Fprintf(f, `{"event":"auth_attempt","username":%q,"time":"2024-01-01T00:00:00Z"}`+"\n", username)
+		f.Close()
+	}
+	appendRecord("old")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan string, 10)
+	done := make(chan error, 1)
+	caughtUp := make(chan struct{})
+	go func() {
+		config := FollowConfig{Path: path, Poll: 5 * time.Millisecond, CaughtUp: func() { close(caughtUp) }}
+		done <- Follow(ctx, config, func(e *Event) error {
+			events <- e.GetString("username")
+			return nil
+		})
+	}()
+
+	expect := func(username string) {
+		t.Helper()
+		select {
+		case got := <-events:
+			if got != username {
+				t.Errorf("Expected %s, got %s", username, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for %s", username)
+		}
+	}
+
+	// Existing records are skipped
+	select {
+	case <-caughtUp:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for the end of the log")
+	}
+	appendRecord("first")
+	expect("first")
+
+	// Records written in parts are read once complete
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"event":"auth_attempt","username":"split",`)
+	time.Sleep(20 * time.Millisecond)
+	f.WriteString(`"time":"2024-01-01T00:00:00Z"}` + "\n" + "not json\n")
+	f.Close()
+	expect("split")
+
+	// Rotated files are read from the start
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("Failed to rotate log: %v", err)
+	}
+	appendRecord("rotated")
+	expect("rotated")
+
+	// Truncated files are read from the start
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatalf("Failed to truncate log: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	appendRecord("truncated")
+	expect("truncated")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestFollowFromStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.log")
+	os.WriteFile(path, []byte(`{"event":"auth_attempt","username":"old","time":"2024-01-01T00:00:00Z"}`+"\n"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var usernames []string
+	config := FollowConfig{Path: path, FromStart: true, Poll: time.Millisecond, CaughtUp: cancel}
+	err := Follow(ctx, config, func(e *Event) error {
+		usernames = append(usernames, e.GetString("username"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(usernames) != 1 || usernames[0] != "old" {
+		t.Errorf("Expected existing records before catching up, got %v", usernames)
+	}
+}
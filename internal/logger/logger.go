@@ -20,19 +20,45 @@
 package logger
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"os"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/rs/zerolog"
+	"github.com/abehterev/fakessh/internal/metrics"
+	"github.com/abehterev/fakessh/internal/tracing"
 	"github.com/rs/zerolog/log"
 )
 
+// ErrSinkUnavailable is wrapped by the errors of sinks that can not be
+// opened, and of events no sink could store
+var ErrSinkUnavailable = errors.New("sink unavailable")
+
 // CredentialsLogger provides functionality for logging authentication attempts
 type CredentialsLogger struct {
-	logger zerolog.Logger
-	output io.Writer
+	// Sinks of the configuration, opened from configs, followed by the
+	// sinks added with AddSink
+	mu         sync.RWMutex
+	sinks      []*trackedSink
+	configs    []SinkConfig
+	processors []Processor
+	aggregator *aggregator
+	// Processed events for the subscribers observing them
+	feed Feed
+
+	// Emergency file used when every sink fails, opened on first use
+	emergencyPath string
+	encryption    EncryptionConfig
+	times         TimeFormat
+	emergencyMu   sync.Mutex
+	emergency     *trackedSink
+
+	metrics *metrics.Registry
+	tracer  *tracing.Tracer
 }
 
 // CredentialAttempt represents information about an authentication attempt
@@ -41,6 +67,8 @@ type CredentialAttempt struct {
 	RemoteAddr string
 	Username   string
 	Password   string
+	// SSH version string of the client, e.g. "SSH-2.0-libssh_0.9.6"
+	ClientVersion string
 }
 
 // Config contains settings for the logger
@@ -49,72 +77,420 @@ type Config struct {
 	LogFile string
 	// Log format: "json" or "pretty"
 	LogFormat string
+	// Field selection and renaming for the main log
+	Mapping FieldMapping
+	// Write to the additional sinks only, without the main log
+	SkipMainLog bool
+	// Key for the tamper-evident HMAC chain of file sinks, disabled if empty
+	ChainKey []byte
+	// Encryption of file sinks (including the emergency file) at rest
+	Encryption EncryptionConfig
+	// Additional sinks
+	Sinks []SinkConfig
+	// Sinks created outside of the configuration, added like with AddSink,
+	// such as those of programs embedding the server
+	ExtraSinks []Sink
+	// Path to the file used when all sinks are failing, empty to disable
+	EmergencyFile string
+	// Static fields attached to every event
+	Tags map[string]string
+	// Timestamp format of all sinks, RFC3339 in UTC if unset
+	TimeFormat TimeFormat
+	// Window in which identical attempts are collapsed into one event, 0 to disable
+	AggregateWindow time.Duration
+	// Registry of operational metrics, disabled if nil
+	Metrics *metrics.Registry
+	// Tracer recording event processing and sink writes, disabled if nil
+	Tracer *tracing.Tracer
+}
+
+// SinkConfig contains settings for an additional sink
+type SinkConfig struct {
+	// Sink type: "file" or "stdout"
+	Type string
+	// Path to the file for file sinks
+	Path string
+	// Output format: "json" or "pretty"
+	Format string
+	// Field selection and renaming
+	Mapping FieldMapping
+	// Key for the tamper-evident HMAC chain, disabled if empty
+	ChainKey []byte
+	// Encryption at rest
+	Encryption EncryptionConfig
+	// Timestamp format
+	TimeFormat TimeFormat
 }
 
 // NewCredentialsLogger creates a new credentials logger
 func NewCredentialsLogger(config Config) (*CredentialsLogger, error) {
-	var output io.Writer
+	l := &CredentialsLogger{
+		emergencyPath: config.EmergencyFile,
+		encryption:    config.Encryption,
+		times:         config.TimeFormat,
+		metrics:       config.Metrics,
+		tracer:        config.Tracer,
+	}
 
-	// Determine where to output logs
+	configs, err := sinkConfigs(config)
+	if err != nil && len(config.ExtraSinks) == 0 {
+		return nil, err
+	}
+	if l.sinks, err = l.openSinks(configs); err != nil {
+		return nil, err
+	}
+	l.configs = configs
+	for _, sink := range config.ExtraSinks {
+		l.sinks = append(l.sinks, newTrackedSink(sink, l.metrics))
+	}
+
+	if len(config.Tags) > 0 {
+		l.AddProcessor(newTagsProcessor(config.Tags))
+	}
+
+	if config.AggregateWindow > 0 {
+		l.aggregator = newAggregator(config.AggregateWindow, l.times, func(event *Event) error {
+			if err := l.emit(event); err != nil {
+				log.Error().Err(err).Msg("logging error")
+				return err
+			}
+			return nil
+		})
+	}
+
+	return l, nil
+}
+
+// sinkConfigs returns the settings of the sinks of a logger configuration
+func sinkConfigs(config Config) ([]SinkConfig, error) {
+	// The main log is configured the same way as additional sinks
+	main := SinkConfig{
+		Type:    "file",
+		Path:    config.LogFile,
+		Format:  config.LogFormat,
+		Mapping: config.Mapping,
+	}
 	if config.LogFile == "stdout" {
-		output = os.Stdout
-	} else {
-		// Check if the file can be opened for writing
-		f, err := os.OpenFile(config.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		main.Type = "stdout"
+	}
+	sinks := append([]SinkConfig{main}, config.Sinks...)
+	if config.SkipMainLog {
+		sinks = slices.Clone(config.Sinks)
+	}
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("no sinks configured")
+	}
+	for i := range sinks {
+		sinks[i].ChainKey = config.ChainKey
+		sinks[i].Encryption = config.Encryption
+		sinks[i].TimeFormat = config.TimeFormat
+	}
+	return sinks, nil
+}
+
+// openSinks creates the sinks of their settings, closing the created ones
+// if one fails
+func (l *CredentialsLogger) openSinks(configs []SinkConfig) ([]*trackedSink, error) {
+	var sinks []*trackedSink
+	for _, sc := range configs {
+		sink, err := newSink(sc)
 		if err != nil {
-			return nil, fmt.Errorf("failed to open log file: %w", err)
+			for _, s := range sinks {
+				s.sink.Close()
+			}
+			return nil, fmt.Errorf("%w: %w", ErrSinkUnavailable, err)
 		}
-		output = f
+		sinks = append(sinks, newTrackedSink(sink, l.metrics))
 	}
+	return sinks, nil
+}
 
-	// Configure zerolog
-	zerolog.TimeFieldFormat = time.RFC3339
-	var logger zerolog.Logger
+// ReloadSinks replaces the sinks of the configuration with those of a new
+// one, keeping the sinks added with AddSink. Only the main log, the
+// additional sinks and their formats, chain key and encryption are taken
+// from config. Files are closed before they are opened again, so that their
+// chain continues; if a sink cannot be opened, the previous ones are.
+func (l *CredentialsLogger) ReloadSinks(config Config) error {
+	configs, err := sinkConfigs(config)
+	if err != nil {
+		return err
+	}
 
-	// Determine output format
-	if config.LogFormat == "pretty" {
-		logger = zerolog.New(zerolog.ConsoleWriter{Out: output, TimeFormat: time.RFC3339}).
-			With().Timestamp().Str("component", "auth").Logger()
-	} else {
-		// Default is JSON
-		logger = zerolog.New(output).With().Timestamp().Str("component", "auth").Logger()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	added := slices.Clone(l.sinks[len(l.configs):])
+	for _, s := range l.sinks[:len(l.configs)] {
+		s.sink.Close()
+	}
+	sinks, err := l.openSinks(configs)
+	if err != nil {
+		previous, reopenErr := l.openSinks(l.configs)
+		if reopenErr != nil {
+			// Events go to the added sinks or the emergency file
+			l.sinks, l.configs = added, nil
+			return errors.Join(err, reopenErr)
+		}
+		l.sinks = append(previous, added...)
+		return err
+	}
+	l.sinks = append(sinks, added...)
+	l.configs = configs
+	return nil
+}
+
+// newSink creates a sink from its configuration
+func newSink(config SinkConfig) (Sink, error) {
+	var sink Sink
+
+	// Determine where to output logs
+	switch config.Type {
+	case "stdout":
+		sink = newWriterSink("stdout", os.Stdout, config.Format, config.TimeFormat)
+	case "file", "":
+		// Check if the file can be opened for writing
+		fileSink, err := newFileSink(config.Path, config.Format, fileOptions{
+			chainKey:   config.ChainKey,
+			encryption: config.Encryption,
+			times:      config.TimeFormat,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sink = fileSink
+	default:
+		return nil, fmt.Errorf("unknown sink type: %s", config.Type)
+	}
+
+	if !config.Mapping.IsZero() {
+		sink = &mappedSink{Sink: sink, mapping: config.Mapping}
 	}
 
-	return &CredentialsLogger{
-		logger: logger,
-		output: output,
-	}, nil
+	return sink, nil
+}
+
+// AddProcessor registers a processor applied to every event before it reaches the sinks.
+// Processors run in the order they were added.
+func (l *CredentialsLogger) AddProcessor(p Processor) {
+	l.processors = append(l.processors, p)
+}
+
+// AddSink registers a sink created outside of the logger configuration,
+// such as the forwarding to a collector. Like processors, sinks are to be
+// added before events are logged. The sink is closed with the logger.
+func (l *CredentialsLogger) AddSink(sink Sink) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sinks = append(l.sinks, newTrackedSink(sink, l.metrics))
+}
+
+// Subscribe returns a subscription to the events once processed, queuing up
+// to buffer of them. Its channel is closed when the logger is closed.
+func (l *CredentialsLogger) Subscribe(buffer int) *Subscription {
+	return l.feed.Subscribe(buffer)
+}
+
+// Consume runs a processor on the processed events in its own goroutine,
+// for the observers that should not slow down the logging of events. Events
+// are dropped for it once buffer of them are queued.
+func (l *CredentialsLogger) Consume(buffer int, p Processor) *Subscription {
+	return l.feed.Consume(buffer, p)
 }
 
 // Log records information about an authentication attempt
 func (l *CredentialsLogger) Log(attempt CredentialAttempt) error {
-	// Use global logger if logging to stdout
-	// Otherwise use local logger for file or other outputs
-	if _, ok := l.output.(*os.File); ok && l.output == os.Stdout {
-		log.Info().
-			Str("component", "auth").
-			Str("event", "auth_attempt").
-			Str("remote_addr", attempt.RemoteAddr).
-			Str("username", attempt.Username).
-			Str("password", attempt.Password).
-			Msg("authentication attempt")
-	} else {
-		// Use local logger configured for current format
-		l.logger.Info().
-			Str("event", "auth_attempt").
-			Str("remote_addr", attempt.RemoteAddr).
-			Str("username", attempt.Username).
-			Str("password", attempt.Password).
-			Msg("authentication attempt")
+	return l.LogEvent(NewAuthEvent(attempt))
+}
+
+// LogContext records an authentication attempt as part of the trace in ctx
+func (l *CredentialsLogger) LogContext(ctx context.Context, attempt CredentialAttempt) error {
+	return l.LogEventContext(ctx, NewAuthEvent(attempt))
+}
+
+// LogEvent passes an event to all sinks. If every sink fails, the event is
+// written to the emergency file instead. With aggregation enabled,
+// authentication attempts are emitted when their window ends.
+func (l *CredentialsLogger) LogEvent(event *Event) error {
+	return l.LogEventContext(context.Background(), event)
+}
+
+// LogEventContext passes an event to all sinks as part of the trace in ctx
+func (l *CredentialsLogger) LogEventContext(ctx context.Context, event *Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if l.aggregator != nil && l.aggregator.add(event) {
+		return nil
+	}
+	return l.emitContext(ctx, event)
+}
+
+// emit processes an event outside of any trace, used for aggregated attempts
+func (l *CredentialsLogger) emit(event *Event) error {
+	return l.emitContext(context.Background(), event)
+}
+
+// emitContext processes an event and writes it to the sinks
+func (l *CredentialsLogger) emitContext(ctx context.Context, event *Event) error {
+	if event.ID == "" {
+		event.ID = NewEventID(event.Time)
+	}
+
+	ctx, span := l.tracer.Start(ctx, "log_event", tracing.KindInternal)
+	defer span.End()
+	span.SetAttribute("event.type", event.Type)
+
+	_, processSpan := l.tracer.Start(ctx, "process_event", tracing.KindInternal)
+	for _, p := range l.processors {
+		p.Process(event)
+	}
+	processSpan.End()
+	l.feed.Publish(event)
+	l.metrics.Count(metrics.Events, 1, metrics.Tag{Key: "type", Value: event.Type})
+
+	var errs []error
+	l.mu.RLock()
+	for _, s := range l.sinks {
+		if err := s.write(ctx, l.tracer, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.sink.Name(), err))
+		}
+	}
+	written := len(errs) < len(l.sinks)
+	l.mu.RUnlock()
+	if written {
+		return nil
+	}
+
+	if err := l.writeEmergency(ctx, event); err != nil {
+		errs = append(errs, fmt.Errorf("emergency file: %w", err))
+		return fmt.Errorf("%w: all credentials sinks failed: %w", ErrSinkUnavailable, errors.Join(errs...))
+	}
+	return nil
+}
+
+// writeEmergency writes the event to the emergency file
+func (l *CredentialsLogger) writeEmergency(ctx context.Context, event *Event) error {
+	if l.emergencyPath == "" {
+		return fmt.Errorf("emergency file is not configured")
+	}
+
+	l.emergencyMu.Lock()
+	if l.emergency == nil {
+		fileSink, err := newFileSink(l.emergencyPath, "json", fileOptions{encryption: l.encryption, times: l.times})
+		if err != nil {
+			l.emergencyMu.Unlock()
+			return err
+		}
+		l.emergency = newTrackedSink(fileSink, l.metrics)
+		log.Warn().Str("file", l.emergencyPath).Msg("all credentials sinks are failing, falling back to emergency file")
+	}
+	emergency := l.emergency
+	l.emergencyMu.Unlock()
+
+	l.metrics.Count(metrics.EmergencyWrites, 1)
+	return emergency.write(ctx, l.tracer, event)
+}
+
+// Rotate renames the files of the file sinks to copies named after the
+// current time, like FILE.20240101-120000, and continues in new files. It
+// returns the rotated files.
+func (l *CredentialsLogger) Rotate() ([]string, error) {
+	suffix := time.Now().UTC().Format("20060102-150405")
+	var rotated []string
+	var errs []error
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, t := range l.sinks {
+		sink := t.sink
+		if m, ok := sink.(*mappedSink); ok {
+			sink = m.Sink
+		}
+		file, ok := sink.(*writerSink)
+		if !ok || file.path == "" {
+			continue
+		}
+		name, err := file.rotate(suffix)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file.name, err))
+			continue
+		}
+		log.Info().Str("file", file.path).Str("rotated", name).Msg("log file rotated")
+		rotated = append(rotated, name)
+	}
+	return rotated, errors.Join(errs...)
+}
+
+// Reopen closes the files of the file sinks and the emergency file and opens
+// them again at their paths, so that files renamed by logrotate are
+// replaced by new ones
+func (l *CredentialsLogger) Reopen() error {
+	var files []*writerSink
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, t := range l.sinks {
+		sink := t.sink
+		if m, ok := sink.(*mappedSink); ok {
+			sink = m.Sink
+		}
+		if file, ok := sink.(*writerSink); ok && file.path != "" {
+			files = append(files, file)
+		}
+	}
+	l.emergencyMu.Lock()
+	if l.emergency != nil {
+		files = append(files, l.emergency.sink.(*writerSink))
+	}
+	l.emergencyMu.Unlock()
+
+	var errs []error
+	for _, file := range files {
+		if err := file.reopen(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file.name, err))
+		}
 	}
+	return errors.Join(errs...)
+}
 
+// Health returns the health of every configured sink
+func (l *CredentialsLogger) Health() []SinkHealth {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	health := make([]SinkHealth, 0, len(l.sinks))
+	for _, s := range l.sinks {
+		health = append(health, s.snapshot())
+	}
+	return health
+}
+
+// CheckSinks reports an error naming the sinks that are failing
+func (l *CredentialsLogger) CheckSinks() error {
+	var failing []string
+	for _, h := range l.Health() {
+		if !h.Healthy {
+			failing = append(failing, h.Name)
+		}
+	}
+	if len(failing) > 0 {
+		return fmt.Errorf("%w: failing sinks: %s", ErrSinkUnavailable, strings.Join(failing, ", "))
+	}
 	return nil
 }
 
 // Close closes the logger and releases resources
 func (l *CredentialsLogger) Close() {
-	// If output implements io.Closer, close it
-	if closer, ok := l.output.(io.Closer); ok && l.output != os.Stdout {
-		closer.Close()
+	if l.aggregator != nil {
+		l.aggregator.close()
+	}
+	l.feed.Close()
+
+	l.mu.Lock()
+	for _, s := range l.sinks {
+		s.sink.Close()
+	}
+	l.mu.Unlock()
+
+	l.emergencyMu.Lock()
+	defer l.emergencyMu.Unlock()
+	if l.emergency != nil {
+		l.emergency.sink.Close()
 	}
 }
@@ -63,7 +63,7 @@ func TestCredentialsLogger(t *testing.T) {
 	}
 
 	// Check timestamp format - convert to string again
-	timestampStr := timestamp.Format(time.RFC3339)
+	timestampStr := timestamp.UTC().Format(time.RFC3339)
 	if !strings.Contains(logContent, timestampStr) {
 		t.Errorf("Log does not contain correct timestamp: %s", timestampStr)
 	}
@@ -148,3 +148,288 @@ func TestCredentialsLoggerWithPrettyFormat(t *testing.T) {
 		t.Errorf("Log does not contain password: %s", attempt.Password)
 	}
 }
+
+func TestCredentialsLoggerTags(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "credentials_tags_test*.log")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tempFile.Name())
+	tempFile.Close()
+
+	config := Config{
+		LogFile:   tempFile.Name(),
+		LogFormat: "json",
+		Tags: map[string]string{
+			"sensor_id":  "sensor-01",
+			"datacenter": "fra1",
+		},
+	}
+	logger, err := NewCredentialsLogger(config)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	attempt := CredentialAttempt{
+		Timestamp:  time.Now(),
+		RemoteAddr: "127.0.0.1:12345",
+		Username:   "tag_user",
+		Password:   "tag_password",
+	}
+	if err := logger.Log(attempt); err != nil {
+		t.Fatalf("Logging error: %v", err)
+	}
+
+	content, err := os.ReadFile(tempFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+
+	logContent := string(content)
+	if !strings.Contains(logContent, `"sensor_id":"sensor-01"`) {
+		t.Errorf("Log does not contain sensor_id tag: %s", logContent)
+	}
+	if !strings.Contains(logContent, `"datacenter":"fra1"`) {
+		t.Errorf("Log does not contain datacenter tag: %s", logContent)
+	}
+}
+
+func TestCredentialsLoggerSkipMainLog(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := dir + "/main.log"
+	sinkPath := dir + "/sink.log"
+
+	logger, err := NewCredentialsLogger(Config{
+		LogFile:     mainPath,
+		LogFormat:   "json",
+		SkipMainLog: true,
+		Sinks:       []SinkConfig{{Type: "file", Path: sinkPath, Format: "json"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	if err := logger.Log(CredentialAttempt{Timestamp: time.Now(), RemoteAddr: "127.0.0.1:12345", Username: "sink_user"}); err != nil {
+		t.Fatalf("Logging error: %v", err)
+	}
+	logger.Close()
+
+	if _, err := os.Stat(mainPath); !os.IsNotExist(err) {
+		t.Errorf("Main log should not be created")
+	}
+	content, err := os.ReadFile(sinkPath)
+	if err != nil {
+		t.Fatalf("Failed to read sink: %v", err)
+	}
+	if !strings.Contains(string(content), "sink_user") {
+		t.Errorf("Sink does not contain the attempt: %s", content)
+	}
+
+	if _, err := NewCredentialsLogger(Config{LogFile: mainPath, SkipMainLog: true}); err == nil {
+		t.Errorf("Expected error without sinks")
+	}
+}
+
+func TestCredentialsLoggerExtraSinks(t *testing.T) {
+	sink := &lockedSink{}
+	logger, err := NewCredentialsLogger(Config{SkipMainLog: true, ExtraSinks: []Sink{sink}})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	if err := logger.Log(CredentialAttempt{Timestamp: time.Now(), RemoteAddr: "127.0.0.1:12345", Username: "extra_user"}); err != nil {
+		t.Fatalf("Logging error: %v", err)
+	}
+	if events := sink.snapshot(); len(events) != 1 || events[0].GetString("username") != "extra_user" {
+		t.Errorf("Expected the attempt in the extra sink, got %v", events)
+	}
+	if health := logger.Health(); len(health) != 1 || health[0].Name != "locked" {
+		t.Errorf("Expected the health of the extra sink, got %+v", health)
+	}
+}
+
+func TestCredentialsLoggerRotate(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := dir + "/main.log"
+	key := []byte("chain-key")
+
+	logger, err := NewCredentialsLogger(Config{
+		LogFile:   mainPath,
+		LogFormat: "json",
+		ChainKey:  key,
+		Sinks:     []SinkConfig{{Type: "stdout", Format: "json"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	log := func(user string) {
+		if err := logger.Log(CredentialAttempt{Timestamp: time.Now(), RemoteAddr: "127.0.0.1:12345", Username: user}); err != nil {
+			t.Fatalf("Logging error: %v", err)
+		}
+	}
+	log("before")
+	rotated, err := logger.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate() error: %v", err)
+	}
+	if len(rotated) != 1 || !strings.HasPrefix(rotated[0], mainPath+".") {
+		t.Fatalf("Expected the main log to be rotated, got %v", rotated)
+	}
+	log("after")
+
+	// Both files are chained on their own
+	for path, user := range map[string]string{rotated[0]: "before", mainPath: "after"} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if records, err := VerifyChain(strings.NewReader(string(content)), key); err != nil || records != 1 {
+			t.Errorf("%s: expected a valid chain of 1 record, got %d (%v)", path, records, err)
+		}
+		if !strings.Contains(string(content), user) {
+			t.Errorf("%s: expected the attempt of %s, got %s", path, user, content)
+		}
+	}
+}
+
+func TestCredentialsLoggerReopen(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := dir + "/main.log"
+	key := []byte("chain-key")
+
+	logger, err := NewCredentialsLogger(Config{
+		LogFile:   mainPath,
+		LogFormat: "json",
+		ChainKey:  key,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	log := func(user string) {
+		if err := logger.Log(CredentialAttempt{Timestamp: time.Now(), RemoteAddr: "127.0.0.1:12345", Username: user}); err != nil {
+			t.Fatalf("Logging error: %v", err)
+		}
+	}
+	log("first")
+	// Reopening the same file continues its chain
+	if err := logger.Reopen(); err != nil {
+		t.Fatalf("Reopen() error: %v", err)
+	}
+	log("second")
+	// A file renamed by logrotate keeps the records written before reopening
+	if err := os.Rename(mainPath, mainPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	log("third")
+	if err := logger.Reopen(); err != nil {
+		t.Fatalf("Reopen() error: %v", err)
+	}
+	log("fourth")
+
+	for path, records := range map[string]int{mainPath + ".1": 3, mainPath: 1} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if n, err := VerifyChain(strings.NewReader(string(content)), key); err != nil || n != records {
+			t.Errorf("%s: expected a valid chain of %d records, got %d (%v)", path, records, n, err)
+		}
+	}
+}
+
+func TestCredentialsLoggerReloadSinks(t *testing.T) {
+	dir := t.TempDir()
+	first, second := dir+"/first.log", dir+"/second.log"
+	key := []byte("chain-key")
+
+	logger, err := NewCredentialsLogger(Config{LogFile: first, LogFormat: "json", ChainKey: key})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	added := &failingSink{}
+	logger.AddSink(added)
+
+	log := func(user string) {
+		if err := logger.Log(CredentialAttempt{Timestamp: time.Now(), RemoteAddr: "127.0.0.1:12345", Username: user}); err != nil {
+			t.Fatalf("Logging error: %v", err)
+		}
+	}
+	log("before")
+	if err := logger.ReloadSinks(Config{
+		LogFile:   first,
+		LogFormat: "json",
+		ChainKey:  key,
+		Sinks:     []SinkConfig{{Type: "file", Path: second, Format: "json"}},
+	}); err != nil {
+		t.Fatalf("ReloadSinks() error: %v", err)
+	}
+	log("after")
+
+	// The chain of the reopened file continues
+	content, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if records, err := VerifyChain(strings.NewReader(string(content)), key); err != nil || records != 2 {
+		t.Errorf("Expected a valid chain of 2 records, got %d (%v)", records, err)
+	}
+	content, err = os.ReadFile(second)
+	if err != nil || strings.Contains(string(content), "before") || !strings.Contains(string(content), "after") {
+		t.Errorf("Expected the new sink to get the later attempt only, got %q (%v)", content, err)
+	}
+	if len(added.events) != 2 {
+		t.Errorf("Expected the added sink to be kept, got %d events", len(added.events))
+	}
+	if health := logger.Health(); len(health) != 3 {
+		t.Errorf("Expected 3 sinks, got %v", health)
+	}
+
+	// A sink that cannot be opened restores the previous ones
+	err = logger.ReloadSinks(Config{LogFile: dir + "/missing/third.log", LogFormat: "json"})
+	if err == nil {
+		t.Fatal("Expected an error for a sink that cannot be opened")
+	}
+	log("failed")
+	content, _ = os.ReadFile(second)
+	if !strings.Contains(string(content), "failed") {
+		t.Errorf("Expected the previous sinks to be reopened, got %q", content)
+	}
+	if health := logger.Health(); len(health) != 3 {
+		t.Errorf("Expected 3 sinks, got %v", health)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	var pipeline Pipeline
+	event := &Event{Type: "test"}
+	pipeline.Process(event)
+
+	tag := func(key string) Processor {
+		return ProcessorFunc(func(event *Event) { event.Set(key, "set") })
+	}
+	pipeline.AddProcessor(tag("first"))
+	pipeline.Process(event)
+	if _, ok := event.Get("first"); !ok {
+		t.Fatal("Expected the processor to run")
+	}
+
+	var next Pipeline
+	next.AddProcessor(tag("second"))
+	next.AddProcessor(tag("third"))
+	pipeline.Replace(&next)
+	event = &Event{Type: "test"}
+	pipeline.Process(event)
+	if _, ok := event.Get("first"); ok {
+		t.Error("Expected the replaced processor not to run")
+	}
+	for _, key := range []string{"second", "third"} {
+		if _, ok := event.Get(key); !ok {
+			t.Errorf("Expected %s to be set", key)
+		}
+	}
+}
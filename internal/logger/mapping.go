@@ -0,0 +1,77 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package logger
+
+// FieldMapping selects and renames event fields for a sink
+type FieldMapping struct {
+	// Fields to emit, all fields if empty
+	Fields []string
+	// Fields to drop
+	Exclude []string
+	// Output names of fields, keyed by the original name
+	Rename map[string]string
+}
+
+// IsZero reports whether the mapping leaves events unchanged
+func (m FieldMapping) IsZero() bool {
+	return len(m.Fields) == 0 && len(m.Exclude) == 0 && len(m.Rename) == 0
+}
+
+// Apply returns a copy of the event with the mapping applied
+func (m FieldMapping) Apply(event *Event) *Event {
+	var include map[string]bool
+	if len(m.Fields) > 0 {
+		include = make(map[string]bool, len(m.Fields))
+		for _, f := range m.Fields {
+			include[f] = true
+		}
+	}
+	exclude := make(map[string]bool, len(m.Exclude))
+	for _, f := range m.Exclude {
+		exclude[f] = true
+	}
+
+	mapped := *event
+	mapped.Fields = make([]Field, 0, len(event.Fields))
+	for _, f := range event.Fields {
+		if include != nil && !include[f.Key] {
+			continue
+		}
+		if exclude[f.Key] {
+			continue
+		}
+		if name, ok := m.Rename[f.Key]; ok && name != "" {
+			f.Key = name
+		}
+		mapped.Fields = append(mapped.Fields, f)
+	}
+
+	return &mapped
+}
+
+// mappedSink applies a field mapping before passing events to the wrapped sink
+type mappedSink struct {
+	Sink
+	mapping FieldMapping
+}
+
+func (s *mappedSink) Write(event *Event) error {
+	return s.Sink.Write(s.mapping.Apply(event))
+}
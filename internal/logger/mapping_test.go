@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFieldMappingApply(t *testing.T) {
+	event := NewAuthEvent(CredentialAttempt{
+		Timestamp:  time.Now(),
+		RemoteAddr: "192.168.1.1:54321",
+		Username:   "root",
+		Password:   "secret",
+	})
+
+	tests := []struct {
+		name     string
+		mapping  FieldMapping
+		expected []string
+	}{
+		{
+			name:     "Empty mapping",
+			mapping:  FieldMapping{},
+			expected: []string{"remote_addr", "username", "password"},
+		},
+		{
+			name:     "Field selection",
+			mapping:  FieldMapping{Fields: []string{"username", "remote_addr"}},
+			expected: []string{"remote_addr", "username"},
+		},
+		{
+			name:     "Exclude and rename",
+			mapping:  FieldMapping{Exclude: []string{"password"}, Rename: map[string]string{"remote_addr": "src_ip"}},
+			expected: []string{"src_ip", "username"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapped := tt.mapping.Apply(event)
+			if len(mapped.Fields) != len(tt.expected) {
+				t.Fatalf("Expected %d fields, got %d: %+v", len(tt.expected), len(mapped.Fields), mapped.Fields)
+			}
+			for i, key := range tt.expected {
+				if mapped.Fields[i].Key != key {
+					t.Errorf("Expected field #%d to be '%s', got '%s'", i, key, mapped.Fields[i].Key)
+				}
+			}
+		})
+	}
+
+	// The original event must stay untouched
+	if len(event.Fields) != 3 || event.Fields[0].Key != "remote_addr" {
+		t.Errorf("Original event was modified: %+v", event.Fields)
+	}
+}
+
+func TestPerSinkMapping(t *testing.T) {
+	tmpDir := t.TempDir()
+	mainFile := filepath.Join(tmpDir, "main.log")
+	siemFile := filepath.Join(tmpDir, "siem.log")
+
+	l, err := NewCredentialsLogger(Config{
+		LogFile:   mainFile,
+		LogFormat: "json",
+		Sinks: []SinkConfig{
+			{
+				Type:   "file",
+				Path:   siemFile,
+				Format: "json",
+				Mapping: FieldMapping{
+					Exclude: []string{"password"},
+					Rename:  map[string]string{"remote_addr": "src_ip"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	if err := l.Log(CredentialAttempt{
+		Timestamp:  time.Now(),
+		RemoteAddr: "10.1.1.1:1111",
+		Username:   "mapped_user",
+		Password:   "mapped_password",
+	}); err != nil {
+		t.Fatalf("Logging error: %v", err)
+	}
+	l.Close()
+
+	mainContent, _ := os.ReadFile(mainFile)
+	if !strings.Contains(string(mainContent), `"remote_addr":"10.1.1.1:1111"`) ||
+		!strings.Contains(string(mainContent), "mapped_password") {
+		t.Errorf("Main log should contain all fields: %s", mainContent)
+	}
+
+	siemContent, _ := os.ReadFile(siemFile)
+	if !strings.Contains(string(siemContent), `"src_ip":"10.1.1.1:1111"`) {
+		t.Errorf("SIEM log should contain renamed field: %s", siemContent)
+	}
+	if strings.Contains(string(siemContent), "mapped_password") {
+		t.Errorf("SIEM log should not contain password: %s", siemContent)
+	}
+}
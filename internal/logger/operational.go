@@ -0,0 +1,193 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// OperationalConfig contains settings for the operational log (startup,
+// errors, connections), which is separate from the credential events
+type OperationalConfig struct {
+	// "stderr", "stdout" or path to a log file
+	File string
+	// Minimum level: "debug", "info", "warn" or "error"
+	Level string
+	// Log format: "json" or "pretty"
+	Format string
+	// Destination used instead of File, such as the Windows event log;
+	// closed with the returned closer if it is an io.Closer. Writers
+	// implementing zerolog.LevelWriter receive the level of each message.
+	Output io.Writer
+}
+
+// operationalLevel is the minimum level of operational messages, changed
+// at runtime by SetOperationalLevel
+var operationalLevel atomic.Int32
+
+// operationalFile is the file of the operational log, if it is written to
+// one, reopened by ReopenOperational
+var operationalFile atomic.Pointer[reopenableFile]
+
+// SetupOperational configures the global zerolog logger used for
+// operational messages. The returned closer releases the log file, if any.
+func SetupOperational(config OperationalConfig) (io.Closer, error) {
+	var output io.Writer
+	var closer io.Closer = io.NopCloser(nil)
+
+	switch {
+	case config.Output != nil:
+		output = config.Output
+		if c, ok := config.Output.(io.Closer); ok {
+			closer = c
+		}
+	case config.File == "" || config.File == "stderr":
+		output = os.Stderr
+	case config.File == "stdout":
+		output = os.Stdout
+	default:
+		f, err := openReopenableFile(config.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open operational log file: %w", err)
+		}
+		output = f
+		closer = f
+	}
+
+	level := zerolog.InfoLevel
+	if config.Level != "" {
+		var err error
+		level, err = zerolog.ParseLevel(config.Level)
+		if err != nil {
+			closer.Close()
+			return nil, fmt.Errorf("invalid operational log level: %w", err)
+		}
+	}
+
+	zerolog.TimeFieldFormat = time.RFC3339
+	if config.Format == "pretty" {
+		output = zerolog.ConsoleWriter{Out: output, TimeFormat: time.RFC3339}
+	}
+
+	// The level is applied by the writer rather than globally, so that it
+	// does not affect the credential sinks and can be changed at runtime
+	operationalLevel.Store(int32(level))
+	log.Logger = zerolog.New(levelFilter{output}).With().Timestamp().Logger()
+	if f, ok := closer.(*reopenableFile); ok {
+		operationalFile.Store(f)
+	}
+
+	return closer, nil
+}
+
+// ReopenOperational opens the file of the operational log again at its
+// path, after it was renamed by logrotate. It does nothing if the log is not
+// written to a file.
+func ReopenOperational() error {
+	if f := operationalFile.Load(); f != nil {
+		return f.reopen()
+	}
+	return nil
+}
+
+// reopenableFile is a file opened for appending that can be reopened at its
+// path while it is written to
+type reopenableFile struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// openReopenableFile opens a file for appending
+func openReopenableFile(path string) (*reopenableFile, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &reopenableFile{path: path, f: f}, nil
+}
+
+// Write appends to the current file
+func (r *reopenableFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Write(p)
+}
+
+// reopen replaces the file with the one at its path, keeping the previous
+// file if it can not be opened
+func (r *reopenableFile) reopen() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen operational log file: %w", err)
+	}
+	r.mu.Lock()
+	previous := r.f
+	r.f = f
+	r.mu.Unlock()
+	return previous.Close()
+}
+
+// Close closes the file
+func (r *reopenableFile) Close() error {
+	operationalFile.CompareAndSwap(r, nil)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// SetOperationalLevel changes the minimum level of operational messages
+func SetOperationalLevel(name string) error {
+	switch level, _ := zerolog.ParseLevel(name); level {
+	case zerolog.DebugLevel, zerolog.InfoLevel, zerolog.WarnLevel, zerolog.ErrorLevel:
+		operationalLevel.Store(int32(level))
+		return nil
+	}
+	return fmt.Errorf("invalid operational log level '%s': must be 'debug', 'info', 'warn', or 'error'", name)
+}
+
+// OperationalLevel returns the minimum level of operational messages
+func OperationalLevel() string {
+	return zerolog.Level(operationalLevel.Load()).String()
+}
+
+// levelFilter drops operational messages below operationalLevel
+type levelFilter struct {
+	io.Writer
+}
+
+// WriteLevel writes a message of the given level, if it is not filtered
+func (f levelFilter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < zerolog.Level(operationalLevel.Load()) {
+		return len(p), nil
+	}
+	if w, ok := f.Writer.(zerolog.LevelWriter); ok {
+		return w.WriteLevel(level, p)
+	}
+	return f.Write(p)
+}
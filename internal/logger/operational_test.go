@@ -0,0 +1,183 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestSetupOperational(t *testing.T) {
+	saved := log.Logger
+	defer func() { log.Logger = saved }()
+
+	opsFile := filepath.Join(t.TempDir(), "ops.log")
+	closer, err := SetupOperational(OperationalConfig{
+		File:   opsFile,
+		Level:  "warn",
+		Format: "json",
+	})
+	if err != nil {
+		t.Fatalf("Failed to set up operational logger: %v", err)
+	}
+
+	log.Info().Msg("info message")
+	log.Warn().Msg("warn message")
+
+	// Credential events are not affected by the operational level
+	credFile := filepath.Join(t.TempDir(), "credentials.log")
+	l, err := NewCredentialsLogger(Config{LogFile: credFile, LogFormat: "json"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	l.Log(CredentialAttempt{
+		Timestamp:  time.Now(),
+		RemoteAddr: "127.0.0.1:12345",
+		Username:   "ops_user",
+		Password:   "ops_password",
+	})
+	l.Close()
+	closer.Close()
+
+	ops, _ := os.ReadFile(opsFile)
+	if strings.Contains(string(ops), "info message") {
+		t.Errorf("Info message should be filtered at warn level")
+	}
+	if !strings.Contains(string(ops), "warn message") {
+		t.Errorf("Warn message missing from operational log")
+	}
+	if strings.Contains(string(ops), "ops_user") {
+		t.Errorf("Credential event leaked into operational log")
+	}
+
+	creds, _ := os.ReadFile(credFile)
+	if !strings.Contains(string(creds), "ops_user") {
+		t.Errorf("Credential event missing from credentials log")
+	}
+
+	if _, err := SetupOperational(OperationalConfig{Level: "verbose"}); err == nil {
+		t.Errorf("Expected error for invalid level")
+	}
+}
+
+func TestSetOperationalLevel(t *testing.T) {
+	saved := log.Logger
+	defer func() { log.Logger = saved }()
+
+	opsFile := filepath.Join(t.TempDir(), "ops.log")
+	closer, err := SetupOperational(OperationalConfig{File: opsFile, Level: "warn"})
+	if err != nil {
+		t.Fatalf("Failed to set up operational logger: %v", err)
+	}
+	defer closer.Close()
+
+	log.Info().Msg("before change")
+	if err := SetOperationalLevel("debug"); err != nil {
+		t.Fatalf("SetOperationalLevel() error: %v", err)
+	}
+	if level := OperationalLevel(); level != "debug" {
+		t.Errorf("OperationalLevel() = %s, expected debug", level)
+	}
+	log.Debug().Msg("after change")
+
+	ops, _ := os.ReadFile(opsFile)
+	if strings.Contains(string(ops), "before change") {
+		t.Errorf("Info message should be filtered at warn level")
+	}
+	if !strings.Contains(string(ops), "after change") {
+		t.Errorf("Debug message missing after the level changed")
+	}
+
+	for _, name := range []string{"", "verbose", "panic"} {
+		if err := SetOperationalLevel(name); err == nil {
+			t.Errorf("Expected error for level '%s'", name)
+		}
+	}
+	if level := OperationalLevel(); level != "debug" {
+		t.Errorf("Invalid levels should not change the level, got %s", level)
+	}
+}
+
+func TestReopenOperational(t *testing.T) {
+	saved := log.Logger
+	defer func() { log.Logger = saved }()
+
+	opsFile := filepath.Join(t.TempDir(), "ops.log")
+	closer, err := SetupOperational(OperationalConfig{File: opsFile, Level: "info"})
+	if err != nil {
+		t.Fatalf("Failed to set up operational logger: %v", err)
+	}
+	defer closer.Close()
+
+	log.Info().Msg("before rotation")
+	if err := os.Rename(opsFile, opsFile+".1"); err != nil {
+		t.Fatal(err)
+	}
+	log.Info().Msg("still in the rotated file")
+	if err := ReopenOperational(); err != nil {
+		t.Fatalf("ReopenOperational() error: %v", err)
+	}
+	log.Info().Msg("after rotation")
+
+	rotated, _ := os.ReadFile(opsFile + ".1")
+	current, _ := os.ReadFile(opsFile)
+	if !strings.Contains(string(rotated), "before rotation") || !strings.Contains(string(rotated), "still in the rotated file") {
+		t.Errorf("Expected the messages before reopening in the rotated file, got %s", rotated)
+	}
+	if !strings.Contains(string(current), "after rotation") || strings.Contains(string(current), "before") {
+		t.Errorf("Expected only the message after reopening in the new file, got %s", current)
+	}
+
+	// Nothing is reopened once the file is closed
+	closer.Close()
+	if err := ReopenOperational(); err != nil {
+		t.Errorf("ReopenOperational() error after close: %v", err)
+	}
+}
+
+// levelRecorder records the levels of the messages written to it
+type levelRecorder struct {
+	levels []zerolog.Level
+	closed bool
+}
+
+func (r *levelRecorder) Write(p []byte) (int, error) {
+	return r.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (r *levelRecorder) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	r.levels = append(r.levels, level)
+	return len(p), nil
+}
+
+func (r *levelRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestSetupOperationalOutput(t *testing.T) {
+	saved := log.Logger
+	defer func() { log.Logger = saved }()
+
+	output := &levelRecorder{}
+	closer, err := SetupOperational(OperationalConfig{File: "stderr", Level: "info", Output: output})
+	if err != nil {
+		t.Fatalf("Failed to set up operational logger: %v", err)
+	}
+	log.Debug().Msg("filtered")
+	log.Info().Msg("info")
+	log.Error().Msg("error")
+	closer.Close()
+
+	if want := []zerolog.Level{zerolog.InfoLevel, zerolog.ErrorLevel}; !slices.Equal(output.levels, want) {
+		t.Errorf("Expected levels %v, got %v", want, output.levels)
+	}
+	if !output.closed {
+		t.Errorf("Expected the output to be closed")
+	}
+}
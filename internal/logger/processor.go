@@ -0,0 +1,115 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package logger
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Processor modifies an event before it is passed to the sinks
+type Processor interface {
+	Process(event *Event)
+}
+
+// ProcessorFunc adapts an ordinary function to the Processor interface
+type ProcessorFunc func(event *Event)
+
+// Process calls f(event)
+func (f ProcessorFunc) Process(event *Event) {
+	f(event)
+}
+
+// tagsProcessor attaches static key/value pairs to every event
+type tagsProcessor struct {
+	keys []string
+	tags map[string]string
+}
+
+// newTagsProcessor creates a processor adding the tags in key order
+func newTagsProcessor(tags map[string]string) *tagsProcessor {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return &tagsProcessor{keys: keys, tags: tags}
+}
+
+// Process adds the tags without overwriting fields already present in the event
+func (p *tagsProcessor) Process(event *Event) {
+	for _, k := range p.keys {
+		if _, ok := event.Get(k); !ok {
+			event.Set(k, p.tags[k])
+		}
+	}
+}
+
+// Pipeline is a processor running a list of processors that can be replaced
+// as a whole while events are logged, such as the enrichment of a reloaded
+// configuration. Processors are added to a pipeline before it is used.
+type Pipeline struct {
+	stage atomic.Pointer[stage]
+}
+
+// stage is a generation of the processors of a pipeline with the number of
+// events they are processing
+type stage struct {
+	processors []Processor
+	active     atomic.Int64
+}
+
+// AddProcessor appends a processor to the pipeline
+func (p *Pipeline) AddProcessor(processor Processor) {
+	var processors []Processor
+	if current := p.stage.Load(); current != nil {
+		processors = current.processors
+	}
+	next := &stage{processors: append(processors[:len(processors):len(processors)], processor)}
+	p.stage.Store(next)
+}
+
+// Process runs the processors in the order they were added
+func (p *Pipeline) Process(event *Event) {
+	current := p.stage.Load()
+	if current == nil {
+		return
+	}
+	current.active.Add(1)
+	defer current.active.Add(-1)
+	for _, processor := range current.processors {
+		processor.Process(event)
+	}
+}
+
+// Replace makes the processors of another pipeline run instead of the
+// current ones. It returns once no event is processed by the current ones
+// anymore, so that they can be closed.
+func (p *Pipeline) Replace(other *Pipeline) {
+	previous := p.stage.Swap(other.stage.Load())
+	if previous == nil {
+		return
+	}
+	for previous.active.Load() > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
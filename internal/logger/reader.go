@@ -0,0 +1,189 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog"
+)
+
+// Reader reads events back from a credentials log in JSON format.
+// Gzip-compressed logs are decompressed transparently.
+type Reader struct {
+	scanner *bufio.Scanner
+	times   TimeFormat
+	line    int
+}
+
+// NewReader creates a reader of the log in r with timestamps in the given format
+func NewReader(r io.Reader, times TimeFormat) (*Reader, error) {
+	r, err := Decompress(r)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &Reader{scanner: scanner, times: times}, nil
+}
+
+// Decompress returns a reader of the contents of r, decompressing them if
+// they are gzip-compressed
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return br, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compressed log: %w", err)
+	}
+	return gz, nil
+}
+
+// Next returns the next event of the log, or io.EOF at its end
+func (r *Reader) Next() (*Event, error) {
+	for r.scanner.Scan() {
+		r.line++
+		record := bytes.TrimSpace(r.scanner.Bytes())
+		if len(record) == 0 {
+			continue
+		}
+		event, err := ParseRecord(record, r.times)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return event, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read log: %w", err)
+	}
+	return nil, io.EOF
+}
+
+// ParseRecord converts a JSON log record into an event, keeping the order
+// of its fields
+func ParseRecord(record []byte, times TimeFormat) (*Event, error) {
+	dec := json.NewDecoder(bytes.NewReader(record))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, errors.New("record is not a JSON object")
+	}
+
+	event := &Event{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid record: %w", err)
+		}
+		key, _ := t.(string)
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, fmt.Errorf("invalid record: %w", err)
+		}
+		value = fromJSON(value)
+
+		switch key {
+		case zerolog.LevelFieldName, "component", ChainField:
+		case "event":
+			event.Type, _ = value.(string)
+		case "event_id":
+			event.ID, _ = value.(string)
+		case zerolog.MessageFieldName:
+			event.Message, _ = value.(string)
+		case zerolog.TimestampFieldName:
+			if event.Time, err = times.Parse(value); err != nil {
+				return nil, err
+			}
+		default:
+			event.Fields = append(event.Fields, Field{Key: key, Value: value})
+		}
+	}
+	return event, nil
+}
+
+// fromJSON converts decoded numbers to int where they are integral, as
+// events carry them, and to float64 otherwise
+func fromJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil && int64(int(i)) == i {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = fromJSON(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = fromJSON(v[k])
+		}
+	}
+	return v
+}
+
+// ReadLogs calls fn for every event of the logs at paths in turn. The path
+// "-" reads standard input.
+func ReadLogs(paths []string, times TimeFormat, fn func(*Event) error) error {
+	for _, path := range paths {
+		if err := readLog(path, times, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readLog(path string, times TimeFormat, fn func(*Event) error) error {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	r, err := NewReader(in, times)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for {
+		event, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReaderRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.log")
+	sink, err := newFileSink(path, "json", fileOptions{chainKey: []byte("secret")})
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	ts := time.Date(2024, 3, 1, 9, 30, 45, 0, time.UTC)
+	event := NewAuthEvent(CredentialAttempt{Timestamp: ts, RemoteAddr: "192.0.2.1:4000", Username: "root", Password: "123456"})
+	event.ID = "event-1"
+	event.Set("count", 3)
+	event.Set("ratio", 1.5)
+	event.Set("new_attacker", true)
+	event.Set("sources", []string{"192.0.2.1", "192.0.2.2"})
+	if err := sink.Write(event); err != nil {
+		t.Fatalf("Failed to write event: %v", err)
+	}
+	sink.Close()
+
+	var events []*Event
+	err = ReadLogs([]string{path}, TimeFormat{}, func(e *Event) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+
+	got := events[0]
+	if got.ID != "event-1" || got.Type != "auth_attempt" || got.Message != "authentication attempt" || !got.Time.Equal(ts) {
+		t.Errorf("Unexpected event: %+v", got)
+	}
+	keys := make([]string, len(got.Fields))
+	for i, f := range got.Fields {
+		keys[i] = f.Key
+	}
+	if strings.Join(keys, ",") != "remote_addr,username,password,count,ratio,new_attacker,sources" {
+		t.Errorf("Unexpected fields: %v", keys)
+	}
+	if v, _ := got.Get("count"); v != 3 {
+		t.Errorf("Expected integer count, got %#v", v)
+	}
+	if v, _ := got.Get("ratio"); v != 1.5 {
+		t.Errorf("Expected float ratio, got %#v", v)
+	}
+	if v, _ := got.Get("new_attacker"); v != true {
+		t.Errorf("Expected boolean, got %#v", v)
+	}
+}
+
+func TestReaderCompressed(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`{"event":"auth_attempt","username":"root","time":1709285445}` + "\n\n"))
+	gz.Write([]byte(`{"event":"auth_attempt","username":"admin","time":1709285446}` + "\n"))
+	gz.Close()
+
+	r, err := NewReader(&buf, TimeFormat{name: TimeUnix})
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	var usernames []string
+	for {
+		event, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		usernames = append(usernames, event.GetString("username"))
+	}
+	if strings.Join(usernames, ",") != "root,admin" {
+		t.Errorf("Unexpected events: %v", usernames)
+	}
+}
+
+func TestReaderInvalidRecord(t *testing.T) {
+	r, _ := NewReader(strings.NewReader(`{"event":"auth_attempt"}`+"\n"+`not json`+"\n"), TimeFormat{})
+	if _, err := r.Next(); err != nil {
+		t.Fatalf("Failed to read first event: %v", err)
+	}
+	if _, err := r.Next(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected error on line 2, got %v", err)
+	}
+
+	err := ReadLogs([]string{filepath.Join(t.TempDir(), "missing.log")}, TimeFormat{}, func(*Event) error { return nil })
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected missing file error, got %v", err)
+	}
+}
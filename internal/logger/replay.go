@@ -0,0 +1,72 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package logger
+
+import (
+	"context"
+	"time"
+)
+
+// Pacer delays replayed events so that they keep the spacing they were
+// recorded with, scaled by a speed factor
+type Pacer struct {
+	speed  float64
+	maxGap time.Duration
+	last   time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+// NewPacer creates a pacer. A speed of 2 replays twice as fast as recorded,
+// gaps between events longer than maxGap are shortened to it unless 0.
+func NewPacer(speed float64, maxGap time.Duration) *Pacer {
+	return &Pacer{speed: speed, maxGap: maxGap, sleep: sleepContext}
+}
+
+// Wait blocks until the event recorded at the given time is due. Events
+// older than the previous one are due immediately.
+func (p *Pacer) Wait(ctx context.Context, at time.Time) error {
+	if p.last.IsZero() || at.Before(p.last) {
+		if p.last.IsZero() {
+			p.last = at
+		}
+		return ctx.Err()
+	}
+
+	gap := at.Sub(p.last)
+	p.last = at
+	if p.maxGap > 0 && gap > p.maxGap {
+		gap = p.maxGap
+	}
+	return p.sleep(ctx, time.Duration(float64(gap)/p.speed))
+}
+
+// sleepContext sleeps for d or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
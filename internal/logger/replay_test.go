@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPacer(t *testing.T) {
+	var slept []time.Duration
+	p := NewPacer(2, time.Minute)
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, offset := range []time.Duration{0, 10 * time.Second, 10 * time.Second, 5 * time.Second, time.Hour} {
+		if err := p.Wait(context.Background(), start.Add(offset)); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+
+	// Out of order events are not delayed, long gaps are capped
+	expected := []time.Duration{5 * time.Second, 0, 30 * time.Second}
+	if !reflect.DeepEqual(slept, expected) {
+		t.Errorf("Expected sleeps %v, got %v", expected, slept)
+	}
+}
+
+func TestPacerCancel(t *testing.T) {
+	p := NewPacer(1, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	p.Wait(ctx, start)
+	cancel()
+	if err := p.Wait(ctx, start.Add(time.Hour)); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/metrics"
+	"github.com/abehterev/fakessh/internal/tracing"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Sink is a destination for credential events
+type Sink interface {
+	// Name identifies the sink in health reports and warnings
+	Name() string
+	// Write stores a single event
+	Write(event *Event) error
+	// Close releases resources held by the sink
+	Close() error
+}
+
+// SinkHealth describes the current state of a sink
+type SinkHealth struct {
+	Name              string
+	Healthy           bool
+	ConsecutiveErrors int
+	LastError         string
+	LastSuccess       time.Time
+}
+
+// writerSink writes events through zerolog to a file or another writer
+type writerSink struct {
+	mu     sync.Mutex
+	name   string
+	w      io.Writer
+	closer io.Closer
+	buf    bytes.Buffer
+	logger zerolog.Logger
+	times  TimeFormat
+	chain  *hmacChain
+
+	// Path and encryption of file sinks
+	path       string
+	encryption EncryptionConfig
+}
+
+// newWriterSink creates a sink writing events in the given format to w
+func newWriterSink(name string, w io.Writer, format string, times TimeFormat) *writerSink {
+	s := &writerSink{
+		name:  name,
+		w:     w,
+		times: times,
+	}
+	if c, ok := w.(io.Closer); ok && w != os.Stdout && w != os.Stderr {
+		s.closer = c
+	}
+
+	// Events are rendered into a buffer first, since zerolog does not report write errors
+	if format == "pretty" {
+		s.logger = zerolog.New(zerolog.ConsoleWriter{Out: &s.buf, TimeFormat: time.RFC3339}).
+			With().Str("component", "auth").Logger()
+	} else {
+		// Default is JSON
+		s.logger = zerolog.New(&s.buf).With().Str("component", "auth").Logger()
+	}
+
+	return s
+}
+
+// fileOptions contains optional settings of a file sink
+type fileOptions struct {
+	// Key for the HMAC chain, disabled if empty
+	chainKey []byte
+	// Encryption at rest, disabled if there are no recipients
+	encryption EncryptionConfig
+	// Timestamp format
+	times TimeFormat
+}
+
+// newFileSink opens the file at path for appending and returns a sink writing to it
+func newFileSink(path, format string, opts fileOptions) (*writerSink, error) {
+	if len(opts.chainKey) > 0 && format == "pretty" {
+		return nil, fmt.Errorf("HMAC chaining requires json format: %s", path)
+	}
+
+	var chain *hmacChain
+	if len(opts.chainKey) > 0 {
+		// Continue the chain of an existing file
+		prev, err := lastChainValue(path, opts.encryption.Enabled())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HMAC chain: %w", err)
+		}
+		chain = &hmacChain{key: opts.chainKey, prev: prev}
+	}
+
+	w, err := openLogFile(path, opts.encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newWriterSink("file:"+path, w, format, opts.times)
+	s.path = path
+	s.chain = chain
+	s.encryption = opts.encryption
+	return s, nil
+}
+
+// openLogFile opens a log file for appending, encrypting the records if
+// encryption is configured
+func openLogFile(path string, encryption EncryptionConfig) (io.WriteCloser, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	if !encryption.Enabled() {
+		return f, nil
+	}
+	encrypted, err := newSegmentWriter(f, encryption)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return encrypted, nil
+}
+
+// rotate renames the file of a file sink to path.suffix and continues in a
+// new file, returning the name of the rotated file. The HMAC chain starts
+// again in the new file, as in a file created on start.
+func (s *writerSink) rotate(suffix string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rotated := s.path + "." + suffix
+	if _, err := os.Stat(rotated); err == nil {
+		return "", fmt.Errorf("rotated log file %s already exists", rotated)
+	}
+	if err := os.Rename(s.path, rotated); err != nil {
+		return "", fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	// Records keep going to the rotated file if the new one can not be opened
+	w, err := openLogFile(s.path, s.encryption)
+	if err != nil {
+		return rotated, err
+	}
+	if err := s.closer.Close(); err != nil {
+		log.Warn().Err(err).Str("file", rotated).Msg("failed to close rotated log file")
+	}
+	s.w, s.closer = w, w
+
+	if s.chain != nil {
+		s.chain.prev = ""
+		if s.encryption.Enabled() {
+			os.Remove(s.path + chainStateSuffix)
+		}
+	}
+	return rotated, nil
+}
+
+// reopen closes the file of a file sink and opens the file at its path
+// again, after it was renamed by an external tool such as logrotate. The
+// HMAC chain continues if the file is the same, and starts again in a new
+// or empty file.
+func (s *writerSink) reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fresh := true
+	if info, err := os.Stat(s.path); err == nil && info.Size() > 0 {
+		fresh = false
+	}
+	// Records keep going to the previous file if the path can not be opened
+	w, err := openLogFile(s.path, s.encryption)
+	if err != nil {
+		return err
+	}
+	if err := s.closer.Close(); err != nil {
+		log.Warn().Err(err).Str("file", s.path).Msg("failed to close previous log file")
+	}
+	s.w, s.closer = w, w
+
+	if s.chain != nil && fresh {
+		s.chain.prev = ""
+		if s.encryption.Enabled() {
+			os.Remove(s.path + chainStateSuffix)
+		}
+	}
+	return nil
+}
+
+func (s *writerSink) Name() string {
+	return s.name
+}
+
+func (s *writerSink) Write(event *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Reset()
+	writeEvent(s.logger.Info(), event, s.times)
+
+	record := s.buf.Bytes()
+	var sum string
+	if s.chain != nil {
+		record, sum = s.chain.seal(record)
+	}
+
+	if _, err := s.w.Write(record); err != nil {
+		return err
+	}
+	if s.chain != nil {
+		s.chain.prev = sum
+	}
+	return nil
+}
+
+func (s *writerSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The chain of an encrypted file can not be read back on the next start
+	if s.chain != nil && s.encryption.Enabled() && s.chain.prev != "" {
+		if err := saveChainValue(s.path, s.chain.prev); err != nil {
+			log.Warn().Err(err).Str("file", s.path).Msg("failed to save HMAC chain state")
+		}
+	}
+
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// writeEvent adds the event fields to a zerolog event and sends it
+func writeEvent(ev *zerolog.Event, event *Event, times TimeFormat) {
+	ev = ev.Str("event", event.Type)
+	if event.ID != "" {
+		ev = ev.Str("event_id", event.ID)
+	}
+	for _, f := range event.Fields {
+		switch v := f.Value.(type) {
+		case string:
+			ev = ev.Str(f.Key, v)
+		case int:
+			ev = ev.Int(f.Key, v)
+		case int64:
+			ev = ev.Int64(f.Key, v)
+		case float64:
+			ev = ev.Float64(f.Key, v)
+		case bool:
+			ev = ev.Bool(f.Key, v)
+		default:
+			ev = ev.Interface(f.Key, v)
+		}
+	}
+	ev = ev.Interface(zerolog.TimestampFieldName, times.Format(event.Time))
+	ev.Msg(event.Message)
+}
+
+// trackedSink wraps a sink and keeps its health statistics
+type trackedSink struct {
+	sink    Sink
+	mu      sync.Mutex
+	health  SinkHealth
+	metrics *metrics.Registry
+}
+
+func newTrackedSink(sink Sink, m *metrics.Registry) *trackedSink {
+	return &trackedSink{
+		sink:    sink,
+		health:  SinkHealth{Name: sink.Name(), Healthy: true},
+		metrics: m,
+	}
+}
+
+// write passes the event to the sink and updates the health statistics
+func (t *trackedSink) write(ctx context.Context, tracer *tracing.Tracer, event *Event) error {
+	_, span := tracer.Start(ctx, "sink_write", tracing.KindInternal)
+	span.SetAttribute("sink", t.health.Name)
+	start := time.Now()
+	err := t.sink.Write(event)
+	span.RecordError(err)
+	span.End()
+
+	tag := metrics.Tag{Key: "sink", Value: t.health.Name}
+	t.metrics.Timing(metrics.SinkWriteDuration, time.Since(start), tag)
+	if err != nil {
+		t.metrics.Count(metrics.SinkErrors, 1, tag)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err != nil {
+		t.health.ConsecutiveErrors++
+		t.health.LastError = err.Error()
+		if t.health.Healthy {
+			log.Warn().Err(err).Str("sink", t.health.Name).Msg("credentials sink is failing")
+		}
+		t.health.Healthy = false
+		return err
+	}
+
+	if !t.health.Healthy {
+		log.Info().
+			Str("sink", t.health.Name).
+			Int("failed_writes", t.health.ConsecutiveErrors).
+			Msg("credentials sink recovered")
+	}
+	t.health.Healthy = true
+	t.health.ConsecutiveErrors = 0
+	t.health.LastSuccess = time.Now()
+	return nil
+}
+
+// snapshot returns a copy of the current health statistics
+func (t *trackedSink) snapshot() SinkHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.health
+}
@@ -0,0 +1,182 @@
+package logger
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/metrics"
+)
+
+// failingSink is a sink that fails while broken is set
+type failingSink struct {
+	broken bool
+	events []*Event
+}
+
+func (f *failingSink) Name() string { return "failing" }
+
+func (f *failingSink) Write(event *Event) error {
+	if f.broken {
+		return errors.New("sink is broken")
+	}
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *failingSink) Close() error { return nil }
+
+// lockedSink collects events written from several goroutines
+type lockedSink struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+func (s *lockedSink) Name() string { return "locked" }
+
+func (s *lockedSink) Write(event *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *lockedSink) Close() error { return nil }
+
+// snapshot returns the events written so far
+func (s *lockedSink) snapshot() []*Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Event{}, s.events...)
+}
+
+func TestSinkHealthTracking(t *testing.T) {
+	sink := &failingSink{broken: true}
+	l := &CredentialsLogger{sinks: []*trackedSink{newTrackedSink(sink, nil)}}
+
+	attempt := CredentialAttempt{
+		Timestamp:  time.Now(),
+		RemoteAddr: "127.0.0.1:12345",
+		Username:   "user",
+		Password:   "password",
+	}
+
+	// Without an emergency file every failure is reported
+	for i := 0; i < 3; i++ {
+		if err := l.Log(attempt); !errors.Is(err, ErrSinkUnavailable) {
+			t.Fatalf("Expected ErrSinkUnavailable when all sinks fail, got: %v", err)
+		}
+	}
+
+	health := l.Health()
+	if len(health) != 1 {
+		t.Fatalf("Expected health for 1 sink, got %d", len(health))
+	}
+	if health[0].Healthy {
+		t.Errorf("Expected sink to be unhealthy")
+	}
+	if health[0].ConsecutiveErrors != 3 {
+		t.Errorf("Expected 3 consecutive errors, got %d", health[0].ConsecutiveErrors)
+	}
+	if health[0].LastError == "" {
+		t.Errorf("Expected last error to be recorded")
+	}
+	if err := l.CheckSinks(); err == nil || !strings.Contains(err.Error(), "failing") {
+		t.Errorf("Expected failing sink to be reported, got %v", err)
+	}
+
+	// Recovery resets the error counter
+	sink.broken = false
+	if err := l.Log(attempt); err != nil {
+		t.Fatalf("Unexpected error after recovery: %v", err)
+	}
+	health = l.Health()
+	if !health[0].Healthy || health[0].ConsecutiveErrors != 0 {
+		t.Errorf("Expected sink to be healthy after recovery, got %+v", health[0])
+	}
+	if health[0].LastSuccess.IsZero() {
+		t.Errorf("Expected last success time to be set")
+	}
+	if err := l.CheckSinks(); err != nil {
+		t.Errorf("Expected healthy sinks, got %v", err)
+	}
+}
+
+func TestEmergencyFallback(t *testing.T) {
+	tmpDir := t.TempDir()
+	emergencyFile := filepath.Join(tmpDir, "emergency.log")
+
+	sink := &failingSink{broken: true}
+	registry := metrics.NewRegistry()
+	l := &CredentialsLogger{
+		sinks:         []*trackedSink{newTrackedSink(sink, registry)},
+		emergencyPath: emergencyFile,
+		metrics:       registry,
+	}
+	defer l.Close()
+
+	attempt := CredentialAttempt{
+		Timestamp:  time.Now(),
+		RemoteAddr: "10.0.0.1:2222",
+		Username:   "emergency_user",
+		Password:   "emergency_password",
+	}
+
+	if err := l.Log(attempt); err != nil {
+		t.Fatalf("Expected emergency file to accept the event, got: %v", err)
+	}
+
+	content, err := os.ReadFile(emergencyFile)
+	if err != nil {
+		t.Fatalf("Failed to read emergency file: %v", err)
+	}
+	if !strings.Contains(string(content), "emergency_user") {
+		t.Errorf("Emergency file does not contain the event")
+	}
+
+	counters := make(map[string]float64)
+	for _, c := range registry.Snapshot().Counters {
+		counters[c.Name] = c.Value
+	}
+	if counters[metrics.SinkErrors] != 1 || counters[metrics.EmergencyWrites] != 1 || counters[metrics.Events] != 1 {
+		t.Errorf("Unexpected counters: %v", counters)
+	}
+
+	// Once the sink recovers, the emergency file is no longer used
+	sink.broken = false
+	attempt.Username = "recovered_user"
+	if err := l.Log(attempt); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	content, _ = os.ReadFile(emergencyFile)
+	if strings.Contains(string(content), "recovered_user") {
+		t.Errorf("Event was written to emergency file although sink is healthy")
+	}
+	if len(sink.events) != 1 {
+		t.Errorf("Expected 1 event in sink, got %d", len(sink.events))
+	}
+}
+
+func TestAddSink(t *testing.T) {
+	l, err := NewCredentialsLogger(Config{LogFile: filepath.Join(t.TempDir(), "credentials.log"), LogFormat: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	sink := &lockedSink{}
+	l.AddSink(sink)
+	if err := l.LogEvent(&Event{Type: "auth_attempt"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sink.snapshot(); len(got) != 1 || got[0].ID == "" {
+		t.Errorf("Expected the event with its ID in the added sink, got %v", got)
+	}
+	if health := l.Health(); len(health) != 2 || health[1].Name != "locked" {
+		t.Errorf("Expected health of the added sink, got %+v", health)
+	}
+}
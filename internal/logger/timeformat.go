@@ -0,0 +1,117 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package logger
+
+import (
+	"fmt"
+	"time"
+)
+
+// Named timestamp formats
+const (
+	TimeRFC3339     = "rfc3339"
+	TimeRFC3339Nano = "rfc3339nano"
+	TimeUnix        = "unix"
+	TimeUnixMilli   = "unixms"
+)
+
+// TimeFormat renders event timestamps. The zero value renders RFC3339 in UTC.
+type TimeFormat struct {
+	name     string
+	layout   string
+	location *time.Location
+}
+
+// NewTimeFormat creates a timestamp format. The format is one of the named
+// formats or a Go time layout, the timezone is "UTC", "Local" or an IANA
+// name such as "Europe/Berlin". Empty values select RFC3339 and UTC.
+func NewTimeFormat(format, timezone string) (TimeFormat, error) {
+	tf := TimeFormat{name: TimeRFC3339, layout: time.RFC3339, location: time.UTC}
+
+	switch format {
+	case "", TimeRFC3339:
+	case TimeRFC3339Nano:
+		tf.name, tf.layout = format, time.RFC3339Nano
+	case TimeUnix, TimeUnixMilli:
+		tf.name, tf.layout = format, ""
+	default:
+		tf.name, tf.layout = "custom", format
+	}
+
+	if timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return tf, fmt.Errorf("invalid timezone: %w", err)
+		}
+		tf.location = location
+	}
+
+	return tf, nil
+}
+
+// Format returns the timestamp as a string, or as an integer for epoch formats
+func (tf TimeFormat) Format(t time.Time) interface{} {
+	switch tf.name {
+	case TimeUnix:
+		return t.Unix()
+	case TimeUnixMilli:
+		return t.UnixMilli()
+	}
+
+	location := tf.location
+	if location == nil {
+		location = time.UTC
+	}
+	layout := tf.layout
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	return t.In(location).Format(layout)
+}
+
+// Parse reads back a timestamp written by Format. Strings are parsed with
+// the layout of the format, falling back to RFC3339; numbers are read as
+// epoch seconds, or milliseconds for the unixms format.
+func (tf TimeFormat) Parse(v interface{}) (time.Time, error) {
+	location := tf.location
+	if location == nil {
+		location = time.UTC
+	}
+
+	switch v := v.(type) {
+	case string:
+		if tf.layout != "" {
+			if t, err := time.ParseInLocation(tf.layout, v, location); err == nil {
+				return t, nil
+			}
+		}
+		return time.Parse(time.RFC3339Nano, v)
+	case int64:
+		if tf.name == TimeUnixMilli {
+			return time.UnixMilli(v), nil
+		}
+		return time.Unix(v, 0), nil
+	case int:
+		return tf.Parse(int64(v))
+	case float64:
+		return tf.Parse(int64(v))
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp: %v", v)
+}
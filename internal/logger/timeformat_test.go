@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeFormat(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 45, 123456789, time.FixedZone("UTC+3", 3*3600))
+
+	tests := []struct {
+		format   string
+		timezone string
+		expected interface{}
+	}{
+		{"", "", "2024-03-01T09:30:45Z"},
+		{"rfc3339", "UTC", "2024-03-01T09:30:45Z"},
+		{"rfc3339nano", "UTC", "2024-03-01T09:30:45.123456789Z"},
+		{"unix", "", int64(1709285445)},
+		{"unixms", "", int64(1709285445123)},
+		{"2006-01-02 15:04:05", "Asia/Tokyo", "2024-03-01 18:30:45"},
+	}
+
+	for _, tt := range tests {
+		tf, err := NewTimeFormat(tt.format, tt.timezone)
+		if err != nil {
+			t.Fatalf("Failed to create time format %q: %v", tt.format, err)
+		}
+		if got := tf.Format(ts); got != tt.expected {
+			t.Errorf("Format %q/%q: expected %v, got %v", tt.format, tt.timezone, tt.expected, got)
+		}
+	}
+
+	// The zero value is RFC3339 in UTC
+	if got := (TimeFormat{}).Format(ts); got != "2024-03-01T09:30:45Z" {
+		t.Errorf("Zero value: expected RFC3339 UTC, got %v", got)
+	}
+
+	if _, err := NewTimeFormat("", "Mars/Olympus_Mons"); err == nil {
+		t.Errorf("Expected error for unknown timezone")
+	}
+}
+
+func TestTimeFormatParse(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 9, 30, 45, 0, time.UTC)
+
+	for _, format := range []string{"", "rfc3339nano", "unix", "unixms", "2006-01-02 15:04:05"} {
+		tf, err := NewTimeFormat(format, "Asia/Tokyo")
+		if err != nil {
+			t.Fatalf("Failed to create time format %q: %v", format, err)
+		}
+		got, err := tf.Parse(tf.Format(ts))
+		if err != nil {
+			t.Fatalf("Format %q: failed to parse: %v", format, err)
+		}
+		if !got.Equal(ts) {
+			t.Errorf("Format %q: expected %v, got %v", format, ts, got)
+		}
+	}
+
+	// Custom formats still read RFC3339, e.g. of older records
+	tf, _ := NewTimeFormat("2006-01-02 15:04:05", "")
+	if got, err := tf.Parse("2024-03-01T09:30:45Z"); err != nil || !got.Equal(ts) {
+		t.Errorf("Expected RFC3339 fallback, got %v, %v", got, err)
+	}
+	if _, err := tf.Parse(true); err == nil {
+		t.Errorf("Expected error for a non-timestamp value")
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+var (
+	uuidMu     sync.Mutex
+	uuidLastMs int64
+	uuidSeq    uint16
+)
+
+// NewEventID returns a new UUIDv7 (RFC 9562). IDs generated within the same
+// millisecond are kept in order using a counter in the rand_a bits.
+func NewEventID(t time.Time) string {
+	var u [16]byte
+	rand.Read(u[:])
+
+	ms := t.UnixMilli()
+
+	uuidMu.Lock()
+	if ms <= uuidLastMs {
+		// Same millisecond or clock moved backwards: keep IDs increasing
+		ms = uuidLastMs
+		uuidSeq++
+		if uuidSeq > 0x0fff {
+			ms++
+			uuidSeq = 0
+		}
+	} else {
+		uuidSeq = binary.BigEndian.Uint16(u[6:8]) & 0x07ff
+	}
+	uuidLastMs = ms
+	seq := uuidSeq
+	uuidMu.Unlock()
+
+	// 48-bit timestamp, version 7, 12-bit sequence, variant 10, 62 random bits
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+	u[6] = 0x70 | byte(seq>>8)
+	u[7] = byte(seq)
+	u[8] = 0x80 | u[8]&0x3f
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
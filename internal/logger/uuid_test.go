@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+var uuidV7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewEventID(t *testing.T) {
+	now := time.Now()
+
+	seen := make(map[string]bool)
+	prev := ""
+	for i := 0; i < 5000; i++ {
+		id := NewEventID(now)
+		if !uuidV7Pattern.MatchString(id) {
+			t.Fatalf("Invalid UUIDv7: %s", id)
+		}
+		if seen[id] {
+			t.Fatalf("Duplicate ID: %s", id)
+		}
+		seen[id] = true
+
+		// IDs sort in generation order
+		if id <= prev {
+			t.Fatalf("IDs are not increasing: %s after %s", id, prev)
+		}
+		prev = id
+	}
+}
+
+func TestEventIDAssigned(t *testing.T) {
+	sink := &failingSink{}
+	l := &CredentialsLogger{sinks: []*trackedSink{newTrackedSink(sink, nil)}}
+
+	event := NewAuthEvent(CredentialAttempt{Timestamp: time.Now(), Username: "root"})
+	if err := l.LogEvent(event); err != nil {
+		t.Fatalf("Logging error: %v", err)
+	}
+	if !uuidV7Pattern.MatchString(sink.events[0].ID) {
+		t.Errorf("Expected event to get a UUIDv7, got '%s'", sink.events[0].ID)
+	}
+
+	// Existing IDs are kept, e.g. when replaying events
+	replayed := NewAuthEvent(CredentialAttempt{Timestamp: time.Now(), Username: "root"})
+	replayed.ID = "0190b4d2-0000-7000-8000-000000000000"
+	l.LogEvent(replayed)
+	if sink.events[1].ID != replayed.ID {
+		t.Errorf("Expected existing ID to be kept, got '%s'", sink.events[1].ID)
+	}
+}
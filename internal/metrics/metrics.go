@@ -0,0 +1,257 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package metrics collects operational counters, gauges and timings and
+// passes them to exporters
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the core metrics
+const (
+	// Accepted TCP connections
+	Connections = "connections"
+	// Connections currently open
+	ConnectionsActive = "connections_active"
+	// Connections closed because their source is denied
+	ConnectionsDenied = "connections_denied"
+	// Duration of connections from accept to close
+	ConnectionDuration = "connection_duration"
+	// Authentication attempts
+	AuthAttempts = "auth_attempts"
+	// Events written, tagged with the event type
+	Events = "events"
+	// Failed writes, tagged with the sink name
+	SinkErrors = "sink_errors"
+	// Duration of writes, tagged with the sink name
+	SinkWriteDuration = "sink_write_duration"
+	// Events written to the emergency file
+	EmergencyWrites = "emergency_writes"
+)
+
+// Tag is a dimension of a metric
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Observer receives metric updates
+type Observer interface {
+	Count(name string, delta int64, tags ...Tag)
+	Gauge(name string, value float64, tags ...Tag)
+	Timing(name string, d time.Duration, tags ...Tag)
+}
+
+// TimingSummary summarizes the observations of a timing
+type TimingSummary struct {
+	Count int64
+	Sum   time.Duration
+	Min   time.Duration
+	Max   time.Duration
+}
+
+// Sample is the current value of a metric with a set of tags
+type Sample struct {
+	Name string
+	Tags []Tag
+	// Value of counters and gauges
+	Value float64
+	// Summary of timings
+	Timing TimingSummary
+}
+
+// Snapshot contains the current values of all metrics
+type Snapshot struct {
+	// Time the registry was created, the start of all counters and timings
+	Start    time.Time
+	Time     time.Time
+	Counters []Sample
+	Gauges   []Sample
+	Timings  []Sample
+}
+
+type series struct {
+	name   string
+	tags   []Tag
+	value  float64
+	timing TimingSummary
+}
+
+// Registry keeps the current values of metrics and forwards every update
+// to its observers. A nil Registry discards updates.
+type Registry struct {
+	start     time.Time
+	mu        sync.Mutex
+	counters  map[string]*series
+	gauges    map[string]*series
+	timings   map[string]*series
+	observers []Observer
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		start:    time.Now(),
+		counters: make(map[string]*series),
+		gauges:   make(map[string]*series),
+		timings:  make(map[string]*series),
+	}
+}
+
+// AddObserver registers an exporter receiving all further updates
+func (r *Registry) AddObserver(o Observer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observers = append(r.observers, o)
+}
+
+// Count adds delta to a counter
+func (r *Registry) Count(name string, delta int64, tags ...Tag) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.series(r.counters, name, tags).value += float64(delta)
+	observers := r.observers
+	r.mu.Unlock()
+
+	for _, o := range observers {
+		o.Count(name, delta, tags...)
+	}
+}
+
+// Gauge sets the value of a gauge
+func (r *Registry) Gauge(name string, value float64, tags ...Tag) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.series(r.gauges, name, tags).value = value
+	observers := r.observers
+	r.mu.Unlock()
+
+	for _, o := range observers {
+		o.Gauge(name, value, tags...)
+	}
+}
+
+// AddGauge changes the value of a gauge by delta
+func (r *Registry) AddGauge(name string, delta float64, tags ...Tag) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	s := r.series(r.gauges, name, tags)
+	s.value += delta
+	value := s.value
+	observers := r.observers
+	r.mu.Unlock()
+
+	for _, o := range observers {
+		o.Gauge(name, value, tags...)
+	}
+}
+
+// Timing records a duration
+func (r *Registry) Timing(name string, d time.Duration, tags ...Tag) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	t := &r.series(r.timings, name, tags).timing
+	if t.Count == 0 || d < t.Min {
+		t.Min = d
+	}
+	if d > t.Max {
+		t.Max = d
+	}
+	t.Count++
+	t.Sum += d
+	observers := r.observers
+	r.mu.Unlock()
+
+	for _, o := range observers {
+		o.Timing(name, d, tags...)
+	}
+}
+
+// series returns the series of a metric, creating it if needed
+func (r *Registry) series(m map[string]*series, name string, tags []Tag) *series {
+	key := seriesKey(name, tags)
+	s, ok := m[key]
+	if !ok {
+		s = &series{name: name, tags: append([]Tag(nil), tags...)}
+		m[key] = s
+	}
+	return s
+}
+
+func seriesKey(name string, tags []Tag) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, t := range tags {
+		b.WriteByte(0)
+		b.WriteString(t.Key)
+		b.WriteByte('=')
+		b.WriteString(t.Value)
+	}
+	return b.String()
+}
+
+// Snapshot returns the current values of all metrics, sorted by name
+func (r *Registry) Snapshot() Snapshot {
+	if r == nil {
+		return Snapshot{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return Snapshot{
+		Start:    r.start,
+		Time:     time.Now(),
+		Counters: samples(r.counters),
+		Gauges:   samples(r.gauges),
+		Timings:  samples(r.timings),
+	}
+}
+
+func samples(m map[string]*series) []Sample {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]Sample, 0, len(keys))
+	for _, k := range keys {
+		s := m[k]
+		result = append(result, Sample{
+			Name:   s.name,
+			Tags:   append([]Tag(nil), s.tags...),
+			Value:  s.value,
+			Timing: s.timing,
+		})
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+type recordingObserver struct {
+	counts []string
+}
+
+func (o *recordingObserver) Count(name string, delta int64, tags ...Tag) {
+	o.counts = append(o.counts, name)
+}
+func (o *recordingObserver) Gauge(name string, value float64, tags ...Tag)    {}
+func (o *recordingObserver) Timing(name string, d time.Duration, tags ...Tag) {}
+
+func TestRegistrySnapshot(t *testing.T) {
+	r := NewRegistry()
+	observer := &recordingObserver{}
+	r.AddObserver(observer)
+
+	r.Count(Events, 1, Tag{Key: "type", Value: "auth_attempt"})
+	r.Count(Events, 2, Tag{Key: "type", Value: "auth_attempt"})
+	r.Count(Events, 1, Tag{Key: "type", Value: "ioc"})
+	r.AddGauge(ConnectionsActive, 1)
+	r.AddGauge(ConnectionsActive, 1)
+	r.AddGauge(ConnectionsActive, -1)
+	r.Timing(SinkWriteDuration, 3*time.Millisecond)
+	r.Timing(SinkWriteDuration, time.Millisecond)
+
+	snapshot := r.Snapshot()
+	if len(snapshot.Counters) != 2 || snapshot.Counters[0].Value != 3 || snapshot.Counters[1].Value != 1 {
+		t.Errorf("Unexpected counters: %+v", snapshot.Counters)
+	}
+	if len(snapshot.Gauges) != 1 || snapshot.Gauges[0].Value != 1 {
+		t.Errorf("Unexpected gauges: %+v", snapshot.Gauges)
+	}
+	timing := snapshot.Timings[0].Timing
+	if timing.Count != 2 || timing.Sum != 4*time.Millisecond || timing.Min != time.Millisecond || timing.Max != 3*time.Millisecond {
+		t.Errorf("Unexpected timing summary: %+v", timing)
+	}
+	if len(observer.counts) != 3 {
+		t.Errorf("Expected observer to receive 3 counter updates, got %d", len(observer.counts))
+	}
+}
+
+func TestNilRegistry(t *testing.T) {
+	var r *Registry
+	r.Count(Connections, 1)
+	r.AddGauge(ConnectionsActive, 1)
+	r.Timing(ConnectionDuration, time.Second)
+	if s := r.Snapshot(); len(s.Counters) != 0 {
+		t.Errorf("Expected empty snapshot, got %+v", s)
+	}
+}
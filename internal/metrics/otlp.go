@@ -0,0 +1,255 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/otlp"
+	"github.com/rs/zerolog/log"
+)
+
+// OTLPConfig contains settings of the OTLP metrics exporter
+type OTLPConfig struct {
+	// Base URL of the collector, e.g. "http://localhost:4318"
+	Endpoint string
+	// Headers added to every export request
+	Headers map[string]string
+	// Attributes of the resource besides service.name and host.name
+	Resource map[string]string
+	// How often metrics are pushed
+	Interval time.Duration
+	// Timeout of a single export request
+	Timeout time.Duration
+}
+
+// OTLPExporter periodically pushes the metrics of a registry to an
+// OpenTelemetry collector. Counters are cumulative sums, timings are
+// summaries in seconds with their minimum and maximum as quantiles 0 and 1.
+type OTLPExporter struct {
+	registry *Registry
+	client   *otlp.Client
+	resource otlp.Resource
+	timeout  time.Duration
+	failing  bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewOTLPExporter creates an exporter pushing the metrics of registry
+func NewOTLPExporter(registry *Registry, cfg OTLPConfig) *OTLPExporter {
+	e := &OTLPExporter{
+		registry: registry,
+		client: otlp.NewClient(otlp.ClientConfig{
+			Endpoint: cfg.Endpoint,
+			Headers:  cfg.Headers,
+			Timeout:  cfg.Timeout,
+		}),
+		resource: otlp.NewResource("fakessh", cfg.Resource),
+		timeout:  cfg.Timeout,
+		done:     make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.exportLoop(cfg.Interval)
+	return e
+}
+
+func (e *OTLPExporter) exportLoop(interval time.Duration) {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.Export()
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// Export pushes the current values of all metrics
+func (e *OTLPExporter) Export() {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	payload := metricsRequest{ResourceMetrics: []resourceMetrics{{
+		Resource: e.resource,
+		ScopeMetrics: []scopeMetrics{{
+			Scope:   otlp.Scope{Name: "fakessh"},
+			Metrics: otlpMetrics(e.registry.Snapshot()),
+		}},
+	}}}
+	err := e.client.Post(ctx, "/v1/metrics", payload)
+
+	// Only changes of the export state are logged
+	if err != nil && !e.failing {
+		log.Warn().Err(err).Msg("metrics export failed")
+	} else if err == nil && e.failing {
+		log.Info().Msg("metrics export recovered")
+	}
+	e.failing = err != nil
+}
+
+// Close stops the exporter after a last export
+func (e *OTLPExporter) Close() error {
+	close(e.done)
+	e.wg.Wait()
+	e.Export()
+	return nil
+}
+
+// OTLP/JSON representation of metrics
+type metricsRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     otlp.Resource  `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type scopeMetrics struct {
+	Scope   otlp.Scope   `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Name    string       `json:"name"`
+	Unit    string       `json:"unit,omitempty"`
+	Sum     *otlpSum     `json:"sum,omitempty"`
+	Gauge   *otlpGauge   `json:"gauge,omitempty"`
+	Summary *otlpSummary `json:"summary,omitempty"`
+}
+
+// Cumulative aggregation temporality of OTLP sums
+const temporalityCumulative = 2
+
+type otlpSum struct {
+	DataPoints             []numberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []numberDataPoint `json:"dataPoints"`
+}
+
+type otlpSummary struct {
+	DataPoints []summaryDataPoint `json:"dataPoints"`
+}
+
+type numberDataPoint struct {
+	Attributes        []otlp.KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+type summaryDataPoint struct {
+	Attributes        []otlp.KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	QuantileValues    []quantileValue `json:"quantileValues"`
+}
+
+type quantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// otlpMetrics converts a snapshot, samples of the same name become data
+// points of one metric
+func otlpMetrics(s Snapshot) []otlpMetric {
+	start, now := otlp.UnixNano(s.Start), otlp.UnixNano(s.Time)
+
+	var result []otlpMetric
+	index := make(map[string]int)
+	metric := func(name string, init func() otlpMetric) *otlpMetric {
+		i, ok := index[name]
+		if !ok {
+			i = len(result)
+			index[name] = i
+			result = append(result, init())
+		}
+		return &result[i]
+	}
+
+	for _, c := range s.Counters {
+		m := metric(c.Name, func() otlpMetric {
+			return otlpMetric{Name: "fakessh." + c.Name, Unit: "1", Sum: &otlpSum{
+				AggregationTemporality: temporalityCumulative,
+				IsMonotonic:            true,
+			}}
+		})
+		m.Sum.DataPoints = append(m.Sum.DataPoints, numberDataPoint{
+			Attributes:        attributes(c.Tags),
+			StartTimeUnixNano: start,
+			TimeUnixNano:      now,
+			AsDouble:          c.Value,
+		})
+	}
+	for _, g := range s.Gauges {
+		m := metric(g.Name, func() otlpMetric {
+			return otlpMetric{Name: "fakessh." + g.Name, Unit: "1", Gauge: &otlpGauge{}}
+		})
+		m.Gauge.DataPoints = append(m.Gauge.DataPoints, numberDataPoint{
+			Attributes:   attributes(g.Tags),
+			TimeUnixNano: now,
+			AsDouble:     g.Value,
+		})
+	}
+	for _, t := range s.Timings {
+		m := metric(t.Name, func() otlpMetric {
+			return otlpMetric{Name: "fakessh." + t.Name, Unit: "s", Summary: &otlpSummary{}}
+		})
+		m.Summary.DataPoints = append(m.Summary.DataPoints, summaryDataPoint{
+			Attributes:        attributes(t.Tags),
+			StartTimeUnixNano: start,
+			TimeUnixNano:      now,
+			Count:             strconv.FormatInt(t.Timing.Count, 10),
+			Sum:               t.Timing.Sum.Seconds(),
+			QuantileValues: []quantileValue{
+				{Quantile: 0, Value: t.Timing.Min.Seconds()},
+				{Quantile: 1, Value: t.Timing.Max.Seconds()},
+			},
+		})
+	}
+	return result
+}
+
+func attributes(tags []Tag) []otlp.KeyValue {
+	if len(tags) == 0 {
+		return nil
+	}
+	kvs := make([]otlp.KeyValue, 0, len(tags))
+	for _, t := range tags {
+		kvs = append(kvs, otlp.Attribute(t.Key, t.Value))
+	}
+	return kvs
+}
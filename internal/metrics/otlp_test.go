@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	var mu sync.Mutex
+	var requests []metricsRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		var req metricsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	r := NewRegistry()
+	r.Count(Events, 2, Tag{Key: "type", Value: "auth_attempt"})
+	r.Count(Events, 1, Tag{Key: "type", Value: "ioc"})
+	r.Gauge(ConnectionsActive, 4)
+	r.Timing(ConnectionDuration, 500*time.Millisecond)
+	r.Timing(ConnectionDuration, 1500*time.Millisecond)
+
+	e := NewOTLPExporter(r, OTLPConfig{
+		Endpoint: srv.URL,
+		Resource: map[string]string{"sensor": "s1"},
+		Interval: time.Hour,
+		Timeout:  time.Second,
+	})
+	e.Close()
+
+	if len(requests) != 1 {
+		t.Fatalf("Expected one export on close, got %d", len(requests))
+	}
+	rm := requests[0].ResourceMetrics[0]
+	if len(rm.Resource.Attributes) < 2 || *rm.Resource.Attributes[0].Value.StringValue != "fakessh" {
+		t.Errorf("Unexpected resource: %+v", rm.Resource)
+	}
+
+	metrics := make(map[string]otlpMetric)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+	events := metrics["fakessh.events"]
+	if events.Sum == nil || !events.Sum.IsMonotonic || len(events.Sum.DataPoints) != 2 || events.Sum.DataPoints[0].AsDouble != 2 {
+		t.Errorf("Unexpected events metric: %+v", events)
+	}
+	if active := metrics["fakessh.connections_active"]; active.Gauge == nil || active.Gauge.DataPoints[0].AsDouble != 4 {
+		t.Errorf("Unexpected gauge: %+v", active)
+	}
+	duration := metrics["fakessh.connection_duration"]
+	if duration.Summary == nil {
+		t.Fatalf("Expected summary, got %+v", duration)
+	}
+	dp := duration.Summary.DataPoints[0]
+	if dp.Count != "2" || dp.Sum != 2 || dp.QuantileValues[0].Value != 0.5 || dp.QuantileValues[1].Value != 1.5 {
+		t.Errorf("Unexpected summary: %+v", dp)
+	}
+}
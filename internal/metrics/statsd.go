@@ -0,0 +1,192 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxPacketSize keeps StatsD datagrams below the common Ethernet MTU
+const maxPacketSize = 1432
+
+// StatsDConfig contains settings of the StatsD exporter
+type StatsDConfig struct {
+	// UDP address of the StatsD server, e.g. "127.0.0.1:8125"
+	Address string
+	// Prefix of metric names, e.g. "fakessh."
+	Prefix string
+	// Tags attached to every metric
+	Tags map[string]string
+	// Send tags in the DogStatsD format, plain StatsD drops them
+	DogStatsD bool
+	// How often buffered metrics are sent
+	FlushInterval time.Duration
+}
+
+// StatsD sends metrics to a StatsD or DogStatsD server over UDP. Lines are
+// buffered and sent when a datagram is full or on every flush interval.
+type StatsD struct {
+	mu        sync.Mutex
+	conn      net.Conn
+	buf       bytes.Buffer
+	prefix    string
+	tags      []Tag
+	dogStatsD bool
+	failing   bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewStatsD creates a StatsD exporter
+func NewStatsD(cfg StatsDConfig) (*StatsD, error) {
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to StatsD server: %w", err)
+	}
+
+	keys := make([]string, 0, len(cfg.Tags))
+	for k := range cfg.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := make([]Tag, 0, len(keys))
+	for _, k := range keys {
+		tags = append(tags, Tag{Key: k, Value: cfg.Tags[k]})
+	}
+
+	s := &StatsD{
+		conn:      conn,
+		prefix:    cfg.Prefix,
+		tags:      tags,
+		dogStatsD: cfg.DogStatsD,
+		done:      make(chan struct{}),
+	}
+	if cfg.FlushInterval > 0 {
+		s.wg.Add(1)
+		go s.flushLoop(cfg.FlushInterval)
+	}
+	return s, nil
+}
+
+// Count sends a counter increment
+func (s *StatsD) Count(name string, delta int64, tags ...Tag) {
+	s.write(name, strconv.FormatInt(delta, 10), "c", tags)
+}
+
+// Gauge sends the value of a gauge
+func (s *StatsD) Gauge(name string, value float64, tags ...Tag) {
+	s.write(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+// Timing sends a duration in milliseconds
+func (s *StatsD) Timing(name string, d time.Duration, tags ...Tag) {
+	ms := float64(d) / float64(time.Millisecond)
+	s.write(name, strconv.FormatFloat(ms, 'f', -1, 64), "ms", tags)
+}
+
+// write buffers a single line, e.g. "fakessh.events:1|c|#type:auth_attempt"
+func (s *StatsD) write(name, value, kind string, tags []Tag) {
+	var line strings.Builder
+	line.WriteString(s.prefix)
+	line.WriteString(name)
+	line.WriteByte(':')
+	line.WriteString(value)
+	line.WriteByte('|')
+	line.WriteString(kind)
+	if s.dogStatsD && len(s.tags)+len(tags) > 0 {
+		line.WriteString("|#")
+		for i, t := range append(append([]Tag(nil), s.tags...), tags...) {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			line.WriteString(t.Key)
+			line.WriteByte(':')
+			line.WriteString(t.Value)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.buf.Len() > 0 && s.buf.Len()+1+line.Len() > maxPacketSize {
+		s.flushLocked()
+	}
+	if s.buf.Len() > 0 {
+		s.buf.WriteByte('\n')
+	}
+	s.buf.WriteString(line.String())
+}
+
+// Flush sends the buffered lines
+func (s *StatsD) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushLocked()
+}
+
+func (s *StatsD) flushLocked() {
+	if s.buf.Len() == 0 {
+		return
+	}
+	_, err := s.conn.Write(s.buf.Bytes())
+	s.buf.Reset()
+
+	// Metrics are best effort, only changes of the state are logged
+	if err != nil && !s.failing {
+		log.Warn().Err(err).Msg("failed to send metrics to StatsD")
+	} else if err == nil && s.failing {
+		log.Info().Msg("sending metrics to StatsD recovered")
+	}
+	s.failing = err != nil
+}
+
+func (s *StatsD) flushLoop(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close sends the remaining lines and closes the connection
+func (s *StatsD) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	s.Flush()
+	return s.conn.Close()
+}
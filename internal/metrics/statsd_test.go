@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenUDP starts a UDP server returning received datagrams
+func listenUDP(t *testing.T) (string, <-chan string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	packets := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			packets <- string(buf[:n])
+		}
+	}()
+	return conn.LocalAddr().String(), packets
+}
+
+func receive(t *testing.T, packets <-chan string) string {
+	select {
+	case p := <-packets:
+		return p
+	case <-time.After(2 * time.Second):
+		t.Fatalf("No datagram received")
+		return ""
+	}
+}
+
+func TestStatsDDogStatsD(t *testing.T) {
+	addr, packets := listenUDP(t)
+	s, err := NewStatsD(StatsDConfig{
+		Address:   addr,
+		Prefix:    "fakessh.",
+		Tags:      map[string]string{"sensor": "s1", "env": "prod"},
+		DogStatsD: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	defer s.Close()
+
+	s.Count(Events, 1, Tag{Key: "type", Value: "auth_attempt"})
+	s.Gauge(ConnectionsActive, 3)
+	s.Timing(SinkWriteDuration, 1500*time.Microsecond)
+	s.Flush()
+
+	expected := "fakessh.events:1|c|#env:prod,sensor:s1,type:auth_attempt\n" +
+		"fakessh.connections_active:3|g|#env:prod,sensor:s1\n" +
+		"fakessh.sink_write_duration:1.5|ms|#env:prod,sensor:s1"
+	if got := receive(t, packets); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestStatsDPlain(t *testing.T) {
+	addr, packets := listenUDP(t)
+	s, err := NewStatsD(StatsDConfig{Address: addr, Tags: map[string]string{"sensor": "s1"}, FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	defer s.Close()
+
+	s.Count(AuthAttempts, 2)
+	if got := receive(t, packets); got != "auth_attempts:2|c" {
+		t.Errorf("Expected plain StatsD line without tags, got %q", got)
+	}
+}
+
+func TestStatsDPacketSize(t *testing.T) {
+	addr, packets := listenUDP(t)
+	s, err := NewStatsD(StatsDConfig{Address: addr})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 200; i++ {
+		s.Count(AuthAttempts, 1)
+	}
+	first := receive(t, packets)
+	if len(first) > maxPacketSize {
+		t.Errorf("Datagram of %d bytes exceeds the limit", len(first))
+	}
+	if !strings.HasPrefix(first, "auth_attempts:1|c\n") {
+		t.Errorf("Unexpected datagram: %q", first[:40])
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package otlp sends telemetry to an OpenTelemetry collector using OTLP
+// over HTTP with JSON encoding
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientConfig contains settings of an OTLP/HTTP client
+type ClientConfig struct {
+	// Base URL of the collector, e.g. "http://localhost:4318"
+	Endpoint string
+	// Headers added to every request, e.g. for authentication
+	Headers map[string]string
+	// Timeout of a single export
+	Timeout time.Duration
+}
+
+// Client posts OTLP/JSON payloads to a collector
+type Client struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewClient creates an OTLP/HTTP client
+func NewClient(cfg ClientConfig) *Client {
+	return &Client{
+		endpoint: strings.TrimRight(cfg.Endpoint, "/"),
+		headers:  cfg.Headers,
+		client:   &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Post sends a payload to a signal path, e.g. "/v1/traces"
+func (c *Client) Post(ctx context.Context, path string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// KeyValue is an attribute
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue is the value of an attribute, exactly one field is set
+type AnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// Attribute converts a Go value to an attribute, values of other types
+// than strings, booleans and numbers are formatted as strings
+func Attribute(key string, value interface{}) KeyValue {
+	kv := KeyValue{Key: key}
+	switch v := value.(type) {
+	case string:
+		kv.Value.StringValue = &v
+	case bool:
+		kv.Value.BoolValue = &v
+	case int:
+		s := strconv.Itoa(v)
+		kv.Value.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		kv.Value.IntValue = &s
+	case float64:
+		kv.Value.DoubleValue = &v
+	default:
+		s := fmt.Sprint(v)
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
+
+// Resource describes the entity producing telemetry
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+// Scope identifies the instrumentation
+type Scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// NewResource creates the resource of this process with the service name,
+// the host name and additional attributes in key order
+func NewResource(serviceName string, attributes map[string]string) Resource {
+	r := Resource{Attributes: []KeyValue{Attribute("service.name", serviceName)}}
+	if host, err := os.Hostname(); err == nil {
+		r.Attributes = append(r.Attributes, Attribute("host.name", host))
+	}
+
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		r.Attributes = append(r.Attributes, Attribute(k, attributes[k]))
+	}
+	return r
+}
+
+// UnixNano formats a time as the string encoded nanoseconds used by OTLP/JSON
+func UnixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,62 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAttribute(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"root", `{"key":"k","value":{"stringValue":"root"}}`},
+		{true, `{"key":"k","value":{"boolValue":true}}`},
+		{42, `{"key":"k","value":{"intValue":"42"}}`},
+		{int64(7), `{"key":"k","value":{"intValue":"7"}}`},
+		{1.5, `{"key":"k","value":{"doubleValue":1.5}}`},
+		{[]string{"a"}, `{"key":"k","value":{"stringValue":"[a]"}}`},
+	}
+	for _, tt := range tests {
+		data, _ := json.Marshal(Attribute("k", tt.value))
+		if string(data) != tt.expected {
+			t.Errorf("Value %v: expected %s, got %s", tt.value, tt.expected, data)
+		}
+	}
+}
+
+func TestClientPost(t *testing.T) {
+	var path, contentType, auth, body string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		contentType = r.Header.Get("Content-Type")
+		auth = r.Header.Get("Authorization")
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	c := NewClient(ClientConfig{
+		Endpoint: srv.URL + "/",
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+		Timeout:  time.Second,
+	})
+	if err := c.Post(context.Background(), "/v1/traces", map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if path != "/v1/traces" || contentType != "application/json" || auth != "Bearer token" || body != `{"a":1}` {
+		t.Errorf("Unexpected request: %s %s %s %s", path, contentType, auth, body)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := c.Post(context.Background(), "/v1/traces", nil); err == nil {
+		t.Errorf("Expected error for failed export")
+	}
+}
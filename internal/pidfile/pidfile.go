@@ -0,0 +1,97 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package pidfile writes the process ID of the server to a file, for init
+// scripts and logrotate on hosts without systemd
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// File is a PID file written by this process
+type File struct {
+	path string
+	pid  int
+}
+
+// Write writes the ID of this process to a new file at path. A file left
+// by a process that is no longer running is replaced; a file of a running
+// process is an error, so that two servers do not share the file.
+func Write(path string) (*File, error) {
+	pid := os.Getpid()
+	data := []byte(strconv.Itoa(pid) + "\n")
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) && attempt == 0 {
+			other, readErr := Read(path)
+			if readErr == nil && other != pid && running(other) {
+				return nil, fmt.Errorf("%s belongs to the running process %d", path, other)
+			}
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("failed to remove stale PID file: %w", err)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create PID file: %w", err)
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			os.Remove(path)
+			return nil, fmt.Errorf("failed to write PID file: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			os.Remove(path)
+			return nil, fmt.Errorf("failed to write PID file: %w", err)
+		}
+		return &File{path: path, pid: pid}, nil
+	}
+}
+
+// Read returns the process ID in a PID file
+func Read(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid PID file %s", path)
+	}
+	return pid, nil
+}
+
+// Path returns the path of the file
+func (f *File) Path() string {
+	return f.path
+}
+
+// Remove removes the file, unless it was replaced by another process
+func (f *File) Remove() error {
+	if pid, err := Read(f.path); err != nil || pid != f.pid {
+		return nil
+	}
+	return os.Remove(f.path)
+}
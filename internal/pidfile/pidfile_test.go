@@ -0,0 +1,73 @@
+package pidfile
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fakessh.pid")
+	f, err := Write(path)
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if pid, err := Read(path); err != nil || pid != os.Getpid() {
+		t.Errorf("Expected PID %d, got %d (%v)", os.Getpid(), pid, err)
+	}
+
+	// The file of this process is replaced when it is written again
+	if _, err := Write(path); err != nil {
+		t.Errorf("Write() error for the own PID file: %v", err)
+	}
+
+	if err := f.Remove(); err != nil {
+		t.Fatalf("Remove() error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the file to be removed, got %v", err)
+	}
+}
+
+func TestWriteRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fakessh.pid")
+	other := strconv.Itoa(os.Getppid())
+	if err := os.WriteFile(path, []byte(other+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Write(path); err == nil || !strings.Contains(err.Error(), other) {
+		t.Errorf("Expected an error naming the running process, got %v", err)
+	}
+
+	// A file replaced by another process is not removed
+	f := &File{path: path, pid: os.Getpid()}
+	if err := f.Remove(); err != nil {
+		t.Fatalf("Remove() error: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the file of the other process to be kept, got %v", err)
+	}
+}
+
+func TestWriteStale(t *testing.T) {
+	for name, content := range map[string]string{
+		"exited":  "2147483646\n",
+		"invalid": "not a pid",
+		"empty":   "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fakessh.pid")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Write(path); err != nil {
+				t.Fatalf("Write() error: %v", err)
+			}
+			if pid, err := Read(path); err != nil || pid != os.Getpid() {
+				t.Errorf("Expected PID %d, got %d (%v)", os.Getpid(), pid, err)
+			}
+		})
+	}
+}
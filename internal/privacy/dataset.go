@@ -0,0 +1,102 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package privacy
+
+import (
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// DefaultDroppedFields are removed from published events as they identify
+// the source more precisely than its anonymized address
+var DefaultDroppedFields = []string{"rdns", "city", "latitude", "longitude"}
+
+// DatasetConfig configures the anonymization of recorded events
+type DatasetConfig struct {
+	// Anonymizer of source addresses
+	IP *IPAnonymizer
+	// Masker of passwords
+	Password *PasswordMasker
+	// Fields removed from every event
+	Drop []string
+}
+
+// Dataset anonymizes recorded events for publication. Addresses and
+// passwords are rewritten wherever they appear, so a keyed mode maps the
+// same value to the same result in every event and across runs.
+type Dataset struct {
+	config DatasetConfig
+}
+
+// NewDataset creates a dataset anonymizer
+func NewDataset(config DatasetConfig) *Dataset {
+	return &Dataset{config: config}
+}
+
+// Process anonymizes the event in place
+func (d *Dataset) Process(event *logger.Event) {
+	for _, name := range d.config.Drop {
+		event.Delete(name)
+	}
+
+	if ip := d.config.IP; ip != nil && ip.mode != IPNone {
+		ip.Process(event)
+		if value, ok := event.Get("sources"); ok {
+			event.Set("sources", mapStrings(value, ip.AnonymizeString))
+		}
+		if event.GetString("ioc_type") == "ip" {
+			event.Set("ioc_value", ip.AnonymizeString(event.GetString("ioc_value")))
+		}
+	}
+
+	if m := d.config.Password; m != nil && m.mode != PasswordPlain {
+		// Passwords masked by the sensor already are kept unless redacted
+		if mode := event.GetString("password_mode"); mode == "" || mode == PasswordPlain || m.mode == PasswordRedact {
+			m.Process(event)
+		}
+		if event.GetString("spray_type") == "password" {
+			if _, ok := event.Get("spray_value"); ok {
+				event.Set("spray_value", m.Mask(event.GetString("spray_value")))
+			}
+		}
+	}
+}
+
+// mapStrings applies fn to a list of strings, as recorded or as decoded
+// from JSON. Other values are returned unchanged.
+func mapStrings(value interface{}, fn func(string) string) interface{} {
+	switch list := value.(type) {
+	case []string:
+		mapped := make([]string, len(list))
+		for i, s := range list {
+			mapped[i] = fn(s)
+		}
+		return mapped
+	case []interface{}:
+		mapped := make([]interface{}, len(list))
+		for i, v := range list {
+			if s, ok := v.(string); ok {
+				v = fn(s)
+			}
+			mapped[i] = v
+		}
+		return mapped
+	default:
+		return value
+	}
+}
@@ -0,0 +1,89 @@
+package privacy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestDataset(t *testing.T) {
+	ip, _ := NewIPAnonymizer(IPCryptoPAn, []byte("ip-key"))
+	password, _ := NewPasswordMasker(PasswordHMAC, []byte("password-key"), 0)
+	d := NewDataset(DatasetConfig{IP: ip, Password: password, Drop: DefaultDroppedFields})
+
+	attempt := &logger.Event{Type: "auth_attempt"}
+	attempt.Set("remote_addr", "192.0.2.10:50000")
+	attempt.Set("password", "secret")
+	attempt.Set("rdns", "host.example.com")
+	attempt.Set("country", "NL")
+	d.Process(attempt)
+
+	if got := attempt.GetString("remote_addr"); got != ip.AnonymizeString("192.0.2.10:50000") {
+		t.Errorf("Unexpected remote_addr %s", got)
+	}
+	if got := attempt.GetString("password"); got != password.Mask("secret") {
+		t.Errorf("Unexpected password %s", got)
+	}
+	if _, ok := attempt.Get("rdns"); ok {
+		t.Errorf("rdns should be dropped")
+	}
+	if attempt.GetString("country") != "NL" {
+		t.Errorf("country should be kept")
+	}
+
+	// Lists decoded from JSON and sprayed passwords map to the same values
+	spray := &logger.Event{Type: "spray"}
+	spray.Set("spray_type", "password")
+	spray.Set("spray_value", "secret")
+	spray.Set("sources", []interface{}{"192.0.2.10", "198.51.100.1"})
+	d.Process(spray)
+
+	if got := spray.GetString("spray_value"); got != attempt.GetString("password") {
+		t.Errorf("Sprayed password should match the attempt, got %s", got)
+	}
+	sources, _ := spray.Get("sources")
+	expected := []interface{}{ip.AnonymizeString("192.0.2.10"), ip.AnonymizeString("198.51.100.1")}
+	if !reflect.DeepEqual(sources, expected) {
+		t.Errorf("Expected sources %v, got %v", expected, sources)
+	}
+
+	ioc := &logger.Event{Type: "ioc"}
+	ioc.Set("ioc_type", "ip")
+	ioc.Set("ioc_value", "192.0.2.10")
+	d.Process(ioc)
+	if got := ioc.GetString("ioc_value"); got != ip.AnonymizeString("192.0.2.10") {
+		t.Errorf("Unexpected ioc_value %s", got)
+	}
+}
+
+func TestDatasetMaskedPasswords(t *testing.T) {
+	password, _ := NewPasswordMasker(PasswordSHA256, nil, 0)
+	d := NewDataset(DatasetConfig{Password: password})
+
+	event := &logger.Event{Type: "auth_attempt"}
+	event.Set("password", "abc...")
+	event.Set("password_mode", PasswordTruncate)
+	d.Process(event)
+
+	if got := event.GetString("password"); got != "abc..." {
+		t.Errorf("Masked password should be kept, got %s", got)
+	}
+	if got := event.GetString("password_mode"); got != PasswordTruncate {
+		t.Errorf("Expected password_mode truncate, got %s", got)
+	}
+}
+
+func TestDatasetRedactsMaskedPasswords(t *testing.T) {
+	password, _ := NewPasswordMasker(PasswordRedact, nil, 0)
+	d := NewDataset(DatasetConfig{Password: password})
+
+	event := &logger.Event{Type: "auth_attempt"}
+	event.Set("password", "abc...")
+	event.Set("password_mode", PasswordTruncate)
+	d.Process(event)
+
+	if got := event.GetString("password"); got != redactedPassword {
+		t.Errorf("Expected redacted password, got %s", got)
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package privacy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// IP anonymization modes
+const (
+	// IPNone leaves addresses unchanged
+	IPNone = "none"
+	// IPTruncate zeroes the last octet of IPv4 and the last 80 bits of IPv6 addresses
+	IPTruncate = "truncate"
+	// IPCryptoPAn applies keyed prefix-preserving Crypto-PAn anonymization
+	IPCryptoPAn = "cryptopan"
+)
+
+// IPAnonymizer anonymizes IP addresses according to the configured mode
+type IPAnonymizer struct {
+	mode  string
+	block cipher.Block
+	pad   [16]byte
+}
+
+// NewIPAnonymizer creates an IP anonymizer. The key is required in cryptopan
+// mode; any length is accepted as it is stretched with SHA256.
+func NewIPAnonymizer(mode string, key []byte) (*IPAnonymizer, error) {
+	a := &IPAnonymizer{mode: mode}
+
+	switch mode {
+	case IPNone, IPTruncate:
+	case IPCryptoPAn:
+		if len(key) == 0 {
+			return nil, fmt.Errorf("cryptopan IP mode requires a key")
+		}
+		// The first half of the derived key is the AES key, the second half
+		// is encrypted to produce the padding block, as in the original scheme
+		derived := sha256.Sum256(key)
+		block, err := aes.NewCipher(derived[:16])
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cipher: %w", err)
+		}
+		a.block = block
+		block.Encrypt(a.pad[:], derived[16:])
+	default:
+		return nil, fmt.Errorf("unknown IP mode: %s", mode)
+	}
+
+	return a, nil
+}
+
+// Anonymize returns the anonymized form of an address
+func (a *IPAnonymizer) Anonymize(addr netip.Addr) netip.Addr {
+	addr = addr.Unmap()
+
+	switch a.mode {
+	case IPTruncate:
+		bits := 48
+		if addr.Is4() {
+			bits = 24
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			return addr
+		}
+		return prefix.Addr()
+	case IPCryptoPAn:
+		return a.cryptoPAn(addr)
+	default:
+		return addr
+	}
+}
+
+// cryptoPAn implements the Crypto-PAn scheme: bit i of the result is bit i
+// of the original address XOR the first bit of AES(orig[0:i] || pad[i:])
+func (a *IPAnonymizer) cryptoPAn(addr netip.Addr) netip.Addr {
+	orig := addr.AsSlice()
+	bits := len(orig) * 8
+	result := make([]byte, len(orig))
+
+	var input, output [16]byte
+	for i := 0; i < bits; i++ {
+		// Build the input block from the first i bits of the address and the pad
+		input = a.pad
+		for b := 0; b < i/8; b++ {
+			input[b] = orig[b]
+		}
+		if rem := i % 8; rem != 0 {
+			mask := byte(0xff << (8 - rem))
+			input[i/8] = orig[i/8]&mask | a.pad[i/8]&^mask
+		}
+
+		a.block.Encrypt(output[:], input[:])
+		bit := output[0] >> 7
+		result[i/8] |= bit << (7 - i%8)
+	}
+
+	for i := range result {
+		result[i] ^= orig[i]
+	}
+
+	anonymized, _ := netip.AddrFromSlice(result)
+	return anonymized
+}
+
+// AnonymizeString anonymizes an address given as "ip" or "ip:port",
+// keeping the port. Values that can not be parsed are returned unchanged.
+func (a *IPAnonymizer) AnonymizeString(s string) string {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return a.Anonymize(addr).String()
+	}
+
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return s
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return s
+	}
+	return net.JoinHostPort(a.Anonymize(addr).String(), port)
+}
+
+// Process anonymizes the remote address of the event and drops its reverse
+// DNS name, which would reveal the address
+func (a *IPAnonymizer) Process(event *logger.Event) {
+	if a.mode == IPNone {
+		return
+	}
+	if _, ok := event.Get("remote_addr"); !ok {
+		return
+	}
+	if event.OriginalAddr == "" {
+		event.OriginalAddr = event.GetString("remote_addr")
+	}
+	event.Set("remote_addr", a.AnonymizeString(event.GetString("remote_addr")))
+	event.Delete("rdns")
+	event.Set("ip_mode", a.mode)
+}
@@ -0,0 +1,85 @@
+package privacy
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIPAnonymizerTruncate(t *testing.T) {
+	a, err := NewIPAnonymizer(IPTruncate, nil)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	tests := map[string]string{
+		"192.168.1.100:54321":          "192.168.1.0:54321",
+		"203.0.113.7":                  "203.0.113.0",
+		"[2001:db8:1234:5678::1]:2222": "[2001:db8:1234::]:2222",
+		"not-an-address":               "not-an-address",
+	}
+	for input, expected := range tests {
+		if got := a.AnonymizeString(input); got != expected {
+			t.Errorf("AnonymizeString(%s): expected '%s', got '%s'", input, expected, got)
+		}
+	}
+}
+
+func TestIPAnonymizerCryptoPAn(t *testing.T) {
+	if _, err := NewIPAnonymizer(IPCryptoPAn, nil); err == nil {
+		t.Errorf("Expected error for cryptopan mode without key")
+	}
+
+	a, err := NewIPAnonymizer(IPCryptoPAn, []byte("test-key"))
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+
+	a1 := a.Anonymize(netip.MustParseAddr("10.20.30.40"))
+	a2 := a.Anonymize(netip.MustParseAddr("10.20.30.41"))
+	b := a.Anonymize(netip.MustParseAddr("172.16.0.1"))
+
+	// Deterministic for linkability
+	if a1 != a.Anonymize(netip.MustParseAddr("10.20.30.40")) {
+		t.Errorf("Anonymization should be deterministic")
+	}
+	if a1 == netip.MustParseAddr("10.20.30.40") {
+		t.Errorf("Address was not anonymized")
+	}
+
+	// Prefix preserving: addresses sharing 31 bits keep sharing 31 bits
+	if commonPrefix(a1, a2) < 31 {
+		t.Errorf("Expected common prefix of at least 31 bits, got %d", commonPrefix(a1, a2))
+	}
+	if commonPrefix(a1, b) != commonPrefix(netip.MustParseAddr("10.20.30.40"), netip.MustParseAddr("172.16.0.1")) {
+		t.Errorf("Common prefix length was not preserved")
+	}
+
+	// Different keys produce different mappings
+	other, _ := NewIPAnonymizer(IPCryptoPAn, []byte("other-key"))
+	if other.Anonymize(netip.MustParseAddr("10.20.30.40")) == a1 {
+		t.Errorf("Different keys should produce different results")
+	}
+
+	v6 := a.Anonymize(netip.MustParseAddr("2001:db8::1"))
+	if !v6.Is6() {
+		t.Errorf("IPv6 address should stay IPv6, got %s", v6)
+	}
+}
+
+// commonPrefix returns the number of leading bits shared by two addresses
+func commonPrefix(a, b netip.Addr) int {
+	as, bs := a.AsSlice(), b.AsSlice()
+	for i := range as {
+		x := as[i] ^ bs[i]
+		if x == 0 {
+			continue
+		}
+		n := i * 8
+		for x&0x80 == 0 {
+			n++
+			x <<= 1
+		}
+		return n
+	}
+	return len(as) * 8
+}
@@ -0,0 +1,113 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Password modes
+const (
+	// PasswordPlain logs passwords as they were sent
+	PasswordPlain = "plain"
+	// PasswordSHA256 logs the SHA256 of the password, salted with the key if set
+	PasswordSHA256 = "sha256"
+	// PasswordHMAC logs the HMAC-SHA256 of the password keyed with the key
+	PasswordHMAC = "hmac"
+	// PasswordTruncate logs only the first characters of the password
+	PasswordTruncate = "truncate"
+	// PasswordRedact replaces the password completely
+	PasswordRedact = "redact"
+)
+
+// redactedPassword replaces passwords in redact mode
+const redactedPassword = "[REDACTED]"
+
+// PasswordMasker transforms passwords according to the configured mode
+type PasswordMasker struct {
+	mode     string
+	key      []byte
+	truncate int
+}
+
+// NewPasswordMasker creates a password masker. The key is used as salt in
+// sha256 mode and as HMAC key in hmac mode, truncate is the number of
+// characters kept in truncate mode.
+func NewPasswordMasker(mode string, key []byte, truncate int) (*PasswordMasker, error) {
+	switch mode {
+	case PasswordPlain, PasswordSHA256, PasswordRedact:
+	case PasswordHMAC:
+		if len(key) == 0 {
+			return nil, fmt.Errorf("hmac password mode requires a key")
+		}
+	case PasswordTruncate:
+		if truncate < 0 {
+			return nil, fmt.Errorf("truncate length must not be negative")
+		}
+	default:
+		return nil, fmt.Errorf("unknown password mode: %s", mode)
+	}
+
+	return &PasswordMasker{
+		mode:     mode,
+		key:      key,
+		truncate: truncate,
+	}, nil
+}
+
+// Mask returns the password transformed according to the mode
+func (m *PasswordMasker) Mask(password string) string {
+	switch m.mode {
+	case PasswordSHA256:
+		sum := sha256.Sum256(append(append([]byte{}, m.key...), password...))
+		return hex.EncodeToString(sum[:])
+	case PasswordHMAC:
+		mac := hmac.New(sha256.New, m.key)
+		mac.Write([]byte(password))
+		return hex.EncodeToString(mac.Sum(nil))
+	case PasswordTruncate:
+		runes := []rune(password)
+		if len(runes) <= m.truncate {
+			return password
+		}
+		return string(runes[:m.truncate]) + "..."
+	case PasswordRedact:
+		return redactedPassword
+	default:
+		return password
+	}
+}
+
+// Process replaces the password field of the event and records the mode used
+func (m *PasswordMasker) Process(event *logger.Event) {
+	if m.mode == PasswordPlain {
+		return
+	}
+	if _, ok := event.Get("password"); !ok {
+		return
+	}
+	event.Set("password", m.Mask(event.GetString("password")))
+	event.Set("password_mode", m.mode)
+}
@@ -0,0 +1,81 @@
+package privacy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestPasswordMasker(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		key      string
+		truncate int
+		password string
+		expected string
+	}{
+		{"Plain", PasswordPlain, "", 0, "secret", "secret"},
+		{"SHA256", PasswordSHA256, "", 0, "password", "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8"},
+		{"Truncate", PasswordTruncate, "", 2, "secret", "se..."},
+		{"Truncate short password", PasswordTruncate, "", 10, "secret", "secret"},
+		{"Redact", PasswordRedact, "", 0, "secret", "[REDACTED]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewPasswordMasker(tt.mode, []byte(tt.key), tt.truncate)
+			if err != nil {
+				t.Fatalf("Failed to create masker: %v", err)
+			}
+			if got := m.Mask(tt.password); got != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPasswordMaskerKeyed(t *testing.T) {
+	salted, _ := NewPasswordMasker(PasswordSHA256, []byte("salt"), 0)
+	unsalted, _ := NewPasswordMasker(PasswordSHA256, nil, 0)
+	if salted.Mask("secret") == unsalted.Mask("secret") {
+		t.Errorf("Salted and unsalted hashes should differ")
+	}
+
+	if _, err := NewPasswordMasker(PasswordHMAC, nil, 0); err == nil {
+		t.Errorf("Expected error for hmac mode without key")
+	}
+
+	a, _ := NewPasswordMasker(PasswordHMAC, []byte("key-a"), 0)
+	b, _ := NewPasswordMasker(PasswordHMAC, []byte("key-b"), 0)
+	if a.Mask("secret") == b.Mask("secret") {
+		t.Errorf("HMACs with different keys should differ")
+	}
+	if a.Mask("secret") != a.Mask("secret") {
+		t.Errorf("HMAC should be deterministic")
+	}
+
+	if _, err := NewPasswordMasker("rot13", nil, 0); err == nil {
+		t.Errorf("Expected error for unknown mode")
+	}
+}
+
+func TestPasswordMaskerProcess(t *testing.T) {
+	m, _ := NewPasswordMasker(PasswordRedact, nil, 0)
+	event := logger.NewAuthEvent(logger.CredentialAttempt{
+		Timestamp:  time.Now(),
+		RemoteAddr: "127.0.0.1:1234",
+		Username:   "root",
+		Password:   "secret",
+	})
+
+	m.Process(event)
+
+	if event.GetString("password") != "[REDACTED]" {
+		t.Errorf("Expected redacted password, got '%s'", event.GetString("password"))
+	}
+	if event.GetString("password_mode") != PasswordRedact {
+		t.Errorf("Expected password_mode field to be set")
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Banlist formats
+const (
+	// BanPlain lists one address per line
+	BanPlain = "plain"
+	// BanIPSet writes ipset restore commands replacing the sets atomically
+	BanIPSet = "ipset"
+	// BanNFTables writes an nft script replacing the elements of the sets
+	BanNFTables = "nftables"
+)
+
+// BanConfig contains the thresholds of a banlist
+type BanConfig struct {
+	// Attempts are counted within this window before the current time
+	Window time.Duration
+	// Attempts of a source before it is banned
+	MinAttempts int
+	// Distinct usernames of a source before it is banned, ignored if 0
+	MinUsernames int
+	// Networks never banned, e.g. those of the operators
+	Exclude []netip.Prefix
+}
+
+// Banlist selects the sources of attempts exceeding the thresholds within
+// a window. Attempts are expected in time order; the addresses must not be
+// anonymized.
+type Banlist struct {
+	config  BanConfig
+	recent  []banAttempt
+	sources map[netip.Addr]*banSource
+}
+
+// banAttempt is an attempt within the window
+type banAttempt struct {
+	at       time.Time
+	addr     netip.Addr
+	username string
+	count    int
+}
+
+// banSource counts the attempts of a source within the window
+type banSource struct {
+	attempts  int
+	usernames map[string]int
+}
+
+// NewBanlist creates an empty banlist
+func NewBanlist(config BanConfig) *Banlist {
+	return &Banlist{
+		config:  config,
+		sources: make(map[netip.Addr]*banSource),
+	}
+}
+
+// Add counts an authentication attempt, other events, attempts from
+// excluded networks and attempts with anonymized addresses are ignored
+func (b *Banlist) Add(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	if mode := event.GetString("ip_mode"); mode != "" && mode != "none" {
+		return
+	}
+	addr, err := netip.ParseAddr(sourceIP(event))
+	if err != nil {
+		return
+	}
+	addr = addr.Unmap()
+	for _, prefix := range b.config.Exclude {
+		if prefix.Contains(addr) {
+			return
+		}
+	}
+
+	attempt := banAttempt{at: event.Time, addr: addr, username: event.GetString("username"), count: attemptCount(event)}
+	b.recent = append(b.recent, attempt)
+	s := b.sources[addr]
+	if s == nil {
+		s = &banSource{usernames: make(map[string]int)}
+		b.sources[addr] = s
+	}
+	s.attempts += attempt.count
+	s.usernames[attempt.username]++
+}
+
+// Banned returns the sources exceeding the thresholds within the window
+// before now, in address order. Older attempts are forgotten.
+func (b *Banlist) Banned(now time.Time) []netip.Addr {
+	b.expire(now.Add(-b.config.Window))
+
+	var banned []netip.Addr
+	for addr, s := range b.sources {
+		if s.attempts < b.config.MinAttempts {
+			continue
+		}
+		if b.config.MinUsernames > 0 && len(s.usernames) < b.config.MinUsernames {
+			continue
+		}
+		banned = append(banned, addr)
+	}
+	slices.SortFunc(banned, netip.Addr.Compare)
+	return banned
+}
+
+// expire forgets the attempts before the given time
+func (b *Banlist) expire(before time.Time) {
+	n := 0
+	for n < len(b.recent) && b.recent[n].at.Before(before) {
+		attempt := b.recent[n]
+		s := b.sources[attempt.addr]
+		s.attempts -= attempt.count
+		if s.usernames[attempt.username]--; s.usernames[attempt.username] == 0 {
+			delete(s.usernames, attempt.username)
+		}
+		if s.attempts <= 0 {
+			delete(b.sources, attempt.addr)
+		}
+		n++
+	}
+	// The backing array is reused once it is mostly expired
+	b.recent = b.recent[n:]
+	if cap(b.recent) > 1024 && len(b.recent) < cap(b.recent)/4 {
+		b.recent = slices.Clone(b.recent)
+	}
+}
+
+// BanOutput describes how a banlist is written
+type BanOutput struct {
+	// Format: plain, ipset or nftables
+	Format string
+	// Name of the sets, suffixed with _v4 and _v6
+	Set string
+	// Family and name of the nftables table holding the sets, e.g. "inet filter"
+	Table string
+}
+
+// Validate checks the format and names
+func (o BanOutput) Validate() error {
+	switch o.Format {
+	case BanPlain:
+	case BanIPSet, BanNFTables:
+		if o.Set == "" || strings.ContainsAny(o.Set, " \t\n{};") {
+			return fmt.Errorf("invalid set name '%s'", o.Set)
+		}
+		// ipset names are limited to 31 characters, including the suffixes
+		if o.Format == BanIPSet && len(o.Set) > 23 {
+			return fmt.Errorf("set name '%s' is too long for ipset", o.Set)
+		}
+		if o.Format == BanNFTables && len(strings.Fields(o.Table)) != 2 {
+			return fmt.Errorf("invalid nftables table '%s': must be a family and a name", o.Table)
+		}
+	default:
+		return fmt.Errorf("invalid banlist format '%s': must be plain, ipset or nftables", o.Format)
+	}
+	return nil
+}
+
+// Write writes the banned addresses in the output format
+func (o BanOutput) Write(w io.Writer, banned []netip.Addr) error {
+	var v4, v6 []string
+	for _, addr := range banned {
+		if addr.Is4() {
+			v4 = append(v4, addr.String())
+		} else {
+			v6 = append(v6, addr.String())
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	switch o.Format {
+	case BanIPSet:
+		for _, set := range []struct {
+			name   string
+			family string
+			addrs  []string
+		}{{o.Set + "_v4", "inet", v4}, {o.Set + "_v6", "inet6", v6}} {
+			// The new list is built in a temporary set swapped in at once
+			tmp := set.name + "_tmp"
+			fmt.Fprintf(bw, "create %s hash:ip family %s -exist\n", set.name, set.family)
+			fmt.Fprintf(bw, "create %s hash:ip family %s -exist\n", tmp, set.family)
+			fmt.Fprintf(bw, "flush %s\n", tmp)
+			for _, addr := range set.addrs {
+				fmt.Fprintf(bw, "add %s %s -exist\n", tmp, addr)
+			}
+			fmt.Fprintf(bw, "swap %s %s\n", tmp, set.name)
+			fmt.Fprintf(bw, "destroy %s\n", tmp)
+		}
+	case BanNFTables:
+		// nft -f applies the script atomically
+		table := strings.Join(strings.Fields(o.Table), " ")
+		fmt.Fprintf(bw, "table %s {\n", table)
+		fmt.Fprintf(bw, "\tset %s_v4 {\n\t\ttype ipv4_addr\n\t}\n", o.Set)
+		fmt.Fprintf(bw, "\tset %s_v6 {\n\t\ttype ipv6_addr\n\t}\n", o.Set)
+		fmt.Fprintf(bw, "}\n")
+		for _, set := range []struct {
+			name  string
+			addrs []string
+		}{{o.Set + "_v4", v4}, {o.Set + "_v6", v6}} {
+			fmt.Fprintf(bw, "flush set %s %s\n", table, set.name)
+			if len(set.addrs) > 0 {
+				fmt.Fprintf(bw, "add element %s %s { %s }\n", table, set.name, strings.Join(set.addrs, ", "))
+			}
+		}
+	default:
+		for _, addr := range banned {
+			fmt.Fprintln(bw, addr)
+		}
+	}
+	return bw.Flush()
+}
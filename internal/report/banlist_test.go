@@ -0,0 +1,117 @@
+package report
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestBanlist(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := NewBanlist(BanConfig{
+		Window:       time.Hour,
+		MinAttempts:  3,
+		MinUsernames: 2,
+		Exclude:      []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	})
+
+	// Old attempts are forgotten
+	for i := 0; i < 5; i++ {
+		b.Add(attempt("192.0.2.1:1", "root", "x", now.Add(-2*time.Hour)))
+	}
+	b.Add(attempt("192.0.2.1:1", "root", "x", now.Add(-time.Minute)))
+
+	aggregated := attempt("[2001:db8::1]:22", "root", "x", now.Add(-time.Minute))
+	aggregated.Set("count", 5)
+	b.Add(aggregated)
+	b.Add(attempt("[2001:db8::1]:22", "admin", "x", now))
+
+	// A single username is not enough
+	for i := 0; i < 5; i++ {
+		b.Add(attempt("198.51.100.1:1", "root", "x", now))
+	}
+	for _, username := range []string{"a", "b", "c"} {
+		b.Add(attempt("203.0.113.1:1", username, "x", now))
+		b.Add(attempt("10.1.2.3:1", username, "x", now))
+		anonymized := attempt("192.0.2.99:1", username, "x", now)
+		anonymized.Set("ip_mode", "truncate")
+		b.Add(anonymized)
+	}
+	b.Add(&logger.Event{Type: "heartbeat", Time: now})
+
+	expected := []netip.Addr{netip.MustParseAddr("203.0.113.1"), netip.MustParseAddr("2001:db8::1")}
+	if got := b.Banned(now); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if got := b.Banned(now.Add(2 * time.Hour)); len(got) != 0 {
+		t.Errorf("Expected no bans after the window, got %v", got)
+	}
+	if len(b.sources) != 0 || len(b.recent) != 0 {
+		t.Errorf("Expired attempts should be forgotten")
+	}
+}
+
+func TestBanOutput(t *testing.T) {
+	banned := []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")}
+	tests := []struct {
+		output   BanOutput
+		expected string
+	}{
+		{BanOutput{Format: BanPlain}, "192.0.2.1\n2001:db8::1\n"},
+		{BanOutput{Format: BanIPSet, Set: "fakessh"}, `create fakessh_v4 hash:ip family inet -exist
+create fakessh_v4_tmp hash:ip family inet -exist
+flush fakessh_v4_tmp
+add fakessh_v4_tmp 192.0.2.1 -exist
+swap fakessh_v4_tmp fakessh_v4
+destroy fakessh_v4_tmp
+create fakessh_v6 hash:ip family inet6 -exist
+create fakessh_v6_tmp hash:ip family inet6 -exist
+flush fakessh_v6_tmp
+add fakessh_v6_tmp 2001:db8::1 -exist
+swap fakessh_v6_tmp fakessh_v6
+destroy fakessh_v6_tmp
+`},
+		{BanOutput{Format: BanNFTables, Set: "fakessh", Table: "inet filter"}, `table inet filter {
+	set fakessh_v4 {
+		type ipv4_addr
+	}
+	set fakessh_v6 {
+		type ipv6_addr
+	}
+}
+flush set inet filter fakessh_v4
+add element inet filter fakessh_v4 { 192.0.2.1 }
+flush set inet filter fakessh_v6
+add element inet filter fakessh_v6 { 2001:db8::1 }
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.output.Format, func(t *testing.T) {
+			if err := tt.output.Validate(); err != nil {
+				t.Fatalf("Unexpected validation error: %v", err)
+			}
+			var b strings.Builder
+			if err := tt.output.Write(&b, banned); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			if b.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, b.String())
+			}
+		})
+	}
+
+	for _, output := range []BanOutput{
+		{Format: "iptables"},
+		{Format: BanIPSet, Set: "a very long name for an ipset"},
+		{Format: BanNFTables, Set: "fakessh", Table: "filter"},
+	} {
+		if err := output.Validate(); err == nil {
+			t.Errorf("Expected validation error for %+v", output)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// ParseRange reads a period given as START..END with the times of
+// ParseTime, either of which can be left out: "2024-01-01..2024-02-01",
+// "7d.." or "14d..7d"
+func ParseRange(s string, now time.Time) (Filter, error) {
+	var f Filter
+	since, until, ok := strings.Cut(s, "..")
+	if !ok {
+		return f, fmt.Errorf("invalid range %q: must be START..END", s)
+	}
+	var err error
+	if since != "" {
+		if f.Since, err = ParseTime(since, now); err != nil {
+			return f, err
+		}
+	}
+	if until != "" {
+		if f.Until, err = ParseTime(until, now); err != nil {
+			return f, err
+		}
+	}
+	if !f.Since.IsZero() && !f.Until.IsZero() && !f.Since.Before(f.Until) {
+		return f, fmt.Errorf("invalid range %q: start must be before end", s)
+	}
+	return f, nil
+}
+
+// PeriodStats describes the attempts of a period
+type PeriodStats struct {
+	// Start and end of the period, the first and last attempt if not bounded
+	Since          *time.Time `json:"since,omitempty"`
+	Until          *time.Time `json:"until,omitempty"`
+	Attempts       int        `json:"attempts"`
+	AttemptsPerDay float64    `json:"attempts_per_day"`
+	UniqueIPs      int        `json:"unique_ips"`
+	Usernames      int        `json:"usernames"`
+	Passwords      int        `json:"passwords"`
+	Countries      int        `json:"countries"`
+}
+
+// Shift is the change of the share of a value in the attempts of two
+// periods, in percent
+type Shift struct {
+	Value  string  `json:"value"`
+	A      int     `json:"a"`
+	B      int     `json:"b"`
+	ShareA float64 `json:"share_a"`
+	ShareB float64 `json:"share_b"`
+}
+
+// Comparison tells what changed between two periods: the volume, the
+// sources that appeared and disappeared, and how the distribution of
+// usernames, passwords and countries shifted
+type Comparison struct {
+	A              PeriodStats `json:"a"`
+	B              PeriodStats `json:"b"`
+	NewIPs         int         `json:"new_ips"`
+	TopNewIPs      []Count     `json:"top_new_ips"`
+	GoneIPs        int         `json:"gone_ips"`
+	TopGoneIPs     []Count     `json:"top_gone_ips"`
+	UsernameShifts []Shift     `json:"username_shifts"`
+	PasswordShifts []Shift     `json:"password_shifts"`
+	CountryShifts  []Shift     `json:"country_shifts"`
+}
+
+// periodCounter counts the attempts of a period
+type periodCounter struct {
+	filter    Filter
+	first     time.Time
+	last      time.Time
+	attempts  int
+	ips       map[string]int
+	usernames map[string]int
+	passwords map[string]int
+	countries map[string]int
+}
+
+func newPeriodCounter(filter Filter) *periodCounter {
+	return &periodCounter{
+		filter:    filter,
+		ips:       make(map[string]int),
+		usernames: make(map[string]int),
+		passwords: make(map[string]int),
+		countries: make(map[string]int),
+	}
+}
+
+func (p *periodCounter) add(event *logger.Event, n int) {
+	p.attempts += n
+	if p.first.IsZero() || event.Time.Before(p.first) {
+		p.first = event.Time
+	}
+	if event.Time.After(p.last) {
+		p.last = event.Time
+	}
+	p.ips[sourceIP(event)] += n
+	p.usernames[event.GetString("username")] += n
+	p.passwords[event.GetString("password")] += n
+	if country := event.GetString("country"); country != "" {
+		p.countries[country] += n
+	}
+}
+
+func (p *periodCounter) stats() PeriodStats {
+	s := PeriodStats{
+		Attempts:  p.attempts,
+		UniqueIPs: len(p.ips),
+		Usernames: len(p.usernames),
+		Passwords: len(p.passwords),
+		Countries: len(p.countries),
+	}
+	since, until := p.filter.Since, p.filter.Until
+	if since.IsZero() {
+		since = p.first
+	}
+	if until.IsZero() {
+		until = p.last
+	}
+	if !since.IsZero() && !until.IsZero() {
+		s.Since, s.Until = &since, &until
+		// Periods shorter than a day count as a day
+		days := math.Max(until.Sub(since).Hours()/24, 1)
+		s.AttemptsPerDay = math.Round(float64(p.attempts)/days*10) / 10
+	}
+	return s
+}
+
+// Comparer counts the authentication attempts of two periods for a comparison
+type Comparer struct {
+	top int
+	a   *periodCounter
+	b   *periodCounter
+}
+
+// NewComparer creates a comparer of the periods a and b with lists of n entries
+func NewComparer(a, b Filter, n int) *Comparer {
+	return &Comparer{
+		top: n,
+		a:   newPeriodCounter(a),
+		b:   newPeriodCounter(b),
+	}
+}
+
+// Add counts an authentication attempt in the periods it belongs to, other
+// events are ignored
+func (c *Comparer) Add(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	n := attemptCount(event)
+	if c.a.filter.Match(event) {
+		c.a.add(event, n)
+	}
+	if c.b.filter.Match(event) {
+		c.b.add(event, n)
+	}
+}
+
+// Comparison returns the comparison of the attempts counted so far
+func (c *Comparer) Comparison() Comparison {
+	newIPs, goneIPs := make(map[string]int), make(map[string]int)
+	for ip, n := range c.b.ips {
+		if _, ok := c.a.ips[ip]; !ok {
+			newIPs[ip] = n
+		}
+	}
+	for ip, n := range c.a.ips {
+		if _, ok := c.b.ips[ip]; !ok {
+			goneIPs[ip] = n
+		}
+	}
+	return Comparison{
+		A:              c.a.stats(),
+		B:              c.b.stats(),
+		NewIPs:         len(newIPs),
+		TopNewIPs:      top(newIPs, c.top),
+		GoneIPs:        len(goneIPs),
+		TopGoneIPs:     top(goneIPs, c.top),
+		UsernameShifts: shifts(c.a.usernames, c.b.usernames, c.a.attempts, c.b.attempts, c.top),
+		PasswordShifts: shifts(c.a.passwords, c.b.passwords, c.a.attempts, c.b.attempts, c.top),
+		CountryShifts:  shifts(c.a.countries, c.b.countries, c.a.attempts, c.b.attempts, c.top),
+	}
+}
+
+// shifts returns the n values whose share of the attempts changed most
+func shifts(a, b map[string]int, totalA, totalB, n int) []Shift {
+	share := func(count, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return math.Round(float64(count)/float64(total)*1000) / 10
+	}
+	values := make(map[string]bool, len(a)+len(b))
+	for v := range a {
+		values[v] = true
+	}
+	for v := range b {
+		values[v] = true
+	}
+	result := make([]Shift, 0, len(values))
+	for v := range values {
+		s := Shift{Value: v, A: a[v], B: b[v], ShareA: share(a[v], totalA), ShareB: share(b[v], totalB)}
+		if s.ShareA != s.ShareB {
+			result = append(result, s)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		di := math.Abs(result[i].ShareB - result[i].ShareA)
+		dj := math.Abs(result[j].ShareB - result[j].ShareA)
+		if di != dj {
+			return di > dj
+		}
+		return result[i].Value < result[j].Value
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// WriteTable writes the comparison as aligned text tables
+func (c Comparison) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, p := range []struct {
+		name  string
+		stats PeriodStats
+	}{{"A", c.A}, {"B", c.B}} {
+		if p.stats.Since == nil {
+			fmt.Fprintf(tw, "Period %s:\tno attempts\n", p.name)
+			continue
+		}
+		fmt.Fprintf(tw, "Period %s:\t%s - %s\n", p.name, p.stats.Since.UTC().Format(time.RFC3339), p.stats.Until.UTC().Format(time.RFC3339))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(tw, "\n\tA\tB\tCHANGE\n")
+	rows := []struct {
+		name string
+		a, b float64
+	}{
+		{"Attempts", float64(c.A.Attempts), float64(c.B.Attempts)},
+		{"Attempts per day", c.A.AttemptsPerDay, c.B.AttemptsPerDay},
+		{"Unique IPs", float64(c.A.UniqueIPs), float64(c.B.UniqueIPs)},
+		{"Usernames", float64(c.A.Usernames), float64(c.B.Usernames)},
+		{"Passwords", float64(c.A.Passwords), float64(c.B.Passwords)},
+		{"Countries", float64(c.A.Countries), float64(c.B.Countries)},
+	}
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%g\t%g\t%s\n", r.name, r.a, r.b, change(r.a, r.b))
+	}
+
+	lists := []struct {
+		title  string
+		total  int
+		counts []Count
+	}{
+		{"NEW IPS", c.NewIPs, c.TopNewIPs},
+		{"DISAPPEARED IPS", c.GoneIPs, c.TopGoneIPs},
+	}
+	for _, l := range lists {
+		if len(l.counts) == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "\n%s (%d)\tATTEMPTS\n", l.title, l.total)
+		for _, count := range l.counts {
+			fmt.Fprintf(tw, "%s\t%d\n", printable(count.Value), count.Count)
+		}
+	}
+
+	shiftLists := []struct {
+		title  string
+		shifts []Shift
+	}{
+		{"USERNAME", c.UsernameShifts},
+		{"PASSWORD", c.PasswordShifts},
+		{"COUNTRY", c.CountryShifts},
+	}
+	for _, l := range shiftLists {
+		if len(l.shifts) == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "\n%s\tSHARE A\tSHARE B\tCHANGE\n", l.title)
+		for _, s := range l.shifts {
+			fmt.Fprintf(tw, "%s\t%.1f%% (%d)\t%.1f%% (%d)\t%+.1f pp\n", printable(s.Value), s.ShareA, s.A, s.ShareB, s.B, s.ShareB-s.ShareA)
+		}
+	}
+	return tw.Flush()
+}
+
+// change formats the relative change from a to b
+func change(a, b float64) string {
+	switch {
+	case a == b:
+		return "0%"
+	case a == 0:
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", (b-a)/a*100)
+}
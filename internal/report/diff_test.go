@@ -0,0 +1,67 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	now := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	f, err := ParseRange("14d..7d", now)
+	if err != nil || !f.Since.Equal(now.Add(-14*24*time.Hour)) || !f.Until.Equal(now.Add(-7*24*time.Hour)) {
+		t.Errorf("Unexpected range: %+v, %v", f, err)
+	}
+	f, err = ParseRange("2024-01-01..", now)
+	if err != nil || !f.Since.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || !f.Until.IsZero() {
+		t.Errorf("Unexpected open range: %+v, %v", f, err)
+	}
+	for _, s := range []string{"7d", "7d..14d", "x..", "..y"} {
+		if _, err := ParseRange(s, now); err == nil {
+			t.Errorf("Expected error for %q", s)
+		}
+	}
+}
+
+func TestComparer(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := Filter{Since: at, Until: at.Add(48 * time.Hour)}
+	b := Filter{Since: at.Add(48 * time.Hour), Until: at.Add(96 * time.Hour)}
+	c := NewComparer(a, b, 10)
+
+	c.Add(attempt("192.0.2.1:1", "root", "123456", at))
+	c.Add(attempt("192.0.2.1:1", "root", "root", at.Add(time.Hour)))
+	c.Add(attempt("192.0.2.2:1", "admin", "admin", at.Add(2*time.Hour)))
+	c.Add(attempt("192.0.2.2:1", "root", "123456", at.Add(50*time.Hour)))
+	aggregated := attempt("198.51.100.1:1", "pi", "raspberry", at.Add(60*time.Hour))
+	aggregated.Set("count", 7)
+	c.Add(aggregated)
+	// Outside of both periods
+	c.Add(attempt("203.0.113.1:1", "root", "x", at.Add(200*time.Hour)))
+
+	cmp := c.Comparison()
+	if cmp.A.Attempts != 3 || cmp.B.Attempts != 8 || cmp.A.UniqueIPs != 2 || cmp.B.AttemptsPerDay != 4 {
+		t.Errorf("Unexpected periods: %+v %+v", cmp.A, cmp.B)
+	}
+	if cmp.NewIPs != 1 || cmp.TopNewIPs[0] != (Count{Value: "198.51.100.1", Count: 7}) {
+		t.Errorf("Unexpected new IPs: %d %v", cmp.NewIPs, cmp.TopNewIPs)
+	}
+	if cmp.GoneIPs != 1 || cmp.TopGoneIPs[0] != (Count{Value: "192.0.2.1", Count: 2}) {
+		t.Errorf("Unexpected disappeared IPs: %d %v", cmp.GoneIPs, cmp.TopGoneIPs)
+	}
+	// pi rose from 0% to 87.5%, root fell from 66.7% to 12.5%
+	if len(cmp.UsernameShifts) != 3 || cmp.UsernameShifts[0].Value != "pi" || cmp.UsernameShifts[0].ShareB != 87.5 ||
+		cmp.UsernameShifts[1].Value != "root" || cmp.UsernameShifts[1].ShareA != 66.7 {
+		t.Errorf("Unexpected username shifts: %+v", cmp.UsernameShifts)
+	}
+
+	var out strings.Builder
+	if err := cmp.WriteTable(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"+166.7%", "NEW IPS (1)", "DISAPPEARED IPS (1)", "+87.5 pp", "-54.2 pp"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Expected %q in:\n%s", s, out.String())
+		}
+	}
+}
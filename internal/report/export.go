@@ -0,0 +1,272 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Export formats
+const (
+	ExportJSON    = "json"
+	ExportCSV     = "csv"
+	ExportParquet = "parquet"
+	ExportSQL     = "sql"
+	ExportSQLite  = "sqlite"
+)
+
+// DefaultColumns are the exported columns if none are selected
+var DefaultColumns = []string{
+	"time", "event", "event_id", "source_ip", "source_port", "username", "password",
+	"client_version", "count", "country", "asn",
+}
+
+// Exporter writes events as rows of a table
+type Exporter interface {
+	// Write adds a row for the event
+	Write(event *logger.Event) error
+	// Close completes the output
+	Close() error
+}
+
+// NewExporter creates an exporter writing the columns in a format to w.
+// The JSON format writes whole events, one object per line. The SQLite
+// format needs a w implementing io.WriteSeeker, such as a file.
+func NewExporter(format string, w io.Writer, columns []string) (Exporter, error) {
+	if len(columns) == 0 {
+		columns = DefaultColumns
+	}
+	switch format {
+	case ExportJSON:
+		return &jsonExporter{w: w}, nil
+	case ExportCSV:
+		return newCSVExporter(w, columns)
+	case ExportParquet:
+		return newParquetExporter(w, columns)
+	case ExportSQL:
+		return newSQLExporter(w, "events", columns)
+	case ExportSQLite:
+		return newSQLiteExporter(w, "events", columns)
+	}
+	return nil, fmt.Errorf("unknown export format '%s': must be json, csv, parquet, sql or sqlite", format)
+}
+
+// Column returns the value of a column for an event: an event field, or
+// one of time (RFC3339 in UTC), event, event_id, message, source_ip and
+// source_port. Missing fields are nil.
+func Column(event *logger.Event, name string) interface{} {
+	switch name {
+	case "time":
+		return event.Time.UTC().Format(time.RFC3339Nano)
+	case "event":
+		return event.Type
+	case "event_id":
+		return event.ID
+	case "message":
+		return event.Message
+	case "source_ip", "source_port":
+		addr := event.GetString("remote_addr")
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			host, port = addr, ""
+		}
+		if name == "source_ip" {
+			return host
+		}
+		if n, err := strconv.Atoi(port); err == nil {
+			return n
+		}
+		return nil
+	}
+	v, _ := event.Get(name)
+	return v
+}
+
+// jsonExporter writes whole events as JSON lines, keeping the order of their fields
+type jsonExporter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (e *jsonExporter) Write(event *logger.Event) error {
+	e.buf.Reset()
+	e.buf.WriteByte('{')
+	e.field("time", event.Time.UTC().Format(time.RFC3339Nano))
+	e.field("event", event.Type)
+	if event.ID != "" {
+		e.field("event_id", event.ID)
+	}
+	for _, f := range event.Fields {
+		e.field(f.Key, f.Value)
+	}
+	if event.Message != "" {
+		e.field("message", event.Message)
+	}
+	e.buf.WriteString("}\n")
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+// field appends a key and its value to the current object
+func (e *jsonExporter) field(key string, value interface{}) {
+	if e.buf.Len() > 1 {
+		e.buf.WriteByte(',')
+	}
+	k, _ := json.Marshal(key)
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	e.buf.Write(k)
+	e.buf.WriteByte(':')
+	e.buf.Write(v)
+}
+
+func (e *jsonExporter) Close() error {
+	return nil
+}
+
+// csvExporter writes a header and a record per event
+type csvExporter struct {
+	w       *csv.Writer
+	columns []string
+	record  []string
+}
+
+func newCSVExporter(w io.Writer, columns []string) (*csvExporter, error) {
+	e := &csvExporter{w: csv.NewWriter(w), columns: columns, record: make([]string, len(columns))}
+	if err := e.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *csvExporter) Write(event *logger.Event) error {
+	for i, c := range e.columns {
+		e.record[i] = csvValue(Column(event, c))
+	}
+	return e.w.Write(e.record)
+}
+
+func (e *csvExporter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// csvValue formats a value as a CSV field, lists and objects as JSON
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int, int64, float64, bool:
+		return fmt.Sprint(v)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// sqlExporter writes SQL statements creating and filling a table, which
+// sqlite3 loads into a database
+type sqlExporter struct {
+	w       io.Writer
+	table   string
+	columns []string
+	buf     strings.Builder
+}
+
+func newSQLExporter(w io.Writer, table string, columns []string) (*sqlExporter, error) {
+	e := &sqlExporter{w: w, table: table, columns: columns}
+	_, err := fmt.Fprintf(w, "CREATE TABLE IF NOT EXISTS %s (%s);\nBEGIN TRANSACTION;\n", sqlIdentifier(table), strings.Join(sqlIdentifiers(columns), ", "))
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *sqlExporter) Write(event *logger.Event) error {
+	e.buf.Reset()
+	e.buf.WriteString("INSERT INTO ")
+	e.buf.WriteString(sqlIdentifier(e.table))
+	e.buf.WriteString(" VALUES (")
+	for i, c := range e.columns {
+		if i > 0 {
+			e.buf.WriteString(", ")
+		}
+		e.buf.WriteString(sqlValue(Column(event, c)))
+	}
+	e.buf.WriteString(");\n")
+	_, err := io.WriteString(e.w, e.buf.String())
+	return err
+}
+
+func (e *sqlExporter) Close() error {
+	_, err := io.WriteString(e.w, "COMMIT;\n")
+	return err
+}
+
+// sqlIdentifier quotes a table or column name
+func sqlIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqlIdentifiers quotes column names
+func sqlIdentifiers(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = sqlIdentifier(n)
+	}
+	return quoted
+}
+
+// sqlValue formats a value as an SQL literal, lists and objects as JSON
+// text. Strings that are not valid text are written as blobs.
+func sqlValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int, int64, float64:
+		return fmt.Sprint(v)
+	case string:
+		if !utf8.ValidString(v) || strings.ContainsRune(v, 0) {
+			return "X'" + hex.EncodeToString([]byte(v)) + "'"
+		}
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	data, _ := json.Marshal(v)
+	return sqlValue(string(data))
+}
@@ -0,0 +1,300 @@
+package report
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func exportEvents() []*logger.Event {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.FixedZone("UTC+1", 3600))
+	first := attempt("[2001:db8::1]:4000", "root", "it's, \"quoted\"", at)
+	first.ID = "event-1"
+	first.Set("count", 3)
+	first.Set("new_attacker", true)
+	first.Set("sources", []interface{}{"192.0.2.1"})
+	second := attempt("192.0.2.1", "admin", "a\x00b", at)
+	return []*logger.Event{first, second}
+}
+
+func TestCSVExporter(t *testing.T) {
+	var buf strings.Builder
+	e, err := NewExporter(ExportCSV, &buf, []string{"time", "event_id", "source_ip", "source_port", "password", "count", "new_attacker", "sources", "country"})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	for _, event := range exportEvents() {
+		if err := e.Write(event); err != nil {
+			t.Fatalf("Failed to write event: %v", err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Failed to close exporter: %v", err)
+	}
+
+	expected := "time,event_id,source_ip,source_port,password,count,new_attacker,sources,country\n" +
+		`2024-01-01T11:00:00Z,event-1,2001:db8::1,4000,"it's, ""quoted""",3,true,"[""192.0.2.1""]",` + "\n" +
+		"2024-01-01T11:00:00Z,,192.0.2.1,,a\x00b,,,,\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected CSV:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestJSONExporter(t *testing.T) {
+	var buf strings.Builder
+	e, err := NewExporter(ExportJSON, &buf, nil)
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	e.Write(exportEvents()[0])
+	e.Close()
+
+	expected := `{"time":"2024-01-01T11:00:00Z","event":"auth_attempt","event_id":"event-1","remote_addr":"[2001:db8::1]:4000","username":"root","password":"it's, \"quoted\"","count":3,"new_attacker":true,"sources":["192.0.2.1"],"message":"authentication attempt"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected JSON:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestSQLExporter(t *testing.T) {
+	var buf strings.Builder
+	e, err := NewExporter(ExportSQL, &buf, []string{"event", "password", "count", "new_attacker", "sources"})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	for _, event := range exportEvents() {
+		e.Write(event)
+	}
+	e.Close()
+
+	expected := `CREATE TABLE IF NOT EXISTS "events" ("event", "password", "count", "new_attacker", "sources");
+BEGIN TRANSACTION;
+INSERT INTO "events" VALUES ('auth_attempt', 'it''s, "quoted"', 3, 1, '["192.0.2.1"]');
+INSERT INTO "events" VALUES ('auth_attempt', X'610062', NULL, NULL, NULL);
+COMMIT;
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected SQL:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	if _, err := NewExporter("xlsx", &buf, nil); err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+}
+
+func TestSQLiteExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	defer f.Close()
+	e, err := NewExporter(ExportSQLite, f, []string{"event", "password", "count", "new_attacker", "sources"})
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+
+	// Enough rows for interior pages, and passwords spilling into overflow pages
+	events := exportEvents()
+	for i := 0; i < 1000; i++ {
+		event := attempt("192.0.2.1", "root", strings.Repeat("x", i%10*1000), time.Now())
+		event.Set("count", i*100000)
+		events = append(events, event)
+	}
+	for _, event := range events {
+		if err := e.Write(event); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read database: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "SQLite format 3\x00") {
+		t.Fatalf("Missing database header")
+	}
+	if pages := binary.BigEndian.Uint32(data[28:]); int(pages)*sqlitePageSize != len(data) {
+		t.Errorf("Expected %d pages in the header, got %d", len(data)/sqlitePageSize, pages)
+	}
+
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	out, err := exec.Command("sqlite3", path, `PRAGMA integrity_check;
+SELECT event, quote(password), count, new_attacker, sources, typeof(count) FROM events WHERE rowid <= 2;
+SELECT count(*), sum(length(password)), max(count) FROM events;`).CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3 failed: %v: %s", err, out)
+	}
+	expected := `ok
+auth_attempt|'it''s, "quoted"'|3|1|["192.0.2.1"]|integer
+auth_attempt|X'610062'||||null
+1002|4500017|99900000
+`
+	if string(out) != expected {
+		t.Errorf("Unexpected query result:\n%s\nexpected:\n%s", out, expected)
+	}
+}
+
+func TestSQLiteExporterRequiresFile(t *testing.T) {
+	var buf strings.Builder
+	if _, err := NewExporter(ExportSQLite, &buf, nil); err == nil {
+		t.Errorf("Expected error for output that can not seek")
+	}
+}
+
+func TestParquetExporter(t *testing.T) {
+	// More than 14 columns need the long form of list headers
+	columns := []string{"event", "password", "count", "new_attacker", "sources"}
+	for i := len(columns); i < 16; i++ {
+		columns = append(columns, fmt.Sprintf("extra%d", i))
+	}
+	var buf bytes.Buffer
+	e, err := NewExporter(ExportParquet, &buf, columns)
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	events := exportEvents()
+	events[1].Set("password", "a\xffb")
+	for i := 0; i < parquetRowGroupRows; i++ {
+		events = append(events, attempt("192.0.2.1", "root", "x", time.Now()))
+	}
+	for _, event := range events {
+		if err := e.Write(event); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatalf("Missing Parquet magic")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	metadata := readThrift(t, bytes.NewReader(data[len(data)-8-size:len(data)-8]))
+	if rows := metadata[3]; rows != int64(len(events)) {
+		t.Errorf("Expected %d rows, got %v", len(events), rows)
+	}
+	schema := metadata[2].([]interface{})
+	if len(schema) != len(columns)+1 || string(schema[2].(map[int16]interface{})[4].([]byte)) != "password" {
+		t.Fatalf("Unexpected schema: %v", schema)
+	}
+
+	// The first row group holds as many rows as possible
+	groups := metadata[4].([]interface{})
+	if len(groups) != 2 || groups[0].(map[int16]interface{})[3] != int64(parquetRowGroupRows) {
+		t.Fatalf("Unexpected row groups: %v", groups)
+	}
+	chunk := groups[0].(map[int16]interface{})[1].([]interface{})[1].(map[int16]interface{})[3].(map[int16]interface{})
+	values := readParquetPage(t, data[chunk[9].(int64):])
+	if *values[0] != `it's, "quoted"` || *values[1] != "a\ufffdb" || *values[2] != "x" {
+		t.Errorf("Unexpected passwords: %q %q %q", *values[0], *values[1], *values[2])
+	}
+	chunk = groups[0].(map[int16]interface{})[1].([]interface{})[4].(map[int16]interface{})[3].(map[int16]interface{})
+	values = readParquetPage(t, data[chunk[9].(int64):])
+	if *values[0] != `["192.0.2.1"]` || values[1] != nil {
+		t.Errorf("Expected sources as JSON and missing ones as null, got %v %v", values[0], values[1])
+	}
+}
+
+// readParquetPage decodes the values of a data page with definition levels
+// in a single run each
+func readParquetPage(t *testing.T, data []byte) []*string {
+	r := bytes.NewReader(data)
+	header := readThrift(t, r)
+	compressed := make([]byte, header[3].(int64))
+	io.ReadFull(r, compressed)
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("Invalid page compression: %v", err)
+	}
+	page, _ := io.ReadAll(gz)
+	if int64(len(page)) != header[2].(int64) {
+		t.Fatalf("Expected %v bytes of page, got %d", header[2], len(page))
+	}
+
+	levels := bytes.NewReader(page[4 : 4+binary.LittleEndian.Uint32(page)])
+	page = page[4+binary.LittleEndian.Uint32(page):]
+	var values []*string
+	for levels.Len() > 0 {
+		run, _ := binary.ReadUvarint(levels)
+		defined, _ := levels.ReadByte()
+		for i := uint64(0); i < run>>1; i++ {
+			if defined == 0 {
+				values = append(values, nil)
+				continue
+			}
+			n := binary.LittleEndian.Uint32(page)
+			value := string(page[4 : 4+n])
+			page = page[4+n:]
+			values = append(values, &value)
+		}
+	}
+	return values
+}
+
+// readThrift decodes a struct of the Thrift compact protocol into its
+// fields by ID, with integers as int64 and lists as slices
+func readThrift(t *testing.T, r *bytes.Reader) map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			t.Fatalf("Truncated struct: %v", err)
+		}
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			v, _ := binary.ReadVarint(r)
+			id = int16(v)
+		}
+		fields[id] = readThriftValue(t, r, header&0x0f)
+		last = id
+	}
+}
+
+func readThriftValue(t *testing.T, r *bytes.Reader, kind byte) interface{} {
+	switch kind {
+	case thriftI32, thriftI64:
+		v, _ := binary.ReadVarint(r)
+		return v
+	case thriftBinary:
+		n, _ := binary.ReadUvarint(r)
+		v := make([]byte, n)
+		io.ReadFull(r, v)
+		return v
+	case thriftList:
+		header, _ := r.ReadByte()
+		n := uint64(header >> 4)
+		if n == 15 {
+			n, _ = binary.ReadUvarint(r)
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = readThriftValue(t, r, header&0x0f)
+		}
+		return list
+	case thriftStruct:
+		return readThrift(t, r)
+	}
+	t.Fatalf("Unexpected Thrift type %d", kind)
+	return nil
+}
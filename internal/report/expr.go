@@ -0,0 +1,434 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Expr is a filter expression over events, such as
+//
+//	username == "root" && country == "CN" && ts > "2024-01-01"
+//
+// Operands are columns (see Column, ts is an alias of time), double-quoted
+// or backquoted strings, numbers, true, false and null. Comparisons are ==,
+// !=, <, <=, >, >=, and =~ and !~ for regular expressions; they combine
+// with &&, || and ! and group with parentheses. A column on its own is true
+// if it is set to anything but false, 0 or "". The time column compares
+// against times as taken by ParseTime, so ts > "24h" selects the last day.
+type Expr struct {
+	root node
+	now  time.Time
+}
+
+// ParseExpr parses a filter expression, relative times are taken from now
+func ParseExpr(s string, now time.Time) (*Expr, error) {
+	p := &parser{now: now}
+	if err := p.lex(s); err != nil {
+		return nil, err
+	}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s at offset %d", p.tokens[p.pos].text, p.tokens[p.pos].offset)
+	}
+	return &Expr{root: root, now: now}, nil
+}
+
+// Match reports whether the event satisfies the expression
+func (e *Expr) Match(event *logger.Event) bool {
+	return truthy(e.root.eval(event))
+}
+
+type node interface {
+	eval(event *logger.Event) interface{}
+}
+
+type literal struct{ value interface{} }
+
+func (n literal) eval(*logger.Event) interface{} { return n.value }
+
+type column struct{ name string }
+
+func (n column) eval(event *logger.Event) interface{} {
+	if n.name == "time" {
+		return event.Time
+	}
+	return normalize(Column(event, n.name))
+}
+
+type not struct{ operand node }
+
+func (n not) eval(event *logger.Event) interface{} { return !truthy(n.operand.eval(event)) }
+
+type logical struct {
+	and         bool
+	left, right node
+}
+
+func (n logical) eval(event *logger.Event) interface{} {
+	if truthy(n.left.eval(event)) != n.and {
+		return !n.and
+	}
+	return truthy(n.right.eval(event))
+}
+
+type comparison struct {
+	op          string
+	left, right node
+	now         time.Time
+}
+
+func (n comparison) eval(event *logger.Event) interface{} {
+	return compare(n.op, n.left.eval(event), n.right.eval(event), n.now)
+}
+
+type match struct {
+	negate  bool
+	operand node
+	re      *regexp.Regexp
+}
+
+func (n match) eval(event *logger.Event) interface{} {
+	v := n.operand.eval(event)
+	if v == nil {
+		return n.negate
+	}
+	return n.re.MatchString(fmt.Sprint(v)) != n.negate
+}
+
+// normalize converts numbers to float64 for comparisons
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return v
+}
+
+// truthy reports whether a value counts as true on its own
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// compare applies a comparison operator, mismatched types are unequal
+func compare(op string, a, b interface{}, now time.Time) bool {
+	if a == nil || b == nil {
+		switch op {
+		case "==":
+			return a == nil && b == nil
+		case "!=":
+			return (a == nil) != (b == nil)
+		}
+		return false
+	}
+
+	var c int
+	switch {
+	case isTime(a) || isTime(b):
+		ta, oka := asTime(a, now)
+		tb, okb := asTime(b, now)
+		if !oka || !okb {
+			return op == "!="
+		}
+		c = ta.Compare(tb)
+	case isNumber(a) || isNumber(b):
+		fa, oka := asNumber(a)
+		fb, okb := asNumber(b)
+		if !oka || !okb {
+			return op == "!="
+		}
+		switch {
+		case fa < fb:
+			c = -1
+		case fa > fb:
+			c = 1
+		}
+	default:
+		sa, oka := a.(string)
+		sb, okb := b.(string)
+		if !oka || !okb {
+			equal := a == b
+			return (op == "==" && equal) || (op == "!=" && !equal)
+		}
+		c = strings.Compare(sa, sb)
+	}
+
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+func isTime(v interface{}) bool {
+	_, ok := v.(time.Time)
+	return ok
+}
+
+func asTime(v interface{}, now time.Time) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := ParseTime(v, now)
+		return t, err == nil
+	case float64:
+		return time.Unix(int64(v), 0), true
+	}
+	return time.Time{}, false
+}
+
+func isNumber(v interface{}) bool {
+	_, ok := v.(float64)
+	return ok
+}
+
+func asNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// token is a lexical element of an expression
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+// Operators, longest first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"}
+
+type parser struct {
+	tokens []token
+	pos    int
+	now    time.Time
+}
+
+// lex splits an expression into tokens
+func (p *parser) lex(s string) error {
+	for i := 0; i < len(s); {
+		r := rune(s[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '`':
+			end := i + 1
+			for end < len(s) && s[end] != s[i] {
+				if s[i] == '"' && s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return fmt.Errorf("unterminated string at offset %d", i)
+			}
+			text, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return fmt.Errorf("invalid string at offset %d: %w", i, err)
+			}
+			p.tokens = append(p.tokens, token{tokenString, text, i})
+			i = end + 1
+		case r == '_' || unicode.IsLetter(r):
+			end := i
+			for end < len(s) && (s[end] == '_' || s[end] == '.' || unicode.IsLetter(rune(s[end])) || unicode.IsDigit(rune(s[end]))) {
+				end++
+			}
+			p.tokens = append(p.tokens, token{tokenIdent, s[i:end], i})
+			i = end
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(s) && unicode.IsDigit(rune(s[i+1]))):
+			end := i + 1
+			for end < len(s) && (unicode.IsDigit(rune(s[end])) || s[end] == '.') {
+				end++
+			}
+			p.tokens = append(p.tokens, token{tokenNumber, s[i:end], i})
+			i = end
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, token{tokenOperator, op, i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("unexpected character %q at offset %d", r, i)
+			}
+		}
+	}
+	return nil
+}
+
+// accept consumes the next token if it is the given operator
+func (p *parser) accept(op string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenOperator && p.tokens[p.pos].text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	for err == nil && p.accept("||") {
+		var right node
+		if right, err = p.and(); err == nil {
+			left = logical{and: false, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	for err == nil && p.accept("&&") {
+		var right node
+		if right, err = p.unary(); err == nil {
+			left = logical{and: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) unary() (node, error) {
+	if p.accept("!") {
+		operand, err := p.unary()
+		return not{operand}, err
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.operand()
+	if err != nil || p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenOperator {
+		return left, err
+	}
+
+	op := p.tokens[p.pos].text
+	switch op {
+	case "=~", "!~":
+		p.pos++
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenString {
+			return nil, fmt.Errorf("%s requires a string with a regular expression", op)
+		}
+		re, err := regexp.Compile(p.tokens[p.pos].text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		p.pos++
+		return match{negate: op == "!~", operand: left, re: re}, nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.pos++
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return comparison{op: op, left: left, right: right, now: p.now}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) operand() (node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+
+	switch t.kind {
+	case tokenString:
+		return literal{t.text}, nil
+	case tokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s at offset %d", t.text, t.offset)
+		}
+		return literal{f}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		case "ts":
+			return column{"time"}, nil
+		}
+		return column{t.text}, nil
+	}
+
+	if t.text == "(" {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing ) for ( at offset %d", t.offset)
+		}
+		return inner, nil
+	}
+	return nil, fmt.Errorf("unexpected %s at offset %d", t.text, t.offset)
+}
@@ -0,0 +1,74 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestExprMatch(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	event := attempt("192.0.2.1:4000", "root", "123456", time.Date(2024, 1, 9, 12, 0, 0, 0, time.UTC))
+	event.Set("country", "CN")
+	event.Set("count", 3)
+	event.Set("new_attacker", true)
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`username == "root" && country == "CN" && ts > "2024-01-01"`, true},
+		{`username == "root" && country == "US"`, false},
+		{`country == "US" || username == "root"`, true},
+		{`!(username == "admin")`, true},
+		{`ts > "24h"`, true},
+		{`ts >= "2024-01-09T12:00:01Z"`, false},
+		{`count >= 3 && count < 3.5`, true},
+		{`password == 123456`, true},
+		{`source_port > 1024 && source_ip == "192.0.2.1"`, true},
+		{`username =~ "^ro+t$"`, true},
+		{"password !~ `^\\d+$`", false},
+		{`new_attacker`, true},
+		{`new_attacker == false`, false},
+		{`asn == null && country != null`, true},
+		{`asn > 100`, false},
+		{`missing`, false},
+		{`username < "s" && username > "r"`, true},
+		{`event == "auth_attempt"`, true},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.expr, now)
+		if err != nil {
+			t.Errorf("ParseExpr(%s): unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got := e.Match(event); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.expr, tt.expected, got)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`username ==`,
+		`(username == "root"`,
+		`username == "root" country`,
+		`username == "root`,
+		`username =~ "("`,
+		`username =~ root`,
+		`username # 1`,
+	} {
+		if _, err := ParseExpr(expr, time.Now()); err == nil {
+			t.Errorf("ParseExpr(%s): expected error", expr)
+		}
+	}
+}
+
+func TestExprHeartbeat(t *testing.T) {
+	e, _ := ParseExpr(`event != "auth_attempt" || username == "root"`, time.Now())
+	if !e.Match(&logger.Event{Type: "heartbeat"}) {
+		t.Errorf("Expected heartbeat to match")
+	}
+}
@@ -0,0 +1,66 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestFilterMatch(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := Filter{Since: start, Until: start.Add(24 * time.Hour)}
+
+	tests := []struct {
+		at       time.Time
+		expected bool
+	}{
+		{start.Add(-time.Second), false},
+		{start, true},
+		{start.Add(12 * time.Hour), true},
+		{start.Add(24 * time.Hour), false},
+	}
+	for _, tt := range tests {
+		if got := f.Match(&logger.Event{Time: tt.at}); got != tt.expected {
+			t.Errorf("Match(%v): expected %v, got %v", tt.at, tt.expected, got)
+		}
+	}
+	if !(Filter{}).Match(&logger.Event{Time: start}) {
+		t.Errorf("Expected empty filter to match")
+	}
+
+	types := Filter{Types: []string{"auth_attempt", "ioc"}}
+	if !types.Match(&logger.Event{Type: "ioc"}) || types.Match(&logger.Event{Type: "heartbeat"}) {
+		t.Errorf("Expected events to be selected by type")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"2024-01-01T06:00:00Z", time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC)},
+		{"2024-01-01", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"90m", now.Add(-90 * time.Minute)},
+		{"7d", now.Add(-7 * 24 * time.Hour)},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.input, now)
+		if err != nil {
+			t.Errorf("ParseTime(%q): unexpected error: %v", tt.input, err)
+			continue
+		}
+		if !got.Equal(tt.expected) {
+			t.Errorf("ParseTime(%q): expected %v, got %v", tt.input, tt.expected, got)
+		}
+	}
+
+	for _, input := range []string{"yesterday", "7x", "d"} {
+		if _, err := ParseTime(input, now); err == nil {
+			t.Errorf("ParseTime(%q): expected error", input)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Limit of distinct sources counted per location
+const maxLocationSources = 100000
+
+// GeoMap counts attempts by the coordinates of their source for plotting
+// attack origins on a map
+type GeoMap struct {
+	scale     float64
+	locations map[[2]float64]*location
+	skipped   int
+}
+
+// location counts the attempts from one point
+type location struct {
+	latitude    float64
+	longitude   float64
+	attempts    int
+	sources     map[string]bool
+	country     string
+	countryName string
+	city        string
+}
+
+// NewGeoMap creates an empty map. Coordinates are rounded to the given
+// number of decimals, so that nearby locations are counted together.
+func NewGeoMap(precision int) *GeoMap {
+	return &GeoMap{
+		scale:     math.Pow(10, float64(precision)),
+		locations: make(map[[2]float64]*location),
+	}
+}
+
+// Add counts an authentication attempt with coordinates, other events are
+// ignored
+func (m *GeoMap) Add(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	latitude, ok := coordinate(event, "latitude")
+	if !ok {
+		m.skipped += attemptCount(event)
+		return
+	}
+	longitude, ok := coordinate(event, "longitude")
+	if !ok {
+		m.skipped += attemptCount(event)
+		return
+	}
+
+	key := [2]float64{math.Round(latitude*m.scale) / m.scale, math.Round(longitude*m.scale) / m.scale}
+	l := m.locations[key]
+	if l == nil {
+		l = &location{
+			latitude:    key[0],
+			longitude:   key[1],
+			sources:     make(map[string]bool),
+			country:     event.GetString("country"),
+			countryName: event.GetString("country_name"),
+			city:        event.GetString("city"),
+		}
+		m.locations[key] = l
+	}
+	l.attempts += attemptCount(event)
+	if len(l.sources) < maxLocationSources {
+		l.sources[sourceIP(event)] = true
+	}
+}
+
+// Skipped returns the number of attempts without coordinates
+func (m *GeoMap) Skipped() int {
+	return m.skipped
+}
+
+// sorted returns the locations with the most attempts first
+func (m *GeoMap) sorted() []*location {
+	locations := make([]*location, 0, len(m.locations))
+	for _, l := range m.locations {
+		locations = append(locations, l)
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		a, b := locations[i], locations[j]
+		if a.attempts != b.attempts {
+			return a.attempts > b.attempts
+		}
+		if a.latitude != b.latitude {
+			return a.latitude < b.latitude
+		}
+		return a.longitude < b.longitude
+	})
+	return locations
+}
+
+// geoJSONFeature is a point of a GeoJSON feature collection (RFC 7946)
+type geoJSONFeature struct {
+	Type     string `json:"type"`
+	Geometry struct {
+		Type        string     `json:"type"`
+		Coordinates [2]float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties geoJSONProperties `json:"properties"`
+}
+
+type geoJSONProperties struct {
+	Attempts    int    `json:"attempts"`
+	Sources     int    `json:"sources"`
+	Country     string `json:"country,omitempty"`
+	CountryName string `json:"country_name,omitempty"`
+	City        string `json:"city,omitempty"`
+}
+
+// WriteGeoJSON writes the locations as a GeoJSON feature collection of
+// points with their attempts and sources as properties
+func (m *GeoMap) WriteGeoJSON(w io.Writer) error {
+	collection := struct {
+		Type     string           `json:"type"`
+		Features []geoJSONFeature `json:"features"`
+	}{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+
+	for _, l := range m.sorted() {
+		feature := geoJSONFeature{Type: "Feature"}
+		feature.Geometry.Type = "Point"
+		// GeoJSON positions are longitude first
+		feature.Geometry.Coordinates = [2]float64{l.longitude, l.latitude}
+		feature.Properties = geoJSONProperties{
+			Attempts:    l.attempts,
+			Sources:     len(l.sources),
+			Country:     l.country,
+			CountryName: l.countryName,
+			City:        l.city,
+		}
+		collection.Features = append(collection.Features, feature)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(collection)
+}
+
+// WriteCSV writes the locations as heat map points, the weight being the
+// number of attempts
+func (m *GeoMap) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"latitude", "longitude", "weight", "sources", "country", "city"})
+	for _, l := range m.sorted() {
+		cw.Write([]string{
+			strconv.FormatFloat(l.latitude, 'f', -1, 64),
+			strconv.FormatFloat(l.longitude, 'f', -1, 64),
+			strconv.Itoa(l.attempts),
+			strconv.Itoa(len(l.sources)),
+			l.country,
+			l.city,
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
+
+// coordinate returns a numeric field of the event
+func coordinate(event *logger.Event, key string) (float64, bool) {
+	v, ok := event.Get(key)
+	if !ok {
+		return 0, false
+	}
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
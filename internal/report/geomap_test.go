@@ -0,0 +1,71 @@
+package report
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestGeoMap(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	located := func(addr string, latitude, longitude interface{}) *logger.Event {
+		event := attempt(addr, "root", "123456", at)
+		event.Set("latitude", latitude)
+		event.Set("longitude", longitude)
+		event.Set("country", "CN")
+		event.Set("city", "Beijing")
+		return event
+	}
+
+	m := NewGeoMap(1)
+	m.Add(located("192.0.2.1:4000", 39.9042, 116.4074))
+	aggregated := located("192.0.2.2:4000", 39.91, 116.41)
+	aggregated.Set("count", 3)
+	m.Add(aggregated)
+	m.Add(located("198.51.100.1:22", 52, 4))
+	m.Add(attempt("203.0.113.1:22", "admin", "admin", at))
+	m.Add(&logger.Event{Type: "heartbeat", Time: at})
+
+	if m.Skipped() != 1 {
+		t.Errorf("Expected 1 skipped attempt, got %d", m.Skipped())
+	}
+
+	var geo strings.Builder
+	if err := m.WriteGeoJSON(&geo); err != nil {
+		t.Fatalf("WriteGeoJSON failed: %v", err)
+	}
+	var collection struct {
+		Type     string
+		Features []struct {
+			Geometry struct {
+				Coordinates []float64
+			}
+			Properties map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal([]byte(geo.String()), &collection); err != nil {
+		t.Fatalf("Invalid GeoJSON: %v", err)
+	}
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 2 {
+		t.Fatalf("Unexpected collection: %s", geo.String())
+	}
+	beijing := collection.Features[0]
+	if c := beijing.Geometry.Coordinates; c[0] != 116.4 || c[1] != 39.9 {
+		t.Errorf("Expected rounded longitude first, got %v", c)
+	}
+	if p := beijing.Properties; p["attempts"] != 4.0 || p["sources"] != 2.0 || p["city"] != "Beijing" {
+		t.Errorf("Unexpected properties: %v", p)
+	}
+
+	var csv strings.Builder
+	if err := m.WriteCSV(&csv); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	expected := "latitude,longitude,weight,sources,country,city\n39.9,116.4,4,2,CN,Beijing\n52,4,1,1,CN,Beijing\n"
+	if csv.String() != expected {
+		t.Errorf("Expected CSV:\n%s\ngot:\n%s", expected, csv.String())
+	}
+}
@@ -0,0 +1,278 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+//go:embed templates/report.html
+var templates embed.FS
+
+var htmlTemplate = template.Must(template.New("report.html").Funcs(template.FuncMap{
+	"printable": printable,
+	"percent": func(n, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(total)
+	},
+	"utc": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	},
+}).ParseFS(templates, "templates/report.html"))
+
+// Limit of distinct usernames remembered per session
+const maxSessionUsernames = 1000
+
+// HTMLConfig contains settings of an HTML report
+type HTMLConfig struct {
+	// Title of the report
+	Title string
+	// Entries of each top list
+	Top int
+	// Period covered by the report, taken from the attempts if zero
+	Since time.Time
+	Until time.Time
+}
+
+// HTMLReport collects attempts for a self-contained HTML report with
+// charts of attempts over time, a geographic breakdown, top credentials
+// and the sessions with the most attempts
+type HTMLReport struct {
+	config    HTMLConfig
+	summary   *Summarizer
+	hours     map[time.Time]int
+	pairs     map[string]int
+	asns      map[string]int
+	countries map[string]string
+	sessions  map[string]*session
+}
+
+// session summarizes the attempts of a connection
+type session struct {
+	Addr          string
+	First         time.Time
+	Last          time.Time
+	Attempts      int
+	usernames     map[string]bool
+	ClientVersion string
+	Country       string
+}
+
+// Usernames returns the number of distinct usernames of the session
+func (s *session) Usernames() int {
+	return len(s.usernames)
+}
+
+// Duration returns the time between the first and the last attempt
+func (s *session) Duration() time.Duration {
+	return s.Last.Sub(s.First).Round(time.Second)
+}
+
+// NewHTMLReport creates an empty report
+func NewHTMLReport(config HTMLConfig) *HTMLReport {
+	return &HTMLReport{
+		config:    config,
+		summary:   NewSummarizer(config.Top),
+		hours:     make(map[time.Time]int),
+		pairs:     make(map[string]int),
+		asns:      make(map[string]int),
+		countries: make(map[string]string),
+		sessions:  make(map[string]*session),
+	}
+}
+
+// Add counts an authentication attempt, other events are ignored
+func (r *HTMLReport) Add(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	r.summary.Add(event)
+	n := attemptCount(event)
+	r.hours[event.Time.UTC().Truncate(time.Hour)] += n
+	r.pairs[printable(event.GetString("username"))+" / "+printable(event.GetString("password"))] += n
+
+	country := event.GetString("country")
+	if name := event.GetString("country_name"); country != "" && name != "" {
+		r.countries[country] = name
+	}
+	if asn, ok := event.Get("asn"); ok {
+		label := fmt.Sprintf("AS%v", asn)
+		if org := event.GetString("as_org"); org != "" {
+			label += " " + org
+		}
+		r.asns[label] += n
+	}
+
+	// Attempts of a connection share the source address and port
+	addr := event.GetString("remote_addr")
+	s, ok := r.sessions[addr]
+	if !ok {
+		s = &session{Addr: addr, First: event.Time, usernames: make(map[string]bool)}
+		r.sessions[addr] = s
+	}
+	s.Attempts += n
+	if event.Time.Before(s.First) {
+		s.First = event.Time
+	}
+	if event.Time.After(s.Last) {
+		s.Last = event.Time
+	}
+	if len(s.usernames) < maxSessionUsernames {
+		s.usernames[event.GetString("username")] = true
+	}
+	if v := event.GetString("client_version"); v != "" {
+		s.ClientVersion = v
+	}
+	if country != "" {
+		s.Country = country
+	}
+}
+
+// chart is a bar chart of attempts over time, laid out for SVG
+type chart struct {
+	Width, Height int
+	Bars          []bar
+	Labels        []chartLabel
+	Peak          int
+	Unit          string
+}
+
+type bar struct {
+	X, Y, W, H float64
+	Title      string
+}
+
+type chartLabel struct {
+	X    float64
+	Text string
+}
+
+// Chart dimensions in SVG units
+const (
+	chartWidth  = 900
+	chartHeight = 220
+)
+
+// chart buckets the attempts by hour for short periods and by day otherwise
+func (r *HTMLReport) chart(since, until time.Time) chart {
+	c := chart{Width: chartWidth, Height: chartHeight}
+	if len(r.hours) == 0 {
+		return c
+	}
+
+	step, layout := 24*time.Hour, "2006-01-02"
+	c.Unit = "day"
+	if until.Sub(since) <= 3*24*time.Hour {
+		step, layout = time.Hour, "01-02 15:00"
+		c.Unit = "hour"
+	}
+	start := since.UTC().Truncate(step)
+	buckets := int(until.UTC().Sub(start)/step) + 1
+	counts := make([]int, buckets)
+	for hour, n := range r.hours {
+		if i := int(hour.Sub(start) / step); i >= 0 && i < buckets {
+			counts[i] += n
+		}
+	}
+	c.Peak = peak(counts)
+
+	width := float64(chartWidth) / float64(buckets)
+	for i, n := range counts {
+		h := 0.0
+		if c.Peak > 0 {
+			h = float64(n) * (chartHeight - 20) / float64(c.Peak)
+		}
+		at := start.Add(time.Duration(i) * step)
+		c.Bars = append(c.Bars, bar{
+			X:     float64(i) * width,
+			Y:     chartHeight - 20 - h,
+			W:     width * 0.9,
+			H:     h,
+			Title: fmt.Sprintf("%s: %d", at.Format(layout), n),
+		})
+	}
+	for _, i := range []int{0, buckets / 2, buckets - 1} {
+		c.Labels = append(c.Labels, chartLabel{X: float64(i) * width, Text: start.Add(time.Duration(i) * step).Format(layout)})
+	}
+	if buckets < 3 {
+		c.Labels = c.Labels[:1]
+	}
+	return c
+}
+
+// countryCount is the number of attempts from a country
+type countryCount struct {
+	Value string
+	Name  string
+	Count int
+}
+
+// Write renders the report as a self-contained HTML document
+func (r *HTMLReport) Write(w io.Writer, generated time.Time) error {
+	summary := r.summary.Summary()
+	since, until := r.config.Since, r.config.Until
+	if since.IsZero() && summary.First != nil {
+		since = *summary.First
+	}
+	if until.IsZero() && summary.Last != nil {
+		until = *summary.Last
+	}
+
+	var countries []countryCount
+	for _, c := range summary.TopCountries {
+		countries = append(countries, countryCount{Value: c.Value, Name: r.countries[c.Value], Count: c.Count})
+	}
+
+	sessions := make([]*session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Attempts != sessions[j].Attempts {
+			return sessions[i].Attempts > sessions[j].Attempts
+		}
+		return sessions[i].Addr < sessions[j].Addr
+	})
+	if len(sessions) > r.config.Top {
+		sessions = sessions[:r.config.Top]
+	}
+
+	return htmlTemplate.Execute(w, map[string]interface{}{
+		"Title":       r.config.Title,
+		"Generated":   generated,
+		"Since":       since,
+		"Until":       until,
+		"Summary":     summary,
+		"Sessions":    len(r.sessions),
+		"Chart":       r.chart(since, until),
+		"Countries":   countries,
+		"ASNs":        top(r.asns, r.config.Top),
+		"Credentials": top(r.pairs, r.config.Top),
+		"Notable":     sessions,
+	})
+}
@@ -0,0 +1,69 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTMLReport(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	r := NewHTMLReport(HTMLConfig{Title: "Weekly report", Top: 5})
+
+	first := attempt("192.0.2.1:4000", "root", "123456", start)
+	first.Set("country", "CN")
+	first.Set("country_name", "China")
+	first.Set("asn", 4134)
+	first.Set("as_org", "CHINANET")
+	r.Add(first)
+	r.Add(attempt("192.0.2.1:4000", "admin", "admin", start.Add(90*time.Second)))
+	r.Add(attempt("192.0.2.2:5000", "<script>", "x", start.Add(5*time.Hour)))
+
+	var buf strings.Builder
+	if err := r.Write(&buf, start.Add(24*time.Hour)); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<title>Weekly report</title>",
+		"2024-01-01 10:00:00 &ndash; 2024-01-01 15:00:00 UTC",
+		"<b>3</b>attempts",
+		"Attempts per hour",
+		"<title>01-01 10:00: 2</title>",
+		"CN China",
+		"width: 33.3",
+		"AS4134 CHINANET",
+		"root / 123456",
+		"<td class=\"v\">192.0.2.1:4000</td><td>2024-01-01 10:00:00</td><td>1m30s</td><td class=\"n\">2</td><td class=\"n\">2</td>",
+		"&lt;script&gt;",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in report:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "<script>") {
+		t.Errorf("Expected values to be escaped")
+	}
+}
+
+func TestHTMLReportChartByDay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	r := NewHTMLReport(HTMLConfig{Title: "Report", Top: 5, Since: start, Until: start.Add(7 * 24 * time.Hour)})
+	r.Add(attempt("192.0.2.1:4000", "root", "root", start.Add(49*time.Hour)))
+
+	c := r.chart(r.config.Since, r.config.Until)
+	if c.Unit != "day" || len(c.Bars) != 8 || c.Peak != 1 {
+		t.Fatalf("Unexpected chart: %s, %d bars, peak %d", c.Unit, len(c.Bars), c.Peak)
+	}
+	if c.Bars[2].Title != "2024-01-03: 1" || c.Bars[1].H != 0 {
+		t.Errorf("Unexpected bars: %+v", c.Bars[:3])
+	}
+
+	var buf strings.Builder
+	if err := NewHTMLReport(HTMLConfig{Title: "Empty", Top: 5}).Write(&buf, start); err != nil {
+		t.Fatalf("Failed to write empty report: %v", err)
+	}
+	if !strings.Contains(buf.String(), "No attempts") {
+		t.Errorf("Expected empty report to say so")
+	}
+}
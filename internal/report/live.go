@@ -0,0 +1,268 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Number of recent attempts kept for display
+const maxRecent = 100
+
+// Levels of sparklines, from no to the most attempts
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// LiveConfig contains settings of the live view
+type LiveConfig struct {
+	// Period of the top lists
+	Window time.Duration
+	// Entries of each top list
+	Top int
+}
+
+// Live keeps a rolling view of incoming attempts: totals, rates of the last
+// minute and hour, top sources and credentials, and the latest attempts
+type Live struct {
+	config LiveConfig
+
+	mu          sync.Mutex
+	total       int
+	sources     *rollingCounter
+	credentials *rollingCounter
+	seconds     [60]rateBucket
+	minutes     [60]rateBucket
+	recent      []*logger.Event
+}
+
+// rateBucket counts the attempts of a second or minute
+type rateBucket struct {
+	at int64
+	n  int
+}
+
+// NewLive creates an empty live view
+func NewLive(config LiveConfig) *Live {
+	return &Live{
+		config:      config,
+		sources:     newRollingCounter(config.Window),
+		credentials: newRollingCounter(config.Window),
+	}
+}
+
+// Add counts an authentication attempt arriving at now, other events are ignored
+func (l *Live) Add(event *logger.Event, now time.Time) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	n := attemptCount(event)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total += n
+	l.sources.add(sourceIP(event), n, now)
+	l.credentials.add(printable(event.GetString("username"))+" / "+printable(event.GetString("password")), n, now)
+	addRate(&l.seconds, now.Unix(), n)
+	addRate(&l.minutes, now.Unix()/60, n)
+
+	l.recent = append(l.recent, event)
+	if len(l.recent) > maxRecent {
+		l.recent = l.recent[len(l.recent)-maxRecent:]
+	}
+}
+
+// addRate counts attempts in the bucket of a second or minute
+func addRate(buckets *[60]rateBucket, at int64, n int) {
+	b := &buckets[at%60]
+	if b.at != at {
+		*b = rateBucket{at: at}
+	}
+	b.n += n
+}
+
+// rates returns the counts of the 60 buckets up to now, oldest first
+func rates(buckets *[60]rateBucket, now int64) []int {
+	counts := make([]int, 60)
+	for i := range counts {
+		at := now - 59 + int64(i)
+		if b := buckets[at%60]; b.at == at {
+			counts[i] = b.n
+		}
+	}
+	return counts
+}
+
+// Render writes a frame of the view fitting width columns and height lines
+func (l *Live) Render(w io.Writer, title string, now time.Time, width, height int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var lines []string
+	seconds := rates(&l.seconds, now.Unix())
+	minutes := rates(&l.minutes, now.Unix()/60)
+	lastMinute := sum(seconds)
+
+	lines = append(lines,
+		fmt.Sprintf("%s  %s", title, now.UTC().Format(time.RFC3339)),
+		fmt.Sprintf("Attempts  %d total, %d in the last minute (%.1f/s)", l.total, lastMinute, float64(lastMinute)/60),
+		"Last 60s  "+sparkline(seconds, width-10)+fmt.Sprintf("  max %d/s", peak(seconds)),
+		"Last 60m  "+sparkline(minutes, width-10)+fmt.Sprintf("  max %d/min", peak(minutes)),
+		"",
+	)
+
+	column := width / 2
+	sources := l.sources.top(l.config.Top, now)
+	credentials := l.credentials.top(l.config.Top, now)
+	window := l.config.Window.String()
+	lines = append(lines, pad("TOP SOURCES (last "+window+")", column)+"TOP CREDENTIALS (last "+window+")")
+	for i := 0; i < l.config.Top && (i < len(sources) || i < len(credentials)); i++ {
+		var left, right string
+		if i < len(sources) {
+			left = fmt.Sprintf("%7d  %s", sources[i].Count, sources[i].Value)
+		}
+		if i < len(credentials) {
+			right = fmt.Sprintf("%7d  %s", credentials[i].Count, credentials[i].Value)
+		}
+		lines = append(lines, pad(left, column)+right)
+	}
+
+	lines = append(lines, "", "RECENT ATTEMPTS")
+	rows := height - len(lines)
+	for i := len(l.recent) - 1; i >= 0 && rows > 0; i, rows = i-1, rows-1 {
+		e := l.recent[i]
+		lines = append(lines, fmt.Sprintf("%s  %-39s  %-16s  %-16s  %s",
+			e.Time.UTC().Format(time.TimeOnly), sourceIP(e),
+			printable(e.GetString("username")), printable(e.GetString("password")), e.GetString("country")))
+	}
+
+	for i, line := range lines {
+		if i >= height {
+			break
+		}
+		if _, err := io.WriteString(w, cut(line, width)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sparkline draws the last n counts scaled to the highest one
+func sparkline(counts []int, n int) string {
+	if n < len(counts) {
+		counts = counts[len(counts)-max(0, n):]
+	}
+	highest := peak(counts)
+	var b strings.Builder
+	for _, c := range counts {
+		level := 0
+		if highest > 0 {
+			level = c * (len(sparks) - 1) / highest
+		}
+		b.WriteRune(sparks[level])
+	}
+	return b.String()
+}
+
+func sum(counts []int) int {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	return total
+}
+
+func peak(counts []int) int {
+	highest := 0
+	for _, c := range counts {
+		if c > highest {
+			highest = c
+		}
+	}
+	return highest
+}
+
+// pad fills a string with spaces to width runes, cutting longer ones
+func pad(s string, width int) string {
+	s = cut(s, width-1)
+	return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+}
+
+// cut shortens a string to at most width runes
+func cut(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+// rollingCounter counts values in one-minute buckets over a window
+type rollingCounter struct {
+	window  time.Duration
+	buckets []bucket
+}
+
+type bucket struct {
+	start  time.Time
+	counts map[string]int
+}
+
+func newRollingCounter(window time.Duration) *rollingCounter {
+	return &rollingCounter{window: window}
+}
+
+// add counts n occurrences of a value at now
+func (c *rollingCounter) add(value string, n int, now time.Time) {
+	start := now.Truncate(time.Minute)
+	if len(c.buckets) == 0 || c.buckets[len(c.buckets)-1].start.Before(start) {
+		c.buckets = append(c.buckets, bucket{start: start, counts: make(map[string]int)})
+	}
+	c.buckets[len(c.buckets)-1].counts[value] += n
+	c.expire(now)
+}
+
+// expire drops the buckets that left the window
+func (c *rollingCounter) expire(now time.Time) {
+	cutoff := now.Add(-c.window)
+	i := 0
+	for i < len(c.buckets) && !c.buckets[i].start.Add(time.Minute).After(cutoff) {
+		i++
+	}
+	c.buckets = c.buckets[i:]
+}
+
+// top returns the n most frequent values of the window
+func (c *rollingCounter) top(n int, now time.Time) []Count {
+	c.expire(now)
+	totals := make(map[string]int)
+	for _, b := range c.buckets {
+		for v, count := range b.counts {
+			totals[v] += count
+		}
+	}
+	return top(totals, n)
+}
@@ -0,0 +1,65 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLiveRender(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	live := NewLive(LiveConfig{Window: 5 * time.Minute, Top: 3})
+
+	live.Add(attempt("192.0.2.1:4000", "root", "123456", now.Add(-10*time.Minute)), now.Add(-10*time.Minute))
+	for i := 0; i < 4; i++ {
+		live.Add(attempt("192.0.2.2:4000", "admin", "admin", now), now.Add(-time.Duration(i)*time.Second))
+	}
+	live.Add(attempt("192.0.2.3:4000", "root", "pass word", now), now)
+
+	var buf strings.Builder
+	if err := live.Render(&buf, "fakessh top", now, 100, 30); err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"Attempts  6 total, 5 in the last minute",
+		"max 2/s",
+		"TOP SOURCES (last 5m0s)",
+		"      4  192.0.2.2",
+		`      1  root / "pass word"`,
+		"192.0.2.3",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+	// The attempt before the window is left out of the top lists
+	if strings.Contains(out, "      1  192.0.2.1") {
+		t.Errorf("Expected expired source to be left out:\n%s", out)
+	}
+
+	// The frame fits the terminal
+	buf.Reset()
+	live.Render(&buf, "fakessh top", now, 40, 8)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 8 {
+		t.Errorf("Expected 8 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if n := len([]rune(line)); n > 40 {
+			t.Errorf("Line of %d runes exceeds width: %q", n, line)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if got := sparkline([]int{0, 1, 2, 4, 8}, 10); got != "▁▁▂▄█" {
+		t.Errorf("Unexpected sparkline: %s", got)
+	}
+	if got := sparkline([]int{0, 1, 2, 4, 8}, 2); got != "▄█" {
+		t.Errorf("Expected the latest counts, got %s", got)
+	}
+	if got := sparkline([]int{0, 0}, 10); got != "▁▁" {
+		t.Errorf("Unexpected sparkline without attempts: %s", got)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// SensorField is the field naming the sensor an event came from, as set by
+// the sensor_id tag
+const SensorField = "sensor_id"
+
+// Merger combines the events of several sensors into one stream ordered by
+// time. Events logged more than once, e.g. by overlapping copies of a log,
+// are kept once.
+type Merger struct {
+	events     []*logger.Event
+	seen       map[string]bool
+	duplicates int
+}
+
+// NewMerger creates an empty merger
+func NewMerger() *Merger {
+	return &Merger{seen: make(map[string]bool)}
+}
+
+// Log returns a function adding the events of a log of a sensor. Events
+// are converted to the current schema, and get the sensor field unless they
+// already name their sensor.
+func (m *Merger) Log(sensor string) func(*logger.Event) {
+	// Events without ID are told apart by their position among equal
+	// events of the log, so that only copies in other logs are dropped
+	occurrences := make(map[string]int)
+	return func(event *logger.Event) {
+		upgrade(event)
+		key := event.ID
+		if key == "" {
+			key = contentKey(event)
+			occurrences[key]++
+			key = fmt.Sprintf("%s#%d", key, occurrences[key])
+		}
+		if m.seen[key] {
+			m.duplicates++
+			return
+		}
+		m.seen[key] = true
+
+		if sensor != "" && event.GetString(SensorField) == "" {
+			event.Set(SensorField, sensor)
+		}
+		m.events = append(m.events, event)
+	}
+}
+
+// Events returns the merged events ordered by time; events of the same
+// time keep the order they were added in
+func (m *Merger) Events() []*logger.Event {
+	sort.SliceStable(m.events, func(i, j int) bool {
+		return m.events[i].Time.Before(m.events[j].Time)
+	})
+	return m.events
+}
+
+// Duplicates returns the number of events dropped as duplicates
+func (m *Merger) Duplicates() int {
+	return m.duplicates
+}
+
+// upgrade converts events of older versions: attempts were logged without
+// an event type before other events existed
+func upgrade(event *logger.Event) {
+	if event.Type == "" && event.Message == "authentication attempt" {
+		event.Type = "auth_attempt"
+	}
+}
+
+// contentKey identifies events of older versions that were logged without
+// an ID by their content
+func contentKey(event *logger.Event) string {
+	h := sha256.New()
+	h.Write([]byte(event.Time.UTC().String() + "\x00" + event.Type + "\x00"))
+	for _, f := range event.Fields {
+		if f.Key == SensorField {
+			continue
+		}
+		value, _ := json.Marshal(f.Value)
+		h.Write([]byte(f.Key + "\x00"))
+		h.Write(value)
+		h.Write([]byte{0})
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,60 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestMerger(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMerger()
+
+	late := attempt("192.0.2.1:4000", "late", "x", start.Add(time.Minute))
+	late.ID = "event-2"
+	first := m.Log("sensor-01")
+	first(late)
+
+	early := attempt("192.0.2.2:4000", "early", "x", start)
+	early.ID = "event-1"
+	early.Set(SensorField, "sensor-03")
+	second := m.Log("sensor-02")
+	second(early)
+
+	// The same event from an overlapping copy of the log
+	copied := attempt("192.0.2.1:4000", "late", "x", start.Add(time.Minute))
+	copied.ID = "event-2"
+	m.Log("sensor-01")(copied)
+
+	// Records of older versions without event type and ID are only
+	// duplicates in another log
+	old := &logger.Event{Time: start.Add(time.Minute), Message: "authentication attempt", Fields: []logger.Field{{Key: "username", Value: "old"}}}
+	second(old)
+	second(old.Clone())
+	third := m.Log("sensor-02")
+	third(old.Clone())
+	third(old.Clone())
+	third(old.Clone())
+
+	events := m.Events()
+	if len(events) != 5 || m.Duplicates() != 3 {
+		t.Fatalf("Expected 5 events and 3 duplicates, got %d and %d", len(events), m.Duplicates())
+	}
+	expected := []struct{ username, sensor string }{
+		{"early", "sensor-03"},
+		{"late", "sensor-01"},
+		{"old", "sensor-02"},
+		{"old", "sensor-02"},
+		{"old", "sensor-02"},
+	}
+	for i, e := range expected {
+		if events[i].GetString("username") != e.username || events[i].GetString(SensorField) != e.sensor {
+			t.Errorf("Event %d: expected %s from %s, got %s from %s", i, e.username, e.sensor,
+				events[i].GetString("username"), events[i].GetString(SensorField))
+		}
+	}
+	if events[2].Type != "auth_attempt" {
+		t.Errorf("Expected attempt of an older version to get its type, got %q", events[2].Type)
+	}
+}
@@ -0,0 +1,347 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Layout of the Parquet files written by parquetExporter, see
+// https://parquet.apache.org/docs/file-format/
+const (
+	parquetMagic = "PAR1"
+	// Rows buffered before they are written as a row group
+	parquetRowGroupRows = 100000
+
+	// Values of the enumerations of the format
+	parquetByteArray     = 6 // Type
+	parquetOptional      = 1 // FieldRepetitionType
+	parquetUTF8          = 0 // ConvertedType
+	parquetPlain         = 0 // Encoding
+	parquetRLE           = 3 // Encoding
+	parquetGzip          = 2 // CompressionCodec
+	parquetDataPage      = 0 // PageType
+	parquetFormatVersion = 1
+)
+
+// parquetExporter writes a Parquet file with an optional string column per
+// selected column. Values are written as in the CSV format, lists and
+// objects as JSON, and invalid text has its invalid bytes replaced. Rows
+// are buffered and written in gzip-compressed row groups, the metadata
+// follows them when the exporter is closed.
+type parquetExporter struct {
+	w       io.Writer
+	columns []string
+	// Bytes written so far, for the offsets of the metadata
+	offset int64
+	// Values of the buffered rows by column, nil for missing ones
+	values [][]*string
+	rows   int
+	groups []parquetRowGroup
+	total  int64
+}
+
+// parquetRowGroup is the metadata of a written row group
+type parquetRowGroup struct {
+	rows   int
+	size   int64
+	chunks []parquetChunk
+}
+
+// parquetChunk is the metadata of a written column chunk
+type parquetChunk struct {
+	offset           int64
+	values           int
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+func newParquetExporter(w io.Writer, columns []string) (*parquetExporter, error) {
+	e := &parquetExporter{w: w, columns: columns, values: make([][]*string, len(columns))}
+	if err := e.write([]byte(parquetMagic)); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *parquetExporter) Write(event *logger.Event) error {
+	for i, c := range e.columns {
+		var value *string
+		if v := Column(event, c); v != nil {
+			s := strings.ToValidUTF8(csvValue(v), "�")
+			value = &s
+		}
+		e.values[i] = append(e.values[i], value)
+	}
+	e.rows++
+	if e.rows == parquetRowGroupRows {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *parquetExporter) Close() error {
+	if e.rows > 0 {
+		if err := e.flush(); err != nil {
+			return err
+		}
+	}
+	metadata := e.metadata()
+	if err := e.write(metadata); err != nil {
+		return err
+	}
+	return e.write(binary.LittleEndian.AppendUint32([]byte(nil), uint32(len(metadata))), []byte(parquetMagic))
+}
+
+// flush writes the buffered rows as a row group with a data page per column
+func (e *parquetExporter) flush() error {
+	group := parquetRowGroup{rows: e.rows}
+	for i, values := range e.values {
+		page := parquetPage(values)
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(page)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+
+		var header thriftWriter
+		header.fieldI32(1, parquetDataPage)
+		header.fieldI32(2, int32(len(page)))
+		header.fieldI32(3, int32(compressed.Len()))
+		header.fieldStruct(5)
+		header.fieldI32(1, int32(len(values)))
+		header.fieldI32(2, parquetPlain)
+		header.fieldI32(3, parquetRLE)
+		header.fieldI32(4, parquetRLE)
+		header.end()
+		header.finish()
+
+		chunk := parquetChunk{
+			offset:           e.offset,
+			values:           len(values),
+			uncompressedSize: int64(len(header.buf) + len(page)),
+			compressedSize:   int64(len(header.buf) + compressed.Len()),
+		}
+		if err := e.write(header.buf, compressed.Bytes()); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.uncompressedSize
+		e.values[i] = values[:0]
+	}
+	e.groups = append(e.groups, group)
+	e.total += int64(e.rows)
+	e.rows = 0
+	return nil
+}
+
+// parquetPage returns the content of a data page: the definition levels of
+// the values, 0 for missing ones, in runs of the RLE encoding, followed by
+// the present values
+func parquetPage(values []*string) []byte {
+	var levels []byte
+	for i := 0; i < len(values); {
+		n := 1
+		for i+n < len(values) && (values[i+n] == nil) == (values[i] == nil) {
+			n++
+		}
+		levels = binary.AppendUvarint(levels, uint64(n)<<1)
+		if values[i] != nil {
+			levels = append(levels, 1)
+		} else {
+			levels = append(levels, 0)
+		}
+		i += n
+	}
+
+	page := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+	page = append(page, levels...)
+	for _, v := range values {
+		if v != nil {
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(*v)))
+			page = append(page, *v...)
+		}
+	}
+	return page
+}
+
+// metadata returns the file metadata with the schema and the row groups
+func (e *parquetExporter) metadata() []byte {
+	var m thriftWriter
+	m.fieldI32(1, parquetFormatVersion)
+
+	// The schema is a root element followed by the columns
+	m.fieldList(2, thriftStruct, len(e.columns)+1)
+	m.begin()
+	m.fieldBinary(4, "schema")
+	m.fieldI32(5, int32(len(e.columns)))
+	m.end()
+	for _, c := range e.columns {
+		m.begin()
+		m.fieldI32(1, parquetByteArray)
+		m.fieldI32(3, parquetOptional)
+		m.fieldBinary(4, c)
+		m.fieldI32(6, parquetUTF8)
+		m.fieldStruct(10) // LogicalType
+		m.fieldStruct(1)  // STRING
+		m.end()
+		m.end()
+		m.end()
+	}
+
+	m.fieldI64(3, e.total)
+	m.fieldList(4, thriftStruct, len(e.groups))
+	for _, g := range e.groups {
+		m.begin()
+		m.fieldList(1, thriftStruct, len(g.chunks))
+		for i, c := range g.chunks {
+			m.begin()
+			m.fieldI64(2, c.offset)
+			m.fieldStruct(3) // ColumnMetaData
+			m.fieldI32(1, parquetByteArray)
+			m.fieldList(2, thriftI32, 2)
+			m.varint(parquetPlain)
+			m.varint(parquetRLE)
+			m.fieldList(3, thriftBinary, 1)
+			m.binary(e.columns[i])
+			m.fieldI32(4, parquetGzip)
+			m.fieldI64(5, int64(c.values))
+			m.fieldI64(6, c.uncompressedSize)
+			m.fieldI64(7, c.compressedSize)
+			m.fieldI64(9, c.offset)
+			m.end()
+			m.end()
+		}
+		m.fieldI64(2, g.size)
+		m.fieldI64(3, int64(g.rows))
+		m.end()
+	}
+	m.fieldBinary(6, "fakessh")
+	return m.finish()
+}
+
+// write writes data and counts its bytes
+func (e *parquetExporter) write(data ...[]byte) error {
+	for _, d := range data {
+		n, err := e.w.Write(d)
+		e.offset += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Types of the Thrift compact protocol
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the metadata structures of Parquet with the Thrift
+// compact protocol. Fields are written in increasing order of their IDs
+// within a struct, the top-level struct is completed with finish.
+type thriftWriter struct {
+	buf []byte
+	// Last field ID of the current struct and of the enclosing ones
+	last  int16
+	stack []int16
+}
+
+func (w *thriftWriter) field(id int16, kind byte) {
+	if delta := id - w.last; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|kind)
+	} else {
+		w.buf = append(w.buf, kind)
+		w.varint(int64(id))
+	}
+	w.last = id
+}
+
+func (w *thriftWriter) fieldI32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.varint(int64(v))
+}
+
+func (w *thriftWriter) fieldI64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.varint(v)
+}
+
+func (w *thriftWriter) fieldBinary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.binary(s)
+}
+
+// fieldStruct starts a struct field, completed with end
+func (w *thriftWriter) fieldStruct(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
+
+// fieldList starts a list field of n elements, which follow it. Elements
+// that are structs are each started with begin and completed with end.
+func (w *thriftWriter) fieldList(id int16, kind byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|kind)
+	} else {
+		w.buf = append(w.buf, 0xf0|kind)
+		w.buf = binary.AppendUvarint(w.buf, uint64(n))
+	}
+}
+
+// begin starts a struct
+func (w *thriftWriter) begin() {
+	w.stack = append(w.stack, w.last)
+	w.last = 0
+}
+
+// end completes the current struct
+func (w *thriftWriter) end() {
+	w.buf = append(w.buf, 0)
+	w.last = w.stack[len(w.stack)-1]
+	w.stack = w.stack[:len(w.stack)-1]
+}
+
+// finish completes the top-level struct and returns the encoded data
+func (w *thriftWriter) finish() []byte {
+	w.buf = append(w.buf, 0)
+	return w.buf
+}
+
+// varint writes a signed integer in zigzag encoding
+func (w *thriftWriter) varint(v int64) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(v<<1^v>>63))
+}
+
+func (w *thriftWriter) binary(s string) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
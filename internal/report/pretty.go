@@ -0,0 +1,106 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// ANSI colors of pretty lines
+const (
+	colorReset   = "\x1b[0m"
+	colorDim     = "\x1b[2m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+)
+
+// Fields shown in the main part of attempt lines
+var prettyAttemptFields = map[string]bool{
+	"remote_addr": true, "username": true, "password": true, "country": true,
+	"count": true, "new_attacker": true, "client_version": true,
+}
+
+// Pretty formats events as human-friendly lines. Attempts show the source,
+// the credentials and their most interesting fields, other events their
+// message and all fields.
+type Pretty struct {
+	// Highlight parts of the lines with ANSI colors
+	Color bool
+	// Append the other fields of attempts as key=value
+	Verbose bool
+}
+
+// Format returns the line of an event, without a newline
+func (p Pretty) Format(event *logger.Event) string {
+	var b strings.Builder
+	b.WriteString(p.paint(colorDim, event.Time.UTC().Format(time.DateTime)))
+
+	if event.Type != "auth_attempt" {
+		b.WriteString(" " + p.paint(colorMagenta, event.Type))
+		if event.Message != "" {
+			b.WriteString(" " + printable(event.Message))
+		}
+		for _, f := range event.Fields {
+			fmt.Fprintf(&b, " %s=%s", f.Key, printable(fmt.Sprint(f.Value)))
+		}
+		return b.String()
+	}
+
+	b.WriteString(" " + p.paint(colorCyan, sourceIP(event)))
+	b.WriteString(" " + p.paint(colorYellow, printable(event.GetString("username"))))
+	// Imported sshd attempts have no password
+	if _, ok := event.Get("password"); ok {
+		b.WriteString(" / " + p.paint(colorRed, printable(event.GetString("password"))))
+	}
+	if country := event.GetString("country"); country != "" {
+		b.WriteString(" " + p.paint(colorGreen, country))
+	}
+	if n := attemptCount(event); n > 1 {
+		fmt.Fprintf(&b, " x%d", n)
+	}
+	if v, _ := event.Get("new_attacker"); v == true {
+		b.WriteString(" " + p.paint(colorGreen, "new"))
+	}
+	if version := event.GetString("client_version"); version != "" {
+		b.WriteString(" " + p.paint(colorDim, printable(version)))
+	}
+	if p.Verbose {
+		for _, f := range event.Fields {
+			if !prettyAttemptFields[f.Key] {
+				fmt.Fprintf(&b, " %s=%s", f.Key, printable(fmt.Sprint(f.Value)))
+			}
+		}
+	}
+	return b.String()
+}
+
+// paint wraps s in a color if colors are enabled
+func (p Pretty) paint(color, s string) string {
+	if !p.Color {
+		return s
+	}
+	return color + s + colorReset
+}
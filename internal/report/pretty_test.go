@@ -0,0 +1,39 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestPrettyFormat(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	event := attempt("192.0.2.1:4000", "root", "pass word", at)
+	event.Set("country", "CN")
+	event.Set("count", 3)
+	event.Set("new_attacker", true)
+	event.Set("client_version", "SSH-2.0-Go")
+	event.Set("asn", 4134)
+
+	if got := (Pretty{}).Format(event); got != `2024-01-01 12:00:00 192.0.2.1 root / "pass word" CN x3 new SSH-2.0-Go` {
+		t.Errorf("Unexpected line: %s", got)
+	}
+	if got := (Pretty{Verbose: true}).Format(event); got != `2024-01-01 12:00:00 192.0.2.1 root / "pass word" CN x3 new SSH-2.0-Go asn=4134` {
+		t.Errorf("Unexpected verbose line: %s", got)
+	}
+	colored := Pretty{Color: true}.Format(attempt("192.0.2.1:4000", "root", "x", at))
+	if colored != "\x1b[2m2024-01-01 12:00:00\x1b[0m \x1b[36m192.0.2.1\x1b[0m \x1b[33mroot\x1b[0m / \x1b[31mx\x1b[0m" {
+		t.Errorf("Unexpected colored line: %q", colored)
+	}
+
+	event.Delete("password")
+	if got := (Pretty{}).Format(event); got != `2024-01-01 12:00:00 192.0.2.1 root CN x3 new SSH-2.0-Go` {
+		t.Errorf("Unexpected line without password: %s", got)
+	}
+
+	heartbeat := &logger.Event{Type: "heartbeat", Time: at, Message: "heartbeat", Fields: []logger.Field{{Key: "uptime_seconds", Value: 60}}}
+	if got := (Pretty{}).Format(heartbeat); got != "2024-01-01 12:00:00 heartbeat heartbeat uptime_seconds=60" {
+		t.Errorf("Unexpected line: %s", got)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Query selects events by the parameters of an HTTP request, for the APIs
+// serving events
+type Query struct {
+	Filter
+	prefixes  []netip.Prefix
+	usernames []string
+	sensors   []string
+	countries []string
+	expr      *Expr
+}
+
+// ParseQuery reads the filters of the parameters since, until, type, ip (an
+// address or a CIDR prefix), username, sensor, country and q (an
+// expression). Parameters given more than once match any of their values.
+func ParseQuery(values url.Values, now time.Time) (*Query, error) {
+	q := &Query{
+		usernames: values["username"],
+		sensors:   values["sensor"],
+		countries: values["country"],
+	}
+	q.Types = values["type"]
+	var err error
+	if v := values.Get("since"); v != "" {
+		if q.Since, err = ParseTime(v, now); err != nil {
+			return nil, err
+		}
+	}
+	if v := values.Get("until"); v != "" {
+		if q.Until, err = ParseTime(v, now); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range values["ip"] {
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ip %q: must be an address or a CIDR prefix", v)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		q.prefixes = append(q.prefixes, prefix.Masked())
+	}
+	if v := values.Get("q"); v != "" {
+		if q.expr, err = ParseExpr(v, now); err != nil {
+			return nil, fmt.Errorf("invalid q: %w", err)
+		}
+	}
+	return q, nil
+}
+
+// Match reports whether an event passes all filters of the query
+func (q *Query) Match(event *logger.Event) bool {
+	if !q.Filter.Match(event) {
+		return false
+	}
+	if len(q.prefixes) > 0 {
+		addr, err := netip.ParseAddr(sourceIP(event))
+		if err != nil || !slices.ContainsFunc(q.prefixes, func(p netip.Prefix) bool { return p.Contains(addr.Unmap()) }) {
+			return false
+		}
+	}
+	if len(q.usernames) > 0 && !slices.Contains(q.usernames, event.GetString("username")) {
+		return false
+	}
+	if len(q.sensors) > 0 && !slices.Contains(q.sensors, event.GetString("sensor_id")) {
+		return false
+	}
+	if len(q.countries) > 0 && !slices.Contains(q.countries, event.GetString("country")) {
+		return false
+	}
+	return q.expr == nil || q.expr.Match(event)
+}
@@ -0,0 +1,58 @@
+package report
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	event := attempt("[::ffff:192.0.2.1]:4000", "root", "123456", now.Add(-time.Hour))
+	event.Set("country", "CN")
+	event.Set("sensor_id", "fra1")
+
+	tests := []struct {
+		query string
+		match bool
+	}{
+		{"", true},
+		{"since=2h&until=2024-01-02", true},
+		{"since=30m", false},
+		{"type=auth_attempt&type=command", true},
+		{"type=connection", false},
+		{"ip=192.0.2.0/24", true},
+		{"ip=192.0.2.1", true},
+		{"ip=198.51.100.1&ip=2001:db8::/32", false},
+		{"username=admin&username=root", true},
+		{"username=admin", false},
+		{"sensor=fra1&country=CN", true},
+		{"country=RU", false},
+		{"q=password+%3D~+%22%5E12%22", true},
+		{"q=password+%3D%3D+%22x%22", false},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		q, err := ParseQuery(values, now)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) failed: %v", tt.query, err)
+			continue
+		}
+		if got := q.Match(event); got != tt.match {
+			t.Errorf("ParseQuery(%q).Match() = %v, want %v", tt.query, got, tt.match)
+		}
+	}
+
+	for _, invalid := range []string{"since=yesterday", "until=soon", "ip=host", "q=username+%3D%3D"} {
+		values, _ := url.ParseQuery(invalid)
+		if _, err := ParseQuery(values, now); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+
+	if q, _ := ParseQuery(url.Values{"ip": {"192.0.2.1"}}, now); q.Match(&logger.Event{Type: "heartbeat", Time: now}) {
+		t.Errorf("Expected events without a source not to match an ip filter")
+	}
+}
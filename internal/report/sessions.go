@@ -0,0 +1,294 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// SessionConfig contains settings of session grouping
+type SessionConfig struct {
+	// Idle time after which the next event of a connection without a
+	// session_id starts a new session, never if 0
+	Gap time.Duration
+	// Number of most recent sessions kept, all if 0
+	Max int
+}
+
+// Session is the interaction of a connection: its events in order and
+// what the attacker did
+type Session struct {
+	ID            string
+	RemoteAddr    string
+	SensorID      string
+	ClientVersion string
+	Start         time.Time
+	End           time.Time
+	Attempts      int
+	Commands      int
+	Accepted      bool
+	Events        []*logger.Event
+
+	key string
+}
+
+// Duration returns the time between the first and the last event
+func (s *Session) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// MarshalJSON writes the session with its events in the format of the JSON export
+func (s *Session) MarshalJSON() ([]byte, error) {
+	var events []json.RawMessage
+	var buf bytes.Buffer
+	exporter := &jsonExporter{w: &buf}
+	for _, event := range s.Events {
+		buf.Reset()
+		exporter.Write(event)
+		events = append(events, append(json.RawMessage(nil), bytes.TrimSpace(buf.Bytes())...))
+	}
+	return json.Marshal(struct {
+		ID            string            `json:"id"`
+		RemoteAddr    string            `json:"remote_addr"`
+		SensorID      string            `json:"sensor_id,omitempty"`
+		ClientVersion string            `json:"client_version,omitempty"`
+		Start         string            `json:"start"`
+		End           string            `json:"end"`
+		Duration      float64           `json:"duration"`
+		Attempts      int               `json:"attempts"`
+		Commands      int               `json:"commands"`
+		Accepted      bool              `json:"accepted"`
+		Events        []json.RawMessage `json:"events,omitempty"`
+	}{
+		ID:            s.ID,
+		RemoteAddr:    s.RemoteAddr,
+		SensorID:      s.SensorID,
+		ClientVersion: s.ClientVersion,
+		Start:         s.Start.UTC().Format(time.RFC3339Nano),
+		End:           s.End.UTC().Format(time.RFC3339Nano),
+		Duration:      s.Duration().Seconds(),
+		Attempts:      s.Attempts,
+		Commands:      s.Commands,
+		Accepted:      s.Accepted,
+		Events:        events,
+	})
+}
+
+// Sessions groups events into sessions: by their session_id (imported
+// logs), or by the sensor and the address and port of the connection.
+// It is a logger.Processor, so that the sessions of a running server can
+// be served by the admin API.
+type Sessions struct {
+	config SessionConfig
+
+	mu       sync.Mutex
+	open     map[string]*Session
+	sessions []*Session
+}
+
+// NewSessions creates an empty session grouping
+func NewSessions(config SessionConfig) *Sessions {
+	return &Sessions{
+		config: config,
+		open:   make(map[string]*Session),
+	}
+}
+
+// Process adds a copy of a logged event
+func (s *Sessions) Process(event *logger.Event) {
+	s.Add(event.Clone())
+}
+
+// Add adds an event to its session, events of no connection are ignored
+func (s *Sessions) Add(event *logger.Event) {
+	sessionID := event.GetString("session_id")
+	remoteAddr := event.GetString("remote_addr")
+	if sessionID == "" && remoteAddr == "" {
+		return
+	}
+	sensorID := event.GetString("sensor_id")
+	key := sensorID + "\x00" + remoteAddr
+	if sessionID != "" {
+		key = sensorID + "\x00" + sessionID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session := s.open[key]
+	if session != nil && sessionID == "" && s.config.Gap > 0 && event.Time.Sub(session.End) > s.config.Gap {
+		session = nil
+	}
+	if session == nil {
+		session = &Session{
+			ID:         sessionID,
+			RemoteAddr: remoteAddr,
+			SensorID:   sensorID,
+			Start:      event.Time,
+			End:        event.Time,
+			key:        key,
+		}
+		if session.ID == "" {
+			session.ID = event.ID
+		}
+		if session.ID == "" {
+			session.ID = fmt.Sprintf("%s-%d", sourceIP(event), event.Time.UnixMilli())
+		}
+		s.open[key] = session
+		s.sessions = append(s.sessions, session)
+		if s.config.Max > 0 && len(s.sessions) > s.config.Max {
+			oldest := s.sessions[0]
+			s.sessions[0] = nil
+			s.sessions = s.sessions[1:]
+			if s.open[oldest.key] == oldest {
+				delete(s.open, oldest.key)
+			}
+		}
+	}
+
+	session.Events = append(session.Events, event)
+	if event.Time.Before(session.Start) {
+		session.Start = event.Time
+	}
+	if event.Time.After(session.End) {
+		session.End = event.Time
+	}
+	if session.RemoteAddr == "" {
+		session.RemoteAddr = remoteAddr
+	}
+	if version := event.GetString("client_version"); version != "" {
+		session.ClientVersion = version
+	}
+	switch event.Type {
+	case "auth_attempt":
+		session.Attempts += attemptCount(event)
+		if v, _ := event.Get("accepted"); v == true {
+			session.Accepted = true
+		}
+	case "command":
+		session.Commands++
+	}
+}
+
+// List returns copies of the sessions ordered by their start
+func (s *Sessions) List() []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]*Session, len(s.sessions))
+	for i, session := range s.sessions {
+		sessions[i] = session.copy()
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Start.Before(sessions[j].Start)
+	})
+	return sessions
+}
+
+// Get returns a copy of the session with the given ID, nil if there is none
+func (s *Sessions) Get(id string) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.sessions) - 1; i >= 0; i-- {
+		if s.sessions[i].ID == id {
+			return s.sessions[i].copy()
+		}
+	}
+	return nil
+}
+
+// ServeHTTP returns the session with the id path value and its events, or
+// the sessions without their events. The limit query parameter restricts
+// the list to the latest sessions.
+func (s *Sessions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if id := r.PathValue("id"); id != "" {
+		session := s.Get(id)
+		if session == nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "unknown session"})
+			return
+		}
+		json.NewEncoder(w).Encode(session)
+		return
+	}
+
+	sessions := s.List()
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid limit"})
+			return
+		}
+		if limit < len(sessions) {
+			sessions = sessions[len(sessions)-limit:]
+		}
+	}
+	for _, session := range sessions {
+		session.Events = nil
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"sessions": sessions})
+}
+
+// FormatSession returns the header line of a session: its source, sensor,
+// period and what happened, without a newline
+func (p Pretty) FormatSession(s *Session) string {
+	var b strings.Builder
+	b.WriteString(p.paint(colorDim, s.Start.UTC().Format(time.DateTime)))
+	fmt.Fprintf(&b, " %s", p.paint(colorCyan, printable(s.RemoteAddr)))
+	if s.SensorID != "" {
+		b.WriteString(" @" + printable(s.SensorID))
+	}
+	fmt.Fprintf(&b, " %s, %s", s.Duration().Round(time.Second), plural(s.Attempts, "attempt"))
+	if s.Commands > 0 {
+		b.WriteString(", " + plural(s.Commands, "command"))
+	}
+	if s.Accepted {
+		b.WriteString(" " + p.paint(colorRed, "accepted"))
+	}
+	if s.ClientVersion != "" {
+		b.WriteString(" " + p.paint(colorDim, printable(s.ClientVersion)))
+	}
+	b.WriteString(" " + p.paint(colorDim, "session="+printable(s.ID)))
+	return b.String()
+}
+
+// plural returns a number with a noun in singular or plural
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// copy returns a copy of the session that is not changed by later events
+func (s *Session) copy() *Session {
+	c := *s
+	c.Events = append([]*logger.Event(nil), s.Events...)
+	return &c
+}
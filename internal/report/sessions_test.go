@@ -0,0 +1,138 @@
+package report
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestSessions(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewSessions(SessionConfig{Gap: 10 * time.Minute})
+
+	first := attempt("192.0.2.1:4000", "root", "123456", at)
+	first.ID = "0190a000-0000-7000-8000-000000000001"
+	first.Set("client_version", "SSH-2.0-Go")
+	s.Add(first)
+	aggregated := attempt("192.0.2.1:4000", "root", "admin", at.Add(time.Minute))
+	aggregated.Set("count", 3)
+	s.Add(aggregated)
+	s.Add(attempt("198.51.100.1:5000", "admin", "admin", at.Add(2*time.Minute)))
+	// The port is reused after the gap
+	s.Add(attempt("192.0.2.1:4000", "pi", "raspberry", at.Add(time.Hour)))
+	s.Add(&logger.Event{Type: "heartbeat", Time: at})
+
+	// Imported sessions are grouped by their ID, also after long pauses
+	for i, kind := range []string{"auth_attempt", "command", "command"} {
+		event := &logger.Event{Type: kind, Time: at.Add(time.Duration(i) * time.Hour)}
+		event.Set("remote_addr", "203.0.113.1:22")
+		event.Set("session_id", "c0ffee")
+		if kind == "auth_attempt" {
+			event.Set("accepted", true)
+		}
+		s.Add(event)
+	}
+
+	sessions := s.List()
+	if len(sessions) != 4 {
+		t.Fatalf("Expected 4 sessions, got %d", len(sessions))
+	}
+	session := sessions[0]
+	if session.ID != first.ID || session.Attempts != 4 || session.Duration() != time.Minute || session.ClientVersion != "SSH-2.0-Go" || len(session.Events) != 2 {
+		t.Errorf("Unexpected first session: %+v", session)
+	}
+	imported := s.Get("c0ffee")
+	if imported == nil || imported.Attempts != 1 || imported.Commands != 2 || !imported.Accepted || imported.Duration() != 2*time.Hour {
+		t.Errorf("Unexpected imported session: %+v", imported)
+	}
+	if last := sessions[3]; last.RemoteAddr != "192.0.2.1:4000" || last.ID != "192.0.2.1-1704070800000" {
+		t.Errorf("Unexpected session after the gap: %+v", last)
+	}
+
+	// Later events do not change returned sessions
+	s.Add(attempt("192.0.2.1:4000", "pi", "pi", at.Add(time.Hour+time.Second)))
+	if len(sessions[3].Events) != 1 || len(s.List()[3].Events) != 2 {
+		t.Errorf("Sessions are not copied")
+	}
+}
+
+func TestSessionsMax(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewSessions(SessionConfig{Max: 2})
+	s.Add(attempt("192.0.2.1:1", "root", "x", at))
+	s.Add(attempt("192.0.2.2:1", "root", "x", at))
+	s.Add(attempt("192.0.2.3:1", "root", "x", at))
+	// The dropped session is not continued
+	s.Add(attempt("192.0.2.1:1", "root", "y", at))
+
+	sessions := s.List()
+	if len(sessions) != 2 || sessions[0].RemoteAddr != "192.0.2.3:1" || sessions[1].RemoteAddr != "192.0.2.1:1" || sessions[1].Attempts != 1 {
+		t.Errorf("Unexpected sessions: %+v", sessions)
+	}
+}
+
+func TestSessionsServeHTTP(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewSessions(SessionConfig{})
+	s.Process(attempt("192.0.2.1:1", "root", "x", at))
+	s.Process(attempt("192.0.2.2:1", "root", "x", at.Add(time.Second)))
+	s.Process(attempt("192.0.2.2:1", "admin", "x", at.Add(2*time.Second)))
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /sessions", s)
+	mux.Handle("GET /sessions/{id}", s)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sessions?limit=1", nil))
+	var list struct {
+		Sessions []map[string]interface{} `json:"sessions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Sessions) != 1 || list.Sessions[0]["remote_addr"] != "192.0.2.2:1" || list.Sessions[0]["events"] != nil {
+		t.Fatalf("Unexpected list: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sessions/"+list.Sessions[0]["id"].(string), nil))
+	var session struct {
+		Attempts int                      `json:"attempts"`
+		Events   []map[string]interface{} `json:"events"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &session); err != nil {
+		t.Fatal(err)
+	}
+	if session.Attempts != 2 || len(session.Events) != 2 || session.Events[0]["username"] != "root" || session.Events[1]["username"] != "admin" {
+		t.Errorf("Unexpected session: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sessions/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown session, got %d", rec.Code)
+	}
+}
+
+func TestPrettyFormatSession(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	session := &Session{
+		ID:            "c0ffee",
+		RemoteAddr:    "192.0.2.1:4000",
+		SensorID:      "sensor-1",
+		ClientVersion: "SSH-2.0-Go",
+		Start:         at,
+		End:           at.Add(90 * time.Second),
+		Attempts:      3,
+		Commands:      2,
+		Accepted:      true,
+	}
+	expected := "2024-01-01 00:00:00 192.0.2.1:4000 @sensor-1 1m30s, 3 attempts, 2 commands accepted SSH-2.0-Go session=c0ffee"
+	if line := (Pretty{}).FormatSession(session); line != expected {
+		t.Errorf("Expected %q, got %q", expected, line)
+	}
+}
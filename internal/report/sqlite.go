@@ -0,0 +1,381 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Layout of the database files written by sqliteExporter, see
+// https://www.sqlite.org/fileformat.html
+const (
+	sqlitePageSize = 4096
+	// Header of the database at the start of the first page
+	sqliteHeaderSize = 100
+	// Page types and the sizes of their headers
+	sqliteInteriorPage       = 0x05
+	sqliteLeafPage           = 0x0d
+	sqliteInteriorHeaderSize = 12
+	sqliteLeafHeaderSize     = 8
+	// Largest payload kept in a leaf cell, longer payloads continue in
+	// overflow pages
+	sqliteMaxLocal = sqlitePageSize - 35
+	sqliteMinLocal = (sqlitePageSize-12)*32/255 - 23
+)
+
+// errSQLiteSeek is returned for outputs the database can not be written to
+var errSQLiteSeek = errors.New("the sqlite format must be written to a file")
+
+// sqliteExporter writes an SQLite database with a table of the events.
+// Leaf pages are written as rows are added, the interior pages of the
+// table and the schema on the first page once all rows are known.
+type sqliteExporter struct {
+	w       io.WriteSeeker
+	table   string
+	columns []string
+	// Pages written so far, the first page is written last
+	pages uint32
+	// Cells of the leaf page being filled and their size
+	cells [][]byte
+	size  int
+	rowid int64
+	// Page numbers and last row IDs of the written pages of the lowest
+	// level of the table
+	children []sqliteChild
+	record   []byte
+}
+
+// sqliteChild is a page of the table with the largest row ID stored in it
+type sqliteChild struct {
+	page  uint32
+	rowid int64
+}
+
+func newSQLiteExporter(w io.Writer, table string, columns []string) (*sqliteExporter, error) {
+	ws, ok := w.(io.WriteSeeker)
+	if !ok {
+		return nil, errSQLiteSeek
+	}
+	// The first page is reserved for the header and the schema
+	if _, err := ws.Seek(sqlitePageSize, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("%w: %w", errSQLiteSeek, err)
+	}
+	return &sqliteExporter{w: ws, table: table, columns: columns, pages: 1}, nil
+}
+
+func (e *sqliteExporter) Write(event *logger.Event) error {
+	values := make([]interface{}, len(e.columns))
+	for i, c := range e.columns {
+		values[i] = Column(event, c)
+	}
+	e.record = sqliteRecord(e.record[:0], values)
+
+	cell, err := e.cell(e.rowid+1, e.record)
+	if err != nil {
+		return err
+	}
+	if sqliteLeafHeaderSize+2*(len(e.cells)+1)+e.size+len(cell) > sqlitePageSize {
+		if err := e.flushLeaf(); err != nil {
+			return err
+		}
+	}
+	e.cells = append(e.cells, cell)
+	e.size += len(cell)
+	e.rowid++
+	return nil
+}
+
+func (e *sqliteExporter) Close() error {
+	if len(e.cells) > 0 || len(e.children) == 0 {
+		if err := e.flushLeaf(); err != nil {
+			return err
+		}
+	}
+
+	// Interior pages are added above the leaves until one page is the root
+	level := e.children
+	for len(level) > 1 {
+		var parents []sqliteChild
+		for len(level) > 0 {
+			n := sqliteInteriorCells(level)
+			if len(level) == n+2 {
+				// The last page of a level points to two children at least
+				n--
+			}
+			page, err := e.writePage(sqliteInteriorPage, 0, sqliteInteriorCellsOf(level[:n]), level[n].page)
+			if err != nil {
+				return err
+			}
+			parents = append(parents, sqliteChild{page: page, rowid: level[n].rowid})
+			level = level[n+1:]
+		}
+		level = parents
+	}
+
+	schema := fmt.Sprintf("CREATE TABLE %s (%s)", sqlIdentifier(e.table), strings.Join(sqlIdentifiers(e.columns), ", "))
+	record := sqliteRecord(nil, []interface{}{"table", e.table, e.table, int(level[0].page), schema})
+	cell, err := e.cell(1, record)
+	if err != nil {
+		return err
+	}
+	if sqliteHeaderSize+sqliteLeafHeaderSize+2+len(cell) > sqlitePageSize {
+		return fmt.Errorf("too many columns for the sqlite format")
+	}
+
+	page := make([]byte, sqlitePageSize)
+	sqliteHeader(page, e.pages)
+	sqliteFillPage(page, sqliteHeaderSize, sqliteLeafPage, [][]byte{cell}, 0)
+	if _, err := e.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = e.w.Write(page)
+	return err
+}
+
+// flushLeaf writes the cells added since the last leaf page
+func (e *sqliteExporter) flushLeaf() error {
+	page, err := e.writePage(sqliteLeafPage, 0, e.cells, 0)
+	if err != nil {
+		return err
+	}
+	e.children = append(e.children, sqliteChild{page: page, rowid: e.rowid})
+	e.cells = e.cells[:0]
+	e.size = 0
+	return nil
+}
+
+// writePage writes a page after those written before and returns its number
+func (e *sqliteExporter) writePage(kind byte, offset int, cells [][]byte, right uint32) (uint32, error) {
+	page := make([]byte, sqlitePageSize)
+	sqliteFillPage(page, offset, kind, cells, right)
+	if _, err := e.w.Write(page); err != nil {
+		return 0, err
+	}
+	e.pages++
+	return e.pages, nil
+}
+
+// cell returns the leaf cell of a row, writing the end of long records to
+// overflow pages
+func (e *sqliteExporter) cell(rowid int64, record []byte) ([]byte, error) {
+	cell := sqliteVarint(nil, uint64(len(record)))
+	cell = sqliteVarint(cell, uint64(rowid))
+
+	local := len(record)
+	if local > sqliteMaxLocal {
+		local = sqliteMinLocal + (len(record)-sqliteMinLocal)%(sqlitePageSize-4)
+		if local > sqliteMaxLocal {
+			local = sqliteMinLocal
+		}
+	}
+	cell = append(cell, record[:local]...)
+	if local == len(record) {
+		return cell, nil
+	}
+
+	// Overflow pages are written in order, each pointing to the next one
+	cell = binary.BigEndian.AppendUint32(cell, e.pages+1)
+	rest := record[local:]
+	for len(rest) > 0 {
+		page := make([]byte, sqlitePageSize)
+		n := copy(page[4:], rest)
+		rest = rest[n:]
+		if len(rest) > 0 {
+			binary.BigEndian.PutUint32(page, e.pages+2)
+		}
+		if _, err := e.w.Write(page); err != nil {
+			return nil, err
+		}
+		e.pages++
+	}
+	return cell, nil
+}
+
+// sqliteInteriorCells returns how many children of a level are referenced
+// by the cells of the next interior page, the child after them is its
+// right-most pointer
+func sqliteInteriorCells(level []sqliteChild) int {
+	size := sqliteInteriorHeaderSize
+	n := 0
+	for n < len(level)-1 {
+		cellSize := 4 + len(sqliteVarint(nil, uint64(level[n].rowid)))
+		if size+2+cellSize > sqlitePageSize {
+			break
+		}
+		size += 2 + cellSize
+		n++
+	}
+	return n
+}
+
+// sqliteInteriorCellsOf returns the cells of an interior page pointing to
+// the children with their largest row ID as key
+func sqliteInteriorCellsOf(children []sqliteChild) [][]byte {
+	cells := make([][]byte, len(children))
+	for i, c := range children {
+		cells[i] = sqliteVarint(binary.BigEndian.AppendUint32(nil, c.page), uint64(c.rowid))
+	}
+	return cells
+}
+
+// sqliteFillPage writes a b-tree page header at offset, the cell pointers
+// after it and the cells at the end of the page
+func sqliteFillPage(page []byte, offset int, kind byte, cells [][]byte, right uint32) {
+	header := page[offset:]
+	header[0] = kind
+	binary.BigEndian.PutUint16(header[3:], uint16(len(cells)))
+	pointers := header[sqliteLeafHeaderSize:]
+	if kind == sqliteInteriorPage {
+		binary.BigEndian.PutUint32(header[8:], right)
+		pointers = header[sqliteInteriorHeaderSize:]
+	}
+
+	end := len(page)
+	for i, cell := range cells {
+		end -= len(cell)
+		copy(page[end:], cell)
+		binary.BigEndian.PutUint16(pointers[2*i:], uint16(end))
+	}
+	binary.BigEndian.PutUint16(header[5:], uint16(end))
+}
+
+// sqliteHeader writes the database header of a file with the given number
+// of pages
+func sqliteHeader(page []byte, pages uint32) {
+	copy(page, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(page[16:], sqlitePageSize)
+	page[18], page[19] = 1, 1 // Rollback journal
+	page[21], page[22], page[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(page[24:], 1) // File change counter
+	binary.BigEndian.PutUint32(page[28:], pages)
+	binary.BigEndian.PutUint32(page[40:], 1) // Schema cookie
+	binary.BigEndian.PutUint32(page[44:], 4) // Schema format
+	binary.BigEndian.PutUint32(page[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(page[92:], 1) // Version valid for the change counter
+	binary.BigEndian.PutUint32(page[96:], 3046000)
+}
+
+// sqliteRecord appends the record of a row to buf. Values are stored like
+// sqlValue writes them: booleans as integers, lists and objects as JSON
+// text, and strings that are not valid text as blobs.
+func sqliteRecord(buf []byte, values []interface{}) []byte {
+	var header, body []byte
+	for _, v := range values {
+		var serial uint64
+		serial, body = sqliteValue(body, v)
+		header = sqliteVarint(header, serial)
+	}
+	// The header size includes its own varint
+	size := len(header) + 1
+	for len(header)+len(sqliteVarint(nil, uint64(size))) > size {
+		size++
+	}
+	buf = sqliteVarint(buf, uint64(size))
+	buf = append(buf, header...)
+	return append(buf, body...)
+}
+
+// sqliteValue appends a value to the body of a record and returns its
+// serial type
+func sqliteValue(body []byte, v interface{}) (uint64, []byte) {
+	switch v := v.(type) {
+	case nil:
+		return 0, body
+	case bool:
+		if v {
+			return 9, body
+		}
+		return 8, body
+	case int:
+		return sqliteInteger(body, int64(v))
+	case int64:
+		return sqliteInteger(body, v)
+	case float64:
+		return 7, binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+	case string:
+		if !utf8.ValidString(v) || strings.ContainsRune(v, 0) {
+			return uint64(len(v))*2 + 12, append(body, v...)
+		}
+		return uint64(len(v))*2 + 13, append(body, v...)
+	}
+	data, _ := json.Marshal(v)
+	return sqliteValue(body, string(data))
+}
+
+// sqliteInteger appends an integer in the smallest of the sizes of the format
+func sqliteInteger(body []byte, v int64) (uint64, []byte) {
+	switch v {
+	case 0:
+		return 8, body
+	case 1:
+		return 9, body
+	}
+	serial, size := uint64(6), 8
+	for _, s := range []struct {
+		serial uint64
+		size   int
+	}{{1, 1}, {2, 2}, {3, 3}, {4, 4}, {5, 6}} {
+		limit := int64(1) << (s.size*8 - 1)
+		if v >= -limit && v < limit {
+			serial, size = s.serial, s.size
+			break
+		}
+	}
+	for i := size - 1; i >= 0; i-- {
+		body = append(body, byte(v>>(i*8)))
+	}
+	return serial, body
+}
+
+// sqliteVarint appends a variable-length integer of the format: big-endian
+// groups of 7 bits, the ninth byte holding 8 bits
+func sqliteVarint(buf []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		buf = append(buf, byte(v>>57)|0x80, byte(v>>50)|0x80, byte(v>>43)|0x80, byte(v>>36)|0x80,
+			byte(v>>29)|0x80, byte(v>>22)|0x80, byte(v>>15)|0x80, byte(v>>8)|0x80, byte(v))
+		return buf
+	}
+	var groups [8]byte
+	n := 0
+	for {
+		groups[n] = byte(v & 0x7f)
+		n++
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		b := groups[i]
+		if i > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
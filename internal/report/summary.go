@@ -0,0 +1,227 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Count is the number of attempts with a value
+type Count struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// DayCount is the number of attempts of a day in UTC
+type DayCount struct {
+	Day      string `json:"day"`
+	Attempts int    `json:"attempts"`
+}
+
+// Summary describes the attempts of a log
+type Summary struct {
+	First        *time.Time `json:"first,omitempty"`
+	Last         *time.Time `json:"last,omitempty"`
+	Attempts     int        `json:"attempts"`
+	UniqueIPs    int        `json:"unique_ips"`
+	TopIPs       []Count    `json:"top_ips"`
+	TopUsernames []Count    `json:"top_usernames"`
+	TopPasswords []Count    `json:"top_passwords"`
+	TopCountries []Count    `json:"top_countries"`
+	PerDay       []DayCount `json:"per_day"`
+}
+
+// Summarizer counts authentication attempts for a summary
+type Summarizer struct {
+	top       int
+	first     time.Time
+	last      time.Time
+	attempts  int
+	ips       map[string]int
+	usernames map[string]int
+	passwords map[string]int
+	countries map[string]int
+	days      map[string]int
+}
+
+// NewSummarizer creates a summarizer with top lists of n entries
+func NewSummarizer(n int) *Summarizer {
+	return &Summarizer{
+		top:       n,
+		ips:       make(map[string]int),
+		usernames: make(map[string]int),
+		passwords: make(map[string]int),
+		countries: make(map[string]int),
+		days:      make(map[string]int),
+	}
+}
+
+// Add counts an authentication attempt, other events are ignored
+func (s *Summarizer) Add(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	n := attemptCount(event)
+	s.attempts += n
+	if s.first.IsZero() || event.Time.Before(s.first) {
+		s.first = event.Time
+	}
+	if event.Time.After(s.last) {
+		s.last = event.Time
+	}
+
+	s.ips[sourceIP(event)] += n
+	s.usernames[event.GetString("username")] += n
+	s.passwords[event.GetString("password")] += n
+	if country := event.GetString("country"); country != "" {
+		s.countries[country] += n
+	}
+	s.days[event.Time.UTC().Format(time.DateOnly)] += n
+}
+
+// Summary returns the summary of the attempts counted so far
+func (s *Summarizer) Summary() Summary {
+	summary := Summary{
+		Attempts:     s.attempts,
+		UniqueIPs:    len(s.ips),
+		TopIPs:       top(s.ips, s.top),
+		TopUsernames: top(s.usernames, s.top),
+		TopPasswords: top(s.passwords, s.top),
+		TopCountries: top(s.countries, s.top),
+		PerDay:       make([]DayCount, 0, len(s.days)),
+	}
+	if s.attempts > 0 {
+		summary.First, summary.Last = &s.first, &s.last
+	}
+	for day, n := range s.days {
+		summary.PerDay = append(summary.PerDay, DayCount{Day: day, Attempts: n})
+	}
+	sort.Slice(summary.PerDay, func(i, j int) bool {
+		return summary.PerDay[i].Day < summary.PerDay[j].Day
+	})
+	return summary
+}
+
+// top returns the n values with the highest counts, ties in value order
+func top(m map[string]int, n int) []Count {
+	counts := make([]Count, 0, len(m))
+	for v, c := range m {
+		counts = append(counts, Count{Value: v, Count: c})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Value < counts[j].Value
+	})
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// TopCounter counts authentication attempts by the value of a column
+type TopCounter struct {
+	column string
+	counts map[string]int
+}
+
+// NewTopCounter creates a counter of the values of a column (see Column)
+func NewTopCounter(column string) *TopCounter {
+	return &TopCounter{column: column, counts: make(map[string]int)}
+}
+
+// Add counts an authentication attempt, other events and attempts without
+// a value are ignored
+func (c *TopCounter) Add(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	v := Column(event, c.column)
+	if v == nil || v == "" {
+		return
+	}
+	c.counts[fmt.Sprint(v)] += attemptCount(event)
+}
+
+// Distinct returns the number of values counted
+func (c *TopCounter) Distinct() int {
+	return len(c.counts)
+}
+
+// Top returns the n values with the most attempts
+func (c *TopCounter) Top(n int) []Count {
+	return top(c.counts, n)
+}
+
+// WriteTable writes the summary as aligned text tables
+func (s Summary) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Attempts:\t%d\n", s.Attempts)
+	fmt.Fprintf(tw, "Unique IPs:\t%d\n", s.UniqueIPs)
+	if s.First != nil {
+		fmt.Fprintf(tw, "First:\t%s\n", s.First.UTC().Format(time.RFC3339))
+		fmt.Fprintf(tw, "Last:\t%s\n", s.Last.UTC().Format(time.RFC3339))
+	}
+
+	lists := []struct {
+		title  string
+		counts []Count
+	}{
+		{"TOP IPS", s.TopIPs},
+		{"TOP USERNAMES", s.TopUsernames},
+		{"TOP PASSWORDS", s.TopPasswords},
+		{"TOP COUNTRIES", s.TopCountries},
+	}
+	for _, l := range lists {
+		if len(l.counts) == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "\n%s\tATTEMPTS\n", l.title)
+		for _, c := range l.counts {
+			fmt.Fprintf(tw, "%s\t%d\n", printable(c.Value), c.Count)
+		}
+	}
+
+	if len(s.PerDay) > 0 {
+		fmt.Fprintf(tw, "\nDAY\tATTEMPTS\n")
+		for _, d := range s.PerDay {
+			fmt.Fprintf(tw, "%s\t%d\n", d.Day, d.Attempts)
+		}
+	}
+	return tw.Flush()
+}
+
+// printable quotes values that are empty or contain spaces or control
+// characters, which attackers send to garble terminals
+func printable(s string) string {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool { return !unicode.IsGraphic(r) || unicode.IsSpace(r) }) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,94 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func attempt(addr, username, password string, at time.Time) *logger.Event {
+	return logger.NewAuthEvent(logger.CredentialAttempt{Timestamp: at, RemoteAddr: addr, Username: username, Password: password})
+}
+
+func TestSummarizer(t *testing.T) {
+	day := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	s := NewSummarizer(2)
+
+	first := attempt("192.0.2.1:4000", "root", "123456", day)
+	first.Set("country", "CN")
+	s.Add(first)
+	aggregated := attempt("192.0.2.1:4001", "admin", "123456", day.Add(2*time.Hour))
+	aggregated.Set("count", 3)
+	s.Add(aggregated)
+	s.Add(attempt("[2001:db8::1]:22", "root", "password", day.Add(time.Hour)))
+	s.Add(&logger.Event{Type: "heartbeat", Time: day})
+
+	summary := s.Summary()
+	if summary.Attempts != 5 || summary.UniqueIPs != 2 {
+		t.Errorf("Unexpected totals: %+v", summary)
+	}
+	if !summary.First.Equal(day) || !summary.Last.Equal(day.Add(2*time.Hour)) {
+		t.Errorf("Unexpected period: %v - %v", summary.First, summary.Last)
+	}
+	if len(summary.TopIPs) != 2 || summary.TopIPs[0] != (Count{"192.0.2.1", 4}) {
+		t.Errorf("Unexpected top IPs: %v", summary.TopIPs)
+	}
+	if summary.TopPasswords[0] != (Count{"123456", 4}) {
+		t.Errorf("Unexpected top passwords: %v", summary.TopPasswords)
+	}
+	if len(summary.TopCountries) != 1 || summary.TopCountries[0] != (Count{"CN", 1}) {
+		t.Errorf("Unexpected top countries: %v", summary.TopCountries)
+	}
+	expected := []DayCount{{"2024-01-01", 1}, {"2024-01-02", 4}}
+	if len(summary.PerDay) != 2 || summary.PerDay[0] != expected[0] || summary.PerDay[1] != expected[1] {
+		t.Errorf("Unexpected attempts per day: %v", summary.PerDay)
+	}
+}
+
+func TestTopCounter(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewTopCounter("source_ip")
+
+	c.Add(attempt("192.0.2.1:4000", "root", "123456", day))
+	aggregated := attempt("192.0.2.2:4001", "admin", "admin", day)
+	aggregated.Set("count", 3)
+	c.Add(aggregated)
+	c.Add(attempt("192.0.2.1:4002", "root", "root", day))
+	c.Add(attempt("", "root", "root", day))
+	c.Add(&logger.Event{Type: "connection", Time: day, Fields: []logger.Field{{Key: "remote_addr", Value: "192.0.2.3:22"}}})
+
+	if c.Distinct() != 2 {
+		t.Errorf("Expected 2 distinct values, got %d", c.Distinct())
+	}
+	top := c.Top(1)
+	if len(top) != 1 || top[0] != (Count{"192.0.2.2", 3}) {
+		t.Errorf("Unexpected top values: %v", top)
+	}
+}
+
+func TestSummaryWriteTable(t *testing.T) {
+	s := NewSummarizer(10)
+	s.Add(attempt("192.0.2.1:4000", "root", "pass word\x1b[2J", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	var buf strings.Builder
+	if err := s.Summary().WriteTable(&buf); err != nil {
+		t.Fatalf("Failed to write table: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"Attempts:    1", "TOP USERNAMES", "root", `"pass word\x1b[2J"`, "2024-01-01"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "TOP COUNTRIES") {
+		t.Errorf("Expected empty lists to be left out:\n%s", out)
+	}
+
+	buf.Reset()
+	NewSummarizer(10).Summary().WriteTable(&buf)
+	if strings.Contains(buf.String(), "First:") {
+		t.Errorf("Expected no period for an empty log:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// Wordlists counts the usernames, passwords and credential pairs of
+// attempts for password auditing tools
+type Wordlists struct {
+	usernames map[string]int
+	passwords map[string]int
+	pairs     map[string]int
+	masked    int
+}
+
+// NewWordlists creates empty wordlists
+func NewWordlists() *Wordlists {
+	return &Wordlists{
+		usernames: make(map[string]int),
+		passwords: make(map[string]int),
+		pairs:     make(map[string]int),
+	}
+}
+
+// Add counts an authentication attempt, other events are ignored.
+// Passwords masked by the sensor and values that do not fit on a line are
+// left out.
+func (l *Wordlists) Add(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+	n := attemptCount(event)
+	username := event.GetString("username")
+	if wordlistValue(username) {
+		l.usernames[username] += n
+	}
+
+	if _, ok := event.Get("password"); !ok {
+		return
+	}
+	if mode := event.GetString("password_mode"); mode != "" && mode != "plain" {
+		l.masked += n
+		return
+	}
+	password := event.GetString("password")
+	if wordlistValue(password) {
+		l.passwords[password] += n
+		if wordlistValue(username) && !strings.Contains(username, ":") {
+			l.pairs[username+":"+password] += n
+		}
+	}
+}
+
+// Usernames returns the usernames, most frequent first
+func (l *Wordlists) Usernames() []Count {
+	return top(l.usernames, len(l.usernames))
+}
+
+// Passwords returns the passwords, most frequent first
+func (l *Wordlists) Passwords() []Count {
+	return top(l.passwords, len(l.passwords))
+}
+
+// Pairs returns the credentials as username:password, most frequent first
+func (l *Wordlists) Pairs() []Count {
+	return top(l.pairs, len(l.pairs))
+}
+
+// Masked returns the number of attempts with passwords masked by the sensor
+func (l *Wordlists) Masked() int {
+	return l.masked
+}
+
+// WriteWordlist writes the values used at least minCount times, one per
+// line, preceded by their count and a tab if withCounts is set
+func WriteWordlist(w io.Writer, counts []Count, minCount int, withCounts bool) error {
+	for _, c := range counts {
+		if c.Count < minCount {
+			// Counts are sorted, the rest is below the threshold
+			break
+		}
+		var err error
+		if withCounts {
+			_, err = fmt.Fprintf(w, "%d\t%s\n", c.Count, c.Value)
+		} else {
+			_, err = fmt.Fprintln(w, c.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wordlistValue reports whether a value can be written as a line of a
+// wordlist
+func wordlistValue(s string) bool {
+	return s != "" && !strings.ContainsAny(s, "\r\n")
+}
@@ -0,0 +1,48 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+func TestWordlists(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewWordlists()
+	l.Add(attempt("192.0.2.1:1", "root", "123456", at))
+	aggregated := attempt("192.0.2.2:1", "admin", "123456", at)
+	aggregated.Set("count", 2)
+	l.Add(aggregated)
+	l.Add(attempt("192.0.2.3:1", "root", "multi\nline", at))
+	l.Add(attempt("192.0.2.3:1", "user:name", "pass", at))
+	masked := attempt("192.0.2.4:1", "root", "5e884898", at)
+	masked.Set("password_mode", "sha256")
+	l.Add(masked)
+	l.Add(&logger.Event{Type: "heartbeat", Time: at})
+
+	var b strings.Builder
+	if err := WriteWordlist(&b, l.Passwords(), 1, false); err != nil {
+		t.Fatalf("WriteWordlist failed: %v", err)
+	}
+	if b.String() != "123456\npass\n" {
+		t.Errorf("Unexpected passwords:\n%s", b.String())
+	}
+
+	b.Reset()
+	WriteWordlist(&b, l.Usernames(), 3, true)
+	if b.String() != "3\troot\n" {
+		t.Errorf("Unexpected usernames:\n%s", b.String())
+	}
+
+	b.Reset()
+	WriteWordlist(&b, l.Pairs(), 1, false)
+	if b.String() != "admin:123456\nroot:123456\n" {
+		t.Errorf("Unexpected pairs:\n%s", b.String())
+	}
+
+	if l.Masked() != 1 {
+		t.Errorf("Expected 1 masked attempt, got %d", l.Masked())
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package sandbox confines the server once it is listening: a new root
+// directory, an unprivileged user, Landlock rules limiting filesystem
+// access and a seccomp filter limiting system calls. A honeypot parses
+// hostile input, so a flaw in it should find little to work with.
+package sandbox
+
+import "errors"
+
+// ErrNotSupported is returned for confinement the system does not offer
+var ErrNotSupported = errors.New("not supported on this system")
+
+// Seccomp actions for system calls outside the filter
+const (
+	// The call fails with EPERM
+	ActionErrno = "errno"
+	// The process is killed
+	ActionKill = "kill"
+	// The call is allowed and logged to the audit log
+	ActionLog = "log"
+)
+
+// Config describes the confinement of the process
+type Config struct {
+	// Directory the process changes its root to, empty to keep it
+	Chroot string
+	// User the process switches to, as "name", "name:group" or numeric
+	// IDs, empty to keep the user
+	User string
+	// Limit filesystem access with Landlock to ReadPaths and WritePaths,
+	// directories including everything beneath them
+	Landlock   bool
+	ReadPaths  []string
+	WritePaths []string
+	// Limit system calls with a seccomp filter, applying SeccompAction to
+	// the others
+	Seccomp       bool
+	SeccompAction string
+}
+
+// Enabled reports whether any confinement is configured
+func (c Config) Enabled() bool {
+	return c.Chroot != "" || c.User != "" || c.Landlock || c.Seccomp
+}
@@ -0,0 +1,148 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// errCgo is returned when confinement can not be applied to every thread
+var errCgo = fmt.Errorf("%w: confining every thread requires a build without cgo (CGO_ENABLED=0)", ErrNotSupported)
+
+// Apply confines the process, which can not be undone. The user and the
+// paths of the Landlock rules are looked up before the root changes, so
+// they are found outside the new root.
+func Apply(config Config) error {
+	uid, gid := -1, -1
+	if config.User != "" {
+		var err error
+		if uid, gid, err = lookupUser(config.User); err != nil {
+			return err
+		}
+	}
+
+	var ruleset *landlockRuleset
+	if config.Landlock {
+		var err error
+		if ruleset, err = newLandlockRuleset(config.ReadPaths, config.WritePaths); err != nil {
+			return err
+		}
+		defer ruleset.close()
+	}
+
+	if config.Chroot != "" {
+		if err := unix.Chroot(config.Chroot); err != nil {
+			return fmt.Errorf("failed to change root to %s: %w", config.Chroot, err)
+		}
+		if err := unix.Chdir("/"); err != nil {
+			return fmt.Errorf("failed to change root to %s: %w", config.Chroot, err)
+		}
+	}
+
+	// The user IDs of every thread change
+	if uid >= 0 {
+		if err := syscall.Setgroups([]int{gid}); err != nil {
+			return fmt.Errorf("failed to switch to user %s: %w", config.User, err)
+		}
+		if err := syscall.Setgid(gid); err != nil {
+			return fmt.Errorf("failed to switch to user %s: %w", config.User, err)
+		}
+		if err := syscall.Setuid(uid); err != nil {
+			return fmt.Errorf("failed to switch to user %s: %w", config.User, err)
+		}
+	}
+
+	if ruleset != nil {
+		if err := ruleset.restrict(); err != nil {
+			return err
+		}
+	}
+	if config.Seccomp {
+		if err := installFilter(config.SeccompAction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupUser returns the user and group IDs of "user" or "user:group",
+// given by name or ID
+func lookupUser(spec string) (int, int, error) {
+	name, group, hasGroup := strings.Cut(spec, ":")
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return 0, 0, fmt.Errorf("unknown user %s", name)
+		}
+	}
+	gidText := u.Gid
+	if hasGroup {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				return 0, 0, fmt.Errorf("unknown group %s", group)
+			}
+		}
+		gidText = g.Gid
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid ID of user %s: %s", name, u.Uid)
+	}
+	gid, err := strconv.Atoi(gidText)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid ID of group: %s", gidText)
+	}
+	return uid, gid, nil
+}
+
+// setNoNewPrivs keeps the process from gaining privileges, as Landlock and
+// seccomp require. If every thread can not be changed and allThreads is not
+// set, only the calling one is, which seccomp extends to the others.
+func setNoNewPrivs(allThreads bool) error {
+	_, _, errno := syscall.AllThreadsSyscall(unix.SYS_PRCTL, unix.PR_SET_NO_NEW_PRIVS, 1, 0)
+	switch {
+	case errno == syscall.ENOTSUP && allThreads:
+		return errCgo
+	case errno == syscall.ENOTSUP:
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to set no_new_privs: %w", err)
+		}
+	case errno != 0:
+		return fmt.Errorf("failed to set no_new_privs: %w", errno)
+	}
+	return nil
+}
+
+// notSupported wraps the errors of system calls the kernel does not have
+// or has disabled
+func notSupported(err error) error {
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EOPNOTSUPP) {
+		return fmt.Errorf("%w: %w", ErrNotSupported, err)
+	}
+	return err
+}
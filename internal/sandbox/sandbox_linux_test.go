@@ -0,0 +1,190 @@
+package sandbox
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// runFilter evaluates the seccomp filter for a system call, supporting the
+// instructions it is made of
+func runFilter(t *testing.T, filter []unix.SockFilter, arch uint32, nr uint32) uint32 {
+	data := make([]byte, 8)
+	binary.NativeEndian.PutUint32(data[0:], nr)
+	binary.NativeEndian.PutUint32(data[4:], arch)
+
+	var acc uint32
+	for pc := 0; pc < len(filter); pc++ {
+		ins := filter[pc]
+		switch ins.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = binary.NativeEndian.Uint32(data[ins.K:])
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K:
+			if acc == ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			if acc >= ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case unix.BPF_RET | unix.BPF_K:
+			return ins.K
+		default:
+			t.Fatalf("Unexpected instruction %#x", ins.Code)
+		}
+	}
+	t.Fatal("Filter ended without a result")
+	return 0
+}
+
+func TestSeccompFilter(t *testing.T) {
+	const arch = unix.AUDIT_ARCH_X86_64
+	denied := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM))
+	filter := seccompFilter(arch, []uintptr{0, 1, 60}, denied)
+
+	tests := []struct {
+		name string
+		arch uint32
+		nr   uint32
+		want uint32
+	}{
+		{"first allowed", arch, 0, unix.SECCOMP_RET_ALLOW},
+		{"last allowed", arch, 60, unix.SECCOMP_RET_ALLOW},
+		{"not allowed", arch, 59, denied},
+		{"x32 call", arch, x32Bit | 1, denied},
+		{"other architecture", unix.AUDIT_ARCH_I386, 1, unix.SECCOMP_RET_KILL_PROCESS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runFilter(t, filter, tt.arch, tt.nr); got != tt.want {
+				t.Errorf("Expected %#x, got %#x", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSeccompAction(t *testing.T) {
+	for action, want := range map[string]uint32{
+		"":          unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM),
+		ActionErrno: unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM),
+		ActionKill:  unix.SECCOMP_RET_KILL_PROCESS,
+		ActionLog:   unix.SECCOMP_RET_LOG,
+	} {
+		if got, err := seccompAction(action); err != nil || got != want {
+			t.Errorf("Expected %#x for %q, got %#x (%v)", want, action, got, err)
+		}
+	}
+	if _, err := seccompAction("trap"); err == nil {
+		t.Error("Expected an error for an unknown action")
+	}
+}
+
+func TestLookupUser(t *testing.T) {
+	if uid, gid, err := lookupUser("0:0"); err != nil || uid != 0 || gid != 0 {
+		t.Errorf("Expected 0:0, got %d:%d (%v)", uid, gid, err)
+	}
+	if uid, _, err := lookupUser("root"); err != nil || uid != 0 {
+		t.Errorf("Expected user 0 for root, got %d (%v)", uid, err)
+	}
+	if _, _, err := lookupUser("no-such-user-fakessh"); err == nil {
+		t.Error("Expected an error for an unknown user")
+	}
+}
+
+// helperEnv names the environment variable running the test binary as a
+// confined helper process, as the confinement can not be undone
+const helperEnv = "FAKESSH_SANDBOX_HELPER"
+
+// TestHelperProcess is the confined process of the tests below
+func TestHelperProcess(t *testing.T) {
+	dir := os.Getenv(helperEnv)
+	if dir == "" {
+		t.Skip("helper process only")
+	}
+	config := Config{
+		Landlock:   os.Getenv("LANDLOCK") != "",
+		ReadPaths:  []string{filepath.Join(dir, "read")},
+		WritePaths: []string{filepath.Join(dir, "write")},
+		Seccomp:    os.Getenv("SECCOMP") != "",
+	}
+	if err := Apply(config); err != nil {
+		if errors.Is(err, ErrNotSupported) {
+			os.Stdout.WriteString("unsupported: " + err.Error())
+			os.Exit(0)
+		}
+		os.Stdout.WriteString("apply: " + err.Error())
+		os.Exit(1)
+	}
+
+	var results []string
+	check := func(name string, err error) {
+		results = append(results, name+"="+map[bool]string{true: "ok", false: "denied"}[err == nil])
+	}
+	_, err := os.ReadFile(filepath.Join(dir, "read", "file"))
+	check("read", err)
+	check("write", os.WriteFile(filepath.Join(dir, "write", "file"), []byte("x"), 0644))
+	check("write-read", os.WriteFile(filepath.Join(dir, "read", "new"), []byte("x"), 0644))
+	_, err = os.ReadFile(filepath.Join(dir, "other"))
+	check("other", err)
+	// ptrace is not in the filter
+	_, _, errno := unix.Syscall(unix.SYS_PTRACE, unix.PTRACE_TRACEME, 0, 0)
+	if errno == 0 {
+		err = nil
+	} else {
+		err = errno
+	}
+	check("ptrace", err)
+	os.Stdout.WriteString(strings.Join(results, " "))
+	os.Exit(0)
+}
+
+// runHelper runs the helper process with the environment set and returns
+// its output
+func runHelper(t *testing.T, env ...string) string {
+	dir := t.TempDir()
+	for _, sub := range []string{"read", "write"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"read/file", "other"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), append(env, helperEnv+"="+dir)...)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Helper process error: %v: %s", err, out)
+	}
+	if strings.HasPrefix(string(out), "unsupported: ") {
+		t.Skip(string(out))
+	}
+	return string(out)
+}
+
+func TestApplyLandlock(t *testing.T) {
+	want := "read=ok write=ok write-read=denied other=denied ptrace=ok"
+	if got := runHelper(t, "LANDLOCK=1"); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestApplySeccomp(t *testing.T) {
+	want := "read=ok write=ok write-read=ok other=ok ptrace=denied"
+	if got := runHelper(t, "SECCOMP=1"); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,33 @@
+package sandbox
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestEnabled(t *testing.T) {
+	if (Config{ReadPaths: []string{"/etc"}, SeccompAction: ActionKill}).Enabled() {
+		t.Error("Expected paths and actions alone not to enable confinement")
+	}
+	for _, config := range []Config{{Chroot: "/var/empty"}, {User: "nobody"}, {Landlock: true}, {Seccomp: true}} {
+		if !config.Enabled() {
+			t.Errorf("Expected %+v to be enabled", config)
+		}
+	}
+}
+
+func TestApplyDisabled(t *testing.T) {
+	if err := Apply(Config{}); err != nil {
+		t.Errorf("Apply() error without confinement: %v", err)
+	}
+}
+
+func TestApplyNotSupported(t *testing.T) {
+	if runtime.GOOS == "linux" {
+		t.Skip("confinement is supported on Linux")
+	}
+	if err := Apply(Config{Seccomp: true}); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Expected ErrNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build linux && amd64
+
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package sandbox
+
+import "golang.org/x/sys/unix"
+
+// auditArch identifies the architecture in the data of the filter
+const auditArch = unix.AUDIT_ARCH_X86_64
+
+// archSyscalls are the system calls of this architecture that others
+// replaced with newer ones
+var archSyscalls = []uintptr{
+	unix.SYS_ARCH_PRCTL, unix.SYS_NEWFSTATAT, unix.SYS_OPEN, unix.SYS_STAT, unix.SYS_LSTAT,
+	unix.SYS_ACCESS, unix.SYS_READLINK, unix.SYS_RENAME, unix.SYS_UNLINK,
+	unix.SYS_MKDIR, unix.SYS_PIPE, unix.SYS_DUP2, unix.SYS_POLL,
+	unix.SYS_SELECT, unix.SYS_EPOLL_WAIT, unix.SYS_EPOLL_CREATE,
+	unix.SYS_GETDENTS, unix.SYS_TIME,
+}
@@ -0,0 +1,30 @@
+//go:build linux && arm64
+
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package sandbox
+
+import "golang.org/x/sys/unix"
+
+// auditArch identifies the architecture in the data of the filter
+const auditArch = unix.AUDIT_ARCH_AARCH64
+
+// archSyscalls are the system calls named differently on this architecture
+var archSyscalls = []uintptr{unix.SYS_FSTATAT}
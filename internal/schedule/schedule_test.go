@@ -0,0 +1,62 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// Monday
+	now := time.Date(2024, 1, 1, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 8 * * mon", time.Date(2024, 1, 8, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2024, 1, 2, 10, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		// Day of month or day of week
+		{"0 0 15 * sat", time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{"5,10/20 12 * * *", time.Date(2024, 1, 1, 12, 5, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec, time.UTC)
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+		if next := s.Next(now); !next.Equal(tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.spec, tt.expected, next)
+		}
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip(err)
+	}
+	s, err := Parse("0 8 * * *", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := s.Next(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	if expected := time.Date(2024, 1, 2, 8, 0, 0, 0, loc); !next.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, next)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "x * * * *"} {
+		if _, err := Parse(spec, time.UTC); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
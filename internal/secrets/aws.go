@@ -0,0 +1,220 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AWSConfig contains settings of the AWS Secrets Manager provider
+type AWSConfig struct {
+	// Region of the secrets, such as "eu-central-1"
+	Region string
+	// Credentials of an IAM user or role
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Endpoint of the service, the regional endpoint if empty
+	Endpoint string
+}
+
+// AWSConfigFromEnv returns the settings of the AWS CLI environment
+// variables: AWS_REGION (or AWS_DEFAULT_REGION), AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and
+// AWS_ENDPOINT_URL_SECRETS_MANAGER (or AWS_ENDPOINT_URL)
+func AWSConfigFromEnv() AWSConfig {
+	config := AWSConfig{
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER"),
+	}
+	if config.Region == "" {
+		config.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	return config
+}
+
+// AWSSecretsManager reads secrets of AWS Secrets Manager. References are
+// secret names or ARNs, with the key of a secret holding a JSON object, such
+// as "prod/fakessh#abuseipdb_key".
+type AWSSecretsManager struct {
+	config AWSConfig
+	client *http.Client
+	now    func() time.Time
+
+	// Values of the secrets read, by ID
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+// NewAWSSecretsManager creates an AWS Secrets Manager provider
+func NewAWSSecretsManager(config AWSConfig) (*AWSSecretsManager, error) {
+	if config.Region == "" {
+		return nil, errors.New("no region, set AWS_REGION")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("no credentials, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://secretsmanager." + config.Region + ".amazonaws.com"
+	}
+	return &AWSSecretsManager{
+		config:  config,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		now:     time.Now,
+		secrets: make(map[string]string),
+	}, nil
+}
+
+// Secret returns a secret, or a key of a secret holding a JSON object
+func (a *AWSSecretsManager) Secret(ctx context.Context, ref string) (string, error) {
+	id, name := splitReference(ref)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	value, ok := a.secrets[id]
+	if !ok {
+		var err error
+		if value, err = a.read(ctx, id); err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", id, err)
+		}
+		a.secrets[id] = value
+	}
+	if name == "" {
+		return value, nil
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &values); err != nil {
+		return "", fmt.Errorf("%s: secret is not a JSON object", id)
+	}
+	value, err := field(values, name)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", id, err)
+	}
+	return value, nil
+}
+
+// read returns the current value of a secret
+func (a *AWSSecretsManager) read(ctx context.Context, id string) (string, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signV4(req, body, "secretsmanager", a.config, a.now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	var secret struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := decodeResponse(resp, &secret); err != nil {
+		return "", err
+	}
+	if secret.SecretString == nil {
+		return "", errors.New("secret has no string value")
+	}
+	return *secret.SecretString, nil
+}
+
+// signV4 signs a request with AWS Signature Version 4, covering its headers
+func signV4(req *http.Request, body []byte, service string, config AWSConfig, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", config.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := day + "/" + config.Region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+config.SecretAccessKey), day)
+	key = hmacSHA256(key, config.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with a key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,85 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	config := AWSConfig{
+		Region:          "us-east-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	signV4(req, nil, "service", config, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+}
+
+func TestAWSSecretsManagerSecret(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-central-1/secretsmanager/aws4_request") ||
+			r.Header.Get("X-Amz-Security-Token") != "session" {
+			http.Error(w, `{"__type":"UnrecognizedClientException"}`, http.StatusBadRequest)
+			return
+		}
+		var body struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&body)
+		switch body.SecretId {
+		case "prod/fakessh":
+			w.Write([]byte(`{"Name":"prod/fakessh","SecretString":"{\"abuseipdb_key\":\"a1\",\"hec_token\":\"h1\"}"}`))
+		case "prod/webhook":
+			w.Write([]byte(`{"Name":"prod/webhook","SecretString":"https://hooks.example.com/x"}`))
+		default:
+			http.Error(w, `{"__type":"ResourceNotFoundException"}`, http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	a, err := NewAWSSecretsManager(AWSConfig{
+		Region:          "eu-central-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "session",
+		Endpoint:        srv.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewAWSSecretsManager() error: %v", err)
+	}
+	ctx := context.Background()
+	for ref, want := range map[string]string{
+		"prod/fakessh#abuseipdb_key": "a1",
+		"prod/fakessh#hec_token":     "h1",
+		"prod/webhook":               "https://hooks.example.com/x",
+	} {
+		got, err := a.Secret(ctx, ref)
+		if err != nil {
+			t.Fatalf("Secret(%s) error: %v", ref, err)
+		}
+		if got != want {
+			t.Errorf("Secret(%s) = %q, want %q", ref, got, want)
+		}
+	}
+	if _, err := a.Secret(ctx, "prod/webhook#key"); err == nil {
+		t.Error("Expected an error for a key of a plain secret")
+	}
+	if _, err := a.Secret(ctx, "prod/missing"); err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Errorf("Expected the error of the service, got: %v", err)
+	}
+	if _, err := NewAWSSecretsManager(AWSConfig{Region: "eu-central-1"}); err == nil {
+		t.Error("Expected an error without credentials")
+	}
+}
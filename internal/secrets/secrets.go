@@ -0,0 +1,144 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package secrets resolves references to secrets kept in external stores,
+// such as "vault://secret/fakessh#api_key", so that they need not be written
+// into the configuration
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Provider fetches secrets from a store
+type Provider interface {
+	// Secret returns the secret named by a reference without its scheme,
+	// such as "secret/fakessh#api_key"
+	Secret(ctx context.Context, ref string) (string, error)
+}
+
+// providers create the provider of each reference scheme, configured
+// through the environment variables of the store
+var providers = map[string]func() (Provider, error){
+	"vault": func() (Provider, error) { return NewVault(VaultConfigFromEnv()) },
+	"awssm": func() (Provider, error) { return NewAWSSecretsManager(AWSConfigFromEnv()) },
+	"sops":  func() (Provider, error) { return NewSOPS(SOPSConfigFromEnv()) },
+}
+
+// IsReference reports whether a value is a secret reference
+func IsReference(value string) bool {
+	scheme, _, ok := strings.Cut(value, "://")
+	return ok && providers[scheme] != nil
+}
+
+// Resolver resolves secret references, creating the provider of a scheme on
+// its first reference. It is not safe for concurrent use.
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// NewResolver creates a resolver of secret references
+func NewResolver() *Resolver {
+	return &Resolver{providers: make(map[string]Provider)}
+}
+
+// Resolve returns the secret of a reference
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	newProvider := providers[scheme]
+	if !ok || newProvider == nil {
+		return "", fmt.Errorf("not a secret reference: %s", value)
+	}
+	p, ok := r.providers[scheme]
+	if !ok {
+		var err error
+		if p, err = newProvider(); err != nil {
+			return "", fmt.Errorf("%s: %w", scheme, err)
+		}
+		r.providers[scheme] = p
+	}
+	secret, err := p.Secret(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", scheme, err)
+	}
+	return secret, nil
+}
+
+// splitReference splits a reference into the secret and the field after
+// "#", which is empty if there is none
+func splitReference(ref string) (string, string) {
+	if i := strings.LastIndexByte(ref, '#'); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// field returns a field of a secret with several values, or its only value
+// if no field is named
+func field(values map[string]interface{}, name string) (string, error) {
+	if name == "" {
+		if len(values) != 1 {
+			return "", fmt.Errorf("secret has %d fields, name one after '#': %s", len(values), fieldNames(values))
+		}
+		for k := range values {
+			name = k
+		}
+	}
+	value, ok := values[name]
+	if !ok {
+		return "", fmt.Errorf("secret has no field '%s': %s", name, fieldNames(values))
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case nil, map[string]interface{}, []interface{}:
+		return "", fmt.Errorf("field '%s' is not a single value", name)
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// fieldNames lists the fields of a secret for errors, without their values
+func fieldNames(values map[string]interface{}) string {
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// decodeResponse decodes the JSON body of a successful response into v
+func decodeResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// mockProvider returns the secrets of a map and counts the providers created
+type mockProvider map[string]string
+
+func (m mockProvider) Secret(ctx context.Context, ref string) (string, error) {
+	if secret, ok := m[ref]; ok {
+		return secret, nil
+	}
+	return "", errors.New("no such secret")
+}
+
+func TestResolver(t *testing.T) {
+	created := 0
+	providers["mock"] = func() (Provider, error) {
+		created++
+		return mockProvider{"fakessh#token": "s3cret"}, nil
+	}
+	defer delete(providers, "mock")
+
+	if !IsReference("mock://fakessh#token") || IsReference("https://example.com") || IsReference("mock:token") {
+		t.Errorf("Unexpected IsReference results")
+	}
+
+	r := NewResolver()
+	for i := 0; i < 2; i++ {
+		secret, err := r.Resolve(context.Background(), "mock://fakessh#token")
+		if err != nil {
+			t.Fatalf("Resolve() error: %v", err)
+		}
+		if secret != "s3cret" {
+			t.Errorf("Expected s3cret, got %q", secret)
+		}
+	}
+	if created != 1 {
+		t.Errorf("Expected the provider to be created once, got %d", created)
+	}
+
+	if _, err := r.Resolve(context.Background(), "mock://fakessh#other"); err == nil || !strings.HasPrefix(err.Error(), "mock: ") {
+		t.Errorf("Expected an error naming the scheme, got: %v", err)
+	}
+	if _, err := r.Resolve(context.Background(), "https://example.com"); err == nil {
+		t.Error("Expected an error for a URL")
+	}
+}
+
+func TestField(t *testing.T) {
+	values := map[string]interface{}{"user": "admin", "port": float64(8200), "nested": map[string]interface{}{}}
+	if v, err := field(values, "user"); err != nil || v != "admin" {
+		t.Errorf("field(user) = %q, %v", v, err)
+	}
+	if v, err := field(values, "port"); err != nil || v != "8200" {
+		t.Errorf("field(port) = %q, %v", v, err)
+	}
+	if _, err := field(values, "nested"); err == nil {
+		t.Error("Expected an error for a nested value")
+	}
+	if _, err := field(values, ""); err == nil || !strings.Contains(err.Error(), "nested, port, user") {
+		t.Errorf("Expected an error listing the fields, got: %v", err)
+	}
+	if v, err := field(map[string]interface{}{"key": "value"}, ""); err != nil || v != "value" {
+		t.Errorf("Expected the only field, got %q, %v", v, err)
+	}
+}
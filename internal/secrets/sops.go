@@ -0,0 +1,226 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+// SOPSConfig contains settings of the SOPS provider
+type SOPSConfig struct {
+	// age identities (AGE-SECRET-KEY-1...) decrypting the data keys of files,
+	// one per line
+	AgeKeys string
+}
+
+// SOPSConfigFromEnv returns the settings of the SOPS environment variables:
+// the identities of SOPS_AGE_KEY, or of the SOPS_AGE_KEY_FILE file, by
+// default sops/age/keys.txt in the user configuration directory
+func SOPSConfigFromEnv() SOPSConfig {
+	if keys := os.Getenv("SOPS_AGE_KEY"); keys != "" {
+		return SOPSConfig{AgeKeys: keys}
+	}
+	path := os.Getenv("SOPS_AGE_KEY_FILE")
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return SOPSConfig{}
+		}
+		path = filepath.Join(dir, "sops", "age", "keys.txt")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SOPSConfig{}
+	}
+	return SOPSConfig{AgeKeys: string(data)}
+}
+
+// SOPS reads values of YAML or JSON files encrypted by SOPS with age keys.
+// References are the path of a file and the dotted key of a value, such as
+// "/etc/fakessh/secrets.enc.yaml#alerts.slack_webhook".
+//
+// Values are authenticated one by one with their keys; the message
+// authentication code of the whole file is not checked.
+type SOPS struct {
+	identities []age.Identity
+
+	// Decrypted documents and their data keys, by path
+	mu    sync.Mutex
+	files map[string]*sopsFile
+}
+
+// sopsFile is a document encrypted by SOPS with its data key
+type sopsFile struct {
+	tree    map[string]interface{}
+	dataKey []byte
+}
+
+// sopsValue matches the values encrypted by SOPS
+var sopsValue = regexp.MustCompile(`^ENC\[AES256_GCM,data:([^,]*),iv:([^,]+),tag:([^,]+),type:([a-z]+)\]$`)
+
+// NewSOPS creates a SOPS provider
+func NewSOPS(config SOPSConfig) (*SOPS, error) {
+	if strings.TrimSpace(config.AgeKeys) == "" {
+		return nil, errors.New("no age key, set SOPS_AGE_KEY or SOPS_AGE_KEY_FILE")
+	}
+	identities, err := age.ParseIdentities(strings.NewReader(config.AgeKeys))
+	if err != nil {
+		return nil, fmt.Errorf("invalid age key: %w", err)
+	}
+	return &SOPS{identities: identities, files: make(map[string]*sopsFile)}, nil
+}
+
+// Secret returns the decrypted value of a key of a file
+func (s *SOPS) Secret(ctx context.Context, ref string) (string, error) {
+	path, key := splitReference(ref)
+	if key == "" {
+		return "", fmt.Errorf("%s: name the key of the value after '#'", path)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[path]
+	if !ok {
+		var err error
+		if f, err = s.open(path); err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		s.files[path] = f
+	}
+	value, err := f.value(strings.Split(key, "."))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return value, nil
+}
+
+// open reads a file and decrypts its data key
+func (s *SOPS) open(path string) (*sopsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	var metadata struct {
+		Age []struct {
+			Recipient string `yaml:"recipient"`
+			Enc       string `yaml:"enc"`
+		} `yaml:"age"`
+	}
+	if raw, ok := tree["sops"]; ok {
+		// Decode the metadata through YAML, which JSON documents are as well
+		encoded, err := yaml.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(encoded, &metadata); err != nil {
+			return nil, fmt.Errorf("invalid SOPS metadata: %w", err)
+		}
+	} else {
+		return nil, errors.New("not encrypted by SOPS")
+	}
+	if len(metadata.Age) == 0 {
+		return nil, errors.New("no age recipients, only age keys are supported")
+	}
+
+	for _, recipient := range metadata.Age {
+		r, err := age.Decrypt(armor.NewReader(strings.NewReader(recipient.Enc)), s.identities...)
+		if err != nil {
+			continue
+		}
+		dataKey, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+		}
+		return &sopsFile{tree: tree, dataKey: dataKey}, nil
+	}
+	return nil, errors.New("no age key matches the recipients of the file")
+}
+
+// value decrypts the value at a key path
+func (f *sopsFile) value(keys []string) (string, error) {
+	if keys[0] == "sops" {
+		return "", errors.New("the sops key holds the metadata of the file")
+	}
+	var node interface{} = f.tree
+	for i, key := range keys {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("no key %s", strings.Join(keys[:i+1], "."))
+		}
+		if node, ok = m[key]; !ok {
+			return "", fmt.Errorf("no key %s", strings.Join(keys[:i+1], "."))
+		}
+	}
+	encrypted, ok := node.(string)
+	if !ok {
+		if _, nested := node.(map[string]interface{}); nested {
+			return "", fmt.Errorf("key %s is not a single value", strings.Join(keys, "."))
+		}
+		// Unencrypted values keep their type
+		return fmt.Sprint(node), nil
+	}
+	match := sopsValue.FindStringSubmatch(encrypted)
+	if match == nil {
+		// Values of keys with the unencrypted suffix are kept as is
+		return encrypted, nil
+	}
+
+	var parts [3][]byte
+	for i := range parts {
+		var err error
+		if parts[i], err = base64.StdEncoding.DecodeString(match[i+1]); err != nil {
+			return "", fmt.Errorf("invalid encrypted value of %s: %w", strings.Join(keys, "."), err)
+		}
+	}
+	ciphertext, iv, tag := parts[0], parts[1], parts[2]
+	block, err := aes.NewCipher(f.dataKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid data key: %w", err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return "", err
+	}
+	// The keys leading to a value authenticate it
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(strings.Join(keys, ":")+":"))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", strings.Join(keys, "."), err)
+	}
+	return string(plaintext), nil
+}
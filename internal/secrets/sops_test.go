@@ -0,0 +1,111 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// sopsEncrypt encrypts a value as SOPS does, authenticated by its keys
+func sopsEncrypt(t *testing.T, dataKey []byte, value string, keys ...string) string {
+	t.Helper()
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, 32)
+	rand.Read(iv)
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := gcm.Seal(nil, iv, []byte(value), []byte(strings.Join(keys, ":")+":"))
+	data, tag := sealed[:len(value)], sealed[len(value):]
+	enc := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:str]", enc(data), enc(iv), enc(tag))
+}
+
+func TestSOPSSecret(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey := make([]byte, 32)
+	rand.Read(dataKey)
+	var encKey bytes.Buffer
+	a := armor.NewWriter(&encKey)
+	w, err := age.Encrypt(a, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(dataKey)
+	w.Close()
+	a.Close()
+
+	content := fmt.Sprintf(`alerts:
+  slack_webhook: %s
+  swapped: %s
+api_key: %s
+port_unencrypted: 8200
+sops:
+  age:
+    - recipient: %s
+      enc: |
+%s
+  version: 3.9.0
+`,
+		sopsEncrypt(t, dataKey, "https://hooks.slack.com/services/T0/B0/x", "alerts", "slack_webhook"),
+		sopsEncrypt(t, dataKey, "moved", "api_key"),
+		sopsEncrypt(t, dataKey, "k3y", "api_key"),
+		identity.Recipient(),
+		"        "+strings.ReplaceAll(strings.TrimSpace(encKey.String()), "\n", "\n        "))
+	path := filepath.Join(t.TempDir(), "secrets.enc.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSOPS(SOPSConfig{AgeKeys: "# created: 2024-05-01\n" + identity.String() + "\n"})
+	if err != nil {
+		t.Fatalf("NewSOPS() error: %v", err)
+	}
+	ctx := context.Background()
+	for key, want := range map[string]string{
+		"alerts.slack_webhook": "https://hooks.slack.com/services/T0/B0/x",
+		"api_key":              "k3y",
+		"port_unencrypted":     "8200",
+	} {
+		got, err := s.Secret(ctx, path+"#"+key)
+		if err != nil {
+			t.Fatalf("Secret(%s) error: %v", key, err)
+		}
+		if got != want {
+			t.Errorf("Secret(%s) = %q, want %q", key, got, want)
+		}
+	}
+
+	for _, key := range []string{"alerts.swapped", "alerts.missing", "alerts", "sops.version", ""} {
+		if _, err := s.Secret(ctx, path+"#"+key); err == nil {
+			t.Errorf("Expected an error for key %q", key)
+		}
+	}
+
+	other, _ := age.GenerateX25519Identity()
+	s, err = NewSOPS(SOPSConfig{AgeKeys: other.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Secret(ctx, path+"#api_key"); err == nil {
+		t.Error("Expected an error without a matching age key")
+	}
+}
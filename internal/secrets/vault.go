@@ -0,0 +1,166 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package secrets
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultConfig contains settings of the HashiCorp Vault provider
+type VaultConfig struct {
+	// Address of the server, such as "https://vault.example.com:8200"
+	Address string
+	// Token authenticating the requests
+	Token string
+	// Namespace of the secrets (Vault Enterprise), none if empty
+	Namespace string
+	// CA certificates (PEM) of the server certificate, the system roots if
+	// empty
+	CACert string
+}
+
+// VaultConfigFromEnv returns the settings of the Vault CLI environment
+// variables: VAULT_ADDR, VAULT_TOKEN (or the ~/.vault-token file of
+// "vault login"), VAULT_NAMESPACE and VAULT_CACERT
+func VaultConfigFromEnv() VaultConfig {
+	config := VaultConfig{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		CACert:    os.Getenv("VAULT_CACERT"),
+	}
+	if config.Address == "" {
+		config.Address = "https://127.0.0.1:8200"
+	}
+	if config.Token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				config.Token = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	return config
+}
+
+// Vault reads secrets of the KV secrets engine, version 1 or 2. References
+// are the API paths of secrets with a field, such as
+// "secret/data/fakessh#api_key" for a KV version 2 engine mounted at secret.
+type Vault struct {
+	config VaultConfig
+	client *http.Client
+
+	// Fields of the secrets read, by path
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+}
+
+// NewVault creates a Vault provider
+func NewVault(config VaultConfig) (*Vault, error) {
+	if config.Token == "" {
+		return nil, errors.New("no token, set VAULT_TOKEN")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.CACert != "" {
+		data, err := os.ReadFile(config.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no CA certificates in %s", config.CACert)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &Vault{
+		config:  config,
+		client:  &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		secrets: make(map[string]map[string]interface{}),
+	}, nil
+}
+
+// Secret returns a field of a secret
+func (v *Vault) Secret(ctx context.Context, ref string) (string, error) {
+	path, name := splitReference(ref)
+	path = strings.Trim(path, "/")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	values, ok := v.secrets[path]
+	if !ok {
+		var err error
+		if values, err = v.read(ctx, path); err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		v.secrets[path] = values
+	}
+	value, err := field(values, name)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return value, nil
+}
+
+// read returns the fields of the secret at a path
+func (v *Vault) read(ctx context.Context, path string) (map[string]interface{}, error) {
+	endpoint, err := url.JoinPath(v.config.Address, "v1", path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.config.Token)
+	if v.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := decodeResponse(resp, &body); err != nil {
+		return nil, err
+	}
+
+	// KV version 2 nests the fields next to the metadata of the version
+	if data, ok := body.Data["data"].(map[string]interface{}); ok {
+		if _, ok := body.Data["metadata"]; ok {
+			return data, nil
+		}
+	}
+	if body.Data == nil {
+		return nil, errors.New("secret has no data")
+	}
+	return body.Data, nil
+}
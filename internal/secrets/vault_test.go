@@ -0,0 +1,60 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVaultSecret(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("X-Vault-Token") != "hvs.test" || r.Header.Get("X-Vault-Namespace") != "ops" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/fakessh":
+			w.Write([]byte(`{"data":{"data":{"api_key":"k2","hec_token":"t2"},"metadata":{"version":3}}}`))
+		case "/v1/kv/fakessh":
+			w.Write([]byte(`{"data":{"api_key":"k1"}}`))
+		default:
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	v, err := NewVault(VaultConfig{Address: srv.URL, Token: "hvs.test", Namespace: "ops"})
+	if err != nil {
+		t.Fatalf("NewVault() error: %v", err)
+	}
+	ctx := context.Background()
+	for ref, want := range map[string]string{
+		"secret/data/fakessh#api_key":   "k2",
+		"secret/data/fakessh#hec_token": "t2",
+		"kv/fakessh":                    "k1",
+	} {
+		got, err := v.Secret(ctx, ref)
+		if err != nil {
+			t.Fatalf("Secret(%s) error: %v", ref, err)
+		}
+		if got != want {
+			t.Errorf("Secret(%s) = %q, want %q", ref, got, want)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("Expected a request per secret, got %d", requests)
+	}
+
+	if _, err := v.Secret(ctx, "secret/data/missing#key"); err == nil {
+		t.Error("Expected an error for a missing secret")
+	}
+	if _, err := v.Secret(ctx, "secret/data/fakessh#password"); err == nil {
+		t.Error("Expected an error for a missing field")
+	}
+	if _, err := NewVault(VaultConfig{Address: srv.URL}); err == nil {
+		t.Error("Expected an error without a token")
+	}
+}
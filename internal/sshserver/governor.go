@@ -0,0 +1,326 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package sshserver
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/config"
+)
+
+// defaultTarpitDelay is the time an attempt is held in the tarpit if no
+// delay is configured
+const defaultTarpitDelay = 30 * time.Second
+
+// Default bounds of the random delay before an attempt is rejected
+const (
+	defaultDelayMin = 200 * time.Millisecond
+	defaultDelayMax = 500 * time.Millisecond
+)
+
+// Governor decides how connections are handled by their source: denied
+// sources are disconnected before the handshake, and while the tarpit is
+// enabled every authentication attempt is held for the tarpit delay instead
+// of the usual random delay. The collector may add sources to deny or hold
+// in the tarpit, in lists kept apart from the local denylist. Allowed
+// sources are never denied nor held in the tarpit. It is safe for
+// concurrent use and changed at runtime by the admin API.
+type Governor struct {
+	NopHooks
+
+	mu          sync.RWMutex
+	denylist    prefixSet
+	allowlist   prefixSet
+	fleetDeny   prefixSet
+	fleetTarpit prefixSet
+	tarpit      bool
+	tarpitDelay time.Duration
+	delayMin    time.Duration
+	delayMax    time.Duration
+	rand        Rand
+}
+
+// NewGovernor creates a governor from the access settings
+func NewGovernor(access config.AccessConfig) (*Governor, error) {
+	denylist, err := newPrefixSet(access.Denylist)
+	if err != nil {
+		return nil, err
+	}
+	allowlist, err := newPrefixSet(access.Allowlist)
+	if err != nil {
+		return nil, err
+	}
+	g := &Governor{
+		denylist:    denylist,
+		allowlist:   allowlist,
+		tarpit:      access.Tarpit,
+		tarpitDelay: access.TarpitDelay,
+		delayMin:    defaultDelayMin,
+		delayMax:    defaultDelayMax,
+		rand:        globalRand{},
+	}
+	if g.tarpitDelay <= 0 {
+		g.tarpitDelay = defaultTarpitDelay
+	}
+	if access.DelayMin != 0 || access.DelayMax != 0 {
+		if err := g.SetDelay(access.DelayMin, access.DelayMax); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// ParsePrefix parses an address or a CIDR range, an address being the
+// range of itself
+func ParsePrefix(entry string) (netip.Prefix, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR range '%s': %w", entry, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address '%s': %w", entry, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Deny adds an address or CIDR range to the denylist and returns it in
+// canonical form
+func (g *Governor) Deny(entry string) (netip.Prefix, error) {
+	prefix, err := ParsePrefix(entry)
+	if err != nil {
+		return prefix, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.denylist[prefix] = struct{}{}
+	return prefix, nil
+}
+
+// Undeny removes an entry from the denylist, reporting whether it was listed
+func (g *Governor) Undeny(entry string) (bool, error) {
+	prefix, err := ParsePrefix(entry)
+	if err != nil {
+		return false, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.denylist[prefix]
+	delete(g.denylist, prefix)
+	return ok, nil
+}
+
+// SetDenylist replaces the denylist. On an invalid entry the denylist is
+// left unchanged.
+func (g *Governor) SetDenylist(entries []string) error {
+	denylist, err := newPrefixSet(entries)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.denylist = denylist
+	return nil
+}
+
+// Denylist returns the entries of the denylist, sorted
+func (g *Governor) Denylist() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.denylist.sorted()
+}
+
+// SetAllowlist replaces the allowlist. On an invalid entry the allowlist is
+// left unchanged.
+func (g *Governor) SetAllowlist(entries []string) error {
+	allowlist, err := newPrefixSet(entries)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.allowlist = allowlist
+	return nil
+}
+
+// Allowlist returns the entries of the allowlist, sorted
+func (g *Governor) Allowlist() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.allowlist.sorted()
+}
+
+// SetFleet replaces the sources denied and held in the tarpit by the
+// collector. On an invalid entry the lists are left unchanged.
+func (g *Governor) SetFleet(denylist, tarpit []string) error {
+	deny, err := newPrefixSet(denylist)
+	if err != nil {
+		return err
+	}
+	hold, err := newPrefixSet(tarpit)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.fleetDeny, g.fleetTarpit = deny, hold
+	return nil
+}
+
+// Fleet returns the sources denied and held in the tarpit by the
+// collector, sorted
+func (g *Governor) Fleet() (denylist, tarpit []string) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.fleetDeny.sorted(), g.fleetTarpit.sorted()
+}
+
+// Denied reports whether connections from the remote address are denied
+func (g *Governor) Denied(remoteAddr net.Addr) bool {
+	addr, ok := remoteIP(remoteAddr)
+	if !ok {
+		return false
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return !g.allowlist.contains(addr) && (g.denylist.contains(addr) || g.fleetDeny.contains(addr))
+}
+
+// SetTarpit enables or disables the tarpit
+func (g *Governor) SetTarpit(enabled bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.tarpit = enabled
+}
+
+// Tarpit reports whether the tarpit is enabled, and its delay
+func (g *Governor) Tarpit() (bool, time.Duration) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.tarpit, g.tarpitDelay
+}
+
+// SetDelay sets the bounds of the random delay before an attempt is rejected
+func (g *Governor) SetDelay(min, max time.Duration) error {
+	if min < 0 || max < min {
+		return fmt.Errorf("invalid delay range %s-%s", min, max)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.delayMin, g.delayMax = min, max
+	return nil
+}
+
+// Delay returns the bounds of the random delay before an attempt is rejected
+func (g *Governor) Delay() (time.Duration, time.Duration) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.delayMin, g.delayMax
+}
+
+// OnConnection refuses the denied sources. The governor comes first in the
+// hooks of its server.
+func (g *Governor) OnConnection(addr net.Addr) error {
+	if g.Denied(addr) {
+		return errDenied
+	}
+	return nil
+}
+
+// AttemptDelay returns how long an attempt from the remote address is held
+// before it is rejected
+func (g *Governor) AttemptDelay(remoteAddr net.Addr) time.Duration {
+	addr, ok := remoteIP(remoteAddr)
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	allowed := ok && g.allowlist.contains(addr)
+	if !allowed && (g.tarpit || (ok && g.fleetTarpit.contains(addr))) {
+		return g.tarpitDelay
+	}
+	delay := g.delayMin
+	if spread := g.delayMax - g.delayMin; spread > 0 {
+		delay += time.Duration(g.rand.Int63n(int64(spread) + 1))
+	}
+	return delay
+}
+
+// remoteIP returns the IP address of a remote address
+func remoteIP(remoteAddr net.Addr) (netip.Addr, bool) {
+	addrPort, err := netip.ParseAddrPort(remoteAddr.String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addrPort.Addr().Unmap(), true
+}
+
+// prefixSet is a set of addresses and CIDR ranges
+type prefixSet map[netip.Prefix]struct{}
+
+func newPrefixSet(entries []string) (prefixSet, error) {
+	set := make(prefixSet, len(entries))
+	for _, entry := range entries {
+		prefix, err := ParsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		set[prefix] = struct{}{}
+	}
+	return set, nil
+}
+
+// contains reports whether an entry of the set contains the address
+func (s prefixSet) contains(addr netip.Addr) bool {
+	for p := range s {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sorted returns the entries of the set in canonical form, sorted
+func (s prefixSet) sorted() []string {
+	prefixes := make([]netip.Prefix, 0, len(s))
+	for p := range s {
+		prefixes = append(prefixes, p)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		if c := prefixes[i].Addr().Compare(prefixes[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return prefixes[i].Bits() < prefixes[j].Bits()
+	})
+	entries := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		entries[i] = p.String()
+	}
+	return entries
+}
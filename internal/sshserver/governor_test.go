@@ -0,0 +1,192 @@
+package sshserver
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/config"
+)
+
+func TestGovernorDenylist(t *testing.T) {
+	g, err := NewGovernor(config.AccessConfig{Denylist: []string{"192.0.2.7", "198.51.100.0/24"}})
+	if err != nil {
+		t.Fatalf("NewGovernor() error: %v", err)
+	}
+
+	tests := []struct {
+		addr   string
+		denied bool
+	}{
+		{"192.0.2.7:4000", true},
+		{"192.0.2.8:4000", false},
+		{"198.51.100.200:22", true},
+		{"[::ffff:192.0.2.7]:4000", true},
+		{"[2001:db8::1]:4000", false},
+	}
+	for _, tt := range tests {
+		if denied := g.Denied(mockAddr(tt.addr)); denied != tt.denied {
+			t.Errorf("Denied(%s) = %v, expected %v", tt.addr, denied, tt.denied)
+		}
+	}
+
+	if p, err := g.Deny("2001:db8::/32"); err != nil || p.String() != "2001:db8::/32" {
+		t.Errorf("Deny() = %v, %v", p, err)
+	}
+	if !g.Denied(&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4000}) {
+		t.Errorf("Expected the added range to be denied")
+	}
+	if _, err := g.Deny("not-an-address"); err == nil {
+		t.Errorf("Expected an error for an invalid entry")
+	}
+
+	if ok, err := g.Undeny("192.0.2.7"); !ok || err != nil {
+		t.Errorf("Undeny() = %v, %v", ok, err)
+	}
+	if ok, _ := g.Undeny("192.0.2.7"); ok {
+		t.Errorf("Expected a removed entry not to be listed")
+	}
+	expected := []string{"198.51.100.0/24", "2001:db8::/32"}
+	if list := g.Denylist(); !reflect.DeepEqual(list, expected) {
+		t.Errorf("Denylist() = %v, expected %v", list, expected)
+	}
+
+	if _, err := NewGovernor(config.AccessConfig{Denylist: []string{"192.0.2.0/33"}}); err == nil {
+		t.Errorf("Expected an error for an invalid range")
+	}
+}
+
+func TestGovernorTarpit(t *testing.T) {
+	g, err := NewGovernor(config.AccessConfig{})
+	if err != nil {
+		t.Fatalf("NewGovernor() error: %v", err)
+	}
+	if enabled, delay := g.Tarpit(); enabled || delay != defaultTarpitDelay {
+		t.Errorf("Tarpit() = %v, %s", enabled, delay)
+	}
+	g.SetTarpit(true)
+	if enabled, _ := g.Tarpit(); !enabled {
+		t.Errorf("Expected the tarpit to be enabled")
+	}
+
+	g, _ = NewGovernor(config.AccessConfig{Tarpit: true, TarpitDelay: time.Minute})
+	if enabled, delay := g.Tarpit(); !enabled || delay != time.Minute {
+		t.Errorf("Tarpit() = %v, %s", enabled, delay)
+	}
+}
+
+func TestGovernorAllowlist(t *testing.T) {
+	g, err := NewGovernor(config.AccessConfig{
+		Denylist:    []string{"192.0.2.0/24"},
+		Allowlist:   []string{"192.0.2.7"},
+		Tarpit:      true,
+		TarpitDelay: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewGovernor() error: %v", err)
+	}
+
+	allowed, other := mockAddr("192.0.2.7:4000"), mockAddr("192.0.2.8:4000")
+	if g.Denied(allowed) {
+		t.Errorf("Expected an allowed address not to be denied")
+	}
+	if !g.Denied(other) {
+		t.Errorf("Expected the rest of the range to be denied")
+	}
+	if delay := g.AttemptDelay(allowed); delay >= time.Minute {
+		t.Errorf("Expected an allowed address not to be held in the tarpit, got %s", delay)
+	}
+	if delay := g.AttemptDelay(other); delay != time.Minute {
+		t.Errorf("AttemptDelay() = %s, expected the tarpit delay", delay)
+	}
+
+	if err := g.SetAllowlist([]string{"192.0.2.8", "bad"}); err == nil {
+		t.Errorf("Expected an error for an invalid entry")
+	}
+	if list := g.Allowlist(); !reflect.DeepEqual(list, []string{"192.0.2.7/32"}) {
+		t.Errorf("An invalid allowlist should not change it, got %v", list)
+	}
+	if err := g.SetAllowlist(nil); err != nil {
+		t.Fatalf("SetAllowlist() error: %v", err)
+	}
+	if !g.Denied(allowed) {
+		t.Errorf("Expected the address to be denied without the allowlist")
+	}
+	if err := g.SetDenylist([]string{"198.51.100.0/24"}); err != nil {
+		t.Fatalf("SetDenylist() error: %v", err)
+	}
+	if g.Denied(allowed) {
+		t.Errorf("Expected the replaced denylist not to deny the address")
+	}
+}
+
+func TestGovernorFleet(t *testing.T) {
+	g, err := NewGovernor(config.AccessConfig{
+		Denylist:    []string{"192.0.2.1"},
+		Allowlist:   []string{"192.0.2.9"},
+		TarpitDelay: time.Minute,
+		DelayMax:    time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewGovernor() error: %v", err)
+	}
+
+	if err := g.SetFleet([]string{"192.0.2.7", "192.0.2.9"}, []string{"198.51.100.0/24"}); err != nil {
+		t.Fatalf("SetFleet() error: %v", err)
+	}
+	if !g.Denied(mockAddr("192.0.2.7:4000")) || !g.Denied(mockAddr("192.0.2.1:4000")) {
+		t.Errorf("Expected the fleet and local denylists to be denied")
+	}
+	if g.Denied(mockAddr("192.0.2.9:4000")) {
+		t.Errorf("Expected the allowlist to override the fleet denylist")
+	}
+	if delay := g.AttemptDelay(mockAddr("198.51.100.3:4000")); delay != time.Minute {
+		t.Errorf("AttemptDelay() = %s, expected the tarpit delay for the fleet tarpit", delay)
+	}
+	if delay := g.AttemptDelay(mockAddr("203.0.113.1:4000")); delay > time.Second {
+		t.Errorf("AttemptDelay() = %s, expected the usual delay", delay)
+	}
+	if list := g.Denylist(); !reflect.DeepEqual(list, []string{"192.0.2.1/32"}) {
+		t.Errorf("Expected the local denylist to be kept apart, got %v", list)
+	}
+
+	if err := g.SetFleet([]string{"bad"}, nil); err == nil {
+		t.Errorf("Expected an error for an invalid entry")
+	}
+	deny, tarpit := g.Fleet()
+	if !reflect.DeepEqual(deny, []string{"192.0.2.7/32", "192.0.2.9/32"}) || !reflect.DeepEqual(tarpit, []string{"198.51.100.0/24"}) {
+		t.Errorf("An invalid list should not change the fleet lists, got %v %v", deny, tarpit)
+	}
+	if err := g.SetFleet(nil, nil); err != nil {
+		t.Fatalf("SetFleet() error: %v", err)
+	}
+	if g.Denied(mockAddr("192.0.2.7:4000")) {
+		t.Errorf("Expected the cleared fleet denylist not to deny the address")
+	}
+}
+
+func TestGovernorDelay(t *testing.T) {
+	g, err := NewGovernor(config.AccessConfig{})
+	if err != nil {
+		t.Fatalf("NewGovernor() error: %v", err)
+	}
+	if min, max := g.Delay(); min != defaultDelayMin || max != defaultDelayMax {
+		t.Errorf("Delay() = %s, %s", min, max)
+	}
+
+	if err := g.SetDelay(time.Second, 2*time.Second); err != nil {
+		t.Fatalf("SetDelay() error: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if delay := g.AttemptDelay(mockAddr("192.0.2.1:4000")); delay < time.Second || delay > 2*time.Second {
+			t.Fatalf("AttemptDelay() = %s, expected 1s-2s", delay)
+		}
+	}
+	if err := g.SetDelay(time.Second, time.Millisecond); err == nil {
+		t.Errorf("Expected an error for an inverted range")
+	}
+	if _, err := NewGovernor(config.AccessConfig{DelayMin: -time.Second}); err == nil {
+		t.Errorf("Expected an error for a negative delay")
+	}
+}
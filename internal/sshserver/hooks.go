@@ -0,0 +1,119 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package sshserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+)
+
+// errDenied disconnects the sources of the denylists
+var errDenied = errors.New("source denied")
+
+// Hooks are called around connections and authentication attempts, for the
+// features deciding how they are handled, such as the governor. Hooks are
+// called from the goroutines of several connections at once.
+type Hooks interface {
+	// OnConnection is called for an accepted connection before the
+	// handshake. An error disconnects the client without events.
+	OnConnection(addr net.Addr) error
+	// BeforeAuth is called for an authentication attempt before it is
+	// logged, and may change its credentials. An error rejects the attempt
+	// at once without logging it.
+	BeforeAuth(ctx context.Context, attempt *Attempt) error
+	// AfterAuth is called once the attempt is logged, and may change the
+	// delay before it is rejected
+	AfterAuth(ctx context.Context, attempt *Attempt)
+	// OnDisconnect is called when a connection that was not refused by
+	// OnConnection ends, or at once with a zero duration when a later hook
+	// refuses it
+	OnDisconnect(addr net.Addr, duration time.Duration)
+}
+
+// Attempt is an authentication attempt passed to the hooks
+type Attempt struct {
+	// Address of the client
+	Addr net.Addr
+	// Credentials and client version, as logged
+	Credentials logger.CredentialAttempt
+	// Time the attempt is held before it is rejected, the random delay or
+	// the tarpit delay of the governor unless set by WithDelayFunc
+	Delay time.Duration
+}
+
+// NopHooks does nothing, for hooks to embed when they implement only some
+// of the calls
+type NopHooks struct{}
+
+// OnConnection accepts the connection
+func (NopHooks) OnConnection(addr net.Addr) error { return nil }
+
+// BeforeAuth accepts the attempt
+func (NopHooks) BeforeAuth(ctx context.Context, attempt *Attempt) error { return nil }
+
+// AfterAuth does nothing
+func (NopHooks) AfterAuth(ctx context.Context, attempt *Attempt) {}
+
+// OnDisconnect does nothing
+func (NopHooks) OnDisconnect(addr net.Addr, duration time.Duration) {}
+
+// hookChain calls hooks in the order they were added, stopping at the first
+// error
+type hookChain []Hooks
+
+// OnConnection calls the hooks until one refuses the connection, then calls
+// OnDisconnect on those that accepted it, in reverse order, so that they can
+// release what they acquired
+func (c hookChain) OnConnection(addr net.Addr) error {
+	for i, h := range c {
+		if err := h.OnConnection(addr); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				c[j].OnDisconnect(addr, 0)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (c hookChain) BeforeAuth(ctx context.Context, attempt *Attempt) error {
+	for _, h := range c {
+		if err := h.BeforeAuth(ctx, attempt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c hookChain) AfterAuth(ctx context.Context, attempt *Attempt) {
+	for _, h := range c {
+		h.AfterAuth(ctx, attempt)
+	}
+}
+
+func (c hookChain) OnDisconnect(addr net.Addr, duration time.Duration) {
+	for _, h := range c {
+		h.OnDisconnect(addr, duration)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package sshserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	cryptoRand "crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Host key types of GenerateHostKey
+const (
+	KeyTypeRSA     = "rsa"
+	KeyTypeECDSA   = "ecdsa"
+	KeyTypeEd25519 = "ed25519"
+)
+
+// DefaultKeyBits returns the size of keys of a type generated when none is
+// given, as ssh-keygen does
+func DefaultKeyBits(keyType string) int {
+	switch keyType {
+	case KeyTypeRSA:
+		return 3072
+	case KeyTypeECDSA, KeyTypeEd25519:
+		return 256
+	}
+	return 0
+}
+
+// GenerateHostKey generates a host key of a type and size in bits, returning
+// it in the OpenSSH private key format with the comment
+func GenerateHostKey(keyType string, bits int, comment string) ([]byte, error) {
+	var key crypto.PrivateKey
+	var err error
+	switch keyType {
+	case KeyTypeRSA:
+		if bits < 2048 || bits > 16384 {
+			return nil, fmt.Errorf("invalid RSA key size %d: must be between 2048 and 16384 bits", bits)
+		}
+		key, err = rsa.GenerateKey(cryptoRand.Reader, bits)
+	case KeyTypeECDSA:
+		var curve elliptic.Curve
+		switch bits {
+		case 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("invalid ECDSA key size %d: must be 256, 384 or 521 bits", bits)
+		}
+		key, err = ecdsa.GenerateKey(curve, cryptoRand.Reader)
+	case KeyTypeEd25519:
+		if bits != 256 {
+			return nil, fmt.Errorf("invalid Ed25519 key size %d: must be 256 bits", bits)
+		}
+		_, key, err = ed25519.GenerateKey(cryptoRand.Reader)
+	default:
+		return nil, fmt.Errorf("invalid key type '%s': must be rsa, ecdsa or ed25519", keyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", keyType, err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, comment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// BuiltinHostKey returns the host key used without a key file or key
+// generation, which is the same in every installation
+func BuiltinHostKey() (ssh.Signer, error) {
+	return ssh.ParsePrivateKey([]byte(defaultHostKey))
+}
+
+// KeyBits returns the size of a public key in bits, or 0 for unknown types
+func KeyBits(key ssh.PublicKey) int {
+	cryptoKey, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	switch k := cryptoKey.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package sshserver
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGenerateHostKey(t *testing.T) {
+	tests := []struct {
+		keyType string
+		bits    int
+		algo    string
+	}{
+		{KeyTypeRSA, 2048, ssh.KeyAlgoRSA},
+		{KeyTypeECDSA, 384, ssh.KeyAlgoECDSA384},
+		{KeyTypeEd25519, 256, ssh.KeyAlgoED25519},
+	}
+	for _, tt := range tests {
+		data, err := GenerateHostKey(tt.keyType, tt.bits, "sensor-1")
+		if err != nil {
+			t.Fatalf("GenerateHostKey(%s) error: %v", tt.keyType, err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			t.Fatalf("Failed to parse %s key: %v", tt.keyType, err)
+		}
+		if algo := signer.PublicKey().Type(); algo != tt.algo {
+			t.Errorf("Expected %s key, got %s", tt.algo, algo)
+		}
+		if bits := KeyBits(signer.PublicKey()); bits != tt.bits {
+			t.Errorf("Expected %d bits for %s, got %d", tt.bits, tt.keyType, bits)
+		}
+	}
+
+	for _, invalid := range []struct {
+		keyType string
+		bits    int
+	}{
+		{KeyTypeRSA, 1024},
+		{KeyTypeECDSA, 255},
+		{KeyTypeEd25519, 512},
+		{"dsa", 1024},
+	} {
+		if _, err := GenerateHostKey(invalid.keyType, invalid.bits, ""); err == nil {
+			t.Errorf("Expected an error for a %d bits %s key", invalid.bits, invalid.keyType)
+		}
+	}
+}
+
+func TestBuiltinHostKey(t *testing.T) {
+	signer, err := BuiltinHostKey()
+	if err != nil {
+		t.Fatalf("BuiltinHostKey() error: %v", err)
+	}
+	if bits := KeyBits(signer.PublicKey()); bits != 2048 {
+		t.Errorf("Expected a 2048 bits key, got %d", bits)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package sshserver
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// Option configures a server beyond its configuration
+type Option func(*options)
+
+// options are the settings collected from the options of NewServer
+type options struct {
+	hostKey ssh.Signer
+	logger  *logger.CredentialsLogger
+	clock   Clock
+	rand    Rand
+	banner  func(conn ssh.ConnMetadata) string
+	delay   func(addr net.Addr) time.Duration
+	hooks   []Hooks
+}
+
+// Clock tells the time of connections and attempts, and waits for the
+// delays of attempts
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the clock of the system
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Rand draws the random delays of attempts
+type Rand interface {
+	// Int63n returns a number in [0,n)
+	Int63n(n int64) int64
+}
+
+// globalRand is the generator of math/rand, seeded randomly
+type globalRand struct{}
+
+func (globalRand) Int63n(n int64) int64 { return rand.Int63n(n) }
+
+// lockedRand serializes the calls to a generator, such as a *rand.Rand,
+// which is not safe for concurrent use
+type lockedRand struct {
+	mu sync.Mutex
+	r  Rand
+}
+
+func (l *lockedRand) Int63n(n int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Int63n(n)
+}
+
+// WithHostKey sets the host key, instead of the key of the configuration
+func WithHostKey(key ssh.Signer) Option {
+	return func(o *options) {
+		o.hostKey = key
+	}
+}
+
+// WithLogger sets the logger of the attempts, replacing the one passed to
+// NewServer
+func WithLogger(l *logger.CredentialsLogger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithClock sets the clock, the system clock by default
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithRand sets the generator of the random delays, such as a *rand.Rand
+// with a fixed seed, math/rand by default. Calls to it are serialized.
+func WithRand(r Rand) Option {
+	return func(o *options) {
+		o.rand = &lockedRand{r: r}
+	}
+}
+
+// WithBannerFunc sets the function returning the banner shown to a client
+// before authentication, instead of the Ubuntu greeting with the banner of
+// the configuration
+func WithBannerFunc(f func(conn ssh.ConnMetadata) string) Option {
+	return func(o *options) {
+		o.banner = f
+	}
+}
+
+// WithDelayFunc sets the function returning how long an attempt from an
+// address is held before it is rejected, instead of the random delay or
+// the tarpit delay of the governor. Hooks may still change the delay.
+func WithDelayFunc(f func(addr net.Addr) time.Duration) Option {
+	return func(o *options) {
+		o.delay = f
+	}
+}
+
+// WithHooks adds hooks, called after the governor in the order they are
+// added
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) {
+		o.hooks = append(o.hooks, hooks)
+	}
+}
@@ -20,66 +20,117 @@
 package sshserver
 
 import (
+	"context"
 	cryptoRand "crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/abehterev/fakessh/internal/config"
 	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/metrics"
+	"github.com/abehterev/fakessh/internal/tracing"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/crypto/ssh"
 )
 
+// ErrKeyLoad is wrapped by the errors of obtaining the host key
+var ErrKeyLoad = errors.New("host key loading error")
+
+// ErrBind is wrapped by the errors of binding the listener
+var ErrBind = errors.New("listener binding error")
+
+// errPermissionDenied rejects every authentication attempt
+var errPermissionDenied = errors.New("permission denied (password), please try again")
+
 // Server represents a fake SSH server
 type Server struct {
 	config     *config.Config
 	sshConfig  *ssh.ServerConfig
 	logger     *logger.CredentialsLogger
 	privateKey ssh.Signer
+	metrics    *metrics.Registry
+	tracer     *tracing.Tracer
+	governor   *Governor
+	// Hooks around connections and attempts, starting with the governor
+	hooks hookChain
+	clock Clock
+	// Delay of attempts by remote address
+	delay func(addr net.Addr) time.Duration
+	// Server version and banner, changed at runtime by the admin API and
+	// configuration profiles
+	version atomic.Pointer[string]
+	banner  atomic.Pointer[string]
+
+	// Trace contexts of open connections by remote address, used by the
+	// authentication callbacks
+	traces sync.Map
+
+	// Set while the listener is bound
+	listening  atomic.Bool
+	listenerMu sync.Mutex
+	listener   net.Listener
+	// Set by Close, and closed to end the delays of attempts
+	closed bool
+	done   chan struct{}
+	// Called once the listener is bound
+	onListening func()
+
+	// Open connections, closed by Shutdown when it stops waiting. No
+	// connection is added once draining is set.
+	connsMu  sync.Mutex
+	conns    map[net.Conn]struct{}
+	connsWG  sync.WaitGroup
+	draining bool
 }
 
-func init() {
-	// Initialize the random number generator
-	rand.Seed(time.Now().UnixNano())
-}
-
-// NewServer creates a new SSH server instance
-func NewServer(config *config.Config, logger *logger.CredentialsLogger) (*Server, error) {
-	// Get private key
-	var privateKey ssh.Signer
-	var err error
+// NewServer creates a new SSH server instance, with options for what the
+// configuration does not cover
+func NewServer(config *config.Config, logger *logger.CredentialsLogger, opts ...Option) (*Server, error) {
+	o := options{logger: logger, clock: systemClock{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
 
-	if config.GenerateKey {
-		// Generate a new private key
-		privateKey, err = generatePrivateKey()
-		if err != nil {
-			return nil, fmt.Errorf("key generation error: %w", err)
-		}
-	} else if config.PrivateKeyPath != "" {
-		// Load key from file
-		privateKey, err = loadPrivateKey(config.PrivateKeyPath)
-		if err != nil {
-			return nil, fmt.Errorf("key loading error: %w", err)
-		}
-	} else {
-		// Use built-in key
-		privateKey, err = ssh.ParsePrivateKey([]byte(defaultHostKey))
-		if err != nil {
-			return nil, fmt.Errorf("built-in key parsing error: %w", err)
+	privateKey := o.hostKey
+	if privateKey == nil {
+		var err error
+		if privateKey, err = configHostKey(config); err != nil {
+			return nil, err
 		}
 	}
 
+	governor, err := NewGovernor(config.Access)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access settings: %w", err)
+	}
+
 	server := &Server{
 		config:     config,
-		logger:     logger,
+		logger:     o.logger,
 		privateKey: privateKey,
+		governor:   governor,
+		hooks:      append(hookChain{governor}, o.hooks...),
+		clock:      o.clock,
+		delay:      o.delay,
+		done:       make(chan struct{}),
+		conns:      make(map[net.Conn]struct{}),
 	}
+	if o.rand != nil {
+		governor.rand = o.rand
+	}
+	if server.delay == nil {
+		server.delay = governor.AttemptDelay
+	}
+	server.version.Store(&config.ServerVersion)
+	server.banner.Store(&config.Banner)
 
 	// Configure SSH server
 	sshConfig := &ssh.ServerConfig{
@@ -87,6 +138,9 @@ func NewServer(config *config.Config, logger *logger.CredentialsLogger) (*Server
 		BannerCallback:   server.bannerCallback,
 		ServerVersion:    config.GetFullServerVersion(),
 	}
+	if o.banner != nil {
+		sshConfig.BannerCallback = o.banner
+	}
 
 	// Add private key to configuration
 	sshConfig.AddHostKey(privateKey)
@@ -96,43 +150,275 @@ func NewServer(config *config.Config, logger *logger.CredentialsLogger) (*Server
 	return server, nil
 }
 
-// Start launches the SSH server
+// configHostKey returns the host key of the configuration: a new key, the
+// key of private_key_path or the built-in key
+func configHostKey(config *config.Config) (ssh.Signer, error) {
+	if config.GenerateKey {
+		// Generate a new private key
+		privateKey, err := generatePrivateKey()
+		if err != nil {
+			return nil, fmt.Errorf("%w: key generation error: %w", ErrKeyLoad, err)
+		}
+		return privateKey, nil
+	}
+	if config.PrivateKeyPath != "" {
+		// Load key from file
+		privateKey, err := loadPrivateKey(config.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrKeyLoad, err)
+		}
+		return privateKey, nil
+	}
+	// Use built-in key
+	privateKey, err := BuiltinHostKey()
+	if err != nil {
+		return nil, fmt.Errorf("%w: built-in key parsing error: %w", ErrKeyLoad, err)
+	}
+	return privateKey, nil
+}
+
+// SetMetrics sets the registry receiving connection and attempt metrics
+func (s *Server) SetMetrics(m *metrics.Registry) {
+	s.metrics = m
+}
+
+// SetTracer sets the tracer recording connection handling
+func (s *Server) SetTracer(t *tracing.Tracer) {
+	s.tracer = t
+}
+
+// SetListeningHook sets a function called once the listener is bound
+func (s *Server) SetListeningHook(f func()) {
+	s.onListening = f
+}
+
+// Governor returns the governor deciding how connections are handled
+func (s *Server) Governor() *Governor {
+	return s.governor
+}
+
+// SetBanner changes the version banner shown to new connections
+func (s *Server) SetBanner(banner string) {
+	s.banner.Store(&banner)
+}
+
+// Banner returns the version banner shown to new connections
+func (s *Server) Banner() string {
+	return *s.banner.Load()
+}
+
+// SetServerVersion changes the server version shown to new connections
+func (s *Server) SetServerVersion(version string) {
+	s.version.Store(&version)
+}
+
+// ServerVersion returns the server version shown to new connections
+func (s *Server) ServerVersion() string {
+	return *s.version.Load()
+}
+
+// serverVersion returns the full version string of new connections
+func (s *Server) serverVersion() string {
+	return config.FullServerVersion(s.ServerVersion(), s.Banner())
+}
+
+// Addr returns the address of the bound listener, or nil before Start
+func (s *Server) Addr() net.Addr {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Events returns a channel of the events logged from now on, once
+// processed, closed with the logger. Events are dropped while
+// logger.DefaultFeedBuffer of them are queued, see Subscribe.
+func (s *Server) Events() <-chan *logger.Event {
+	return s.Subscribe(0).Events()
+}
+
+// Subscribe returns a subscription to the events logged from now on, for
+// the components observing them, queuing up to buffer of them
+func (s *Server) Subscribe(buffer int) *logger.Subscription {
+	return s.logger.Subscribe(buffer)
+}
+
+// Close stops accepting connections, making Start return. A server closed
+// before Start returns from it at once.
+func (s *Server) Close() error {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// Shutdown stops accepting connections and waits for the open ones to end.
+// Delays of attempts are cut short, so clients see their last attempt
+// rejected. Connections still open when ctx is done are closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.Close()
+	s.connsMu.Lock()
+	s.draining = true
+	s.connsMu.Unlock()
+
+	ended := make(chan struct{})
+	go func() {
+		s.connsWG.Wait()
+		close(ended)
+	}()
+	select {
+	case <-ended:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.connsMu.Lock()
+	open := len(s.conns)
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsMu.Unlock()
+	<-ended
+	return errors.Join(err, fmt.Errorf("%d connections closed: %w", open, ctx.Err()))
+}
+
+// CheckListener reports an error if the server is not accepting connections
+func (s *Server) CheckListener() error {
+	if !s.listening.Load() {
+		return fmt.Errorf("listener is not bound")
+	}
+	return nil
+}
+
+// CheckHostKey reports an error if no host key is loaded
+func (s *Server) CheckHostKey() error {
+	if s.privateKey == nil {
+		return fmt.Errorf("host key is not loaded")
+	}
+	return nil
+}
+
+// Start launches the SSH server on the port of the configuration
 func (s *Server) Start() error {
 	// Listen for connections on the specified port
 	listener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", s.config.Port))
 	if err != nil {
-		return fmt.Errorf("server start error: %w", err)
+		return fmt.Errorf("%w: %w", ErrBind, err)
 	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on a listener until Close, for listeners bound
+// beforehand, wrapped in TLS or kept in memory by tests. The listener is
+// closed when Serve returns.
+func (s *Server) Serve(listener net.Listener) error {
 	defer listener.Close()
 
-	fmt.Printf("Fake SSH server started on port %d\n", s.config.Port)
-	fmt.Printf("Server version: %s\n", s.config.GetFullServerVersion())
+	s.listenerMu.Lock()
+	s.listener = listener
+	closed := s.closed
+	s.listenerMu.Unlock()
+	if closed {
+		return nil
+	}
+
+	s.listening.Store(true)
+	defer s.listening.Store(false)
+
+	started := log.Info()
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		started = started.Int("port", addr.Port)
+	} else {
+		started = started.Str("address", listener.Addr().String())
+	}
+	started.
+		Str("version", s.serverVersion()).
+		Str("fingerprint", ssh.FingerprintSHA256(s.privateKey.PublicKey())).
+		Msg("Fake SSH server started")
 
-	// Print SSH key fingerprint for debugging
-	if pubKey, ok := s.privateKey.PublicKey().(ssh.PublicKey); ok {
-		fmt.Printf("Server fingerprint: %s\n", ssh.FingerprintSHA256(pubKey))
+	if s.onListening != nil {
+		s.onListening()
 	}
 
 	for {
 		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
 		if err != nil {
-			fmt.Printf("Connection acceptance error: %v\n", err)
+			log.Error().Err(err).Msg("connection acceptance error")
 			continue
 		}
 
 		// Handle connection in a separate goroutine
+		s.connsMu.Lock()
+		if s.draining {
+			s.connsMu.Unlock()
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.connsWG.Add(1)
+		s.connsMu.Unlock()
 		go s.handleConnection(conn)
 	}
 }
 
 // handleConnection processes an incoming connection
 func (s *Server) handleConnection(conn net.Conn) {
-	defer conn.Close()
+	defer func() {
+		conn.Close()
+		s.connsMu.Lock()
+		delete(s.conns, conn)
+		s.connsMu.Unlock()
+		s.connsWG.Done()
+	}()
+
+	// Denied sources are disconnected before the handshake, without events
+	if err := s.hooks.OnConnection(conn.RemoteAddr()); err != nil {
+		s.metrics.Count(metrics.ConnectionsDenied, 1)
+		log.Debug().Str("remote_addr", conn.RemoteAddr().String()).Err(err).Msg("connection denied")
+		return
+	}
 
-	// Perform SSH handshake
-	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.sshConfig)
+	start := s.clock.Now()
+	s.metrics.Count(metrics.Connections, 1)
+	s.metrics.AddGauge(metrics.ConnectionsActive, 1)
+	defer func() {
+		duration := s.clock.Now().Sub(start)
+		s.metrics.AddGauge(metrics.ConnectionsActive, -1)
+		s.metrics.Timing(metrics.ConnectionDuration, duration)
+		s.hooks.OnDisconnect(conn.RemoteAddr(), duration)
+	}()
+
+	remoteAddr := conn.RemoteAddr().String()
+	log.Debug().Str("remote_addr", remoteAddr).Msg("connection accepted")
+
+	ctx, span := s.tracer.Start(context.Background(), "ssh_connection", tracing.KindServer)
+	defer span.End()
+	span.SetAttribute("client.address", remoteAddr)
+
+	// Authentication attempts happen during the handshake
+	handshakeCtx, handshakeSpan := s.tracer.Start(ctx, "ssh_handshake", tracing.KindInternal)
+	s.traces.Store(remoteAddr, handshakeCtx)
+	defer s.traces.Delete(remoteAddr)
+
+	// Perform SSH handshake, with the banner current at connection time
+	sshConfig := *s.sshConfig
+	sshConfig.ServerVersion = s.serverVersion()
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, &sshConfig)
+	handshakeSpan.End()
 	if err != nil {
 		// Error is expected here as we always reject authentication
+		log.Debug().Str("remote_addr", remoteAddr).Err(err).Msg("connection closed")
 		return
 	}
 	defer sshConn.Close()
@@ -148,26 +434,53 @@ func (s *Server) handleConnection(conn net.Conn) {
 
 // passwordCallback handles password authentication attempts
 func (s *Server) passwordCallback(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
-	// Log login attempt
-	attempt := logger.CredentialAttempt{
-		Timestamp:  time.Now(),
-		RemoteAddr: conn.RemoteAddr().String(),
-		Username:   conn.User(),
-		Password:   string(password),
+	s.metrics.Count(metrics.AuthAttempts, 1)
+
+	ctx := context.Background()
+	if v, ok := s.traces.Load(conn.RemoteAddr().String()); ok {
+		ctx = v.(context.Context)
+	}
+	ctx, span := s.tracer.Start(ctx, "auth_attempt", tracing.KindInternal)
+	defer span.End()
+	span.SetAttribute("ssh.username", conn.User())
+
+	attempt := &Attempt{
+		Addr: conn.RemoteAddr(),
+		Credentials: logger.CredentialAttempt{
+			Timestamp:     s.clock.Now(),
+			RemoteAddr:    conn.RemoteAddr().String(),
+			Username:      conn.User(),
+			Password:      string(password),
+			ClientVersion: string(conn.ClientVersion()),
+		},
+		Delay: s.delay(conn.RemoteAddr()),
+	}
+	if err := s.hooks.BeforeAuth(ctx, attempt); err != nil {
+		log.Debug().Str("remote_addr", attempt.Credentials.RemoteAddr).Err(err).Msg("attempt refused")
+		return nil, errPermissionDenied
 	}
 
-	if err := s.logger.Log(attempt); err != nil {
+	// Log login attempt
+	if err := s.logger.LogContext(ctx, attempt.Credentials); err != nil {
+		span.RecordError(err)
 		log.Error().Err(err).Msg("logging error")
 	}
 
-	// Always reject authentication with a delay to simulate a real server
-	time.Sleep(time.Duration(200+rand.Intn(300)) * time.Millisecond)
-	return nil, fmt.Errorf("permission denied (password), please try again")
+	// Always reject authentication with a delay to simulate a real server,
+	// or to hold the client in the tarpit
+	s.hooks.AfterAuth(ctx, attempt)
+	_, delaySpan := s.tracer.Start(ctx, "auth_delay", tracing.KindInternal)
+	select {
+	case <-s.clock.After(attempt.Delay):
+	case <-s.done:
+	}
+	delaySpan.End()
+	return nil, errPermissionDenied
 }
 
 // bannerCallback returns a greeting banner
 func (s *Server) bannerCallback(conn ssh.ConnMetadata) string {
-	return fmt.Sprintf("Welcome to Ubuntu %s (GNU/Linux 5.4.0-109-generic x86_64)\n\n", s.config.Banner)
+	return fmt.Sprintf("Welcome to Ubuntu %s (GNU/Linux 5.4.0-109-generic x86_64)\n\n", s.Banner())
 }
 
 // generatePrivateKey generates a new RSA private key for SSH server
@@ -1,14 +1,25 @@
 package sshserver
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/abehterev/fakessh/internal/config"
 	"github.com/abehterev/fakessh/internal/logger"
+	"golang.org/x/crypto/ssh"
 )
 
 // mockLogger is a mock implementation of logger.CredentialsLogger for testing
@@ -138,8 +149,8 @@ func TestNewServer(t *testing.T) {
 					}
 				}
 			} else {
-				if err == nil {
-					t.Errorf("Expected an error, got nil")
+				if !errors.Is(err, ErrKeyLoad) {
+					t.Errorf("Expected ErrKeyLoad, got: %v", err)
 				}
 				if server != nil {
 					t.Errorf("Expected server to be nil")
@@ -181,8 +192,8 @@ func TestPasswordCallback(t *testing.T) {
 	}
 	defer credLogger.Close()
 
-	// Create a new server
-	server, err := NewServer(cfg, credLogger)
+	// Create a new server, whose clock does not wait for the delay
+	server, err := NewServer(cfg, credLogger, WithClock(&fakeClock{now: time.Now()}))
 	if err != nil {
 		t.Fatalf("Failed to create server: %v", err)
 	}
@@ -218,6 +229,22 @@ func TestPasswordCallback(t *testing.T) {
 	}
 }
 
+func TestServerIdentityChange(t *testing.T) {
+	cfg := &config.Config{Banner: "Test", ServerVersion: "OpenSSH_8.2p1", GenerateKey: true}
+	server, err := NewServer(cfg, nil)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if got := server.serverVersion(); got != "SSH-2.0-OpenSSH_8.2p1 Test" {
+		t.Errorf("Unexpected server version '%s'", got)
+	}
+	server.SetServerVersion("OpenSSH_9.6p1")
+	server.SetBanner("Ubuntu-3ubuntu13")
+	if got := server.serverVersion(); got != "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13" {
+		t.Errorf("Unexpected changed server version '%s'", got)
+	}
+}
+
 // mockConnMetadata is a mock implementation of ssh.ConnMetadata for testing
 type mockConnMetadata struct {
 	user       string
@@ -235,3 +262,558 @@ type mockAddr string
 
 func (a mockAddr) Network() string { return "tcp" }
 func (a mockAddr) String() string  { return string(a) }
+
+func TestStartClose(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	cfg := &config.Config{
+		Port:          0,
+		Banner:        "Test",
+		Log:           config.LogConfig{File: logFile, Format: "json"},
+		ServerVersion: "8.2p1",
+		GenerateKey:   true,
+	}
+	credLogger, err := logger.NewCredentialsLogger(logger.Config{LogFile: logFile, LogFormat: "json"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer credLogger.Close()
+
+	server, err := NewServer(cfg, credLogger)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if server.Addr() != nil {
+		t.Errorf("Expected no address before Start")
+	}
+
+	listening := make(chan struct{})
+	server.SetListeningHook(func() { close(listening) })
+	done := make(chan error, 1)
+	go func() { done <- server.Start() }()
+	<-listening
+
+	port := server.Addr().(*net.TCPAddr).Port
+	if port == 0 {
+		t.Fatalf("Expected an ephemeral port to be bound")
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	conn.Close()
+
+	// The port is taken by the first server
+	taken := *cfg
+	taken.Port = port
+	other, err := NewServer(&taken, credLogger)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if err := other.Start(); !errors.Is(err, ErrBind) {
+		t.Errorf("Expected ErrBind for a port in use, got: %v", err)
+	}
+
+	if err := server.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Start() returned %v after Close", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() did not return after Close")
+	}
+}
+
+func TestDeniedConnection(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	cfg := &config.Config{
+		Port:          0,
+		Banner:        "Test",
+		Log:           config.LogConfig{File: logFile, Format: "json"},
+		ServerVersion: "8.2p1",
+		GenerateKey:   true,
+		Access:        config.AccessConfig{Denylist: []string{"127.0.0.0/8"}},
+	}
+	credLogger, err := logger.NewCredentialsLogger(logger.Config{LogFile: logFile, LogFormat: "json"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer credLogger.Close()
+
+	server, err := NewServer(cfg, credLogger)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	listening := make(chan struct{})
+	server.SetListeningHook(func() { close(listening) })
+	go server.Start()
+	defer server.Close()
+	<-listening
+
+	port := server.Addr().(*net.TCPAddr).Port
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	// A denied client is disconnected without the version exchange
+	if n, err := conn.Read(make([]byte, 64)); n != 0 || err == nil {
+		t.Errorf("Expected the connection to be closed, read %d bytes (%v)", n, err)
+	}
+
+	cfg.Access.Denylist = []string{"invalid"}
+	if _, err := NewServer(cfg, credLogger); err == nil {
+		t.Errorf("Expected an error for an invalid denylist")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	cfg := &config.Config{
+		Port:          0,
+		Banner:        "Test",
+		Log:           config.LogConfig{File: logFile, Format: "json"},
+		ServerVersion: "8.2p1",
+		GenerateKey:   true,
+		Access:        config.AccessConfig{Tarpit: true, TarpitDelay: time.Hour},
+	}
+	credLogger, err := logger.NewCredentialsLogger(logger.Config{LogFile: logFile, LogFormat: "json"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer credLogger.Close()
+
+	server, err := NewServer(cfg, credLogger)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	listening := make(chan struct{})
+	server.SetListeningHook(func() { close(listening) })
+	done := make(chan error, 1)
+	go func() { done <- server.Start() }()
+	<-listening
+	addr := server.Addr().String()
+
+	// A client held in the tarpit gets its attempt rejected on shutdown
+	dialed := make(chan error, 1)
+	go func() {
+		_, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+			User:            "tarpitted",
+			Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		})
+		dialed <- err
+	}()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if content, _ := os.ReadFile(logFile); strings.Contains(string(content), "tarpitted") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Attempt not logged")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+	select {
+	case err := <-dialed:
+		if err == nil {
+			t.Error("Expected authentication to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Client still held after Shutdown")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Start() returned %v after Shutdown", err)
+	}
+
+	// A server shut down before Start does not serve
+	server, err = NewServer(cfg, credLogger)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	server.Close()
+	if err := server.Start(); err != nil {
+		t.Errorf("Start() returned %v after Close", err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	cfg := &config.Config{
+		Port:          0,
+		Banner:        "Test",
+		Log:           config.LogConfig{File: logFile, Format: "json"},
+		ServerVersion: "8.2p1",
+		GenerateKey:   true,
+	}
+	credLogger, err := logger.NewCredentialsLogger(logger.Config{LogFile: logFile, LogFormat: "json"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer credLogger.Close()
+
+	server, err := NewServer(cfg, credLogger)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	listening := make(chan struct{})
+	server.SetListeningHook(func() { close(listening) })
+	go server.Start()
+	<-listening
+
+	// A client that never sends its version keeps the connection open
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.Read(make([]byte, 64))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "1 connections closed") {
+		t.Errorf("Expected the open connection to be closed, got %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Errorf("Expected the connection to be closed by the server, got %v", err)
+	}
+}
+
+// recordingHooks refuses the user "blocked", masks passwords and records
+// the connections
+type recordingHooks struct {
+	NopHooks
+	mu           sync.Mutex
+	connections  int
+	disconnected int
+}
+
+func (h *recordingHooks) OnConnection(addr net.Addr) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.connections++
+	return nil
+}
+
+func (h *recordingHooks) BeforeAuth(ctx context.Context, attempt *Attempt) error {
+	if attempt.Credentials.Username == "blocked" {
+		return errors.New("blocked user")
+	}
+	attempt.Credentials.Password = "***"
+	return nil
+}
+
+func (h *recordingHooks) AfterAuth(ctx context.Context, attempt *Attempt) {
+	attempt.Delay = 0
+}
+
+func (h *recordingHooks) OnDisconnect(addr net.Addr, duration time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.disconnected++
+}
+
+func TestHooks(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	cfg := &config.Config{
+		Banner:        "Test",
+		ServerVersion: "8.2p1",
+		GenerateKey:   true,
+		Access:        config.AccessConfig{DelayMin: time.Hour, DelayMax: time.Hour},
+	}
+	credLogger, err := logger.NewCredentialsLogger(logger.Config{LogFile: logFile, LogFormat: "json"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer credLogger.Close()
+	hooks := &recordingHooks{}
+	server, err := NewServer(cfg, credLogger, WithHooks(hooks))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	events := server.Subscribe(10)
+
+	// The delay of the governor is replaced by the later hooks
+	for _, user := range []string{"blocked", "root"} {
+		if _, err := server.passwordCallback(&mockConnMetadata{user: user, remoteAddr: "127.0.0.1:12345"}, []byte("secret")); err == nil {
+			t.Errorf("Expected the attempt of %s to be rejected", user)
+		}
+	}
+	if n := len(events.Events()); n != 1 {
+		t.Fatalf("Expected only the attempt not refused to be logged, got %d events", n)
+	}
+	if event := <-events.Events(); event.GetString("username") != "root" || event.GetString("password") != "***" {
+		t.Errorf("Expected the credentials changed by the hooks, got %s/%s", event.GetString("username"), event.GetString("password"))
+	}
+
+	listening := make(chan struct{})
+	server.SetListeningHook(func() { close(listening) })
+	go server.Start()
+	<-listening
+	port := server.Addr().(*net.TCPAddr).Port
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	conn.Close()
+	server.Shutdown(context.Background())
+
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if hooks.connections != 1 || hooks.disconnected != 1 {
+		t.Errorf("Expected 1 connection and disconnection, got %d and %d", hooks.connections, hooks.disconnected)
+	}
+}
+
+// refusingHooks refuses every connection
+type refusingHooks struct {
+	recordingHooks
+}
+
+func (h *refusingHooks) OnConnection(addr net.Addr) error {
+	h.recordingHooks.OnConnection(addr)
+	return errDenied
+}
+
+func TestHooksRefused(t *testing.T) {
+	accepting, refusing := &recordingHooks{}, &refusingHooks{}
+	chain := hookChain{accepting, refusing}
+
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345}
+	if err := chain.OnConnection(addr); !errors.Is(err, errDenied) {
+		t.Fatalf("Expected the connection to be refused, got %v", err)
+	}
+
+	// The hook that accepted the connection is told it is gone, the one
+	// that refused it is not
+	if accepting.connections != 1 || accepting.disconnected != 1 {
+		t.Errorf("Expected 1 connection and disconnection of the first hook, got %d and %d", accepting.connections, accepting.disconnected)
+	}
+	if refusing.connections != 1 || refusing.disconnected != 0 {
+		t.Errorf("Expected 1 connection and no disconnection of the second hook, got %d and %d", refusing.connections, refusing.disconnected)
+	}
+}
+
+// pipeListener is an in-memory listener accepting the connections of dial
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return mockAddr("pipe") }
+
+func (l *pipeListener) dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return newAsyncConn(client), nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// asyncConn writes in the background, as both sides of the SSH version
+// exchange write at once, which blocks them on the unbuffered net.Pipe
+type asyncConn struct {
+	net.Conn
+	writes chan []byte
+	done   chan struct{}
+}
+
+func newAsyncConn(conn net.Conn) *asyncConn {
+	c := &asyncConn{Conn: conn, writes: make(chan []byte, 64), done: make(chan struct{})}
+	go func() {
+		for {
+			select {
+			case b := <-c.writes:
+				if _, err := conn.Write(b); err != nil {
+					return
+				}
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return c
+}
+
+func (c *asyncConn) Write(b []byte) (int, error) {
+	select {
+	case c.writes <- append([]byte(nil), b...):
+		return len(b), nil
+	case <-c.done:
+		return 0, net.ErrClosed
+	}
+}
+
+func (c *asyncConn) Close() error {
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	return c.Conn.Close()
+}
+
+func TestServe(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	cfg := &config.Config{
+		Banner:        "Test",
+		ServerVersion: "8.2p1",
+		GenerateKey:   true,
+		Access:        config.AccessConfig{DelayMin: time.Millisecond, DelayMax: time.Millisecond},
+	}
+	credLogger, err := logger.NewCredentialsLogger(logger.Config{LogFile: logFile, LogFormat: "json"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer credLogger.Close()
+	server, err := NewServer(cfg, credLogger)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	events := server.Subscribe(10)
+
+	listener := newPipeListener()
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	conn, err := listener.dial()
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	_, _, _, err = ssh.NewClientConn(conn, "pipe", &ssh.ClientConfig{
+		User:            "root",
+		Auth:            []ssh.AuthMethod{ssh.Password("toor")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err == nil {
+		t.Fatal("Expected authentication to fail")
+	}
+	if event := <-events.Events(); event.GetString("username") != "root" || event.GetString("remote_addr") != "pipe" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+
+	server.Close()
+	if err := <-served; err != nil {
+		t.Errorf("Serve() error: %v", err)
+	}
+}
+
+// fakeClock stands still and records the delays it is asked to wait
+type fakeClock struct {
+	now    time.Time
+	mu     sync.Mutex
+	delays []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delays = append(c.delays, d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now.Add(d)
+	return ch
+}
+
+func TestServerOptions(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	credLogger, err := logger.NewCredentialsLogger(logger.Config{LogFile: logFile, LogFormat: "json"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer credLogger.Close()
+	hostKey, err := generatePrivateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	clock := &fakeClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+	cfg := &config.Config{Banner: "Test", ServerVersion: "8.2p1", PrivateKeyPath: "/nonexistent"}
+	server, err := NewServer(cfg, nil,
+		WithHostKey(hostKey),
+		WithLogger(credLogger),
+		WithClock(clock),
+		WithBannerFunc(func(conn ssh.ConnMetadata) string { return "Hello " + conn.User() }),
+		WithDelayFunc(func(addr net.Addr) time.Duration { return time.Hour }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if !bytes.Equal(server.privateKey.PublicKey().Marshal(), hostKey.PublicKey().Marshal()) {
+		t.Error("Expected the host key of the option")
+	}
+	meta := &mockConnMetadata{user: "root", remoteAddr: "127.0.0.1:12345"}
+	if banner := server.sshConfig.BannerCallback(meta); banner != "Hello root" {
+		t.Errorf("Expected the banner of the function, got %q", banner)
+	}
+
+	events := server.Subscribe(1)
+	server.passwordCallback(meta, []byte("toor"))
+	if event := <-events.Events(); !event.Time.Equal(clock.now) {
+		t.Errorf("Expected the time of the clock, got %v", event.Time)
+	}
+	if len(clock.delays) != 1 || clock.delays[0] != time.Hour {
+		t.Errorf("Expected the delay of the function, got %v", clock.delays)
+	}
+}
+
+func TestServerRand(t *testing.T) {
+	cfg := &config.Config{Banner: "Test", ServerVersion: "8.2p1"}
+	credLogger, err := logger.NewCredentialsLogger(logger.Config{LogFile: filepath.Join(t.TempDir(), "test.log"), LogFormat: "json"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer credLogger.Close()
+	delays := func() []time.Duration {
+		clock := &fakeClock{}
+		server, err := NewServer(cfg, credLogger, WithClock(clock), WithRand(rand.New(rand.NewSource(1))))
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+		for i := 0; i < 5; i++ {
+			server.passwordCallback(&mockConnMetadata{user: "root", remoteAddr: "192.0.2.1:4000"}, []byte("root"))
+		}
+		return clock.delays
+	}
+
+	first, second := delays(), delays()
+	if len(first) != 5 || !slices.Equal(first, second) {
+		t.Errorf("Expected the same delays from generators of the same seed, got %v and %v", first, second)
+	}
+	for _, d := range first {
+		if d < defaultDelayMin || d > defaultDelayMax {
+			t.Errorf("Expected delays between the default bounds, got %s", d)
+		}
+	}
+}
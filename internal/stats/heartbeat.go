@@ -0,0 +1,139 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// HeartbeatConfig contains settings of heartbeat events
+type HeartbeatConfig struct {
+	// Interval between heartbeats
+	Interval time.Duration
+	// Identifier of the sensor
+	SensorID string
+	// Version of the running binary
+	Version string
+	// Git commit, build date and Go version of the binary, omitted if empty
+	Commit    string
+	BuildDate string
+	GoVersion string
+}
+
+// Heartbeat periodically logs an event with the sensor identity, uptime and
+// counters, so that downstream systems can tell a dead sensor from a quiet one
+type Heartbeat struct {
+	config   HeartbeatConfig
+	start    time.Time
+	registry *metrics.Registry
+	logger   *logger.CredentialsLogger
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// StartHeartbeat logs a heartbeat right away and then every interval
+func StartHeartbeat(config HeartbeatConfig, registry *metrics.Registry, l *logger.CredentialsLogger) *Heartbeat {
+	h := &Heartbeat{
+		config:   config,
+		start:    time.Now(),
+		registry: registry,
+		logger:   l,
+		done:     make(chan struct{}),
+	}
+	h.wg.Add(1)
+	go h.loop()
+	return h
+}
+
+func (h *Heartbeat) loop() {
+	defer h.wg.Done()
+	ticker := time.NewTicker(h.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.logger.LogEvent(h.Event(time.Now())); err != nil {
+			log.Error().Err(err).Msg("heartbeat logging error")
+		}
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Event builds the heartbeat event for the given time
+func (h *Heartbeat) Event(now time.Time) *logger.Event {
+	event := &logger.Event{
+		Time:    now,
+		Type:    "heartbeat",
+		Message: "sensor heartbeat",
+		Fields: []logger.Field{
+			{Key: "sensor_id", Value: h.config.SensorID},
+			{Key: "version", Value: h.config.Version},
+		},
+	}
+	for _, f := range []logger.Field{
+		{Key: "commit", Value: h.config.Commit},
+		{Key: "build_date", Value: h.config.BuildDate},
+		{Key: "go_version", Value: h.config.GoVersion},
+	} {
+		if f.Value != "" {
+			event.Set(f.Key, f.Value)
+		}
+	}
+	event.Set("uptime_seconds", int64(now.Sub(h.start).Seconds()))
+
+	var connections, active, attempts, sinkErrors int64
+	snapshot := h.registry.Snapshot()
+	for _, c := range snapshot.Counters {
+		switch c.Name {
+		case metrics.Connections:
+			connections += int64(c.Value)
+		case metrics.AuthAttempts:
+			attempts += int64(c.Value)
+		case metrics.SinkErrors:
+			sinkErrors += int64(c.Value)
+		}
+	}
+	for _, g := range snapshot.Gauges {
+		if g.Name == metrics.ConnectionsActive {
+			active = int64(g.Value)
+		}
+	}
+
+	event.Set("connections_total", connections)
+	event.Set("connections_active", active)
+	event.Set("attempts_total", attempts)
+	event.Set("sink_errors_total", sinkErrors)
+	return event
+}
+
+// Close stops the heartbeats
+func (h *Heartbeat) Close() error {
+	close(h.done)
+	h.wg.Wait()
+	return nil
+}
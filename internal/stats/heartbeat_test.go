@@ -0,0 +1,86 @@
+package stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/metrics"
+)
+
+func TestHeartbeatEvent(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.Count(metrics.Connections, 4)
+	registry.AddGauge(metrics.ConnectionsActive, 2)
+	registry.Count(metrics.AuthAttempts, 7)
+	registry.Count(metrics.SinkErrors, 1, metrics.Tag{Key: "sink", Value: "stdout"})
+
+	h := &Heartbeat{
+		config:   HeartbeatConfig{SensorID: "sensor-01", Version: "v1.2.3", Commit: "0a1b2c3", GoVersion: "go1.23.4"},
+		start:    time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		registry: registry,
+	}
+	event := h.Event(time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC))
+
+	if event.Type != "heartbeat" {
+		t.Errorf("Type = %q, want heartbeat", event.Type)
+	}
+	want := map[string]interface{}{
+		"sensor_id":          "sensor-01",
+		"version":            "v1.2.3",
+		"commit":             "0a1b2c3",
+		"go_version":         "go1.23.4",
+		"uptime_seconds":     int64(3600),
+		"connections_total":  int64(4),
+		"connections_active": int64(2),
+		"attempts_total":     int64(7),
+		"sink_errors_total":  int64(1),
+	}
+	for k, v := range want {
+		if got, _ := event.Get(k); got != v {
+			t.Errorf("%s = %v, want %v", k, got, v)
+		}
+	}
+	if _, ok := event.Get("build_date"); ok {
+		t.Errorf("Expected no build_date without a build date")
+	}
+}
+
+func TestHeartbeatLogsEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.log")
+	l, err := logger.NewCredentialsLogger(logger.Config{LogFile: path, LogFormat: "json"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer l.Close()
+
+	h := StartHeartbeat(HeartbeatConfig{Interval: 10 * time.Millisecond, SensorID: "sensor-01"}, nil, l)
+	time.Sleep(35 * time.Millisecond)
+	h.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Invalid record %q: %v", scanner.Text(), err)
+		}
+		if record["event"] != "heartbeat" || record["sensor_id"] != "sensor-01" {
+			t.Errorf("Unexpected record: %s", scanner.Text())
+		}
+		lines++
+	}
+	if lines < 2 {
+		t.Errorf("Expected at least 2 heartbeats, got %d", lines)
+	}
+}
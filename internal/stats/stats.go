@@ -0,0 +1,147 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package stats keeps a runtime summary of the server for lightweight
+// dashboards: uptime, connection and attempt totals, top sources and
+// usernames, and sink health. Heartbeat events carry the totals downstream.
+package stats
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/metrics"
+)
+
+// Size of the top lists and the window they cover
+const (
+	topSize   = 10
+	topWindow = time.Hour
+)
+
+// Snapshot is the runtime summary returned by /stats
+type Snapshot struct {
+	Started           time.Time `json:"started"`
+	UptimeSeconds     int64     `json:"uptime_seconds"`
+	ConnectionsActive int64     `json:"connections_active"`
+	ConnectionsTotal  int64     `json:"connections_total"`
+	AttemptsTotal     int64     `json:"attempts_total"`
+	TopIPs            []Count   `json:"top_ips_last_hour"`
+	TopUsernames      []Count   `json:"top_usernames_last_hour"`
+	Sinks             []Sink    `json:"sinks"`
+}
+
+// Sink is the health of a log sink. Sinks are written synchronously, so
+// there is no queue: a failing sink shows up as consecutive errors.
+type Sink struct {
+	Name              string    `json:"name"`
+	Healthy           bool      `json:"healthy"`
+	ConsecutiveErrors int       `json:"consecutive_errors"`
+	LastError         string    `json:"last_error,omitempty"`
+	LastSuccess       time.Time `json:"last_success"`
+}
+
+// Collector counts authentication attempts by source and username, and
+// builds snapshots together with the metrics and the sink health
+type Collector struct {
+	start     time.Time
+	registry  *metrics.Registry
+	health    func() []logger.SinkHealth
+	ips       *windowCounter
+	usernames *windowCounter
+}
+
+// NewCollector creates a collector reading totals from registry and the
+// sink health from health
+func NewCollector(registry *metrics.Registry, health func() []logger.SinkHealth) *Collector {
+	return &Collector{
+		start:     time.Now(),
+		registry:  registry,
+		health:    health,
+		ips:       newWindowCounter(topWindow),
+		usernames: newWindowCounter(topWindow),
+	}
+}
+
+// Process counts authentication attempts, as they are logged
+func (c *Collector) Process(event *logger.Event) {
+	if event.Type != "auth_attempt" {
+		return
+	}
+
+	attempts := 1
+	if v, ok := event.Get("count"); ok {
+		if n, ok := v.(int); ok && n > 0 {
+			attempts = n
+		}
+	}
+
+	addr := event.GetString("remote_addr")
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	c.ips.add(addr, attempts)
+	c.usernames.add(event.GetString("username"), attempts)
+}
+
+// Snapshot returns the current summary
+func (c *Collector) Snapshot() Snapshot {
+	s := Snapshot{
+		Started:       c.start,
+		UptimeSeconds: int64(time.Since(c.start).Seconds()),
+		TopIPs:        c.ips.top(topSize),
+		TopUsernames:  c.usernames.top(topSize),
+	}
+	if c.health != nil {
+		for _, h := range c.health() {
+			s.Sinks = append(s.Sinks, Sink{
+				Name:              h.Name,
+				Healthy:           h.Healthy,
+				ConsecutiveErrors: h.ConsecutiveErrors,
+				LastError:         h.LastError,
+				LastSuccess:       h.LastSuccess,
+			})
+		}
+	}
+
+	snapshot := c.registry.Snapshot()
+	for _, g := range snapshot.Gauges {
+		if g.Name == metrics.ConnectionsActive {
+			s.ConnectionsActive = int64(g.Value)
+		}
+	}
+	for _, m := range snapshot.Counters {
+		switch m.Name {
+		case metrics.Connections:
+			s.ConnectionsTotal += int64(m.Value)
+		case metrics.AuthAttempts:
+			s.AttemptsTotal += int64(m.Value)
+		}
+	}
+	return s
+}
+
+// ServeHTTP returns the snapshot as JSON
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.Snapshot())
+}
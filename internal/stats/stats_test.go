@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/metrics"
+)
+
+func attempt(addr, username string) *logger.Event {
+	return logger.NewAuthEvent(logger.CredentialAttempt{
+		Timestamp:  time.Now(),
+		RemoteAddr: addr,
+		Username:   username,
+		Password:   "secret",
+	})
+}
+
+func TestCollectorSnapshot(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.Count(metrics.Connections, 2)
+	registry.AddGauge(metrics.ConnectionsActive, 1)
+	registry.Count(metrics.AuthAttempts, 3)
+
+	health := []logger.SinkHealth{{Name: "stdout", Healthy: true}}
+	c := NewCollector(registry, func() []logger.SinkHealth { return health })
+
+	c.Process(attempt("192.0.2.1:4000", "root"))
+	c.Process(attempt("192.0.2.1:4001", "admin"))
+	c.Process(attempt("[2001:db8::1]:22", "root"))
+	c.Process(&logger.Event{Type: "connection", Fields: []logger.Field{{Key: "remote_addr", Value: "192.0.2.9:4000"}}})
+
+	s := c.Snapshot()
+	if s.ConnectionsTotal != 2 || s.ConnectionsActive != 1 || s.AttemptsTotal != 3 {
+		t.Errorf("totals = %d/%d/%d, want 2/1/3", s.ConnectionsTotal, s.ConnectionsActive, s.AttemptsTotal)
+	}
+	if len(s.TopIPs) != 2 || s.TopIPs[0] != (Count{"192.0.2.1", 2}) || s.TopIPs[1] != (Count{"2001:db8::1", 1}) {
+		t.Errorf("top IPs = %v", s.TopIPs)
+	}
+	if len(s.TopUsernames) != 2 || s.TopUsernames[0] != (Count{"root", 2}) {
+		t.Errorf("top usernames = %v", s.TopUsernames)
+	}
+	if len(s.Sinks) != 1 || s.Sinks[0].Name != "stdout" || !s.Sinks[0].Healthy {
+		t.Errorf("sinks = %v", s.Sinks)
+	}
+}
+
+func TestCollectorCountsAggregatedAttempts(t *testing.T) {
+	c := NewCollector(nil, nil)
+	event := attempt("192.0.2.1:4000", "root")
+	event.Set("count", 5)
+	c.Process(event)
+
+	if top := c.Snapshot().TopIPs; len(top) != 1 || top[0].Count != 5 {
+		t.Errorf("top IPs = %v, want one address with 5 attempts", top)
+	}
+}
+
+func TestCollectorServeHTTP(t *testing.T) {
+	c := NewCollector(metrics.NewRegistry(), nil)
+	c.Process(attempt("192.0.2.1:4000", "root"))
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var s Snapshot
+	if err := json.NewDecoder(rec.Body).Decode(&s); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(s.TopUsernames) != 1 || s.TopUsernames[0].Value != "root" {
+		t.Errorf("top usernames = %v", s.TopUsernames)
+	}
+}
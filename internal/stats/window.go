@@ -0,0 +1,100 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// windowCounter counts values in a sliding window of one-minute buckets
+type windowCounter struct {
+	mu      sync.Mutex
+	window  time.Duration
+	buckets []bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	start  time.Time
+	counts map[string]int
+}
+
+// Count is the number of occurrences of a value
+type Count struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+func newWindowCounter(window time.Duration) *windowCounter {
+	return &windowCounter{window: window, now: time.Now}
+}
+
+// add counts n occurrences of a value
+func (w *windowCounter) add(value string, n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	start := w.now().Truncate(time.Minute)
+	if len(w.buckets) == 0 || w.buckets[len(w.buckets)-1].start.Before(start) {
+		w.buckets = append(w.buckets, bucket{start: start, counts: make(map[string]int)})
+	}
+	w.buckets[len(w.buckets)-1].counts[value] += n
+	w.expire()
+}
+
+// expire drops the buckets that left the window
+func (w *windowCounter) expire() {
+	cutoff := w.now().Add(-w.window)
+	i := 0
+	for i < len(w.buckets) && !w.buckets[i].start.Add(time.Minute).After(cutoff) {
+		i++
+	}
+	w.buckets = w.buckets[i:]
+}
+
+// top returns the n most frequent values of the window, ties in value order
+func (w *windowCounter) top(n int) []Count {
+	w.mu.Lock()
+	w.expire()
+	totals := make(map[string]int)
+	for _, b := range w.buckets {
+		for v, c := range b.counts {
+			totals[v] += c
+		}
+	}
+	w.mu.Unlock()
+
+	counts := make([]Count, 0, len(totals))
+	for v, c := range totals {
+		counts = append(counts, Count{Value: v, Count: c})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Value < counts[j].Value
+	})
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
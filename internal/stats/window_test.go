@@ -0,0 +1,46 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWindowCounterTop(t *testing.T) {
+	w := newWindowCounter(time.Hour)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+
+	w.add("root", 3)
+	w.add("admin", 1)
+	now = now.Add(10 * time.Minute)
+	w.add("admin", 2)
+	w.add("guest", 1)
+	w.add("user", 3)
+
+	want := []Count{{"admin", 3}, {"root", 3}, {"user", 3}}
+	if got := w.top(3); !reflect.DeepEqual(got, want) {
+		t.Errorf("top(3) = %v, want %v", got, want)
+	}
+}
+
+func TestWindowCounterExpires(t *testing.T) {
+	w := newWindowCounter(time.Hour)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+
+	w.add("root", 5)
+	now = now.Add(30 * time.Minute)
+	w.add("admin", 1)
+
+	now = now.Add(31 * time.Minute)
+	want := []Count{{"admin", 1}}
+	if got := w.top(10); !reflect.DeepEqual(got, want) {
+		t.Errorf("top(10) after an hour = %v, want %v", got, want)
+	}
+
+	now = now.Add(time.Hour)
+	if got := w.top(10); len(got) != 0 {
+		t.Errorf("top(10) after two hours = %v, want empty", got)
+	}
+}
@@ -0,0 +1,234 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+// Package stream sends events to HTTP clients as they are logged, as
+// Server-Sent Events or over WebSocket
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/rs/zerolog/log"
+)
+
+// Config contains settings of an event stream
+type Config struct {
+	// Maximum number of connected clients, unlimited if 0
+	MaxClients int
+	// Events queued per client; newer events are dropped for clients
+	// falling behind
+	Buffer int
+	// Interval of keep-alive messages
+	KeepAlive time.Duration
+}
+
+// errClosed is returned to clients connecting after Close
+var errClosed = errors.New("event stream closed")
+
+// Hub passes the logged events to the connected clients matching them. It
+// is a logger.Processor, to be added after the privacy processors.
+type Hub struct {
+	config Config
+	done   chan struct{}
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	closed  bool
+}
+
+// client is a connected client with its filter
+type client struct {
+	query   *report.Query
+	events  chan *logger.Event
+	dropped int
+}
+
+// New creates a hub without clients
+func New(config Config) *Hub {
+	if config.Buffer <= 0 {
+		config.Buffer = 256
+	}
+	if config.KeepAlive <= 0 {
+		config.KeepAlive = 30 * time.Second
+	}
+	return &Hub{
+		config:  config,
+		done:    make(chan struct{}),
+		clients: make(map[*client]struct{}),
+	}
+}
+
+// Process queues a copy of an event for the clients it matches
+func (h *Hub) Process(event *logger.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var clone *logger.Event
+	for c := range h.clients {
+		if !c.query.Match(event) {
+			continue
+		}
+		if clone == nil {
+			clone = event.Clone()
+		}
+		select {
+		case c.events <- clone:
+		default:
+			if c.dropped == 0 {
+				log.Warn().Msg("event stream client falling behind, dropping events")
+			}
+			c.dropped++
+		}
+	}
+}
+
+// Clients returns the number of connected clients
+func (h *Hub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// Close disconnects all clients
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.closed {
+		h.closed = true
+		close(h.done)
+	}
+	return nil
+}
+
+// subscribe registers a client for the events matching a query
+func (h *Hub) subscribe(query *report.Query) (*client, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, errClosed
+	}
+	if h.config.MaxClients > 0 && len(h.clients) >= h.config.MaxClients {
+		return nil, fmt.Errorf("too many clients")
+	}
+	c := &client{query: query, events: make(chan *logger.Event, h.config.Buffer)}
+	h.clients[c] = struct{}{}
+	return c, nil
+}
+
+// unsubscribe removes a client
+func (h *Hub) unsubscribe(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c)
+	if c.dropped > 0 {
+		log.Info().Int("dropped", c.dropped).Msg("event stream client disconnected after dropped events")
+	}
+}
+
+// ServeHTTP streams the events matching the filters of report.ParseQuery,
+// over WebSocket for upgrade requests and as Server-Sent Events otherwise
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query, err := report.ParseQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if isWebSocket(r) {
+		h.serveWebSocket(w, r, query)
+		return
+	}
+	h.serveEvents(w, r, query)
+}
+
+// serveEvents streams events as Server-Sent Events: the event ID as id and
+// the event as JSON in data
+func (h *Hub) serveEvents(w http.ResponseWriter, r *http.Request, query *report.Query) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	c, err := h.subscribe(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer h.unsubscribe(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Proxies such as nginx would buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(h.config.KeepAlive)
+	defer keepAlive.Stop()
+	var enc encoder
+	for {
+		select {
+		case event := <-c.events:
+			data, err := enc.encode(event)
+			if err != nil {
+				log.Debug().Err(err).Msg("event stream encoding error")
+				continue
+			}
+			if event.ID != "" && !strings.ContainsAny(event.ID, "\r\n") {
+				fmt.Fprintf(w, "id: %s\n", event.ID)
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// encoder writes events as single-line JSON in the format of the JSON export
+type encoder struct {
+	buf      bytes.Buffer
+	exporter report.Exporter
+}
+
+func (e *encoder) encode(event *logger.Event) ([]byte, error) {
+	if e.exporter == nil {
+		e.exporter, _ = report.NewExporter(report.ExportJSON, &e.buf, nil)
+	}
+	e.buf.Reset()
+	if err := e.exporter.Write(event); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(e.buf.Bytes()), nil
+}
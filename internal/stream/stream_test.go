@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/report"
+)
+
+func attempt(id, username string) *logger.Event {
+	event := logger.NewAuthEvent(logger.CredentialAttempt{
+		Timestamp:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		RemoteAddr: "192.0.2.1:4000",
+		Username:   username,
+		Password:   "123456",
+	})
+	event.ID = id
+	return event
+}
+
+// waitClients waits until the hub has n clients
+func waitClients(t *testing.T, h *Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for h.Clients() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d clients, got %d", n, h.Clients())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServerSentEvents(t *testing.T) {
+	h := New(Config{})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?username=root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q", ct)
+	}
+	waitClients(t, h, 1)
+
+	h.Process(attempt("e1", "admin"))
+	h.Process(attempt("e2", "root"))
+
+	r := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	if lines[0] != "id: e2" || !strings.HasPrefix(lines[1], `data: {"time":"2024-01-01T00:00:00Z","event":"auth_attempt","event_id":"e2"`) || lines[2] != "" {
+		t.Errorf("Unexpected stream: %q", lines)
+	}
+
+	h.Close()
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Errorf("Expected the stream to end when the hub is closed")
+	}
+	waitClients(t, h, 0)
+}
+
+func TestStreamRejects(t *testing.T) {
+	h := New(Config{MaxClients: 1})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?ip=host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid filter, got %d", resp.StatusCode)
+	}
+
+	first, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Body.Close()
+	waitClients(t, h, 1)
+	resp, err = http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 beyond the client limit, got %d", resp.StatusCode)
+	}
+}
+
+func TestSlowClientDropsEvents(t *testing.T) {
+	h := New(Config{Buffer: 2})
+	c, err := h.subscribe(&report.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		h.Process(attempt("e", "root"))
+	}
+	if len(c.events) != 2 || c.dropped != 3 {
+		t.Errorf("Expected 2 queued and 3 dropped events, got %d and %d", len(c.events), c.dropped)
+	}
+	h.unsubscribe(c)
+}
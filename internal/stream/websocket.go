@@ -0,0 +1,221 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+package stream
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/report"
+	"github.com/rs/zerolog/log"
+)
+
+// WebSocket opcodes (RFC 6455)
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xa
+)
+
+// websocketGUID is appended to the key of the client for the accept key
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxClientFrame is the largest frame read from clients, which only send
+// control frames to the stream
+const maxClientFrame = 4096
+
+// writeTimeout bounds the time to write a frame to a client
+const writeTimeout = 10 * time.Second
+
+// isWebSocket reports whether a request asks for a WebSocket upgrade
+func isWebSocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// acceptKey returns the Sec-WebSocket-Accept value for a client key
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// serveWebSocket streams events as text messages of JSON, one event each
+func (h *Hub) serveWebSocket(w http.ResponseWriter, r *http.Request, query *report.Query) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusBadRequest)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return
+	}
+	c, err := h.subscribe(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer h.unsubscribe(c)
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		log.Debug().Err(err).Msg("WebSocket upgrade error")
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	// Client frames are read in the background: pings are answered, a
+	// close frame or a read error ends the stream
+	pings := make(chan []byte, 1)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		readFrames(rw.Reader, pings)
+	}()
+
+	keepAlive := time.NewTicker(h.config.KeepAlive)
+	defer keepAlive.Stop()
+	var enc encoder
+	for {
+		var err error
+		select {
+		case event := <-c.events:
+			data, encErr := enc.encode(event)
+			if encErr != nil {
+				log.Debug().Err(encErr).Msg("event stream encoding error")
+				continue
+			}
+			err = writeFrame(conn, opText, data)
+		case payload := <-pings:
+			err = writeFrame(conn, opPong, payload)
+		case <-keepAlive.C:
+			err = writeFrame(conn, opPing, nil)
+		case <-closed:
+			writeFrame(conn, opClose, nil)
+			return
+		case <-h.done:
+			// 1001: going away
+			writeFrame(conn, opClose, []byte{0x03, 0xe9})
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeFrame writes an unfragmented, unmasked frame
+func writeFrame(conn net.Conn, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode, 0}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := (&net.Buffers{header, payload}).WriteTo(conn)
+	return err
+}
+
+// readFrames reads the frames of a client until it closes the connection,
+// passing the payload of pings on. Data frames are ignored.
+func readFrames(r *bufio.Reader, pings chan<- []byte) {
+	for {
+		opcode, payload, err := readFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Debug().Err(err).Msg("WebSocket read error")
+			}
+			return
+		}
+		switch opcode {
+		case opClose:
+			return
+		case opPing:
+			select {
+			case pings <- payload:
+			default:
+			}
+		}
+	}
+}
+
+// readFrame reads a frame of a client, which must be masked
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0f
+	if header[1]&0x80 == 0 {
+		return 0, nil, errors.New("unmasked client frame")
+	}
+	size := uint64(header[1] & 0x7f)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if size > maxClientFrame {
+		return 0, nil, fmt.Errorf("client frame of %d bytes too large", size)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
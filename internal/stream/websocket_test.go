@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialWebSocket opens a WebSocket connection to a test server
+func dialWebSocket(t *testing.T, url string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "GET /?type=auth_attempt HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected handshake response: %d %v", resp.StatusCode, resp.Header)
+	}
+	return conn, r
+}
+
+// serverFrame reads an unmasked frame of the server
+func serverFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	size := int(header[1] & 0x7f)
+	if size == 126 {
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		size = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+// clientFrame writes a masked frame as clients do
+func clientFrame(conn net.Conn, opcode byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	conn.Write(frame)
+}
+
+func TestWebSocket(t *testing.T) {
+	h := New(Config{})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	conn, r := dialWebSocket(t, ts.URL)
+	waitClients(t, h, 1)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	h.Process(attempt("e1", "root"))
+	opcode, payload := serverFrame(t, r)
+	if opcode != opText || !bytes.Contains(payload, []byte(`"event_id":"e1"`)) {
+		t.Errorf("Unexpected message: %d %s", opcode, payload)
+	}
+
+	clientFrame(conn, opPing, []byte("hello"))
+	if opcode, payload := serverFrame(t, r); opcode != opPong || string(payload) != "hello" {
+		t.Errorf("Expected pong, got %d %q", opcode, payload)
+	}
+
+	clientFrame(conn, opClose, nil)
+	if opcode, _ := serverFrame(t, r); opcode != opClose {
+		t.Errorf("Expected close frame, got %d", opcode)
+	}
+	waitClients(t, h, 0)
+}
+
+func TestWebSocketHubClose(t *testing.T) {
+	h := New(Config{})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	conn, r := dialWebSocket(t, ts.URL)
+	waitClients(t, h, 1)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	h.Close()
+	if opcode, payload := serverFrame(t, r); opcode != opClose || binary.BigEndian.Uint16(payload) != 1001 {
+		t.Errorf("Expected close frame going away, got %d %v", opcode, payload)
+	}
+}
+
+func TestReadFrameRejectsUnmasked(t *testing.T) {
+	if _, _, err := readFrame(bufio.NewReader(bytes.NewReader([]byte{0x81, 0x01, 'x'}))); err == nil {
+		t.Errorf("Expected error for an unmasked frame")
+	}
+	large := []byte{0x82, 0xff, 0, 0, 0, 0, 0, 1, 0, 0}
+	if _, _, err := readFrame(bufio.NewReader(bytes.NewReader(large))); err == nil {
+		t.Errorf("Expected error for a frame too large")
+	}
+}
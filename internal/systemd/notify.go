@@ -0,0 +1,129 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package systemd implements the service notification protocol of systemd
+// (sd_notify): readiness of Type=notify units and watchdog keep-alives
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Notification states
+const (
+	Ready    = "READY=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notify sends a state to the service manager. It returns false without an
+// error when the process is not run by systemd with a notification socket.
+func Notify(state string) (bool, error) {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return false, nil
+	}
+	// Abstract sockets are passed with a leading "@"
+	if name[0] == '@' {
+		name = "\x00" + name[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("notification socket error: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("notification error: %w", err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the watchdog timeout of the unit, or false if the
+// watchdog is not enabled for this process
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// Watchdogger sends keep-alives to the service manager while the service is healthy
+type Watchdogger struct {
+	interval time.Duration
+	check    func() error
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// StartWatchdog sends a keep-alive every half of the watchdog timeout as
+// long as check passes, so that systemd restarts a wedged service
+func StartWatchdog(timeout time.Duration, check func() error) *Watchdogger {
+	w := &Watchdogger{
+		interval: timeout / 2,
+		check:    check,
+		done:     make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.loop()
+	return w
+}
+
+func (w *Watchdogger) loop() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			err := w.check()
+			if err == nil {
+				_, err = Notify(Watchdog)
+			}
+			if err != nil && !failing {
+				log.Warn().Err(err).Msg("watchdog keep-alives suspended")
+			} else if err == nil && failing {
+				log.Info().Msg("watchdog keep-alives resumed")
+			}
+			failing = err != nil
+		}
+	}
+}
+
+// Close stops sending keep-alives
+func (w *Watchdogger) Close() error {
+	close(w.done)
+	w.wg.Wait()
+	return nil
+}
@@ -0,0 +1,94 @@
+package systemd
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// listen creates a notification socket and points NOTIFY_SOCKET at it
+func listen(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func receive(t *testing.T, conn *net.UnixConn, timeout time.Duration) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to receive notification: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	conn := listen(t)
+
+	sent, err := Notify(Ready)
+	if err != nil || !sent {
+		t.Fatalf("Notify() = %v, %v", sent, err)
+	}
+	if got := receive(t, conn, time.Second); got != Ready {
+		t.Errorf("Received %q, want %q", got, Ready)
+	}
+}
+
+func TestNotifyWithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := Notify(Ready)
+	if err != nil || sent {
+		t.Errorf("Notify() = %v, %v, want false without error", sent, err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", "")
+	if d, ok := WatchdogInterval(); !ok || d != 30*time.Second {
+		t.Errorf("WatchdogInterval() = %v, %v, want 30s", d, ok)
+	}
+
+	t.Setenv("WATCHDOG_PID", "1")
+	if _, ok := WatchdogInterval(); ok {
+		t.Error("Expected the watchdog of another process to be ignored")
+	}
+
+	t.Setenv("WATCHDOG_USEC", "")
+	if _, ok := WatchdogInterval(); ok {
+		t.Error("Expected the watchdog to be disabled")
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	conn := listen(t)
+
+	w := StartWatchdog(20*time.Millisecond, func() error { return nil })
+	defer w.Close()
+
+	if got := receive(t, conn, time.Second); got != Watchdog {
+		t.Errorf("Received %q, want %q", got, Watchdog)
+	}
+}
+
+func TestWatchdogFailingCheck(t *testing.T) {
+	conn := listen(t)
+
+	w := StartWatchdog(20*time.Millisecond, func() error { return errors.New("listener is not bound") })
+	defer w.Close()
+
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 256)); err == nil {
+		t.Error("Expected no keep-alive while the check fails")
+	}
+}
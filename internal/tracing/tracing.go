@@ -0,0 +1,337 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package tracing records spans of connection handling and exports them to
+// an OpenTelemetry collector over OTLP/HTTP
+package tracing
+
+import (
+	"context"
+	cryptoRand "crypto/rand"
+	"encoding/hex"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/abehterev/fakessh/internal/otlp"
+	"github.com/rs/zerolog/log"
+)
+
+// Kind is the role of a span in a trace
+type Kind int
+
+// Span kinds as defined by OTLP
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+)
+
+// OTLP status code of failed spans
+const statusError = 2
+
+// Config contains settings of the tracer
+type Config struct {
+	// Base URL of the collector, e.g. "http://localhost:4318"
+	Endpoint string
+	// Headers added to every export request
+	Headers map[string]string
+	// Attributes of the resource besides service.name and host.name
+	Resource map[string]string
+	// Share of traces recorded, from 0 to 1
+	SampleRatio float64
+	// Maximum number of spans per export request
+	BatchSize int
+	// Maximum number of spans waiting for export, further spans are dropped
+	QueueSize int
+	// How often spans are exported
+	FlushInterval time.Duration
+	// Timeout of a single export request
+	Timeout time.Duration
+}
+
+// Tracer creates spans and exports them in batches. A nil Tracer creates
+// no spans.
+type Tracer struct {
+	client    *otlp.Client
+	resource  otlp.Resource
+	ratio     float64
+	batchSize int
+	queueSize int
+	timeout   time.Duration
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+	failing bool
+
+	flush chan struct{}
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New creates a tracer exporting spans to a collector
+func New(cfg Config) *Tracer {
+	t := &Tracer{
+		client: otlp.NewClient(otlp.ClientConfig{
+			Endpoint: cfg.Endpoint,
+			Headers:  cfg.Headers,
+			Timeout:  cfg.Timeout,
+		}),
+		resource:  otlp.NewResource("fakessh", cfg.Resource),
+		ratio:     cfg.SampleRatio,
+		batchSize: cfg.BatchSize,
+		queueSize: cfg.QueueSize,
+		timeout:   cfg.Timeout,
+		flush:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.exportLoop(cfg.FlushInterval)
+	return t
+}
+
+// spanContext identifies the current span in a context
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+type contextKey struct{}
+
+// Start creates a span, a child of the span in ctx if there is one. The
+// returned span is nil if the trace is not sampled.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent, hasParent := ctx.Value(contextKey{}).(spanContext)
+	if hasParent && !parent.sampled {
+		return ctx, nil
+	}
+
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	cryptoRand.Read(s.spanID[:])
+	if hasParent {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		if rand.Float64() >= t.ratio {
+			return context.WithValue(ctx, contextKey{}, spanContext{}), nil
+		}
+		cryptoRand.Read(s.traceID[:])
+	}
+	return context.WithValue(ctx, contextKey{}, spanContext{traceID: s.traceID, spanID: s.spanID, sampled: true}), s
+}
+
+// Span is a timed operation of a trace. The methods of a nil Span do nothing.
+type Span struct {
+	tracer   *Tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     Kind
+
+	mu         sync.Mutex
+	start      time.Time
+	end        time.Time
+	attributes []otlp.KeyValue
+	err        string
+}
+
+// SetAttribute adds an attribute to the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, otlp.Attribute(key, value))
+}
+
+// RecordError marks the span as failed
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End finishes the span and queues it for export
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.enqueue(s)
+}
+
+// enqueue adds a finished span to the export queue
+func (t *Tracer) enqueue(s *Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.queue) >= t.queueSize {
+		t.dropped++
+		return
+	}
+	t.queue = append(t.queue, s)
+	if len(t.queue) >= t.batchSize {
+		select {
+		case t.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) exportLoop(interval time.Duration) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.Flush()
+		case <-t.flush:
+			t.Flush()
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// Flush exports all queued spans
+func (t *Tracer) Flush() {
+	for {
+		t.mu.Lock()
+		n := min(len(t.queue), t.batchSize)
+		batch := t.queue[:n:n]
+		t.queue = t.queue[n:]
+		dropped := t.dropped
+		t.dropped = 0
+		t.mu.Unlock()
+
+		if dropped > 0 {
+			log.Warn().Int("spans", dropped).Msg("trace export queue full, spans dropped")
+		}
+		if n == 0 {
+			return
+		}
+		t.export(batch)
+	}
+}
+
+// export sends a batch of spans to the collector
+func (t *Tracer) export(batch []*Span) {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		spans = append(spans, s.otlp())
+	}
+	payload := traceRequest{ResourceSpans: []resourceSpans{{
+		Resource:   t.resource,
+		ScopeSpans: []scopeSpans{{Scope: otlp.Scope{Name: "fakessh"}, Spans: spans}},
+	}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	err := t.client.Post(ctx, "/v1/traces", payload)
+
+	// Only changes of the export state are logged
+	if err != nil && !t.failing {
+		log.Warn().Err(err).Msg("trace export failed")
+	} else if err == nil && t.failing {
+		log.Info().Msg("trace export recovered")
+	}
+	t.failing = err != nil
+}
+
+// Close exports the remaining spans and stops the tracer
+func (t *Tracer) Close() error {
+	close(t.done)
+	t.wg.Wait()
+	t.Flush()
+	return nil
+}
+
+// OTLP/JSON representation of spans
+type traceRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   otlp.Resource `json:"resource"`
+	ScopeSpans []scopeSpans  `json:"scopeSpans"`
+}
+
+type scopeSpans struct {
+	Scope otlp.Scope `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlp.KeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: otlp.UnixNano(s.start),
+		EndTimeUnixNano:   otlp.UnixNano(s.end),
+		Attributes:        s.attributes,
+	}
+	if s.parentID != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	if s.err != "" {
+		span.Status = &otlpStatus{Code: statusError, Message: s.err}
+	}
+	return span
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector records the spans of OTLP/JSON trace exports
+type collector struct {
+	mu    sync.Mutex
+	spans []otlpSpan
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req traceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+}
+
+func newTestTracer(t *testing.T, ratio float64) (*Tracer, *collector) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	return New(Config{
+		Endpoint:      srv.URL,
+		SampleRatio:   ratio,
+		BatchSize:     100,
+		QueueSize:     1000,
+		FlushInterval: time.Hour,
+		Timeout:       time.Second,
+	}), c
+}
+
+func TestTracerExport(t *testing.T) {
+	tracer, c := newTestTracer(t, 1)
+
+	ctx, conn := tracer.Start(context.Background(), "connection", KindServer)
+	conn.SetAttribute("client.address", "203.0.113.10")
+	_, auth := tracer.Start(ctx, "auth_attempt", KindInternal)
+	auth.RecordError(errors.New("sink failed"))
+	auth.End()
+	conn.End()
+	conn.End()
+	tracer.Close()
+
+	if len(c.spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(c.spans))
+	}
+	child, root := c.spans[0], c.spans[1]
+	if root.Name != "connection" || root.Kind != KindServer || root.ParentSpanID != "" {
+		t.Errorf("Unexpected root span: %+v", root)
+	}
+	if child.TraceID != root.TraceID || child.ParentSpanID != root.SpanID {
+		t.Errorf("Expected child of the connection span, got %+v", child)
+	}
+	if child.Status == nil || child.Status.Code != statusError || child.Status.Message != "sink failed" {
+		t.Errorf("Expected error status, got %+v", child.Status)
+	}
+	if len(root.Attributes) != 1 || *root.Attributes[0].Value.StringValue != "203.0.113.10" {
+		t.Errorf("Unexpected attributes: %+v", root.Attributes)
+	}
+	if len(root.TraceID) != 32 || len(root.SpanID) != 16 {
+		t.Errorf("Expected hex encoded IDs, got %s %s", root.TraceID, root.SpanID)
+	}
+}
+
+func TestTracerSampling(t *testing.T) {
+	tracer, c := newTestTracer(t, 0)
+
+	ctx, root := tracer.Start(context.Background(), "connection", KindServer)
+	_, child := tracer.Start(ctx, "auth_attempt", KindInternal)
+	if root != nil || child != nil {
+		t.Errorf("Expected unsampled trace to have no spans")
+	}
+	child.SetAttribute("ssh.username", "root")
+	child.End()
+	tracer.Close()
+
+	if len(c.spans) != 0 {
+		t.Errorf("Expected no exported spans, got %d", len(c.spans))
+	}
+
+	var nilTracer *Tracer
+	if _, span := nilTracer.Start(context.Background(), "connection", KindServer); span != nil {
+		t.Errorf("Expected nil tracer to create no spans")
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package winsvc runs the server as a native Windows service: installation
+// with the service control manager, the service control handler and
+// messages to the Windows event log. On other systems the functions return
+// ErrNotSupported.
+package winsvc
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultName is the name of the service unless another one is given
+const DefaultName = "fakessh"
+
+// ErrNotSupported is returned on systems without Windows services
+var ErrNotSupported = errors.New("Windows services are only supported on Windows")
+
+// Config describes a service to install
+type Config struct {
+	// Name of the service, also the source of its event log messages
+	Name string
+	// Name shown in the services console
+	DisplayName string
+	Description string
+	// Absolute path of the executable and the arguments it is started with
+	Executable string
+	Args       []string
+	// Started on demand instead of at boot
+	Manual bool
+}
+
+// Severities of event log messages
+const (
+	severityInfo = iota
+	severityWarning
+	severityError
+)
+
+// severity returns the severity of the event log message of an operational
+// message level
+func severity(level zerolog.Level) int {
+	switch {
+	case level >= zerolog.ErrorLevel && level <= zerolog.PanicLevel:
+		return severityError
+	case level == zerolog.WarnLevel:
+		return severityWarning
+	}
+	return severityInfo
+}
+
+// eventMessage returns the text of an event log message written by zerolog
+func eventMessage(p []byte) string {
+	return strings.TrimRight(string(p), "\r\n")
+}
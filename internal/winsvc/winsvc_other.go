@@ -0,0 +1,58 @@
+//go:build !windows
+
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package winsvc
+
+import (
+	"context"
+	"io"
+)
+
+// Run runs a function as the service name until it returns
+func Run(name string, run func(ctx context.Context) error) error {
+	return ErrNotSupported
+}
+
+// Install creates the service and registers it as an event log source
+func Install(config Config) error {
+	return ErrNotSupported
+}
+
+// Uninstall removes the service and its event log source
+func Uninstall(name string) error {
+	return ErrNotSupported
+}
+
+// Start starts an installed service
+func Start(name string) error {
+	return ErrNotSupported
+}
+
+// Stop stops a running service and waits until it has stopped
+func Stop(name string) error {
+	return ErrNotSupported
+}
+
+// OpenEventLog returns a writer sending operational messages to the event
+// log as messages of the source name
+func OpenEventLog(name string) (io.WriteCloser, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,54 @@
+package winsvc
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSeverity(t *testing.T) {
+	tests := map[zerolog.Level]int{
+		zerolog.DebugLevel: severityInfo,
+		zerolog.InfoLevel:  severityInfo,
+		zerolog.NoLevel:    severityInfo,
+		zerolog.WarnLevel:  severityWarning,
+		zerolog.ErrorLevel: severityError,
+		zerolog.FatalLevel: severityError,
+		zerolog.PanicLevel: severityError,
+	}
+	for level, want := range tests {
+		if got := severity(level); got != want {
+			t.Errorf("severity(%s) = %d, want %d", level, got, want)
+		}
+	}
+}
+
+func TestEventMessage(t *testing.T) {
+	if got := eventMessage([]byte("{\"level\":\"info\"}\n")); got != `{"level":"info"}` {
+		t.Errorf("Unexpected message: %q", got)
+	}
+}
+
+func TestNotSupported(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("services are supported on Windows")
+	}
+	run := func(ctx context.Context) error { return nil }
+	for name, err := range map[string]error{
+		"Run":       Run(DefaultName, run),
+		"Install":   Install(Config{Name: DefaultName}),
+		"Uninstall": Uninstall(DefaultName),
+		"Start":     Start(DefaultName),
+		"Stop":      Stop(DefaultName),
+	} {
+		if !errors.Is(err, ErrNotSupported) {
+			t.Errorf("%s: expected ErrNotSupported, got %v", name, err)
+		}
+	}
+	if _, err := OpenEventLog(DefaultName); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("OpenEventLog: expected ErrNotSupported, got %v", err)
+	}
+}
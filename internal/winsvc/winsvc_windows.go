@@ -0,0 +1,260 @@
+//go:build windows
+
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package winsvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// eventID is the ID of every event log message; the messages are not
+// described by a message file
+const eventID = 1
+
+// stopTimeout bounds the wait for a stopped service
+const stopTimeout = time.Minute
+
+// handler runs the function of a service until it returns or the service
+// is stopped
+type handler struct {
+	run func(ctx context.Context) error
+	err error
+}
+
+// Execute reports the service running, and cancels the context of the
+// function on a stop or shutdown request
+func (h *handler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- h.run(ctx) }()
+	accepts := svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.Running, Accepts: accepts}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				h.err = err
+				// A service-specific exit code makes the manager apply the
+				// recovery actions
+				return true, 1
+			}
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
+
+// Run runs a function as the service name until it returns, or until the
+// service is stopped, which cancels its context. An error of the function
+// is written to the event log, since the service has no console.
+func Run(name string, run func(ctx context.Context) error) error {
+	h := &handler{run: run}
+	if err := svc.Run(name, h); err != nil {
+		return fmt.Errorf("service error: %w", err)
+	}
+	if h.err != nil {
+		if elog, err := eventlog.Open(name); err == nil {
+			elog.Error(eventID, h.err.Error())
+			elog.Close()
+		}
+	}
+	return h.err
+}
+
+// Install creates the service and registers it as an event log source.
+// Failed services are restarted after 5 seconds, then after a minute.
+func Install(config Config) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(config.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", config.Name)
+	}
+	startType := uint32(mgr.StartAutomatic)
+	if config.Manual {
+		startType = mgr.StartManual
+	}
+	s, err := m.CreateService(config.Name, config.Executable, mgr.Config{
+		DisplayName: config.DisplayName,
+		Description: config.Description,
+		StartType:   startType,
+	}, config.Args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	actions := []mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}
+	if err := s.SetRecoveryActions(actions, uint32((24 * time.Hour).Seconds())); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+	err = eventlog.InstallAsEventCreate(config.Name, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to register event log source: %w", err)
+	}
+	return nil
+}
+
+// Uninstall removes the service and its event log source. A running
+// service is removed once it stops.
+func Uninstall(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", name, err)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+	if err := eventlog.Remove(name); err != nil {
+		return fmt.Errorf("failed to remove event log source: %w", err)
+	}
+	return nil
+}
+
+// Start starts an installed service
+func Start(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", name, err)
+	}
+	defer s.Close()
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("failed to start service: %w", err)
+	}
+	return nil
+}
+
+// Stop stops a running service and waits until it has stopped
+func Stop(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", name, err)
+	}
+	defer s.Close()
+	status, err := s.Control(svc.Stop)
+	if errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stop service: %w", err)
+	}
+	for deadline := time.Now().Add(stopTimeout); status.State != svc.Stopped; {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service %s did not stop within %s", name, stopTimeout)
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return fmt.Errorf("failed to query service: %w", err)
+		}
+	}
+	return nil
+}
+
+// eventLog writes operational messages to the event log, with the
+// severity of their level
+type eventLog struct {
+	log *eventlog.Log
+}
+
+// OpenEventLog returns a writer sending operational messages to the event
+// log as messages of the source name
+func OpenEventLog(name string) (io.WriteCloser, error) {
+	l, err := eventlog.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	return &eventLog{log: l}, nil
+}
+
+// Write writes a message without a level as information
+func (e *eventLog) Write(p []byte) (int, error) {
+	return e.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel writes a message with the severity of its level
+func (e *eventLog) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var err error
+	switch msg := eventMessage(p); severity(level) {
+	case severityError:
+		err = e.log.Error(eventID, msg)
+	case severityWarning:
+		err = e.log.Warning(eventID, msg)
+	default:
+		err = e.log.Info(eventID, msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the event log
+func (e *eventLog) Close() error {
+	return e.log.Close()
+}
@@ -0,0 +1,330 @@
+/*
+ * FakeSSH - SSH server honeypot for monitoring brute force attacks
+ * Copyright (C) 2023 Andrey Bekhterev
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program; if not, write to the Free Software Foundation, Inc.,
+ * 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package fakessh embeds the honeypot in other Go programs, such as custom
+// honeynets and test rigs. A server rejects every authentication attempt
+// and passes the attempts as events to the sinks of the program and to the
+// channel returned by Events:
+//
+//	server, err := fakessh.NewServer(fakessh.WithPort(2222))
+//	if err != nil {
+//		return err
+//	}
+//	go func() {
+//		for event := range server.Events() {
+//			fmt.Println(event.GetString("remote_addr"), event.GetString("username"))
+//		}
+//	}()
+//	return server.Start(ctx)
+//
+// Unlike the fakessh command, the server writes no files: the log settings
+// of the configuration are not used. Operational messages go to the global
+// zerolog logger.
+package fakessh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	"github.com/abehterev/fakessh/internal/config"
+	"github.com/abehterev/fakessh/internal/logger"
+	"github.com/abehterev/fakessh/internal/sshserver"
+)
+
+// Errors of the server, wrapped by the errors returned, to be matched with
+// errors.Is
+var (
+	// ErrConfigInvalid is wrapped by the errors of settings that can not be
+	// parsed or are not valid
+	ErrConfigInvalid = config.ErrConfigInvalid
+	// ErrKeyLoad is wrapped by the errors of obtaining the host key
+	ErrKeyLoad = sshserver.ErrKeyLoad
+	// ErrBind is wrapped by the errors of listening on the port
+	ErrBind = sshserver.ErrBind
+	// ErrSinkUnavailable is wrapped by the errors of events no sink could
+	// store, which are logged as the server does not return them
+	ErrSinkUnavailable = logger.ErrSinkUnavailable
+)
+
+// Config contains the settings of the server, as in the configuration file
+// of the fakessh command
+type Config = config.Config
+
+// DefaultConfig returns the default settings
+func DefaultConfig() *Config {
+	return config.DefaultConfig()
+}
+
+// LoadConfig reads the settings of a configuration file and the FAKESSH_*
+// environment variables
+func LoadConfig(path string) (*Config, error) {
+	return config.LoadConfig(path)
+}
+
+// Event is a record of the honeypot, such as an "auth_attempt" with the
+// remote_addr, username, password and client_version fields
+type Event = logger.Event
+
+// Field is a key/value pair of an event
+type Field = logger.Field
+
+// Sink receives the events of the server. Write is called for one event at
+// a time per connection, from several connections at once; Close is
+// called when the server stops.
+type Sink = logger.Sink
+
+// SinkFunc adapts a function to the Sink interface
+type SinkFunc func(event *Event) error
+
+// Name returns "func"
+func (f SinkFunc) Name() string { return "func" }
+
+// Write calls f(event)
+func (f SinkFunc) Write(event *Event) error { return f(event) }
+
+// Close does nothing
+func (f SinkFunc) Close() error { return nil }
+
+// Hooks are called around connections and authentication attempts, after
+// the access settings of the configuration are applied: an error of
+// OnConnection disconnects the client and one of BeforeAuth rejects the
+// attempt without logging it. Hooks embed NopHooks for the calls they do
+// not implement.
+type Hooks = sshserver.Hooks
+
+// Attempt is an authentication attempt passed to the hooks, whose
+// credentials and delay may be changed
+type Attempt = sshserver.Attempt
+
+// NopHooks implements Hooks doing nothing
+type NopHooks = sshserver.NopHooks
+
+// Clock tells the time of connections and attempts and waits for the
+// delays of attempts, for tests not to wait
+type Clock = sshserver.Clock
+
+// Rand draws the random delays of attempts, such as a *rand.Rand with a
+// fixed seed for deterministic delays
+type Rand = sshserver.Rand
+
+// DefaultEventBuffer is the number of events the channel of Events holds
+const DefaultEventBuffer = logger.DefaultFeedBuffer
+
+// Option configures a server
+type Option func(*options)
+
+// options are the settings collected from the options of NewServer
+type options struct {
+	config   *Config
+	port     *int
+	listener net.Listener
+	sinks    []Sink
+	// Options passed on to the SSH server
+	server      []sshserver.Option
+	eventBuffer int
+}
+
+// WithConfig sets the settings of the server, the defaults otherwise. The
+// configuration is copied.
+func WithConfig(cfg *Config) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+// WithPort sets the port the server listens on, overriding the
+// configuration; 0 picks a free port, see Server.Addr. It is not used with
+// WithListener.
+func WithPort(port int) Option {
+	return func(o *options) {
+		o.port = &port
+	}
+}
+
+// WithListener makes the server accept connections on a listener instead
+// of listening on the port of the configuration, such as a socket bound
+// beforehand, a TLS listener or an in-memory listener in tests. The
+// listener is closed when Start returns.
+func WithListener(listener net.Listener) Option {
+	return func(o *options) {
+		o.listener = listener
+	}
+}
+
+// WithSink adds a sink receiving every event
+func WithSink(sink Sink) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, sink)
+	}
+}
+
+// WithHooks adds hooks, called in the order they are added
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) {
+		o.server = append(o.server, sshserver.WithHooks(hooks))
+	}
+}
+
+// WithClock sets the clock of the server, the system clock by default
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.server = append(o.server, sshserver.WithClock(clock))
+	}
+}
+
+// WithRand sets the generator of the random delays, math/rand by default.
+// Calls to it are serialized.
+func WithRand(r Rand) Option {
+	return func(o *options) {
+		o.server = append(o.server, sshserver.WithRand(r))
+	}
+}
+
+// WithEventBuffer sets the number of events the channel of Events holds
+// before new events are dropped, DefaultEventBuffer if not set or 0
+func WithEventBuffer(size int) Option {
+	return func(o *options) {
+		o.eventBuffer = size
+	}
+}
+
+// Server is an embedded honeypot, started once
+type Server struct {
+	config   *Config
+	server   *sshserver.Server
+	logger   *logger.CredentialsLogger
+	listener net.Listener
+	events   *logger.Subscription
+	started  atomic.Bool
+}
+
+// NewServer creates a server with the given options
+func NewServer(opts ...Option) (*Server, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	cfg := *config.DefaultConfig()
+	if o.config != nil {
+		cfg = *o.config
+	}
+	if o.port != nil {
+		cfg.Port = *o.port
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if o.eventBuffer < 0 {
+		return nil, fmt.Errorf("invalid event buffer: must not be negative")
+	}
+
+	// Events are counted as stored once written to a sink, so a server
+	// passing them to Events only has one discarding them
+	sinks := o.sinks
+	if len(sinks) == 0 {
+		sinks = []Sink{discardSink{}}
+	}
+	credLogger, err := logger.NewCredentialsLogger(logger.Config{
+		SkipMainLog:     true,
+		ExtraSinks:      sinks,
+		Tags:            cfg.Tags,
+		AggregateWindow: cfg.Log.AggregateWindow,
+	})
+	if err != nil {
+		return nil, err
+	}
+	server, err := sshserver.NewServer(&cfg, credLogger, o.server...)
+	if err != nil {
+		credLogger.Close()
+		return nil, err
+	}
+	return &Server{
+		config:   &cfg,
+		server:   server,
+		logger:   credLogger,
+		listener: o.listener,
+		events:   server.Subscribe(o.eventBuffer),
+	}, nil
+}
+
+// Start listens for connections until ctx is done, then gives the open
+// ones the shutdown_timeout of the configuration to end before closing
+// them. Once it returns, the sinks are closed and so is the channel of
+// Events.
+func (s *Server) Start(ctx context.Context) error {
+	if !s.started.CompareAndSwap(false, true) {
+		return fmt.Errorf("server already started")
+	}
+	defer s.logger.Close()
+
+	stopped := make(chan struct{})
+	shutdown := make(chan error, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+			defer cancel()
+			shutdown <- s.server.Shutdown(shutdownCtx)
+		case <-stopped:
+			shutdown <- nil
+		}
+	}()
+
+	var err error
+	if s.listener != nil {
+		err = s.server.Serve(s.listener)
+	} else {
+		err = s.server.Start()
+	}
+	close(stopped)
+	if shutdownErr := <-shutdown; err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+// Addr returns the address the server listens on, or nil while it is not
+// listening
+func (s *Server) Addr() net.Addr {
+	return s.server.Addr()
+}
+
+// Events returns the channel receiving every event, closed when Start
+// returns. Events are dropped rather than holding connections while the
+// channel is full; Dropped counts them.
+func (s *Server) Events() <-chan *Event {
+	return s.events.Events()
+}
+
+// Dropped returns the number of events dropped because the channel of
+// Events was full
+func (s *Server) Dropped() uint64 {
+	return s.events.Dropped()
+}
+
+// discardSink is the sink of servers without sinks of their own
+type discardSink struct{}
+
+func (discardSink) Name() string { return "discard" }
+
+func (discardSink) Write(event *Event) error { return nil }
+
+func (discardSink) Close() error { return nil }
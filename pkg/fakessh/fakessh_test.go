@@ -0,0 +1,197 @@
+package fakessh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startServer starts a server on a free port and returns its address and
+// the channel receiving the result of Start
+func startServer(t *testing.T, ctx context.Context, server *Server) (string, <-chan error) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- server.Start(ctx) }()
+	for deadline := time.Now().Add(5 * time.Second); server.Addr() == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Server not listening")
+		}
+	}
+	return server.Addr().String(), done
+}
+
+// serve starts a server accepting connections on a listener bound
+// beforehand, without waiting for it to listen
+func serve(t *testing.T, ctx context.Context, opts ...Option) (*Server, string, <-chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error: %v", err)
+	}
+	server, err := NewServer(append(opts, WithListener(listener))...)
+	if err != nil {
+		listener.Close()
+		t.Fatalf("NewServer() error: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.Start(ctx) }()
+	return server, listener.Addr().String(), done
+}
+
+// attempt makes an authentication attempt, which the server rejects
+func attempt(addr, user, password string) error {
+	_, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	return err
+}
+
+func TestServer(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Access.DelayMin, cfg.Access.DelayMax = 0, 0
+	cfg.Tags = map[string]string{"rig": "test"}
+
+	var mu sync.Mutex
+	var written []*Event
+	server, err := NewServer(WithConfig(cfg), WithPort(0), WithSink(SinkFunc(func(event *Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		written = append(written, event)
+		return nil
+	})))
+	if err != nil {
+		t.Fatalf("NewServer() error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, done := startServer(t, ctx, server)
+
+	if err := attempt(addr, "admin", "hunter2"); err == nil {
+		t.Fatal("Expected authentication to fail")
+	}
+	select {
+	case event := <-server.Events():
+		if event.Type != "auth_attempt" || event.GetString("username") != "admin" || event.GetString("password") != "hunter2" {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+		if event.GetString("rig") != "test" {
+			t.Errorf("Expected the tags of the configuration, got %+v", event.Fields)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No event received")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Start() error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() did not return after the context was canceled")
+	}
+	if _, ok := <-server.Events(); ok {
+		t.Error("Expected the event channel to be closed")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(written) != 1 {
+		t.Errorf("Expected 1 event in the sink, got %d", len(written))
+	}
+
+	if err := server.Start(context.Background()); err == nil {
+		t.Error("Expected an error when starting the server again")
+	}
+}
+
+func TestServerDroppedEvents(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Access.DelayMin, cfg.Access.DelayMax = 0, 0
+	ctx, cancel := context.WithCancel(context.Background())
+	server, addr, done := serve(t, ctx, WithConfig(cfg), WithEventBuffer(1))
+	attempt(addr, "root", "root")
+	attempt(addr, "admin", "admin")
+	cancel()
+	<-done
+
+	if server.Dropped() != 1 {
+		t.Errorf("Expected 1 dropped event, got %d", server.Dropped())
+	}
+}
+
+// refuseHooks refuses the attempts of a user
+type refuseHooks struct {
+	NopHooks
+	user string
+}
+
+func (h refuseHooks) BeforeAuth(ctx context.Context, attempt *Attempt) error {
+	if attempt.Credentials.Username == h.user {
+		return errors.New("refused")
+	}
+	return nil
+}
+
+func TestServerHooks(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Access.DelayMin, cfg.Access.DelayMax = 0, 0
+	ctx, cancel := context.WithCancel(context.Background())
+	server, addr, done := serve(t, ctx, WithConfig(cfg), WithHooks(refuseHooks{user: "blocked"}))
+	attempt(addr, "blocked", "blocked")
+	attempt(addr, "root", "root")
+	cancel()
+	<-done
+
+	var usernames []string
+	for event := range server.Events() {
+		usernames = append(usernames, event.GetString("username"))
+	}
+	if len(usernames) != 1 || usernames[0] != "root" {
+		t.Errorf("Expected only the attempt not refused, got %v", usernames)
+	}
+}
+
+func TestNewServerInvalid(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Port = 70000
+	if _, err := NewServer(WithConfig(cfg)); !errors.Is(err, ErrConfigInvalid) {
+		t.Errorf("Expected ErrConfigInvalid for an invalid port, got: %v", err)
+	}
+	cfg = DefaultConfig()
+	cfg.GenerateKey = false
+	cfg.PrivateKeyPath = filepath.Join(t.TempDir(), "host_key")
+	if err := os.WriteFile(cfg.PrivateKeyPath, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewServer(WithConfig(cfg)); !errors.Is(err, ErrKeyLoad) {
+		t.Errorf("Expected ErrKeyLoad for an invalid host key, got: %v", err)
+	}
+	if _, err := NewServer(WithEventBuffer(-1)); err == nil {
+		t.Error("Expected an error for a negative event buffer")
+	}
+}
+
+func TestServerBind(t *testing.T) {
+	listener, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatalf("Listen() error: %v", err)
+	}
+	defer listener.Close()
+	server, err := NewServer(WithPort(listener.Addr().(*net.TCPAddr).Port))
+	if err != nil {
+		t.Fatalf("NewServer() error: %v", err)
+	}
+	if err := server.Start(context.Background()); !errors.Is(err, ErrBind) {
+		t.Errorf("Expected ErrBind for a port in use, got: %v", err)
+	}
+}